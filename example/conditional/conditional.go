@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/d4l3k/go-pry/pry"
+)
+
+func main() {
+	pry.PryWithTimeout(time.Minute)
+	for i := 0; i < 10; i++ {
+		pry.PryIf(i == 5)
+		pry.PryIfFunc(func() bool { return i%7 == 6 })
+		pry.PryOnce()
+	}
+	fmt.Println("DUCK")
+}
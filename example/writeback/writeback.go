@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/d4l3k/go-pry/pry"
+)
+
+const attempts = 3
+
+func main() {
+	retries := attempts
+	for _, name := range []string{"db", "cache"} {
+		// Assigning to retries in the REPL changes what's printed, name is
+		// only a copy of the element.
+		pry.Pry()
+		fmt.Println(name, "retries:", retries)
+	}
+}
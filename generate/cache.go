@@ -0,0 +1,399 @@
+package generate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// cacheVersion changes whenever the format of the cache entries or what
+// they hold does, so older entries are never used.
+const cacheVersion = "go-pry exports 2"
+
+// DefaultPruneAge is how long a cache entry can go unused before Prune
+// removes it, as the go command does for GOCACHE.
+const DefaultPruneAge = 5 * 24 * time.Hour
+
+// cacheTouchAge is how old the modification time of an entry gets before a
+// hit updates it, which Prune goes by.
+const cacheTouchAge = time.Hour
+
+// Cache keeps the exports of packages between runs so only the packages
+// whose files changed are parsed again. Entries are keyed by a hash of the
+// package's import path, the names, sizes and modification times of its
+// files and the Go version.
+type Cache struct {
+	dir string
+
+	mu sync.Mutex
+	// mem holds the entries used by this process.
+	mem map[string][]export
+}
+
+// DefaultCacheDir returns the directory of the cache: $GOPRYCACHE, or
+// go-pry in the user's cache directory. It's empty if GOPRYCACHE is "off".
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv("GOPRYCACHE"); dir == "off" {
+		return "", nil
+	} else if len(dir) > 0 {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "finding the cache directory")
+	}
+	return filepath.Join(dir, "go-pry"), nil
+}
+
+// OpenCache opens the cache in dir, creating the directory if needed.
+func OpenCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating the cache")
+	}
+	return &Cache{dir: dir, mem: map[string][]export{}}, nil
+}
+
+// Dir returns the directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// exportsKey returns the key of the exports of the package at pkgPath made
+// of goFiles.
+func exportsKey(pkgPath, name string, goFiles []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", cacheVersion, runtime.Version(), pkgPath, name)
+	files := append([]string(nil), goFiles...)
+	sort.Strings(files)
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return "", errors.Wrapf(err, "hashing %s", pkgPath)
+		}
+		fmt.Fprintf(h, "%s %d %d\n", file, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listKey returns the key of the packages paths resolve to from dir. It
+// covers what the go command resolves them with: the environment, the Go
+// version and the module, workspace and vendor files of dir.
+func listKey(dir string, buildFlags, env []string, paths []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", cacheVersion, runtime.Version(), dir)
+	for _, name := range []string{"GOOS", "GOARCH", "GOFLAGS", "CGO_ENABLED", "GO111MODULE", "GOPATH", "GOROOT", "GOWORK"} {
+		fmt.Fprintf(h, "%s=%s\n", name, os.Getenv(name))
+	}
+	fmt.Fprintf(h, "%q\n%q\n", buildFlags, env)
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	fmt.Fprintf(h, "%q\n", sorted)
+	for d := dir; ; d = filepath.Dir(d) {
+		for _, name := range []string{"go.mod", "go.sum", "go.work", "go.work.sum", filepath.Join("vendor", "modules.txt")} {
+			data, err := ioutil.ReadFile(filepath.Join(d, name))
+			if err != nil && !os.IsNotExist(err) {
+				return "", errors.Wrap(err, "hashing the module")
+			}
+			fmt.Fprintf(h, "%s %d\n", filepath.Join(d, name), len(data))
+			h.Write(data)
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listedPackage is a package paths resolved to, as kept in the cache.
+type listedPackage struct {
+	PkgPath string
+	Name    string
+	GoFiles []string
+	// Dir and DirModTime tell whether files were added or removed.
+	Dir        string
+	DirModTime int64
+	ExportsKey string
+}
+
+// current returns whether p still has the files it was listed with.
+func (p listedPackage) current() bool {
+	fi, err := os.Stat(p.Dir)
+	if err != nil || fi.ModTime().UnixNano() != p.DirModTime {
+		return false
+	}
+	key, err := exportsKey(p.PkgPath, p.Name, p.GoFiles)
+	return err == nil && key == p.ExportsKey
+}
+
+// path returns the file of the entry key of the given kind.
+func (c *Cache) path(key, kind string) string {
+	return filepath.Join(c.dir, key[:2], key+"-"+kind)
+}
+
+// get decodes the entry key into v.
+func (c *Cache) get(key, kind string, v interface{}) bool {
+	path := c.path(key, kind)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false
+	}
+	if fi, err := os.Stat(path); err == nil && time.Since(fi.ModTime()) > cacheTouchAge {
+		now := time.Now()
+		os.Chtimes(path, now, now)
+	}
+	return true
+}
+
+// put stores v as the entry key. The entry is written to a temporary file
+// first so concurrent runs never read a partial entry.
+func (c *Cache) put(key, kind string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "encoding the cache entry")
+	}
+	path := c.path(key, kind)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "writing the cache entry")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), key+"-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "writing the cache entry")
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "writing the cache entry")
+	}
+	return nil
+}
+
+// exports returns the exports stored under key.
+func (c *Cache) exports(key string) ([]export, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if exports, ok := c.mem[key]; ok {
+		return exports, true
+	}
+	var exports []export
+	if !c.get(key, "exports", &exports) {
+		return nil, false
+	}
+	c.mem[key] = exports
+	return exports, true
+}
+
+// putExports stores exports under key.
+func (c *Cache) putExports(key string, exports []export) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mem[key] = exports
+	return c.put(key, "exports", exports)
+}
+
+// Prune removes the entries that weren't used for maxAge, which are those
+// of packages that changed or aren't imported anymore, and returns how many
+// it removed.
+func (c *Cache) Prune(maxAge time.Duration) (int, error) {
+	removed := 0
+	err := filepath.Walk(c.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		if !strings.HasSuffix(name, "-exports") && !strings.HasSuffix(name, "-list") && !strings.HasSuffix(name, ".tmp") {
+			return nil
+		}
+		if time.Since(info.ModTime()) <= maxAge {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, errors.Wrap(err, "pruning the cache")
+	}
+	return removed, nil
+}
+
+// loadedPackage is an imported package and its exports.
+type loadedPackage struct {
+	Name    string
+	PkgPath string
+	Errors  []packages.Error
+	Exports []export
+}
+
+// loadPackages loads the packages at paths. Only the packages parse returns
+// true for are parsed; the others have no exports. With a cache the go
+// command isn't run at all when none of the packages changed, and only the
+// packages that did are parsed.
+func (g *Generator) loadPackages(paths []string, parse func(path string) bool) (map[string]*loadedPackage, error) {
+	if g.Cache == nil {
+		var parsed, listed []string
+		for _, path := range paths {
+			if parse(path) {
+				parsed = append(parsed, path)
+			} else {
+				listed = append(listed, path)
+			}
+		}
+		loaded := map[string]*loadedPackage{}
+		for _, load := range []struct {
+			mode  packages.LoadMode
+			paths []string
+		}{{g.Config.Mode, parsed}, {packages.NeedName, listed}} {
+			if len(load.paths) == 0 {
+				continue
+			}
+			conf := g.Config
+			conf.Mode = load.mode
+			pkgs, err := packages.Load(&conf, load.paths...)
+			if err != nil {
+				return nil, errors.Wrap(err, "loading the imports")
+			}
+			for _, pkg := range pkgs {
+				loaded[pkg.PkgPath] = &loadedPackage{Name: pkg.Name, PkgPath: pkg.PkgPath, Errors: pkg.Errors, Exports: packageExports(pkg.Syntax)}
+			}
+		}
+		return loaded, nil
+	}
+
+	listKey, err := listKey(g.Config.Dir, g.Config.BuildFlags, g.Config.Env, paths)
+	if err != nil {
+		return nil, err
+	}
+	var listed []listedPackage
+	if g.Cache.get(listKey, "list", &listed) {
+		if loaded, ok := g.cachedPackages(listed, parse); ok {
+			return loaded, nil
+		}
+	}
+
+	// Listing the files is much cheaper than parsing them, which also runs
+	// cgo.
+	conf := g.Config
+	conf.Mode = packages.NeedName | packages.NeedFiles
+	pkgs, err := packages.Load(&conf, paths...)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading the imports")
+	}
+	loaded := map[string]*loadedPackage{}
+	listed = nil
+	// Packages with errors or outside of a directory are listed again
+	// next time.
+	listable := true
+	keys := map[string]string{}
+	var missed []string
+	for _, pkg := range pkgs {
+		l := &loadedPackage{Name: pkg.Name, PkgPath: pkg.PkgPath, Errors: pkg.Errors}
+		loaded[pkg.PkgPath] = l
+		if len(pkg.Errors) > 0 {
+			listable = false
+			continue
+		}
+		key, err := exportsKey(pkg.PkgPath, pkg.Name, pkg.GoFiles)
+		if err != nil {
+			return nil, err
+		}
+		if len(pkg.GoFiles) == 0 {
+			listable = false
+		} else if dir := filepath.Dir(pkg.GoFiles[0]); listable {
+			fi, err := os.Stat(dir)
+			if err != nil {
+				return nil, errors.Wrapf(err, "listing %s", pkg.PkgPath)
+			}
+			listed = append(listed, listedPackage{
+				PkgPath: pkg.PkgPath, Name: pkg.Name, GoFiles: pkg.GoFiles,
+				Dir: dir, DirModTime: fi.ModTime().UnixNano(), ExportsKey: key,
+			})
+		}
+		if !parse(pkg.PkgPath) {
+			continue
+		}
+		if exports, ok := g.Cache.exports(key); ok {
+			l.Exports = exports
+			continue
+		}
+		keys[pkg.PkgPath] = key
+		missed = append(missed, pkg.PkgPath)
+	}
+
+	if len(missed) > 0 {
+		g.Debug(" :: Parsing %d packages missing from the cache.\n", len(missed))
+		conf.Mode = packages.NeedName | packages.NeedSyntax
+		pkgs, err = packages.Load(&conf, missed...)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading the imports")
+		}
+		for _, pkg := range pkgs {
+			l, ok := loaded[pkg.PkgPath]
+			if !ok {
+				continue
+			}
+			if len(pkg.Errors) > 0 {
+				l.Errors = pkg.Errors
+				listable = false
+				continue
+			}
+			l.Exports = packageExports(pkg.Syntax)
+			if err := g.Cache.putExports(keys[pkg.PkgPath], l.Exports); err != nil {
+				g.Debug(" :: %v\n", err)
+			}
+		}
+	}
+
+	if listable {
+		if err := g.Cache.put(listKey, "list", listed); err != nil {
+			g.Debug(" :: %v\n", err)
+		}
+	}
+	return loaded, nil
+}
+
+// cachedPackages returns the packages in listed from the cache if none of
+// them changed and the exports of those parse returns true for are cached.
+func (g *Generator) cachedPackages(listed []listedPackage, parse func(path string) bool) (map[string]*loadedPackage, bool) {
+	loaded := map[string]*loadedPackage{}
+	for _, p := range listed {
+		if !p.current() {
+			return nil, false
+		}
+		l := &loadedPackage{Name: p.Name, PkgPath: p.PkgPath}
+		if parse(p.PkgPath) {
+			exports, ok := g.Cache.exports(p.ExportsKey)
+			if !ok {
+				return nil, false
+			}
+			l.Exports = exports
+		}
+		loaded[p.PkgPath] = l
+	}
+	return loaded, true
+}
@@ -0,0 +1,119 @@
+package generate
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFile is the file, next to go.mod, listing the packages whose exports
+// aren't generated. Each line is a pattern of import paths, such as
+// "k8s.io/...". Lines starting with "!" list packages that are always
+// generated, even if another line or the size limit would skip them, and
+// lines starting with "#" are comments.
+const IgnoreFile = ".pryignore"
+
+// PackageFilter decides which imported packages have their exports
+// generated. Large packages make the instrumented file slow to compile, so
+// they can be skipped. Skipped packages are still in scope, as stubs that
+// explain why their members are missing.
+//
+// Patterns match import paths like those of the go command: "..." matches
+// any string, so "k8s.io/..." matches k8s.io and the packages under it.
+type PackageFilter struct {
+	// Include, if set, lists the only packages generated. The packages it
+	// lists are generated regardless of MaxExports.
+	Include []string
+	// Exclude lists the packages that aren't generated.
+	Exclude []string
+	// Allow lists the packages generated even if Exclude or MaxExports
+	// would skip them.
+	Allow []string
+	// MaxExports skips the packages with more exports unless they're listed
+	// by Include or Allow. Zero doesn't limit them.
+	MaxExports int
+}
+
+// patternRegexp compiles a pattern of import paths.
+func patternRegexp(pattern string) *regexp.Regexp {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
+	// Like the go command, "foo/..." matches foo too.
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	return regexp.MustCompile("^" + re + "$")
+}
+
+// matchAny returns whether path matches one of the patterns.
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if patternRegexp(pattern).MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded returns why the patterns skip the package at path, or "" if they
+// don't.
+func (f *PackageFilter) excluded(path string) string {
+	if matchAny(f.Allow, path) {
+		return ""
+	}
+	if len(f.Include) > 0 && !matchAny(f.Include, path) {
+		return "not included"
+	}
+	if matchAny(f.Exclude, path) {
+		return "excluded"
+	}
+	return ""
+}
+
+// skipReason returns why the package at path with n exports isn't
+// generated, or "" if it is.
+func (f *PackageFilter) skipReason(path string, n int) string {
+	if reason := f.excluded(path); len(reason) > 0 {
+		return reason
+	}
+	if f.MaxExports > 0 && n > f.MaxExports && !matchAny(f.Allow, path) && !matchAny(f.Include, path) {
+		return fmt.Sprintf("%d exports, more than %d", n, f.MaxExports)
+	}
+	return ""
+}
+
+// withIgnoreFile returns the filter with the patterns of the IgnoreFile of
+// the module of dir added.
+func (f PackageFilter) withIgnoreFile(dir string) (PackageFilter, error) {
+	path := filepath.Join(moduleRoot(dir), IgnoreFile)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return f, errors.Wrapf(err, "reading %s", path)
+	}
+	defer file.Close()
+
+	f.Exclude = append([]string(nil), f.Exclude...)
+	f.Allow = append([]string(nil), f.Allow...)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(line) == 0 || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "!"):
+			f.Allow = append(f.Allow, strings.TrimSpace(line[1:]))
+		default:
+			f.Exclude = append(f.Exclude, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return f, errors.Wrapf(err, "reading %s", path)
+	}
+	return f, nil
+}
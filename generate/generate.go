@@ -11,18 +11,31 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
-	"github.com/d4l3k/go-pry/pry"
 	"github.com/pkg/errors"
 	"golang.org/x/tools/go/packages"
 )
 
 type Generator struct {
 	contexts []pryContext
-	debug    bool
-	Config   packages.Config
+	// copies counts the enclosing range statements declaring each name.
+	copies map[string]int
+	debug  bool
+	Config packages.Config
+	// Instantiations are the instantiations of generics generated for the
+	// REPL, in the form of DefaultInstantiations. The instantiations the
+	// instrumented file writes out, such as slices.Sort[[]T], are generated
+	// too.
+	Instantiations map[string][]string
+	// Cache keeps the exports of the imported packages between runs. Nil
+	// parses every import each time.
+	Cache *Cache
+	// Filter skips imported packages, along with the IgnoreFile of the
+	// module of the instrumented file.
+	Filter PackageFilter
 }
 
 func NewGenerator(debug bool) *Generator {
@@ -31,6 +44,7 @@ func NewGenerator(debug bool) *Generator {
 		Config: packages.Config{
 			Mode: packages.NeedName | packages.NeedSyntax,
 		},
+		Instantiations: DefaultInstantiations,
 	}
 }
 
@@ -56,6 +70,36 @@ func (g *Generator) ExecuteGoCmd(ctx context.Context, args []string, env []strin
 	return cmd.Run()
 }
 
+// NoopTag is the build tag that turns breakpoints into no-ops. Nothing needs
+// to be injected into builds that set it.
+const NoopTag = "prynoop"
+
+// HasBuildTag reports whether the arguments of a go command or goflags, the
+// value of GOFLAGS, set the build tag.
+func HasBuildTag(args []string, goflags, tag string) bool {
+	args = append(strings.Fields(goflags), args...)
+	for i, arg := range args {
+		var tags string
+		switch {
+		case arg == "-tags" || arg == "--tags":
+			if i+1 < len(args) {
+				tags = args[i+1]
+			}
+		case strings.HasPrefix(arg, "-tags="):
+			tags = strings.TrimPrefix(arg, "-tags=")
+		case strings.HasPrefix(arg, "--tags="):
+			tags = strings.TrimPrefix(arg, "--tags=")
+		}
+		// Tags are separated by commas or, in older versions of Go, spaces.
+		for _, t := range strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ' ' }) {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // InjectPry walks the scope and replaces pry.Pry with pry.Apply(pry.Scope{...}).
 func (g *Generator) InjectPry(filePath string) (string, error) {
 	g.Debug("Prying into %s\n", filePath)
@@ -65,6 +109,7 @@ func (g *Generator) InjectPry(filePath string) (string, error) {
 	}
 
 	g.contexts = make([]pryContext, 0)
+	g.copies = map[string]int{}
 
 	fset := token.NewFileSet() // positions are relative to fset
 
@@ -77,33 +122,12 @@ func (g *Generator) InjectPry(filePath string) (string, error) {
 
 	g.Config.Dir = filepath.Dir(filePath)
 
-	packagePairs := []string{}
-	for _, imp := range f.Imports {
-		importStr := imp.Path.Value[1 : len(imp.Path.Value)-1]
-		if importStr != "../pry" {
-			pkgs, err := packages.Load(&g.Config, importStr)
-			if err != nil {
-				return "", err
-			}
-			pkg := pkgs[0]
-			importName := pkg.Name
-			if imp.Name != nil {
-				importName = imp.Name.Name
-			}
-			pair := "\"" + importName + "\": pry.Package{Name: \"" + pkg.Name + "\", Functions: map[string]interface{}{"
-			added := make(map[string]bool)
-			exports, err := g.GetExports(importName, pkg.Syntax, added)
-			if err != nil {
-				return "", err
-			}
-			pair += exports
-			pair += "}}, "
-			packagePairs = append(packagePairs, pair)
-		}
-	}
-
 	var funcs []*ast.FuncDecl
 	var vars []string
+	// values are the names that aren't variables, so their address can't be
+	// taken and changes made in the REPL can't be written back.
+	values := map[string]bool{}
+	consts := map[string]bool{}
 
 	// Print the imports from the file's AST.
 	for k, v := range f.Scope.Objects {
@@ -112,11 +136,16 @@ func (g *Generator) InjectPry(filePath string) (string, error) {
 			funcs = append(funcs, decl)
 		case *ast.ValueSpec:
 			vars = append(vars, k)
+			if v.Kind == ast.Con {
+				values[k] = true
+				consts[k] = true
+			}
 		}
 	}
 
 	for _, f := range funcs {
 		vars = append(vars, f.Name.Name)
+		values[f.Name.Name] = true
 		if f.Recv != nil {
 			vars = g.extractFields(vars, f.Recv.List)
 		}
@@ -137,6 +166,7 @@ func (g *Generator) InjectPry(filePath string) (string, error) {
 	}
 
 	fileText := (string)(fileTextBytes)
+	originalText := fileText
 
 	offset := 0
 
@@ -146,110 +176,350 @@ func (g *Generator) InjectPry(filePath string) (string, error) {
 
 	g.Debug(" :: Found %d pry statements.\n", len(g.contexts))
 
+	packagePairs, dotMembers, err := g.packagePairs(f)
+	if err != nil {
+		return "", err
+	}
+
 	for _, context := range g.contexts {
 		filteredVars := filterVars(context.Vars)
+		// Variables are captured by address so assignments in the REPL
+		// change the program.
+		var readOnly []string
 		obj := "&pry.Scope{Vals:map[string]interface{}{ "
 		for _, v := range filteredVars {
-			obj += "\"" + v + "\": " + v + ", "
+			if values[v] {
+				obj += "\"" + v + "\": " + v + ", "
+			} else {
+				obj += "\"" + v + "\": &" + v + ", "
+			}
+			if consts[v] || context.Copies[v] {
+				readOnly = append(readOnly, strconv.Quote(v)+": true")
+			}
+		}
+		// Dot imported members are hidden by the variables with the same
+		// name.
+		inScope := map[string]bool{}
+		for _, v := range filteredVars {
+			inScope[v] = true
+		}
+		for _, m := range dotMembers {
+			if inScope[m.name] || len(m.unavailable) > 0 {
+				continue
+			}
+			obj += strconv.Quote(m.name) + ": " + m.expr + ", "
+			if m.kind == ast.Con || m.kind == ast.Typ || m.generic {
+				readOnly = append(readOnly, strconv.Quote(m.name)+": true")
+			}
 		}
 		obj += strings.Join(packagePairs, "")
-		obj += "}}"
+		obj += "}"
+		if len(readOnly) > 0 {
+			obj += ", ReadOnly: map[string]bool{" + strings.Join(readOnly, ", ") + "}"
+		}
+		obj += "}"
 		text := "pry.Apply(" + obj + ")"
+		// Conditional breakpoints only build the scope when they open the
+		// REPL. The replacement stays on one line so Apply reports the line
+		// of the original call.
+		switch context.Kind {
+		case "PryIf":
+			text = "if " + originalText[context.ArgStart:context.ArgEnd] + " { " + text + " }"
+		case "PryIfFunc":
+			text = "if (" + originalText[context.ArgStart:context.ArgEnd] + ")() { " + text + " }"
+		case "PryWithTimeout":
+			text = "pry.Apply(" + obj + ", pry.WithTimeout(" + originalText[context.ArgStart:context.ArgEnd] + "))"
+		case "PryOnce":
+			line := strings.Count(originalText[:context.Start], "\n") + 1
+			key := fmt.Sprintf("%s:%d", filePath, line)
+			text = "if pry.Once(" + strconv.Quote(key) + ") { " + text + " }"
+		}
 		fileText = fileText[0:context.Start+offset] + text + fileText[context.End+offset:]
-		offset = len(text) - (context.End - context.Start)
+		offset += len(text) - (context.End - context.Start)
 	}
 
-	newPath := filepath.Dir(filePath) + "/." + filepath.Base(filePath) + "pry"
-
-	err = os.Rename(filePath, newPath)
-	if err != nil {
+	if err := instrument(filePath, fileTextBytes, []byte(fileText)); err != nil {
 		return "", err
 	}
-	ioutil.WriteFile(filePath, ([]byte)(fileText), 0644)
 	return filePath, nil
 }
 
-// GetExports returns a string of gocode that represents the exports (constants/functions) of an ast.Package.
+// packagePairs returns the scope entries of the packages imported by f,
+// bound under the name the file uses for them, and the members of the
+// packages it dot imports, which are in scope on their own. The imports are
+// resolved by the go command from the directory of the file, so they follow
+// its go.mod, including replace directives, and vendoring.
+func (g *Generator) packagePairs(f *ast.File) ([]string, []member, error) {
+	type importSpec struct {
+		name, path string
+	}
+	var imports []importSpec
+	var paths []string
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "import %s", imp.Path.Value)
+		}
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		// Blank imports don't bind a name and C isn't a package.
+		if name == "_" || path == "C" {
+			continue
+		}
+		imports = append(imports, importSpec{name, path})
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, nil, nil
+	}
+	filter, err := g.Filter.withIgnoreFile(g.Config.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Packages the patterns skip aren't parsed at all.
+	byPath, err := g.loadPackages(paths, func(path string) bool {
+		return len(filter.excluded(path)) == 0
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The names the imported packages are referred to by, which
+	// instantiations can use in their type arguments.
+	importNames := map[string]bool{}
+	for _, imp := range imports {
+		if imp.name == "" {
+			if pkg, ok := byPath[imp.path]; ok {
+				importNames[pkg.Name] = true
+			}
+		} else if imp.name != "." {
+			importNames[imp.name] = true
+		}
+	}
+	// Whether the module can instantiate generics is only checked once
+	// the configured instantiations of a package are needed.
+	var checked, instantiable bool
+	canInstantiate := func() (bool, error) {
+		if !checked {
+			var err error
+			if instantiable, err = g.instantiable(); err != nil {
+				return false, err
+			}
+			checked = true
+		}
+		return instantiable, nil
+	}
+
+	var pairs, unavailable []string
+	var dots []member
+	dotted := map[string]bool{}
+	for _, imp := range imports {
+		pkg, ok := byPath[imp.path]
+		if !ok {
+			return nil, nil, errors.Errorf("import %q wasn't loaded", imp.path)
+		}
+		importName := imp.name
+		if importName == "" {
+			importName = pkg.Name
+		}
+		// The build reports the errors, if they aren't only those of
+		// parsing the package, such as some using cgo. The session
+		// shouldn't fail because of one import.
+		if len(pkg.Errors) > 0 {
+			log.Printf("go-pry: skipping the import %q: %v", imp.path, pkg.Errors[0])
+			if importName != "." && len(pkg.Name) > 0 {
+				pairs = append(pairs, stubPair(importName, pkg.Name, pkg.PkgPath, "failed to load"))
+			}
+			continue
+		}
+		for _, e := range pkg.Exports {
+			if len(e.Unavailable) > 0 {
+				unavailable = append(unavailable, pkg.Name+"."+e.Name+" ("+e.Unavailable+")")
+			}
+		}
+		if reason := filter.skipReason(pkg.PkgPath, len(pkg.Exports)); len(reason) > 0 {
+			g.Debug(" :: Skipping %s (%s).\n", pkg.PkgPath, reason)
+			if importName != "." {
+				pairs = append(pairs, stubPair(importName, pkg.Name, pkg.PkgPath, reason))
+			}
+			continue
+		}
+		used := usedInstantiations(f, importName, importNames)
+		instances, err := g.instantiations(pkg.PkgPath, used, canInstantiate)
+		if err != nil {
+			return nil, nil, err
+		}
+		if importName == "." {
+			dots = append(dots, exportedMembers("", pkg.Exports, dotted, instances)...)
+			continue
+		}
+		// The members are only built once the session uses the package.
+		pair := "\"" + importName + "\": pry.LazyPackage(\"" + pkg.Name + "\", " + strconv.Quote(pkg.PkgPath) + ", func() pry.Package { return pry.Package{"
+		pair += g.packageFields(importName, pkg.Exports, make(map[string]bool), instances)
+		pair += "} }), "
+		pairs = append(pairs, pair)
+	}
+	if len(unavailable) > 0 {
+		log.Printf("go-pry: left %d members the generated code can't refer to out of the scope: %s", len(unavailable), strings.Join(unavailable, ", "))
+	}
+	return pairs, dots, nil
+}
+
+// stubPair returns the scope entry of a package whose members were skipped
+// for the given reason.
+func stubPair(importName, pkgName, pkgPath, reason string) string {
+	return "\"" + importName + "\": pry.Package{Name: \"" + pkgName + "\", Path: " + strconv.Quote(pkgPath) + ", Skipped: " + strconv.Quote(reason) + "}, "
+}
+
+// GetExports returns the fields of a pry.Package literal holding the exports
+// of an ast.Package: the functions in Functions, pointers to the variables
+// in Variables, the constants in Consts and the types in Types.
 func (g *Generator) GetExports(importName string, files []*ast.File, added map[string]bool) (string, error) {
-	vars := ""
+	return g.packageFields(importName, packageExports(files), added, nil), nil
+}
+
+// packageFields is GetExports of the exports of a package imported as
+// importName, with its generics instantiated with instances. Members the
+// generated code can't refer to are listed in Unavailable instead.
+func (g *Generator) packageFields(importName string, exports []export, added map[string]bool, instances map[string][]string) string {
+	var funcs, vars, consts, typs, generics, unavailable string
+	sep := ","
+	if g.debug {
+		sep += "\n"
+	}
+	for _, m := range exportedMembers(importName+".", exports, added, instances) {
+		entry := strconv.Quote(m.name) + ": " + m.expr + sep
+		switch {
+		case len(m.unavailable) > 0:
+			unavailable += strconv.Quote(m.name) + ": " + strconv.Quote(m.unavailable) + sep
+		case m.generic:
+			generics += entry
+		case m.kind == ast.Typ:
+			typs += entry
+		case m.kind == ast.Var:
+			vars += entry
+		case m.kind == ast.Con:
+			consts += entry
+		default:
+			funcs += entry
+		}
+	}
+
+	fields := "Functions: map[string]interface{}{" + funcs + "}"
+	if len(vars) > 0 {
+		fields += ", Variables: map[string]interface{}{" + vars + "}"
+	}
+	if len(consts) > 0 {
+		fields += ", Consts: map[string]interface{}{" + consts + "}"
+	}
+	if len(typs) > 0 {
+		fields += ", Types: pry.TypeMap{" + typs + "}"
+	}
+	if len(generics) > 0 {
+		fields += ", Generics: map[string]pry.Generic{" + generics + "}"
+	}
+	if len(unavailable) > 0 {
+		fields += ", Unavailable: map[string]string{" + unavailable + "}"
+	}
+	return fields
+}
+
+// member is an exported member of a package and the expression referring
+// to it in the instrumented file.
+type member struct {
+	kind ast.ObjKind
+	name string
+	expr string
+	// generic is set for generic functions and types, whose expr is a
+	// pry.Generic.
+	generic bool
+	// unavailable is why the member can't be referred to, in which case
+	// there's no expr.
+	unavailable string
+}
+
+// export is an exported member of a package, as kept in the cache.
+type export struct {
+	Kind    ast.ObjKind
+	Name    string
+	Generic bool
+	// Convert is the type constants are converted to when their default
+	// type can't hold their value.
+	Convert string
+	// Unavailable is why the generated code can't refer to the member. It's
+	// empty if it can.
+	Unavailable string
+}
+
+// packageExports returns the sorted exported members declared by the files
+// of a package.
+func packageExports(files []*ast.File) []export {
+	convert, unavailable := checkConstants(files)
+	seen := map[string]bool{}
+	var exports []export
 	for _, file := range files {
-		// Print the imports from the file's AST.
-		scope := pry.NewScope()
 		for k, obj := range file.Scope.Objects {
-			if added[k] {
+			if seen[k] {
 				continue
 			}
-			added[k] = true
+			seen[k] = true
 			firstLetter := k[0:1]
-			if firstLetter == strings.ToUpper(firstLetter) && firstLetter != "_" {
-
-				isType := false
-
-				switch stmt := obj.Decl.(type) {
-				/*
-					case *ast.ValueSpec:
-						if len(stmt.Values) > 0 {
-							out, err := pry.InterpretExpr(scope, stmt.Values[0])
-							if err != nil {
-								fmt.Println("ERR", err)
-								//continue
-							} else {
-								scope[obj.Name] = out
-							}
-						}
-				*/
-				case *ast.TypeSpec:
-					switch typ := stmt.Type.(type) {
-					case *ast.StructType:
-						isType = true
-						scope.Set(obj.Name, typ)
-
-					default:
-						out, err := scope.Interpret(stmt.Type)
-						if err != nil {
-							g.Debug("TypeSpec ERR %s\n", err.Error())
-							//continue
-						} else {
-							scope.Set(obj.Name, out)
-							isType = true
-						}
-					}
-				}
+			if firstLetter != strings.ToUpper(firstLetter) || firstLetter == "_" {
+				continue
+			}
+			exports = append(exports, export{Kind: obj.Kind, Name: k, Generic: isGeneric(obj), Convert: convert[k], Unavailable: unavailable[k]})
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].Name < exports[j].Name
+	})
+	return exports
+}
 
-				if obj.Kind != ast.Typ || isType {
-					path := importName + "." + k
-					vars += "\"" + k + "\": "
-					if isType {
-						out, _ := scope.Get(obj.Name)
-						switch v := out.(type) {
-						case reflect.Type:
-							zero := reflect.Zero(v).Interface()
-							val := fmt.Sprintf("%#v", zero)
-							if zero == nil {
-								val = "nil"
-							}
-							vars += fmt.Sprintf("pry.Type(%s(%s))", path, val)
-						case *ast.StructType:
-							vars += fmt.Sprintf("pry.Type(%s{})", path)
-						default:
-							log.Fatalf("got unknown type: %T %+v", out, out)
-						}
-
-						// TODO Fix hack for very large constants
-					} else if path == "math.MaxUint64" || path == "crc64.ISO" || path == "crc64.ECMA" {
-						vars += fmt.Sprintf("uint64(%s)", path)
-					} else {
-						vars += path
-					}
-					vars += ","
-					if g.debug {
-						vars += "\n"
-					}
-				}
+// exportedMembers returns the exports of a package, which is referred to
+// through qualifier, such as "m." or "" for a dot import.
+// Generics are instantiated with the type arguments in instances. Names in
+// added are skipped and the returned ones are added to it.
+func exportedMembers(qualifier string, exports []export, added map[string]bool, instances map[string][]string) []member {
+	var members []member
+	for _, e := range exports {
+		k := e.Name
+		if added[k] {
+			continue
+		}
+		added[k] = true
+
+		m := member{kind: e.Kind, name: k, expr: qualifier + k}
+		if len(e.Unavailable) > 0 {
+			m.unavailable = e.Unavailable
+			members = append(members, m)
+			continue
+		}
+		if e.Generic {
+			m.generic = true
+			m.expr = genericExpr(m, e.Kind == ast.Typ, instances[k])
+			members = append(members, m)
+			continue
+		}
+		switch e.Kind {
+		case ast.Typ:
+			// A nil pointer works for every kind of type, including
+			// interfaces.
+			m.expr = "pry.Type((*" + m.expr + ")(nil)).Elem()"
+
+		case ast.Var:
+			m.expr = "&" + m.expr
+
+		case ast.Con:
+			if len(e.Convert) > 0 {
+				m.expr = e.Convert + "(" + m.expr + ")"
 			}
 		}
+		members = append(members, m)
 	}
-	return vars, nil
+	return members
 }
 
 // GenerateFile generates a injected file.
@@ -297,20 +567,28 @@ func (g *Generator) GenerateAndExecuteFile(ctx context.Context, imports []string
 // RevertPry reverts the changes made by InjectPry.
 func (g *Generator) RevertPry(modifiedFiles []string) error {
 	fmt.Println("Reverting files")
+	var errs []string
 	for _, file := range modifiedFiles {
-		newPath := filepath.Dir(file) + "/." + filepath.Base(file) + "pry"
-		if _, err := os.Stat(newPath); os.IsNotExist(err) {
-			return errors.Errorf("no such file or directory: %s", newPath)
-		}
-
-		err := os.Remove(file)
+		file, err := filepath.Abs(file)
 		if err != nil {
 			return err
 		}
-		err = os.Rename(newPath, file)
+		m, err := loadManifest(stateDir(file))
 		if err != nil {
 			return err
 		}
+		// Files that were changed since aren't restored, but the others
+		// still are.
+		found, err := m.restore(file)
+		if !found {
+			err = restoreLegacy(file)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
 	}
 	return nil
 }
@@ -380,10 +658,36 @@ func (g *Generator) handleIfStmt(vars []string, stmt *ast.IfStmt) []string {
 func (g *Generator) handleRangeStmt(vars []string, stmt *ast.RangeStmt) []string {
 	vars = g.handleExpr(vars, stmt.Key)
 	vars = g.handleExpr(vars, stmt.Value)
+	// The variables declared by the range are copies of the elements, so
+	// assigning to them doesn't change what's ranged over.
+	var declared []string
+	if stmt.Tok == token.DEFINE {
+		for _, expr := range []ast.Expr{stmt.Key, stmt.Value} {
+			if ident, ok := expr.(*ast.Ident); ok {
+				declared = append(declared, ident.Name)
+				g.copies[ident.Name]++
+			}
+		}
+	}
 	vars = g.handleStatement(vars, stmt.Body)
+	for _, name := range declared {
+		g.copies[name]--
+	}
 	return vars
 }
 
+// currentCopies returns the names declared by the range statements the
+// current statement is in.
+func (g *Generator) currentCopies() map[string]bool {
+	copies := map[string]bool{}
+	for name, n := range g.copies {
+		if n > 0 {
+			copies[name] = true
+		}
+	}
+	return copies
+}
+
 func (g *Generator) handleForStmt(vars []string, stmt *ast.ForStmt) []string {
 	vars = g.handleStatement(vars, stmt.Init)
 	vars = g.handleStatement(vars, stmt.Body)
@@ -416,8 +720,17 @@ func (g *Generator) handleExpr(vars []string, v ast.Expr) []string {
 		switch fun := expr.Fun.(type) {
 		case *ast.SelectorExpr:
 			funcName := fun.Sel.Name
-			if funcName == "Pry" || funcName == "Apply" {
-				g.contexts = append(g.contexts, pryContext{(int)(expr.Pos() - 1), (int)(expr.End() - 1), vars})
+			switch funcName {
+			case "Pry", "Apply", "PryOnce":
+				g.contexts = append(g.contexts, pryContext{Start: (int)(expr.Pos() - 1), End: (int)(expr.End() - 1), Vars: vars, Kind: funcName, Copies: g.currentCopies()})
+			case "PryIf", "PryIfFunc", "PryWithTimeout":
+				if len(expr.Args) == 1 {
+					arg := expr.Args[0]
+					g.contexts = append(g.contexts, pryContext{
+						Start: (int)(expr.Pos() - 1), End: (int)(expr.End() - 1), Vars: vars, Kind: funcName, Copies: g.currentCopies(),
+						ArgStart: (int)(arg.Pos() - 1), ArgEnd: (int)(arg.End() - 1),
+					})
+				}
 			}
 			//handleExpr(vars, fun.X)
 		case *ast.FuncLit:
@@ -453,4 +766,11 @@ func (g *Generator) handleExpr(vars []string, v ast.Expr) []string {
 type pryContext struct {
 	Start, End int
 	Vars       []string
+	// Kind is the name of the function called, such as "Pry" or "PryIf".
+	Kind string
+	// ArgStart and ArgEnd are the position of the argument of PryIf,
+	// PryIfFunc and PryWithTimeout.
+	ArgStart, ArgEnd int
+	// Copies are the range variables in scope.
+	Copies map[string]bool
 }
@@ -1,9 +1,18 @@
 package generate
 
 import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestImportPry(t *testing.T) {
@@ -41,7 +50,677 @@ func TestImportPry(t *testing.T) {
 	}
 }
 
+func TestInjectPryWriteBack(t *testing.T) {
+	g := NewGenerator(false)
+	file := "../example/writeback/writeback.go"
+	res, err := g.InjectPry(file)
+	if err != nil {
+		t.Fatalf("Failed to inject pry %v", err)
+	}
+	defer g.RevertPry([]string{res})
+
+	out, err := ioutil.ReadFile(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"retries": &retries, `,
+		`"name": &name, `,
+		`"attempts": attempts, `,
+		`"main": main, `,
+		`ReadOnly: map[string]bool{`,
+		`"attempts": true`,
+		`"name": true`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected %q in the generated file:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), `"retries": true`) {
+		t.Errorf("retries shouldn't be read-only:\n%s", out)
+	}
+	if out, err := exec.Command("go", "build", "-o", os.DevNull, filepath.Dir(file)).CombinedOutput(); err != nil {
+		t.Errorf("the generated file doesn't build: %v\n%s", err, out)
+	}
+}
+
 func fileExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	return !os.IsNotExist(err)
 }
+
+func TestInjectConditionalPry(t *testing.T) {
+	g := NewGenerator(false)
+	file := "../example/conditional/conditional.go"
+	res, err := g.InjectPry(file)
+	if err != nil {
+		t.Fatalf("Failed to inject pry %v", err)
+	}
+	defer g.RevertPry([]string{res})
+
+	out, err := ioutil.ReadFile(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"if i == 5 { pry.Apply(&pry.Scope{",
+		"if (func() bool { return i%7 == 6 })() { pry.Apply(&pry.Scope{",
+		"if pry.Once(" + strconv.Quote(abs+":15") + ") { pry.Apply(&pry.Scope{",
+		"}}, pry.WithTimeout(time.Minute))",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected %q in the generated file:\n%s", want, out)
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), res, out, 0); err != nil {
+		t.Errorf("the generated file doesn't parse: %v", err)
+	}
+}
+
+func TestHasBuildTag(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		args    []string
+		goflags string
+		want    bool
+	}{
+		{[]string{"-tags", "prynoop", "."}, "", true},
+		{[]string{"-tags=foo,prynoop", "."}, "", true},
+		{[]string{"--tags", "foo prynoop"}, "", true},
+		{[]string{"-o", "out", "."}, "-mod=mod -tags=prynoop", true},
+		{[]string{"-tags", "prynoopx", "."}, "", false},
+		{[]string{"prynoop"}, "", false},
+		{[]string{"-tags"}, "", false},
+		{nil, "", false},
+	}
+	for i, c := range cases {
+		if got := HasBuildTag(c.args, c.goflags, NoopTag); got != c.want {
+			t.Errorf("%d. HasBuildTag(%q, %q): Expected %#v got %#v.", i, c.args, c.goflags, c.want, got)
+		}
+	}
+}
+
+func TestInjectPryReplacedModule(t *testing.T) {
+	g := NewGenerator(false)
+	file := "testdata/replace/app/main.go"
+	res, err := g.InjectPry(file)
+	if err != nil {
+		t.Fatalf("Failed to inject pry %v", err)
+	}
+	defer g.RevertPry([]string{res})
+
+	out, err := ioutil.ReadFile(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"greet": pry.LazyPackage("greet", "example.com/greet", func() pry.Package { return pry.Package{Functions: map[string]interface{}{"Hello": greet.Hello,}, ` +
+			`Variables: map[string]interface{}{"Greeting": &greet.Greeting,}, ` +
+			`Consts: map[string]interface{}{"Punctuation": greet.Punctuation,}, ` +
+			`Types: pry.TypeMap{"Greeter": pry.Type((*greet.Greeter)(nil)).Elem(),}} })`,
+		`"pry": pry.LazyPackage("pry", "github.com/d4l3k/go-pry/pry", `,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected %q in the generated file:\n%s", want, out)
+		}
+	}
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = filepath.Dir(file)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("the generated file doesn't build: %v\n%s", err, out)
+	}
+}
+
+func TestInjectPryImportNames(t *testing.T) {
+	g := NewGenerator(false)
+	file := "testdata/imports/imports.go"
+	res, err := g.InjectPry(file)
+	if err != nil {
+		t.Fatalf("Failed to inject pry %v", err)
+	}
+	defer g.RevertPry([]string{res})
+
+	out, err := ioutil.ReadFile(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"fmt": pry.LazyPackage("fmt", "fmt", `,
+		`"m": pry.LazyPackage("math", "math", `,
+		`"Sqrt": m.Sqrt,`,
+		`"MaxUint64": uint64(m.MaxUint64),`,
+		`"ToUpper": ToUpper, `,
+		`"Builder": pry.Type((*Builder)(nil)).Elem(), `,
+		`"Count": &Count, `,
+		`"Builder": true`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected %q in the generated file:\n%s", want, out)
+		}
+	}
+	for _, unwanted := range []string{`"png"`, `"_"`, `"strings"`, `"math"`, `"Count": Count`} {
+		if strings.Contains(string(out), unwanted+":") {
+			t.Errorf("Didn't expect %q in the generated file:\n%s", unwanted, out)
+		}
+	}
+	if out, err := exec.Command("go", "build", "-o", os.DevNull, "./"+filepath.Dir(file)).CombinedOutput(); err != nil {
+		t.Errorf("the generated file doesn't build: %v\n%s", err, out)
+	}
+}
+
+func TestInjectPryGenerics(t *testing.T) {
+	g := NewGenerator(false)
+	file := "testdata/generics/main.go"
+	res, err := g.InjectPry(file)
+	if err != nil {
+		t.Fatalf("Failed to inject pry %v", err)
+	}
+	defer g.RevertPry([]string{res})
+
+	out, err := ioutil.ReadFile(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"Sort": pry.Generic{Name: "slices.Sort", Instances: map[string]interface{}{"[]float64": slices.Sort[[]float64], "[]int": slices.Sort[[]int], "[]string": slices.Sort[[]string], }},`,
+		`"Map": pry.Generic{Name: "stack.Map", Instances: map[string]interface{}{"int, string": stack.Map[int, string], }},`,
+		`"Stack": pry.Generic{Name: "stack.Stack", Instances: map[string]interface{}{"point": pry.Type((*stack.Stack[point])(nil)).Elem(), }},`,
+		`Functions: map[string]interface{}{"Depth": stack.Depth,}`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected %q in the generated file:\n%s", want, out)
+		}
+	}
+	cmd := exec.Command("go", "build", "-o", os.DevNull, ".")
+	cmd.Dir = filepath.Dir(file)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("the generated file doesn't build: %v\n%s", err, out)
+	}
+}
+
+func TestInstantiable(t *testing.T) {
+	t.Parallel()
+
+	// The module of go-pry predates generics.
+	for dir, want := range map[string]bool{"../example/file": false, "testdata/generics": true} {
+		g := NewGenerator(false)
+		g.Config.Dir = dir
+		got, err := g.instantiable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: Expected %#v got %#v.", dir, want, got)
+		}
+	}
+}
+
+func TestNormalizeTypeArgs(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"[]int":                  "[]int",
+		"map[string] int":        "map[string]int",
+		"string,int":             "string, int",
+		"map[string]int, string": "map[string]int, string",
+	}
+	for in, want := range cases {
+		got, err := normalizeTypeArgs(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: Expected %#v got %#v.", in, want, got)
+		}
+	}
+	if _, err := normalizeTypeArgs("[]"); err == nil {
+		t.Error("Expected an error for invalid type arguments")
+	}
+}
+
+func TestCacheInjectPry(t *testing.T) {
+	file := "testdata/replace/app/main.go"
+	inject := func(g *Generator) string {
+		res, err := g.InjectPry(file)
+		if err != nil {
+			t.Fatalf("Failed to inject pry %v", err)
+		}
+		defer g.RevertPry([]string{res})
+		out, err := ioutil.ReadFile(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	want := inject(NewGenerator(false))
+
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		g := NewGenerator(false)
+		g.Cache = cache
+		if got := inject(g); got != want {
+			t.Errorf("%d. Expected the file generated without the cache got:\n%s", i, got)
+		}
+	}
+	lists, _ := filepath.Glob(filepath.Join(cache.Dir(), "*", "*-list"))
+	if len(lists) != 1 {
+		t.Errorf("Expected one list entry got %#v.", lists)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "p"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write("go.mod", "module example.com/tmp\n\ngo 1.16\n")
+	write("p/p.go", "package p\n\nfunc A() {}\n")
+
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func() []string {
+		g := NewGenerator(false)
+		g.Cache = cache
+		g.Config.Dir = dir
+		pkgs, err := g.loadPackages([]string{"example.com/tmp/p"}, func(string) bool { return true })
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, e := range pkgs["example.com/tmp/p"].Exports {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+	for i, c := range []struct {
+		change func()
+		want   []string
+	}{
+		{func() {}, []string{"A"}},
+		{func() {}, []string{"A"}},
+		{func() { write("p/p.go", "package p\n\nfunc A() {}\n\nfunc B() {}\n") }, []string{"A", "B"}},
+		{func() { write("p/c.go", "package p\n\nconst C = 1\n") }, []string{"A", "B", "C"}},
+	} {
+		c.change()
+		if got := names(); !reflect.DeepEqual(c.want, got) {
+			t.Errorf("%d. Expected %#v got %#v.", i, c.want, got)
+		}
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	t.Parallel()
+
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"aaaa", "bbbb"} {
+		if err := cache.putExports(key, []export{{Name: "A"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * DefaultPruneAge)
+	if err := os.Chtimes(cache.path("aaaa", "exports"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := cache.Prune(DefaultPruneAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected %#v got %#v.", 1, removed)
+	}
+	if _, err := os.Stat(cache.path("bbbb", "exports")); err != nil {
+		t.Errorf("the recent entry was removed: %v", err)
+	}
+}
+
+// tempModule writes files to a new module requiring this copy of go-pry and
+// returns its directory.
+func tempModule(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := ioutil.ReadFile("../go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["go.mod"] = "module example.com/tmp\n\ngo 1.16\n\nrequire github.com/d4l3k/go-pry v0.0.0\n\nreplace github.com/d4l3k/go-pry => " + root + "\n"
+	files["go.sum"] = string(sum)
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var crashFiles = map[string]string{
+	"a.go": "package main\n\nimport \"github.com/d4l3k/go-pry/pry\"\n\nfunc main() {\n\tpry.Pry()\n\tb()\n}\n",
+	"b.go": "package main\n\nimport \"github.com/d4l3k/go-pry/pry\"\n\nfunc b() {\n\tpry.Pry()\n}\n",
+}
+
+func TestRestoreAfterCrash(t *testing.T) {
+	for _, step := range []string{"manifest", "sidecar"} {
+		files := map[string]string{}
+		for name, content := range crashFiles {
+			files[name] = content
+		}
+		dir := tempModule(t, files)
+
+		g := NewGenerator(false)
+		if _, err := g.InjectPry(filepath.Join(dir, "a.go")); err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			crashHook = func(s string) {
+				if s == step {
+					panic("crash")
+				}
+			}
+			defer func() {
+				crashHook = func(string) {}
+				if recover() == nil {
+					t.Fatalf("%s: Expected a crash", step)
+				}
+			}()
+			g.InjectPry(filepath.Join(dir, "b.go"))
+		}()
+
+		report, err := NewGenerator(false).Doctor(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if len(report) == 0 {
+			t.Errorf("%s: Expected a report of the repairs", step)
+		}
+		for name, want := range crashFiles {
+			got, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != want {
+				t.Errorf("%s: %s wasn't restored:\n%s", step, name, got)
+			}
+			if fileExists(sidecarPath(filepath.Join(dir, name))) {
+				t.Errorf("%s: the copy of %s wasn't removed", step, name)
+			}
+		}
+		m, err := loadManifest(moduleStateDir(dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Entries) != 0 {
+			t.Errorf("%s: Expected an empty manifest got %#v.", step, m.Entries)
+		}
+		backups, _ := ioutil.ReadDir(filepath.Join(moduleStateDir(dir), "backups"))
+		if len(backups) != 0 {
+			t.Errorf("%s: Expected no backups left got %d.", step, len(backups))
+		}
+	}
+}
+
+func TestRevertPryKeepsEdits(t *testing.T) {
+	dir := tempModule(t, map[string]string{"a.go": crashFiles["a.go"]})
+	path := filepath.Join(dir, "a.go")
+
+	g := NewGenerator(false)
+	if _, err := g.InjectPry(path); err != nil {
+		t.Fatal(err)
+	}
+	edited := []byte("package main\n\nfunc main() {}\n")
+	if err := ioutil.WriteFile(path, edited, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.RevertPry([]string{path}); err == nil {
+		t.Error("Expected an error restoring an edited file")
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(edited) {
+		t.Errorf("the edited file was overwritten:\n%s", got)
+	}
+	m, err := loadManifest(moduleStateDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup, err := ioutil.ReadFile(m.backupPath(m.Entries[path].Original))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(backup) != crashFiles["a.go"] {
+		t.Errorf("Expected the original to be kept got:\n%s", backup)
+	}
+}
+
+func TestTestPackages(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"."}},
+		{[]string{"-v", "-run", "TestFoo"}, []string{"."}},
+		{[]string{"./pkg", "-run", "TestFoo", "-count=1"}, []string{"./pkg"}},
+		{[]string{"-tags", "a,b", "-v", "./a/...", "./b"}, []string{"./a/...", "./b"}},
+		{[]string{"-test.timeout", "1m", "./pkg", "-args", "other"}, []string{"./pkg"}},
+	}
+	for _, c := range cases {
+		if got := TestPackages(c.args); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("TestPackages(%q): Expected %#v got %#v.", c.args, c.want, got)
+		}
+	}
+}
+
+func TestTestArgs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"test", "./pkg"}, []string{"test", "-timeout", "0", "./pkg"}},
+		{[]string{"test", "-timeout=1m", "./pkg"}, []string{"test", "-timeout=1m", "./pkg"}},
+		{[]string{"test", "./pkg", "-args", "-timeout"}, []string{"test", "-timeout", "0", "./pkg", "-args", "-timeout"}},
+	}
+	for _, c := range cases {
+		if got := TestArgs(c.args); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("TestArgs(%q): Expected %#v got %#v.", c.args, c.want, got)
+		}
+	}
+}
+
+func TestInjectPryTests(t *testing.T) {
+	t.Parallel()
+
+	dir := tempModule(t, map[string]string{
+		"sum.go":      "package sum\n\nfunc Sum(a, b int) int {\n\treturn a + b\n}\n",
+		"sum_test.go": "package sum\n\nimport (\n\t\"testing\"\n\n\t\"github.com/d4l3k/go-pry/pry\"\n)\n\nfunc TestSum(t *testing.T) {\n\twant := 3\n\tgot := Sum(1, 2)\n\tpry.Pry()\n\tif got != want {\n\t\tt.Fatal(got)\n\t}\n}\n",
+		"x_test.go":   "package sum_test\n\nimport \"testing\"\n\nfunc TestX(t *testing.T) {}\n",
+	})
+
+	g := NewGenerator(false)
+	g.Config.Dir = dir
+	files, err := g.TestFiles([]string{"."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "sum.go"), filepath.Join(dir, "sum_test.go"), filepath.Join(dir, "x_test.go")}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("Expected %#v got %#v.", want, files)
+	}
+
+	if _, err := g.InjectPry(filepath.Join(dir, "sum_test.go")); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(filepath.Join(dir, "sum_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{`"t": &t`, `"want": &want`, `"got": &got`} {
+		if !strings.Contains(string(out), v) {
+			t.Errorf("Expected the scope to have %s: %s", v, out)
+		}
+	}
+	if err := g.RevertPry([]string{filepath.Join(dir, "sum_test.go")}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageFilter(t *testing.T) {
+	t.Parallel()
+
+	filter := PackageFilter{
+		Exclude:    []string{"k8s.io/...", "net/*"},
+		Allow:      []string{"k8s.io/api/core/v1"},
+		MaxExports: 10,
+	}
+	cases := []struct {
+		filter  PackageFilter
+		path    string
+		exports int
+		want    string
+	}{
+		{filter, "fmt", 5, ""},
+		{filter, "k8s.io", 5, "excluded"},
+		{filter, "k8s.io/client-go/kubernetes", 5, "excluded"},
+		{filter, "k8s.iox", 5, ""},
+		{filter, "k8s.io/api/core/v1", 500, ""},
+		{filter, "math", 11, "11 exports, more than 10"},
+		{PackageFilter{Include: []string{"fmt", "net/..."}, MaxExports: 10}, "net/http", 200, ""},
+		{PackageFilter{Include: []string{"fmt", "net/..."}}, "strings", 5, "not included"},
+	}
+	for i, c := range cases {
+		if got := c.filter.skipReason(c.path, c.exports); got != c.want {
+			t.Errorf("%d. skipReason(%q, %d): Expected %#v got %#v.", i, c.path, c.exports, c.want, got)
+		}
+	}
+}
+
+func TestInjectPryFilter(t *testing.T) {
+	t.Parallel()
+
+	dir := tempModule(t, map[string]string{
+		"main.go":    "package main\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n\n\t\"github.com/d4l3k/go-pry/pry\"\n)\n\nfunc main() {\n\tpry.Pry()\n\tfmt.Println(strings.ToUpper(\"a\"))\n}\n",
+		".pryignore": "# Too big.\nstrings\n",
+	})
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inject := func() string {
+		g := NewGenerator(false)
+		g.Cache = cache
+		res, err := g.InjectPry(filepath.Join(dir, "main.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer g.RevertPry([]string{res})
+		out, err := ioutil.ReadFile(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	stub := `"strings": pry.Package{Name: "strings", Path: "strings", Skipped: "excluded"}`
+	out := inject()
+	if !strings.Contains(out, stub) || !strings.Contains(out, `"Println": fmt.Println`) {
+		t.Errorf("Expected strings to be a stub and fmt generated got:\n%s", out)
+	}
+
+	// The cached listing doesn't have the exports of the skipped package,
+	// which are parsed once it's allowed.
+	if err := ioutil.WriteFile(filepath.Join(dir, ".pryignore"), []byte("strings\n!strings\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out = inject()
+	if strings.Contains(out, stub) || !strings.Contains(out, `"ToUpper": strings.ToUpper`) {
+		t.Errorf("Expected strings to be generated got:\n%s", out)
+	}
+}
+
+func TestCheckConstants(t *testing.T) {
+	t.Parallel()
+
+	src := "package p\n\nimport \"other\"\n\nconst (\n\tSmall = 3\n\tMax = 1<<64 - 1\n\tBig = 1 << 64\n\tHuge = 1e400\n\tTyped uint64 = 1<<64 - 1\n\tOther = other.X << 70\n\tR = 'a' + 1<<40\n\tunexported = 1 << 64\n)\n"
+	f, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	convert, unavailable := checkConstants([]*ast.File{f})
+	if want := map[string]string{"Max": "uint64", "R": "uint64"}; !reflect.DeepEqual(convert, want) {
+		t.Errorf("Expected %#v got %#v.", want, convert)
+	}
+	wantUnavailable := map[string]string{
+		"Big":  "the constant overflows uint64",
+		"Huge": "the constant overflows float64",
+	}
+	if !reflect.DeepEqual(unavailable, wantUnavailable) {
+		t.Errorf("Expected %#v got %#v.", wantUnavailable, unavailable)
+	}
+}
+
+func TestInjectPryCgo(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("cgo needs a C compiler")
+	}
+	dir := tempModule(t, map[string]string{
+		"cg/cg.go": "package cg\n\n/*\ntypedef struct { int x; } point;\nstatic int add(int a, int b) { return a + b; }\n*/\nimport \"C\"\n\ntype Point = C.point\n\nvar Origin C.point\n\nconst Size = C.sizeof_point\n\nconst Huge = 1e400\n\nfunc Add(a, b int) int { return int(C.add(C.int(a), C.int(b))) }\n",
+		"main.go":  "package main\n\nimport (\n\t\"example.com/tmp/cg\"\n\t\"github.com/d4l3k/go-pry/pry\"\n)\n\nfunc main() {\n\tpry.Pry()\n\tprintln(cg.Add(1, 2))\n}\n",
+	})
+
+	g := NewGenerator(false)
+	res, err := g.InjectPry(filepath.Join(dir, "main.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.RevertPry([]string{res})
+	out, err := ioutil.ReadFile(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `Unavailable: map[string]string{"Huge": "the constant overflows float64",}`) {
+		t.Errorf("Expected Huge to be unavailable got:\n%s", out)
+	}
+
+	// Without a terminal the breakpoint logs the scope and continues.
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	for _, want := range []string{"cg", "3"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Expected the output to contain %q got:\n%s", want, output)
+		}
+	}
+}
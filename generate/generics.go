@@ -0,0 +1,224 @@
+package generate
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// DefaultInstantiations are the instantiations of common generic functions
+// and types of the standard library generated for the REPL. They're keyed by
+// the import path and name, such as "slices.Sort", and list the type
+// arguments of each instantiation, such as "[]int" or "string, int". Type
+// arguments can only use predeclared types since they're written in the
+// instrumented file.
+var DefaultInstantiations = map[string][]string{
+	"slices.BinarySearch": sliceTypes,
+	"slices.Clone":        sliceTypes,
+	"slices.Compact":      sliceTypes,
+	"slices.Contains":     sliceTypes,
+	"slices.Equal":        sliceTypes,
+	"slices.Index":        sliceTypes,
+	"slices.Insert":       sliceTypes,
+	"slices.Max":          sliceTypes,
+	"slices.Min":          sliceTypes,
+	"slices.Reverse":      sliceTypes,
+	"slices.Sort":         sliceTypes,
+
+	"maps.Clone":  mapTypes,
+	"maps.Keys":   mapTypes,
+	"maps.Values": mapTypes,
+	"maps.Equal":  {"map[string]int, map[string]int", "map[string]string, map[string]string"},
+
+	"cmp.Compare": orderedTypes,
+	"cmp.Less":    orderedTypes,
+
+	"sync/atomic.Pointer": {"int", "string"},
+}
+
+var (
+	sliceTypes   = []string{"[]int", "[]string", "[]float64"}
+	mapTypes     = []string{"map[string]int", "map[string]string"}
+	orderedTypes = []string{"int", "string", "float64"}
+)
+
+// instantiable returns whether generics can be instantiated in the
+// instrumented file, which needs its module to use Go 1.18 or later.
+func (g *Generator) instantiable() (bool, error) {
+	conf := g.Config
+	conf.Mode = packages.NeedModule
+	pkgs, err := packages.Load(&conf, ".")
+	if err != nil {
+		return false, errors.Wrap(err, "loading the module")
+	}
+	if len(pkgs) == 0 || pkgs[0].Module == nil {
+		// Outside of a module the language version is the one of the
+		// toolchain.
+		return true, nil
+	}
+	version := strings.Split(pkgs[0].Module.GoVersion, ".")
+	if len(version) < 2 {
+		return false, nil
+	}
+	major, _ := strconv.Atoi(version[0])
+	minor, _ := strconv.Atoi(version[1])
+	return major > 1 || major == 1 && minor >= 18, nil
+}
+
+// usedInstantiations returns the type arguments of the generics of the
+// import named importName that f instantiates explicitly, keyed by the name
+// of the generic. importName is "." for dot imports. Only type arguments
+// made of predeclared types, imported types and the types declared by f are
+// kept since others might not be in scope at the breakpoints.
+func usedInstantiations(f *ast.File, importName string, imports map[string]bool) map[string][]string {
+	used := map[string][]string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		x, indices, ok := indexExprs(n)
+		if !ok {
+			return true
+		}
+		var name string
+		switch x := x.(type) {
+		case *ast.SelectorExpr:
+			if pkg, ok := x.X.(*ast.Ident); ok && pkg.Name == importName {
+				name = x.Sel.Name
+			}
+		case *ast.Ident:
+			if importName == "." {
+				name = x.Name
+			}
+		}
+		if len(name) == 0 {
+			return true
+		}
+		for _, index := range indices {
+			if !inFileScope(f, index, imports) {
+				return true
+			}
+		}
+		used[name] = append(used[name], typeArgs(indices))
+		return true
+	})
+	return used
+}
+
+// inFileScope returns whether every name expr refers to is predeclared,
+// declared by f or a member of one of the imports.
+func inFileScope(f *ast.File, expr ast.Expr, imports map[string]bool) bool {
+	ok := true
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if pkg, isIdent := n.X.(*ast.Ident); !isIdent || !imports[pkg.Name] {
+				ok = false
+			}
+			return false
+		case *ast.Ident:
+			if _, isType := types.Universe.Lookup(n.Name).(*types.TypeName); !isType && f.Scope.Lookup(n.Name) == nil {
+				ok = false
+			}
+		case *ast.FuncType, *ast.StructType, *ast.InterfaceType:
+			// Field and parameter names aren't references.
+			ok = false
+			return false
+		}
+		return ok
+	})
+	return ok
+}
+
+// typeArgs renders type arguments the way pry.Generic keys instantiations.
+func typeArgs(indices []ast.Expr) string {
+	var rendered []string
+	for _, index := range indices {
+		rendered = append(rendered, types.ExprString(index))
+	}
+	return strings.Join(rendered, ", ")
+}
+
+// normalizeTypeArgs rewrites type arguments from the configuration the way
+// typeArgs renders them.
+func normalizeTypeArgs(args string) (string, error) {
+	expr, err := parser.ParseExpr("x[" + args + "]")
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid type arguments %q", args)
+	}
+	_, indices, ok := indexExprs(expr)
+	if !ok {
+		return "", errors.Errorf("invalid type arguments %q", args)
+	}
+	return typeArgs(indices), nil
+}
+
+// instantiations returns the type arguments to instantiate the generics of
+// the package at path with, keyed by their name: the ones used and, if
+// instantiable reports the file can instantiate generics, the configured
+// ones.
+func (g *Generator) instantiations(path string, used map[string][]string, instantiable func() (bool, error)) (map[string][]string, error) {
+	instances := map[string][]string{}
+	add := func(name string, args []string) {
+		for _, arg := range args {
+			if !containsString(instances[name], arg) {
+				instances[name] = append(instances[name], arg)
+			}
+		}
+	}
+	prefix := path + "."
+	for key, args := range g.Instantiations {
+		if !strings.HasPrefix(key, prefix) || strings.Contains(key[len(prefix):], ".") {
+			continue
+		}
+		ok, err := instantiable()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		var normalized []string
+		for _, arg := range args {
+			n, err := normalizeTypeArgs(arg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "instantiating %s", key)
+			}
+			normalized = append(normalized, n)
+		}
+		add(key[len(prefix):], normalized)
+	}
+	for _, args := range instances {
+		sort.Strings(args)
+	}
+	for name, args := range used {
+		add(name, args)
+	}
+	return instances, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// genericExpr returns the pry.Generic literal of the generic m refers to,
+// instantiated with each of the type arguments in instances.
+func genericExpr(m member, isType bool, instances []string) string {
+	expr := "pry.Generic{Name: " + strconv.Quote(m.expr) + ", Instances: map[string]interface{}{"
+	for _, args := range instances {
+		instance := m.expr + "[" + args + "]"
+		if isType {
+			instance = "pry.Type((*" + instance + ")(nil)).Elem()"
+		}
+		expr += strconv.Quote(args) + ": " + instance + ", "
+	}
+	return expr + "}}"
+}
@@ -0,0 +1,108 @@
+package generate
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// valueFlags are the flags of go test followed by a value unless it's
+// written as -flag=value.
+var valueFlags = map[string]bool{
+	// Build flags.
+	"C": true, "asmflags": true, "buildmode": true, "compiler": true,
+	"covermode": true, "coverpkg": true, "exec": true, "gccgoflags": true,
+	"gcflags": true, "installsuffix": true, "ldflags": true, "mod": true,
+	"modfile": true, "o": true, "overlay": true, "p": true, "pgo": true,
+	"pkgdir": true, "tags": true, "toolexec": true, "vet": true,
+
+	// Test flags.
+	"bench": true, "benchtime": true, "blockprofile": true,
+	"blockprofilerate": true, "count": true, "coverprofile": true,
+	"cpu": true, "cpuprofile": true, "fuzz": true, "fuzzminimizetime": true,
+	"fuzztime": true, "list": true, "memprofile": true,
+	"memprofilerate": true, "mutexprofile": true,
+	"mutexprofilefraction": true, "outputdir": true, "parallel": true,
+	"run": true, "shuffle": true, "skip": true, "timeout": true,
+	"trace": true,
+}
+
+// splitTestFlag returns the name of the flag arg, without dashes or the
+// test. prefix, and whether its value is part of arg.
+func splitTestFlag(arg string) (string, bool) {
+	name := strings.TrimPrefix(strings.TrimLeft(arg, "-"), "test.")
+	if i := strings.Index(name, "="); i >= 0 {
+		return name[:i], true
+	}
+	return name, false
+}
+
+// TestPackages returns the packages the arguments of go test, without "test",
+// refer to. It's "." when there are none.
+func TestPackages(args []string) []string {
+	var pkgs []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-args" || arg == "--args" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			pkgs = append(pkgs, arg)
+			continue
+		}
+		if name, hasValue := splitTestFlag(arg); valueFlags[name] && !hasValue {
+			i++
+		}
+	}
+	if len(pkgs) == 0 {
+		return []string{"."}
+	}
+	return pkgs
+}
+
+// TestArgs returns the arguments of go test to run tests with breakpoints:
+// the test timeout is disabled unless it's set since the sessions would
+// otherwise count towards it.
+func TestArgs(args []string) []string {
+	for _, arg := range args[1:] {
+		if arg == "-args" || arg == "--args" {
+			break
+		}
+		if name, _ := splitTestFlag(arg); strings.HasPrefix(arg, "-") && name == "timeout" {
+			return args
+		}
+	}
+	return append([]string{args[0], "-timeout", "0"}, args[1:]...)
+}
+
+// TestFiles returns the Go files of the packages go test builds for the
+// patterns, including their test files.
+func (g *Generator) TestFiles(patterns []string) ([]string, error) {
+	conf := g.Config
+	conf.Mode = packages.NeedName | packages.NeedFiles
+	conf.Tests = true
+	pkgs, err := packages.Load(&conf, patterns...)
+	if err != nil {
+		return nil, errors.Wrap(err, "listing the packages to test")
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, errors.Errorf("listing %s: %s", pkg.PkgPath, pkg.Errors[0])
+		}
+		for _, file := range pkg.GoFiles {
+			// Test binaries have a generated main package outside of the
+			// package directory.
+			if !strings.HasSuffix(file, ".go") || strings.HasSuffix(pkg.PkgPath, ".test") || seen[file] {
+				continue
+			}
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,155 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// lazyPackage matches the start of the packages the generated code builds on
+// first use.
+var lazyPackage = regexp.MustCompile(`pry\.LazyPackage\(("[^"]*"), ("[^"]*"), func\(\) pry\.Package \{ return pry\.Package\{`)
+
+// eagerPackages returns the generated code src with the members of its
+// packages built up front, as the generator used to.
+func eagerPackages(src []byte) []byte {
+	src = lazyPackage.ReplaceAll(src, []byte("pry.Package{Name: $1, Path: $2, "))
+	return bytes.ReplaceAll(src, []byte("} }), "), []byte("}, "))
+}
+
+// BenchmarkPromptReady measures how long a program importing ten packages
+// with many members takes to show the first prompt of its session on a
+// terminal, with the members built on first use and, as before, up front.
+func BenchmarkPromptReady(b *testing.B) {
+	g := NewGenerator(false)
+	file := "testdata/heavy/heavy.go"
+	res, err := g.InjectPry(file)
+	if err != nil {
+		b.Fatalf("Failed to inject pry %v", err)
+	}
+	defer g.RevertPry([]string{res})
+	lazy, err := ioutil.ReadFile(res)
+	if err != nil {
+		b.Fatal(err)
+	}
+	eager := eagerPackages(lazy)
+	if bytes.Contains(eager, []byte("pry.LazyPackage(")) {
+		b.Fatal("some packages are still lazy")
+	}
+
+	dir := b.TempDir()
+	variants := []struct {
+		name string
+		src  []byte
+	}{{"eager", eager}, {"lazy", lazy}}
+	for _, v := range variants {
+		// The lazy code is written last, so the file can be reverted.
+		if err := ioutil.WriteFile(res, v.src, 0644); err != nil {
+			b.Fatal(err)
+		}
+		cmd := exec.Command("go", "build", "-o", filepath.Join(dir, v.name), ".")
+		cmd.Dir = filepath.Dir(file)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			b.Fatalf("the %s program doesn't build: %v\n%s", v.name, err, out)
+		}
+	}
+
+	home := b.TempDir()
+	for _, v := range variants {
+		bin := filepath.Join(dir, v.name)
+		b.Run(v.name, func(b *testing.B) {
+			// The first run type checks the program with an empty build
+			// cache, which takes far longer than the runs that follow.
+			waitForPrompt(b, bin, home)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				waitForPrompt(b, bin, home)
+			}
+		})
+	}
+}
+
+// waitForPrompt runs bin on a new terminal until it shows a prompt.
+func waitForPrompt(b *testing.B, bin, home string) {
+	b.StopTimer()
+	master, slave, err := openPTY(80, 24)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer master.Close()
+	cmd := exec.Command(bin)
+	cmd.Env = append(os.Environ(), "HOME="+home, "GOPRY_NORC=1", "NO_COLOR=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	b.StartTimer()
+
+	if err := cmd.Start(); err != nil {
+		b.Fatal(err)
+	}
+	slave.Close()
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	ready := make(chan error, 1)
+	go func() {
+		var out []byte
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			out = append(out, buf[:n]...)
+			if strings.Contains(string(out), "go-pry> ") {
+				ready <- nil
+				return
+			}
+			if err != nil {
+				ready <- fmt.Errorf("%v\nOutput:\n%s", err, out)
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			b.Fatal(err)
+		}
+	case <-time.After(5 * time.Minute):
+		b.Fatal("no prompt after five minutes")
+	}
+	b.StopTimer()
+}
+
+// openPTY opens a new pseudo-terminal of width columns and height rows.
+func openPTY(width, height int) (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unlock int32
+	var n uint32
+	size := [4]uint16{uint16(height), uint16(width)}
+	for _, req := range []struct {
+		op  uintptr
+		arg unsafe.Pointer
+	}{{syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)}, {syscall.TIOCGPTN, unsafe.Pointer(&n)}, {syscall.TIOCSWINSZ, unsafe.Pointer(&size)}} {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, master.Fd(), req.op, uintptr(req.arg)); errno != 0 {
+			master.Close()
+			return nil, nil, errno
+		}
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
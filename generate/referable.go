@@ -0,0 +1,103 @@
+package generate
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// noImporter fails every import, so packages are type checked from their own
+// files only.
+type noImporter struct{}
+
+func (noImporter) Import(path string) (*types.Package, error) {
+	return nil, errors.Errorf("%s isn't imported", path)
+}
+
+// checkConstants finds the exported constants of a package the generated
+// code can't refer to as they are. Untyped constants in a map literal take
+// their default type, which can't hold values such as math.MaxUint64. It
+// returns the type to convert the ones that fit another type to, and why the
+// others can't be generated, by name.
+//
+// The package is type checked from files alone: constants that depend on
+// other packages, including cgo, are unknown and assumed to be fine.
+func checkConstants(files []*ast.File) (convert, unavailable map[string]string) {
+	convert = map[string]string{}
+	unavailable = map[string]string{}
+	hasConstants := false
+	for _, file := range files {
+		for name, obj := range file.Scope.Objects {
+			if obj.Kind == ast.Con && ast.IsExported(name) {
+				hasConstants = true
+			}
+		}
+	}
+	if !hasConstants || len(files) == 0 {
+		return convert, unavailable
+	}
+
+	conf := types.Config{
+		Importer:    noImporter{},
+		FakeImportC: true,
+		// Errors, such as unresolved imports, only make the affected
+		// declarations invalid.
+		Error: func(error) {},
+	}
+	pkg, _ := conf.Check(files[0].Name.Name, coveringFileSet(files), files, nil)
+	if pkg == nil {
+		return convert, unavailable
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		c, ok := scope.Lookup(name).(*types.Const)
+		if !ok || !c.Exported() {
+			continue
+		}
+		basic, ok := c.Type().(*types.Basic)
+		if !ok || basic.Info()&types.IsUntyped == 0 {
+			continue
+		}
+		switch v := c.Val(); v.Kind() {
+		case constant.Int:
+			if i, exact := constant.Int64Val(v); exact && (basic.Kind() != types.UntypedRune || i == int64(int32(i))) {
+				continue
+			}
+			if _, exact := constant.Uint64Val(v); exact {
+				convert[name] = "uint64"
+			} else {
+				unavailable[name] = "the constant overflows uint64"
+			}
+		case constant.Float:
+			if f, _ := constant.Float64Val(v); math.IsInf(f, 0) {
+				unavailable[name] = "the constant overflows float64"
+			}
+		case constant.Complex:
+			re, _ := constant.Float64Val(constant.Real(v))
+			im, _ := constant.Float64Val(constant.Imag(v))
+			if math.IsInf(re, 0) || math.IsInf(im, 0) {
+				unavailable[name] = "the constant overflows complex128"
+			}
+		}
+	}
+	return convert, unavailable
+}
+
+// coveringFileSet returns a file set with a single file spanning the
+// positions of files. The type checker needs one to report errors, which
+// are ignored, and the file set the files were parsed with isn't kept.
+func coveringFileSet(files []*ast.File) *token.FileSet {
+	end := 0
+	for _, f := range files {
+		if e := int(f.End()); e > end {
+			end = e
+		}
+	}
+	fset := token.NewFileSet()
+	fset.AddFile("", -1, end+1)
+	return fset
+}
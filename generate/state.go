@@ -0,0 +1,337 @@
+package generate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StateDir is the directory, next to go.mod, where go-pry records the files
+// it instrumented and keeps copies of their originals until they're
+// restored.
+const StateDir = ".go-pry"
+
+// tmpPrefix starts the names of the temporary files that are renamed over
+// the files go-pry writes, so they're either complete or untouched.
+const tmpPrefix = ".go-pry-"
+
+// crashHook is called between the steps of instrumenting a file. Tests use
+// it to simulate crashes.
+var crashHook = func(step string) {}
+
+// manifestEntry records an instrumented file.
+type manifestEntry struct {
+	// Original and Instrumented are the SHA-256 hashes of the file before
+	// and after instrumenting it.
+	Original     string
+	Instrumented string
+}
+
+// manifest lists the files instrumented in a module, keyed by their
+// absolute path.
+type manifest struct {
+	dir     string
+	Entries map[string]manifestEntry
+}
+
+// stateDir returns the state directory of the module of the file at path.
+func stateDir(path string) string {
+	return moduleStateDir(filepath.Dir(path))
+}
+
+// moduleStateDir returns the state directory of the module of dir.
+func moduleStateDir(dir string) string {
+	return filepath.Join(moduleRoot(dir), StateDir)
+}
+
+// moduleRoot returns the directory of the closest go.mod above dir or,
+// without one, dir.
+func moduleRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// loadManifest reads the manifest in the state directory dir. It's empty if
+// there's none.
+func loadManifest(dir string) (*manifest, error) {
+	m := &manifest{dir: dir, Entries: map[string]manifestEntry{}}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading the manifest")
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrapf(err, "reading %s", filepath.Join(dir, "manifest.json"))
+	}
+	if m.Entries == nil {
+		m.Entries = map[string]manifestEntry{}
+	}
+	return m, nil
+}
+
+// save writes the manifest, creating the state directory if needed.
+func (m *manifest) save() error {
+	if err := os.MkdirAll(filepath.Join(m.dir, "backups"), 0755); err != nil {
+		return errors.Wrap(err, "creating the state directory")
+	}
+	// The state shouldn't end up in version control.
+	ignore := filepath.Join(m.dir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		if err := writeFileAtomic(ignore, []byte("*\n"), 0644); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encoding the manifest")
+	}
+	return writeFileAtomic(filepath.Join(m.dir, "manifest.json"), data, 0644)
+}
+
+// backupPath returns the copy of the original with the given hash.
+func (m *manifest) backupPath(hash string) string {
+	return filepath.Join(m.dir, "backups", hash)
+}
+
+// removeBackup removes the copy of the original with the given hash unless
+// other entries still refer to it.
+func (m *manifest) removeBackup(hash string) {
+	for _, e := range m.Entries {
+		if e.Original == hash {
+			return
+		}
+	}
+	os.Remove(m.backupPath(hash))
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sidecarPath returns the path of the copy of the original next to path,
+// which pry reads the source from.
+func sidecarPath(path string) string {
+	return filepath.Dir(path) + "/." + filepath.Base(path) + "pry"
+}
+
+// writeFileAtomic writes data to path through a temporary file renamed over
+// it, so path either has its previous content or data.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), tmpPrefix+"*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "writing %s", path)
+	}
+	return nil
+}
+
+// instrument replaces the file at path, whose content is original, with
+// instrumented. The original is recorded in the manifest and backed up
+// before the file is touched, so a crash at any point can be recovered
+// from.
+func instrument(path string, original, instrumented []byte) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	m, err := loadManifest(stateDir(path))
+	if err != nil {
+		return err
+	}
+	entry := manifestEntry{Original: hashBytes(original), Instrumented: hashBytes(instrumented)}
+	if err := os.MkdirAll(filepath.Join(m.dir, "backups"), 0755); err != nil {
+		return errors.Wrap(err, "creating the state directory")
+	}
+	if err := writeFileAtomic(m.backupPath(entry.Original), original, 0644); err != nil {
+		return err
+	}
+	m.Entries[path] = entry
+	if err := m.save(); err != nil {
+		return err
+	}
+	crashHook("manifest")
+
+	if err := writeFileAtomic(sidecarPath(path), original, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	crashHook("sidecar")
+
+	return writeFileAtomic(path, instrumented, fi.Mode().Perm())
+}
+
+// EditedError is returned when restoring a file that was changed after it
+// was instrumented. The file is left alone and its original is kept at
+// Backup.
+type EditedError struct {
+	Path   string
+	Backup string
+}
+
+func (e *EditedError) Error() string {
+	return e.Path + " was changed after it was instrumented, so it wasn't restored; the original is at " + e.Backup
+}
+
+// restore restores path from the manifest m. It returns false if m doesn't
+// have path.
+func (m *manifest) restore(path string) (bool, error) {
+	entry, ok := m.Entries[path]
+	if !ok {
+		return false, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+	switch hash := hashBytes(data); {
+	case os.IsNotExist(err) || hash == entry.Instrumented:
+		original, err := ioutil.ReadFile(m.backupPath(entry.Original))
+		if err != nil {
+			return true, errors.Wrapf(err, "restoring %s", path)
+		}
+		if hashBytes(original) != entry.Original {
+			return true, errors.Errorf("restoring %s: the backup %s is corrupt", path, m.backupPath(entry.Original))
+		}
+		perm := os.FileMode(0644)
+		if fi, err := os.Stat(path); err == nil {
+			perm = fi.Mode().Perm()
+		}
+		if err := writeFileAtomic(path, original, perm); err != nil {
+			return true, err
+		}
+	case hash == entry.Original:
+		// The crash happened before the file was replaced.
+	default:
+		return true, &EditedError{Path: path, Backup: m.backupPath(entry.Original)}
+	}
+	if err := os.Remove(sidecarPath(path)); err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+	delete(m.Entries, path)
+	m.removeBackup(entry.Original)
+	return true, m.save()
+}
+
+// restoreLegacy restores a file instrumented without a manifest by moving
+// its sidecar back.
+func restoreLegacy(path string) error {
+	sidecar := sidecarPath(path)
+	if _, err := os.Stat(sidecar); os.IsNotExist(err) {
+		return errors.Errorf("no such file or directory: %s", sidecar)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(sidecar, path)
+}
+
+// Doctor finds the files under dir left instrumented, for instance by a
+// crash, and restores them. It also removes the state left behind by
+// instrumentation that didn't finish. Files changed after they were
+// instrumented are reported and left alone. It returns what it did.
+func (g *Generator) Doctor(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var report []string
+	var errs []string
+
+	m, err := loadManifest(moduleStateDir(dir))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for path := range m.Entries {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		switch _, err := m.restore(path); err.(type) {
+		case nil:
+			report = append(report, "restored "+path)
+		case *EditedError:
+			report = append(report, err.Error())
+		default:
+			errs = append(errs, err.Error())
+		}
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if name == StateDir || name == "vendor" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case strings.HasPrefix(name, tmpPrefix) && strings.HasSuffix(name, ".tmp"):
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			report = append(report, "removed the unfinished write "+path)
+
+		case strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".gopry"):
+			// A sidecar without a manifest entry, left by an older
+			// go-pry.
+			file := filepath.Join(filepath.Dir(path), name[1:len(name)-3])
+			data, err := ioutil.ReadFile(file)
+			if err == nil && !strings.Contains(string(data), "pry.Apply(") {
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				report = append(report, "removed the stale copy "+path)
+				return nil
+			}
+			if err := restoreLegacy(file); err != nil {
+				errs = append(errs, err.Error())
+				return nil
+			}
+			report = append(report, "restored "+file)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	if len(errs) > 0 {
+		return report, errors.New(strings.Join(errs, "\n"))
+	}
+	return report, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"example.com/generics/stack"
+	"github.com/d4l3k/go-pry/pry"
+)
+
+type point struct {
+	x, y int
+}
+
+func main() {
+	var s stack.Stack[point]
+	s.Push(point{1, 2})
+	words := stack.Map[int, string]([]int{1, 2}, strconv.Itoa)
+	slices.Sort(words)
+	fmt.Println(s.Pop(), words, stack.Depth())
+
+	pry.Pry()
+}
@@ -0,0 +1,33 @@
+// Package stack is a generic package for the generator tests.
+package stack
+
+// Stack is a last in, first out stack.
+type Stack[T any] struct {
+	items []T
+}
+
+// Push adds v to the top of the stack.
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+// Pop removes the item at the top of the stack.
+func (s *Stack[T]) Pop() T {
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v
+}
+
+// Map returns the results of f applied to each of vs.
+func Map[T, U any](vs []T, f func(T) U) []U {
+	var out []U
+	for _, v := range vs {
+		out = append(out, f(v))
+	}
+	return out
+}
+
+// Depth is a regular function next to the generic ones.
+func Depth() int {
+	return 0
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"html/template"
+	"net/http"
+	"syscall"
+
+	"github.com/d4l3k/go-pry/pry"
+)
+
+// main imports ten packages with many members, to measure how long the
+// session takes to show its first prompt.
+func main() {
+	fmt.Println(tls.VersionTLS13, x509.RSA, sql.LevelSerializable, json.Valid(nil), xml.Header != "",
+		ast.Bad, types.Typ != nil, template.HTMLEscapeString(""), http.MethodGet, syscall.Getpid() > 0)
+
+	pry.Pry()
+}
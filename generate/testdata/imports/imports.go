@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	_ "image/png"
+	m "math"
+	. "strings"
+
+	"github.com/d4l3k/go-pry/pry"
+)
+
+func main() {
+	Count := 3
+	s := ToUpper("pry")
+	fmt.Println(s, Count, m.Sqrt(2), uint64(m.MaxUint64))
+
+	pry.Pry()
+}
@@ -0,0 +1,13 @@
+module example.com/app
+
+go 1.16
+
+require (
+	example.com/greet v1.0.0
+	github.com/d4l3k/go-pry v0.0.0
+)
+
+replace (
+	example.com/greet => ../greet
+	github.com/d4l3k/go-pry => ../../../..
+)
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/greet"
+	"github.com/d4l3k/go-pry/pry"
+)
+
+func main() {
+	fmt.Println(greet.Hello("world"))
+	pry.Pry()
+}
@@ -0,0 +1,23 @@
+// Package greet is only available through a replace directive.
+package greet
+
+// Punctuation ends every greeting.
+const Punctuation = "!"
+
+// Greeting starts every greeting.
+var Greeting = "Hello"
+
+// Hello greets name.
+func Hello(name string) string {
+	return Greeting + ", " + name + Punctuation
+}
+
+// Greeter greets by name.
+type Greeter struct {
+	Name string
+}
+
+// Greet greets the name of g.
+func (g *Greeter) Greet() string {
+	return Hello(g.Name)
+}
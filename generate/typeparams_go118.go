@@ -0,0 +1,29 @@
+// +build go1.18
+
+package generate
+
+import "go/ast"
+
+// isGeneric returns whether obj is a generic function or type.
+func isGeneric(obj *ast.Object) bool {
+	switch decl := obj.Decl.(type) {
+	case *ast.FuncDecl:
+		return decl.Type.TypeParams != nil
+	case *ast.TypeSpec:
+		return decl.TypeParams != nil
+	}
+	return false
+}
+
+// indexExprs returns the operand and indices of an index expression, which
+// has several indices when it instantiates a generic with several type
+// parameters.
+func indexExprs(n ast.Node) (ast.Expr, []ast.Expr, bool) {
+	switch n := n.(type) {
+	case *ast.IndexExpr:
+		return n.X, []ast.Expr{n.Index}, true
+	case *ast.IndexListExpr:
+		return n.X, n.Indices, true
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,19 @@
+// +build !go1.18
+
+package generate
+
+import "go/ast"
+
+// isGeneric returns whether obj is a generic function or type, which only
+// Go 1.18 and later have.
+func isGeneric(obj *ast.Object) bool {
+	return false
+}
+
+// indexExprs returns the operand and index of an index expression.
+func indexExprs(n ast.Node) (ast.Expr, []ast.Expr, bool) {
+	if n, ok := n.(*ast.IndexExpr); ok {
+		return n.X, []ast.Expr{n.Index}, true
+	}
+	return nil, nil, false
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/d4l3k/go-pry/generate"
+	"github.com/d4l3k/go-pry/pry"
 	"github.com/pkg/errors"
 )
 
@@ -30,6 +31,27 @@ func main() {
 	}
 }
 
+// openCache opens the cache of the exports of packages. It's nil when
+// GOPRYCACHE is off.
+func openCache() (*generate.Cache, error) {
+	dir, err := generate.DefaultCacheDir()
+	if err != nil || len(dir) == 0 {
+		return nil, err
+	}
+	return generate.OpenCache(dir)
+}
+
+// splitList splits a comma separated flag.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 func run() error {
 	ctx := context.Background()
 
@@ -39,6 +61,12 @@ func run() error {
 	execute := flag.String("e", "", "statements to execute")
 	generatePath := flag.String("generate", "", "the path to generate a go-pry injected file - EXPERIMENTAL")
 	debug := flag.Bool("d", false, "display debug statements")
+	noCache := flag.Bool("no-cache", false, "parse every imported package instead of using the cache of their exports")
+	prune := flag.Bool("prune", false, "remove the cache entries that weren't used recently and exit")
+	include := flag.String("include", "", "the only imported packages to generate, comma separated patterns such as k8s.io/...")
+	exclude := flag.String("exclude", "", "imported packages not to generate, comma separated patterns; see also "+generate.IgnoreFile)
+	noRC := flag.Bool("no-rc", false, "don't run ~/.gopryrc and ./.gopryrc when a session starts")
+	maxExports := flag.Int("max-exports", 0, "don't generate imported packages with more exports unless they're included, 0 for no limit")
 
 	flag.CommandLine.Usage = func() {
 		if err := generate.NewGenerator(*debug).ExecuteGoCmd(ctx, []string{}, nil); err != nil {
@@ -50,10 +78,41 @@ func run() error {
 		fmt.Println("Running go-pry with no arguments will drop you into an interactive REPL.")
 		flag.PrintDefaults()
 		fmt.Println("  revert: cleans up go-pry generated files if not automatically done")
+		fmt.Println("  doctor [dirs]: restores the files left instrumented, such as by a crash")
+		fmt.Println("  test [packages] [flags]: runs go test with breakpoints in the tests, on the terminal")
+		fmt.Println("  attach host:port: connects to a REPL served over TCP, see pry.ListenAndServe")
 	}
 	flag.Parse()
+	if *noRC {
+		// The sessions run in the programs go-pry builds.
+		os.Setenv("GOPRY_NORC", "1")
+	}
 
 	g := generate.NewGenerator(*debug)
+	g.Filter = generate.PackageFilter{
+		Include:    splitList(*include),
+		Exclude:    splitList(*exclude),
+		MaxExports: *maxExports,
+	}
+	if !*noCache || *prune {
+		cache, err := openCache()
+		if err != nil {
+			// The cache only saves time.
+			log.Printf("not caching the exports of packages: %v", err)
+		}
+		g.Cache = cache
+	}
+	if *prune {
+		if g.Cache == nil {
+			return nil
+		}
+		removed, err := g.Cache.Prune(generate.DefaultPruneAge)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("removed %d stale entries from %s\n", removed, g.Cache.Dir())
+		return nil
+	}
 
 	cmdArgs := flag.Args()
 	if len(cmdArgs) == 0 {
@@ -64,6 +123,33 @@ func run() error {
 		return g.GenerateAndExecuteFile(ctx, imports, *execute)
 	}
 
+	if cmdArgs[0] == "attach" {
+		if len(cmdArgs) != 2 {
+			return errors.New("usage: go-pry attach host:port")
+		}
+		return pry.Attach(cmdArgs[1])
+	}
+
+	if cmdArgs[0] == "doctor" {
+		dirs := cmdArgs[1:]
+		if len(dirs) == 0 {
+			dirs = []string{"."}
+		}
+		for _, dir := range dirs {
+			report, err := g.Doctor(dir)
+			for _, line := range report {
+				fmt.Println(line)
+			}
+			if err != nil {
+				return err
+			}
+			if len(report) == 0 {
+				fmt.Printf("%s: nothing to repair\n", dir)
+			}
+		}
+		return nil
+	}
+
 	goDirs := []string{}
 	for _, arg := range cmdArgs {
 		if strings.HasSuffix(arg, ".go") {
@@ -84,47 +170,64 @@ func run() error {
 	if cmdArgs[0] == "revert" {
 		fmt.Println("REVERTING PRY")
 		for _, dir := range goDirs {
-			filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-				if strings.HasSuffix(path, ".gopry") {
-					processed := false
-					for _, file := range processedFiles {
-						if file == path {
-							processed = true
-						}
-					}
-					if !processed {
-						base := filepath.Base(path)
-						newPath := filepath.Dir(path) + "/" + base[1:len(base)-3]
-						modifiedFiles = append(modifiedFiles, newPath)
-					}
-				}
-				return nil
-			})
+			report, err := g.Doctor(dir)
+			for _, line := range report {
+				fmt.Println(line)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Breakpoints are no-ops with the tag, so there's nothing to inject.
+	if generate.HasBuildTag(cmdArgs[1:], os.Getenv("GOFLAGS"), generate.NoopTag) {
+		if cmdArgs[0] == "apply" {
+			return nil
 		}
-		return g.RevertPry(modifiedFiles)
+		return g.ExecuteGoCmd(ctx, cmdArgs, nil)
 	}
 
-	testsRequired := cmdArgs[0] == "test"
-	for _, dir := range goDirs {
-		if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-			if !testsRequired && strings.HasSuffix(path, "_test.go") || !strings.HasSuffix(path, ".go") || strings.Contains(path, "vendor/") {
+	inject := func(path string) error {
+		for _, file := range processedFiles {
+			if file == path {
 				return nil
 			}
-			for _, file := range processedFiles {
-				if file == path {
+		}
+		file, err := g.InjectPry(path)
+		if err != nil {
+			return errors.Wrap(err, "inject")
+		}
+		if file != "" {
+			modifiedFiles = append(modifiedFiles, path)
+		}
+		return nil
+	}
+
+	if cmdArgs[0] == "test" {
+		// Only the packages being tested, with their test files, are
+		// instrumented.
+		files, err := g.TestFiles(generate.TestPackages(cmdArgs[1:]))
+		if err != nil {
+			return err
+		}
+		for _, path := range files {
+			if err := inject(path); err != nil {
+				return err
+			}
+		}
+		cmdArgs = generate.TestArgs(cmdArgs)
+	} else {
+		for _, dir := range goDirs {
+			if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if strings.HasSuffix(path, "_test.go") || !strings.HasSuffix(path, ".go") || strings.Contains(path, "vendor/") {
 					return nil
 				}
+				return inject(path)
+			}); err != nil {
+				return err
 			}
-			file, err := g.InjectPry(path)
-			if err != nil {
-				return errors.Wrap(err, "inject")
-			}
-			if file != "" {
-				modifiedFiles = append(modifiedFiles, path)
-			}
-			return nil
-		}); err != nil {
-			return err
 		}
 	}
 
@@ -132,14 +235,12 @@ func run() error {
 		return nil
 	}
 
-	if err := g.ExecuteGoCmd(ctx, cmdArgs, nil); err != nil {
-		return err
-	}
-
+	// Failing commands, such as go test with failing tests, still revert.
+	err := g.ExecuteGoCmd(ctx, cmdArgs, nil)
 	if *revert {
-		if err := g.RevertPry(modifiedFiles); err != nil {
-			return err
+		if revertErr := g.RevertPry(modifiedFiles); err == nil {
+			err = revertErr
 		}
 	}
-	return nil
+	return err
 }
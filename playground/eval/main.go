@@ -0,0 +1,22 @@
+// +build js,wasm
+
+// Command eval exposes the interpreter to JavaScript, for embedding it in a
+// page such as a docs site. Once it's running, pryEval(src) evaluates Go
+// source and returns {result, error}:
+//
+//	GOOS=js GOARCH=wasm go build -o eval.wasm ./playground/eval
+//
+// The scope only has the builtins, and evaluations stop after ten million
+// steps so a loop that never ends doesn't hang the page.
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/d4l3k/go-pry/pry"
+)
+
+func main() {
+	js.Global().Set("pryEval", pry.JSEval(pry.NewScope(), pry.WithLimits(pry.Limits{MaxSteps: 10000000})))
+	select {}
+}
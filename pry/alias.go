@@ -0,0 +1,231 @@
+package pry
+
+import (
+	"go/scanner"
+	"go/token"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// aliasName matches the names aliases can have.
+var aliasName = regexp.MustCompile(`^[\pL_][\pL\pN_]*$`)
+
+// aliasParam matches the parameters of alias templates: %1 to %9, %* and
+// %% for a percent sign.
+var aliasParam = regexp.MustCompile(`%[1-9*%]`)
+
+// checkAliasName returns an error if name can't be the name of an alias.
+func checkAliasName(name string) error {
+	if !aliasName.MatchString(name) {
+		return errors.Errorf("alias names must be identifiers, not %q", name)
+	}
+	if _, ok := commandNames[name]; ok {
+		return errors.Errorf("%s is a command", name)
+	}
+	if token.Lookup(name).IsKeyword() {
+		return errors.Errorf("%s is a keyword", name)
+	}
+	return nil
+}
+
+// expandAliases replaces the statements of src that start with the name of
+// one of aliases by its template, with the words following the name as the
+// parameters. Only statements outside brackets are expanded, and neither
+// string literals nor comments are. Templates are expanded in turn, and
+// aliases used while they're expanded are a cycle.
+func expandAliases(aliases map[string]string, src string) (string, error) {
+	if len(aliases) == 0 {
+		return src, nil
+	}
+	return expandAliasChain(aliases, src, nil)
+}
+
+// expandAliasChain is expandAliases within the expansion of the aliases of
+// chain.
+func expandAliasChain(aliases map[string]string, src string, chain []string) (string, error) {
+	var b strings.Builder
+	done := 0
+	for _, stmt := range aliasStatements(aliases, src) {
+		for _, name := range chain {
+			if name == stmt.name {
+				return "", errors.Errorf("alias cycle: %s -> %s", strings.Join(chain, " -> "), stmt.name)
+			}
+		}
+		args := src[stmt.argsStart:stmt.end]
+		expanded, err := expandAliasChain(aliases, substituteAlias(aliases[stmt.name], args), append(chain, stmt.name))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(src[done:stmt.start])
+		b.WriteString(expanded)
+		done = stmt.end
+	}
+	if done == 0 {
+		return src, nil
+	}
+	b.WriteString(src[done:])
+	return b.String(), nil
+}
+
+// aliasStatement is a statement of the input starting with an alias. The
+// offsets are in bytes.
+type aliasStatement struct {
+	name                  string
+	start, argsStart, end int
+}
+
+// aliasStatements returns the statements of src starting with the name of
+// one of aliases that's neither assigned to nor followed by a selector,
+// index or call, such as "pp x".
+func aliasStatements(aliases map[string]string, src string) []aliasStatement {
+	body := []byte(src)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(body))
+	var s scanner.Scanner
+	s.Init(file, body, func(token.Position, string) {}, scanner.ScanComments)
+
+	var stmts []aliasStatement
+	// current is the statement being scanned if it starts with an alias,
+	// and tokenEnd where the last token of the statement ended.
+	var current *aliasStatement
+	tokenEnd := 0
+	finish := func() {
+		if current == nil {
+			return
+		}
+		current.end = tokenEnd
+		if current.argsStart < 0 || current.argsStart > current.end {
+			current.argsStart = current.end
+		}
+		stmts = append(stmts, *current)
+		current = nil
+	}
+	depth := 0
+	start := true
+	for {
+		pos, tok, lit := s.Scan()
+		offset := file.Offset(pos)
+		switch {
+		case tok == token.COMMENT:
+			// Comments end the words of the alias but not the statement.
+			if depth == 0 {
+				finish()
+			}
+			continue
+		case tok == token.EOF:
+			finish()
+			return stmts
+		case tok == token.SEMICOLON && depth == 0:
+			finish()
+			start = true
+			continue
+		}
+		if current != nil && current.argsStart == -1 {
+			// The word after the name has to be apart from it, and
+			// assignments to a variable of the same name aren't expanded.
+			if offset == current.start+len(current.name) || isAssignment(tok) {
+				current = nil
+			} else {
+				current.argsStart = offset
+			}
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+		if start && tok == token.IDENT {
+			if _, ok := aliases[lit]; ok {
+				current = &aliasStatement{name: lit, start: offset, argsStart: -1}
+			}
+		}
+		start = false
+		tokenEnd = offset + tokenLen(tok, lit)
+	}
+}
+
+// isAssignment returns whether tok assigns to the operand before it.
+func isAssignment(tok token.Token) bool {
+	switch {
+	case tok >= token.ADD_ASSIGN && tok <= token.AND_NOT_ASSIGN:
+		return true
+	}
+	switch tok {
+	case token.ASSIGN, token.DEFINE, token.INC, token.DEC, token.COMMA, token.ARROW:
+		return true
+	}
+	return false
+}
+
+// substituteAlias returns template with its parameters replaced by the words
+// of args: %1 to %9 by the words, which are separated by spaces outside
+// brackets and literals, and %* by all of them. Missing words are empty.
+func substituteAlias(template, args string) string {
+	args = strings.TrimSpace(args)
+	words := aliasWords(args)
+	return aliasParam.ReplaceAllStringFunc(template, func(param string) string {
+		switch param[1] {
+		case '*':
+			return args
+		case '%':
+			return "%"
+		}
+		if i := int(param[1] - '1'); i < len(words) {
+			return words[i]
+		}
+		return ""
+	})
+}
+
+// aliasWords splits args into words at the spaces outside brackets and
+// literals, so "f(a, b) \"c d\"" is two words.
+func aliasWords(args string) []string {
+	body := []byte(args)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(body))
+	var s scanner.Scanner
+	s.Init(file, body, func(token.Position, string) {}, 0)
+
+	var words []string
+	wordStart, end, depth := -1, 0, 0
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit != ";" {
+			continue
+		}
+		offset := file.Offset(pos)
+		if wordStart >= 0 && depth == 0 && offset > end {
+			words = append(words, args[wordStart:end])
+			wordStart = -1
+		}
+		if wordStart < 0 {
+			wordStart = offset
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		}
+		end = offset + tokenLen(tok, lit)
+	}
+	if wordStart >= 0 {
+		words = append(words, args[wordStart:end])
+	}
+	return words
+}
+
+// tokenLen returns the length in bytes of the token tok with the literal
+// lit.
+func tokenLen(tok token.Token, lit string) int {
+	if len(lit) > 0 {
+		return len(lit)
+	}
+	return len(tok.String())
+}
@@ -0,0 +1,109 @@
+package pry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandAliases(t *testing.T) {
+	t.Parallel()
+
+	aliases := map[string]string{
+		"pp":   `fmt.Printf("%+v\n", %1)`,
+		"both": "%2, %1",
+		"all":  "f(%*)",
+		"pct":  "%1 %% 2",
+		"w":    ":whereami",
+		"ppp":  "pp %1",
+	}
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"pp x", `fmt.Printf("%+v\n", x)`},
+		{"pp f(a, b) c", `fmt.Printf("%+v\n", f(a, b))`},
+		{"both a b", "b, a"},
+		{`both "a b" []int{1, 2}`, `[]int{1, 2}, "a b"`},
+		{"all a + b", "f(a + b)"},
+		{"all", "f()"},
+		{"pct 7", "7 % 2"},
+		{"both a", ", a"},
+		{"w", ":whereami"},
+		{"ppp y", `fmt.Printf("%+v\n", y)`},
+		// Every statement of the line outside brackets is expanded.
+		{"x := 1; pp x", `x := 1; fmt.Printf("%+v\n", x)`},
+		{"pp a\npp b", "fmt.Printf(\"%+v\\n\", a)\nfmt.Printf(\"%+v\\n\", b)"},
+		{"pp x // comment", `fmt.Printf("%+v\n", x) // comment`},
+		// Literals, comments, brackets and other uses of the name aren't.
+		{`s := "pp x"`, `s := "pp x"`},
+		{"s := `a; pp x`", "s := `a; pp x`"},
+		{"// pp x", "// pp x"},
+		{"if true { pp x }", "if true { pp x }"},
+		{"pp := 1", "pp := 1"},
+		{"pp = 2", "pp = 2"},
+		{"pp++", "pp++"},
+		{"pp.X", "pp.X"},
+		{"pp(1)", "pp(1)"},
+		{"pp, q := 1, 2", "pp, q := 1, 2"},
+		{"x pp", "x pp"},
+	}
+	for _, c := range cases {
+		out, err := expandAliases(aliases, c.src)
+		if err != nil {
+			t.Errorf("%q: %v", c.src, err)
+			continue
+		}
+		if out != c.want {
+			t.Errorf("%q: expected %q got %q", c.src, c.want, out)
+		}
+	}
+}
+
+func TestExpandAliasesCycle(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		aliases map[string]string
+		src     string
+		want    string
+	}{
+		{map[string]string{"a": "a"}, "a", "alias cycle: a -> a"},
+		{map[string]string{"a": "b %1", "b": "c %1", "c": "x := 1; a"}, "a 1", "alias cycle: a -> b -> c -> a"},
+	}
+	for _, c := range cases {
+		_, err := expandAliases(c.aliases, c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%q: expected error %q got %v", c.src, c.want, err)
+		}
+	}
+
+	// An alias used twice in a template isn't a cycle.
+	out, err := expandAliases(map[string]string{"twice": "one %1; one %1", "one": "f(%1)"}, "twice x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "f(x); f(x)"; out != want {
+		t.Errorf("Expected %q got %q.", want, out)
+	}
+}
+
+func TestAliasWords(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string][]string{
+		"":                     nil,
+		"a b":                  {"a", "b"},
+		"  a   b  ":            {"a", "b"},
+		"f(a, b) c":            {"f(a, b)", "c"},
+		`"a b" 'c'`:            {`"a b"`, "'c'"},
+		"a+b c":                {"a+b", "c"},
+		"m[\"k\"] struct{}{}":  {`m["k"]`, "struct{}{}"},
+		"`raw text` x.Field()": {"`raw text`", "x.Field()"},
+	}
+	for args, want := range cases {
+		if out := aliasWords(strings.TrimSpace(args)); !reflect.DeepEqual(out, want) {
+			t.Errorf("%q: expected %q got %q", args, want, out)
+		}
+	}
+}
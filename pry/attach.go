@@ -0,0 +1,76 @@
+// +build !js
+
+package pry
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	gotty "github.com/mattn/go-tty"
+	"github.com/pkg/errors"
+)
+
+// detachKey is Ctrl-], which detaches like it escapes telnet.
+const detachKey = 0x1d
+
+// Attach connects the terminal to a REPL served by ListenAndServe or a
+// breakpoint with a listen address until either side disconnects. target is
+// a TCP address, the path of a unix socket or the ID of a process serving on
+// its default socket. Ctrl-] detaches without continuing the program.
+func Attach(target string) error {
+	network, addr := replAddress(target)
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return errors.Wrapf(err, "connecting to %s", addr)
+	}
+	defer conn.Close()
+
+	tty, err := gotty.Open()
+	if err != nil {
+		return errors.Wrap(err, "opening the terminal")
+	}
+	defer tty.Close()
+	restore, err := tty.Raw()
+	if err != nil {
+		return errors.Wrap(err, "switching the terminal to raw mode")
+	}
+	defer restore()
+
+	if width, height, err := tty.Size(); err == nil {
+		conn.Write(telnetWindowSize(width, height))
+	}
+	go func() {
+		for size := range tty.SIGWINCH() {
+			conn.Write(telnetWindowSize(size.W, size.H))
+		}
+	}()
+	go func() {
+		for {
+			r, err := tty.ReadRune()
+			if err != nil {
+				return
+			}
+			if r == detachKey {
+				conn.Close()
+				return
+			}
+			if _, err := conn.Write([]byte(string(r))); err != nil {
+				return
+			}
+		}
+	}()
+
+	if _, err := io.Copy(os.Stdout, telnetReader{bufio.NewReader(conn)}); err != nil && !isClosedConn(err) {
+		return errors.Wrap(err, "reading from the REPL")
+	}
+	return nil
+}
+
+// isClosedConn returns whether err is from using a connection after closing
+// it, as detaching does.
+func isClosedConn(err error) bool {
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
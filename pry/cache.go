@@ -0,0 +1,100 @@
+package pry
+
+import (
+	"container/list"
+	"go/ast"
+	"sync"
+)
+
+// defaultParseCacheSize is the number of parsed sources kept by default.
+const defaultParseCacheSize = 256
+
+// parseKind is the entry point a source was parsed for, since the same
+// source parses differently for each.
+type parseKind int
+
+const (
+	// parseKindProgram is parseProgram.
+	parseKindProgram parseKind = iota
+)
+
+// parseKey identifies a parsed source.
+type parseKey struct {
+	kind parseKind
+	src  string
+}
+
+// parsed is a source parsed with parseProgram.
+type parsed struct {
+	key     parseKey
+	body    *ast.BlockStmt
+	shifted int
+}
+
+// parseCache keeps the most recently parsed sources, so evaluating the same
+// source again doesn't parse it again. The interpreter doesn't change the
+// ASTs it's given, so they're shared between evaluations.
+var parseCache = struct {
+	sync.Mutex
+	size    int
+	order   *list.List
+	entries map[parseKey]*list.Element
+}{
+	size:    defaultParseCacheSize,
+	order:   list.New(),
+	entries: map[parseKey]*list.Element{},
+}
+
+// SetParseCacheSize sets the number of parsed sources kept for evaluating the
+// same source again, such as for rule engines evaluating the same
+// expressions over and over. The least recently used are dropped first. Zero
+// or less disables the cache. It defaults to 256.
+func SetParseCacheSize(n int) {
+	parseCache.Lock()
+	defer parseCache.Unlock()
+
+	parseCache.size = n
+	for parseCache.order.Len() > 0 && parseCache.order.Len() > n {
+		evictParsed()
+	}
+}
+
+// evictParsed drops the least recently used source. The cache must be
+// locked.
+func evictParsed() {
+	e := parseCache.order.Back()
+	parseCache.order.Remove(e)
+	delete(parseCache.entries, e.Value.(*parsed).key)
+}
+
+// cachedParse returns the source parsed for key if it's cached.
+func cachedParse(key parseKey) (*parsed, bool) {
+	parseCache.Lock()
+	defer parseCache.Unlock()
+
+	e, ok := parseCache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	parseCache.order.MoveToFront(e)
+	return e.Value.(*parsed), true
+}
+
+// cacheParse caches p.
+func cacheParse(p *parsed) {
+	parseCache.Lock()
+	defer parseCache.Unlock()
+
+	if parseCache.size <= 0 {
+		return
+	}
+	if e, ok := parseCache.entries[p.key]; ok {
+		e.Value = p
+		parseCache.order.MoveToFront(e)
+		return
+	}
+	parseCache.entries[p.key] = parseCache.order.PushFront(p)
+	if parseCache.order.Len() > parseCache.size {
+		evictParsed()
+	}
+}
@@ -0,0 +1,80 @@
+package pry
+
+import (
+	"context"
+	"testing"
+)
+
+// The parse cache is global, so these tests don't run in parallel.
+
+func TestParseCache(t *testing.T) {
+	defer SetParseCacheSize(defaultParseCacheSize)
+	SetParseCacheSize(2)
+
+	a, _, _ := parseProgram("cacheA + 1")
+	if again, _, _ := parseProgram("cacheA + 1"); again != a {
+		t.Errorf("Expected %#v got %#v.", a, again)
+	}
+	b, _, _ := parseProgram("cacheB + 1")
+	// Using a makes b the least recently used.
+	parseProgram("cacheA + 1")
+	parseProgram("cacheC + 1")
+	if again, _, _ := parseProgram("cacheA + 1"); again != a {
+		t.Errorf("Expected %#v got %#v.", a, again)
+	}
+	if again, _, _ := parseProgram("cacheB + 1"); again == b {
+		t.Errorf("Expected cacheB to be evicted")
+	}
+
+	SetParseCacheSize(0)
+	c, _, _ := parseProgram("cacheC + 1")
+	if again, _, _ := parseProgram("cacheC + 1"); again == c {
+		t.Errorf("Expected the cache to be disabled")
+	}
+	if parseCache.order.Len() != 0 || len(parseCache.entries) != 0 {
+		t.Errorf("Expected an empty cache got %d entries", len(parseCache.entries))
+	}
+}
+
+func TestParseCacheEval(t *testing.T) {
+	// Cached sources are evaluated afresh every time, in any scope.
+	src := "x := 1; f := func() int { x++; return x }; f() + f()"
+	for i := 0; i < 3; i++ {
+		out, err := NewScope().InterpretString(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != 5 {
+			t.Errorf("Expected %#v got %#v.", 5, out)
+		}
+	}
+	// Parse errors aren't cached.
+	for i := 0; i < 2; i++ {
+		if _, err := NewScope().InterpretString("1 +"); err == nil {
+			t.Errorf("Expected a parse error")
+		}
+	}
+}
+
+func BenchmarkEvalParseCache(b *testing.B) {
+	defer SetParseCacheSize(defaultParseCacheSize)
+
+	scope := NewScope()
+	scope.Set("price", 120)
+	scope.Set("quantity", 3)
+	src := "price*quantity > 300 && quantity < 10"
+	for _, size := range []int{0, defaultParseCacheSize} {
+		name := "cached"
+		if size == 0 {
+			name = "uncached"
+		}
+		b.Run(name, func(b *testing.B) {
+			SetParseCacheSize(size)
+			for i := 0; i < b.N; i++ {
+				if _, err := EvalContext(context.Background(), scope, src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
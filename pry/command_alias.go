@@ -0,0 +1,172 @@
+package pry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":alias",
+		Category: categorySession,
+		Usage:    ":alias [--save] [name [= template]]",
+		Summary:  "Define a shortcut for an input, or list them.",
+		Help: "Statements starting with the name of an alias are replaced by " +
+			"its template before they're evaluated, with %1 to %9 replaced by " +
+			"the words after the name, %* by all of them and %% by a percent " +
+			"sign. Words are separated by spaces outside brackets and " +
+			"literals, so after :alias pp = fmt.Printf(\"%+v\\n\", %1), " +
+			"pp f(a, b) prints f(a, b). Aliases aren't expanded inside " +
+			"brackets, string literals or comments, or when they're assigned " +
+			"to, and templates can use other aliases as long as none uses " +
+			"itself. Without a template the alias is shown, and without " +
+			"arguments every alias is listed. --save keeps the alias in the " +
+			"rc file too.",
+		Run: runAlias,
+	})
+	registerCommand(&command{
+		Name:     ":unalias",
+		Category: categorySession,
+		Usage:    ":unalias [--save] name...",
+		Summary:  "Remove aliases.",
+		Help:     "--save removes them from the rc file too.",
+		Run:      runUnalias,
+	})
+}
+
+// saveFlag is the flag of :alias and :unalias keeping the change in the rc
+// file.
+const saveFlag = "--save"
+
+func runAlias(env *commandEnv, args []string) error {
+	text := env.argText
+	save := text == saveFlag || strings.HasPrefix(text, saveFlag+" ")
+	if save {
+		text = strings.TrimSpace(strings.TrimPrefix(text, saveFlag))
+	}
+	if len(text) == 0 {
+		if save {
+			return errors.New("usage: :alias --save name = template")
+		}
+		names := aliasNames(env.config)
+		if len(names) == 0 {
+			fmt.Fprintln(env.out, "No aliases.")
+			return nil
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(env.out, "  %s = %s\n", name, env.config.Aliases[name])
+		}
+		return nil
+	}
+
+	eq := strings.Index(text, "=")
+	if eq < 0 {
+		if save {
+			return errors.New("usage: :alias --save name = template")
+		}
+		template, ok := env.config.Aliases[text]
+		if !ok {
+			return errors.Errorf("no alias %s%s", text, didYouMean(text, aliasNames(env.config)))
+		}
+		fmt.Fprintf(env.out, "  %s = %s\n", text, template)
+		return nil
+	}
+	name := strings.TrimSpace(text[:eq])
+	template := strings.TrimSpace(text[eq+1:])
+	if err := checkAliasName(name); err != nil {
+		return err
+	}
+	if len(template) == 0 {
+		return errors.Errorf("the template of %s is empty; use :unalias %s to remove it", name, name)
+	}
+	aliases := map[string]string{name: template}
+	for other, t := range env.config.Aliases {
+		if other != name {
+			aliases[other] = t
+		}
+	}
+	// Cycles are caught when they're made rather than every time the
+	// alias is used.
+	if _, err := expandAliases(aliases, name); err != nil {
+		return err
+	}
+	if save {
+		if err := saveAlias(env.config.RCFile, name, template); err != nil {
+			return err
+		}
+	}
+	env.config.Aliases = aliases
+	return nil
+}
+
+func runUnalias(env *commandEnv, args []string) error {
+	save := len(args) > 0 && args[0] == saveFlag
+	if save {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return errors.New("usage: :unalias [--save] name...")
+	}
+	for _, name := range args {
+		if _, ok := env.config.Aliases[name]; !ok {
+			return errors.Errorf("no alias %s%s", name, didYouMean(name, aliasNames(env.config)))
+		}
+	}
+	for _, name := range args {
+		if save {
+			if err := saveAlias(env.config.RCFile, name, ""); err != nil {
+				return err
+			}
+		}
+		delete(env.config.Aliases, name)
+	}
+	return nil
+}
+
+// aliasNames returns the names of the aliases of c.
+func aliasNames(c *Config) []string {
+	var names []string
+	for name := range c.Aliases {
+		names = append(names, name)
+	}
+	return names
+}
+
+// saveAlias replaces the definitions of the alias name in the rc file at
+// path by one with template, or removes them if template is empty.
+func saveAlias(path, name, template string) error {
+	if len(path) == 0 {
+		return errors.New("there's no rc file to save aliases in")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "reading the rc file")
+	}
+	var lines []string
+	if text := strings.TrimSuffix(string(data), "\n"); len(text) > 0 {
+		for _, line := range strings.Split(text, "\n") {
+			fields := strings.Fields(strings.Replace(line, "=", " = ", 1))
+			if len(fields) > 1 && fields[0] == ":alias" && fields[1] == name {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(template) > 0 {
+		lines = append(lines, fmt.Sprintf(":alias %s = %s", name, template))
+	}
+	out := strings.Join(lines, "\n")
+	if len(lines) > 0 {
+		out += "\n"
+	}
+	if err := ioutil.WriteFile(path, []byte(out), 0644); err != nil {
+		return errors.Wrap(err, "writing the rc file")
+	}
+	return nil
+}
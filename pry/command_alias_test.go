@@ -0,0 +1,112 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAliasCommand(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	repl := &REPL{
+		In: strings.NewReader(strings.Join([]string{
+			":alias",
+			":alias double = %1 * 2",
+			":alias sum = %1 + %2",
+			"x := 21",
+			"double x",
+			`s := "double x"`,
+			"s",
+			"sum double(1) 3",
+			":alias",
+			":alias sum",
+			":alias loop = twice %1",
+			":alias twice = loop %1",
+			":unalias double",
+			"double x",
+		}, "\n") + "\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile(""), WithRCFile(""), WithAlias("double", "%1")},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput(t, out.String(),
+		"  double = %1\n",
+		"=> 42\n",
+		`=> "double x"`,
+		"undefined: double",
+		"  double = %1 * 2\n  sum = %1 + %2\n",
+		"  sum = %1 + %2\n",
+		"alias cycle: twice -> loop -> twice",
+		"expected ';', found x",
+	)
+}
+
+func TestAliasCommandSave(t *testing.T) {
+	t.Parallel()
+
+	rc := filepath.Join(t.TempDir(), ".gopryrc")
+	if err := ioutil.WriteFile(rc, []byte("x := 1\n:alias pp = old(%1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := newConfig(WithRCFile(rc))
+	env := &commandEnv{scope: NewScope(), out: &bytes.Buffer{}, config: config}
+	for _, input := range []string{":alias --save pp = fmt.Println(%*)", ":alias --save sq = %1 * %1", ":alias tmp = 1"} {
+		if _, err := runCommand(env, input); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x := 1\n:alias pp = fmt.Println(%*)\n:alias sq = %1 * %1\n"; string(data) != want {
+		t.Errorf("Expected %q got %q.", want, data)
+	}
+
+	if _, err := runCommand(env, ":unalias --save pp tmp"); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "x := 1\n:alias sq = %1 * %1\n"; string(data) != want {
+		t.Errorf("Expected %q got %q.", want, data)
+	}
+	if _, ok := config.Aliases["pp"]; ok {
+		t.Errorf("Expected pp to be removed.")
+	}
+
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{":alias 1x = 2", "alias names must be identifiers"},
+		{":alias help = 2", "help is a command"},
+		{":alias for = 2", "for is a keyword"},
+		{":alias sq =", "the template of sq is empty"},
+		{":alias sqq", "no alias sqq; did you mean sq?"},
+		{":unalias missing", "no alias missing"},
+		{":alias a = b %1", ""},
+		{":alias b = c %1", ""},
+		{":alias c = a", "alias cycle: c -> a -> b -> c"},
+	}
+	for _, c := range cases {
+		input, want := c.input, c.want
+		_, err := runCommand(env, input)
+		if len(want) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", input, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q got %v", input, want, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package pry
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"reflect"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":deepequal",
+		Category: categoryScope,
+		Usage:    ":deepequal <expr> <expr>",
+		Summary:  "Compare two expressions with reflect.DeepEqual.",
+		Help: "The expressions are separated by a space or a comma, such as " +
+			":deepequal got want. Unlike ==, slices, maps and structs holding " +
+			"them are compared by their contents and pointers by what they " +
+			"point to. The result is bound to _.",
+		Run: runDeepEqual,
+	})
+}
+
+func runDeepEqual(env *commandEnv, args []string) error {
+	x, y, ok := splitTwoExprs(env.argText)
+	if !ok {
+		return errors.New("usage: :deepequal <expr> <expr>")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := notifyInterrupt(cancel)
+	defer stop()
+
+	xv, err := env.scope.InterpretStringContext(ctx, x)
+	if err != nil {
+		return err
+	}
+	yv, err := env.scope.InterpretStringContext(ctx, y)
+	if err != nil {
+		return err
+	}
+	eq := reflect.DeepEqual(xv, yv)
+	env.scope.Set(resultVar, eq)
+	fmt.Fprintf(env.out, "=> %s\n", env.config.Theme.Highlight(strconv.FormatBool(eq), nil))
+	return nil
+}
+
+// splitTwoExprs splits text into two expressions at the first space or comma
+// both sides of which parse, so spaces and commas within the expressions,
+// such as in f(a, b), are kept.
+func splitTwoExprs(text string) (x, y string, ok bool) {
+	for i, r := range text {
+		if r != ' ' && r != ',' {
+			continue
+		}
+		x, y = text[:i], text[i+1:]
+		if _, err := parser.ParseExpr(x); err != nil {
+			continue
+		}
+		if _, err := parser.ParseExpr(y); err != nil {
+			continue
+		}
+		return x, y, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,47 @@
+package pry
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeepEqualCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	if _, err := scope.InterpretString(`a := []int{1, 2}; b := []int{1, 2}; c := map[string][]int{"x": a}`); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		args string
+		want string
+	}{
+		{"a b", "=> true\n"},
+		{"a, b", "=> true\n"},
+		{"a c", "=> false\n"},
+		{`c map[string][]int{"x": []int{1, 2}}`, "=> true\n"},
+		{"append(a, 3) b", "=> false\n"},
+		{"len(a)  2", "=> true\n"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: scope, out: &out, config: newConfig(WithTheme(NoColorTheme))}
+		if _, err := runCommand(env, ":deepequal "+c.args); err != nil {
+			t.Errorf(":deepequal %s: %v", c.args, err)
+			continue
+		}
+		if out.String() != c.want {
+			t.Errorf(":deepequal %s: Expected %#v got %#v.", c.args, c.want, out.String())
+		}
+	}
+	if result, _ := scope.Get(resultVar); result != true {
+		t.Errorf("Expected %#v got %#v.", true, result)
+	}
+
+	for _, args := range []string{"", "a", "a b c"} {
+		env := &commandEnv{scope: scope, out: &bytes.Buffer{}, config: newConfig()}
+		if _, err := runCommand(env, ":deepequal "+args); err == nil {
+			t.Errorf(":deepequal %s: Expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package pry
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":doc",
+		Category: categoryScope,
+		Usage:    ":doc <pkg.Symbol>",
+		Summary:  "Show the documentation of a package, function, type, method, variable or constant.",
+		Help: "Symbols are resolved the same way as selectors in expressions, so " +
+			"\":doc strings.Builder.WriteString\" and \":doc b.WriteString\" for a " +
+			"variable b both work. The documentation is read from the package " +
+			"source, which must be in GOPATH, the module cache or GOROOT.",
+		Run: runDoc,
+	})
+}
+
+func runDoc(env *commandEnv, args []string) error {
+	if len(env.argText) == 0 {
+		return errors.New("usage: :doc <pkg.Symbol>")
+	}
+	expr, err := parser.ParseExpr(env.argText)
+	if err != nil {
+		return newParseError(err, 0)
+	}
+	path, symbol, err := env.scope.docTarget(expr)
+	if err != nil {
+		return err
+	}
+	text, err := symbolDoc(path, symbol)
+	if err != nil {
+		return err
+	}
+	env.show(text)
+	return nil
+}
+
+// docTarget resolves expr to the import path of a package and the symbol in
+// it, e.g. "Builder" or "Builder.WriteString". The symbol is empty for the
+// package itself.
+func (scope *Scope) docTarget(expr ast.Expr) (path, symbol string, err error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return scope.docTarget(e.X)
+	case *ast.SelectorExpr:
+		// pkg.Type.Method doesn't need the type to be in the bundle.
+		if inner, ok := e.X.(*ast.SelectorExpr); ok {
+			if pkg, ok := scope.docPackage(inner.X); ok {
+				return pkg.importPath(), inner.Sel.Name + "." + e.Sel.Name, nil
+			}
+		}
+		x, err := scope.staticValue(e.X)
+		if err != nil {
+			return "", "", err
+		}
+		if pkg, ok := valueInterface(x).(Package); ok {
+			return pkg.importPath(), e.Sel.Name, nil
+		}
+		if typ, ok := valueInterface(x).(reflect.Type); ok {
+			return typeDocTarget(typ, e.Sel.Name, expr)
+		}
+		if !x.IsValid() {
+			return "", "", errors.Errorf("no documentation for %s: it's nil", types.ExprString(expr))
+		}
+		return typeDocTarget(x.Type(), e.Sel.Name, expr)
+	}
+
+	v, err := scope.staticValue(expr)
+	if err != nil {
+		return "", "", err
+	}
+	switch val := valueInterface(v).(type) {
+	case Package:
+		return val.importPath(), "", nil
+	case reflect.Type:
+		return typeDocTarget(val, "", expr)
+	case *Func:
+		return "", "", errors.Errorf("no documentation for %s: it's an interpreted function", types.ExprString(expr))
+	}
+	if !v.IsValid() {
+		return "", "", errors.Errorf("no documentation for %s: it's nil", types.ExprString(expr))
+	}
+	return typeDocTarget(v.Type(), "", expr)
+}
+
+// docPackage returns the package expr refers to, if any.
+func (scope *Scope) docPackage(expr ast.Expr) (Package, bool) {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return Package{}, false
+	}
+	v, ok := scope.Get(ident.Name)
+	if !ok {
+		return Package{}, false
+	}
+	pkg, ok := v.(Package)
+	return pkg, ok
+}
+
+// typeDocTarget returns the documentation target for the member of the named
+// type typ. Pointers are followed to the type they point to.
+func typeDocTarget(typ reflect.Type, member string, expr ast.Expr) (path, symbol string, err error) {
+	if typ.Kind() == reflect.Ptr && len(typ.Name()) == 0 {
+		typ = typ.Elem()
+	}
+	if len(typ.PkgPath()) == 0 || len(typ.Name()) == 0 {
+		return "", "", errors.Errorf("no documentation for %s: %s isn't a named package type", types.ExprString(expr), typ)
+	}
+	symbol = typ.Name()
+	if len(member) > 0 {
+		symbol += "." + member
+	}
+	return typ.PkgPath(), symbol, nil
+}
+
+// importPath returns the import path of the package. Bundles generated
+// before packages recorded their path only have the name, which is the path
+// for most standard library packages.
+func (pkg Package) importPath() string {
+	if len(pkg.Path) > 0 {
+		return pkg.Path
+	}
+	return pkg.Name
+}
+
+// docCache holds the parsed documentation by import path, and why it couldn't
+// be read for the packages whose source can't be found, so completion doesn't
+// look for them on every key.
+var docCache = struct {
+	sync.Mutex
+	docs map[string]*packageDoc
+	errs map[string]error
+}{docs: map[string]*packageDoc{}, errs: map[string]error{}}
+
+type packageDoc struct {
+	fset *token.FileSet
+	pkg  *doc.Package
+}
+
+// loadDoc reads the documentation of the package with the given import path
+// from its source.
+func loadDoc(path string) (*packageDoc, error) {
+	docCache.Lock()
+	defer docCache.Unlock()
+	if d, ok := docCache.docs[path]; ok {
+		return d, nil
+	}
+	if err, ok := docCache.errs[path]; ok {
+		return nil, err
+	}
+
+	bp, err := build.Import(path, ".", 0)
+	if err != nil {
+		err = errors.Wrapf(err, "finding the source of %q", path)
+		docCache.errs[path] = err
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(bp.Dir, name), nil, parser.ParseComments)
+		if err != nil {
+			err = errors.Wrapf(err, "parsing %q", path)
+			docCache.errs[path] = err
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	pkg, err := doc.NewFromFiles(fset, files, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading the documentation of %q", path)
+	}
+	d := &packageDoc{fset: fset, pkg: pkg}
+	docCache.docs[path] = d
+	return d, nil
+}
+
+// symbolDoc returns the declaration and documentation of symbol in the
+// package with the given import path, or the package documentation if
+// symbol is empty.
+func symbolDoc(path, symbol string) (string, error) {
+	d, err := loadDoc(path)
+	if err != nil {
+		return "", err
+	}
+	if len(symbol) == 0 {
+		return fmt.Sprintf("package %s // import %q\n\n%s", d.pkg.Name, path, d.pkg.Doc), nil
+	}
+
+	decl, text, err := d.lookup(symbol)
+	if err != nil {
+		return "", err
+	}
+	return d.format(decl, text), nil
+}
+
+// docSummary returns the first sentence of the documentation of symbol in the
+// package with the given import path, or of the package if symbol is empty.
+// It's empty if there is none.
+func docSummary(path, symbol string) string {
+	d, err := loadDoc(path)
+	if err != nil {
+		return ""
+	}
+	if len(symbol) == 0 {
+		return doc.Synopsis(d.pkg.Doc)
+	}
+	_, text, err := d.lookup(symbol)
+	if err != nil {
+		return ""
+	}
+	return doc.Synopsis(text)
+}
+
+// lookup returns the declaration and documentation of symbol, a top level
+// symbol or a method like "Type.Method".
+func (d *packageDoc) lookup(symbol string) (ast.Node, string, error) {
+	typeName, member := symbol, ""
+	if i := strings.Index(symbol, "."); i >= 0 {
+		typeName, member = symbol[:i], symbol[i+1:]
+	}
+	if len(member) == 0 {
+		for _, f := range d.pkg.Funcs {
+			if f.Name == symbol {
+				return f.Decl, f.Doc, nil
+			}
+		}
+		values := append(append([]*doc.Value{}, d.pkg.Consts...), d.pkg.Vars...)
+		for _, t := range d.pkg.Types {
+			for _, f := range t.Funcs {
+				if f.Name == symbol {
+					return f.Decl, f.Doc, nil
+				}
+			}
+			values = append(values, append(t.Consts, t.Vars...)...)
+		}
+		for _, v := range values {
+			for _, name := range v.Names {
+				if name == symbol {
+					return v.Decl, v.Doc, nil
+				}
+			}
+		}
+	}
+	for _, t := range d.pkg.Types {
+		if t.Name != typeName {
+			continue
+		}
+		if len(member) == 0 {
+			return t.Decl, t.Doc, nil
+		}
+		for _, f := range append(append([]*doc.Func{}, t.Methods...), t.Funcs...) {
+			if f.Name == member {
+				return f.Decl, f.Doc, nil
+			}
+		}
+		return nil, "", errors.Errorf("no documentation for %s.%s%s", d.pkg.Name, symbol, didYouMean(member, typeMembers(t)))
+	}
+	return nil, "", errors.Errorf("no documentation for %s.%s%s", d.pkg.Name, symbol, didYouMean(symbol, d.symbols()))
+}
+
+// format prints the declaration decl followed by its documentation.
+func (d *packageDoc) format(decl ast.Node, text string) string {
+	var b strings.Builder
+	printer.Fprint(&b, d.fset, decl)
+	b.WriteString("\n\n")
+	b.WriteString(text)
+	return b.String()
+}
+
+// symbols returns the names of the documented top level symbols.
+func (d *packageDoc) symbols() []string {
+	var names []string
+	values := append(append([]*doc.Value{}, d.pkg.Consts...), d.pkg.Vars...)
+	for _, f := range d.pkg.Funcs {
+		names = append(names, f.Name)
+	}
+	for _, t := range d.pkg.Types {
+		names = append(names, t.Name)
+		for _, f := range t.Funcs {
+			names = append(names, f.Name)
+		}
+		values = append(values, append(t.Consts, t.Vars...)...)
+	}
+	for _, v := range values {
+		names = append(names, v.Names...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// typeMembers returns the names of the methods of t.
+func typeMembers(t *doc.Type) []string {
+	var names []string
+	for _, f := range t.Methods {
+		names = append(names, f.Name)
+	}
+	return names
+}
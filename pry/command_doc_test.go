@@ -0,0 +1,82 @@
+package pry
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Path: "strings", Functions: map[string]interface{}{
+		"Index":   strings.Index,
+		"Builder": Type(strings.Builder{}),
+	}})
+	scope.Set("b", &strings.Builder{})
+
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{"strings", []string{"package strings // import \"strings\"", "Package strings implements"}},
+		{"strings.Index", []string{"func Index(s, substr string) int", "Index returns the index"}},
+		{"strings.Builder", []string{"type Builder struct", "A Builder is used"}},
+		{"strings.Builder.WriteString", []string{"func (b *Builder) WriteString(s string) (int, error)"}},
+		{"b.Len", []string{"func (b *Builder) Len() int"}},
+		{"b", []string{"type Builder struct"}},
+		{"strings.NewReader", []string{"func NewReader(s string) *Reader"}},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: scope, out: &out, config: newConfig()}
+		if _, err := runCommand(env, ":doc "+c.expr); err != nil {
+			t.Errorf(":doc %s: %v", c.expr, err)
+			continue
+		}
+		for _, want := range c.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf(":doc %s: expected %q in %q", c.expr, want, out.String())
+			}
+		}
+	}
+}
+
+func TestDocCommandUnknown(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Path: "strings", Functions: map[string]interface{}{}})
+	scope.Set("n", 1)
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"strings.Indx", "no documentation for strings.Indx; did you mean Index"},
+		{"strings.Builder.WriteStrin", "did you mean WriteString?"},
+		{"n", "isn't a named package type"},
+	}
+	for _, c := range cases {
+		env := &commandEnv{scope: scope, out: &bytes.Buffer{}, config: newConfig()}
+		_, err := runCommand(env, ":doc "+c.expr)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf(":doc %s: expected error containing %q got %v", c.expr, c.want, err)
+		}
+	}
+}
+
+func TestPackageImportPath(t *testing.T) {
+	t.Parallel()
+
+	got := []string{
+		Package{Name: "template", Path: "html/template"}.importPath(),
+		Package{Name: "strings"}.importPath(),
+	}
+	want := []string{"html/template", "strings"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %#v got %#v.", want, got)
+	}
+}
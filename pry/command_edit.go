@@ -0,0 +1,107 @@
+package pry
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":edit",
+		Category: categorySession,
+		Usage:    ":edit [N]",
+		Summary:  "Write an input in your editor, then run it.",
+		Help: "The editor, $EDITOR or vi, opens a Go file with the last input, " +
+			"or history entry N. Once it exits the file is shown and run as a " +
+			"single input, and added to the history. Nothing is run if the " +
+			"editor fails or the file is left empty.",
+		Run: runEdit,
+	})
+}
+
+func runEdit(env *commandEnv, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: :edit [N]")
+	}
+	text := ""
+	if env.history != nil {
+		n := env.history.Len() - 1
+		if len(args) == 1 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 0 {
+				return errors.Errorf("invalid history entry %q", args[0])
+			}
+			if n >= env.history.Len() {
+				return errors.Errorf("no history entry %d; the last is %d", n, env.history.Len()-1)
+			}
+		}
+		if n >= 0 {
+			text = env.history.Record(n)
+		}
+	} else if len(args) == 1 {
+		return errors.New("there's no history")
+	}
+
+	f, err := ioutil.TempFile("", "go-pry-edit-*.go")
+	if err != nil {
+		return errors.Wrap(err, "creating the file to edit")
+	}
+	defer os.Remove(f.Name())
+	if len(text) > 0 {
+		text += "\n"
+	}
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing the file to edit")
+	}
+
+	if err := runEditor(env, f.Name()); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return errors.Wrap(err, "reading the edited file")
+	}
+	edited := strings.TrimRight(string(data), " \t\r\n")
+	if len(strings.TrimSpace(edited)) == 0 {
+		return nil
+	}
+	env.rerun = edited
+	return nil
+}
+
+// runEditor runs the editor of the session on the file at path, giving it
+// the terminal until it exits.
+func runEditor(env *commandEnv, path string) error {
+	cmdLine := env.config.Editor
+	if len(strings.TrimSpace(cmdLine)) == 0 {
+		cmdLine = "vi"
+	}
+	args := strings.Fields(cmdLine)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdout = env.out
+	cmd.Stderr = env.out
+
+	in, out, resume, err := suspendTerminal(env.tty)
+	if err != nil {
+		return errors.Wrap(err, "suspending the terminal")
+	}
+	defer resume()
+	if in != nil {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = in, out, out
+	}
+	// Ctrl-C is the editor's while it runs.
+	defer notifyInterrupt(func() {})()
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "the editor %q failed, so nothing was run", cmdLine)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeEditor returns an editor running the shell script script, with the
+// path of the file to edit as $1.
+func fakeEditor(t *testing.T, script string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake editor is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "editor")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEditCommand(t *testing.T) {
+	t.Parallel()
+
+	// The editor doubles the input it's given.
+	editor := fakeEditor(t, `printf '%s * 2\n' "$(cat "$1")" > "$1"`)
+	historyFile := filepath.Join(t.TempDir(), "history")
+	var out bytes.Buffer
+	repl := &REPL{
+		In: strings.NewReader(strings.Join([]string{
+			"x := 20",
+			"x + 1",
+			":edit",
+			":edit 0",
+			"x",
+			":edit 9",
+		}, "\n") + "\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile(historyFile), WithEditor(editor)},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput(t, out.String(),
+		"x + 1 * 2\n=> 22\n",
+		"x := 20 * 2\n",
+		"=> 40\n",
+		"no history entry 9; the last is 4",
+	)
+	// The edited inputs are added to the history rather than :edit.
+	history, err := openHistory(newConfig(WithHistoryFile(historyFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"x := 20", "x + 1", "x + 1 * 2", "x := 20 * 2", "x", ":edit 9"}
+	if !reflect.DeepEqual(history.Records, want) {
+		t.Errorf("Expected the history %q got %q.", want, history.Records)
+	}
+}
+
+func TestEditCommandNothing(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		script string
+		want   string
+	}{
+		// Editors exiting with an error run nothing.
+		{`echo 'x := 1' > "$1"; exit 3`, "failed, so nothing was run: exit status 3"},
+		// And neither does leaving the file empty.
+		{`true`, ""},
+		{`: > "$1"`, ""},
+		{`printf '\n  \n' > "$1"`, ""},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		repl := &REPL{
+			In:      strings.NewReader(":edit\nx\n"),
+			Out:     &out,
+			Options: []Option{WithHistoryFile(""), WithEditor(fakeEditor(t, c.script))},
+		}
+		if err := repl.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		expectOutput(t, out.String(), c.want, "undefined: x")
+	}
+}
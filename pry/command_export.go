@@ -0,0 +1,38 @@
+package pry
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":export-scope",
+		Category: categoryScope,
+		Usage:    ":export-scope <file.json>",
+		Summary:  "Write the variables in scope to a JSON file for other tools.",
+		Help: "Each variable is written with its type, kind, whether assigning " +
+			"to it changes it and its value, nested and truncated like results " +
+			"are printed. Funcs, chans and values referring back to themselves " +
+			"are written as placeholders. Packages and shadowed variables are " +
+			"left out.",
+		Run: runExportScope,
+	})
+}
+
+func runExportScope(env *commandEnv, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: :export-scope <file.json>")
+	}
+	b, err := env.scope.SnapshotJSON(WithInspectDepth(env.config.InspectDepth), WithInspectMaxElems(env.config.InspectMaxElems))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(args[0], append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.out, "Exported the scope to %s\n", args[0])
+	return nil
+}
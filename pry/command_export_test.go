@@ -0,0 +1,51 @@
+package pry
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportScope(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "go-pry-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	scope := NewScope()
+	scope.Set("xs", []int{1, 2, 3})
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(WithInspectMaxElems(2))}
+	file := filepath.Join(dir, "scope.json")
+	if err := runExportScope(env, []string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Exported the scope to " + file + "\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot map[string]VarSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	// The limits of the session apply.
+	want := VarSnapshot{Type: "[]int", Kind: "slice", Value: []interface{}{1.0, 2.0, map[string]interface{}{"$more": 1.0}}, Addressable: true}
+	if !reflect.DeepEqual(snapshot["xs"], want) {
+		t.Errorf("Expected %#v got %#v.", want, snapshot["xs"])
+	}
+
+	if err := runExportScope(env, nil); err == nil {
+		t.Errorf("Expected a usage error")
+	}
+}
@@ -0,0 +1,66 @@
+package pry
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":hexdump",
+		Category: categoryScope,
+		Usage:    ":hexdump <expr>",
+		Summary:  "Show the bytes of a []byte, [N]byte or string as a hex dump.",
+		Help: "The expression is evaluated like any other input. Every byte is " +
+			"shown, whatever bytesformat and maxelems are set to, in rows of " +
+			"16 with their offset and printable characters, through the pager " +
+			"if there are many. The result is bound to _.",
+		Run: runHexdump,
+	})
+}
+
+func runHexdump(env *commandEnv, args []string) error {
+	if len(env.argText) == 0 {
+		return errors.New("usage: :hexdump <expr>")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := notifyInterrupt(cancel)
+	defer stop()
+
+	result, err := env.scope.InterpretStringContext(ctx, env.argText)
+	if err != nil {
+		return err
+	}
+	b, ok := dumpBytes(result)
+	if !ok {
+		return errors.Errorf("%s is a %s, not a []byte, [N]byte or string", env.argText, typeString(result))
+	}
+	env.scope.Set(resultVar, result)
+	if len(b) == 0 {
+		env.show("No bytes.\n")
+		return nil
+	}
+	env.show(hex.Dump(b))
+	return nil
+}
+
+// dumpBytes returns the bytes of v, if it's a []byte, a [N]byte or a string.
+func dumpBytes(v interface{}) ([]byte, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), true
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, false
+		}
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return b, true
+	}
+	return nil, false
+}
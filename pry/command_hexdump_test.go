@@ -0,0 +1,46 @@
+package pry
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHexdumpCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("payload", []byte("GET / HTTP/1.1\r\nHost: a\r\n"))
+	scope.Set("sum", [4]byte{0xde, 0xad, 0xbe, 0xef})
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(WithNoColor(), WithInspectMaxElems(1))}
+	cases := []struct {
+		input string
+		want  string
+	}{
+		// Every byte is shown, whatever the limits are.
+		{":hexdump payload", `00000000  47 45 54 20 2f 20 48 54  54 50 2f 31 2e 31 0d 0a  |GET / HTTP/1.1..|
+00000010  48 6f 73 74 3a 20 61 0d  0a                       |Host: a..|
+`},
+		{":hexdump sum", "00000000  de ad be ef                                       |....|\n"},
+		{":hexdump payload[:0]", "No bytes.\n"},
+		{`:hexdump "hi"`, "00000000  68 69                                             |hi|\n"},
+	}
+	for _, c := range cases {
+		out.Reset()
+		if _, err := runCommand(env, c.input); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.want {
+			t.Errorf("%s: Expected %#v got %#v.", c.input, c.want, out.String())
+		}
+	}
+	if result, _ := scope.Get(resultVar); result != "hi" {
+		t.Errorf("Expected %#v got %#v.", "hi", result)
+	}
+
+	for _, input := range []string{":hexdump", ":hexdump 1", ":hexdump []int{1}"} {
+		if _, err := runCommand(env, input); err == nil {
+			t.Errorf("%s: Expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package pry
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":history",
+		Category: categorySession,
+		Usage:    ":history [N | /regexp/ | !K]",
+		Summary:  "List the history, or re-execute entry K.",
+		Help: "Entries are numbered like the prompt, most recent last. N only " +
+			"lists the last N entries and /regexp/ the entries matching it. " +
+			"!K, or just !K on its own, runs entry K again as if it was typed " +
+			"and adds it to the history.",
+		Run: runHistory,
+	})
+}
+
+// historyShorthand matches !K, which re-executes history entry K.
+var historyShorthand = regexp.MustCompile(`^!\d+$`)
+
+func runHistory(env *commandEnv, args []string) error {
+	if env.history == nil {
+		return errors.New("there's no history")
+	}
+	if len(args) > 1 {
+		return errors.New("usage: :history [N | /regexp/ | !K]")
+	}
+
+	start := 0
+	var filter *regexp.Regexp
+	if len(args) == 1 {
+		arg := args[0]
+		switch {
+		case historyShorthand.MatchString(arg):
+			k, _ := strconv.Atoi(arg[1:])
+			if k >= env.history.Len() {
+				return errors.Errorf("no history entry %d; the last is %d", k, env.history.Len()-1)
+			}
+			record := env.history.Record(k)
+			if c, args, _ := lookupCommand(record); c != nil && c.Name == ":history" && len(args) == 1 && historyShorthand.MatchString(args[0]) {
+				return errors.Errorf("entry %d re-executes another entry itself", k)
+			}
+			env.rerun = record
+			return nil
+		case len(arg) >= 2 && strings.HasPrefix(arg, "/") && strings.HasSuffix(arg, "/"):
+			var err error
+			if filter, err = regexp.Compile(arg[1 : len(arg)-1]); err != nil {
+				return errors.Wrapf(err, "invalid regexp %q", arg)
+			}
+		default:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return errors.Errorf("invalid count %q", arg)
+			}
+			if start = env.history.Len() - n; start < 0 {
+				start = 0
+			}
+		}
+	}
+	env.show(formatHistory(env.history, start, filter))
+	return nil
+}
+
+// formatHistory lists the history entries from start on that match filter,
+// if it isn't nil. The lines after the first of multi-line entries are
+// indented under it.
+func formatHistory(history historyStore, start int, filter *regexp.Regexp) string {
+	width := len(strconv.Itoa(history.Len() - 1))
+	indent := strings.Repeat(" ", width+2)
+	var b strings.Builder
+	for i := start; i < history.Len(); i++ {
+		record := history.Record(i)
+		if filter != nil && !filter.MatchString(record) {
+			continue
+		}
+		fmt.Fprintf(&b, "%*d  %s\n", width, i, strings.Replace(record, "\n", "\n"+indent, -1))
+	}
+	if b.Len() == 0 {
+		return "No matching history.\n"
+	}
+	return b.String()
+}
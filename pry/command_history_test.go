@@ -0,0 +1,97 @@
+package pry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testHistory is an in-memory historyStore.
+type testHistory []string
+
+func (h testHistory) Len() int            { return len(h) }
+func (h testHistory) Record(i int) string { return h[i] }
+func (h *testHistory) Append(record string) error {
+	*h = append(*h, record)
+	return nil
+}
+
+func TestHistoryCommand(t *testing.T) {
+	t.Parallel()
+
+	history := &testHistory{"a := 1", "func() {\n\ta++\n}()", "b := a", ":vars", "!2"}
+	cases := []struct {
+		args string
+		want string
+	}{
+		{"", "0  a := 1\n1  func() {\n   \ta++\n   }()\n2  b := a\n3  :vars\n4  !2\n"},
+		{"2", "3  :vars\n4  !2\n"},
+		{"/a\\+\\+|b/", "1  func() {\n   \ta++\n   }()\n2  b := a\n"},
+		{"/missing/", "No matching history.\n"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: NewScope(), out: &out, config: newConfig(), history: history}
+		if _, err := runCommand(env, ":history "+c.args); err != nil {
+			t.Errorf(":history %s: %v", c.args, err)
+			continue
+		}
+		if out.String() != c.want {
+			t.Errorf(":history %s: expected %q got %q", c.args, c.want, out.String())
+		}
+	}
+}
+
+func TestHistoryRerun(t *testing.T) {
+	t.Parallel()
+
+	history := &testHistory{"a := 1", "!0", ":history !1"}
+	for _, input := range []string{":history !0", "!0"} {
+		env := &commandEnv{scope: NewScope(), out: &bytes.Buffer{}, config: newConfig(), history: history}
+		if _, err := runCommand(env, input); err != nil {
+			t.Fatal(err)
+		}
+		if env.rerun != "a := 1" {
+			t.Errorf("%s: expected %q to be re-executed got %q", input, "a := 1", env.rerun)
+		}
+	}
+
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"!3", "no history entry 3; the last is 2"},
+		{"!1", "re-executes another entry"},
+		{":history !2", "re-executes another entry"},
+		{":history x", "invalid count"},
+		{":history /(/", "invalid regexp"},
+	}
+	for _, c := range cases {
+		env := &commandEnv{scope: NewScope(), out: &bytes.Buffer{}, config: newConfig(), history: history}
+		_, err := runCommand(env, c.input)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected error containing %q got %v", c.input, c.want, err)
+		}
+	}
+}
+
+func TestCLIHistoryRerun(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte("a := 1\n"))
+	env.Write([]byte("a++\n"))
+	env.Write([]byte("!1\n"))
+	env.Write([]byte("a\n"))
+
+	succeedsSoon(t, func() error {
+		if !strings.Contains(ansiEscape.ReplaceAllString(env.Output(), ""), "=> 3\n") {
+			return errors.Errorf("expected a++ to run again\nOutput:\n%s\n", env.Output())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,222 @@
+package pry
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":load",
+		Category: categorySession,
+		Usage:    ":load <file.go>",
+		Summary:  "Run a Go file in the current scope.",
+		Help: "The file is either a normal Go file with a package clause or a " +
+			"sequence of statements. Functions, variables and constants are " +
+			"defined in the scope and imports must name packages that are " +
+			"already available. Relative paths are resolved against the " +
+			"working directory. Loading a file again redefines its names.",
+		Run: runLoad,
+	})
+}
+
+func runLoad(env *commandEnv, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: :load <file.go>")
+	}
+	file := args[0]
+	if !filepath.IsAbs(file) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		file = filepath.Join(wd, file)
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	names, err := env.scope.load(args[0], string(src))
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(env.out, "Loaded %s: nothing was defined.\n", args[0])
+		return nil
+	}
+	fmt.Fprintf(env.out, "Loaded %s: %s\n", args[0], strings.Join(names, ", "))
+	return nil
+}
+
+// loadPrefix wraps files of bare statements in a function so they can be
+// parsed. It's on the first line so line numbers are unchanged.
+const loadPrefix = "package main; func _() {"
+
+// load interprets the Go source src read from filename in the scope and
+// returns the top level names it defined, in order. The hooks of the scope
+// see the file as one evaluation.
+func (scope *Scope) load(filename, src string) (names []string, err error) {
+	hooks := scope.hooks()
+	start := time.Now()
+	defer func() {
+		afterEval(hooks, src, &Result{Kind: ResultDeclaration, Declared: names, Duration: time.Since(start)}, err)
+	}()
+	if err := beforeEval(hooks, src); err != nil {
+		return nil, err
+	}
+
+	text := src
+	_, err = parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly)
+	bare := err != nil
+	if bare {
+		text = loadPrefix + src + "\n}"
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), filename, text, 0)
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok && bare {
+			for _, e := range list {
+				if e.Pos.Line == 1 {
+					e.Pos.Column -= len(loadPrefix)
+				}
+			}
+		}
+		return nil, err
+	}
+
+	// The file set only has this file, so a position less one is its offset
+	// in text.
+	prev := scope.src
+	scope.src = &source{text: text, name: filename}
+	defer func() {
+		scope.src = prev
+	}()
+	l := &loader{scope: scope, seen: map[string]bool{}}
+	if bare {
+		body := file.Decls[0].(*ast.FuncDecl).Body
+		for _, stmt := range body.List {
+			if err := l.stmt(stmt); err != nil {
+				return l.names, err
+			}
+		}
+		return l.names, nil
+	}
+	for _, decl := range file.Decls {
+		if err := l.decl(decl); err != nil {
+			return l.names, err
+		}
+	}
+	return l.names, nil
+}
+
+// loader interprets the statements and declarations of a loaded file.
+type loader struct {
+	scope *Scope
+	names []string
+	seen  map[string]bool
+}
+
+// define records that name was defined.
+func (l *loader) define(names ...*ast.Ident) {
+	for _, name := range names {
+		if name.Name == "_" || l.seen[name.Name] {
+			continue
+		}
+		l.seen[name.Name] = true
+		l.names = append(l.names, name.Name)
+	}
+}
+
+// errorf returns an error prefixed with the file and line of node.
+func (l *loader) errorf(node ast.Node, format string, args ...interface{}) error {
+	pos := l.scope.src.position(node.Pos())
+	return errors.Errorf("%s:%d: %s", pos.Filename, pos.Line, fmt.Sprintf(format, args...))
+}
+
+// wrap prefixes err with the file and line of node.
+func (l *loader) wrap(node ast.Node, err error) error {
+	pos := l.scope.src.position(node.Pos())
+	return errors.Wrapf(err, "%s:%d", pos.Filename, pos.Line)
+}
+
+func (l *loader) stmt(stmt ast.Stmt) error {
+	if _, err := l.scope.Interpret(stmt); err != nil {
+		return l.wrap(stmt, err)
+	}
+	switch s := stmt.(type) {
+	case *ast.AssignStmt:
+		if s.Tok == token.DEFINE {
+			for _, lhs := range s.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok {
+					l.define(ident)
+				}
+			}
+		}
+	case *ast.DeclStmt:
+		l.defineGen(s.Decl.(*ast.GenDecl))
+	}
+	return nil
+}
+
+func (l *loader) decl(decl ast.Decl) error {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil {
+			return l.errorf(d, "methods aren't supported")
+		}
+		lit := &ast.FuncLit{Type: d.Type, Body: d.Body}
+		if d.Name.Name == "init" {
+			if _, err := l.scope.Interpret(&ast.CallExpr{Fun: lit}); err != nil {
+				return l.wrap(d, err)
+			}
+			return nil
+		}
+		l.scope.Set(d.Name.Name, &Func{Def: lit, src: l.scope.src, scope: l.scope})
+		l.define(d.Name)
+		return nil
+	case *ast.GenDecl:
+		switch d.Tok {
+		case token.IMPORT:
+			for _, spec := range d.Specs {
+				if err := l.checkImport(spec.(*ast.ImportSpec)); err != nil {
+					return err
+				}
+			}
+			return nil
+		case token.TYPE:
+			return l.errorf(d, "type declarations aren't supported")
+		}
+		if _, err := l.scope.Interpret(d); err != nil {
+			return l.wrap(d, err)
+		}
+		l.defineGen(d)
+	}
+	return nil
+}
+
+// defineGen records the names declared by a var or const declaration.
+func (l *loader) defineGen(d *ast.GenDecl) {
+	for _, spec := range d.Specs {
+		if vs, ok := spec.(*ast.ValueSpec); ok {
+			l.define(vs.Names...)
+		}
+	}
+}
+
+// checkImport makes sure an imported package is available in the scope and
+// binds the name it's imported as.
+func (l *loader) checkImport(spec *ast.ImportSpec) error {
+	if err := l.scope.importPackage(spec); err != nil {
+		return l.wrap(spec, err)
+	}
+	return nil
+}
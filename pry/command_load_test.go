@@ -0,0 +1,125 @@
+package pry
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	t.Parallel()
+
+	src := `package helpers
+
+import "strings"
+
+const greeting = "hello"
+
+var shout = strings.ToUpper(greeting)
+
+func double(n int) int {
+	return n * 2
+}
+
+func init() {
+	shout += "!"
+}
+`
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Functions: map[string]interface{}{"ToUpper": strings.ToUpper}})
+	names, err := scope.load("helpers.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"greeting", "shout", "double"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %#v got %#v.", want, names)
+	}
+	if shout, _ := scope.Get("shout"); shout != "HELLO!" {
+		t.Errorf("Expected %#v got %#v.", "HELLO!", shout)
+	}
+	out, err := scope.InterpretString(`double(2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 4 {
+		t.Errorf("Expected %#v got %#v.", 4, out)
+	}
+
+	// Loading the file again redefines the names.
+	if _, err := scope.load("helpers.go", strings.Replace(src, "n * 2", "n * 3", 1)); err != nil {
+		t.Fatal(err)
+	}
+	out, err = scope.InterpretString(`double(2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != 6 {
+		t.Errorf("Expected %#v got %#v.", 6, out)
+	}
+}
+
+func TestLoadStatements(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	names, err := scope.load("fixtures.go", "a := 1\nvar b = a + 1\nb++\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected %#v got %#v.", want, names)
+	}
+	if b, _ := scope.Get("b"); b != 3 {
+		t.Errorf("Expected %#v got %#v.", 3, b)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"a := 1\nb := missing\n", "bad.go:2: undefined: missing"},
+		{"a := )", "bad.go:1:6: expected operand"},
+		{"package p\n\nimport \"net/http\"\n", `bad.go:3: package "net/http" isn't available in this session`},
+		{"package p\n\ntype T struct{}\n", "bad.go:3: type declarations aren't supported"},
+	}
+	for _, c := range cases {
+		_, err := NewScope().load("bad.go", c.src)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("load(%q): expected error containing %q got %v", c.src, c.want, err)
+		}
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "go-pry-load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "helpers.go")
+	if err := ioutil.WriteFile(file, []byte("x := 1\ny := 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	env := &commandEnv{scope: NewScope(), out: &out, config: newConfig()}
+	if _, err := runCommand(env, ":load "+file); err != nil {
+		t.Fatal(err)
+	}
+	want := "Loaded " + file + ": x, y\n"
+	if out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+}
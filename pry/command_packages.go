@@ -0,0 +1,95 @@
+package pry
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":packages",
+		Category: categoryScope,
+		Usage:    ":packages [pattern]",
+		Summary:  "List the packages in scope with their import paths.",
+		Help: "Names are matched against the glob pattern, e.g. \"net*\". " +
+			"Packages go-pry skipped when generating the scope, because " +
+			".pryignore, -exclude or -include left them out or they have " +
+			"more exports than -max-exports, are listed with the reason and " +
+			"have no members. Members the generated code can't refer to, such " +
+			"as constants too large for any type, are listed as unavailable. " +
+			"Packages and members the sandbox policy blocks are marked.",
+		Run: runPackages,
+	})
+}
+
+func runPackages(env *commandEnv, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: :packages [pattern]")
+	}
+	pattern := ""
+	if len(args) == 1 {
+		pattern = args[0]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid pattern %q", pattern)
+		}
+	}
+	fmt.Fprint(env.out, formatPackages(env.scope.bindings(), pattern, env.scope.currentPolicy()))
+	return nil
+}
+
+// formatPackages renders a table of the packages among the bindings whose
+// name matches the pattern, marking what the policy p blocks.
+func formatPackages(bindings []binding, pattern string, p *Policy) string {
+	sort.SliceStable(bindings, func(i, j int) bool {
+		return bindings[i].name < bindings[j].name
+	})
+	var b strings.Builder
+	table := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, binding := range bindings {
+		pkg, ok := binding.value.(Package)
+		if !ok || binding.shadowed {
+			continue
+		}
+		if len(pattern) > 0 {
+			if ok, _ := path.Match(pattern, binding.name); !ok {
+				continue
+			}
+		}
+		fmt.Fprintf(table, "  %s\t%s\t%s\n", binding.name, pkg.Path, packageSummary(pkg, p))
+	}
+	table.Flush()
+	if b.Len() == 0 {
+		return "No matching packages.\n"
+	}
+	return b.String()
+}
+
+// packageSummary describes the members of pkg, or why it was skipped, and
+// which of them the policy p blocks.
+func packageSummary(pkg Package, p *Policy) string {
+	if len(pkg.Skipped) > 0 {
+		return "skipped (" + pkg.Skipped + ")"
+	}
+	pkg = pkg.loaded()
+	summary := "1 member"
+	if n := len(pkg.Keys()); n != 1 {
+		summary = fmt.Sprintf("%d members", n)
+	}
+	if len(pkg.Unavailable) > 0 {
+		var names []string
+		for name := range pkg.Unavailable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		summary += fmt.Sprintf(", %d unavailable (%s)", len(names), strings.Join(names, ", "))
+	}
+	if blocked := p.blockedSummary(pkg); len(blocked) > 0 {
+		summary += ", " + blocked
+	}
+	return summary
+}
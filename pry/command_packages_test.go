@@ -0,0 +1,48 @@
+package pry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPackagesCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Path: "strings", Functions: map[string]interface{}{"Index": strings.Index}})
+	scope.Set("kubernetes", Package{Name: "kubernetes", Path: "k8s.io/client-go/kubernetes", Skipped: "excluded"})
+	scope.Set("math", Package{Name: "math", Path: "math", Consts: map[string]interface{}{"Pi": 3.14}, Unavailable: map[string]string{"Huge": "the constant overflows float64"}})
+	scope.Set("x", 1)
+
+	cases := []struct {
+		cmd  string
+		want string
+	}{
+		{":packages", "  kubernetes  k8s.io/client-go/kubernetes  skipped (excluded)\n  math        math                         1 member, 1 unavailable (Huge)\n  strings     strings                      1 member\n"},
+		{":packages str*", "  strings  strings  1 member\n"},
+		{":packages y*", "No matching packages.\n"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: scope, out: &out, config: newConfig()}
+		if _, err := runCommand(env, c.cmd); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != c.want {
+			t.Errorf("%s: Expected %#v got %#v.", c.cmd, c.want, got)
+		}
+	}
+
+	_, err := scope.InterpretString("kubernetes.NewForConfig")
+	want := "kubernetes.NewForConfig is unavailable: go-pry skipped the package k8s.io/client-go/kubernetes (excluded); list it with -include or as !k8s.io/client-go/kubernetes in .pryignore to use it"
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected %#v got %#v.", want, err)
+	}
+
+	_, err = scope.InterpretString("math.Huge")
+	want = "math.Huge is unavailable: the constant overflows float64"
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected %#v got %#v.", want, err)
+	}
+}
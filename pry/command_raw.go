@@ -0,0 +1,46 @@
+package pry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":raw",
+		Category: categoryScope,
+		Usage:    ":raw <expr>",
+		Summary:  "Print an expression by its fields, ignoring String and Error methods.",
+		Help: "Results are normally shown by their registered formatter or " +
+			"their String or Error method, such as net.IP(127.0.0.1). :raw " +
+			"evaluates the expression like any other input and shows the " +
+			"fields of the result and of every value in it instead, with the " +
+			"addresses of pointers, like (*int)(0xc000012345) &1. The " +
+			"result is bound to _.",
+		Run: runRaw,
+	})
+}
+
+func runRaw(env *commandEnv, args []string) error {
+	if len(env.argText) == 0 {
+		return errors.New("usage: :raw <expr>")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := notifyInterrupt(cancel)
+	defer stop()
+
+	result, err := env.scope.InterpretStringContext(ctx, env.argText)
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		env.scope.Set(resultVar, result)
+	}
+	raw := *env.config
+	raw.InspectRaw = true
+	fmt.Fprintf(env.out, "=> %s\n", env.config.Theme.Highlight(raw.inspect(result), nil))
+	return nil
+}
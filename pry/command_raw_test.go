@@ -0,0 +1,31 @@
+package pry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRawCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	boom := errors.New("boom")
+	scope.Set("err", boom)
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(WithTheme(NoColorTheme))}
+	if _, err := runCommand(env, ":raw []interface{}{err}"); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("=> []interface {}{\n  (*errors.errorString)(%p) &errors.errorString{s: \"boom\"},\n}\n", boom); out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+	if result, _ := scope.Get(resultVar); result == nil {
+		t.Errorf("Expected the result to be bound to _")
+	}
+
+	if _, err := runCommand(env, ":raw"); err == nil {
+		t.Errorf("Expected a usage error")
+	}
+}
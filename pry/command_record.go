@@ -0,0 +1,62 @@
+package pry
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":record",
+		Category: categorySession,
+		Usage:    ":record [--timestamps] [file | off]",
+		Summary:  "Record the session to a file, or stop recording it.",
+		Help: "Every prompt and input from then on is written to the file with " +
+			"the output, without colors, so the session can be shared. The " +
+			"file is appended to if it exists. --timestamps starts each input " +
+			"with the time it was typed. The file is written in the " +
+			"background, and output is dropped with a warning rather than " +
+			"holding up the session if the disk can't keep up. Without " +
+			"arguments it shows where the session is recorded.",
+		Run: runRecord,
+	})
+}
+
+func runRecord(env *commandEnv, args []string) error {
+	timestamps := env.config.RecordTimestamps
+	if len(args) > 0 && args[0] == "--timestamps" {
+		timestamps = true
+		args = args[1:]
+	}
+	if len(args) > 1 || (len(args) == 0 && timestamps) {
+		return errors.New("usage: :record [--timestamps] [file | off]")
+	}
+	if env.session == nil {
+		return errors.New("no session to record")
+	}
+	t := env.session.transcript
+	if len(args) == 0 {
+		if t == nil {
+			fmt.Fprintln(env.out, "Not recording.")
+		} else {
+			fmt.Fprintf(env.out, "Recording to %s.\n", t.path)
+		}
+		return nil
+	}
+	if args[0] == "off" {
+		if t == nil {
+			return errors.New("not recording")
+		}
+		if err := env.session.stopRecording(); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.out, "Stopped recording to %s.\n", t.path)
+		return nil
+	}
+	if err := env.session.record(args[0], timestamps); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.out, "Recording to %s.\n", args[0])
+	return nil
+}
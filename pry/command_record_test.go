@@ -0,0 +1,152 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRecordCommand(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "transcript.txt")
+	if err := ioutil.WriteFile(path, []byte("earlier\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	repl := &REPL{
+		In: strings.NewReader(strings.Join([]string{
+			"a := 1",
+			":record " + path,
+			":record",
+			"a + 1",
+			":record off",
+			"a + 2",
+			":record off",
+		}, "\n") + "\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile(""), WithTheme(DefaultTheme)},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput(t, out.String(), "Recording to "+path+".\n", "Stopped recording to "+path+".\n", "not recording")
+
+	// The file is appended to, without the colors.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "earlier\n" +
+		"Recording to " + path + ".\n" +
+		"[2] go-pry> :record\n" +
+		"Recording to " + path + ".\n" +
+		"[3] go-pry> a + 1\n" +
+		"=> 2\n" +
+		"[4] go-pry> :record off\n"
+	if string(data) != want {
+		t.Errorf("Expected %q got %q.", want, data)
+	}
+}
+
+// panickingEditor is a scriptedEditor panicking once the script is over.
+type panickingEditor struct {
+	scriptedEditor
+}
+
+func (e *panickingEditor) ReadLine(prompt string) (string, error) {
+	if len(e.script) == 0 {
+		panic("editor broke")
+	}
+	return e.scriptedEditor.ReadLine(prompt)
+}
+
+func TestRecordFromStart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "transcript.txt")
+	editor := &panickingEditor{scriptedEditor{script: []scriptedLine{{line: "1 + 1"}}}}
+	repl := &REPL{
+		Out:     &bytes.Buffer{},
+		Options: []Option{WithHistoryFile(""), WithLineEditor(editor), WithRecord(path), WithRecordTimestamps()},
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "editor broke" {
+				t.Errorf("Expected the editor to panic got %v.", r)
+			}
+		}()
+		repl.Run(context.Background())
+	}()
+
+	// The transcript is written even though the session panicked.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^\[\d\d:\d\d:\d\d\] \[0\] go-pry> 1 \+ 1\n=> 2\n$`).Match(data) {
+		t.Errorf("Unexpected transcript %q.", data)
+	}
+}
+
+// slowWriter is a file whose writes wait for release, after signaling
+// started.
+type slowWriter struct {
+	bytes.Buffer
+	started, release chan struct{}
+	err              error
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	w.started <- struct{}{}
+	<-w.release
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *slowWriter) Close() error {
+	return nil
+}
+
+func TestTranscriptSlowDisk(t *testing.T) {
+	t.Parallel()
+
+	w := &slowWriter{started: make(chan struct{}, 10), release: make(chan struct{})}
+	tr := newTranscript(w, 10)
+	tr.Write([]byte("12345678"))
+	<-w.started
+	// Output is held while the disk is busy, up to the limit, and dropped
+	// beyond it without waiting.
+	tr.Write([]byte("\033[31mabcdefgh\033[0m"))
+	tr.Write([]byte("ABCDEFGH"))
+	if want := "the transcript dropped 8 bytes of output because the disk is too slow"; tr.warning() != want {
+		t.Errorf("Expected the warning %q.", want)
+	}
+	if warning := tr.warning(); len(warning) > 0 {
+		t.Errorf("Expected the warning to be given once got %q.", warning)
+	}
+	close(w.release)
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "12345678abcdefgh"; w.String() != want {
+		t.Errorf("Expected %q got %q.", want, w.String())
+	}
+
+	// Errors stop the recording.
+	w = &slowWriter{started: make(chan struct{}, 10), release: make(chan struct{}), err: errors.New("disk full")}
+	close(w.release)
+	tr = newTranscript(w, 10)
+	tr.Write([]byte("x"))
+	if err := tr.Close(); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Expected the write error got %v.", err)
+	}
+}
@@ -0,0 +1,73 @@
+package pry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":reset",
+		Category: categoryScope,
+		Usage:    ":reset [--force] [name...]",
+		Summary:  "Remove the variables defined in the session, or only the named ones.",
+		Help: "Without names every variable defined since the session started " +
+			"is removed. Packages, builtins and the variables of the program " +
+			"are kept, and the history isn't changed. Names the REPL relies on, " +
+			"such as the result variable _, are only removed with --force.",
+		Run: runReset,
+	})
+}
+
+// reservedNames are bound by the REPL itself.
+var reservedNames = map[string]bool{
+	"_pryScope": true,
+	resultVar:   true,
+}
+
+func runReset(env *commandEnv, args []string) error {
+	force := false
+	var names []string
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+			continue
+		}
+		names = append(names, arg)
+	}
+
+	if len(names) == 0 {
+		for _, b := range env.scope.bindings() {
+			if _, ok := b.value.(Package); ok || b.shadowed || reservedNames[b.name] {
+				continue
+			}
+			if env.session != nil && env.session.initial[b.name] {
+				continue
+			}
+			names = append(names, b.name)
+		}
+	} else {
+		for _, name := range names {
+			if reservedNames[name] && !force {
+				return errors.Errorf("%s is used by the REPL; use :reset --force %s to remove it anyway", name, name)
+			}
+			if _, ok := env.scope.Get(name); !ok {
+				return errors.Errorf("undefined: %s%s", name, didYouMean(name, env.scope.identCandidates()))
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		fmt.Fprintln(env.out, "Nothing to remove.")
+		return nil
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env.scope.Delete(name)
+	}
+	fmt.Fprintf(env.out, "Removed %s\n", strings.Join(names, ", "))
+	return nil
+}
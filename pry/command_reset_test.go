@@ -0,0 +1,108 @@
+package pry
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestResetCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings"})
+	scope.Set("local", 1)
+	sess := newSession(scope)
+	for _, input := range []string{"a := 1", "b := 2", "c := 3"} {
+		if _, err := scope.InterpretString(input); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(), session: sess}
+	if _, err := runCommand(env, ":reset c"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Removed c\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+
+	out.Reset()
+	if _, err := runCommand(env, ":reset"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Removed a, b\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+	keys := scope.Keys()
+	sort.Strings(keys)
+	want := []string{"_pryScope", "local", "strings"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected %#v got %#v.", want, keys)
+	}
+
+	out.Reset()
+	if _, err := runCommand(env, ":reset"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Nothing to remove.\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+}
+
+func TestResetCommandErrors(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("value", 1)
+	scope.Set(resultVar, 2)
+	env := &commandEnv{scope: scope, out: &bytes.Buffer{}, config: newConfig()}
+
+	cases := []struct {
+		args string
+		want string
+	}{
+		{"_pryScope", "use :reset --force _pryScope"},
+		{"_", "use :reset --force _"},
+		{"valeu", "undefined: valeu; did you mean value?"},
+	}
+	for _, c := range cases {
+		_, err := runCommand(env, ":reset "+c.args)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf(":reset %s: expected error containing %q got %v", c.args, c.want, err)
+		}
+	}
+	if _, ok := scope.Get("value"); !ok {
+		t.Errorf("a failed :reset shouldn't remove anything")
+	}
+
+	if _, err := runCommand(env, ":reset --force _pryScope"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := scope.Get("_pryScope"); ok {
+		t.Errorf("Expected --force to remove _pryScope")
+	}
+}
+
+func TestScopeDelete(t *testing.T) {
+	t.Parallel()
+
+	parent := NewScope()
+	parent.Set("a", 1)
+	child := parent.NewChild()
+	shadow := 2
+	child.Vals["a"] = &shadow
+
+	if !child.Delete("a") {
+		t.Fatal("Expected a to be deleted")
+	}
+	if v, _ := child.Get("a"); v != 1 {
+		t.Errorf("Expected %#v got %#v.", 1, v)
+	}
+	if !child.Delete("a") || child.Delete("a") {
+		t.Errorf("Expected a to be deleted from the parent once")
+	}
+}
@@ -0,0 +1,296 @@
+package pry
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"html"
+	"io/ioutil"
+	"math"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":save",
+		Category: categorySession,
+		Usage:    ":save [--html] [range] <file.go>",
+		Summary:  "Write the inputs of the session to a Go program.",
+		Help: "Inputs that failed and commands are skipped. The range limits the " +
+			"inputs to the numbers shown by the prompt, e.g. \"3-17\" or \"5\". " +
+			"Expressions are printed with fmt.Println like the REPL does, " +
+			"repeated := become assignments and the packages used are imported. " +
+			"With --html the program is written highlighted in a web page instead.",
+		Run: runSave,
+	})
+}
+
+func runSave(env *commandEnv, args []string) error {
+	asHTML := false
+	if len(args) > 0 && args[0] == "--html" {
+		asHTML = true
+		args = args[1:]
+	}
+	from, to := 0, math.MaxInt32
+	switch len(args) {
+	case 1:
+	case 2:
+		var err error
+		if from, to, err = parseRange(args[0]); err != nil {
+			return err
+		}
+		args = args[1:]
+	default:
+		return errors.New("usage: :save [--html] [range] <file.go>")
+	}
+	if env.session == nil {
+		return errors.New("no session to save")
+	}
+	entries := env.session.succeeded(from, to)
+	if len(entries) == 0 {
+		return errors.New("no inputs to save")
+	}
+	src, err := env.scope.sessionProgram(entries)
+	if err != nil {
+		return err
+	}
+	if asHTML {
+		if src, err = htmlPage(filepath.Base(args[0]), string(src), env.scope); err != nil {
+			return err
+		}
+	}
+	if err := ioutil.WriteFile(args[0], src, 0644); err != nil {
+		return err
+	}
+	inputs := "inputs"
+	if len(entries) == 1 {
+		inputs = "input"
+	}
+	fmt.Fprintf(env.out, "Saved %d %s to %s\n", len(entries), inputs, args[0])
+	return nil
+}
+
+// htmlPage returns a web page showing src highlighted.
+func htmlPage(title, src string, scope *Scope) ([]byte, error) {
+	highlighted, err := HighlightWith(src, Style{Scope: scope}, BackendHTML)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n<pre>%s</pre>\n</body>\n</html>\n",
+		html.EscapeString(title), HighlightCSS, highlighted)
+	return b.Bytes(), nil
+}
+
+// parseRange parses an inclusive range of input numbers such as "3-17" or
+// "5".
+func parseRange(s string) (from, to int, err error) {
+	parts := strings.SplitN(s, "-", 2)
+	if from, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, errors.Errorf("invalid range %q", s)
+	}
+	to = from
+	if len(parts) == 2 {
+		if to, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, errors.Errorf("invalid range %q", s)
+		}
+	}
+	if from > to {
+		return 0, 0, errors.Errorf("invalid range %q: %d is after %d", s, from, to)
+	}
+	return from, to, nil
+}
+
+// savePrefix wraps an input so it parses as statements, like ParseString.
+const savePrefix = "func(){"
+
+// edit replaces the text at [start, end) of an input.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// sessionProgram returns a formatted Go program running the inputs of
+// entries in order.
+func (scope *Scope) sessionProgram(entries []sessionEntry) ([]byte, error) {
+	defined := map[string]bool{}
+	uses := map[string]int{}
+	assigns := map[string]int{}
+	imports := map[string]string{}
+	var order []string
+	var body bytes.Buffer
+
+	for _, entry := range entries {
+		wrapped := savePrefix + entry.input + "\n}"
+		expr, err := parser.ParseExpr(wrapped)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing input %d", entry.number)
+		}
+		stmts := expr.(*ast.FuncLit).Body.List
+		offset := func(pos token.Pos) int { return int(pos) - 1 }
+		var edits []edit
+
+		for _, stmt := range stmts {
+			var lhs []ast.Expr
+			switch s := stmt.(type) {
+			case *ast.AssignStmt:
+				lhs = s.Lhs
+				if s.Tok == token.DEFINE {
+					isNew := false
+					for _, e := range s.Lhs {
+						if ident, ok := e.(*ast.Ident); ok && ident.Name != "_" && !defined[ident.Name] {
+							defined[ident.Name] = true
+							order = append(order, ident.Name)
+							isNew = true
+						}
+					}
+					// The REPL allows redefining variables but Go doesn't.
+					if !isNew {
+						edits = append(edits, edit{offset(s.TokPos), offset(s.TokPos) + 2, "="})
+					}
+				}
+			case *ast.DeclStmt:
+				if gen, ok := s.Decl.(*ast.GenDecl); ok {
+					for _, spec := range gen.Specs {
+						if vs, ok := spec.(*ast.ValueSpec); ok {
+							for _, name := range vs.Names {
+								lhs = append(lhs, name)
+								if !defined[name.Name] {
+									defined[name.Name] = true
+									order = append(order, name.Name)
+								}
+							}
+						}
+					}
+				}
+			}
+			for _, e := range lhs {
+				if ident, ok := e.(*ast.Ident); ok {
+					assigns[ident.Name]++
+				}
+			}
+		}
+
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Ident:
+				uses[n.Name]++
+			case *ast.SelectorExpr:
+				if ident, ok := n.X.(*ast.Ident); ok && !defined[ident.Name] {
+					if v, ok := scope.Get(ident.Name); ok {
+						if pkg, ok := v.(Package); ok {
+							imports[ident.Name] = pkg.importPath()
+						}
+					}
+				}
+			}
+			return true
+		})
+
+		// The REPL prints the value of the last expression.
+		if len(stmts) > 0 {
+			if es, ok := stmts[len(stmts)-1].(*ast.ExprStmt); ok && scope.hasValue(es.X) {
+				edits = append(edits,
+					edit{offset(es.Pos()), offset(es.Pos()), "fmt.Println("},
+					edit{offset(es.End()), offset(es.End()), ")"},
+				)
+				imports["fmt"] = "fmt"
+			}
+		}
+
+		text := applyEdits(wrapped, edits)
+		body.WriteString(strings.TrimSpace(text[len(savePrefix) : len(text)-1]))
+		body.WriteString("\n")
+	}
+
+	// Variables that are never read would stop the program compiling.
+	for _, name := range order {
+		if uses[name] <= assigns[name] {
+			fmt.Fprintf(&body, "_ = %s\n", name)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("package main\n\n")
+	if len(imports) > 0 {
+		var names []string
+		for name := range imports {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return imports[names[i]] < imports[names[j]] })
+		b.WriteString("import (\n")
+		for _, name := range names {
+			importPath := imports[name]
+			if path.Base(importPath) != name {
+				fmt.Fprintf(&b, "\t%s %q\n", name, importPath)
+			} else {
+				fmt.Fprintf(&b, "\t%q\n", importPath)
+			}
+		}
+		b.WriteString(")\n\n")
+	}
+	b.WriteString("func main() {\n")
+	b.Write(body.Bytes())
+	b.WriteString("}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "formatting the program")
+	}
+	return src, nil
+}
+
+// hasValue reports whether the expression statement expr produces a value
+// that the REPL would print. Calls to functions without results don't.
+func (scope *Scope) hasValue(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return true
+	}
+	if ident, ok := call.Fun.(*ast.Ident); ok {
+		switch ident.Name {
+		case "append", "cap", "len", "make", "new":
+			return true
+		case "close", "delete", "panic", "print", "println":
+			return false
+		}
+	}
+	if !isSafeExpr(call.Fun) {
+		return false
+	}
+	fun, err := scope.staticValue(call.Fun)
+	if err != nil {
+		return false
+	}
+	switch f := valueInterface(fun).(type) {
+	case *Func:
+		return f.Def.Type.Results != nil && len(f.Def.Type.Results.List) > 0
+	case reflect.Type:
+		return true
+	}
+	return fun.IsValid() && fun.Kind() == reflect.Func && fun.Type().NumOut() > 0
+}
+
+// applyEdits applies edits to text.
+func applyEdits(text string, edits []edit) string {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		b.WriteString(text[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package pry
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newSaveTestSession(scope *Scope, inputs ...string) *session {
+	sess := &session{}
+	for i, input := range inputs {
+		if _, _, isCommand := lookupCommand(input); isCommand {
+			sess.add(i, input, true, nil)
+			continue
+		}
+		_, err := scope.InterpretString(input)
+		sess.add(i, input, false, err)
+	}
+	return sess
+}
+
+func TestSaveSession(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Path: "strings", Functions: map[string]interface{}{
+		"ToUpper": strings.ToUpper,
+	}})
+	sess := newSaveTestSession(scope,
+		`a := 1`,
+		`:vars`,
+		`missing + 1`,
+		`a := 2`,
+		`s := strings.ToUpper("go")`,
+		`double := func(n int) int { return n * 2 }`,
+		`double(a)`,
+		`unused := 3`,
+	)
+
+	src, err := scope.sessionProgram(sess.succeeded(0, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	a := 1
+	a = 2
+	s := strings.ToUpper("go")
+	double := func(n int) int { return n * 2 }
+	fmt.Println(double(a))
+	unused := 3
+	_ = s
+	_ = unused
+}
+`
+	if string(src) != want {
+		t.Errorf("Expected %s got %s", want, src)
+	}
+
+	// The program must compile.
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "out.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	if _, err := conf.Check("main", fset, []*ast.File{f}, nil); err != nil {
+		t.Errorf("the saved program doesn't compile: %v\n%s", err, src)
+	}
+
+	src, err = scope.sessionProgram(sess.succeeded(4, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "s := strings.ToUpper(\"go\")\n\t_ = s\n") {
+		t.Errorf("the range wasn't respected: %s", src)
+	}
+}
+
+func TestSaveCommand(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "go-pry-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "out.go")
+
+	scope := NewScope()
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(), session: newSaveTestSession(scope, "x := 1", "x")}
+	if _, err := runCommand(env, ":save 1-1 "+file); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Saved 1 input to " + file + "\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "fmt.Println(x)") {
+		t.Errorf("Expected the expression to be printed: %s", src)
+	}
+
+	out.Reset()
+	if _, err := runCommand(env, ":save --html "+file); err != nil {
+		t.Fatal(err)
+	}
+	if src, err = ioutil.ReadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	want := `Println<span class="pry-operator">(</span><span class="pry-ident">x</span>`
+	if !strings.HasPrefix(string(src), "<!DOCTYPE html>") || !strings.Contains(string(src), want) {
+		t.Errorf("Expected a page with %s got %s", want, src)
+	}
+
+	for _, args := range []string{"", "--html", "3-1 " + file, "a-b " + file, "50 " + file} {
+		if _, err := runCommand(env, ":save "+args); err == nil {
+			t.Errorf(":save %s: expected an error", args)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in       string
+		from, to int
+	}{
+		{"3-17", 3, 17},
+		{"5", 5, 5},
+	}
+	for _, c := range cases {
+		from, to, err := parseRange(c.in)
+		if err != nil || from != c.from || to != c.to {
+			t.Errorf("parseRange(%q) = %d, %d, %v; expected %d, %d", c.in, from, to, err, c.from, c.to)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package pry
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":set",
+		Category: categorySession,
+		Usage:    ":set [setting [value]]",
+		Summary:  "Show or change how results are shown, lines edited and the history kept.",
+		Help: "Without arguments every setting is listed with its value, and " +
+			"with a setting only that one. maxstring is the number of bytes " +
+			"of strings shown, maxelems the number of elements of slices, " +
+			"arrays and maps and maxdepth how deeply nested the values " +
+			"shown in full are. The limits apply to the values inside results " +
+			"too, and long results are cut before they're paged. 0 removes a " +
+			"limit. humanize on shows integers as byte sizes too, like " +
+			"1048576 (1.0 MB). bytesformat hex shows binary data in hex, " +
+			"inline if it's short and as a dump with offsets and the " +
+			"printable characters otherwise, dump always shows a dump and go " +
+			"shows the bytes like other slices, or as a string if they're " +
+			"valid UTF-8. editmode vi edits lines " +
+			"with vi's keys, starting in insert mode, rather than emacs's. " +
+			"histdedup consecutive keeps inputs repeating the one before them " +
+			"out of the history, and all keeps only the latest copy of each " +
+			"input. histignore keeps the inputs a regexp matches out of it, " +
+			"such as (?i)password, and histignorespace those starting with a " +
+			"space. histsize is the number of entries kept. linenumbers on " +
+			"numbers the following lines of multi-line input, to find the " +
+			"lines of parse errors. Settings last " +
+			"until the session ends; put them in the rc file to keep them.",
+		Run: runSet,
+	})
+}
+
+// setting is a setting changed by :set.
+type setting struct {
+	name    string
+	summary string
+	// get returns the value of the setting in c and set changes it.
+	get func(c *Config) string
+	set func(c *Config, value string) error
+}
+
+// settings are the settings of :set, in the order they're listed.
+var settings = []setting{
+	{
+		name:    "bytesformat",
+		summary: "how byte slices are shown: hex, dump or go",
+		get:     func(c *Config) string { return c.InspectBytes.String() },
+		set: func(c *Config, value string) error {
+			for f := BytesHex; f <= BytesGo; f++ {
+				if f.String() == strings.ToLower(value) {
+					c.InspectBytes = f
+					return nil
+				}
+			}
+			return errors.Errorf("bytesformat must be hex, dump or go, not %q", value)
+		},
+	},
+	{
+		name:    "editmode",
+		summary: "the key bindings of the line editor: emacs or vi",
+		get:     func(c *Config) string { return c.EditMode.String() },
+		set: func(c *Config, value string) error {
+			for m := EditEmacs; m <= EditVi; m++ {
+				if m.String() == strings.ToLower(value) {
+					c.EditMode = m
+					return nil
+				}
+			}
+			return errors.Errorf("editmode must be emacs or vi, not %q", value)
+		},
+	},
+	{
+		name:    "histdedup",
+		summary: "repeated inputs dropped from the history: off, consecutive or all",
+		get:     func(c *Config) string { return c.HistoryDedup.String() },
+		set: func(c *Config, value string) error {
+			for d := HistoryKeepDuplicates; d <= HistoryDedupAll; d++ {
+				if d.String() == strings.ToLower(value) {
+					c.HistoryDedup = d
+					return nil
+				}
+			}
+			return errors.Errorf("histdedup must be off, consecutive or all, not %q", value)
+		},
+	},
+	{
+		name:    "histignore",
+		summary: "a regexp of inputs kept out of the history, or off",
+		get: func(c *Config) string {
+			if c.HistoryIgnore == nil {
+				return "off"
+			}
+			return c.HistoryIgnore.String()
+		},
+		set: func(c *Config, value string) error {
+			if value == "off" {
+				c.HistoryIgnore = nil
+				return nil
+			}
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return errors.Wrapf(err, "invalid histignore %q", value)
+			}
+			c.HistoryIgnore = re
+			return nil
+		},
+	},
+	flagSetting("histignorespace", "keep inputs starting with a space out of the history", func(c *Config) *bool { return &c.HistoryIgnoreSpace }),
+	limitSetting("histsize", "history entries kept, the oldest dropped first", func(c *Config) *int { return &c.HistorySize }),
+	flagSetting("humanize", "show integers as byte sizes too", func(c *Config) *bool { return &c.InspectHumanize }),
+	flagSetting("linenumbers", "number the following lines of multi-line input", func(c *Config) *bool { return &c.LineNumbers }),
+	limitSetting("maxdepth", "how deeply nested the values shown in full are", func(c *Config) *int { return &c.InspectDepth }),
+	limitSetting("maxelems", "elements of slices, arrays and maps shown", func(c *Config) *int { return &c.InspectMaxElems }),
+	limitSetting("maxstring", "bytes of strings shown", func(c *Config) *int { return &c.InspectMaxString }),
+}
+
+// flagSetting returns a setting switching the field flag returns on or off.
+func flagSetting(name, summary string, flag func(c *Config) *bool) setting {
+	return setting{
+		name:    name,
+		summary: summary,
+		get: func(c *Config) string {
+			if *flag(c) {
+				return "on"
+			}
+			return "off"
+		},
+		set: func(c *Config, value string) error {
+			switch strings.ToLower(value) {
+			case "on", "true":
+				*flag(c) = true
+			case "off", "false":
+				*flag(c) = false
+			default:
+				return errors.Errorf("%s must be on or off, not %q", name, value)
+			}
+			return nil
+		},
+	}
+}
+
+// limitSetting returns a setting changing the limit limit returns, for
+// which 0 is no limit.
+func limitSetting(name, summary string, limit func(c *Config) *int) setting {
+	return setting{
+		name:    name,
+		summary: summary,
+		get: func(c *Config) string {
+			if n := *limit(c); n > 0 {
+				return strconv.Itoa(n)
+			}
+			return "0 (unlimited)"
+		},
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return errors.Errorf("%s must be a number of 0 or more, not %q", name, value)
+			}
+			*limit(c) = n
+			return nil
+		},
+	}
+}
+
+func runSet(env *commandEnv, args []string) error {
+	if len(args) > 2 {
+		return errors.New("usage: :set [setting [value]]")
+	}
+	if len(args) == 0 {
+		table := tabwriter.NewWriter(env.out, 0, 4, 2, ' ', 0)
+		for _, s := range settings {
+			fmt.Fprintf(table, "  %s\t%s\t%s\n", s.name, s.get(env.config), s.summary)
+		}
+		return table.Flush()
+	}
+
+	var found *setting
+	var names []string
+	for i, s := range settings {
+		names = append(names, s.name)
+		if s.name == strings.ToLower(args[0]) {
+			found = &settings[i]
+		}
+	}
+	if found == nil {
+		return errors.Errorf("unknown setting %q%s", args[0], didYouMean(args[0], names))
+	}
+	if len(args) == 2 {
+		if err := found.set(env.config, args[1]); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(env.out, "%s = %s\n", found.name, found.get(env.config))
+	return nil
+}
@@ -0,0 +1,107 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("s", strings.Repeat("a", 20))
+	scope.Set("xs", []int{1, 2, 3, 4})
+	scope.Set("size", 2048)
+	scope.Set("raw", []byte{0xff, 0})
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(WithNoColor())}
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{":set", `  bytesformat      hex    how byte slices are shown: hex, dump or go
+  editmode         emacs  the key bindings of the line editor: emacs or vi
+  histdedup        off    repeated inputs dropped from the history: off, consecutive or all
+  histignore       off    a regexp of inputs kept out of the history, or off
+  histignorespace  off    keep inputs starting with a space out of the history
+  histsize         1000   history entries kept, the oldest dropped first
+  humanize         off    show integers as byte sizes too
+  linenumbers      off    number the following lines of multi-line input
+  maxdepth         3      how deeply nested the values shown in full are
+  maxelems         100    elements of slices, arrays and maps shown
+  maxstring        1024   bytes of strings shown
+`},
+		{":set maxstring 5", "maxstring = 5\n"},
+		{":set MaxElems 2", "maxelems = 2\n"},
+		{":set maxdepth", "maxdepth = 3\n"},
+		{":set maxdepth 0", "maxdepth = 0 (unlimited)\n"},
+		{":set humanize on", "humanize = on\n"},
+		{":set bytesformat GO", "bytesformat = go\n"},
+		{":set editmode vi", "editmode = vi\n"},
+		{":set histdedup all", "histdedup = all\n"},
+		{":set histignore (?i)password", "histignore = (?i)password\n"},
+		{":set histignore off", "histignore = off\n"},
+	}
+	for _, c := range cases {
+		out.Reset()
+		if _, err := runCommand(env, c.input); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.want {
+			t.Errorf("%s: Expected %#v got %#v.", c.input, c.want, out.String())
+		}
+	}
+
+	// The settings last for the session.
+	for expr, want := range map[string]string{
+		"s":    `"aaaaa"… (+15 bytes)`,
+		"xs":   "[]int{1, 2, ... 2 more}",
+		"size": "2048 (2.0 KB)",
+		"raw":  "[]uint8{255, 0}",
+	} {
+		got, err := env.scope.InterpretString(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := formatResult(got, env.config); s != want {
+			t.Errorf("%s: Expected %#v got %#v.", expr, want, s)
+		}
+	}
+
+	for _, input := range []string{":set maxwidth 2", ":set maxstring -1", ":set maxstring x", ":set humanize 1", ":set bytesformat octal", ":set editmode ed", ":set histdedup twice", ":set histignore (", ":set a b c"} {
+		if _, err := runCommand(env, input); err == nil {
+			t.Errorf("%s: Expected an error", input)
+		}
+	}
+	if _, err := runCommand(env, ":set maxstrings 2"); err == nil || !strings.Contains(err.Error(), "did you mean maxstring?") {
+		t.Errorf("Expected a suggestion got %v.", err)
+	}
+}
+
+func TestSetHistoryRules(t *testing.T) {
+	t.Parallel()
+
+	editor := &scriptedEditor{script: []scriptedLine{
+		{line: "1"},
+		{line: "1"},
+		{line: ":set histdedup consecutive"},
+		{line: "1"},
+		{line: "2"},
+		{line: "2"},
+		{line: ":set histignorespace on"},
+		{line: " 3"},
+		{line: "3"},
+	}}
+	repl := &REPL{Out: &bytes.Buffer{}, Options: []Option{WithHistoryFile(""), WithLineEditor(editor)}}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The rules apply from when they're set, to the editor's history too.
+	want := []string{"1", "1", ":set histdedup consecutive", "1", "2", ":set histignorespace on", "3"}
+	if !reflect.DeepEqual(editor.history, want) {
+		t.Errorf("Expected the history %q got %q.", want, editor.history)
+	}
+}
@@ -0,0 +1,168 @@
+package pry
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":source",
+		Category: categoryScope,
+		Usage:    ":source <func>",
+		Summary:  "Show the source of a function with line numbers.",
+		Help: "Works for functions defined in the session as well as native " +
+			"functions and methods, e.g. \":source json.Marshal\" or " +
+			"\":source buf.WriteString\". Native source is read from the file " +
+			"the function was compiled from, so it needs to be on disk.",
+		Run: runSource,
+	})
+}
+
+func runSource(env *commandEnv, args []string) error {
+	if len(env.argText) == 0 {
+		return errors.New("usage: :source <func>")
+	}
+	expr, err := parser.ParseExpr(env.argText)
+	if err != nil {
+		return newParseError(err, 0)
+	}
+	fn, err := env.scope.sourceFunc(expr)
+	if err != nil {
+		return err
+	}
+	name := types.ExprString(expr)
+
+	var file string
+	var firstLine int
+	var text string
+	if f, ok := valueInterface(fn).(*Func); ok {
+		file, firstLine, text = f.source()
+	} else {
+		file, firstLine, text, err = nativeSource(fn)
+		if err != nil {
+			return errors.Wrapf(err, "source not available for %s", name)
+		}
+	}
+	lines := strings.Split(strings.Replace(text, "\t", "  ", -1), "\n")
+	env.show(fmt.Sprintf("From %s @ line %d:\n\n%s", file, firstLine, numberedLines(env.config.Theme, lines, firstLine, -1)))
+	return nil
+}
+
+// sourceFunc resolves expr to a function. Methods are resolved to the method
+// of the type rather than a method value so their source can be found.
+func (scope *Scope) sourceFunc(expr ast.Expr) (reflect.Value, error) {
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		x, err := scope.staticValue(sel.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		typ, isType := valueInterface(x).(reflect.Type)
+		if !isType && x.IsValid() {
+			if _, ok := valueInterface(x).(Package); !ok {
+				typ = x.Type()
+			}
+		}
+		if typ != nil {
+			if m, ok := typ.MethodByName(sel.Sel.Name); ok {
+				return m.Func, nil
+			}
+			if typ.Kind() != reflect.Ptr {
+				if m, ok := reflect.PtrTo(typ).MethodByName(sel.Sel.Name); ok {
+					return m.Func, nil
+				}
+			}
+		}
+	}
+	v, err := scope.staticValue(expr)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	for v.IsValid() && v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if _, ok := valueInterface(v).(*Func); ok {
+		return v, nil
+	}
+	if !v.IsValid() || v.Kind() != reflect.Func || v.IsNil() {
+		return reflect.Value{}, errors.Errorf("%s isn't a function", types.ExprString(expr))
+	}
+	return v, nil
+}
+
+// source returns the text of the function as it was typed, or formatted with
+// go/printer if that isn't known, and the file and line it starts on.
+func (f *Func) source() (file string, line int, text string) {
+	pos := f.src.position(f.Def.Pos())
+	if f.src != nil {
+		start, end := f.src.offset(f.Def.Pos()), f.src.offset(f.Def.End())
+		if start < end {
+			return pos.Filename, pos.Line, f.src.text[start:end]
+		}
+	}
+	var b strings.Builder
+	printer.Fprint(&b, token.NewFileSet(), f.Def)
+	return pos.Filename, pos.Line, b.String()
+}
+
+// nativeSource finds the source of the compiled function fn from the file
+// and line recorded in the binary.
+func nativeSource(fn reflect.Value) (file string, line int, text string, err error) {
+	rf := runtime.FuncForPC(fn.Pointer())
+	if rf == nil {
+		return "", 0, "", errors.New("no symbol information")
+	}
+	file, line = rf.FileLine(rf.Entry())
+	src, err := readFile(file)
+	if err != nil {
+		return "", 0, "", err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, parser.ParseComments)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	// Find the innermost function containing the entry line, which handles
+	// closures as well as declarations.
+	var found ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.FuncDecl, *ast.FuncLit:
+			if fset.Position(n.Pos()).Line <= line && line <= fset.Position(n.End()).Line {
+				found = n
+			}
+		}
+		return true
+	})
+	if found == nil {
+		return "", 0, "", errors.Errorf("no function at %s:%d", file, line)
+	}
+	start, end := fset.Position(found.Pos()), fset.Position(found.End())
+	return file, start.Line, string(src[start.Offset:end.Offset]), nil
+}
+
+// numberedLines renders lines with line numbers starting at first. The line
+// numbered current is marked with an arrow.
+func numberedLines(theme Theme, lines []string, first, current int) string {
+	var b strings.Builder
+	width := len(fmt.Sprint(first + len(lines) - 1))
+	for i, line := range lines {
+		caret := "  "
+		if first+i == current {
+			caret = "=>"
+		}
+		num := theme.paint(fmt.Sprintf("%*d", width, first+i), theme.LineNumber)
+		fmt.Fprintf(&b, " %s %s: %s\n", caret, num, theme.Highlight(line, nil))
+	}
+	return b.String()
+}
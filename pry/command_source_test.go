@@ -0,0 +1,68 @@
+package pry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func sourceTestFunc(n int) int {
+	return n * 2
+}
+
+func TestSourceCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("pry", Package{Name: "pry", Functions: map[string]interface{}{
+		"sourceTestFunc": sourceTestFunc,
+	}})
+	scope.Set("b", &bytes.Buffer{})
+	if _, err := scope.InterpretString("double := func(n int) int {\n\treturn n * 2\n}"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expr string
+		want []string
+	}{
+		{"double", []string{"From <repl> @ line 1:", "   1: func(n int) int {", "   2:   return n * 2", "   3: }"}},
+		{"pry.sourceTestFunc", []string{"command_source_test.go @ line 9:", "   9: func sourceTestFunc(n int) int {", "  11: }"}},
+		{"b.Len", []string{"bytes/buffer.go", "func (b *Buffer) Len() int"}},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: scope, out: &out, config: newConfig(WithTheme(NoColorTheme))}
+		if _, err := runCommand(env, ":source "+c.expr); err != nil {
+			t.Errorf(":source %s: %v", c.expr, err)
+			continue
+		}
+		for _, want := range c.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf(":source %s: expected %q in %q", c.expr, want, out.String())
+			}
+		}
+	}
+}
+
+func TestSourceCommandErrors(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("n", 1)
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"n", "n isn't a function"},
+		{"missing", "undefined: missing"},
+	}
+	for _, c := range cases {
+		env := &commandEnv{scope: scope, out: &bytes.Buffer{}, config: newConfig()}
+		_, err := runCommand(env, ":source "+c.expr)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf(":source %s: expected error containing %q got %v", c.expr, c.want, err)
+		}
+	}
+}
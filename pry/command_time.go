@@ -0,0 +1,147 @@
+package pry
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":time",
+		Category: categoryScope,
+		Usage:    ":time [-n runs] <expr>",
+		Summary:  "Time an expression and report the memory it allocated.",
+		Help: "The expression is evaluated by the interpreter like any other " +
+			"input, so assignments and other effects on the scope happen on " +
+			"every run. With -n it's run repeatedly and the minimum, average " +
+			"and maximum times are reported. The result of the last run is " +
+			"printed and bound to _. Times include the overhead of the " +
+			"interpreter and allocations are counted for the whole process.",
+		Run: runTime,
+	})
+}
+
+func runTime(env *commandEnv, args []string) error {
+	runs, expr, err := parseTimeArgs(env.argText)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := notifyInterrupt(cancel)
+	defer stop()
+
+	var before, after runtime.MemStats
+	var timings []time.Duration
+	var result interface{}
+	runtime.ReadMemStats(&before)
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		result, err = env.scope.InterpretStringContext(ctx, expr)
+		timings = append(timings, time.Since(start))
+		if err != nil {
+			if runs > 1 {
+				return errors.Wrapf(err, "run %d", i+1)
+			}
+			return err
+		}
+	}
+	runtime.ReadMemStats(&after)
+
+	if result != nil {
+		env.scope.Set(resultVar, result)
+	}
+	fmt.Fprintf(env.out, "=> %s\n", env.config.Theme.Highlight(env.config.inspect(result), nil))
+	fmt.Fprint(env.out, formatTimings(timings, after.TotalAlloc-before.TotalAlloc, after.Mallocs-before.Mallocs))
+	return nil
+}
+
+// parseTimeArgs splits the arguments of :time into the number of runs and
+// the expression.
+func parseTimeArgs(argText string) (runs int, expr string, err error) {
+	runs = 1
+	expr = argText
+	if fields := strings.Fields(argText); len(fields) > 0 && fields[0] == "-n" {
+		if len(fields) < 2 {
+			return 0, "", errors.New("-n requires the number of runs")
+		}
+		if runs, err = strconv.Atoi(fields[1]); err != nil || runs < 1 {
+			return 0, "", errors.Errorf("invalid number of runs %q", fields[1])
+		}
+		expr = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(argText, "-n")), fields[1]))
+	}
+	if len(expr) == 0 {
+		return 0, "", errors.New("usage: :time [-n runs] <expr>")
+	}
+	return runs, expr, nil
+}
+
+// formatTimings reports the timings of the runs and the memory allocated by
+// all of them.
+func formatTimings(timings []time.Duration, bytes, allocs uint64) string {
+	runs := uint64(len(timings))
+	if runs == 1 {
+		return fmt.Sprintf("Time: %s  Allocated: %s (%s)\n",
+			humanDuration(timings[0]), humanBytes(bytes), plural(allocs, "allocation"))
+	}
+
+	min, max, total := timings[0], timings[0], time.Duration(0)
+	for _, d := range timings {
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		total += d
+	}
+	return fmt.Sprintf("Runs: %d  Min: %s  Avg: %s  Max: %s\nAllocated: %s/run (%s/run)\n",
+		runs, humanDuration(min), humanDuration(total/time.Duration(runs)), humanDuration(max),
+		humanBytes(bytes/runs), plural(allocs/runs, "allocation"))
+}
+
+// humanDuration formats d in the largest unit that keeps it above one, e.g.
+// 1.5ms.
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Microsecond:
+		return fmt.Sprintf("%dns", d.Nanoseconds())
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.1fµs", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+// humanBytes formats n bytes in the largest binary unit that keeps it above
+// one, e.g. 1.5 KB.
+func humanBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, suffix := float64(n)/unit, "KB"
+	for _, next := range []string{"MB", "GB", "TB"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
+
+// plural formats a count of things, e.g. "1 allocation" or "2 allocations".
+func plural(n uint64, thing string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, thing)
+	}
+	return fmt.Sprintf("%d %ss", n, thing)
+}
@@ -0,0 +1,92 @@
+package pry
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTimeCommand(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("n", 0)
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(WithTheme(NoColorTheme))}
+	if _, err := runCommand(env, ":time -n 3 func() int { n++; return n }()"); err != nil {
+		t.Fatal(err)
+	}
+	want := regexp.MustCompile(`^=> 3\nRuns: 3  Min: \S+  Avg: \S+  Max: \S+\nAllocated: \d+(\.\d)? [KMGT]?B/run \(\d+ allocations?/run\)\n$`)
+	if !want.MatchString(out.String()) {
+		t.Errorf("Expected output matching %s got %q", want, out.String())
+	}
+	if n, _ := scope.Get("n"); n != 3 {
+		t.Errorf("Expected %#v got %#v.", 3, n)
+	}
+	if result, _ := scope.Get(resultVar); result != 3 {
+		t.Errorf("Expected %#v got %#v.", 3, result)
+	}
+
+	out.Reset()
+	if _, err := runCommand(env, ":time n * 2"); err != nil {
+		t.Fatal(err)
+	}
+	want = regexp.MustCompile(`^=> 6\nTime: \S+  Allocated: \d+(\.\d)? [KMGT]?B \(\d+ allocations?\)\n$`)
+	if !want.MatchString(out.String()) {
+		t.Errorf("Expected output matching %s got %q", want, out.String())
+	}
+}
+
+func TestParseTimeArgs(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		runs int
+		expr string
+		err  bool
+	}{
+		{"a + b", 1, "a + b", false},
+		{"-n 1000 f(x)", 1000, "f(x)", false},
+		{"-n1 x", 1, "-n1 x", false},
+		{"-n", 0, "", true},
+		{"-n 0 x", 0, "", true},
+		{"-n 5", 0, "", true},
+		{"", 0, "", true},
+	}
+	for _, c := range cases {
+		runs, expr, err := parseTimeArgs(c.in)
+		if (err != nil) != c.err || runs != c.runs || expr != c.expr {
+			t.Errorf("parseTimeArgs(%q) = %d, %q, %v; expected %d, %q", c.in, runs, expr, err, c.runs, c.expr)
+		}
+	}
+}
+
+func TestHumanUnits(t *testing.T) {
+	t.Parallel()
+
+	durations := map[time.Duration]string{
+		500 * time.Nanosecond:   "500ns",
+		1500 * time.Nanosecond:  "1.5µs",
+		2500 * time.Microsecond: "2.5ms",
+		3 * time.Second:         "3.00s",
+	}
+	for d, want := range durations {
+		if got := humanDuration(d); got != want {
+			t.Errorf("humanDuration(%s) = %q; expected %q", d, got, want)
+		}
+	}
+	sizes := map[uint64]string{
+		12:         "12 B",
+		1536:       "1.5 KB",
+		3 << 20:    "3.0 MB",
+		5 << 30:    "5.0 GB",
+		2048 << 30: "2.0 TB",
+	}
+	for n, want := range sizes {
+		if got := humanBytes(n); got != want {
+			t.Errorf("humanBytes(%d) = %q; expected %q", n, got, want)
+		}
+	}
+}
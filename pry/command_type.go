@@ -0,0 +1,213 @@
+package pry
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":type",
+		Category: categoryScope,
+		Usage:    ":type <expr>",
+		Summary:  "Show the type of an expression.",
+		Help: "Identifiers, selectors, indexes and the results of native calls " +
+			"are typed without evaluating anything else, so calls don't run. " +
+			"Other expressions are evaluated. Interfaces show both the " +
+			"interface and the dynamic type of the value.",
+		Run: runType,
+	})
+}
+
+func runType(env *commandEnv, args []string) error {
+	if len(env.argText) == 0 {
+		return errors.New("usage: :type <expr>")
+	}
+	expr, err := parser.ParseExpr(env.argText)
+	if err != nil {
+		return newParseError(err, 0)
+	}
+	desc, err := env.scope.describeType(expr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(env.out, desc)
+	return nil
+}
+
+// describeType describes the type of expr.
+func (scope *Scope) describeType(expr ast.Expr) (string, error) {
+	if call, ok := expr.(*ast.CallExpr); ok && isSafeExpr(call.Fun) {
+		fun, err := scope.staticValue(call.Fun)
+		if err != nil {
+			return "", err
+		}
+		if fun.IsValid() && fun.Kind() == reflect.Func {
+			return describeResults(fun.Type()), nil
+		}
+		if typ, ok := valueInterface(fun).(reflect.Type); ok {
+			return describeReflectType(typ, reflect.Value{}), nil
+		}
+	}
+
+	v, err := scope.staticValue(expr)
+	if err != nil {
+		return "", err
+	}
+	if !v.IsValid() {
+		return "Type: nil\n", nil
+	}
+	if fn, ok := valueInterface(v).(*Func); ok {
+		return fmt.Sprintf("Type: %s\nKind: func (interpreted)\n", types.ExprString(fn.Def.Type)), nil
+	}
+	if typ, ok := valueInterface(v).(reflect.Type); ok {
+		return fmt.Sprintf("Type: %s (type)\nKind: %s\n", typ, typ.Kind()), nil
+	}
+	return describeReflectType(v.Type(), v), nil
+}
+
+// staticValue returns the value of expr keeping the static type of
+// variables, fields and elements, so interface values aren't reduced to
+// their dynamic type. Only identifiers, selectors and indexes are resolved
+// statically; other expressions are evaluated.
+func (scope *Scope) staticValue(expr ast.Expr) (reflect.Value, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if ptr, ok := scope.GetPointer(e.Name); ok && ptr != nil {
+			if rv := reflect.ValueOf(ptr); rv.Kind() == reflect.Ptr {
+				return rv.Elem(), nil
+			}
+			return reflect.ValueOf(ptr), nil
+		}
+	case *ast.ParenExpr:
+		return scope.staticValue(e.X)
+	case *ast.SelectorExpr:
+		x, err := scope.staticValue(e.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if pkg, ok := valueInterface(x).(Package); ok {
+			if member, ok := pkg.member(e.Sel.Name); ok {
+				return member, nil
+			}
+			break
+		}
+		for x.IsValid() && x.Kind() == reflect.Interface && !x.IsNil() {
+			x = x.Elem()
+		}
+		if x.IsValid() {
+			if method := x.MethodByName(e.Sel.Name); method.IsValid() {
+				return method, nil
+			}
+			if x.Kind() == reflect.Ptr && !x.IsNil() {
+				x = x.Elem()
+			}
+			if x.Kind() == reflect.Struct {
+				if f, ok := x.Type().FieldByName(e.Sel.Name); ok && f.PkgPath == "" {
+					return x.FieldByIndex(f.Index), nil
+				}
+			}
+		}
+	case *ast.IndexExpr:
+		x, err := scope.staticValue(e.X)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		for x.IsValid() && x.Kind() == reflect.Interface && !x.IsNil() {
+			x = x.Elem()
+		}
+		if x.IsValid() {
+			switch x.Kind() {
+			case reflect.Map:
+				key, err := scope.Interpret(e.Index)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				keyV := reflect.ValueOf(key)
+				if keyV.IsValid() && keyV.Type().AssignableTo(x.Type().Key()) {
+					if v := x.MapIndex(keyV); v.IsValid() {
+						return v, nil
+					}
+					return reflect.Zero(x.Type().Elem()), nil
+				}
+			case reflect.Slice, reflect.Array:
+				i, err := scope.Interpret(e.Index)
+				if err != nil {
+					return reflect.Value{}, err
+				}
+				if idx, ok := i.(int); ok && idx >= 0 && idx < x.Len() {
+					return x.Index(idx), nil
+				}
+				return reflect.Zero(x.Type().Elem()), nil
+			}
+		}
+	}
+	// Fall back to evaluating the expression, which also produces the usual
+	// errors for undefined names.
+	v, err := scope.Interpret(expr)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(v), nil
+}
+
+// valueInterface returns the value in v or nil if v isn't valid.
+func valueInterface(v reflect.Value) interface{} {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// describeResults describes the result types of calling a function of type
+// typ.
+func describeResults(typ reflect.Type) string {
+	var results []string
+	for i := 0; i < typ.NumOut(); i++ {
+		results = append(results, typ.Out(i).String())
+	}
+	var b strings.Builder
+	switch len(results) {
+	case 0:
+		b.WriteString("Type: none (the call has no results)\n")
+	case 1:
+		b.WriteString(describeReflectType(typ.Out(0), reflect.Value{}))
+	default:
+		fmt.Fprintf(&b, "Type: (%s)\n", strings.Join(results, ", "))
+	}
+	fmt.Fprintf(&b, "Func: %s\n", typ)
+	return b.String()
+}
+
+// describeReflectType describes typ. If v is valid and typ is an interface
+// the dynamic type of v is included.
+func describeReflectType(typ reflect.Type, v reflect.Value) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Type: %s\n", typ)
+	fmt.Fprintf(&b, "Kind: %s\n", typ.Kind())
+	switch typ.Kind() {
+	case reflect.Interface:
+		if v.IsValid() {
+			if v.IsNil() {
+				b.WriteString("Dynamic type: nil\n")
+			} else {
+				fmt.Fprintf(&b, "Dynamic type: %s\n", v.Elem().Type())
+			}
+		}
+	case reflect.Map:
+		fmt.Fprintf(&b, "Key: %s\n", typ.Key())
+		fmt.Fprintf(&b, "Elem: %s\n", typ.Elem())
+	case reflect.Chan:
+		fmt.Fprintf(&b, "Dir: %s\n", typ.ChanDir())
+		fmt.Fprintf(&b, "Elem: %s\n", typ.Elem())
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		fmt.Fprintf(&b, "Elem: %s\n", typ.Elem())
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package pry
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type typeTestStruct struct {
+	Err    error
+	Reader io.Reader
+	Items  map[string][]int
+}
+
+func TestTypeCommand(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	scope := NewScope()
+	scope.Set("s", typeTestStruct{
+		Err:   errors.New("boom"),
+		Items: map[string][]int{"a": {1}},
+	})
+	scope.Set("ch", make(chan<- int))
+	scope.Set("count", func(s string) (int, error) {
+		calls++
+		return len(s), nil
+	})
+	scope.Set("strings", Package{Name: "strings", Functions: map[string]interface{}{"Index": strings.Index}})
+	scope.Set("time", Package{Name: "time", Types: TypeMap{"Duration": reflect.TypeOf(time.Duration(0))}})
+	if _, err := scope.InterpretString(`double := func(n int) int { return n * 2 }`); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"s", "Type: pry.typeTestStruct\nKind: struct\n"},
+		{"s.Err", "Type: error\nKind: interface\nDynamic type: *errors.errorString\n"},
+		{"s.Reader", "Type: io.Reader\nKind: interface\nDynamic type: nil\n"},
+		{"s.Items", "Type: map[string][]int\nKind: map\nKey: string\nElem: []int\n"},
+		{`s.Items["a"]`, "Type: []int\nKind: slice\nElem: int\n"},
+		{`s.Items["missing"][0]`, "Type: int\nKind: int\n"},
+		{"ch", "Type: chan<- int\nKind: chan\nDir: chan<-\nElem: int\n"},
+		{"count", "Type: func(string) (int, error)\nKind: func\n"},
+		{`count("abc")`, "Type: (int, error)\nFunc: func(string) (int, error)\n"},
+		{`strings.Index("a", "b")`, "Type: int\nKind: int\nFunc: func(string, string) int\n"},
+		{"double", "Type: func(n int) int\nKind: func (interpreted)\n"},
+		{"1 + 2", "Type: int\nKind: int\n"},
+		{"nil", "Type: nil\n"},
+		// Conversions and arithmetic keep named types.
+		{"time.Duration(3e9)", "Type: time.Duration\nKind: int64\n"},
+		{"time.Duration(3e9) * 2", "Type: time.Duration\nKind: int64\n"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: scope, out: &out, config: newConfig()}
+		if _, err := runCommand(env, ":type "+c.expr); err != nil {
+			t.Errorf(":type %s: %v", c.expr, err)
+			continue
+		}
+		if out.String() != c.want {
+			t.Errorf(":type %s: expected\n%s\ngot\n%s", c.expr, c.want, out.String())
+		}
+	}
+	if calls != 0 {
+		t.Errorf("Expected :type to not call functions; called %d times.", calls)
+	}
+}
+
+func TestTypeCommandUndefined(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("line", "")
+	env := &commandEnv{scope: scope, out: &bytes.Buffer{}, config: newConfig()}
+	_, err := runCommand(env, ":type lne")
+	want := "undefined: lne; did you mean line?"
+	if err == nil || err.Error() != want {
+		t.Errorf("Expected %#v got %#v.", want, err)
+	}
+}
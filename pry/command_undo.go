@@ -0,0 +1,73 @@
+package pry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":undo",
+		Category: categoryScope,
+		Usage:    ":undo [n]",
+		Summary:  "Take back what the last input, or the last n, did to the variables.",
+		Help: "Variables defined by the input are removed and the ones it " +
+			"assigned get their previous values back, including the " +
+			"variables of the program. Values are copied shallowly, so " +
+			"changes made through pointers, slices and maps aren't taken " +
+			"back, and neither is anything native functions did, such as " +
+			"writing to files. Inputs that failed have nothing to take " +
+			"back, commands aren't undone and the history is kept. The " +
+			"number of inputs that can be undone is set with WithUndoLevels.",
+		Run: runUndo,
+	})
+}
+
+func runUndo(env *commandEnv, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: :undo [n]")
+	}
+	n := 1
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return errors.Errorf("the number of inputs to undo must be 1 or more, not %q", args[0])
+		}
+	}
+	if env.config.UndoLevels <= 0 {
+		return errors.New("undo is disabled")
+	}
+	sess := env.session
+	if sess != nil && sess.failed {
+		sess.failed = false
+		fmt.Fprintln(env.out, "The last input failed; there's nothing to undo.")
+		return nil
+	}
+	if sess == nil || len(sess.undo) == 0 {
+		fmt.Fprintln(env.out, "Nothing to undo.")
+		return nil
+	}
+
+	for ; n > 0 && len(sess.undo) > 0; n-- {
+		c := sess.undo[len(sess.undo)-1]
+		sess.undo = sess.undo[:len(sess.undo)-1]
+		c.restore()
+		sess.entries[c.entry].undone = true
+		fmt.Fprintf(env.out, "Undid %s\n", strings.Replace(c.input, "\n", "⏎", -1))
+		if c.nativeCalls > 0 {
+			calls := "calls"
+			if c.nativeCalls == 1 {
+				calls = "call"
+			}
+			warning := fmt.Sprintf("Warning: it made %d native %s, whose effects outside the interpreter can't be undone.", c.nativeCalls, calls)
+			fmt.Fprintln(env.out, env.config.Theme.paint(warning, env.config.Theme.Warning))
+		}
+	}
+	if n > 0 {
+		fmt.Fprintln(env.out, "Nothing more to undo.")
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func runUndoREPL(t *testing.T, scope *Scope, input string, opts ...Option) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader(input),
+		Out:     &out,
+		Scope:   scope,
+		Options: append([]Option{WithHistoryFile("")}, opts...),
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestUndoCommand(t *testing.T) {
+	t.Parallel()
+
+	program := 10
+	scope := NewScope()
+	scope.Vals["program"] = &program
+	out := runUndoREPL(t, scope, strings.Join([]string{
+		"x := 1",
+		"s := []int{1}",
+		"x = 2",
+		"program = 20",
+		"x++; s = append(s, 2)",
+		":undo",
+		":undo 2",
+		"x",
+		"s",
+		"program",
+		// Inputs showing values are undone too, and undoing the
+		// definitions removes the variables.
+		":undo 6",
+		"x",
+	}, "\n")+"\n")
+	expectOutput(t, out,
+		"Undid x++; s = append(s, 2)\n", "Undid program = 20\n", "Undid x = 2\n",
+		"=> 1\n", "=> {1} ([]int)\n", "=> 10\n",
+		"Undid program\n", "Undid s\n", "Undid x\n", "Undid s := []int{1}\n", "Undid x := 1\n",
+		"Nothing more to undo.\n", "undefined: x")
+	if strings.Contains(out, "native") {
+		t.Errorf("Expected no warning about native calls:\n%s", out)
+	}
+	if program != 10 {
+		t.Errorf("Expected the variable of the program to be 10 again, got %d.", program)
+	}
+}
+
+func TestUndoCommandFailedInput(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	out := runUndoREPL(t, scope, "x := 1\nx = 2; y\n:undo\n:undo\nx\n")
+	expectOutput(t, out, "undefined: y", "The last input failed; there's nothing to undo.\n", "Undid x := 1\n", "undefined: x")
+}
+
+func TestUndoCommandNativeCalls(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Functions: map[string]interface{}{"ToUpper": strings.ToUpper}})
+	out := runUndoREPL(t, scope, "s := strings.ToUpper(\"a\")\n:undo\n")
+	expectOutput(t, out, "Undid s := strings.ToUpper(\"a\")\n", "Warning: it made 1 native call")
+
+	out = runUndoREPL(t, NewScope(), "x := 1\n:undo\n", WithUndoLevels(0))
+	expectOutput(t, out, "undo is disabled")
+
+	// Only the last levels inputs are kept.
+	out = runUndoREPL(t, NewScope(), "x := 1\nx = 2\nx = 3\n:undo 3\nx\n", WithUndoLevels(2))
+	expectOutput(t, out, "Undid x = 3\n", "Undid x = 2\n", "Nothing more to undo.\n", "=> 1\n")
+}
@@ -0,0 +1,196 @@
+package pry
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":vars",
+		Category: categoryScope,
+		Usage:    ":vars [-t type] [pattern]",
+		Summary:  "List the variables in scope with their types and values.",
+		Help: "Names are sorted and matched against the glob pattern, e.g. " +
+			"\"re*\". -t only lists variables whose type contains the given " +
+			"text, e.g. \"-t http.Client\". Bindings hidden by an inner scope " +
+			"are marked as shadowed, and copies of values of the program, such " +
+			"as range variables, as read-only since assigning to them doesn't " +
+			"change the program. Packages are listed separately at the end.",
+		Run: runVars,
+	})
+}
+
+// binding is a name bound in a scope.
+type binding struct {
+	name  string
+	value interface{}
+	// typ is the type the variable was declared with, such as error for
+	// var err error, or nil if the name is bound to nil.
+	typ      reflect.Type
+	depth    int
+	shadowed bool
+	// readOnly is set for copies of values of the program, which
+	// assignments don't change.
+	readOnly bool
+}
+
+// bindings returns the bindings visible from scope, innermost first. Outer
+// bindings hidden by inner ones are marked as shadowed.
+func (scope *Scope) bindings() []binding {
+	var out []binding
+	seen := map[string]bool{}
+	for depth, s := 0, scope; s != nil; depth, s = depth+1, s.Parent {
+		s.Lock()
+		var level []binding
+		for name, v := range s.Vals {
+			if name == "_pryScope" {
+				continue
+			}
+			value := derefScopeValue(v)
+			level = append(level, binding{name: name, value: value, typ: declaredType(v, value), depth: depth, shadowed: seen[name], readOnly: s.ReadOnly[name]})
+		}
+		s.Unlock()
+		for _, b := range level {
+			seen[b.name] = true
+		}
+		out = append(out, level...)
+	}
+	return out
+}
+
+func runVars(env *commandEnv, args []string) error {
+	var pattern, typeFilter string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-t" {
+			if i+1 >= len(args) {
+				return errors.New("-t requires a type")
+			}
+			typeFilter = args[i+1]
+			i++
+			continue
+		}
+		pattern = args[i]
+	}
+	if len(pattern) > 0 {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Wrapf(err, "invalid pattern %q", pattern)
+		}
+	}
+	fmt.Fprint(env.out, formatVars(env.scope.bindings(), pattern, typeFilter, env.config, env.config.Theme))
+	return nil
+}
+
+// formatVars renders a table of the bindings matching the pattern and type
+// filter followed by the packages, colored with theme. The values are shown
+// with the Inspect settings of c, on one line.
+func formatVars(bindings []binding, pattern, typeFilter string, c *Config, theme Theme) string {
+	flat := *c
+	flat.InspectWidth = 0
+	sort.SliceStable(bindings, func(i, j int) bool {
+		if bindings[i].name != bindings[j].name {
+			return bindings[i].name < bindings[j].name
+		}
+		return bindings[i].depth < bindings[j].depth
+	})
+
+	var vars, packages strings.Builder
+	varsTable := tabwriter.NewWriter(&vars, 0, 4, 2, ' ', 0)
+	packagesTable := tabwriter.NewWriter(&packages, 0, 4, 2, ' ', 0)
+	for _, b := range bindings {
+		if len(pattern) > 0 {
+			if ok, _ := path.Match(pattern, b.name); !ok {
+				continue
+			}
+		}
+		typ := b.typeString()
+		if len(typeFilter) > 0 && !strings.Contains(typ, typeFilter) {
+			continue
+		}
+		name := b.name
+		if b.shadowed {
+			name += " (shadowed)"
+		}
+		if b.readOnly {
+			name += " (read-only)"
+		}
+		if pkg, ok := b.value.(Package); ok {
+			fmt.Fprintf(packagesTable, "  %s\t%s\n", name, packageSummary(pkg, nil))
+			continue
+		}
+		// Every type is colored alike, so the escapes don't misalign the
+		// columns.
+		value := theme.Highlight(abbreviate(flat.inspectVar(b), c.VarsValueWidth), nil)
+		fmt.Fprintf(varsTable, "  %s\t%s\t%s\n", name, theme.paint(typ, theme.Type), value)
+	}
+	varsTable.Flush()
+	packagesTable.Flush()
+
+	var b strings.Builder
+	if vars.Len() == 0 && packages.Len() == 0 {
+		return "No matching variables.\n"
+	}
+	if vars.Len() > 0 {
+		b.WriteString("Variables:\n")
+		b.WriteString(vars.String())
+	}
+	if packages.Len() > 0 {
+		b.WriteString("Packages:\n")
+		b.WriteString(packages.String())
+	}
+	return b.String()
+}
+
+// typeString describes the type of b: the one its variable was declared
+// with, or the signature of functions defined in the REPL.
+func (b binding) typeString() string {
+	switch v := b.value.(type) {
+	case *Func:
+		return v.signature()
+	case Package:
+		return "package"
+	}
+	if b.typ == nil {
+		return "nil"
+	}
+	return b.typ.String()
+}
+
+// inspectVar renders the value of b like the REPL prints results, with the
+// settings of c. Its type is left out, as :vars shows it, unless the
+// variable is of an interface type.
+func (c *Config) inspectVar(b binding) string {
+	var s strings.Builder
+	// Values past the output limit are cut, which is all :vars needs.
+	writeResult(&s, b.value, c, b.typ != nil && b.typ.Kind() != reflect.Interface, nil)
+	return s.String()
+}
+
+// typeString describes the type of v.
+func typeString(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case *Func:
+		return "func"
+	case Package:
+		return "package"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// abbreviate shortens s to at most width columns, ending it with an ellipsis
+// if it was cut. Newlines are replaced so it fits on one line.
+func abbreviate(s string, width int) string {
+	s = strings.Replace(s, "\n", " ", -1)
+	if width <= 0 || stringWidth(s) <= width {
+		return s
+	}
+	return truncateWidth(s, width-1) + "…"
+}
@@ -0,0 +1,158 @@
+package pry
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVars(t *testing.T) {
+	t.Parallel()
+
+	outer := NewScope()
+	outer.Set("x", 1)
+	outer.Set("name", "outer")
+	outer.Set("strings", Package{Name: "strings", Functions: map[string]interface{}{"ToUpper": strings.ToUpper}})
+	inner := outer.NewChild()
+	shadow := "shadow"
+	inner.Vals["x"] = &shadow
+	inner.Set("long", strings.Repeat("a", 100))
+	inner.Set("buf", bytes.NewBufferString("abc"))
+	if _, err := inner.InterpretString("double := func(n int) int { return n * 2 }"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{nil, `Variables:
+  buf           *bytes.Buffer    abc
+  double        func(n int) int  func(n int) int at <repl>:1:11
+  long          string           "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa…
+  name          string           "outer"
+  x             string           "shadow"
+  x (shadowed)  int              1
+Packages:
+  strings  1 member
+`},
+		{[]string{"x*"}, `Variables:
+  x             string  "shadow"
+  x (shadowed)  int     1
+`},
+		{[]string{"-t", "bytes.Buf"}, `Variables:
+  buf  *bytes.Buffer  abc
+`},
+		{[]string{"zzz"}, "No matching variables.\n"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: inner, out: &out, config: newConfig(WithNoColor())}
+		if err := runVars(env, c.args); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != c.want {
+			t.Errorf(":vars %v: expected\n%s\ngot\n%s", c.args, c.want, out.String())
+		}
+	}
+}
+
+func TestVarsReadOnly(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	item := "a"
+	scope.Vals["item"] = &item
+	scope.ReadOnly = map[string]bool{"item": true}
+	scope.Set("n", 1)
+
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(WithNoColor())}
+	if err := runVars(env, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `Variables:
+  item (read-only)  string  "a"
+  n                 int     1
+`
+	if out.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, out.String())
+	}
+}
+
+func TestVarsDeclaredTypes(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	src := `var err error; var w io.Writer = &bytes.Buffer{}; var any interface{} = 1; var n int64 = 2`
+	scope.Set("bytes", Package{Name: "bytes", Path: "bytes", Types: TypeMap{"Buffer": reflect.TypeOf(bytes.Buffer{})}})
+	scope.Set("io", Package{Name: "io", Path: "io", Types: TypeMap{"Writer": reflect.TypeOf((*io.Writer)(nil)).Elem()}})
+	if _, err := scope.InterpretString(src); err != nil {
+		t.Fatal(err)
+	}
+
+	// Variables of interface types show the dynamic type in their values.
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig(WithNoColor())}
+	if err := runVars(env, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `Variables:
+  any  interface {}  1
+  err  error         nil
+  n    int64         2
+  w    io.Writer     *bytes.Buffer()
+`
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("Expected\n%s\ngot\n%s", want, out.String())
+	}
+	out.Reset()
+	if err := runVars(env, []string{"-t", "error"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Variables:\n  err  error  nil\n"; out.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, out.String())
+	}
+
+	// So do their completions.
+	if c := scope.identCandidate("err"); c.Type != "error" {
+		t.Errorf("Expected the type error got %q.", c.Type)
+	}
+}
+
+func TestVarsBadArgs(t *testing.T) {
+	t.Parallel()
+
+	env := &commandEnv{scope: NewScope(), out: &bytes.Buffer{}, config: newConfig(WithNoColor())}
+	for _, args := range [][]string{{"-t"}, {"[a"}} {
+		if err := runVars(env, args); err == nil {
+			t.Errorf(":vars %v: expected an error", args)
+		}
+	}
+}
+
+func TestAbbreviate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"hello", 10, "hello"},
+		{"hello world", 6, "hello…"},
+		{"héllo wörld", 6, "héllo…"},
+		{"a\nb", 10, "a b"},
+		{"hello", 0, "hello"},
+		{"日本語のテキスト", 7, "日本語…"},
+		{"cafe\u0301 au lait", 5, "cafe\u0301…"},
+		{"👩‍💻 coding", 3, "👩‍💻…"},
+	}
+	for _, c := range cases {
+		if out := abbreviate(c.s, c.width); out != c.want {
+			t.Errorf("abbreviate(%q, %d) = %q; expected %q", c.s, c.width, out, c.want)
+		}
+	}
+}
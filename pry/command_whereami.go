@@ -0,0 +1,137 @@
+package pry
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":whereami",
+		Aliases:  []string{"whereami"},
+		Category: categorySession,
+		Usage:    ":whereami",
+		Summary:  "Show the source around the breakpoint and the callers.",
+		Help: "The same as shown when the session opened. WithContextLines " +
+			"sets how many lines are shown around the breakpoint.",
+		Run: runWhereami,
+	})
+	registerCommand(&command{
+		Name:     ":backtrace",
+		Aliases:  []string{":bt"},
+		Category: categorySession,
+		Usage:    ":backtrace",
+		Summary:  "Show the full stack of the goroutine that reached the breakpoint.",
+		Help: "Frames are listed from the breakpoint to the start of the " +
+			"goroutine, leaving out those of pry itself.",
+		Run: runBacktrace,
+	})
+}
+
+// compactFrames is the number of callers shown when the session opens.
+const compactFrames = 5
+
+// pryFunctionPrefix starts the names of the functions of this package.
+const pryFunctionPrefix = "github.com/d4l3k/go-pry/pry."
+
+// position is where a session was opened.
+type position struct {
+	filePath, filePathRaw string
+	line                  int
+	goroutine             int
+	// stack has the callers of the breakpoint, innermost first.
+	stack []runtime.Frame
+}
+
+// newPosition returns the position of a session opened by the calling
+// goroutine.
+func newPosition(filePath, filePathRaw string, line int) *position {
+	return &position{
+		filePath:    filePath,
+		filePathRaw: filePathRaw,
+		line:        line,
+		goroutine:   goroutineID(),
+		stack:       callerStack(),
+	}
+}
+
+// callerStack returns the stack of the calling goroutine without the frames
+// of pry at the top.
+func callerStack() []runtime.Frame {
+	pcs := make([]uintptr, 100)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	var stack []runtime.Frame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, frame)
+		if !more {
+			break
+		}
+	}
+	return trimStack(stack)
+}
+
+// trimStack removes the frames of pry from the top of stack and
+// runtime.goexit, which starts every goroutine, from the bottom.
+func trimStack(stack []runtime.Frame) []runtime.Frame {
+	for len(stack) > 0 && strings.HasPrefix(stack[0].Function, pryFunctionPrefix) {
+		stack = stack[1:]
+	}
+	if n := len(stack); n > 0 && stack[n-1].Function == "runtime.goexit" {
+		stack = stack[:n-1]
+	}
+	return stack
+}
+
+// show writes the source around the position and the first callers.
+func (p *position) show(out io.Writer, config *Config) {
+	if len(p.filePath) > 0 {
+		displayFilePosition(out, config.Theme, p.filePathRaw, p.filePath, p.line, config.ContextLines)
+	} else if len(p.filePathRaw) > 0 {
+		fmt.Fprintf(out, "\nFrom %s @ line %d :\n\n", p.filePathRaw, p.line)
+	}
+	if len(p.stack) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "goroutine %d:\n", p.goroutine)
+	for i, frame := range p.stack {
+		if i == compactFrames {
+			fmt.Fprintf(out, "  ... %d more, see :backtrace\n", len(p.stack)-i)
+			break
+		}
+		fmt.Fprintf(out, "  %s %s:%d\n", shortFunction(frame.Function), filepath.Base(frame.File), frame.Line)
+	}
+	fmt.Fprintln(out)
+}
+
+// shortFunction strips the import path from the package of a function name,
+// e.g. github.com/a/b.(*T).F becomes b.(*T).F.
+func shortFunction(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+func runWhereami(env *commandEnv, args []string) error {
+	if env.position == nil {
+		fmt.Fprintln(env.out, "The session wasn't opened at a breakpoint.")
+		return nil
+	}
+	env.position.show(env.out, env.config)
+	return nil
+}
+
+func runBacktrace(env *commandEnv, args []string) error {
+	if env.position == nil || len(env.position.stack) == 0 {
+		fmt.Fprintln(env.out, "No stack available.")
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "goroutine %d:\n", env.position.goroutine)
+	for _, frame := range env.position.stack {
+		fmt.Fprintf(&b, "%s()\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+	}
+	env.show(b.String())
+	return nil
+}
@@ -0,0 +1,133 @@
+package pry
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTrimStack(t *testing.T) {
+	t.Parallel()
+
+	stack := []runtime.Frame{
+		{Function: "github.com/d4l3k/go-pry/pry.(*REPL).run"},
+		{Function: "github.com/d4l3k/go-pry/pry.Apply"},
+		{Function: "main.worker"},
+		{Function: "github.com/d4l3k/go-pry/pry.Once"},
+		{Function: "main.main"},
+		{Function: "runtime.main"},
+		{Function: "runtime.goexit"},
+	}
+	want := stack[2:6]
+	if got := trimStack(stack); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %#v got %#v.", want, got)
+	}
+
+	// The test functions are in the pry package too.
+	if got := callerStack(); len(got) == 0 || got[0].Function != "testing.tRunner" {
+		t.Errorf("Expected the stack to start at testing.tRunner; got %#v", got)
+	}
+}
+
+func testPosition(t *testing.T, frames int) *position {
+	dir, err := ioutil.TempDir("", "go-pry-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.go")
+	var src strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&src, "// line %d\n", i)
+	}
+	if err := ioutil.WriteFile(path, []byte(src.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pos := &position{filePath: path, filePathRaw: path, line: 10, goroutine: 7}
+	for i := 0; i < frames; i++ {
+		pos.stack = append(pos.stack, runtime.Frame{
+			Function: fmt.Sprintf("github.com/a/b.f%d", i),
+			File:     fmt.Sprintf("/src/b/f%d.go", i),
+			Line:     i + 1,
+		})
+	}
+	return pos
+}
+
+func TestWhereamiCommand(t *testing.T) {
+	t.Parallel()
+
+	pos := testPosition(t, 7)
+	defer os.RemoveAll(filepath.Dir(pos.filePath))
+	var out bytes.Buffer
+	env := &commandEnv{
+		scope:    NewScope(),
+		out:      &out,
+		config:   newConfig(WithTheme(NoColorTheme), WithContextLines(2)),
+		position: pos,
+	}
+	if _, err := runCommand(env, ":whereami"); err != nil {
+		t.Fatal(err)
+	}
+	want := "\nFrom " + pos.filePath + " @ line 10 :\n\n" +
+		"     8: // line 8\n" +
+		"     9: // line 9\n" +
+		" => 10: // line 10\n" +
+		"    11: // line 11\n" +
+		"    12: // line 12\n" +
+		"\n" +
+		"goroutine 7:\n" +
+		"  b.f0 f0.go:1\n" +
+		"  b.f1 f1.go:2\n" +
+		"  b.f2 f2.go:3\n" +
+		"  b.f3 f3.go:4\n" +
+		"  b.f4 f4.go:5\n" +
+		"  ... 2 more, see :backtrace\n" +
+		"\n"
+	if out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+
+	out.Reset()
+	pos.filePath = filepath.Join(filepath.Dir(pos.filePath), ".main.gopry")
+	pos.filePathRaw = pos.filePath
+	pos.stack = nil
+	if _, err := runCommand(env, ":whereami"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Source unavailable: ") || strings.Contains(out.String(), "goroutine") {
+		t.Errorf("Expected the source to be unavailable and no stack; got %q", out.String())
+	}
+}
+
+func TestBacktraceCommand(t *testing.T) {
+	t.Parallel()
+
+	pos := testPosition(t, 2)
+	defer os.RemoveAll(filepath.Dir(pos.filePath))
+	var out bytes.Buffer
+	env := &commandEnv{scope: NewScope(), out: &out, config: newConfig(), position: pos}
+	if _, err := runCommand(env, ":bt"); err != nil {
+		t.Fatal(err)
+	}
+	want := "goroutine 7:\n" +
+		"github.com/a/b.f0()\n\t/src/b/f0.go:1\n" +
+		"github.com/a/b.f1()\n\t/src/b/f1.go:2\n"
+	if out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+
+	out.Reset()
+	env.position = nil
+	if _, err := runCommand(env, ":backtrace"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "No stack available.\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+}
@@ -0,0 +1,328 @@
+package pry
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The categories commands are listed under by :help.
+const (
+	categorySession = "Session commands"
+	categoryScope   = "Scope commands"
+)
+
+// errExit is returned by commands that end the session.
+var errExit = errors.New("exit")
+
+// command is a REPL command such as :help. Commands register themselves with
+// registerCommand so :help always lists every command.
+type command struct {
+	// Name is the primary name including the colon, e.g. ":help".
+	Name string
+	// Aliases are other names for the command, such as "help".
+	Aliases  []string
+	Category string
+	// Usage shows the arguments, e.g. ":help [command]".
+	Usage   string
+	Summary string
+	// Help is the detailed description shown by ":help <command>".
+	Help string
+	Run  func(env *commandEnv, args []string) error
+}
+
+// commandEnv is what commands have access to.
+type commandEnv struct {
+	scope  *Scope
+	out    io.Writer
+	tty    genericTTY
+	config *Config
+	// session has the inputs of the session so far.
+	session *session
+	history historyStore
+	// rerun is set by commands that re-execute an input, which the REPL
+	// then runs as if it was typed.
+	rerun string
+	// argText is the input after the command name, for commands that take
+	// an expression.
+	argText string
+	// position is where the session was opened.
+	position *position
+}
+
+// width returns the width of the terminal.
+func (env *commandEnv) width() int {
+	if env.tty != nil {
+		if width, _, err := env.tty.Size(); err == nil && width > 0 {
+			return width
+		}
+	}
+	return 80
+}
+
+// show writes text to the output, through the pager if it's too tall for
+// the terminal.
+func (env *commandEnv) show(text string) {
+	if env.tty != nil && env.config != nil {
+		paged, err := page(env.config, env.out, env.tty, text)
+		if err != nil {
+			printError(env.out, env.config.Theme, err)
+		} else if paged {
+			return
+		}
+	}
+	fmt.Fprint(env.out, text)
+}
+
+// historyStore is the input history shared by the line editor and the
+// commands.
+type historyStore interface {
+	Len() int
+	// Record returns the record at index i, oldest first.
+	Record(i int) string
+	Append(record string) error
+}
+
+var (
+	commands     []*command
+	commandNames = map[string]*command{}
+)
+
+// registerCommand adds c to the command table.
+func registerCommand(c *command) {
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if _, ok := commandNames[name]; ok {
+			panic(fmt.Sprintf("pry: command %q registered twice", name))
+		}
+		commandNames[name] = c
+	}
+	commands = append(commands, c)
+}
+
+// lookupCommand returns the command named by the first word of input and the
+// remaining words. isCommand is true if input starts with a colon even if
+// there's no such command.
+func lookupCommand(input string) (c *command, args []string, isCommand bool) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return nil, nil, false
+	}
+	if historyShorthand.MatchString(fields[0]) {
+		return commandNames[":history"], fields, true
+	}
+	c, ok := commandNames[fields[0]]
+	if !ok {
+		return nil, nil, strings.HasPrefix(fields[0], ":")
+	}
+	return c, fields[1:], true
+}
+
+// runCommand runs the command in input. It returns false if input isn't a
+// command.
+func runCommand(env *commandEnv, input string) (bool, error) {
+	c, args, isCommand := lookupCommand(input)
+	if !isCommand {
+		return false, nil
+	}
+	if c == nil {
+		name := strings.Fields(input)[0]
+		return true, errors.Errorf("unknown command %s%s", name, didYouMean(name, commandCandidates()))
+	}
+	env.argText = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(input), strings.Fields(input)[0]))
+	return true, c.Run(env, args)
+}
+
+// commandCandidates returns the names of all commands.
+func commandCandidates() []string {
+	var names []string
+	for name := range commandNames {
+		names = append(names, name)
+	}
+	return names
+}
+
+// builtinSignatures documents the supported builtins for :help.
+var builtinSignatures = []struct{ name, signature string }{
+	{"append", "append(slice []T, elems ...T) []T"},
+	{"close", "close(c chan<- T)"},
+	{"len", "len(v T) int"},
+	{"make", "make(t T, size ...int) T"},
+}
+
+// keyBindings documents the line editor keys for :help.
+var keyBindings = []struct{ key, summary string }{
+	{"Tab", "Complete the identifier, field or method before the cursor."},
+	{"Up/Down", "Move through the history."},
+	{"Left/Right", "Move the cursor."},
+	{"Ctrl-R", "Search the history backwards."},
+	{"Ctrl-C", "Interrupt the running evaluation or discard the input."},
+	{"Ctrl-D", "Exit the session."},
+	{"Ctrl-A/Ctrl-E", "Move to the start or end of the line (emacs mode)."},
+	{"Alt-B/Alt-F", "Move back or forward a word (emacs mode)."},
+	{"Ctrl-W/Ctrl-K/Ctrl-U", "Cut the word before the cursor, or the line after or before it (emacs mode)."},
+	{"Ctrl-Y", "Paste the text last cut (emacs mode)."},
+	{"Esc", "Switch to normal mode, with vi's motions and d, c, x and p (vi mode)."},
+}
+
+func init() {
+	registerCommand(&command{
+		Name:     ":help",
+		Aliases:  []string{"help"},
+		Category: categorySession,
+		Usage:    ":help [command]",
+		Summary:  "List the commands, builtins and key bindings, or describe one command.",
+		Run:      runHelp,
+	})
+	registerCommand(&command{
+		Name:     ":exit",
+		Aliases:  []string{"exit", "continue"},
+		Category: categorySession,
+		Usage:    ":exit",
+		Summary:  "End the session and continue running the program.",
+		Run: func(*commandEnv, []string) error {
+			return errExit
+		},
+	})
+}
+
+func runHelp(env *commandEnv, args []string) error {
+	if len(args) > 0 {
+		name := args[0]
+		c, ok := commandNames[name]
+		if !ok {
+			c, ok = commandNames[":"+name]
+		}
+		if !ok {
+			return errors.Errorf("unknown command %s%s", name, didYouMean(name, commandCandidates()))
+		}
+		fmt.Fprint(env.out, commandDetail(c, env.width()))
+		return nil
+	}
+	fmt.Fprint(env.out, helpText(env.scope, env.width()))
+	return nil
+}
+
+// commandDetail describes one command.
+func commandDetail(c *command, width int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage: %s\n", c.Usage)
+	if len(c.Aliases) > 0 {
+		fmt.Fprintf(&b, "Aliases: %s\n", strings.Join(c.Aliases, ", "))
+	}
+	b.WriteString("\n")
+	b.WriteString(wrapText(c.Summary, width, ""))
+	if len(c.Help) > 0 {
+		b.WriteString("\n")
+		b.WriteString(wrapText(c.Help, width, ""))
+	}
+	return b.String()
+}
+
+// helpText lists the commands by category followed by the builtins,
+// including the ones registered for scope, and key bindings.
+func helpText(scope *Scope, width int) string {
+	byCategory := map[string][][2]string{}
+	var categories []string
+	for _, c := range commands {
+		if _, ok := byCategory[c.Category]; !ok {
+			categories = append(categories, c.Category)
+		}
+		byCategory[c.Category] = append(byCategory[c.Category], [2]string{c.Usage, c.Summary})
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categoryOrder(categories[i]) < categoryOrder(categories[j])
+	})
+
+	var b strings.Builder
+	for _, category := range categories {
+		entries := byCategory[category]
+		sort.Slice(entries, func(i, j int) bool { return entries[i][0] < entries[j][0] })
+		writeHelpSection(&b, category, entries, width)
+	}
+
+	var builtins [][2]string
+	for _, builtin := range builtinSignatures {
+		builtins = append(builtins, [2]string{builtin.name, builtin.signature})
+	}
+	for _, name := range scope.registeredNames() {
+		if v, ok := scope.registeredValue(name); ok {
+			builtins = append(builtins, [2]string{name, registeredSignature(name, v)})
+		}
+	}
+	writeHelpSection(&b, "Builtins", builtins, width)
+
+	var keys [][2]string
+	for _, key := range keyBindings {
+		keys = append(keys, [2]string{key.key, key.summary})
+	}
+	writeHelpSection(&b, "Key bindings", keys, width)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// categoryOrder lists the session commands first, then the scope commands,
+// then any others alphabetically.
+func categoryOrder(category string) string {
+	switch category {
+	case categorySession:
+		return "0"
+	case categoryScope:
+		return "1"
+	}
+	return "2" + category
+}
+
+// writeHelpSection writes a titled two column table, wrapping the second
+// column to fit within width.
+func writeHelpSection(b *strings.Builder, title string, entries [][2]string, width int) {
+	fmt.Fprintf(b, "%s:\n", title)
+	nameWidth := 0
+	for _, entry := range entries {
+		if len(entry[0]) > nameWidth {
+			nameWidth = len(entry[0])
+		}
+	}
+	indent := strings.Repeat(" ", nameWidth+4)
+	// Narrow terminals get the summaries on their own lines.
+	stacked := width-len(indent) < minWrapWidth
+	if stacked {
+		indent = "      "
+	}
+	for _, entry := range entries {
+		summary := wrapText(entry[1], width, indent)
+		if stacked {
+			fmt.Fprintf(b, "  %s\n%s", entry[0], summary)
+		} else {
+			fmt.Fprintf(b, "  %-*s  %s", nameWidth, entry[0], strings.TrimPrefix(summary, indent))
+		}
+	}
+	b.WriteString("\n")
+}
+
+// minWrapWidth is the narrowest column text is wrapped to.
+const minWrapWidth = 20
+
+// wrapText wraps text at word boundaries to fit within width, prefixing
+// every line with indent. Each line ends with a newline.
+func wrapText(text string, width int, indent string) string {
+	lineWidth := width - len(indent)
+	if lineWidth < minWrapWidth {
+		lineWidth = minWrapWidth
+	}
+	var b strings.Builder
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if len(line) > 0 && len(line)+1+len(word) > lineWidth {
+			b.WriteString(indent + line + "\n")
+			line = ""
+		}
+		if len(line) > 0 {
+			line += " "
+		}
+		line += word
+	}
+	b.WriteString(indent + line + "\n")
+	return b.String()
+}
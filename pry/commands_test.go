@@ -0,0 +1,85 @@
+package pry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		input     string
+		isCommand bool
+		err       string
+	}{
+		{"a := 1", false, ""},
+		{"help", true, ""},
+		{":help :exit", true, ""},
+		{"exit", true, "exit"},
+		{":exit", true, "exit"},
+		{":hepl", true, "unknown command :hepl; did you mean :help?"},
+		{":help nope", true, "unknown command nope"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		env := &commandEnv{scope: NewScope(), out: &out}
+		isCommand, err := runCommand(env, c.input)
+		if isCommand != c.isCommand {
+			t.Errorf("%q: expected isCommand = %t; got %t", c.input, c.isCommand, isCommand)
+		}
+		if (err == nil && c.err != "") || (err != nil && err.Error() != c.err) {
+			t.Errorf("%q: expected error %q; got %v", c.input, c.err, err)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	env := &commandEnv{scope: NewScope(), out: &out}
+	if _, err := runCommand(env, ":help"); err != nil {
+		t.Fatal(err)
+	}
+	help := out.String()
+	for _, want := range []string{
+		"Session commands:", "  :help [command]", "Builtins:",
+		"append(slice []T, elems ...T) []T", "Key bindings:", "Ctrl-R",
+	} {
+		if !strings.Contains(help, want) {
+			t.Errorf("expected help to contain %q:\n%s", want, help)
+		}
+	}
+
+	out.Reset()
+	if _, err := runCommand(env, "help exit"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Usage: :exit\nAliases: exit, continue\n") {
+		t.Errorf("expected :exit details; got:\n%s", out.String())
+	}
+}
+
+func TestHelpWidth(t *testing.T) {
+	t.Parallel()
+
+	for _, width := range []int{40, 80} {
+		for _, line := range strings.Split(helpText(NewScope(), width), "\n") {
+			if len(line) > width {
+				t.Errorf("width %d: line is too long: %q", width, line)
+			}
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	t.Parallel()
+
+	out := wrapText("the quick brown fox jumps over the lazy dog", 25, "  ")
+	want := "  the quick brown fox\n  jumps over the lazy dog\n"
+	if out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
@@ -0,0 +1,307 @@
+package pry
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+)
+
+// Program is source compiled by Compile, to be run any number of times.
+type Program struct {
+	scope   *Scope
+	src     string
+	body    *ast.BlockStmt
+	shifted int
+	run     compiled
+}
+
+// compiled runs a compiled node in scope and returns what Interpret returns
+// for it.
+type compiled func(scope *Scope) (interface{}, error)
+
+// Compile parses src, like Eval does, and compiles it into closures, so
+// running it again skips walking the AST and looking up what doesn't change
+// between runs, such as the values of literals.
+// Nodes that aren't compiled are interpreted when they're run, so programs
+// behave exactly like Eval.
+//
+// The program runs in scope unless it's run in another one.
+func Compile(scope *Scope, src string) (*Program, error) {
+	body, shifted, err := parseProgram(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{scope: scope, src: src, body: body, shifted: shifted, run: compileNode(body)}, nil
+}
+
+// Run runs p in scope, or in the scope it was compiled for if scope is nil,
+// and returns the value of the last statement, like EvalContext.
+func (p *Program) Run(scope *Scope) (interface{}, error) {
+	return p.RunContext(context.Background(), scope)
+}
+
+// RunContext is Run stopping once ctx is done, like EvalContext.
+func (p *Program) RunContext(ctx context.Context, scope *Scope) (interface{}, error) {
+	if scope == nil {
+		scope = p.scope
+	}
+	res, err := scope.eval(ctx, p.src, p)
+	return res.Value, err
+}
+
+// compileNode compiles node into a closure doing what Interpret does for it.
+func compileNode(node ast.Node) compiled {
+	switch e := node.(type) {
+	case *ast.Ident:
+		// Identifiers are resolved when they're run, as variables shadow
+		// types and types can be registered after compiling.
+		name := e.Name
+		return func(scope *Scope) (interface{}, error) {
+			return scope.ident(name)
+		}
+
+	case *ast.BasicLit:
+		// Literals don't depend on the scope.
+		v, err := (*Scope)(nil).Interpret(e)
+		return func(*Scope) (interface{}, error) {
+			return v, err
+		}
+
+	case *ast.ParenExpr:
+		return compileNode(e.X)
+
+	case *ast.BinaryExpr:
+		x, y, op := compileNode(e.X), compileNode(e.Y), e.Op
+		untyped := isUntypedLiteral(e.X) || isUntypedLiteral(e.Y)
+		return func(scope *Scope) (interface{}, error) {
+			xv, err := x(scope)
+			if err != nil {
+				return nil, err
+			}
+			yv, err := y(scope)
+			if err != nil {
+				return nil, err
+			}
+			if untyped {
+				xv, yv = untypedOperands(e, xv, yv)
+			}
+			out, err := ComputeBinaryOp(xv, yv, op)
+			if err != nil {
+				return nil, operationError(e, err)
+			}
+			return out, nil
+		}
+
+	case *ast.UnaryExpr:
+		if e.Op == token.AND {
+			break
+		}
+		x, op := compileNode(e.X), e.Op
+		return func(scope *Scope) (interface{}, error) {
+			xv, err := x(scope)
+			if err != nil {
+				return nil, err
+			}
+			return scope.ComputeUnaryOp(xv, op)
+		}
+
+	case *ast.CallExpr:
+		args := compileList(e.Args)
+		fun, argExprs := e.Fun, e.Args
+		return func(scope *Scope) (interface{}, error) {
+			argVals := make([]interface{}, len(args))
+			for i, arg := range args {
+				v, err := arg(scope)
+				if err != nil {
+					return nil, err
+				}
+				argVals[i] = v
+			}
+			return scope.executeCall(fun, argExprs, argVals)
+		}
+
+	case *ast.BlockStmt:
+		stmts := make([]compiled, len(e.List))
+		for i, stmt := range e.List {
+			stmts[i] = compileNode(stmt)
+		}
+		return func(scope *Scope) (interface{}, error) {
+			var outFinal interface{}
+			for _, stmt := range stmts {
+				if err := scope.checkInterrupt(); err != nil {
+					return nil, err
+				}
+				out, err := stmt(scope)
+				if err != nil {
+					return out, err
+				}
+				outFinal = out
+			}
+			return outFinal, nil
+		}
+
+	case *ast.ExprStmt:
+		return compileNode(e.X)
+
+	case *ast.AssignStmt:
+		if ident, ok := e.Lhs[0].(*ast.Ident); ok && len(e.Lhs) == 1 && len(e.Rhs) == 1 && e.Tok != token.DEFINE {
+			return compileAssignIdent(e, ident.Name)
+		}
+		if len(e.Lhs) == 2 && len(e.Rhs) == 1 {
+			// The value may be a comma-ok lookup, v, ok := m[k].
+			return func(scope *Scope) (interface{}, error) {
+				vals, err := scope.commaOk(e.Rhs[0])
+				if err != nil {
+					return nil, err
+				}
+				return scope.assign(e, vals)
+			}
+		}
+		rhs := compileList(e.Rhs)
+		return func(scope *Scope) (interface{}, error) {
+			vals := make([]interface{}, len(rhs))
+			for i, r := range rhs {
+				v, err := r(scope)
+				if err != nil {
+					return nil, err
+				}
+				vals[i] = v
+			}
+			return scope.assign(e, vals)
+		}
+
+	case *ast.IncDecStmt:
+		return compileNode(incDecAssign(e))
+
+	case *ast.ForStmt:
+		return compileFor(e)
+
+	case *ast.IfStmt:
+		init, cond, body, els := compileOptional(e.Init), compileNode(e.Cond), compileNode(e.Body), compileOptional(e.Else)
+		return func(scope *Scope) (interface{}, error) {
+			currentScope := scope.NewChild()
+			if init != nil {
+				if _, err := init(currentScope); err != nil {
+					return nil, err
+				}
+			}
+			c, err := cond(currentScope)
+			if err != nil {
+				return nil, err
+			}
+			if ok, isBool := c.(bool); !isBool {
+				return nil, newTypeError("if condition", "bool", c)
+			} else if ok {
+				return body(currentScope)
+			} else if els == nil {
+				return nil, nil
+			}
+			return els(currentScope)
+		}
+	}
+	return func(scope *Scope) (interface{}, error) {
+		return scope.Interpret(node)
+	}
+}
+
+// compileAssignIdent compiles e, an assignment to the variable name other
+// than a definition, like Scope.assign runs it but finding the variable once.
+func compileAssignIdent(e *ast.AssignStmt, name string) compiled {
+	rhs, rhsExpr, tok := compileNode(e.Rhs[0]), e.Rhs[0], e.Tok
+	return func(scope *Scope) (interface{}, error) {
+		r, err := rhs(scope)
+		if err != nil {
+			return nil, err
+		}
+		owner, ptr, exists := scope.owner(name)
+		if !exists {
+			return nil, &UndefinedError{Name: name}
+		}
+		val := derefScopeValue(ptr)
+		r, err = assignedValue(tok, rhsExpr, r, val, variableType(ptr, val))
+		if err != nil {
+			return nil, err
+		}
+		if !owner.setExisting(name, r, scope.hooks()) {
+			// The variable was deleted meanwhile.
+			scope.Set(name, r)
+		}
+		return r, nil
+	}
+}
+
+// compileList compiles each of exprs.
+func compileList(exprs []ast.Expr) []compiled {
+	out := make([]compiled, len(exprs))
+	for i, expr := range exprs {
+		out[i] = compileNode(expr)
+	}
+	return out
+}
+
+// compileOptional compiles stmt, or returns nil if there's none.
+func compileOptional(stmt ast.Stmt) compiled {
+	if stmt == nil {
+		return nil
+	}
+	return compileNode(stmt)
+}
+
+// compileFor compiles a for loop like Interpret runs it.
+func compileFor(e *ast.ForStmt) compiled {
+	init, post, body := compileOptional(e.Init), compileOptional(e.Post), compileNode(e.Body)
+	var cond compiled
+	if e.Cond != nil {
+		cond = compileNode(e.Cond)
+	}
+	return func(scope *Scope) (interface{}, error) {
+		s := scope.NewChild()
+		if init != nil {
+			if _, err := init(s); err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		var last interface{}
+		for {
+			if err := s.checkInterrupt(); err != nil {
+				return nil, err
+			}
+			if cond != nil {
+				c, err := cond(s)
+				if err != nil {
+					return nil, err
+				}
+				if cont, ok := c.(bool); !ok {
+					return nil, newTypeError("for loop condition", "bool", c)
+				} else if !cont {
+					return last, nil
+				}
+			}
+
+			last, err = body(s)
+			if err == ErrBranchBreak {
+				break
+			} else if err != nil && err != ErrBranchContinue {
+				return nil, err
+			}
+
+			if post != nil {
+				if _, err := post(s); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return last, nil
+	}
+}
+
+// compiling returns whether Eval compiles the sources it evaluates in scope.
+func (scope *Scope) compiling() bool {
+	for s := scope; s != nil; s = s.Parent {
+		if s.compileEval {
+			return true
+		}
+	}
+	return false
+}
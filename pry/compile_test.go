@@ -0,0 +1,213 @@
+package pry
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// engineCases are evaluated by both engines, which must agree on them.
+var engineCases = []struct {
+	name string
+	src  string
+	want interface{}
+	// err is part of the error the evaluation fails with, if it does.
+	err string
+}{
+	{name: "string", src: `"Hello!"`, want: "Hello!"},
+	{name: "int", src: `-1234`, want: -1234},
+	{name: "hex", src: `0xC123`, want: 0xC123},
+	{name: "char", src: `'a'`, want: 'a'},
+	{name: "float", src: `1.5 * 2`, want: 3.0},
+	{name: "math", src: `(2 + 3) * 4 - 10 / 3 % 2`, want: 19},
+	{name: "shift", src: `1 << 4 >> 2`, want: 4},
+	{name: "bool", src: `!(1 < 2 && 3 >= 4) || false`, want: true},
+	{name: "concat", src: `"a" + "b" + string('c')`, want: "abc"},
+	{name: "unary", src: `x := 3; -x + 1`, want: -2},
+	{name: "typed", src: `var x int64 = 2; x * 3`, want: int64(6)},
+	{name: "define", src: `a, b := 1, 2; a, b = b, a; a - b`, want: 1},
+	{name: "assign op", src: `s := "x"; s += "y"; n := 10; n -= 3; n *= 2; s + string(rune('0'+n))`, want: "xy>"},
+	{name: "incdec", src: `i := 0; i++; i++; i--; i`, want: 1},
+	{name: "slice", src: `s := []int{1, 2, 3}; s = append(s, 4); s[1:3]`, want: []int{2, 3}},
+	{name: "array", src: `var a [3]int; a[2] = 5; a`, want: [3]int{0, 0, 5}},
+	{name: "map", src: `m := map[string]int{"a": 1}; m["b"] = 2; len(m) + m["a"]`, want: 3},
+	{name: "nested", src: `m := map[string][]int{"a": []int{1}}; m["a"] = append(m["a"], 2); m["a"][1]`, want: 2},
+	{name: "if", src: `x := 5; if y := x * 2; y > 8 { x = 1 } else { x = 2 }; x`, want: 1},
+	{name: "else if", src: `x := 0; if x > 0 { x = 1 } else if x < 0 { x = 2 } else { x = 3 }; x`, want: 3},
+	{name: "for", src: `sum := 0; for i := 0; i < 10; i++ { if i%2 == 0 { continue }; if i > 7 { break }; sum += i }; sum`, want: 16},
+	{name: "for cond", src: `n := 1; for n < 100 { n *= 3 }; n`, want: 243},
+	{name: "range", src: `sum := 0; for _, v := range []int{1, 2, 3} { sum += v }; sum`, want: 6},
+	{name: "switch", src: `x := 2; r := ""; switch x { case 1: r = "one"; case 2: r = "two"; default: r = "many" }; r`, want: "two"},
+	{name: "closure", src: `n := 0; inc := func(d int) int { n += d; return n }; inc(2); inc(3)`, want: 5},
+	{name: "multi return", src: `f := func() (int, string) { return 1, "a" }; a, b := f(); b + string(rune('0'+a))`, want: "a1"},
+	{name: "defer", src: `s := ""; func() { defer func() { s += "b" }(); s += "a" }(); s`, want: "ab"},
+	{name: "conversion", src: `float64(7) / 2`, want: 3.5},
+	{name: "shadowed type", src: `int := 5; string := "a"; int + len(string)`, want: 6},
+	{name: "undefined", src: `x + 1`, err: "undefined: x"},
+	{name: "mismatch", src: `1 + "a"`, err: "unknown operation"},
+	{name: "index", src: `s := []int{1}; s[3]`, err: "out of range"},
+	{name: "divide", src: `x := 0; 1 / x`, err: "division by zero"},
+	{name: "parse", src: `1 +`, err: "expected operand"},
+}
+
+func TestEngines(t *testing.T) {
+	t.Parallel()
+
+	for _, engine := range []string{"interpreted", "compiled"} {
+		for _, c := range engineCases {
+			scope := NewScope()
+			scope.compileEval = engine == "compiled"
+			out, err := scope.InterpretString(c.src)
+			if len(c.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("%s %s: expected an error with %q got %v.", engine, c.name, c.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s: %v", engine, c.name, err)
+			} else if !reflect.DeepEqual(out, c.want) {
+				t.Errorf("%s %s: expected %#v got %#v.", engine, c.name, c.want, out)
+			}
+		}
+	}
+}
+
+// interpreterTests are the tests of the interpreter TestCompiledEngine runs
+// again with the compiled engine.
+var interpreterTests = []func(*testing.T){
+	TestEmptyString, TestStringLiteral, TestIntLiteral, TestHexIntLiteral,
+	TestOctalIntLiteral, TestCharLiteral, TestArrayLiteral,
+	TestFixedArrayLiteral, TestFixedArray, TestFixedArraySet,
+	TestArraySet, TestMapLiteral, TestElidedCompositeLiterals, TestMapSet,
+	TestMapLiteralInterface, TestMapIndex, TestTypeCast,
+	TestStringConversions, TestStringConversionWarning,
+	TestTypeDeclarations, TestCompareComposite, TestBasicIdent,
+	TestMissingBasicIdent, TestMapIdent, TestMissingMapIdent,
+	TestArrIdent, TestMissingArrIdent, TestSlice, TestSliceOmittedBounds,
+	TestOutOfRangeMessages, TestInterruptInfiniteLoop, TestEvalContext,
+	TestSelector, TestStructLiteral, TestStructLiteralNamed,
+	TestStructLiteralEmpty, TestStructSelectorAssignment,
+	TestSelectorFunc, TestPackageMembers, TestPackageVariableAssignment,
+	TestLazyPackage, TestPackageTypes, TestGenerics, TestDotImportScope,
+	TestBasicMath, TestMathShifting, TestMathBasic, TestBoolConds,
+	TestStringConcat, TestParens, TestMakeSlice, TestMakeChan,
+	TestMakeChanInterface, TestMakeUnknown, TestAppend, TestMultiReturn,
+	TestDeclareAssignVar, TestDeclareVarWithoutType, TestDeclareAssign,
+	TestAssign, TestAssignTypeMismatch, TestAssignUntypedConversion,
+	TestFuncDeclAndCall, TestChannel, TestChannelSendFail,
+	TestChannelRecvFail, TestFor, TestForBreak, TestForContinue,
+	TestForRangeArray, TestForRangeMap, TestForRangeInt, TestForRangeFunc,
+	TestForRangeErrors, TestReturnEndsFunc, TestSelectDefault, TestSelect,
+	TestSelectMultiCase, TestSwitch, TestSwitchDefault, TestSwitchBool,
+	TestSwitchType, TestSwitchTypeUse, TestSwitchNone, TestIf, TestIfElse,
+	TestIfIfElse, TestIfWithoutElse, TestInitStatementScope,
+	TestFunctionArgs, TestFunctionArgsBad, TestDefer, TestStringAppend,
+	TestIntMod, TestAssignWritesThrough, TestDefineShadowsParent,
+	TestInterpretProgram, TestInterpretProgramErrors,
+	TestGroupedDeclarations, TestEval,
+}
+
+// newTestScope returns a new scope for the test t, which compiles what's
+// evaluated in it when t is run by TestCompiledEngine.
+func newTestScope(t *testing.T) *Scope {
+	scope := NewScope()
+	scope.compileEval = strings.HasPrefix(t.Name(), "TestCompiledEngine/")
+	return scope
+}
+
+// TestCompiledEngine runs the tests of the interpreter with the compiled
+// engine, which must behave the same. It isn't parallel, as some of them
+// change package variables.
+func TestCompiledEngine(t *testing.T) {
+	for _, test := range interpreterTests {
+		name := runtime.FuncForPC(reflect.ValueOf(test).Pointer()).Name()
+		t.Run(name[strings.LastIndex(name, ".")+1:], test)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("n", 10)
+	prog, err := Compile(scope, "sum := 0; for i := 0; i < n; i++ { if i%2 == 0 { sum += i } else { sum-- } }; sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if out, err := prog.Run(nil); err != nil || out != 15 {
+			t.Errorf("Expected %#v got %#v %v.", 15, out, err)
+		}
+	}
+	// Identifiers are looked up in the scope it's run in.
+	other := NewScope()
+	other.Set("n", 5)
+	if out, err := prog.Run(other); err != nil || out != 4 {
+		t.Errorf("Expected %#v got %#v %v.", 4, out, err)
+	}
+	var undefined *UndefinedError
+	if _, err := prog.Run(NewScope()); !errors.As(err, &undefined) || undefined.Name != "n" {
+		t.Errorf("Expected an *UndefinedError for n got %#v.", err)
+	}
+
+	// Variables shadow the types with their names when it's run.
+	prog, err = Compile(scope, "int(n) + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := prog.Run(nil); err != nil || out != 11 {
+		t.Errorf("Expected %#v got %#v %v.", 11, out, err)
+	}
+	other.Set("int", func(n int) int { return -n })
+	if out, err := prog.Run(other); err != nil || out != -4 {
+		t.Errorf("Expected %#v got %#v %v.", -4, out, err)
+	}
+
+	var parseErr *ParseError
+	if _, err := Compile(scope, "1 +"); !errors.As(err, &parseErr) {
+		t.Errorf("Expected a *ParseError got %#v.", err)
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.SetLimits(Limits{MaxSteps: 100})
+	prog, err := Compile(scope, "for {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stepErr *StepLimitError
+	if _, err := prog.Run(nil); !errors.As(err, &stepErr) {
+		t.Errorf("Expected a *StepLimitError got %#v.", err)
+	}
+}
+
+// arithmeticSrc is an arithmetic heavy program for the benchmarks.
+const arithmeticSrc = "x := 0; for i := 0; i < 100; i++ { x = x + i*3 - (i/2)%7 }; x"
+
+func BenchmarkArithmeticInterpreted(b *testing.B) {
+	scope := NewScope()
+	for i := 0; i < b.N; i++ {
+		if _, err := scope.InterpretString(arithmeticSrc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkArithmeticCompiled(b *testing.B) {
+	scope := NewScope()
+	prog, err := Compile(scope, arithmeticSrc)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		if _, err := prog.Run(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
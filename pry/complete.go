@@ -0,0 +1,588 @@
+package pry
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// CandidateKind is the kind of a completion candidate.
+type CandidateKind int
+
+const (
+	// CandidateVariable is a variable of the scope or of a package.
+	CandidateVariable CandidateKind = iota
+	// CandidateConst is a constant of a package.
+	CandidateConst
+	// CandidateField is a field of a struct.
+	CandidateField
+	// CandidateMethod is a method.
+	CandidateMethod
+	// CandidateFunc is a function, including the variables of the scope
+	// holding one.
+	CandidateFunc
+	// CandidatePackage is a package.
+	CandidatePackage
+	// CandidateType is a type of the scope or of a package, or one registered
+	// with RegisterNamedType.
+	CandidateType
+	// CandidateBuiltin is a predeclared identifier, such as len, int or nil.
+	CandidateBuiltin
+)
+
+func (k CandidateKind) String() string {
+	switch k {
+	case CandidateVariable:
+		return "variable"
+	case CandidateConst:
+		return "const"
+	case CandidateField:
+		return "field"
+	case CandidateMethod:
+		return "method"
+	case CandidateFunc:
+		return "func"
+	case CandidatePackage:
+		return "package"
+	case CandidateType:
+		return "type"
+	case CandidateBuiltin:
+		return "builtin"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes k as its name, so candidates encoded as JSON have kinds
+// like "field".
+func (k CandidateKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes the name of a kind.
+func (k *CandidateKind) UnmarshalText(text []byte) error {
+	for kind := CandidateVariable; kind <= CandidateBuiltin; kind++ {
+		if kind.String() == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return errors.Errorf("unknown candidate kind %q", text)
+}
+
+// Candidate is a completion candidate.
+type Candidate struct {
+	// Text replaces the identifier being completed.
+	Text string        `json:"text"`
+	Kind CandidateKind `json:"kind"`
+	// Type is the type of variables, constants and fields, the signature of
+	// funcs and methods, the kind of types, such as "struct", and the import
+	// path of packages. It's empty for builtins.
+	Type string `json:"type,omitempty"`
+	// Doc is the first sentence of the documentation of the candidate, if
+	// the source of its package can be found.
+	Doc string `json:"doc,omitempty"`
+	// Blocked is set for the candidates the Policy of the scope blocks.
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// detail describes c in completion listings, e.g. "field int" or
+// "method func() string". It's empty for builtins.
+func (c Candidate) detail() string {
+	var detail string
+	switch c.Kind {
+	case CandidateFunc, CandidateBuiltin:
+		detail = c.Type
+	default:
+		detail = strings.TrimSuffix(c.Kind.String(), "iable") + " " + c.Type
+	}
+	if c.Blocked {
+		detail += " (blocked)"
+	}
+	return strings.TrimSpace(detail)
+}
+
+// Complete returns the completion candidates for the identifier ending at
+// cursor in line, sorted, along with the byte offset where that identifier
+// starts. Accepting a candidate means replacing line[replaceFrom:cursor] with
+// its Text. The REPL completes with it on TAB and editors can complete
+// against a session with it, such as through Handler.
+//
+// Candidates come from the scope and the builtins or, after a dot, from the
+// fields and methods of the value before it. If nothing matches the typed
+// prefix case-sensitively, case-insensitive matches are returned. The value
+// before a dot is only evaluated if it's made of identifiers, selectors and
+// indexes, so completing never calls functions or has other side effects.
+func Complete(scope *Scope, line string, cursor int) (candidates []Candidate, replaceFrom int) {
+	if cursor > len(line) {
+		cursor = len(line)
+	}
+	start := identStart(line, cursor)
+	prefix := line[start:cursor]
+
+	// docOf returns where the documentation of a candidate is.
+	var docOf func(c Candidate) (path, symbol string, ok bool)
+	if start > 0 && line[start-1] == '.' {
+		v, ok := scope.evalReceiver(line[:start-1])
+		if !ok {
+			return nil, start
+		}
+		candidates = members(v)
+		docOf = memberDoc(v)
+		if pkg, ok := v.(Package); ok {
+			candidates = scope.currentPolicy().markBlocked(pkg, candidates)
+		}
+	} else {
+		for _, name := range scope.identCandidates() {
+			candidates = append(candidates, scope.identCandidate(name))
+		}
+		docOf = scope.identDoc
+	}
+
+	matches := filterCandidates(candidates, func(name string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+	if len(matches) == 0 {
+		lower := strings.ToLower(prefix)
+		matches = filterCandidates(candidates, func(name string) bool {
+			return strings.HasPrefix(strings.ToLower(name), lower)
+		})
+	}
+	// The variables of the scope come first, so they shadow the builtins of
+	// the same name.
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Text < matches[j].Text
+	})
+	out := matches[:0]
+	for i, c := range matches {
+		if i == 0 || c.Text != matches[i-1].Text {
+			if path, symbol, ok := docOf(c); ok {
+				c.Doc = docSummary(path, symbol)
+			}
+			out = append(out, c)
+		}
+	}
+	return out, start
+}
+
+// identCandidate describes the identifier name of scope.
+func (scope *Scope) identCandidate(name string) Candidate {
+	v, ok := scope.Get(name)
+	if !ok {
+		v, ok = scope.registeredValue(name)
+	}
+	if !ok {
+		if t, ok := loadRegisteredTypes()[name]; ok {
+			return Candidate{Text: name, Kind: CandidateType, Type: t.Kind().String()}
+		}
+		return Candidate{Text: name, Kind: CandidateBuiltin}
+	}
+	switch v := v.(type) {
+	case Package:
+		return Candidate{Text: name, Kind: CandidatePackage, Type: v.importPath(), Blocked: !scope.currentPolicy().allowsPackage(v)}
+	case reflect.Type:
+		return Candidate{Text: name, Kind: CandidateType, Type: v.Kind().String()}
+	case *Func:
+		return Candidate{Text: name, Kind: CandidateFunc, Type: v.signature()}
+	}
+	// Variables are described by the type they were declared with, such as
+	// error for var err error.
+	ptr, _ := scope.GetPointer(name)
+	typ := declaredType(ptr, v)
+	if typ == nil {
+		return Candidate{Text: name, Kind: CandidateVariable, Type: "nil"}
+	}
+	if typ.Kind() == reflect.Func {
+		return Candidate{Text: name, Kind: CandidateFunc, Type: typ.String()}
+	}
+	return Candidate{Text: name, Kind: CandidateVariable, Type: typ.String()}
+}
+
+// identDoc returns where the documentation of the identifier c of scope is:
+// that of packages and of the types registered from packages.
+func (scope *Scope) identDoc(c Candidate) (path, symbol string, ok bool) {
+	switch c.Kind {
+	case CandidatePackage:
+		v, _ := scope.Get(c.Text)
+		if pkg, ok := v.(Package); ok {
+			return pkg.importPath(), "", true
+		}
+	case CandidateType:
+		t, ok := loadRegisteredTypes()[c.Text]
+		if ok && len(t.PkgPath()) > 0 && len(t.Name()) > 0 {
+			return t.PkgPath(), t.Name(), true
+		}
+	}
+	return "", "", false
+}
+
+// memberDoc returns a func returning where the documentation of the members
+// of v is: that of the members of packages and of the methods of named types
+// of packages.
+func memberDoc(v interface{}) func(c Candidate) (path, symbol string, ok bool) {
+	if pkg, ok := v.(Package); ok {
+		return func(c Candidate) (string, string, bool) {
+			return pkg.importPath(), c.Text, true
+		}
+	}
+	typ := reflect.TypeOf(v)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return func(c Candidate) (string, string, bool) {
+		if c.Kind != CandidateMethod || len(typ.PkgPath()) == 0 || len(typ.Name()) == 0 {
+			return "", "", false
+		}
+		return typ.PkgPath(), typ.Name() + "." + c.Text, true
+	}
+}
+
+// filterCandidates returns the candidates whose names match.
+func filterCandidates(candidates []Candidate, match func(string) bool) []Candidate {
+	var out []Candidate
+	for _, c := range candidates {
+		if match(c.Text) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// evalReceiver evaluates the expression at the end of text. Only identifiers,
+// selectors and indexes are evaluated so completing never has side effects.
+func (scope *Scope) evalReceiver(text string) (v interface{}, ok bool) {
+	exprStr := receiverExpr(text)
+	if len(exprStr) == 0 {
+		return nil, false
+	}
+	expr, err := parser.ParseExpr(exprStr)
+	if err != nil || !isSafeExpr(expr) {
+		return nil, false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			v, ok = nil, false
+		}
+	}()
+	v, err = scope.Interpret(expr)
+	if err != nil || v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// receiverExpr returns the chain of identifiers, selectors and indexes at the
+// end of text.
+func receiverExpr(text string) string {
+	start := len(text)
+	for start > 0 {
+		switch text[start-1] {
+		case '.':
+			start--
+		case ']':
+			depth := 0
+			i := start - 1
+			for ; i >= 0; i-- {
+				if text[i] == ']' {
+					depth++
+				} else if text[i] == '[' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if i < 0 {
+				return ""
+			}
+			start = i
+		default:
+			identAt := identStart(text, start)
+			if identAt == start {
+				return text[start:]
+			}
+			start = identAt
+		}
+	}
+	return text[start:]
+}
+
+// isSafeExpr returns whether expr can be evaluated without side effects.
+func isSafeExpr(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		return isSafeExpr(e.X)
+	case *ast.IndexExpr:
+		return isSafeExpr(e.X) && (isSafeExpr(e.Index) || isBasicLit(e.Index))
+	}
+	return false
+}
+
+func isBasicLit(expr ast.Expr) bool {
+	_, ok := expr.(*ast.BasicLit)
+	return ok
+}
+
+// members returns the exported members of v. Packages list their registered
+// functions. Otherwise the fields, including those promoted from embedded
+// structs, and the methods, including those with pointer receivers, are
+// listed.
+func members(v interface{}) []Candidate {
+	if pkg, ok := v.(Package); ok {
+		return packageCandidates(pkg)
+	}
+
+	var out []Candidate
+	typ := reflect.TypeOf(v)
+	methodType := typ
+	if typ.Kind() != reflect.Ptr && typ.Kind() != reflect.Interface {
+		methodType = reflect.PtrTo(typ)
+	}
+	methods := reflect.Zero(methodType)
+	for i := 0; i < methodType.NumMethod(); i++ {
+		out = append(out, Candidate{
+			Text: methodType.Method(i).Name,
+			Kind: CandidateMethod,
+			Type: methods.Method(i).Type().String(),
+		})
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Struct {
+		for _, f := range structFields(typ) {
+			out = append(out, Candidate{Text: f.Name, Kind: CandidateField, Type: f.Type.String()})
+		}
+	}
+	return out
+}
+
+// packageCache holds the sorted member candidates of packages keyed by their
+// member maps, so large packages are only described once.
+var packageCache = struct {
+	sync.Mutex
+	entries map[packageCacheKey]packageCacheEntry
+}{entries: map[packageCacheKey]packageCacheEntry{}}
+
+type packageCacheKey struct {
+	functions, variables, consts, types, generics uintptr
+}
+
+type packageCacheEntry struct {
+	// size is the number of members when the entry was built, so members
+	// registered later invalidate it.
+	size    int
+	members []Candidate
+}
+
+// packageCandidates returns the sorted members of pkg. The result is shared
+// and must not be modified.
+func packageCandidates(pkg Package) []Candidate {
+	pkg = pkg.loaded()
+	key := packageCacheKey{
+		functions: reflect.ValueOf(pkg.Functions).Pointer(),
+		variables: reflect.ValueOf(pkg.Variables).Pointer(),
+		consts:    reflect.ValueOf(pkg.Consts).Pointer(),
+		types:     reflect.ValueOf(pkg.Types).Pointer(),
+		generics:  reflect.ValueOf(pkg.Generics).Pointer(),
+	}
+	size := len(pkg.Functions) + len(pkg.Variables) + len(pkg.Consts) + len(pkg.Types) + len(pkg.Generics)
+
+	packageCache.Lock()
+	defer packageCache.Unlock()
+
+	if entry, ok := packageCache.entries[key]; ok && entry.size == size {
+		return entry.members
+	}
+	keys := pkg.Keys()
+	members := make([]Candidate, 0, len(keys))
+	for _, name := range keys {
+		member, _ := pkg.Get(name)
+		c := describeMember(name, member)
+		if _, ok := pkg.Consts[name]; ok && c.Kind == CandidateVariable {
+			c.Kind = CandidateConst
+		}
+		members = append(members, c)
+	}
+	packageCache.entries[key] = packageCacheEntry{size: size, members: members}
+	return members
+}
+
+// describeMember describes the package member name.
+func describeMember(name string, member interface{}) Candidate {
+	typ := reflect.TypeOf(member)
+	if typ == nil {
+		return Candidate{Text: name, Kind: CandidateVariable}
+	}
+	if t, ok := member.(reflect.Type); ok {
+		return Candidate{Text: name, Kind: CandidateType, Type: t.Kind().String()}
+	}
+	if _, ok := member.(Generic); ok {
+		return Candidate{Text: name, Kind: CandidateFunc, Type: "generic"}
+	}
+	if typ.Kind() == reflect.Func {
+		return Candidate{Text: name, Kind: CandidateFunc, Type: typ.String()}
+	}
+	return Candidate{Text: name, Kind: CandidateVariable, Type: typ.String()}
+}
+
+// structFields returns the exported fields of typ including the ones promoted
+// from embedded structs. Shallower fields shadow deeper ones.
+func structFields(typ reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	seen := map[string]bool{}
+	visited := map[reflect.Type]bool{}
+	level := []reflect.Type{typ}
+	for len(level) > 0 {
+		var next []reflect.Type
+		names := map[string]bool{}
+		for _, t := range level {
+			if visited[t] {
+				continue
+			}
+			visited[t] = true
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				if f.Anonymous {
+					embedded := f.Type
+					if embedded.Kind() == reflect.Ptr {
+						embedded = embedded.Elem()
+					}
+					if embedded.Kind() == reflect.Struct {
+						next = append(next, embedded)
+					}
+				}
+				if f.PkgPath != "" || seen[f.Name] {
+					continue
+				}
+				names[f.Name] = true
+				fields = append(fields, f)
+			}
+		}
+		for name := range names {
+			seen[name] = true
+		}
+		level = next
+	}
+	return fields
+}
+
+// identStart returns the offset of the start of the identifier ending at
+// cursor.
+func identStart(line string, cursor int) int {
+	start := cursor
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:start])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		start -= size
+	}
+	return start
+}
+
+// builtinNames returns the predeclared identifiers the interpreter supports
+// and the types registered with RegisterNamedType.
+func builtinNames() []string {
+	var names []string
+	for _, name := range types.Universe.Names() {
+		if _, ok := builtinScope[name]; ok {
+			names = append(names, name)
+		} else if _, ok := builtinTypes[name]; ok {
+			names = append(names, name)
+		}
+	}
+	var registered []string
+	for name := range loadRegisteredTypes() {
+		registered = append(registered, name)
+	}
+	sort.Strings(registered)
+	return append(names, registered...)
+}
+
+// commonPrefix returns the longest common prefix of strs.
+func commonPrefix(strs []string) string {
+	if len(strs) == 0 {
+		return ""
+	}
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// formatCandidates renders candidates for display. Builtins are laid out in
+// columns; other candidates are listed one per line with their details.
+func formatCandidates(candidates []Candidate, width int) string {
+	var names []string
+	nameWidth := 0
+	annotated := false
+	for _, c := range candidates {
+		names = append(names, c.Text)
+		if l := stringWidth(c.Text); l > nameWidth {
+			nameWidth = l
+		}
+		annotated = annotated || len(c.detail()) > 0
+	}
+	if !annotated {
+		return formatColumns(names, width)
+	}
+
+	var b strings.Builder
+	for _, c := range candidates {
+		b.WriteString(c.Text)
+		if len(c.detail()) > 0 {
+			b.WriteString(strings.Repeat(" ", nameWidth-stringWidth(c.Text)+2))
+			b.WriteString(c.detail())
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatColumns lays out items in columns that fit within width.
+func formatColumns(items []string, width int) string {
+	maxLen := 0
+	for _, item := range items {
+		if l := stringWidth(item); l > maxLen {
+			maxLen = l
+		}
+	}
+	colWidth := maxLen + 2
+	cols := width / colWidth
+	if cols < 1 {
+		cols = 1
+	}
+	rows := (len(items) + cols - 1) / cols
+
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			i := col*rows + row
+			if i >= len(items) {
+				break
+			}
+			item := items[i]
+			b.WriteString(item)
+			if col < cols-1 && i+rows < len(items) {
+				b.WriteString(strings.Repeat(" ", colWidth-stringWidth(item)))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,308 @@
+package pry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// candidateTexts returns the texts of candidates.
+func candidateTexts(candidates []Candidate) []string {
+	var texts []string
+	for _, c := range candidates {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
+
+func TestComplete(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("fooBar", 1)
+	scope.Set("fooBaz", 2)
+	scope.Set("Format", 3)
+
+	cases := []struct {
+		line   string
+		cursor int
+		want   []string
+		start  int
+	}{
+		{"foo", 3, []string{"fooBar", "fooBaz"}, 0},
+		{"fooBar", 6, []string{"fooBar"}, 0},
+		{"a := foo + 1", 8, []string{"fooBar", "fooBaz"}, 5},
+		{"append(x, fooBa)", 15, []string{"fooBar", "fooBaz"}, 10},
+		{"appe", 4, []string{"append"}, 0},
+		{"strin", 5, []string{"string"}, 0},
+		{"FOOBAR", 6, []string{"fooBar"}, 0},
+		{"form", 4, []string{"Format"}, 0},
+		{"x.foo", 5, nil, 2},
+		{"zzz", 3, nil, 0},
+	}
+	for _, c := range cases {
+		candidates, start := Complete(scope, c.line, c.cursor)
+		if out := candidateTexts(candidates); !reflect.DeepEqual(out, c.want) || start != c.start {
+			t.Errorf("Complete(%q, %d) = %#v, %d; expected %#v, %d",
+				c.line, c.cursor, out, start, c.want, c.start)
+		}
+	}
+}
+
+type completeInner struct {
+	Promoted int
+	Shadowed string
+}
+
+func (completeInner) InnerMethod() {}
+
+type completeOuter struct {
+	completeInner
+	Name     string
+	Shadowed bool
+	hidden   int
+}
+
+func (completeOuter) Value() string       { return "" }
+func (*completeOuter) Pointer(x int) bool { return false }
+
+func TestCompleteMembers(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("resp", completeOuter{})
+	scope.Set("list", []completeOuter{{}})
+	scope.Set("strings", Package{
+		Name: "strings",
+		Functions: map[string]interface{}{
+			"Contains": strings.Contains,
+			"ToUpper":  strings.ToUpper,
+		},
+	})
+	calls := 0
+	scope.Set("f", func() completeOuter {
+		calls++
+		return completeOuter{}
+	})
+
+	cases := []struct {
+		line string
+		want []Candidate
+	}{
+		{"resp.", []Candidate{
+			{Text: "InnerMethod", Kind: CandidateMethod, Type: "func()"},
+			{Text: "Name", Kind: CandidateField, Type: "string"},
+			{Text: "Pointer", Kind: CandidateMethod, Type: "func(int) bool"},
+			{Text: "Promoted", Kind: CandidateField, Type: "int"},
+			{Text: "Shadowed", Kind: CandidateField, Type: "bool"},
+			{Text: "Value", Kind: CandidateMethod, Type: "func() string"},
+		}},
+		{"x := resp.P", []Candidate{
+			{Text: "Pointer", Kind: CandidateMethod, Type: "func(int) bool"},
+			{Text: "Promoted", Kind: CandidateField, Type: "int"},
+		}},
+		{"list[0].Na", []Candidate{{Text: "Name", Kind: CandidateField, Type: "string"}}},
+		{"strings.Con", []Candidate{{Text: "Contains", Kind: CandidateFunc, Type: "func(string, string) bool", Doc: "Contains reports whether substr is within s."}}},
+		{"f().Na", nil},
+		{"resp.hid", nil},
+	}
+	for _, c := range cases {
+		out, _ := Complete(scope, c.line, len(c.line))
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("Complete(%q) = %#v; expected %#v", c.line, out, c.want)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("Expected completion to not call functions; called %d times.", calls)
+	}
+}
+
+func TestCompletePackages(t *testing.T) {
+	t.Parallel()
+
+	functions := map[string]interface{}{
+		"Contains":     strings.Contains,
+		"ContainsAny":  strings.ContainsAny,
+		"ContainsRune": strings.ContainsRune,
+		"Count":        strings.Count,
+	}
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Functions: functions})
+	scope.Set("str", "")
+
+	candidates, start := Complete(scope, "strings.Con", 11)
+	out := candidateTexts(candidates)
+	want := []string{"Contains", "ContainsAny", "ContainsRune"}
+	if !reflect.DeepEqual(out, want) || start != 8 {
+		t.Errorf("Expected %#v, 8 got %#v, %d.", want, out, start)
+	}
+
+	completions, _ := Complete(scope, "strin", 5)
+	wantCompletions := []Candidate{{Text: "string", Kind: CandidateBuiltin}, {Text: "strings", Kind: CandidatePackage, Type: "strings", Doc: "Package strings implements simple functions to manipulate UTF-8 encoded strings."}}
+	if !reflect.DeepEqual(completions, wantCompletions) {
+		t.Errorf("Expected %#v got %#v.", wantCompletions, completions)
+	}
+
+	// Registering a member invalidates the cached list.
+	functions["Compare"] = strings.Compare
+	candidates, _ = Complete(scope, "strings.Co", 10)
+	out = candidateTexts(candidates)
+	want = []string{"Compare", "Contains", "ContainsAny", "ContainsRune", "Count"}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestReceiverExpr(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"a := foo":       "foo",
+		"foo.bar[1].baz": "foo.bar[1].baz",
+		"f(a, m[\"k\"]":  "m[\"k\"]",
+		"f()":            "",
+		"x]":             "",
+	}
+	for text, want := range cases {
+		if out := receiverExpr(text); out != want {
+			t.Errorf("receiverExpr(%q) = %q; expected %q", text, out, want)
+		}
+	}
+}
+
+func TestCompleteExcludesScope(t *testing.T) {
+	t.Parallel()
+
+	out, _ := Complete(NewScope(), "_pry", 4)
+	if len(out) != 0 {
+		t.Errorf("Expected no candidates got %#v.", out)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		strs []string
+		want string
+	}{
+		{[]string{"fooBar", "fooBaz"}, "fooBa"},
+		{[]string{"abc"}, "abc"},
+		{[]string{"abc", "xyz"}, ""},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		if out := commonPrefix(c.strs); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+}
+
+func TestFormatColumns(t *testing.T) {
+	t.Parallel()
+
+	out := formatColumns([]string{"a", "bb", "c", "d", "e"}, 9)
+	want := "a   d\nbb  e\nc\n"
+	if out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	out = formatCandidates([]Candidate{
+		{Text: "Name", Kind: CandidateField, Type: "string"},
+		{Text: "Do", Kind: CandidateMethod, Type: "func()"},
+		{Text: "Exit", Kind: CandidateFunc, Type: "func(int)", Blocked: true},
+	}, 80)
+	want = "Name  field string\nDo    method func()\nExit  func(int) (blocked)\n"
+	if out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+// completeFixture returns the scope TestCompleteFixture completes against.
+func completeFixture(t *testing.T) *Scope {
+	scope := NewScope()
+	scope.Set("strings", Package{
+		Name: "strings",
+		Functions: map[string]interface{}{
+			"Contains": strings.Contains,
+			"ToUpper":  strings.ToUpper,
+		},
+	})
+	scope.Set("resp", &completeOuter{Name: "x"})
+	scope.Set("items", []completeOuter{{}})
+	scope.Set("retries", 3)
+	scope.Set("point", reflect.TypeOf(completeInner{}))
+	if _, err := scope.InterpretString(`reset := func(n int) int { retries = n; return n }`); err != nil {
+		t.Fatal(err)
+	}
+	return scope
+}
+
+func TestCompleteFixture(t *testing.T) {
+	t.Parallel()
+
+	scope := completeFixture(t)
+	members := []Candidate{
+		{Text: "InnerMethod", Kind: CandidateMethod, Type: "func()"},
+		{Text: "Name", Kind: CandidateField, Type: "string"},
+		{Text: "Pointer", Kind: CandidateMethod, Type: "func(int) bool"},
+		{Text: "Promoted", Kind: CandidateField, Type: "int"},
+		{Text: "Shadowed", Kind: CandidateField, Type: "bool"},
+		{Text: "Value", Kind: CandidateMethod, Type: "func() string"},
+	}
+	reset := Candidate{Text: "reset", Kind: CandidateFunc, Type: "func(n int) int"}
+	resp := Candidate{Text: "resp", Kind: CandidateVariable, Type: "*pry.completeOuter"}
+	retries := Candidate{Text: "retries", Kind: CandidateVariable, Type: "int"}
+	point := Candidate{Text: "point", Kind: CandidateType, Type: "struct"}
+
+	line := `if re := resp.Val(); strings.Con(items[0].Na, re) { po := point{}; reset(ret) }`
+	cases := []struct {
+		prefix string
+		want   []Candidate
+		start  int
+	}{
+		{"if", nil, 0},
+		{"if re", []Candidate{reset, resp, retries}, 3},
+		{"if re := res", []Candidate{reset, resp}, 9},
+		{"if re := resp", []Candidate{resp}, 9},
+		{"if re := resp.", members, 14},
+		{"if re := resp.Val", members[5:], 14},
+		{"if re := resp.Val(); strings.", []Candidate{
+			{Text: "Contains", Kind: CandidateFunc, Type: "func(string, string) bool"},
+			{Text: "ToUpper", Kind: CandidateFunc, Type: "func(string) string"},
+		}, 29},
+		{"if re := resp.Val(); strings.Con", []Candidate{
+			{Text: "Contains", Kind: CandidateFunc, Type: "func(string, string) bool"},
+		}, 29},
+		{"if re := resp.Val(); strings.Con(items", []Candidate{
+			{Text: "items", Kind: CandidateVariable, Type: "[]pry.completeOuter"},
+		}, 33},
+		{"if re := resp.Val(); strings.Con(items[0].", members, 42},
+		{"if re := resp.Val(); strings.Con(items[0].Na", members[1:2], 42},
+		{"if re := resp.Val(); strings.Con(items[0].Na, re) { po", []Candidate{point}, 52},
+		{"if re := resp.Val(); strings.Con(items[0].Na, re) { po := point{}; reset(ret", []Candidate{retries}, 73},
+	}
+	for _, c := range cases {
+		if !strings.HasPrefix(line, c.prefix) {
+			t.Fatalf("%q isn't a prefix of the line", c.prefix)
+		}
+		out, start := Complete(scope, line, len(c.prefix))
+		// The summaries depend on the source of the packages being found.
+		for i := range out {
+			out[i].Doc = ""
+		}
+		if !reflect.DeepEqual(out, c.want) || start != c.start {
+			t.Errorf("%q: Expected %#v at %d got %#v at %d.", c.prefix, c.want, c.start, out, start)
+		}
+	}
+
+	// Completing after calls doesn't make them.
+	for _, line := range []string{"reset(1).", "resp.Value().", "items[reset(2)]."} {
+		if out, _ := Complete(scope, line, len(line)); len(out) != 0 {
+			t.Errorf("%q: Expected no candidates got %#v.", line, out)
+		}
+	}
+	if v, _ := scope.Get("retries"); v != 3 {
+		t.Errorf("Expected %#v got %#v.", 3, v)
+	}
+}
@@ -0,0 +1,594 @@
+package pry
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// defaultHistorySize is the number of history entries kept by default.
+const defaultHistorySize = 1000
+
+// defaultContextLines is the number of lines of source shown around the
+// breakpoint by default.
+const defaultContextLines = 5
+
+// defaultVarsValueWidth is the default width of values listed by :vars.
+const defaultVarsValueWidth = 40
+
+// Config holds the settings of an interactive pry session.
+type Config struct {
+	// HistoryFile is where the input history is persisted. An empty path
+	// disables persistence. In the browser this is the localStorage key.
+	HistoryFile string
+	// HistorySize is the maximum number of history entries kept. The oldest
+	// entries are evicted first. Zero means unlimited.
+	HistorySize int
+	// HistoryDedup is which repeated inputs the history drops. It keeps
+	// them all by default.
+	HistoryDedup HistoryDedup
+	// HistoryIgnore keeps the inputs it matches out of the history, such
+	// as those containing passwords, if it isn't nil.
+	HistoryIgnore *regexp.Regexp
+	// HistoryIgnoreSpace keeps the inputs starting with a space out of the
+	// history, as in bash.
+	HistoryIgnoreSpace bool
+	// Theme colors the input and output. It's NoColorTheme when the NO_COLOR
+	// environment variable or NoColor is set, or the output isn't a terminal.
+	Theme Theme
+	// NoColor disables colors whatever the theme.
+	NoColor bool
+	// Prompt renders the prompt.
+	Prompt PromptFunc
+	// ContinuationPrompt renders the prompt of the following lines of
+	// multi-line input.
+	ContinuationPrompt PromptFunc
+	// Indent is what the terminal editor indents the following lines of
+	// multi-line input with, for each bracket left open, a tab by default.
+	// Typing a closing bracket at the start of a line takes a level off. An
+	// empty Indent leaves the lines as they're typed.
+	Indent string
+	// LineNumbers prefixes the continuation prompts with the number of the
+	// line within its input, so the lines of parse errors are easy to find.
+	LineNumbers bool
+	// EditMode is the key bindings of the terminal editor, EditEmacs by
+	// default.
+	EditMode EditMode
+	// PagerThreshold is the number of rows a result can take up before it's
+	// paged. Zero uses the terminal height and a negative threshold disables
+	// paging. Output that isn't a terminal is never paged.
+	PagerThreshold int
+	// Pager is the command line of an external pager, such as "less -R". If
+	// it's empty the internal pager is used. It defaults to $PAGER.
+	Pager string
+	// Editor is the command line of the editor :edit opens, such as
+	// "code --wait". It defaults to $EDITOR, or vi if that's empty.
+	Editor string
+	// VarsValueWidth is the number of characters values listed by :vars are
+	// truncated to. Zero or less disables truncation.
+	VarsValueWidth int
+	// Timeout is how long the session waits for input before printing the
+	// scope and continuing the program. Zero or less waits forever. It
+	// defaults to the duration set by SetDefaultTimeout.
+	Timeout time.Duration
+	// ListenAddr, such as "localhost:2345" or "unix:" for a unix socket,
+	// makes the session wait for a connection on the address and run over it
+	// instead of the terminal. See ListenAndServe. It defaults to
+	// $PRY_LISTEN.
+	ListenAddr string
+	// AllowRemote allows ListenAddr to be reachable from other hosts. Without
+	// it only loopback addresses are accepted, since whoever connects can run
+	// code in the program.
+	AllowRemote bool
+	// ContextLines is the number of lines of source shown before and after
+	// the breakpoint.
+	ContextLines int
+	// ContinueIfBusy makes breakpoints reached while another one has the
+	// terminal continue straight away instead of waiting for their turn.
+	ContinueIfBusy bool
+	// Hooks observe the evaluations of the session. They're added to its
+	// scope while it runs.
+	Hooks []Hooks
+	// Limits are the guardrails of the evaluations of the session. They're
+	// unlimited by default.
+	Limits Limits
+	// Policy restricts the packages and functions the session can use.
+	// Everything is allowed by default.
+	Policy Policy
+	// InspectDepth is how deeply nested the values Inspect shows in full
+	// are, 3 by default. Deeper values are shown as "{…}". Zero or less is
+	// unlimited.
+	InspectDepth int
+	// InspectWidth is the width Inspect fits values into; wider ones are
+	// broken over several lines. Zero or less keeps values on one line.
+	InspectWidth int
+	// InspectMaxElems is the number of elements of slices, arrays and maps
+	// Inspect shows. Zero or less shows them all.
+	InspectMaxElems int
+	// InspectMaxString is the number of bytes of strings Inspect shows,
+	// 1024 by default. Longer ones are cut and end with how much is left
+	// out, like "… (+51234 bytes)". Zero or less shows them in full.
+	InspectMaxString int
+	// InspectBytes is how Inspect shows the bytes of []byte and [N]byte
+	// values, BytesHex by default.
+	InspectBytes BytesFormat
+	// InspectHumanize makes Inspect show integers of 1024 or more with the
+	// size they are as a number of bytes too, like 1048576 (1.0 MB).
+	InspectHumanize bool
+	// ShowObviousTypes makes the REPL show the type after results of the
+	// types Go constants default to, such as int and string, too.
+	ShowObviousTypes bool
+	// InspectRaw makes Inspect show values by their fields, ignoring the
+	// registered formatters and String and Error methods.
+	InspectRaw bool
+	// UndoLevels is the number of inputs :undo can take back, 20 by
+	// default. Zero or less disables it, which saves copying the variables
+	// before every input.
+	UndoLevels int
+	// Aliases are shortcuts for inputs, by name. Statements starting with
+	// the name of one are replaced by its template, in which %1 to %9 are
+	// the words after the name and %* all of them. See :alias.
+	Aliases map[string]string
+	// RCFile is the startup file of the REPL, where :alias --save keeps
+	// aliases. It's $GOPRY_RC, or .gopryrc in the home directory by
+	// default. Its lines run as if they were typed before the first prompt,
+	// followed by those of .gopryrc in the working directory, if there's
+	// one. Errors are shown and the session starts anyway.
+	RCFile string
+	// RecordFile is where the session is recorded from the start, as with
+	// :record, if it's set. RecordTimestamps starts the inputs of
+	// transcripts with the time they were typed.
+	RecordFile       string
+	RecordTimestamps bool
+	// NoRC skips the startup files. It's set by default when $GOPRY_NORC is
+	// true, as go-pry -no-rc does.
+	NoRC bool
+	// LineEditor reads the lines of the session. Sessions on a terminal edit
+	// them with the keys by default. See WithLineEditor.
+	LineEditor LineEditor
+
+	// lineInput makes sessions without a LineEditor read lines rather than
+	// keys, for input that isn't a terminal.
+	lineInput bool
+	// paste is how the terminal editor tells pasted text from typed text.
+	paste pasteMode
+	// queue is where breakpoints wait for the terminal.
+	queue *breakpointQueue
+}
+
+// defaultTimeout is the default Config.Timeout in nanoseconds.
+var defaultTimeout int64
+
+// SetDefaultTimeout sets the timeout of sessions that don't set one with
+// WithTimeout or PryWithTimeout. It's useful for programs that may run
+// unattended, such as in CI. Zero or less waits forever.
+func SetDefaultTimeout(d time.Duration) {
+	atomic.StoreInt64(&defaultTimeout, int64(d))
+}
+
+// disabled is set when breakpoints are skipped at runtime. It defaults to
+// $PRY_DISABLED.
+var disabled = func() int32 {
+	if off, _ := strconv.ParseBool(os.Getenv("PRY_DISABLED")); off {
+		return 1
+	}
+	return 0
+}()
+
+// noRC returns whether $GOPRY_NORC asks sessions to skip the startup files.
+func noRC() bool {
+	off, _ := strconv.ParseBool(os.Getenv("GOPRY_NORC"))
+	return off
+}
+
+// SetEnabled enables or disables every breakpoint. Disabled breakpoints log
+// that they were skipped and return immediately. It's for builds that can't
+// be rebuilt with -tags prynoop, which removes the breakpoints entirely.
+// Breakpoints are disabled by default when PRY_DISABLED is set to a true
+// value, such as 1.
+func SetEnabled(enabled bool) {
+	var v int32
+	if !enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&disabled, v)
+}
+
+// Enabled reports whether breakpoints open the REPL.
+func Enabled() bool {
+	return buildEnabled && atomic.LoadInt32(&disabled) == 0
+}
+
+// skipped reports whether the breakpoint at filePathRaw:lineNum is disabled
+// and logs that it was skipped.
+func skipped(filePathRaw string, lineNum int) bool {
+	if Enabled() {
+		return false
+	}
+	if buildEnabled {
+		log.Printf("pry breakpoint skipped at %s:%d", filepath.Base(filePathRaw), lineNum)
+	}
+	return true
+}
+
+// PromptInfo describes the state of the session for rendering the prompt.
+type PromptInfo struct {
+	// Counter is the number of the next input.
+	Counter int
+	// File and Line are where the session was started.
+	File string
+	Line int
+	// Goroutine is the ID of the goroutine running the session.
+	Goroutine int
+	// ScopeSize is the number of names in scope.
+	ScopeSize int
+	// BlockLine is the number of the line being read within its input,
+	// from 1. It's more than 1 for the following lines of multi-line input.
+	BlockLine int
+}
+
+// PromptFunc renders a prompt. The prompt may contain ANSI escape sequences.
+type PromptFunc func(PromptInfo) string
+
+// defaultPrompt renders prompts like "[3] go-pry> ".
+func defaultPrompt(info PromptInfo) string {
+	return fmt.Sprintf("[%d] go-pry> ", info.Counter)
+}
+
+// defaultContinuationPrompt renders the prompt "...> ".
+func defaultContinuationPrompt(info PromptInfo) string {
+	return "...> "
+}
+
+// Option configures a pry session.
+type Option func(*Config)
+
+// WithHistoryFile sets the path of the history file. An empty path disables
+// persistent history.
+func WithHistoryFile(path string) Option {
+	return func(c *Config) {
+		c.HistoryFile = path
+	}
+}
+
+// WithHistoryDedup sets which repeated inputs the history drops.
+func WithHistoryDedup(dedup HistoryDedup) Option {
+	return func(c *Config) {
+		c.HistoryDedup = dedup
+	}
+}
+
+// WithHistoryIgnore keeps the inputs re matches out of the history, such as
+// regexp.MustCompile("(?i)password|token").
+func WithHistoryIgnore(re *regexp.Regexp) Option {
+	return func(c *Config) {
+		c.HistoryIgnore = re
+	}
+}
+
+// WithHistoryIgnoreSpace keeps the inputs starting with a space out of the
+// history.
+func WithHistoryIgnoreSpace() Option {
+	return func(c *Config) {
+		c.HistoryIgnoreSpace = true
+	}
+}
+
+// WithHistorySize sets the maximum number of history entries kept.
+func WithHistorySize(size int) Option {
+	return func(c *Config) {
+		c.HistorySize = size
+	}
+}
+
+// WithTheme sets the syntax highlighting theme.
+func WithTheme(theme Theme) Option {
+	return func(c *Config) {
+		c.Theme = theme
+	}
+}
+
+// WithNoColor disables colors, so the output is plain text even on a
+// terminal.
+func WithNoColor() Option {
+	return func(c *Config) {
+		c.NoColor = true
+	}
+}
+
+// WithPrompt sets the function rendering the prompt.
+func WithPrompt(prompt PromptFunc) Option {
+	return func(c *Config) {
+		c.Prompt = prompt
+	}
+}
+
+// WithContinuationPrompt sets the function rendering the prompt of the
+// following lines of multi-line input.
+func WithContinuationPrompt(prompt PromptFunc) Option {
+	return func(c *Config) {
+		c.ContinuationPrompt = prompt
+	}
+}
+
+// WithLineNumbers prefixes the continuation prompts with the number of the
+// line within its input.
+func WithLineNumbers() Option {
+	return func(c *Config) {
+		c.LineNumbers = true
+	}
+}
+
+// WithIndent sets what the terminal editor indents the following lines of
+// multi-line input with for each bracket left open, such as four spaces. An
+// empty indent turns the indentation off.
+func WithIndent(indent string) Option {
+	return func(c *Config) {
+		c.Indent = indent
+	}
+}
+
+// WithEditMode sets the key bindings of the terminal editor, such as
+// EditVi.
+func WithEditMode(mode EditMode) Option {
+	return func(c *Config) {
+		c.EditMode = mode
+	}
+}
+
+// WithPagerThreshold sets the number of rows a result can take up before it's
+// paged. Zero uses the terminal height and a negative threshold disables
+// paging.
+func WithPagerThreshold(rows int) Option {
+	return func(c *Config) {
+		c.PagerThreshold = rows
+	}
+}
+
+// WithPager sets the command line of the external pager. An empty command
+// selects the internal pager.
+func WithPager(cmd string) Option {
+	return func(c *Config) {
+		c.Pager = cmd
+	}
+}
+
+// WithEditor sets the command line of the editor :edit opens, which is
+// given the path of the file to edit after its arguments.
+func WithEditor(cmd string) Option {
+	return func(c *Config) {
+		c.Editor = cmd
+	}
+}
+
+// WithVarsValueWidth sets the number of characters values listed by :vars
+// are truncated to.
+func WithVarsValueWidth(width int) Option {
+	return func(c *Config) {
+		c.VarsValueWidth = width
+	}
+}
+
+// WithTimeout sets how long the session waits for input before continuing
+// the program. Zero or less waits forever.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = d
+	}
+}
+
+// WithListenAddr makes the session run over a connection to addr, such as
+// "localhost:2345", instead of the terminal.
+func WithListenAddr(addr string) Option {
+	return func(c *Config) {
+		c.ListenAddr = addr
+	}
+}
+
+// WithAllowRemote allows the listen address to be reachable from other
+// hosts.
+func WithAllowRemote(allow bool) Option {
+	return func(c *Config) {
+		c.AllowRemote = allow
+	}
+}
+
+// WithContextLines sets the number of lines of source shown before and after
+// the breakpoint.
+func WithContextLines(n int) Option {
+	return func(c *Config) {
+		c.ContextLines = n
+	}
+}
+
+// WithContinueIfBusy makes the breakpoint continue instead of waiting when
+// another breakpoint has the terminal, which suits code paths many
+// goroutines go through.
+func WithContinueIfBusy(continueIfBusy bool) Option {
+	return func(c *Config) {
+		c.ContinueIfBusy = continueIfBusy
+	}
+}
+
+// WithHooks adds hooks observing the evaluations of the session, such as
+// JSONLogHooks for an audit trail.
+func WithHooks(h Hooks) Option {
+	return func(c *Config) {
+		c.Hooks = append(c.Hooks, h)
+	}
+}
+
+// WithLimits sets the guardrails of the evaluations of the session.
+func WithLimits(l Limits) Option {
+	return func(c *Config) {
+		c.Limits = l
+	}
+}
+
+// WithPolicy restricts the packages and functions the session can use, such
+// as with Policy{Deny: DefaultDeny}.
+func WithPolicy(p Policy) Option {
+	return func(c *Config) {
+		c.Policy = p
+	}
+}
+
+// WithInspectDepth sets how deeply nested the values shown in full are.
+func WithInspectDepth(depth int) Option {
+	return func(c *Config) {
+		c.InspectDepth = depth
+	}
+}
+
+// WithInspectWidth sets the width values are fitted into.
+func WithInspectWidth(width int) Option {
+	return func(c *Config) {
+		c.InspectWidth = width
+	}
+}
+
+// WithInspectMaxElems sets the number of elements of slices, arrays and maps
+// shown.
+func WithInspectMaxElems(n int) Option {
+	return func(c *Config) {
+		c.InspectMaxElems = n
+	}
+}
+
+// WithInspectMaxString sets the number of bytes of strings shown.
+func WithInspectMaxString(n int) Option {
+	return func(c *Config) {
+		c.InspectMaxString = n
+	}
+}
+
+// WithInspectBytes sets how the bytes of []byte and [N]byte values are
+// shown.
+func WithInspectBytes(f BytesFormat) Option {
+	return func(c *Config) {
+		c.InspectBytes = f
+	}
+}
+
+// WithInspectHumanize makes integers be shown with the size they are as a
+// number of bytes too, like 1048576 (1.0 MB).
+func WithInspectHumanize() Option {
+	return func(c *Config) {
+		c.InspectHumanize = true
+	}
+}
+
+// WithObviousTypes sets whether the REPL shows the type after results of
+// the types Go constants default to, such as 1 (int), which it leaves out
+// by default.
+func WithObviousTypes(show bool) Option {
+	return func(c *Config) {
+		c.ShowObviousTypes = show
+	}
+}
+
+// WithInspectRaw makes values be shown by their fields, even those with a
+// formatter or a String or Error method, and pointers by their address as
+// well, like (*int)(0xc000012345) &1.
+func WithInspectRaw() Option {
+	return func(c *Config) {
+		c.InspectRaw = true
+	}
+}
+
+// WithUndoLevels sets the number of inputs :undo can take back. Zero or less
+// disables it.
+func WithUndoLevels(levels int) Option {
+	return func(c *Config) {
+		c.UndoLevels = levels
+	}
+}
+
+// WithAlias defines the alias name, which replaces statements starting with
+// it by template, as :alias does.
+func WithAlias(name, template string) Option {
+	return func(c *Config) {
+		if c.Aliases == nil {
+			c.Aliases = map[string]string{}
+		}
+		c.Aliases[name] = template
+	}
+}
+
+// WithRCFile sets the path of the startup file of the REPL.
+func WithRCFile(path string) Option {
+	return func(c *Config) {
+		c.RCFile = path
+	}
+}
+
+// WithRecord makes the session be recorded to the file at path from the
+// start, as :record does. The file is appended to if it exists.
+func WithRecord(path string) Option {
+	return func(c *Config) {
+		c.RecordFile = path
+	}
+}
+
+// WithRecordTimestamps makes transcripts start each input with the time it
+// was typed.
+func WithRecordTimestamps() Option {
+	return func(c *Config) {
+		c.RecordTimestamps = true
+	}
+}
+
+// WithNoRC makes the session start without running the startup files.
+func WithNoRC() Option {
+	return func(c *Config) {
+		c.NoRC = true
+	}
+}
+
+// WithLineEditor makes the session read its lines with e rather than from the
+// terminal or REPL.In.
+func WithLineEditor(e LineEditor) Option {
+	return func(c *Config) {
+		c.LineEditor = e
+	}
+}
+
+// newConfig returns the default config with opts applied.
+func newConfig(opts ...Option) *Config {
+	c := &Config{
+		HistoryFile: defaultHistoryFile(),
+		RCFile:      defaultRCFile(),
+		HistorySize: defaultHistorySize,
+		Theme:       DefaultTheme,
+
+		Prompt:             defaultPrompt,
+		ContinuationPrompt: defaultContinuationPrompt,
+		Indent:             "\t",
+		Pager:              os.Getenv("PAGER"),
+		Editor:             os.Getenv("EDITOR"),
+		VarsValueWidth:     defaultVarsValueWidth,
+		Timeout:            time.Duration(atomic.LoadInt64(&defaultTimeout)),
+		ListenAddr:         os.Getenv("PRY_LISTEN"),
+		ContextLines:       defaultContextLines,
+		InspectDepth:       defaultInspectDepth,
+		InspectWidth:       defaultInspectWidth,
+		InspectMaxElems:    defaultInspectMaxElems,
+		InspectMaxString:   defaultInspectMaxString,
+		UndoLevels:         defaultUndoLevels,
+		NoRC:               noRC(),
+		queue:              terminalQueue,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	// See https://no-color.org.
+	if c.NoColor || os.Getenv("NO_COLOR") != "" {
+		c.Theme = NoColorTheme
+	}
+	return c
+}
@@ -0,0 +1,92 @@
+package pry
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+// needsContinuation returns whether src is incomplete and more lines should
+// be read before evaluating it. That's the case when brackets are left open,
+// a raw string or comment is unterminated, or the last token is a binary
+// operator, an assignment, a comma or a dot.
+func needsContinuation(src string) bool {
+	if len(strings.TrimSpace(src)) == 0 {
+		return false
+	}
+	depth, last, unterminated := scanInput(src)
+	if unterminated || depth > 0 {
+		return true
+	}
+	switch {
+	case last == token.COMMA, last == token.PERIOD:
+		return true
+	case last.Precedence() > 0:
+		return true
+	case last >= token.ADD_ASSIGN && last <= token.AND_NOT_ASSIGN,
+		last == token.ASSIGN, last == token.DEFINE:
+		return true
+	}
+	return false
+}
+
+// indentDepth returns the number of levels the line following src is
+// indented by: the number of brackets left open. It's 0 inside raw strings
+// and comments, whose lines are kept as they're typed.
+func indentDepth(src string) int {
+	depth, _, unterminated := scanInput(src)
+	if unterminated || depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+// blockLine returns the number of the line following pending, the previous
+// lines of the input, within it, from 1.
+func blockLine(pending string) int {
+	return strings.Count(pending, "\n") + 1
+}
+
+// numberLine returns prompt prefixed with the number of the line it reads.
+// The number is only shown, so it's never part of the input.
+func numberLine(prompt string, line int) string {
+	return fmt.Sprintf("%3d ", line) + prompt
+}
+
+// scanInput scans src, returning the number of brackets left open, the last
+// token that isn't an automatically inserted semicolon and whether a raw
+// string or comment is unterminated.
+func scanInput(src string) (depth int, last token.Token, unterminated bool) {
+	body := []byte(src)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(body))
+
+	var s scanner.Scanner
+	s.Init(file, body, func(_ token.Position, msg string) {
+		if msg == "raw string literal not terminated" || msg == "comment not terminated" {
+			unterminated = true
+		}
+	}, 0)
+
+	last = token.ILLEGAL
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.SEMICOLON:
+			// Automatically inserted semicolons don't end the input.
+			if lit != ";" {
+				continue
+			}
+		}
+		last = tok
+	}
+	return depth, last, unterminated
+}
@@ -0,0 +1,59 @@
+package pry
+
+import "testing"
+
+func TestNeedsContinuation(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want bool
+	}{
+		{"a := 1", false},
+		{"", false},
+		{"for i := 0; i < 10; i++ {", true},
+		{"for i := 0; i < 10; i++ {\na += i\n}", false},
+		{"f(1,", true},
+		{"a := []int{\n1,\n2,\n}", false},
+		{"a := 1 +", true},
+		{"ok := a &&", true},
+		{"a :=", true},
+		{"a.", true},
+		{"s := `raw\nstring", true},
+		{"s := `raw\nstring`", false},
+		{`s := "{"`, false},
+		{"s := '('", false},
+		{"a := 1 // {", false},
+		{"/* comment", true},
+		{"a := 1; b := 2;", false},
+		{")", false},
+		{`s := "unterminated`, false},
+	}
+	for _, c := range cases {
+		if out := needsContinuation(c.src); out != c.want {
+			t.Errorf("needsContinuation(%q) = %t; expected %t", c.src, out, c.want)
+		}
+	}
+}
+
+func TestIndentDepth(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want int
+	}{
+		{"", 0},
+		{"if a {\n", 1},
+		{"if a {\nfor {\n", 2},
+		{"f(g(\n", 2},
+		{"if a {\nx := `raw {\n", 0},
+		{"}\n", 0},
+		{"m := map[string]int{\n\"}\": 1,\n", 1},
+	}
+	for _, c := range cases {
+		if out := indentDepth(c.src); out != c.want {
+			t.Errorf("indentDepth(%q) = %d; expected %d", c.src, out, c.want)
+		}
+	}
+}
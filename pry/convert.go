@@ -0,0 +1,262 @@
+package pry
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"math"
+	"reflect"
+	"unicode/utf8"
+)
+
+// coerceAssign checks that the value r, produced by expr, can be stored in a
+// location of type typ. Untyped numeric literals are converted to typ when
+// they fit, mirroring Go's constant conversion rules.
+func coerceAssign(expr ast.Expr, r interface{}, typ reflect.Type) (interface{}, error) {
+	rType := reflect.TypeOf(r)
+	if rType == nil {
+		if v, ok := nilValue(typ); ok {
+			return v.Interface(), nil
+		}
+		return nil, &AssignError{Value: renderValue(expr), Expected: typ}
+	}
+	if rType.AssignableTo(typ) {
+		return r, nil
+	}
+	// Interpreted functions don't have a static signature.
+	if _, isFunc := r.(*Func); isFunc && typ.Kind() == reflect.Func {
+		return r, nil
+	}
+	if converted, ok := convertUntyped(expr, r, typ); ok {
+		return converted, nil
+	}
+	return nil, &AssignError{Value: renderValue(expr), Got: rType, Expected: typ, constant: expr != nil && isUntypedLiteral(expr)}
+}
+
+// assignValue is coerceAssign returning the value to store in the location
+// of type typ, such as an argument or an element. context is what the value
+// is used in for errors, such as "argument to f", an assignment if it's "".
+func assignValue(context string, expr ast.Expr, r interface{}, typ reflect.Type) (reflect.Value, error) {
+	v, err := coerceAssign(expr, r, typ)
+	if err != nil {
+		if assignErr, ok := err.(*AssignError); ok {
+			assignErr.Context = context
+		}
+		return reflect.Value{}, err
+	}
+	if v == nil {
+		// The nil of interface types.
+		return reflect.Zero(typ), nil
+	}
+	return reflect.ValueOf(v), nil
+}
+
+// nilValue returns the value the untyped nil takes as a typ: the zero value
+// of pointer, map, slice, channel, func and interface types. ok is false for
+// the other types, which nil can't be used as.
+func nilValue(typ reflect.Type) (v reflect.Value, ok bool) {
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface, reflect.UnsafePointer:
+		return reflect.Zero(typ), true
+	}
+	return reflect.Value{}, false
+}
+
+// renderValue renders an expression for use in error messages.
+func renderValue(expr ast.Expr) string {
+	if expr == nil {
+		return "value"
+	}
+	return types.ExprString(expr)
+}
+
+// isUntypedLiteral returns whether expr is a numeric or character literal,
+// optionally negated or parenthesized.
+func isUntypedLiteral(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return e.Kind == token.INT || e.Kind == token.FLOAT || e.Kind == token.CHAR
+	case *ast.UnaryExpr:
+		return (e.Op == token.SUB || e.Op == token.ADD) && isUntypedLiteral(e.X)
+	case *ast.ParenExpr:
+		return isUntypedLiteral(e.X)
+	}
+	return false
+}
+
+// untypedOperands converts the operand of the binary expression e that's an
+// untyped constant, such as the 2 of 2 * time.Second, to the type of the
+// other, x and y being their values.
+func untypedOperands(e *ast.BinaryExpr, x, y interface{}) (interface{}, interface{}) {
+	typeX, typeY := reflect.TypeOf(x), reflect.TypeOf(y)
+	if typeX == typeY || typeX == nil || typeY == nil || e.Op == token.SHL || e.Op == token.SHR {
+		return x, y
+	}
+	if converted, ok := convertUntyped(e.Y, y, typeX); ok {
+		return x, converted
+	}
+	if converted, ok := convertUntyped(e.X, x, typeY); ok {
+		return converted, y
+	}
+	return x, y
+}
+
+// convertUntyped converts v, the value of the untyped literal expr, to typ.
+// It returns false if expr isn't an untyped literal or the value doesn't fit.
+func convertUntyped(expr ast.Expr, v interface{}, typ reflect.Type) (interface{}, bool) {
+	if expr == nil || !isUntypedLiteral(expr) {
+		return nil, false
+	}
+	if reflect.TypeOf(v) == typ {
+		return v, true
+	}
+	rv := reflect.ValueOf(v)
+	var f float64
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int32:
+		f = float64(rv.Int())
+	case reflect.Float64:
+		f = rv.Float()
+	default:
+		return nil, false
+	}
+
+	out := reflect.New(typ).Elem()
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f != math.Trunc(f) || math.Abs(f) >= 1<<63 {
+			return nil, false
+		}
+		i := int64(f)
+		if rv.Kind() != reflect.Float64 {
+			i = rv.Int()
+		}
+		if out.OverflowInt(i) {
+			return nil, false
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if f != math.Trunc(f) || f < 0 || f >= 1<<64 {
+			return nil, false
+		}
+		u := uint64(f)
+		if rv.Kind() != reflect.Float64 {
+			u = uint64(rv.Int())
+		}
+		if out.OverflowUint(u) {
+			return nil, false
+		}
+		out.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if out.OverflowFloat(f) {
+			return nil, false
+		}
+		out.SetFloat(f)
+	case reflect.Complex64, reflect.Complex128:
+		out.SetComplex(complex(f, 0))
+	default:
+		return nil, false
+	}
+	return out.Interface(), true
+}
+
+// valueOf returns the reflect.Value of v, using the zero value of typ for nil.
+func valueOf(v interface{}, typ reflect.Type) reflect.Value {
+	if v == nil {
+		return reflect.Zero(typ)
+	}
+	return reflect.ValueOf(v)
+}
+
+// convert converts v, the value of expr, to typ, as typ(expr) does. Named
+// types, such as time.Duration, keep their methods.
+func (scope *Scope) convert(expr ast.Expr, v interface{}, typ reflect.Type) (interface{}, error) {
+	vType := reflect.TypeOf(v)
+	if vType == nil {
+		if nv, ok := nilValue(typ); ok {
+			return nv.Interface(), nil
+		}
+		return nil, &ConvertError{Value: "nil", Expected: typ}
+	}
+	if typ.Kind() == reflect.Interface {
+		// Converting to an interface keeps the value.
+		if err := newInterfaceError("conversion", v, typ); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if s, ok := scope.convertString(v, typ); ok {
+		return s, nil
+	}
+	if !vType.ConvertibleTo(typ) {
+		return nil, &ConvertError{Value: renderValue(expr), Got: vType, Expected: typ}
+	}
+	rv := reflect.ValueOf(v)
+	// Untyped float constants only convert to integers they're equal to,
+	// as in time.Duration(3e9).
+	if isUntypedLiteral(expr) && rv.Kind() == reflect.Float64 && isIntegerKind(typ.Kind()) && rv.Float() != math.Trunc(rv.Float()) {
+		return nil, &ConvertError{Value: renderValue(expr), Got: vType, Expected: typ, Truncated: true}
+	}
+	return rv.Convert(typ).Interface(), nil
+}
+
+// byteSliceType and runeSliceType are the types of []byte and []rune.
+var (
+	byteSliceType = reflect.TypeOf([]byte(nil))
+	runeSliceType = reflect.TypeOf([]rune(nil))
+)
+
+// convertString converts v to typ if it's one of the conversions between
+// strings, bytes and runes: []byte(s), []rune(s), string(bs), string(rs) and
+// string(r). Integers convert to the string of the rune they're the code
+// point of, or "\uFFFD" if they aren't one, like Go does; that's warned about
+// as go vet does unless their type is byte or rune. typ may be a named type of
+// any of these types; ok is false for the other conversions.
+func (scope *Scope) convertString(v interface{}, typ reflect.Type) (converted interface{}, ok bool) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, false
+	}
+	switch {
+	case typ.Kind() == reflect.String && rv.Kind() == reflect.String:
+		return rv.Convert(typ).Interface(), true
+
+	case typ.Kind() == reflect.String && rv.Type().ConvertibleTo(byteSliceType) && rv.Kind() == reflect.Slice:
+		s := string(rv.Convert(byteSliceType).Interface().([]byte))
+		return reflect.ValueOf(s).Convert(typ).Interface(), true
+
+	case typ.Kind() == reflect.String && rv.Type().ConvertibleTo(runeSliceType) && rv.Kind() == reflect.Slice:
+		s := string(rv.Convert(runeSliceType).Interface().([]rune))
+		return reflect.ValueOf(s).Convert(typ).Interface(), true
+
+	case typ.Kind() == reflect.String && isIntegerKind(rv.Kind()):
+		if k := rv.Kind(); k != reflect.Uint8 && k != reflect.Int32 {
+			scope.warn("conversion from %s to %s yields a string of one rune, not a string of digits (did you mean fmt.Sprint(x)?)", rv.Type(), typ)
+		}
+		r := utf8.RuneError
+		switch {
+		case rv.Kind() >= reflect.Int && rv.Kind() <= reflect.Int64:
+			if n := rv.Int(); n >= 0 && n <= utf8.MaxRune {
+				r = rune(n)
+			}
+		default:
+			if n := rv.Uint(); n <= utf8.MaxRune {
+				r = rune(n)
+			}
+		}
+		// Surrogate halves aren't valid runes and encode as RuneError.
+		return reflect.ValueOf(string(r)).Convert(typ).Interface(), true
+
+	case rv.Kind() == reflect.String && byteSliceType.ConvertibleTo(typ):
+		return reflect.ValueOf([]byte(rv.String())).Convert(typ).Interface(), true
+
+	case rv.Kind() == reflect.String && runeSliceType.ConvertibleTo(typ):
+		return reflect.ValueOf([]rune(rv.String())).Convert(typ).Interface(), true
+	}
+	return nil, false
+}
+
+// isIntegerKind returns whether k is the kind of an integer type.
+func isIntegerKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Uintptr
+}
@@ -0,0 +1,144 @@
+package pry
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSuggestions is the maximum number of "did you mean" candidates offered.
+const maxSuggestions = 3
+
+// didYouMean returns a hint suggesting which of the candidates the user may
+// have meant when typing name. It returns an empty string if none of the
+// candidates are close enough.
+func didYouMean(name string, candidates []string) string {
+	seen := map[string]bool{}
+	buckets := map[int][]string{}
+	for _, c := range candidates {
+		if c == name || seen[c] {
+			continue
+		}
+		seen[c] = true
+		if strings.EqualFold(c, name) {
+			return "; did you mean " + c + "? (identifiers are case-sensitive)"
+		}
+		l := utf8.RuneCountInString(c)
+		buckets[l] = append(buckets[l], c)
+	}
+
+	type match struct {
+		name string
+		dist int
+	}
+	var matches []match
+	length := utf8.RuneCountInString(name)
+	maxDist := maxEditDistance(length)
+	for l := length - maxDist; l <= length+maxDist; l++ {
+		for _, c := range buckets[l] {
+			if d := editDistance(name, c); d <= maxDist {
+				matches = append(matches, match{c, d})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].name < matches[j].name
+	})
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+
+	hint := "; did you mean "
+	for i, m := range matches {
+		if i > 0 && i == len(matches)-1 {
+			hint += " or "
+		} else if i > 0 {
+			hint += ", "
+		}
+		hint += m.name
+	}
+	return hint + "?"
+}
+
+// maxEditDistance returns how many edits a candidate may be away from a name
+// of the given length and still be suggested.
+func maxEditDistance(length int) int {
+	d := length/4 + 1
+	if d > 3 {
+		d = 3
+	}
+	return d
+}
+
+// editDistance computes the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// identCandidates returns every identifier visible from the scope, including
+// the registered and predeclared builtins.
+func (scope *Scope) identCandidates() []string {
+	var candidates []string
+	for _, k := range scope.Keys() {
+		if k != "_pryScope" {
+			candidates = append(candidates, k)
+		}
+	}
+	candidates = append(candidates, scope.registeredNames()...)
+	return append(candidates, builtinNames()...)
+}
+
+// memberCandidates returns the exported fields and methods of v.
+func memberCandidates(v reflect.Value) []string {
+	var candidates []string
+	typ := v.Type()
+	for i := 0; i < typ.NumMethod(); i++ {
+		candidates = append(candidates, typ.Method(i).Name)
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Struct {
+		for i := 0; i < typ.NumField(); i++ {
+			if f := typ.Field(i); f.PkgPath == "" {
+				candidates = append(candidates, f.Name)
+			}
+		}
+	}
+	return candidates
+}
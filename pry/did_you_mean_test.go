@@ -0,0 +1,93 @@
+package pry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDidYouMean(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"lne", []string{"line", "foo"}, "; did you mean line?"},
+		{"Len", []string{"len", "Lens"}, "; did you mean len? (identifiers are case-sensitive)"},
+		{"abcd", []string{"abce", "abcf", "abdd", "abzz", "xyz"}, "; did you mean abce, abcf or abdd?"},
+		{"banana", []string{"apple", "orange"}, ""},
+		{"x", nil, ""},
+	}
+	for _, c := range cases {
+		out := didYouMean(c.name, c.candidates)
+		if out != c.want {
+			t.Errorf("didYouMean(%q, %v) = %q; expected %q", c.name, c.candidates, out, c.want)
+		}
+	}
+}
+
+func TestDidYouMeanManyKeys(t *testing.T) {
+	t.Parallel()
+
+	var candidates []string
+	for i := 0; i < 5000; i++ {
+		candidates = append(candidates, strings.Repeat("x", i%50)+"key")
+	}
+	candidates = append(candidates, "line")
+	out := didYouMean("lime", candidates)
+	if out != "; did you mean line?" {
+		t.Errorf("expected line to be suggested; got %q", out)
+	}
+}
+
+func TestMissingIdentSuggestion(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("line", 5)
+	child := scope.NewChild().NewChild()
+	_, err := child.InterpretString(`lne`)
+	if err == nil || !strings.Contains(err.Error(), "did you mean line?") {
+		t.Errorf("expected suggestion for line; got %v", err)
+	}
+
+	_, err = scope.InterpretString(`Len("foo")`)
+	if err == nil || !strings.Contains(err.Error(), "did you mean len? (identifiers are case-sensitive)") {
+		t.Errorf("expected case-sensitive hint for len; got %v", err)
+	}
+}
+
+type suggestionStruct struct {
+	Name   string
+	hidden int
+}
+
+func (suggestionStruct) Greet() string { return "hi" }
+
+func TestMissingFieldSuggestion(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("a", suggestionStruct{})
+	_, err := scope.InterpretString(`a.Nme`)
+	if err == nil || !strings.Contains(err.Error(), "did you mean Name?") {
+		t.Errorf("expected suggestion for Name; got %v", err)
+	}
+
+	_, err = scope.InterpretString(`a.greet`)
+	if err == nil || !strings.Contains(err.Error(), "did you mean Greet? (identifiers are case-sensitive)") {
+		t.Errorf("expected case-sensitive hint for Greet; got %v", err)
+	}
+
+	_, err = scope.InterpretString(`a.hidden`)
+	if err == nil || !strings.Contains(err.Error(), "is unexported") {
+		t.Errorf("expected unexported field error; got %v", err)
+	}
+
+	scope.Set("pkg", Package{Name: "fmt", Functions: map[string]interface{}{"Println": 1}})
+	_, err = scope.InterpretString(`pkg.Prinln`)
+	if err == nil || !strings.Contains(err.Error(), "did you mean Println?") {
+		t.Errorf("expected suggestion for Println; got %v", err)
+	}
+}
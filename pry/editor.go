@@ -0,0 +1,430 @@
+package pry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mgutz/ansi"
+	"github.com/pkg/errors"
+)
+
+// LineEditor reads the lines of a session. Sessions on a terminal edit them
+// with the keys, with history, completion and highlighting; other editors let
+// the REPL run in other frontends, such as a browser, an IDE or a test.
+type LineEditor interface {
+	// ReadLine shows prompt and returns the line entered, without its line
+	// ending. It returns ErrLineAborted if the line is abandoned, ErrContinue
+	// if the user leaves the session and io.EOF once the input ends.
+	ReadLine(prompt string) (string, error)
+	// AddHistory adds an entered line to the history. Sessions add the lines
+	// of the history file when they start.
+	AddHistory(line string)
+	// SetCompleter sets what completes the line being edited.
+	SetCompleter(c Completer)
+	// Close releases the editor. Sessions don't close the editors they're
+	// given, so an editor can be used by several breakpoints.
+	Close() error
+}
+
+var (
+	// ErrLineAborted is returned by ReadLine when the line being edited is
+	// abandoned, as with Ctrl-C. The session drops incomplete multi-line
+	// input and reads the next line.
+	ErrLineAborted = errors.New("line aborted")
+	// ErrContinue is returned by ReadLine when the user leaves the session,
+	// as with Ctrl-D, and the program continues.
+	ErrContinue = errors.New("continue")
+)
+
+// Completer returns the completion candidates for the identifier ending at
+// cursor in line, along with the byte offset where that identifier starts,
+// as Complete does.
+type Completer func(line string, cursor int) (candidates []Candidate, replaceFrom int)
+
+// scopeCompleter completes identifiers of scope with Complete.
+func scopeCompleter(scope *Scope) Completer {
+	return func(line string, cursor int) ([]Candidate, int) {
+		return Complete(scope, line, cursor)
+	}
+}
+
+// NewReaderEditor returns an editor reading lines from r, such as a pipe or a
+// file of statements, and writing the prompts to out. Lines end with "\n",
+// "\r\n" or "\r". It has no history or completion, and closing it doesn't
+// close r.
+func NewReaderEditor(r io.Reader, out io.Writer) LineEditor {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return newReaderEditor(readerTTY{br}, out)
+}
+
+func newReaderEditor(r genericTTY, out io.Writer) *readerEditor {
+	return &readerEditor{r: r, out: out}
+}
+
+// readerEditor reads lines from a stream that isn't a terminal. The lines are
+// written after the prompts, since nothing else echoes them.
+type readerEditor struct {
+	r   genericTTY
+	out io.Writer
+	// afterCR is set when the last line ended with "\r", so a "\n" following
+	// it doesn't end another line.
+	afterCR bool
+	// err is the error that ended a last line without a line ending.
+	err error
+}
+
+func (e *readerEditor) ReadLine(prompt string) (string, error) {
+	if e.err != nil {
+		return "", e.err
+	}
+	fmt.Fprint(e.out, prompt)
+	var line strings.Builder
+	for {
+		r, _, err := e.r.ReadRune()
+		if err != nil {
+			if line.Len() == 0 {
+				fmt.Fprintln(e.out)
+				return "", err
+			}
+			e.err = err
+			fmt.Fprintln(e.out, line.String())
+			return line.String(), nil
+		}
+		afterCR := e.afterCR
+		e.afterCR = r == '\r'
+		switch {
+		case r == '\n' && afterCR && line.Len() == 0:
+		case r == '\n' || r == '\r':
+			fmt.Fprintln(e.out, line.String())
+			return line.String(), nil
+		default:
+			line.WriteRune(r)
+		}
+	}
+}
+
+// AddHistory does nothing; lines read from a stream can't be recalled.
+func (e *readerEditor) AddHistory(line string) {}
+
+// SetCompleter does nothing; lines read from a stream aren't completed.
+func (e *readerEditor) SetCompleter(c Completer) {}
+
+// Close does nothing; the stream belongs to whoever started the session.
+func (e *readerEditor) Close() error {
+	return nil
+}
+
+// terminalEditor edits lines with the keys read from a terminal. It redraws
+// the line as it's edited, highlighted and with the suggestions below it.
+type terminalEditor struct {
+	out io.Writer
+	tty genericTTY
+	// highlight colors the line for display. The line is shown as it is if
+	// it's nil.
+	highlight func(line string) string
+	// suggest returns the suggestions shown below the line, if it's set.
+	suggest   func(line string, cursor int) ([]string, error)
+	completer Completer
+	history   []string
+	// paste is how pasted text is told from typed text. Pasted line
+	// endings are kept in the line, so a pasted block only runs, as a
+	// whole, once ENTER is pressed.
+	paste pasteMode
+	// indent is what each level of indentation is made of, and depth the
+	// number of levels the next line starts with. Lines aren't indented if
+	// indent is empty.
+	indent string
+	depth  int
+	// mode returns the key bindings lines are edited with, which can
+	// change between lines. They're those of emacs if it's nil.
+	mode func() EditMode
+	// normalMark is shown before the prompt in vi normal mode.
+	normalMark string
+	// killed is the text last cut, which Ctrl-Y pastes.
+	killed string
+}
+
+// autoIndenter is a LineEditor indenting the lines of multi-line input.
+type autoIndenter interface {
+	// indentNext makes the next line start indented by depth levels.
+	indentNext(depth int)
+}
+
+func (e *terminalEditor) indentNext(depth int) {
+	e.depth = depth
+}
+
+func newTerminalEditor(out io.Writer, tty genericTTY) *terminalEditor {
+	return &terminalEditor{out: out, tty: tty, normalMark: "N "}
+}
+
+func (e *terminalEditor) AddHistory(line string) {
+	e.history = append(e.history, line)
+}
+
+// historyReplacer is a LineEditor whose history can be replaced, so it drops
+// the inputs the history rules dropped from the history store too.
+type historyReplacer interface {
+	setHistory(records []string)
+}
+
+func (e *terminalEditor) setHistory(records []string) {
+	e.history = append([]string(nil), records...)
+}
+
+func (e *terminalEditor) SetCompleter(c Completer) {
+	e.completer = c
+}
+
+// Close does nothing; the TTY belongs to whoever opened it.
+func (e *terminalEditor) Close() error {
+	return nil
+}
+
+// ReadLine edits a line until ENTER is pressed, with the key bindings of the
+// edit mode. Up and Down recall the history, Ctrl-R searches it and TAB
+// completes the identifier before the cursor. The line starts indented as
+// indentNext asked, and closing brackets typed at its start take a level
+// off.
+func (e *terminalEditor) ReadLine(prompt string) (string, error) {
+	if e.paste == pasteBracketed {
+		fmt.Fprint(e.out, bracketedPasteOn)
+		defer fmt.Fprint(e.out, bracketedPasteOff)
+	}
+	s := &lineState{line: strings.Repeat(e.indent, e.depth), historyPos: len(e.history)}
+	s.index = len(s.line)
+	e.depth = 0
+	// escape holds the escape sequence being read, such as "\033[" of an
+	// arrow key, and beforeEscape the state before its ESC, which may
+	// have switched to vi normal mode.
+	escape := ""
+	var beforeEscape lineState
+	// pasting is set between the escape sequences around pasted text.
+	pasting := false
+	for {
+		if s.search.active {
+			fmt.Fprintf(e.out, "\r\033[K%s\033[0J", s.search.prompt(e.history))
+		} else {
+			highlighted := s.line
+			if e.highlight != nil {
+				highlighted = e.highlight(s.line)
+			}
+			// Multi-line history records are shown on a single line.
+			highlighted = strings.Replace(highlighted, "\n", "⏎", -1)
+			linePrompt := prompt
+			if s.normal {
+				linePrompt = e.normalMark + prompt
+			}
+			fmt.Fprintf(e.out, "\r\033[K%s%s \033[0J\033[%dD", linePrompt, highlighted, lineWidth(s.line[s.index:])+1)
+			e.displaySuggestions(s.line, s.index, visibleWidth(linePrompt)+lineWidth(s.line[:s.index]))
+		}
+
+		r, err := e.readRune()
+		if err != nil {
+			return "", err
+		}
+		s.afterCR = s.r == '\r'
+		s.r = r
+
+		key := keyName(r)
+		if len(escape) > 0 {
+			if escape == "\033" && r != '[' {
+				// ESC followed by a plain key is the key with Alt.
+				escape = ""
+				if !s.normal {
+					key = "alt-" + key
+				}
+			} else {
+				if escape == "\033" {
+					*s = beforeEscape
+					s.r = r
+				}
+				escape += string(r)
+				// Sequences end with a byte in @ to ~, after the
+				// parameters.
+				if len(escape) > 2 && r >= '@' && r <= '~' {
+					seq := escape
+					escape = ""
+					switch seq {
+					case bracketedPasteStart:
+						if s.search.active {
+							s.line = s.search.accept(e.history)
+							s.index = len(s.line)
+						}
+						pasting = true
+					case bracketedPasteEnd:
+						pasting = false
+						// The line ending pasted blocks usually end
+						// with is left to ENTER.
+						for s.index > 0 && s.line[s.index-1] == '\n' {
+							s.line = s.line[:s.index-1] + s.line[s.index:]
+							s.index--
+						}
+					default:
+						if name, ok := escapeKeys[seq]; ok && !s.search.active {
+							if err := e.handleKey(s, name); err != nil {
+								return e.endLine(s, err)
+							}
+						}
+					}
+				}
+				continue
+			}
+		}
+
+		if pasting && r != 27 {
+			s.line, s.index = insertPasted(s.line, s.index, r, s.afterCR)
+			continue
+		}
+
+		if s.search.active {
+			switch r {
+			case 18: // Ctrl-R
+				s.search.next(e.history)
+				continue
+			case 7, 27: // Ctrl-G, ESC
+				s.line, s.index = s.search.cancel()
+				if r == 27 {
+					escape = "\033"
+					beforeEscape = *s
+				}
+				continue
+			case 127, '\b': // Backspace
+				s.search.backspace(e.history)
+				continue
+			default:
+				if r >= 32 {
+					s.search.add(r, e.history)
+					continue
+				}
+				// Any other control key accepts the match and is handled
+				// as usual, so ENTER runs it.
+				s.line = s.search.accept(e.history)
+				s.index = len(s.line)
+			}
+		}
+
+		if r == 27 {
+			// ESC starts the escape sequences of special keys, and in vi
+			// insert mode switches to normal mode unless it does.
+			escape = "\033"
+			beforeEscape = *s
+		}
+		if err := e.handleKey(s, key); err != nil {
+			return e.endLine(s, err)
+		}
+	}
+}
+
+// endLine ends the line being edited with the error err of a key action.
+func (e *terminalEditor) endLine(s *lineState, err error) (string, error) {
+	if err != errLineDone {
+		return "", err
+	}
+	fmt.Fprintln(e.out, "\033[100000C\033[0J")
+	return s.line, nil
+}
+
+// insertPasted inserts the pasted key r into line at index, returning the
+// line and the index after it. Line endings become "\n", "\r\n" included,
+// and control keys other than TAB are dropped.
+func insertPasted(line string, index int, r rune, afterCR bool) (string, int) {
+	switch {
+	case r == '\n' && afterCR:
+		return line, index
+	case r == '\r':
+		r = '\n'
+	case r < 32 && r != '\t' && r != '\n':
+		return line, index
+	}
+	return line[:index] + string(r) + line[index:], index + utf8.RuneLen(r)
+}
+
+// lineWidth returns the number of columns the part s of the line being edited
+// takes up, with its newlines shown as ⏎.
+func lineWidth(s string) int {
+	return stringWidth(strings.Replace(s, "\n", "⏎", -1))
+}
+
+// readRune reads the next key, skipping NULs.
+func (e *terminalEditor) readRune() (rune, error) {
+	for {
+		r, _, err := e.tty.ReadRune()
+		if err != nil || r != 0 {
+			return r, err
+		}
+	}
+}
+
+// complete completes the identifier before the cursor. Ambiguous
+// completions are extended to their longest common prefix and, if that
+// doesn't add anything, listed below the prompt.
+func (e *terminalEditor) complete(line string, index int) (string, int) {
+	if e.completer == nil {
+		return line, index
+	}
+	completions, start := e.completer(line, index)
+	if len(completions) == 0 {
+		return line, index
+	}
+	var candidates []string
+	for _, c := range completions {
+		candidates = append(candidates, c.Text)
+	}
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 || len(prefix) > index-start {
+		return line[:start] + prefix + line[index:], start + len(prefix)
+	}
+
+	termWidth, _, err := e.tty.Size()
+	if err != nil || termWidth <= 0 {
+		termWidth = 80
+	}
+	list := formatCandidates(completions, termWidth)
+	fmt.Fprint(e.out, "\033[100000C\033[0J\n"+strings.Replace(list, "\n", "\r\n", -1))
+	return line, index
+}
+
+// displaySuggestions renders the live suggestions below the line.
+func (e *terminalEditor) displaySuggestions(line string, index, promptWidth int) {
+	if e.suggest == nil {
+		return
+	}
+	suggestions, err := e.suggest(line, index)
+	if err != nil {
+		suggestions = []string{"ERR", err.Error()}
+	}
+
+	maxLength := 0
+	if len(suggestions) > 10 {
+		suggestions = suggestions[:10]
+	}
+	for _, term := range suggestions {
+		if w := stringWidth(term); w > maxLength {
+			maxLength = w
+		}
+	}
+	termWidth, _, _ := e.tty.Size()
+	for _, term := range suggestions {
+		paddedTerm := term + strings.Repeat(" ", maxLength-stringWidth(term))
+		var leftPadding string
+		for i := 0; i < promptWidth; i++ {
+			leftPadding += " "
+		}
+		if promptWidth > termWidth {
+			return
+		} else if stringWidth(paddedTerm)+promptWidth > termWidth {
+			paddedTerm = truncateWidth(paddedTerm, termWidth-promptWidth)
+		}
+		fmt.Fprintf(e.out, "\n%s%s\033[%dD", leftPadding, ansi.Color(paddedTerm, "white+b:magenta"), stringWidth(paddedTerm))
+	}
+	if len(suggestions) > 0 {
+		fmt.Fprintf(e.out, "\033[%dA", len(suggestions))
+	}
+}
@@ -0,0 +1,365 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scriptedEditor is a LineEditor returning the lines of a script in turn,
+// then io.EOF. It records what the session gives it.
+type scriptedEditor struct {
+	script    []scriptedLine
+	prompts   []string
+	history   []string
+	completer Completer
+	closed    bool
+}
+
+// scriptedLine is a line of a scriptedEditor, or the error ReadLine returns
+// instead.
+type scriptedLine struct {
+	line string
+	err  error
+}
+
+func (e *scriptedEditor) ReadLine(prompt string) (string, error) {
+	e.prompts = append(e.prompts, prompt)
+	if len(e.script) == 0 {
+		return "", io.EOF
+	}
+	next := e.script[0]
+	e.script = e.script[1:]
+	return next.line, next.err
+}
+
+func (e *scriptedEditor) AddHistory(line string) {
+	e.history = append(e.history, line)
+}
+
+func (e *scriptedEditor) SetCompleter(c Completer) {
+	e.completer = c
+}
+
+func (e *scriptedEditor) Close() error {
+	e.closed = true
+	return nil
+}
+
+func TestREPLLineEditor(t *testing.T) {
+	t.Parallel()
+
+	editor := &scriptedEditor{script: []scriptedLine{
+		{line: "a := 20"},
+		{line: "b := a +"},
+		{err: ErrLineAborted},
+		{line: "a + 1"},
+		{line: "fn := func() int {"},
+		{line: "return 2 }"},
+		{line: ""},
+		{line: "fn() * a"},
+		{err: ErrContinue},
+		{line: "unreachable"},
+	}}
+	var out bytes.Buffer
+	repl := &REPL{Out: &out, Options: []Option{WithHistoryFile(""), WithLineEditor(editor)}}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput(t, out.String(), "=> 21\n", "=> 40\n")
+
+	wantPrompts := []string{
+		"[0] go-pry> ", "[1] go-pry> ", "...> ", "[1] go-pry> ",
+		"[2] go-pry> ", "...> ", "[3] go-pry> ", "[3] go-pry> ", "[4] go-pry> ",
+	}
+	if !reflect.DeepEqual(editor.prompts, wantPrompts) {
+		t.Errorf("Expected %#v got %#v.", wantPrompts, editor.prompts)
+	}
+	wantHistory := []string{"a := 20", "a + 1", "fn := func() int {\nreturn 2 }", "fn() * a"}
+	if !reflect.DeepEqual(editor.history, wantHistory) {
+		t.Errorf("Expected %#v got %#v.", wantHistory, editor.history)
+	}
+	if _, ok := repl.Scope.Get("b"); ok {
+		t.Errorf("Expected the aborted input not to run.")
+	}
+	// The editor belongs to whoever gave it.
+	if editor.closed {
+		t.Errorf("Expected the editor not to be closed.")
+	}
+
+	// The completer completes the identifiers of the scope.
+	completions, start := editor.completer("x := fn", 7)
+	if want := []Candidate{{Text: "fn", Kind: CandidateFunc, Type: "func() int"}}; !reflect.DeepEqual(completions, want) || start != 5 {
+		t.Errorf("Expected %#v at 5 got %#v at %d.", want, completions, start)
+	}
+}
+
+func TestREPLLineNumbers(t *testing.T) {
+	t.Parallel()
+
+	script := []string{
+		"fn := func(n int) int {",
+		"m := n *",
+		"2",
+		"return m }",
+		"fn(3)",
+		"if true {",
+		"x := 1",
+		"x x",
+		"}",
+		":set linenumbers off",
+		"[]int{",
+		"1,",
+		"}",
+	}
+	editor := &scriptedEditor{}
+	for _, line := range script {
+		editor.script = append(editor.script, scriptedLine{line: line})
+	}
+	var out bytes.Buffer
+	repl := &REPL{Out: &out, Options: []Option{WithHistoryFile(""), WithLineEditor(editor), WithLineNumbers()}}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The parse error is on the line numbered 3.
+	expectOutput(t, out.String(), "=> 6\n", "3:3: expected", "linenumbers = off\n", "=> {1} ([]int)\n")
+
+	wantPrompts := []string{
+		"[0] go-pry> ", "  2 ...> ", "  3 ...> ", "  4 ...> ",
+		"[1] go-pry> ",
+		"[2] go-pry> ", "  2 ...> ", "  3 ...> ", "  4 ...> ",
+		"[3] go-pry> ",
+		"[4] go-pry> ", "...> ", "...> ", "[5] go-pry> ",
+	}
+	if !reflect.DeepEqual(editor.prompts, wantPrompts) {
+		t.Errorf("Expected %#v got %#v.", wantPrompts, editor.prompts)
+	}
+	// The numbers are only in the prompts.
+	wantHistory := []string{
+		"fn := func(n int) int {\nm := n *\n2\nreturn m }", "fn(3)",
+		"if true {\nx := 1\nx x\n}", ":set linenumbers off", "[]int{\n1,\n}",
+	}
+	if !reflect.DeepEqual(editor.history, wantHistory) {
+		t.Errorf("Expected %#v got %#v.", wantHistory, editor.history)
+	}
+}
+
+func TestReaderEditor(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	editor := NewReaderEditor(strings.NewReader("a\r\nb\rc\n\nx := []int{1}"), &out)
+	var lines []string
+	for {
+		line, err := editor.ReadLine("> ")
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if want := []string{"a", "b", "c", "", "x := []int{1}"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("Expected %#v got %#v.", want, lines)
+	}
+	// The lines are written after their prompts.
+	if want := "> a\n> b\n> c\n> \n> x := []int{1}\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+}
+
+func TestTerminalEditorWidth(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	tty := newScriptedTTY("日本\033[D\033[D\033[Ce\u0301🎉\r", 80, 24)
+	defer tty.Close()
+	editor := newTerminalEditor(&out, tty)
+	line, err := editor.ReadLine("> ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "日e\u0301🎉本"; line != want {
+		t.Errorf("Expected %#v got %#v.", want, line)
+	}
+	// The cursor is moved back over the columns after it, not the bytes,
+	// every time the line is redrawn.
+	var moves []string
+	for _, redraw := range strings.Split(out.String(), "\r\033[K")[1:] {
+		move := redraw[strings.LastIndex(redraw, "\033["):]
+		if len(moves) == 0 || moves[len(moves)-1] != move {
+			moves = append(moves, move)
+		}
+	}
+	want := []string{"\033[1D", "\033[3D", "\033[5D", "\033[3D", "\033[0J\n"}
+	if !reflect.DeepEqual(moves, want) {
+		t.Errorf("Expected %q got %q.", want, moves)
+	}
+}
+
+func TestTerminalEditorPaste(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		keys  string
+		paste pasteMode
+		want  string
+	}{
+		// Pasted line endings stay in the line until ENTER, without the
+		// one the paste ends with.
+		{"\033[200~a := 1\rb := a\r\033[201~\r", pasteBracketed, "a := 1\nb := a"},
+		{"\033[200~x\r\ny\n\033[201~ + 1\r", pasteBracketed, "x\ny + 1"},
+		// TAB is pasted as it is and other control keys are dropped.
+		{"f(\033[200~\ta,\x03\x04\033[201~)\r", pasteBracketed, "f(\ta,)"},
+		// The escape sequences of other keys are handled while pasting.
+		{"\033[200~ab\033[Dc\033[201~\r", pasteBracketed, "acb"},
+		// Keys following a line ending at once were pasted too.
+		{"a := 1\rb := a\r\nc\r", pasteTiming, "a := 1\nb := a\nc"},
+		{"x\r", pasteTiming, "x"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		var tty genericTTY = newScriptedTTY(c.keys, 80, 24)
+		if c.paste == pasteTiming {
+			pasted := newPasteTTY(tty)
+			defer pasted.Stop()
+			tty = pasted
+		}
+		editor := newTerminalEditor(&out, tty)
+		editor.paste = c.paste
+		line, err := editor.ReadLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != c.want {
+			t.Errorf("%q: Expected %#v got %#v.", c.keys, c.want, line)
+		}
+		// Terminals mark pastes only while a line is edited.
+		on := strings.HasPrefix(out.String(), bracketedPasteOn) && strings.HasSuffix(out.String(), bracketedPasteOff)
+		if on != (c.paste == pasteBracketed) {
+			t.Errorf("%q: Expected bracketed paste to be turned on: %v", c.keys, c.paste == pasteBracketed)
+		}
+		tty.Close()
+	}
+
+	for term, want := range map[string]pasteMode{"xterm-256color": pasteBracketed, "tmux": pasteBracketed, "dumb": pasteTiming, "": pasteTiming, "linux": pasteTiming} {
+		if mode := terminalPasteMode(term); mode != want {
+			t.Errorf("%q: Expected %v got %v.", term, want, mode)
+		}
+	}
+}
+
+func TestREPLPastedBlock(t *testing.T) {
+	t.Parallel()
+
+	// A pasted block runs as a whole, so a syntax error in it leaves the
+	// scope as it was.
+	editor := &scriptedEditor{script: []scriptedLine{
+		{line: "a := 1\nb := (a))"},
+		{line: "x := 2\ny := x * 3\ny"},
+	}}
+	var out bytes.Buffer
+	repl := &REPL{Out: &out, Options: []Option{WithHistoryFile(""), WithLineEditor(editor)}}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repl.Scope.Get("a"); ok {
+		t.Errorf("Expected nothing of the block with an error to run.")
+	}
+	expectOutput(t, out.String(), "=> 6\n")
+	if want := []string{"a := 1\nb := (a))", "x := 2\ny := x * 3\ny"}; !reflect.DeepEqual(editor.history, want) {
+		t.Errorf("Expected %#v got %#v.", want, editor.history)
+	}
+}
+
+func TestTerminalEditorIndent(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		indent string
+		keys   string
+		want   string
+	}{
+		{"\t", "if true {\rfor i := 0; i < 3; i++ {\rx += i\r}\r}\r", "if true {\n\tfor i := 0; i < 3; i++ {\n\t\tx += i\n\t}\n}"},
+		{"  ", "f := func(\ra int,\r) int {\rreturn a\r}\rx = f(1)\r", "f := func(\n  a int,\n) int {\n  return a\n}"},
+		// Brackets after the start of a line are typed as they are, and
+		// nothing is indented without an indent.
+		{"\t", "if true {\rx = []int{3}[0]\r}\r", "if true {\n\tx = []int{3}[0]\n}"},
+		{"", "if true {\rx = 2\r}\r", "if true {\nx = 2\n}"},
+	}
+	for _, c := range cases {
+		tty := makeTestTTY()
+		go func(keys string) {
+			tty.Write([]byte(keys))
+			tty.PipeWriter.Close()
+		}(c.keys)
+		var out bytes.Buffer
+		editor := newTerminalEditor(&out, tty)
+		editor.indent = c.indent
+		repl := &REPL{Out: &out, Options: []Option{WithHistoryFile(""), WithLineEditor(editor)}}
+		repl.Scope = NewScope()
+		repl.Scope.Set("x", 0)
+		if err := repl.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(editor.history) == 0 || editor.history[0] != c.want {
+			t.Errorf("%q: Expected %#v got %#v.", c.keys, c.want, editor.history)
+		}
+		if x, _ := repl.Scope.Get("x"); x == 0 {
+			t.Errorf("%q: Expected the block to run.", c.keys)
+		}
+	}
+}
+
+func TestTerminalEditor(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		keys string
+		want string
+		err  error
+	}{
+		{"[]int{1}\r", "[]int{1}", nil},
+		// left left backspace, DELETE and right
+		{"abcd\033[D\033[D\b\033[3~\033[Cx\r", "adx", nil},
+		{"3~\033x\r", "3~x", nil},
+		// Unknown sequences, such as Ctrl-Right, are ignored.
+		{"a\033[1;5Cb\n", "ab", nil},
+		// Down past the end, then up up
+		{"\033[B\033[A\033[A\r", "a = 1", nil},
+		// Ctrl-R, then ESC cancels the search and Up is handled.
+		{"zz\x12= 1\033[A\r", "a = 2", nil},
+		{"fo\t\r", "foo", nil},
+		// The cursor moves over whole characters, however wide they are
+		// and whatever marks and joiners make them up.
+		{"日本\033[D\b語\r", "語本", nil},
+		{"ae\u0301\033[D\bx\r", "xe\u0301", nil},
+		{"👩‍💻ab\033[D\033[D\b\r", "ab", nil},
+		{"🇫🇷x\033[D\033[D\033[3~\r", "x", nil},
+		{"e\u0301\b\r", "", nil},
+		{"a + \x03", "", ErrLineAborted},
+		{"\x04", "", ErrContinue},
+		{"", "", io.EOF},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		tty := newScriptedTTY(c.keys, 80, 24)
+		editor := newTerminalEditor(&out, tty)
+		editor.AddHistory("a = 1")
+		editor.AddHistory("a = 2")
+		editor.SetCompleter(func(line string, cursor int) ([]Candidate, int) {
+			return []Candidate{{Text: "foo"}}, 0
+		})
+		if len(c.keys) == 0 {
+			tty.PipeWriter.Close()
+		}
+		line, err := editor.ReadLine("> ")
+		if line != c.want || err != c.err {
+			t.Errorf("%q: Expected %#v, %v got %#v, %v.", c.keys, c.want, c.err, line, err)
+		}
+		tty.Close()
+	}
+}
@@ -0,0 +1,7 @@
+// +build prynoop
+
+package pry
+
+// buildEnabled is false when the program is built with -tags prynoop, which
+// turns every breakpoint into a no-op.
+const buildEnabled = false
@@ -0,0 +1,26 @@
+// +build prynoop
+
+package pry
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestNoopBuild(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	SetEnabled(true)
+	if Enabled() {
+		t.Fatal("Expected breakpoints to be disabled by the build tag")
+	}
+	// A remote session would wait for a connection.
+	Apply(NewScope(), WithListenAddr("localhost:0"))
+	if out.Len() > 0 {
+		t.Errorf("Expected nothing to be logged; got %q", out.String())
+	}
+}
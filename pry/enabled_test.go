@@ -0,0 +1,59 @@
+package pry
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSetEnabled(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	log.SetFlags(0)
+	defer func(flags int) {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	}(log.Flags())
+
+	SetEnabled(false)
+	defer SetEnabled(true)
+	if Enabled() {
+		t.Fatal("Expected breakpoints to be disabled")
+	}
+	// A remote session would wait for a connection.
+	_, _, line, _ := runtime.Caller(0)
+	Apply(NewScope(), WithListenAddr("localhost:0"))
+	if err := ListenAndServe("localhost:0", NewScope()); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("pry breakpoint skipped at enabled_test.go:%d\n"+
+		"pry breakpoint skipped at enabled_test.go:%d\n", line+1, line+2)
+	if out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+
+	SetEnabled(true)
+	if !Enabled() {
+		t.Fatal("Expected breakpoints to be enabled")
+	}
+}
+
+func TestBuildTagNoop(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the package")
+	}
+	t.Parallel()
+
+	out, err := exec.Command("go", "test", "-tags", "prynoop", "-run", "^TestNoopBuild$", "-v", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "--- PASS: TestNoopBuild") {
+		t.Errorf("Expected TestNoopBuild to run:\n%s", out)
+	}
+}
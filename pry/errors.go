@@ -0,0 +1,439 @@
+package pry
+
+import (
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ParseError is returned when the input isn't valid Go code.
+type ParseError struct {
+	// Pos is the position of the error relative to the input.
+	Pos token.Position
+	Msg string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError converts an error returned by go/parser into a *ParseError.
+// shifted is the number of characters that were prepended to the first line
+// of the input before parsing it.
+func newParseError(err error, shifted int) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return &ParseError{Msg: err.Error(), Err: err}
+	}
+	pos := list[0].Pos
+	if pos.Line == 1 {
+		pos.Column -= shifted
+		if pos.Column < 1 {
+			pos.Column = 1
+		}
+	}
+	return &ParseError{Pos: pos, Msg: list[0].Msg, Err: err}
+}
+
+// UndefinedError is returned when an identifier, field or method can't be
+// found.
+type UndefinedError struct {
+	// Name is the identifier or selector expression that couldn't be
+	// resolved. Ex: "foo" or "foo.Bar"
+	Name string
+	// Hint is an optional suggestion appended to the message.
+	Hint string
+}
+
+func (e *UndefinedError) Error() string {
+	return "undefined: " + e.Name + e.Hint
+}
+
+// TypeError is returned when a value doesn't have the type an operation
+// requires.
+type TypeError struct {
+	// Expected describes the required type. Ex: "int" or "func"
+	Expected string
+	// Got is the type of the offending value or nil for an untyped nil.
+	Got reflect.Type
+	// Context describes where the value was used. Ex: "index"
+	Context string
+}
+
+func (e *TypeError) Error() string {
+	got := "nil"
+	if e.Got != nil {
+		got = e.Got.String()
+	}
+	return fmt.Sprintf("%s: expected %s; got %s", e.Context, e.Expected, got)
+}
+
+// InterfaceError is returned when a value asserted or converted to an
+// interface type doesn't implement it.
+type InterfaceError struct {
+	// Context is where the value was used: "type assertion" or
+	// "conversion".
+	Context string
+	// Got is the type of the value or nil for a nil interface.
+	Got       reflect.Type
+	Interface reflect.Type
+	// Methods describes the methods of Interface that Got lacks, e.g.
+	// "missing method Read" or "method Write has pointer receiver".
+	Methods []string
+}
+
+func (e *InterfaceError) Error() string {
+	if e.Got == nil {
+		return fmt.Sprintf("%s: interface is nil, not %s", e.Context, e.Interface)
+	}
+	return fmt.Sprintf("%s: %s does not implement %s (%s)", e.Context, e.Got, e.Interface, strings.Join(e.Methods, ", "))
+}
+
+// newInterfaceError returns the InterfaceError of v not implementing iface,
+// or nil if it does.
+func newInterfaceError(context string, v interface{}, iface reflect.Type) error {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Implements(iface) {
+		return nil
+	}
+	err := &InterfaceError{Context: context, Got: t, Interface: iface}
+	for i := 0; t != nil && i < iface.NumMethod(); i++ {
+		if why := methodProblem(t, iface.Method(i)); len(why) > 0 {
+			err.Methods = append(err.Methods, why)
+		}
+	}
+	return err
+}
+
+// ConvertError is returned when a value can't be converted to a type, as
+// with time.Duration("1s").
+type ConvertError struct {
+	// Value is the rendered expression converted.
+	Value string
+	// Got is the type of the value or nil for an untyped nil.
+	Got      reflect.Type
+	Expected reflect.Type
+	// Truncated is set if Value is an untyped float constant that isn't an
+	// integer, converted to an integer type.
+	Truncated bool
+}
+
+func (e *ConvertError) Error() string {
+	switch {
+	case e.Got == nil:
+		return fmt.Sprintf("cannot convert nil to type %s", e.Expected)
+	case e.Truncated:
+		return fmt.Sprintf("cannot convert %s (untyped float constant) to type %s (truncated)", e.Value, e.Expected)
+	}
+	return fmt.Sprintf("cannot convert %s (type %s) to type %s", e.Value, e.Got, e.Expected)
+}
+
+// OperationError is returned when an operator can't be used on its
+// operands, such as == on slices.
+type OperationError struct {
+	Op token.Token
+	// Expr is the rendered expression, if it's known.
+	Expr string
+	// Reason explains what's wrong, e.g. "slice can only be compared to
+	// nil".
+	Reason string
+}
+
+func (e *OperationError) Error() string {
+	expr := e.Expr
+	if len(expr) == 0 {
+		expr = "operator " + e.Op.String()
+	}
+	return fmt.Sprintf("invalid operation: %s (%s)", expr, e.Reason)
+}
+
+// AssignError is returned when a value can't be assigned to a variable,
+// element or field of a different type.
+type AssignError struct {
+	// Value is the rendered right hand side expression.
+	Value string
+	// Got is the type of the value or nil for an untyped nil.
+	Got      reflect.Type
+	Expected reflect.Type
+	// Context is what the value is used in, such as "argument to f" or "map
+	// literal". It's an assignment if empty.
+	Context string
+	// constant is whether the value is an untyped constant, which isn't
+	// representable in Expected since it would have been converted.
+	constant bool
+}
+
+func (e *AssignError) Error() string {
+	context := e.Context
+	if len(context) == 0 {
+		context = "assignment"
+	}
+	if e.Got == nil {
+		return fmt.Sprintf("cannot use nil as type %s in %s", e.Expected, context)
+	}
+	msg := fmt.Sprintf("cannot use %s (type %s) as type %s in %s", e.Value, e.Got, e.Expected, context)
+	if e.Expected.Kind() == reflect.Interface {
+		if why := missingMethod(e.Got, e.Expected); len(why) > 0 {
+			msg += fmt.Sprintf(": %s does not implement %s (%s)", e.Got, e.Expected, why)
+		}
+	} else if !e.constant && e.Got.ConvertibleTo(e.Expected) {
+		msg += fmt.Sprintf("; use %s(%s) to convert", e.Expected, e.Value)
+	}
+	return msg
+}
+
+// missingMethod explains why t doesn't implement the interface iface, or
+// returns "" if it does.
+func missingMethod(t, iface reflect.Type) string {
+	for i := 0; i < iface.NumMethod(); i++ {
+		if why := methodProblem(t, iface.Method(i)); len(why) > 0 {
+			return why
+		}
+	}
+	return ""
+}
+
+// methodProblem explains why t doesn't have the interface method want, or
+// returns "" if it does.
+func methodProblem(t reflect.Type, want reflect.Method) string {
+	got, ok := t.MethodByName(want.Name)
+	switch {
+	case !ok && t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface:
+		if _, ok := reflect.PtrTo(t).MethodByName(want.Name); ok {
+			return fmt.Sprintf("method %s has pointer receiver", want.Name)
+		}
+		fallthrough
+	case !ok:
+		return fmt.Sprintf("missing method %s", want.Name)
+	}
+	// The methods of interface types have no receiver.
+	gotType := got.Type
+	if t.Kind() != reflect.Interface {
+		gotType = methodType(gotType)
+	}
+	if gotType != want.Type {
+		return fmt.Sprintf("wrong type for method %s", want.Name)
+	}
+	return ""
+}
+
+// methodType returns the type of a method without its receiver, the first
+// argument of fn.
+func methodType(fn reflect.Type) reflect.Type {
+	in := make([]reflect.Type, fn.NumIn()-1)
+	for i := range in {
+		in[i] = fn.In(i + 1)
+	}
+	out := make([]reflect.Type, fn.NumOut())
+	for i := range out {
+		out[i] = fn.Out(i)
+	}
+	return reflect.FuncOf(in, out, fn.IsVariadic())
+}
+
+// CallError is returned when calling a native function fails.
+type CallError struct {
+	// Func is the rendered function expression. Ex: "strings.Repeat"
+	Func  string
+	Cause error
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("calling %s: %s", e.Func, e.Cause)
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Cause
+}
+
+// SignatureError is returned when an interpreted function can't be used as
+// a native function of a type whose signature it doesn't declare.
+type SignatureError struct {
+	// Func is the declared signature. Ex: "func(a int) string"
+	Func string
+	// Type is the requested function type or nil.
+	Type reflect.Type
+	// Reason describes the mismatch. Ex: "parameter 1 is int, not string"
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("cannot use %s as %v: %s", e.Func, e.Type, e.Reason)
+}
+
+// newTypeError returns a *TypeError for the value v.
+func newTypeError(context, expected string, v interface{}) *TypeError {
+	return &TypeError{
+		Expected: expected,
+		Got:      reflect.TypeOf(v),
+		Context:  context,
+	}
+}
+
+// maxStackDepth caps the number of frames recorded on a *RuntimeError so
+// runaway recursion doesn't produce huge traces.
+const maxStackDepth = 32
+
+// Frame is a single interpreted function call.
+type Frame struct {
+	// Func is the name of the called function, or "func@<position>" for
+	// function literals called directly.
+	Func string
+	// Call is the position of the call site.
+	Call token.Position
+}
+
+// InterruptedError is returned when the context of an evaluation is done
+// before the evaluation finishes. It matches ErrInterrupted with errors.Is
+// and wraps the error of the context, such as context.DeadlineExceeded.
+type InterruptedError struct {
+	Err error
+}
+
+func (e *InterruptedError) Error() string {
+	return ErrInterrupted.Error() + ": " + e.Err.Error()
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrInterrupted) hold.
+func (e *InterruptedError) Is(target error) bool {
+	return target == ErrInterrupted
+}
+
+// StepLimitError is returned when an evaluation takes more steps than
+// Limits.MaxSteps allows. It matches ErrLimitExceeded with errors.Is.
+type StepLimitError struct {
+	Max int64
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("the evaluation took more than the %d steps allowed", e.Max)
+}
+
+// Is makes errors.Is(err, ErrLimitExceeded) hold.
+func (e *StepLimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// MakeLimitError is returned when make would allocate more than
+// Limits.MaxMakeBytes allows. It matches ErrLimitExceeded with errors.Is.
+type MakeLimitError struct {
+	Type reflect.Type
+	// Size is the length or capacity requested.
+	Size int64
+	Max  int64
+}
+
+func (e *MakeLimitError) Error() string {
+	return fmt.Sprintf("make(%s, %d) allocates more than the %d bytes allowed", e.Type, e.Size, e.Max)
+}
+
+// Is makes errors.Is(err, ErrLimitExceeded) hold.
+func (e *MakeLimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// OutputLimitError is returned when a result formats to more than
+// Limits.MaxOutputBytes. It matches ErrLimitExceeded with errors.Is.
+type OutputLimitError struct {
+	Max int
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("the result is longer than the %d bytes allowed and was cut short", e.Max)
+}
+
+// Is makes errors.Is(err, ErrLimitExceeded) hold.
+func (e *OutputLimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// DurationLimitError is returned when an evaluation runs longer than
+// Limits.MaxDuration allows. It matches ErrLimitExceeded with errors.Is.
+type DurationLimitError struct {
+	Max time.Duration
+}
+
+func (e *DurationLimitError) Error() string {
+	return fmt.Sprintf("the evaluation ran longer than the %s allowed", e.Max)
+}
+
+// Is makes errors.Is(err, ErrLimitExceeded) hold.
+func (e *DurationLimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// PolicyError is returned when evaluated code uses a package or function
+// the Policy of the scope blocks.
+type PolicyError struct {
+	// Symbol is the blocked member or function. Ex: "os.Exit"
+	Symbol string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Symbol + " is blocked by the sandbox policy"
+}
+
+// RuntimeError is returned when an error occurs inside an interpreted
+// function call. Stack holds the calls that lead to the error, innermost
+// first.
+type RuntimeError struct {
+	Err   error
+	Stack []Frame
+	// Omitted is the number of outer frames dropped beyond maxStackDepth.
+	Omitted int
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Traceback renders the call stack. Ex: "in double() at <repl>:1:17, called
+// from apply() at <repl>:2:4"
+func (e *RuntimeError) Traceback() string {
+	var b strings.Builder
+	for i, f := range e.Stack {
+		if i == 0 {
+			b.WriteString("in ")
+		} else {
+			b.WriteString(", called from ")
+		}
+		fmt.Fprintf(&b, "%s() at %s", f.Func, f.Call)
+	}
+	if e.Omitted > 0 {
+		fmt.Fprintf(&b, ", ... %d more", e.Omitted)
+	}
+	return b.String()
+}
+
+// withFrame records that err happened inside the call described by f.
+func withFrame(err error, f Frame) error {
+	if err == ErrBranchBreak || err == ErrBranchContinue || err == ErrChanRecvInSelect {
+		return err
+	}
+	rErr, ok := err.(*RuntimeError)
+	if !ok {
+		rErr = &RuntimeError{Err: err}
+	}
+	if len(rErr.Stack) < maxStackDepth {
+		rErr.Stack = append(rErr.Stack, f)
+	} else {
+		rErr.Omitted++
+	}
+	return rErr
+}
@@ -0,0 +1,131 @@
+package pry
+
+import (
+	"errors"
+	"go/scanner"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorType(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	_, err := scope.InterpretString(`a := `)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected *ParseError; got %T %+v", err, err)
+	}
+	if parseErr.Pos.Line != 1 {
+		t.Errorf("expected error on line 1; got %+v", parseErr.Pos)
+	}
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		t.Errorf("expected ParseError to wrap scanner.ErrorList; got %#v", parseErr.Err)
+	}
+}
+
+func TestUndefinedErrorType(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	_, err := scope.InterpretString(`missing + 1`)
+	var undefinedErr *UndefinedError
+	if !errors.As(err, &undefinedErr) {
+		t.Fatalf("expected *UndefinedError; got %T %+v", err, err)
+	}
+	if undefinedErr.Name != "missing" {
+		t.Errorf("expected Name = missing; got %q", undefinedErr.Name)
+	}
+
+	_, err = scope.InterpretString(`missing = 1`)
+	if !errors.As(err, &undefinedErr) {
+		t.Errorf("expected *UndefinedError on assignment; got %T %+v", err, err)
+	}
+}
+
+func TestTypeErrorType(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	_, err := scope.InterpretString(`
+		a := []int{1, 2}
+		a["foo"]
+	`)
+	var typeErr *TypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected *TypeError; got %T %+v", err, err)
+	}
+	if typeErr.Expected != "int" || typeErr.Got != reflect.TypeOf("") || typeErr.Context != "index" {
+		t.Errorf("unexpected TypeError %+v", typeErr)
+	}
+
+	_, err = scope.InterpretString(`append(1, 2)`)
+	if !errors.As(err, &typeErr) {
+		t.Errorf("expected *TypeError from append; got %T %+v", err, err)
+	}
+}
+
+func TestCallErrorType(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("repeat", strings.Repeat)
+	_, err := scope.InterpretString(`repeat(1, 2)`)
+	var callErr *CallError
+	if !errors.As(err, &callErr) {
+		t.Fatalf("expected *CallError; got %T %+v", err, err)
+	}
+	if callErr.Func != "repeat" {
+		t.Errorf("expected Func = repeat; got %q", callErr.Func)
+	}
+	if callErr.Cause == nil || errors.Unwrap(callErr) != callErr.Cause {
+		t.Errorf("expected CallError to unwrap to its cause; got %+v", callErr.Cause)
+	}
+}
+
+func TestRuntimeErrorStack(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	if _, err := scope.InterpretString("double := func(a int) int {\n\treturn a * missing\n}"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := scope.InterpretString("apply := func(f func(int) int) int { return f(2) }\napply(double)")
+	var rErr *RuntimeError
+	if !errors.As(err, &rErr) {
+		t.Fatalf("expected *RuntimeError; got %T %+v", err, err)
+	}
+	var undefinedErr *UndefinedError
+	if !errors.As(err, &undefinedErr) {
+		t.Errorf("expected RuntimeError to wrap *UndefinedError; got %T", rErr.Err)
+	}
+	want := "in f() at <repl>:1:45, called from apply() at <repl>:2:1"
+	if out := rErr.Traceback(); out != want {
+		t.Errorf("Traceback() = %q; expected %q", out, want)
+	}
+}
+
+func TestRuntimeErrorStackDepth(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	_, err := scope.InterpretString(`
+		recurse := func(n int) int {
+			if n == 0 {
+				return missing
+			} else {
+				return recurse(n - 1)
+			}
+		}
+		recurse(50)
+	`)
+	var rErr *RuntimeError
+	if !errors.As(err, &rErr) {
+		t.Fatalf("expected *RuntimeError; got %T %+v", err, err)
+	}
+	if len(rErr.Stack) != maxStackDepth || rErr.Omitted != 51-maxStackDepth {
+		t.Errorf("expected %d frames and %d omitted; got %d and %d", maxStackDepth, 51-maxStackDepth, len(rErr.Stack), rErr.Omitted)
+	}
+}
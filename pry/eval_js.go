@@ -0,0 +1,58 @@
+// +build js,wasm
+
+package pry
+
+import (
+	"context"
+	"syscall/js"
+)
+
+// JSEval returns a JavaScript function evaluating Go source in scope, for
+// embedding the interpreter in a page, such as to let the readers of a docs
+// site run the examples. The function takes the source and returns an object
+// with the result rendered like the REPL prints it and the error, if the
+// evaluation failed:
+//
+//	pryEval("2 + 2") // {result: "4", error: ""}
+//
+// opts set how results are shown and the limits and policy of the
+// evaluations, as for a session. Release the function once it's no longer
+// called.
+func JSEval(scope *Scope, opts ...Option) js.Func {
+	config := newConfig(opts...)
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 || args[0].Type() != js.TypeString {
+			return jsEvalResult("", "pryEval takes the source to evaluate")
+		}
+		if config.Limits != (Limits{}) {
+			defer scope.pushLimits(config.Limits)()
+		}
+		if !config.Policy.isZero() {
+			defer scope.pushPolicy(config.Policy)()
+		}
+		res, err := Eval(context.Background(), scope, args[0].String())
+		if err != nil {
+			return jsEvalResult("", err.Error())
+		}
+		if res.Kind != ResultExpression {
+			return jsEvalResult("", "")
+		}
+		text, err := formatResult(res.Value, config)
+		if err != nil {
+			return jsEvalResult(text, err.Error())
+		}
+		if res.ReturnedError != nil {
+			text += "\nReturned error: " + res.ReturnedError.Error()
+		}
+		return jsEvalResult(text, "")
+	})
+}
+
+// jsEvalResult is the object returned by the functions of JSEval. Its keys
+// are set in order, so it's always serialized the same way.
+func jsEvalResult(result, err string) js.Value {
+	obj := js.Global().Get("Object").New()
+	obj.Set("result", result)
+	obj.Set("error", err)
+	return obj
+}
@@ -0,0 +1,291 @@
+package pry
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// formatValue formats v like %#v, except that the keys of maps, including
+// those nested in structs, slices and other maps, are always sorted: numeric
+// keys numerically, strings lexically and other keys by their formatted
+// form.
+func formatValue(v interface{}) string {
+	s, _ := formatTruncated(v, 0)
+	return s
+}
+
+// formatTruncated is formatValue stopping after max bytes if max is
+// positive, so large values aren't formatted in full.
+func formatTruncated(v interface{}, max int) (s string, truncated bool) {
+	f := &formatter{max: max}
+	if v == nil {
+		f.WriteString("<nil>")
+	} else {
+		f.value(reflect.ValueOf(v), 0)
+	}
+	return f.String(), f.truncated
+}
+
+// goStringer is the interface fmt uses for %#v.
+var goStringer = reflect.TypeOf((*fmt.GoStringer)(nil)).Elem()
+
+// formatter writes values the way formatValue describes.
+type formatter struct {
+	strings.Builder
+	max       int
+	truncated bool
+	// maps holds the maps being formatted, so maps holding themselves
+	// aren't formatted forever.
+	maps []uintptr
+}
+
+func (f *formatter) WriteString(s string) (int, error) {
+	if f.truncated {
+		return 0, nil
+	}
+	if f.max > 0 && f.Len()+len(s) > f.max {
+		cut := f.max - f.Len()
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+		f.truncated = true
+	}
+	return f.Builder.WriteString(s)
+}
+
+// fmt writes v with %#v.
+func (f *formatter) fmt(v reflect.Value) {
+	// fmt writes some types, such as []byte, differently when it doesn't
+	// get them as a reflect.Value.
+	if v.CanInterface() {
+		f.WriteString(fmt.Sprintf("%#v", v.Interface()))
+		return
+	}
+	f.WriteString(fmt.Sprintf("%#v", v))
+}
+
+// value writes v, which is nested depth levels deep.
+func (f *formatter) value(v reflect.Value, depth int) {
+	if f.truncated {
+		return
+	}
+	if v.CanInterface() && v.Type().Implements(goStringer) {
+		f.fmt(v)
+		return
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			f.WriteString(v.Type().String() + "(nil)")
+			return
+		}
+		f.value(v.Elem(), depth)
+
+	case reflect.Ptr:
+		// Like fmt, only the value pointed to at the top level is shown.
+		if depth == 0 && !v.IsNil() {
+			switch v.Elem().Kind() {
+			case reflect.Array, reflect.Slice, reflect.Struct, reflect.Map:
+				f.WriteString("&")
+				f.value(v.Elem(), depth+1)
+				return
+			}
+		}
+		f.fmt(v)
+
+	case reflect.Map:
+		if v.IsNil() {
+			f.WriteString(v.Type().String() + "(nil)")
+			return
+		}
+		for _, p := range f.maps {
+			if p == v.Pointer() {
+				f.WriteString(v.Type().String() + "{...}")
+				return
+			}
+		}
+		f.maps = append(f.maps, v.Pointer())
+		defer func() {
+			f.maps = f.maps[:len(f.maps)-1]
+		}()
+		f.WriteString(v.Type().String() + "{")
+		for i, key := range sortedKeys(v) {
+			if f.truncated {
+				return
+			}
+			if i > 0 {
+				f.WriteString(", ")
+			}
+			f.value(key, depth+1)
+			f.WriteString(":")
+			f.value(v.MapIndex(key), depth+1)
+		}
+		f.WriteString("}")
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// fmt writes bytes in hexadecimal.
+			f.fmt(v)
+			return
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			f.WriteString(v.Type().String() + "(nil)")
+			return
+		}
+		f.WriteString(v.Type().String() + "{")
+		for i := 0; i < v.Len() && !f.truncated; i++ {
+			if i > 0 {
+				f.WriteString(", ")
+			}
+			f.value(v.Index(i), depth+1)
+		}
+		f.WriteString("}")
+
+	case reflect.Struct:
+		f.WriteString(v.Type().String() + "{")
+		for i := 0; i < v.NumField() && !f.truncated; i++ {
+			if i > 0 {
+				f.WriteString(", ")
+			}
+			f.WriteString(v.Type().Field(i).Name + ":")
+			f.value(v.Field(i), depth+1)
+		}
+		f.WriteString("}")
+
+	default:
+		f.fmt(v)
+	}
+}
+
+// sortedKeys returns the keys of the map v in the order formatValue writes
+// them.
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	formatted := make([]string, len(keys))
+	for i, k := range keys {
+		var f formatter
+		f.value(k, 1)
+		formatted[i] = f.String()
+	}
+	idx := make([]int, len(keys))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ka, kb := keys[idx[a]], keys[idx[b]]
+		if c, ok := compareKeys(ka, kb); ok && c != 0 {
+			return c < 0
+		}
+		if formatted[idx[a]] != formatted[idx[b]] {
+			return formatted[idx[a]] < formatted[idx[b]]
+		}
+		// Keys formatted the same way, such as 1 and 1.0 in a map of
+		// interfaces, are ordered by their type.
+		return keyType(ka) < keyType(kb)
+	})
+	sorted := make([]reflect.Value, len(keys))
+	for i, j := range idx {
+		sorted[i] = keys[j]
+	}
+	return sorted
+}
+
+// compareKeys compares the map keys a and b: numbers come first, in order,
+// then strings, then booleans. It returns false if neither can be compared
+// that way.
+func compareKeys(a, b reflect.Value) (int, bool) {
+	for a.Kind() == reflect.Interface && !a.IsNil() {
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Interface && !b.IsNil() {
+		b = b.Elem()
+	}
+	ca, cb := keyClass(a), keyClass(b)
+	switch {
+	case ca == keyOther && cb == keyOther:
+		return 0, false
+	case ca != cb:
+		return compareOrdered(ca < cb, ca > cb), true
+	case isInt(a) && isInt(b):
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int()), true
+	case isUint(a) && isUint(b):
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint()), true
+	case ca == keyNumber:
+		x, y := keyFloat(a), keyFloat(b)
+		return compareOrdered(x < y, x > y), true
+	case ca == keyString:
+		return strings.Compare(a.String(), b.String()), true
+	}
+	return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool()), true
+}
+
+// The classes of map keys, in the order they're sorted in.
+const (
+	keyNumber = iota
+	keyString
+	keyBool
+	keyOther
+)
+
+// keyType returns the name of the type of the map key v.
+func keyType(v reflect.Value) string {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Type().String()
+}
+
+// keyClass returns the class of the map key v.
+func keyClass(v reflect.Value) int {
+	switch {
+	case isInt(v) || isUint(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		return keyNumber
+	case v.Kind() == reflect.String:
+		return keyString
+	case v.Kind() == reflect.Bool:
+		return keyBool
+	}
+	return keyOther
+}
+
+// compareOrdered returns -1 if less, 1 if greater and 0 otherwise.
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUint(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// keyFloat returns the number v as a float64.
+func keyFloat(v reflect.Value) float64 {
+	switch {
+	case isInt(v):
+		return float64(v.Int())
+	case isUint(v):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
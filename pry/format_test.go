@@ -0,0 +1,94 @@
+package pry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type formatPoint struct {
+	X, Y int
+	name string
+}
+
+func TestFormatValueLikeFmt(t *testing.T) {
+	t.Parallel()
+
+	var err error
+	var nilSlice []int
+	for _, v := range []interface{}{
+		nil,
+		1,
+		"a\"b",
+		3.5,
+		formatPoint{1, 2, "p"},
+		&formatPoint{X: 1},
+		[]interface{}{1, "a", nil, true},
+		[][]int{{1, 2}, {3}},
+		[2]string{"a", "b"},
+		[]byte("hi"),
+		nilSlice,
+		err,
+		errors.New("e"),
+		[]*int{nil},
+	} {
+		want := fmt.Sprintf("%#v", v)
+		if out := formatValue(v); out != want {
+			t.Errorf("Expected %#v got %#v.", want, out)
+		}
+	}
+}
+
+func TestFormatValueSortsMaps(t *testing.T) {
+	t.Parallel()
+
+	type withMap struct {
+		M map[string]int
+	}
+	self := map[string]interface{}{}
+	self["self"] = self
+
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{map[int]string{10: "a", 9: "b", -1: "c"}, `map[int]string{-1:"c", 9:"b", 10:"a"}`},
+		{map[uint64]bool{1<<63 + 1: true, 1 << 63: false}, "map[uint64]bool{0x8000000000000000:false, 0x8000000000000001:true}"},
+		{map[string]int{"b": 1, "a": 2, "B": 3}, `map[string]int{"B":3, "a":2, "b":1}`},
+		{map[bool]int{true: 1, false: 0}, "map[bool]int{false:0, true:1}"},
+		{map[interface{}]int{"a": 1, 2: 2, 1.5: 3, 1: 4, 1.0: 5, true: 6}, `map[interface {}]int{1:5, 1:4, 1.5:3, 2:2, "a":1, true:6}`},
+		{map[formatPoint]int{{2, 1, ""}: 1, {1, 2, ""}: 2}, `map[pry.formatPoint]int{pry.formatPoint{X:1, Y:2, name:""}:2, pry.formatPoint{X:2, Y:1, name:""}:1}`},
+		{withMap{M: map[string]int{"z": 1, "y": 2}}, `pry.withMap{M:map[string]int{"y":2, "z":1}}`},
+		{[]map[int]int{{2: 0, 1: 0}}, "[]map[int]int{map[int]int{1:0, 2:0}}"},
+		{map[string]map[int]int{"a": {3: 0, 2: 0}}, `map[string]map[int]int{"a":map[int]int{2:0, 3:0}}`},
+		{self, `map[string]interface {}{"self":map[string]interface {}{...}}`},
+		{map[string]int(nil), "map[string]int(nil)"},
+		{&map[int]int{2: 0, 1: 0}, "&map[int]int{1:0, 2:0}"},
+	}
+	for _, c := range cases {
+		// Map iteration is random, so try a few times.
+		for i := 0; i < 5; i++ {
+			if out := formatValue(c.v); out != c.want {
+				t.Errorf("Expected %#v got %#v.", c.want, out)
+				break
+			}
+		}
+	}
+}
+
+func TestFormatValueTruncated(t *testing.T) {
+	t.Parallel()
+
+	m := map[int]string{}
+	for i := 0; i < 10000; i++ {
+		m[i] = strings.Repeat("x", 100)
+	}
+	out, truncated := formatTruncated(m, 30)
+	if want := `map[int]string{0:"xxxxxxxxxxxx`; out != want || !truncated {
+		t.Errorf("Expected %#v got %#v %v.", want, out, truncated)
+	}
+	if out, truncated := formatTruncated(map[int]int{2: 0, 1: 0}, 30); out != "map[int]int{1:0, 2:0}" || truncated {
+		t.Errorf("Expected %#v got %#v %v.", "map[int]int{1:0, 2:0}", out, truncated)
+	}
+}
@@ -0,0 +1,152 @@
+package pry
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// formatterTable is the formatters registered with RegisterFormatter.
+type formatterTable struct {
+	byType map[reflect.Type]func(v interface{}) string
+	// interfaces are the interface types with formatters, in the order
+	// they were registered.
+	interfaces []reflect.Type
+}
+
+// formatters holds the registered formatters. Registrations replace the
+// table rather than change it, so looking formatters up, as is done for
+// every value printed, doesn't lock.
+var formatters = struct {
+	sync.Mutex
+	table atomic.Value // *formatterTable
+}{}
+
+func init() {
+	RegisterFormatter(reflect.TypeOf(time.Time{}), func(v interface{}) string {
+		t := v.(time.Time)
+		if t.IsZero() {
+			return t.Format(time.RFC3339Nano)
+		}
+		return t.Format(time.RFC3339Nano) + ", " + relativeTime(t, time.Now())
+	})
+	RegisterFormatter(reflect.TypeOf(time.Duration(0)), func(v interface{}) string {
+		return v.(time.Duration).String()
+	})
+	RegisterFormatter(errorType, func(v interface{}) string {
+		return strconv.Quote(v.(error).Error())
+	})
+}
+
+// relativeTime returns how long before or after now t is, in its largest
+// unit, like 2m ago or in 3d.
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	var s string
+	switch {
+	case d < time.Second:
+		return "now"
+	case d < time.Minute:
+		s = strconv.Itoa(int(d/time.Second)) + "s"
+	case d < time.Hour:
+		s = strconv.Itoa(int(d/time.Minute)) + "m"
+	case d < 24*time.Hour:
+		s = strconv.Itoa(int(d/time.Hour)) + "h"
+	case d < 365*24*time.Hour:
+		s = strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	default:
+		s = strconv.Itoa(int(d/(365*24*time.Hour))) + "y"
+	}
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
+
+// RegisterFormatter makes results show values of type t as fn formats them,
+// such as by an ID or a summary rather than their fields, wherever they are
+// in the result. Results show them like T(text). A formatter registered for
+// t also formats pointers to t, and one registered for an interface type
+// formats the values implementing it. Formatters for the exact type come
+// first, then those for the type pointed to, then those for interfaces in the
+// order they were registered. Values that have none are shown by their String
+// method, if they have one, or their fields.
+//
+// Registering a formatter for t again replaces it, and a nil fn removes it.
+// Times, durations and errors have formatters from the start: times are
+// shown in RFC 3339 with how long ago they are, like
+// time.Time(2024-05-01T10:00:00Z, 2m ago), and durations like 1.5s.
+func RegisterFormatter(t reflect.Type, fn func(v interface{}) string) {
+	formatters.Lock()
+	defer formatters.Unlock()
+
+	old := loadFormatters()
+	table := &formatterTable{byType: make(map[reflect.Type]func(v interface{}) string, len(old.byType)+1)}
+	for k, v := range old.byType {
+		table.byType[k] = v
+	}
+	for _, iface := range old.interfaces {
+		if iface != t {
+			table.interfaces = append(table.interfaces, iface)
+		}
+	}
+	if fn == nil {
+		delete(table.byType, t)
+	} else {
+		table.byType[t] = fn
+		if t.Kind() == reflect.Interface {
+			table.interfaces = append(table.interfaces, t)
+		}
+	}
+	formatters.table.Store(table)
+}
+
+// loadFormatters returns the registered formatters. The table mustn't be
+// changed.
+func loadFormatters() *formatterTable {
+	if table, ok := formatters.table.Load().(*formatterTable); ok {
+		return table
+	}
+	return &formatterTable{}
+}
+
+// formatRegistered formats v with its registered formatter, if it has one.
+func formatRegistered(v reflect.Value) (s string, ok bool) {
+	if !v.CanInterface() || v.Kind() == reflect.Interface {
+		return "", false
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return "", false
+	}
+	table := loadFormatters()
+	if len(table.byType) == 0 {
+		return "", false
+	}
+	fn, ok := table.byType[v.Type()]
+	if !ok && v.Kind() == reflect.Ptr {
+		if fn, ok = table.byType[v.Type().Elem()]; ok {
+			v = v.Elem()
+		}
+	}
+	for i := 0; !ok && i < len(table.interfaces); i++ {
+		if v.Type().Implements(table.interfaces[i]) {
+			fn, ok = table.byType[table.interfaces[i]]
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	defer func() {
+		// Formatters that panic are treated as if there were none.
+		if recover() != nil {
+			s, ok = "", false
+		}
+	}()
+	return fn(v.Interface()), true
+}
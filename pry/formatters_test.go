@@ -0,0 +1,99 @@
+package pry
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type formattedUser struct {
+	ID   int
+	Blob []byte
+}
+
+func (u formattedUser) Label() string { return "label" }
+
+type formattedLabel struct{ name string }
+
+func (l *formattedLabel) Label() string { return l.name }
+
+type labeler interface {
+	Label() string
+}
+
+// The formatters are global, so these tests don't run in parallel.
+
+func TestRegisterFormatter(t *testing.T) {
+	userType := reflect.TypeOf(formattedUser{})
+	labelerType := reflect.TypeOf((*labeler)(nil)).Elem()
+	defer RegisterFormatter(userType, nil)
+	defer RegisterFormatter(labelerType, nil)
+
+	RegisterFormatter(labelerType, func(v interface{}) string {
+		return "labeled " + v.(labeler).Label()
+	})
+	RegisterFormatter(userType, func(v interface{}) string {
+		return "user #" + strconv.Itoa(v.(formattedUser).ID)
+	})
+
+	user := formattedUser{ID: 42, Blob: make([]byte, 1000)}
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		// The exact type comes before the interfaces it implements.
+		{user, "pry.formattedUser(user #42)"},
+		{&user, "*pry.formattedUser(user #42)"},
+		{&formattedLabel{name: "a"}, "*pry.formattedLabel(labeled a)"},
+		{map[string][]formattedUser{"admins": {user}}, "map[string][]pry.formattedUser{\"admins\": {pry.formattedUser(user #42)}}"},
+		{[]interface{}{(*formattedUser)(nil)}, "[]interface {}{(*pry.formattedUser)(nil)}"},
+		{time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), "time.Time(2020-01-02T03:04:05.000000006Z, " + relativeTime(time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), time.Now()) + ")"},
+		{time.Time{}, "time.Time(0001-01-01T00:00:00Z)"},
+		{map[string]time.Duration{"timeout": 1500 * time.Millisecond}, `map[string]time.Duration{"timeout": time.Duration(1.5s)}`},
+	}
+	for _, c := range cases {
+		if out := Inspect(c.v); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+
+	// Formatters that panic are ignored.
+	RegisterFormatter(userType, func(v interface{}) string { panic("broken") })
+	if out, want := Inspect(formattedUser{ID: 1}), "pry.formattedUser{ID: 1, Blob: nil}"; out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	// Removed formatters don't apply anymore.
+	RegisterFormatter(userType, nil)
+	if out, want := Inspect(formattedUser{ID: 1}), "pry.formattedUser(labeled label)"; out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+	RegisterFormatter(labelerType, nil)
+	if out, want := Inspect(&formattedLabel{name: "a"}), `&pry.formattedLabel{name: "a"}`; out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		d    time.Duration
+		want string
+	}{
+		{-500 * time.Millisecond, "now"},
+		{-45 * time.Second, "45s ago"},
+		{-2*time.Minute - 30*time.Second, "2m ago"},
+		{-5 * time.Hour, "5h ago"},
+		{-3 * 24 * time.Hour, "3d ago"},
+		{-800 * 24 * time.Hour, "2y ago"},
+		{90 * time.Minute, "in 1h"},
+	}
+	for _, c := range cases {
+		if out := relativeTime(now.Add(c.d), now); out != c.want {
+			t.Errorf("%s: Expected %#v got %#v.", c.d, c.want, out)
+		}
+	}
+}
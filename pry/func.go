@@ -0,0 +1,271 @@
+package pry
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Interface returns a native function of type typ that runs f, so functions
+// defined in the REPL can be handed to Go code taking callbacks, including
+// code that keeps them after the session ends. It returns a *SignatureError
+// if typ doesn't have the parameters and results f declares.
+//
+// The arguments are bound in a child of the scope f was defined in and the
+// results are converted to the types of typ. Calls made while no evaluation
+// is running get limits of their own. If running f fails, the error is
+// returned as the last result when that's an error and the function panics
+// with it otherwise.
+func (f *Func) Interface(typ reflect.Type) (interface{}, error) {
+	if typ == nil || typ.Kind() != reflect.Func {
+		return nil, &SignatureError{Func: f.signature(), Type: typ, Reason: "not a func type"}
+	}
+	if err := f.checkSignature(typ); err != nil {
+		return nil, err
+	}
+	returnsError := typ.NumOut() > 0 && typ.Out(typ.NumOut()-1) == errorType
+	return reflect.MakeFunc(typ, func(in []reflect.Value) []reflect.Value {
+		out, err := f.callNatively(typ, in)
+		if err == nil {
+			return out
+		}
+		if !returnsError {
+			panic(err)
+		}
+		out = make([]reflect.Value, typ.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(typ.Out(i))
+		}
+		out[len(out)-1] = reflect.ValueOf(&err).Elem()
+		return out
+	}).Interface(), nil
+}
+
+// signature renders the signature f declares. Ex: "func(a int) string"
+func (f *Func) signature() string {
+	return types.ExprString(f.Def.Type)
+}
+
+// String describes f by its signature and where it was defined, rather than
+// by its fields, which hold its syntax tree and the scope it was defined in.
+// Ex: "func(a int) string at <repl>:1:6"
+func (f *Func) String() string {
+	if f.src == nil {
+		return f.signature()
+	}
+	return f.signature() + " at " + f.src.position(f.Def.Pos()).String()
+}
+
+// literalName names f in tracebacks by where it's defined.
+func (f *Func) literalName() string {
+	return "func@" + f.src.position(f.Def.Pos()).String()
+}
+
+// definedIn returns the scope f was defined in.
+func (f *Func) definedIn() *Scope {
+	if f.scope == nil {
+		return NewScope()
+	}
+	return f.scope
+}
+
+// checkSignature returns a *SignatureError if f doesn't declare the
+// parameters and results of typ.
+func (f *Func) checkSignature(typ reflect.Type) error {
+	mismatch := func(format string, args ...interface{}) error {
+		return &SignatureError{Func: f.signature(), Type: typ, Reason: fmt.Sprintf(format, args...)}
+	}
+	scope := f.definedIn()
+	params, variadic, err := scope.fieldTypes(f.Def.Type.Params)
+	if err != nil {
+		return mismatch("%s", err)
+	}
+	if len(params) != typ.NumIn() {
+		return mismatch("has %d parameters, not %d", len(params), typ.NumIn())
+	}
+	if variadic != typ.IsVariadic() {
+		if variadic {
+			return mismatch("is variadic")
+		}
+		return mismatch("isn't variadic")
+	}
+	for i, param := range params {
+		if param != typ.In(i) {
+			return mismatch("parameter %d is %s, not %s", i+1, param, typ.In(i))
+		}
+	}
+	results, _, err := scope.fieldTypes(f.Def.Type.Results)
+	if err != nil {
+		return mismatch("%s", err)
+	}
+	if len(results) != typ.NumOut() {
+		return mismatch("has %d results, not %d", len(results), typ.NumOut())
+	}
+	for i, result := range results {
+		if result != typ.Out(i) {
+			return mismatch("result %d is %s, not %s", i+1, result, typ.Out(i))
+		}
+	}
+	return nil
+}
+
+// callNatively runs f with the arguments in of a call to its native function
+// of type typ and returns the results converted to the types of typ.
+func (f *Func) callNatively(typ reflect.Type, in []reflect.Value) (out []reflect.Value, err error) {
+	frame := Frame{Func: f.literalName(), Call: token.Position{Filename: "<native>"}}
+	defer recoverInterpret(frame.Func, &err)
+
+	scope := f.definedIn()
+	if l, ok := scope.currentLimits(); ok && scope.currentBudget() == nil {
+		scope = scope.NewChild()
+		scope.budget = newBudget(l)
+	}
+	ret, err := scope.callFunc(f, ValuesToInterfaces(in), frame)
+	if err != nil {
+		return nil, err
+	}
+
+	// Several results are returned as a slice.
+	rets := []interface{}{ret}
+	if typ.NumOut() > 1 {
+		var ok bool
+		if rets, ok = ret.([]interface{}); !ok || len(rets) != typ.NumOut() {
+			return nil, withFrame(errors.Errorf("expected %d results; got %#v", typ.NumOut(), ret), frame)
+		}
+	}
+	out = make([]reflect.Value, typ.NumOut())
+	for i := range out {
+		if out[i], err = nativeResult(rets[i], typ.Out(i), "result "+strconv.Itoa(i+1)); err != nil {
+			return nil, withFrame(err, frame)
+		}
+	}
+	return out, nil
+}
+
+// nativeResult converts v, a result of an interpreted function, to typ. It
+// returns a *TypeError for context if it can't. Numbers are converted if they
+// keep their value, since the interpreter gives untyped constants their
+// default type.
+func nativeResult(v interface{}, typ reflect.Type, context string) (reflect.Value, error) {
+	if v == nil {
+		switch typ.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface:
+			return reflect.Zero(typ), nil
+		}
+		return reflect.Value{}, newTypeError(context, typ.String(), v)
+	}
+	if fn, ok := v.(*Func); ok && typ.Kind() == reflect.Func {
+		native, err := fn.Interface(typ)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(native), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(typ) {
+		out := reflect.New(typ).Elem()
+		out.Set(rv)
+		return out, nil
+	}
+	if isNumberKind(rv.Kind()) && isNumberKind(typ.Kind()) {
+		if out := rv.Convert(typ); out.Convert(rv.Type()).Interface() == v {
+			return out, nil
+		}
+	}
+	return reflect.Value{}, newTypeError(context, typ.String(), v)
+}
+
+// isNumberKind returns whether k is an integer or floating point kind.
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// fieldTypes returns the types of the parameters or results in fields, and
+// whether the last parameter is variadic.
+func (scope *Scope) fieldTypes(fields *ast.FieldList) ([]reflect.Type, bool, error) {
+	if fields == nil {
+		return nil, false, nil
+	}
+	var out []reflect.Type
+	variadic := false
+	for _, field := range fields.List {
+		expr := field.Type
+		if ellipsis, ok := expr.(*ast.Ellipsis); ok {
+			expr, variadic = &ast.ArrayType{Elt: ellipsis.Elt}, true
+		}
+		typ, err := scope.typeExpr(expr)
+		if err != nil {
+			return nil, false, err
+		}
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			out = append(out, typ)
+		}
+	}
+	return out, variadic, nil
+}
+
+// typeExpr returns the type expr denotes, including the pointer and func
+// types Interpret doesn't evaluate.
+func (scope *Scope) typeExpr(expr ast.Expr) (reflect.Type, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		// The predeclared error is the interface, not the type of errors.New.
+		if e.Name == "error" {
+			return errorType, nil
+		}
+	case *ast.ParenExpr:
+		return scope.typeExpr(e.X)
+	case *ast.StarExpr:
+		elem, err := scope.typeExpr(e.X)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PtrTo(elem), nil
+	case *ast.ArrayType:
+		if e.Len == nil {
+			elem, err := scope.typeExpr(e.Elt)
+			if err != nil {
+				return nil, err
+			}
+			return reflect.SliceOf(elem), nil
+		}
+	case *ast.MapType:
+		key, err := scope.typeExpr(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := scope.typeExpr(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.MapOf(key, elem), nil
+	case *ast.FuncType:
+		in, variadic, err := scope.fieldTypes(e.Params)
+		if err != nil {
+			return nil, err
+		}
+		out, _, err := scope.fieldTypes(e.Results)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.FuncOf(in, out, variadic), nil
+	}
+	v, err := scope.Interpret(expr)
+	if err != nil {
+		return nil, err
+	}
+	typ, ok := v.(reflect.Type)
+	if !ok {
+		return nil, newTypeError(types.ExprString(expr), "type", v)
+	}
+	return typ, nil
+}
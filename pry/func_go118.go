@@ -0,0 +1,17 @@
+//go:build go1.18
+// +build go1.18
+
+package pry
+
+import "reflect"
+
+// MakeFunc is Func.Interface for the func type T, returning the function
+// typed. Ex: less, err := pry.MakeFunc[func(a, b int) bool](f)
+func MakeFunc[T any](f *Func) (T, error) {
+	var fn T
+	native, err := f.Interface(reflect.TypeOf(&fn).Elem())
+	if err != nil {
+		return fn, err
+	}
+	return native.(T), nil
+}
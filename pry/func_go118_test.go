@@ -0,0 +1,27 @@
+//go:build go1.18
+// +build go1.18
+
+package pry
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMakeFunc(t *testing.T) {
+	t.Parallel()
+
+	f := testFunc(t, NewScope(), "func(s string, n int) string { out := \"\"; for i := 0; i < n; i++ { out += s }; return out }")
+	repeat, err := MakeFunc[func(string, int) string](f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := repeat("ab", 3); out != "ababab" {
+		t.Errorf("Expected %#v got %#v.", "ababab", out)
+	}
+
+	var sigErr *SignatureError
+	if _, err := MakeFunc[func(string) string](f); !errors.As(err, &sigErr) {
+		t.Errorf("Expected a *SignatureError got %#v.", err)
+	}
+}
@@ -0,0 +1,155 @@
+package pry
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// testFunc interprets src, a function literal, in scope.
+func testFunc(t *testing.T, scope *Scope, src string) *Func {
+	t.Helper()
+
+	v, err := scope.InterpretString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := v.(*Func)
+	if !ok {
+		t.Fatalf("Expected a *Func got %#v.", v)
+	}
+	return f
+}
+
+func TestFuncInterface(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("offset", 10)
+	f := testFunc(t, scope, "func(a, b int) int { return a + b + offset }")
+	native, err := f.Interface(reflect.TypeOf(func(int, int) int { return 0 }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := native.(func(int, int) int)
+	if out := add(1, 2); out != 13 {
+		t.Errorf("Expected %#v got %#v.", 13, out)
+	}
+	// The function sees the scope it was defined in as it is when called.
+	scope.Set("offset", 20)
+	if out := add(1, 2); out != 23 {
+		t.Errorf("Expected %#v got %#v.", 23, out)
+	}
+
+	// Native callbacks can be interpreted functions.
+	scope.Set("xs", []int{3, 1, 2})
+	less, err := testFunc(t, scope, "func(i, j int) bool { return xs[i] < xs[j] }").Interface(reflect.TypeOf(func(int, int) bool { return false }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xs, _ := scope.Get("xs")
+	sort.Slice(xs, less.(func(int, int) bool))
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(xs, want) {
+		t.Errorf("Expected %#v got %#v.", want, xs)
+	}
+
+	// Results are converted to the declared types.
+	native, err = testFunc(t, scope, "func(s ...string) (float64, []string, error) { return 1, s, nil }").Interface(reflect.TypeOf(func(...string) (float64, []string, error) { return 0, nil, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, s, err := native.(func(...string) (float64, []string, error))("a", "b")
+	if n != 1.0 || !reflect.DeepEqual(s, []string{"a", "b"}) || err != nil {
+		t.Errorf("Expected %#v got %#v %#v %v.", []interface{}{1.0, []string{"a", "b"}, nil}, n, s, err)
+	}
+}
+
+func TestFuncInterfaceErrors(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.SetLimits(Limits{MaxSteps: 100})
+
+	// Errors are returned as the error result.
+	native, err := testFunc(t, scope, "func(b int) (int, error) { return 10 / b, nil }").Interface(reflect.TypeOf(func(int) (int, error) { return 0, nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	div := native.(func(int) (int, error))
+	if out, err := div(0); out != 0 || !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("Expected %#v got %#v %v.", ErrDivisionByZero, out, err)
+	}
+	if out, err := div(5); out != 2 || err != nil {
+		t.Errorf("Expected %#v got %#v %v.", 2, out, err)
+	}
+
+	// Calls get the limits of the scope.
+	native, err = testFunc(t, scope, "func() error { for {}; return nil }").Interface(reflect.TypeOf(func() error { return nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stepErr *StepLimitError
+	if err := native.(func() error)(); !errors.As(err, &stepErr) {
+		t.Errorf("Expected a *StepLimitError got %#v.", err)
+	}
+
+	// Functions without an error result panic.
+	native, err = testFunc(t, scope, `func() string { return 1 }`).Interface(reflect.TypeOf(func() string { return "" }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			var typeErr *TypeError
+			if err, _ := recover().(error); !errors.As(err, &typeErr) || typeErr.Context != "result 1" {
+				t.Errorf("Expected a *TypeError for result 1 got %#v.", err)
+			}
+		}()
+		native.(func() string)()
+	}()
+}
+
+func TestFuncInterfaceSignature(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	cases := []struct {
+		src    string
+		typ    interface{}
+		reason string
+	}{
+		{"func(a int) string { return \"\" }", func(string) string { return "" }, "parameter 1 is int, not string"},
+		{"func(a, b int) {}", func(int) {}, "has 2 parameters, not 1"},
+		{"func(a ...int) {}", func([]int) {}, "is variadic"},
+		{"func(a []int) {}", func(...int) {}, "isn't variadic"},
+		{"func() {}", func() error { return nil }, "has 0 results, not 1"},
+		{"func() (int, error) { return 0, nil }", func() (int, int) { return 0, 0 }, "result 2 is error, not int"},
+		{"func(f func(int) bool) {}", func(func(int) int) {}, "parameter 1 is func(int) bool, not func(int) int"},
+		{"func() {}", 1, "not a func type"},
+	}
+	for _, c := range cases {
+		_, err := testFunc(t, scope, c.src).Interface(reflect.TypeOf(c.typ))
+		var sigErr *SignatureError
+		if !errors.As(err, &sigErr) || sigErr.Reason != c.reason {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.reason, err)
+		}
+	}
+
+	// Pointer, map and func types match.
+	src := "func(p *int, m map[string][]error, f func(...int) (int, error)) {}"
+	typ := reflect.TypeOf(func(*int, map[string][]error, func(...int) (int, error)) {})
+	if _, err := testFunc(t, scope, src).Interface(typ); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFuncString(t *testing.T) {
+	t.Parallel()
+
+	f := testFunc(t, NewScope(), "func(a int, s ...string) (int, error) { return a, nil }")
+	want := "func(a int, s ...string) (int, error) at <repl>:1:1"
+	if out := (&Config{}).inspect(f); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
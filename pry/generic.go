@@ -0,0 +1,113 @@
+package pry
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Generic is a generic function or type of a package. Go can't refer to one
+// without type arguments, so it holds the instantiations go-pry generated
+// keyed by their type arguments, such as "[]int" or "string, int".
+// Instantiations of types are reflect.Type.
+type Generic struct {
+	// Name is the qualified name, such as "slices.Sort".
+	Name      string
+	Instances map[string]interface{}
+}
+
+// Instantiate returns the instantiation with the type arguments typeArgs.
+func (g Generic) Instantiate(typeArgs string) (interface{}, error) {
+	if v, ok := g.Instances[typeArgs]; ok {
+		return v, nil
+	}
+	return nil, errors.Errorf("%s[%s] wasn't instantiated; %s", g.Name, typeArgs, g.available())
+}
+
+// instances returns the sorted type arguments of the instantiations.
+func (g Generic) instances() []string {
+	var keys []string
+	for k := range g.Instances {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// available lists the instantiations for error messages.
+func (g Generic) available() string {
+	keys := g.instances()
+	if len(keys) == 0 {
+		return "no instantiations were generated"
+	}
+	for i, k := range keys {
+		keys[i] = g.Name + "[" + k + "]"
+	}
+	return "available: " + strings.Join(keys, ", ")
+}
+
+// infer returns the first instantiated function the arguments can be passed
+// to, as type inference would at compile time.
+func (g Generic) infer(args []interface{}) (interface{}, error) {
+	for _, k := range g.instances() {
+		fn := reflect.ValueOf(g.Instances[k])
+		if fn.Kind() == reflect.Func && acceptsArgs(fn.Type(), args) {
+			return g.Instances[k], nil
+		}
+	}
+	var argTypes []string
+	for _, arg := range args {
+		if arg == nil {
+			argTypes = append(argTypes, "nil")
+		} else {
+			argTypes = append(argTypes, reflect.TypeOf(arg).String())
+		}
+	}
+	return nil, errors.Errorf("cannot infer the type arguments of %s from (%s); %s", g.Name, strings.Join(argTypes, ", "), g.available())
+}
+
+// acceptsArgs returns whether a function of type typ can be called with
+// args.
+func acceptsArgs(typ reflect.Type, args []interface{}) bool {
+	n := typ.NumIn()
+	if typ.IsVariadic() {
+		if len(args) < n-1 {
+			return false
+		}
+	} else if len(args) != n {
+		return false
+	}
+	for i, arg := range args {
+		var in reflect.Type
+		if typ.IsVariadic() && i >= n-1 {
+			in = typ.In(n - 1).Elem()
+		} else {
+			in = typ.In(i)
+		}
+		if arg == nil {
+			switch in.Kind() {
+			case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Chan, reflect.Func:
+				continue
+			}
+			return false
+		}
+		if !reflect.TypeOf(arg).AssignableTo(in) {
+			return false
+		}
+	}
+	return true
+}
+
+// typeArgs renders the type arguments of an instantiation the way the keys
+// of Generic.Instances are written, such as "[]int" or "string, int".
+func typeArgs(indices []ast.Expr) string {
+	var rendered []string
+	for _, index := range indices {
+		rendered = append(rendered, types.ExprString(index))
+	}
+	return strings.Join(rendered, ", ")
+}
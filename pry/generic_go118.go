@@ -0,0 +1,18 @@
+// +build go1.18
+
+package pry
+
+import "go/ast"
+
+// indexExprs returns the operand and indices of an index expression, which
+// has several indices when it instantiates a generic with several type
+// parameters.
+func indexExprs(e ast.Node) (ast.Expr, []ast.Expr, bool) {
+	switch e := e.(type) {
+	case *ast.IndexExpr:
+		return e.X, []ast.Expr{e.Index}, true
+	case *ast.IndexListExpr:
+		return e.X, e.Indices, true
+	}
+	return nil, nil, false
+}
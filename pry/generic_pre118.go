@@ -0,0 +1,13 @@
+// +build !go1.18
+
+package pry
+
+import "go/ast"
+
+// indexExprs returns the operand and index of an index expression.
+func indexExprs(e ast.Node) (ast.Expr, []ast.Expr, bool) {
+	if e, ok := e.(*ast.IndexExpr); ok {
+		return e.X, []ast.Expr{e.Index}, true
+	}
+	return nil, nil, false
+}
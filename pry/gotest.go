@@ -0,0 +1,54 @@
+// +build !js
+
+package pry
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	gotty "github.com/mattn/go-tty"
+)
+
+// inTest returns whether the program is a test binary built by go test.
+// go test doesn't connect the stdin of tests and captures their output, so
+// breakpoints in tests use the controlling terminal directly.
+func inTest() bool {
+	return flag.Lookup("test.v") != nil
+}
+
+// hasTerminal returns whether the process has a controlling terminal.
+func hasTerminal() bool {
+	tty, err := gotty.Open()
+	if err != nil {
+		return false
+	}
+	tty.Close()
+	return true
+}
+
+// lockTerminal waits until no breakpoint of another test binary has the
+// terminal and returns the function releasing it. go test runs the binaries
+// of different packages in parallel; the breakpoints of the goroutines of
+// one process already take turns through the queue. Other programs don't
+// share the terminal, so nothing is locked for them.
+func lockTerminal() (unlock func()) {
+	if !inTest() {
+		return func() {}
+	}
+	path := filepath.Join(os.TempDir(), "go-pry-terminal-"+strconv.Itoa(os.Getuid())+".lock")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		// Sharing the terminal is better than not opening at all.
+		return func() {}
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return func() {}
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}
+}
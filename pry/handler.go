@@ -0,0 +1,318 @@
+package pry
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxEvalRequestBytes is the size of the largest body /eval accepts.
+const maxEvalRequestBytes = 1 << 20
+
+// Handler returns an HTTP handler for exploring scope from a browser, such
+// as that of a paused process. Requests must carry token as a bearer token,
+// "Authorization: Bearer <token>", since whoever has it can run code in the
+// program; Handler panics if it's empty. It serves:
+//
+//   - POST /eval with {"source": "x * 2"} evaluates the source in scope and
+//     returns {"result": "=> 42", "type": "int", "kind": "expression",
+//     "duration": "15µs"}, with "error" set instead of "result" if it fails
+//     and "warnings" listing what it warns about. Calls returning an error
+//     last, such as strconv.Atoi, have the other results in "result" and the
+//     error, if there's one, in "returned_error". Results are rendered and
+//     cut like the REPL prints them. "source_html" and "result_html" hold
+//     them highlighted with BackendHTML.
+//   - GET /scope returns the variables in scope, as SnapshotJSON encodes
+//     them.
+//   - GET /complete?line=fmt.Pr&pos=6 returns the candidates Complete
+//     finds for the identifier before pos, {"completions": [{"text":
+//     "Println", "kind": "func", "type": "func(...interface {}) (int,
+//     error)", "doc": "Println formats..."}], "start": 4}. pos defaults to
+//     the end of the line.
+//   - GET / serves a page with an input box and a log of the results, which
+//     asks for the token.
+//
+// The evaluations run one at a time with the hooks, limits and policy set
+// with opts, like the input of a session, and stop when their request is
+// canceled. opts also set how results are shown, as with WithInspectDepth.
+func Handler(scope *Scope, token string, opts ...Option) http.Handler {
+	if len(token) == 0 {
+		panic("pry: Handler needs a token")
+	}
+	h := &evalHandler{scope: scope, token: token, config: newConfig(opts...), mux: http.NewServeMux()}
+	h.mux.HandleFunc("/eval", h.eval)
+	h.mux.HandleFunc("/scope", h.snapshot)
+	h.mux.HandleFunc("/complete", h.complete)
+	return h
+}
+
+// evalHandler is the handler returned by Handler.
+type evalHandler struct {
+	scope  *Scope
+	token  string
+	config *Config
+	mux    *http.ServeMux
+	// mu serializes the requests using the scope.
+	mu sync.Mutex
+}
+
+// evalRequest is the body of a POST /eval.
+type evalRequest struct {
+	Source string `json:"source"`
+}
+
+// evalResponse is the result of a POST /eval.
+type evalResponse struct {
+	Result string `json:"result,omitempty"`
+	// ResultHTML and SourceHTML are the result and the source highlighted
+	// with BackendHTML.
+	ResultHTML string `json:"result_html,omitempty"`
+	SourceHTML string `json:"source_html"`
+	Type       string `json:"type,omitempty"`
+	Kind       string `json:"kind"`
+	Error      string `json:"error,omitempty"`
+	// ReturnedError is the error returned by a call whose last result is
+	// an error.
+	ReturnedError string   `json:"returned_error,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+	Duration      string   `json:"duration"`
+}
+
+// completeResponse is the result of a GET /complete.
+type completeResponse struct {
+	Completions []Candidate `json:"completions"`
+	Start       int         `json:"start"`
+}
+
+func (h *evalHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The page holds nothing but the code asking for the token.
+	if r.URL.Path == "/" && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(handlerPage))
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-pry"`)
+		writeJSONError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized returns whether r carries the token.
+func (h *evalHandler) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(h.token)) == 1
+}
+
+// use sets up the scope for a request like it's set up for a session, until
+// the returned function is called. Requests wait for the ones before them.
+func (h *evalHandler) use() (done func()) {
+	h.mu.Lock()
+	var restores []func()
+	for _, hooks := range h.config.Hooks {
+		restores = append(restores, h.scope.AddHooks(hooks))
+	}
+	if h.config.Limits != (Limits{}) {
+		restores = append(restores, h.scope.pushLimits(h.config.Limits))
+	}
+	if !h.config.Policy.isZero() {
+		restores = append(restores, h.scope.pushPolicy(h.config.Policy))
+	}
+	return func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			restores[i]()
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *evalHandler) eval(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEvalRequestBytes))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.Wrap(err, "reading the request"))
+		return
+	}
+	var req evalRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.Wrap(err, "decoding the request"))
+		return
+	}
+
+	done := h.use()
+	defer done()
+	res, err := Eval(r.Context(), h.scope, req.Source)
+	resp := evalResponse{Kind: res.Kind.String(), Warnings: res.Warnings, Duration: res.Duration.String()}
+	if res.Type != nil {
+		resp.Type = res.Type.String()
+	}
+	if err == nil && res.Kind == ResultExpression {
+		// Statements, such as calls to functions without results, have
+		// nothing to show.
+		if res.Value != nil {
+			h.scope.Set(resultVar, res.Value)
+		}
+		var text string
+		text, err = formatResult(res.Value, h.config)
+		resp.Result = "=> " + text
+		highlighted, _ := HighlightWith(text, Style{}, BackendHTML)
+		resp.ResultHTML = "=&gt; " + highlighted
+		if res.ReturnedError != nil {
+			resp.ReturnedError = res.ReturnedError.Error()
+		}
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	// The source is highlighted after it runs, so what it declares is known.
+	resp.SourceHTML, _ = HighlightWith(req.Source, Style{Scope: h.scope}, BackendHTML)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *evalHandler) snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+		return
+	}
+	done := h.use()
+	b, err := h.scope.SnapshotJSON(WithInspectDepth(h.config.InspectDepth), WithInspectMaxElems(h.config.InspectMaxElems))
+	done()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+func (h *evalHandler) complete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("use GET"))
+		return
+	}
+	line := r.URL.Query().Get("line")
+	pos := len(line)
+	if s := r.URL.Query().Get("pos"); len(s) > 0 {
+		var err error
+		if pos, err = strconv.Atoi(s); err != nil || pos < 0 || pos > len(line) {
+			writeJSONError(w, http.StatusBadRequest, errors.Errorf("pos must be between 0 and %d", len(line)))
+			return
+		}
+	}
+	done := h.use()
+	completions, start := Complete(h.scope, line, pos)
+	done()
+	if completions == nil {
+		completions = []Candidate{}
+	}
+	writeJSON(w, http.StatusOK, completeResponse{Completions: completions, Start: start})
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes err as a JSON response, {"error": "..."}.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// handlerPage is the page Handler serves at /. The token is kept for the tab
+// in sessionStorage.
+const handlerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>go-pry</title>
+<style>
+body { font-family: monospace; margin: 1em; }
+#log { white-space: pre-wrap; }
+.src { color: #555; }
+.error { color: #b00; }
+.warning { color: #a60; }
+#source { width: 100%; font-family: monospace; }
+` + HighlightCSS + `</style>
+</head>
+<body>
+<div id="log"></div>
+<form id="form"><input id="source" autocomplete="off" autofocus placeholder="Go statements, ENTER runs them"></form>
+<script>
+const log = document.getElementById("log");
+const source = document.getElementById("source");
+
+function token() {
+  let t = sessionStorage.getItem("pry-token");
+  if (!t) {
+    t = prompt("Token");
+    sessionStorage.setItem("pry-token", t || "");
+  }
+  return t;
+}
+
+function show(text, cls, html) {
+  const div = document.createElement("div");
+  div.className = cls;
+  if (html) {
+    div.innerHTML = html;
+  } else {
+    div.textContent = text;
+  }
+  log.appendChild(div);
+  window.scrollTo(0, document.body.scrollHeight);
+  return div;
+}
+
+document.getElementById("form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const src = source.value;
+  source.value = "";
+  const line = show("> " + src, "src");
+  const resp = await fetch("eval", {
+    method: "POST",
+    headers: {"Authorization": "Bearer " + token(), "Content-Type": "application/json"},
+    body: JSON.stringify({source: src}),
+  });
+  if (resp.status === 401) {
+    sessionStorage.removeItem("pry-token");
+  }
+  const out = await resp.json();
+  if (out.source_html) {
+    line.innerHTML = "&gt; " + out.source_html;
+  }
+  if (out.result) {
+    show(out.result, "result", out.result_html);
+  }
+  if (out.returned_error) {
+    show("Returned error: " + out.returned_error, "error");
+  }
+  for (const w of out.warnings || []) {
+    show("Warning: " + w, "warning");
+  }
+  if (out.error) {
+    show("Error: " + out.error, "error");
+  }
+});
+</script>
+</body>
+</html>
+`
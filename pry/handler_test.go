@@ -0,0 +1,139 @@
+package pry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// handlerRequest makes a request to h with the token "secret" and decodes
+// the JSON response into out.
+func handlerRequest(t *testing.T, h http.Handler, method, target, body string, out interface{}) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("%s %s: %v: %s", method, target, err, rec.Body.String())
+	}
+	return rec.Code
+}
+
+func TestHandlerEval(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("atoi", strconv.Atoi)
+	h := Handler(scope, "secret", WithLimits(Limits{MaxSteps: 1000}))
+	cases := []struct {
+		src  string
+		want evalResponse
+	}{
+		{"a := 2", evalResponse{Type: "int", Kind: "declaration"}},
+		{`atoi("x")`, evalResponse{Result: "=> 0", Type: "int", Kind: "expression", ReturnedError: `strconv.Atoi: parsing "x": invalid syntax`}},
+		{"a * 21", evalResponse{Result: "=> 42", Type: "int", Kind: "expression"}},
+		{"b", evalResponse{Kind: "statement", Error: "undefined: b"}},
+		{"for {}", evalResponse{Kind: "statement", Error: "the evaluation took more than the 1000 steps allowed"}},
+	}
+	for _, c := range cases {
+		body, _ := json.Marshal(evalRequest{Source: c.src})
+		var out evalResponse
+		if code := handlerRequest(t, h, http.MethodPost, "/eval", string(body), &out); code != http.StatusOK {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, http.StatusOK, code)
+		}
+		if len(out.Duration) == 0 {
+			t.Errorf("%s: Expected a duration.", c.src)
+		}
+		out.Duration = ""
+		if len(out.SourceHTML) == 0 {
+			t.Errorf("%s: Expected the source highlighted.", c.src)
+		}
+		if c.src == "a * 21" {
+			want := `<span class="pry-ident">a</span> <span class="pry-operator">*</span> <span class="pry-number">21</span>`
+			if out.SourceHTML != want || out.ResultHTML != `=&gt; <span class="pry-number">42</span>` {
+				t.Errorf("Expected %#v got %#v, %#v.", want, out.SourceHTML, out.ResultHTML)
+			}
+		}
+		out.SourceHTML, out.ResultHTML = "", ""
+		if strings.HasPrefix(out.Error, c.want.Error) {
+			out.Error = c.want.Error
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+	// Results are bound to _, as in the REPL.
+	if v, _ := scope.Get(resultVar); v != 42 {
+		t.Errorf("Expected %#v got %#v.", 42, v)
+	}
+	// The limits are only set while the requests run.
+	if _, ok := scope.currentLimits(); ok {
+		t.Errorf("Expected the limits to be removed.")
+	}
+
+	var out map[string]string
+	if code := handlerRequest(t, h, http.MethodGet, "/eval", "", &out); code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %#v got %#v.", http.StatusMethodNotAllowed, code)
+	}
+	if code := handlerRequest(t, h, http.MethodPost, "/eval", "{", &out); code != http.StatusBadRequest {
+		t.Errorf("Expected %#v got %#v.", http.StatusBadRequest, code)
+	}
+}
+
+func TestHandlerScopeAndComplete(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("count", 3)
+	scope.Set("counter", "x")
+	h := Handler(scope, "secret")
+
+	var vars map[string]VarSnapshot
+	handlerRequest(t, h, http.MethodGet, "/scope", "", &vars)
+	want := VarSnapshot{Type: "int", Kind: "int", Value: 3.0, Addressable: true}
+	if !reflect.DeepEqual(vars["count"], want) {
+		t.Errorf("Expected %#v got %#v.", want, vars["count"])
+	}
+
+	var out completeResponse
+	handlerRequest(t, h, http.MethodGet, "/complete?line="+url.QueryEscape("x := coun + 1")+"&pos=9", "", &out)
+	wantCompletions := completeResponse{Completions: []Candidate{{Text: "count", Kind: CandidateVariable, Type: "int"}, {Text: "counter", Kind: CandidateVariable, Type: "string"}}, Start: 5}
+	if !reflect.DeepEqual(out, wantCompletions) {
+		t.Errorf("Expected %#v got %#v.", wantCompletions, out)
+	}
+	var errOut map[string]string
+	if code := handlerRequest(t, h, http.MethodGet, "/complete?line=a&pos=5", "", &errOut); code != http.StatusBadRequest {
+		t.Errorf("Expected %#v got %#v.", http.StatusBadRequest, code)
+	}
+}
+
+func TestHandlerAuth(t *testing.T) {
+	t.Parallel()
+
+	h := Handler(NewScope(), "secret")
+	for _, auth := range []string{"", "Bearer wrong", "secret", "Basic c2VjcmV0"} {
+		req := httptest.NewRequest(http.MethodGet, "/scope", nil)
+		if len(auth) > 0 {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q: Expected %#v got %#v.", auth, http.StatusUnauthorized, rec.Code)
+		}
+	}
+
+	// The page is served to anyone; it asks for the token.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `fetch("eval"`) {
+		t.Errorf("Expected the page got %#v:\n%s", rec.Code, rec.Body.String())
+	}
+}
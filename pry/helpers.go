@@ -23,10 +23,24 @@ func (a *InterpretError) Error() error {
 // Append is a runtime replacement for the append function
 func Append(arr interface{}, elems ...interface{}) (interface{}, *InterpretError) {
 	arrVal := reflect.ValueOf(arr)
+	arrType := reflect.TypeOf(arr)
+	if arrType == nil || arrType.Kind() != reflect.Slice {
+		return nil, &InterpretError{newTypeError("append", "slice", arr)}
+	}
 	valArr := make([]reflect.Value, len(elems))
 	for i, elem := range elems {
-		if reflect.TypeOf(arr) != reflect.SliceOf(reflect.TypeOf(elem)) {
-			return nil, &InterpretError{fmt.Errorf("%T cannot append to %T", elem, arr)}
+		if elem == nil {
+			if v, ok := nilValue(arrType.Elem()); ok {
+				valArr[i] = v
+				continue
+			}
+		}
+		if elem == nil || arrType != reflect.SliceOf(reflect.TypeOf(elem)) {
+			return nil, &InterpretError{&TypeError{
+				Expected: arrType.Elem().String(),
+				Got:      reflect.TypeOf(elem),
+				Context:  "append",
+			}}
 		}
 		valArr[i] = reflect.ValueOf(elem)
 	}
@@ -37,7 +51,7 @@ func Append(arr interface{}, elems ...interface{}) (interface{}, *InterpretError
 func Make(t interface{}, args ...interface{}) (interface{}, *InterpretError) {
 	typ, isType := t.(reflect.Type)
 	if !isType {
-		return nil, &InterpretError{fmt.Errorf("invalid type %#v", t)}
+		return nil, &InterpretError{newTypeError("make", "type", t)}
 	}
 	switch typ.Kind() {
 	case reflect.Slice:
@@ -46,13 +60,13 @@ func Make(t interface{}, args ...interface{}) (interface{}, *InterpretError) {
 		}
 		length, isInt := args[0].(int)
 		if !isInt {
-			return nil, &InterpretError{errors.New("len is not int")}
+			return nil, &InterpretError{newTypeError("make len", "int", args[0])}
 		}
 		capacity := length
 		if len(args) == 2 {
-			capacity, isInt = args[0].(int)
+			capacity, isInt = args[1].(int)
 			if !isInt {
-				return nil, &InterpretError{errors.New("len is not int")}
+				return nil, &InterpretError{newTypeError("make cap", "int", args[1])}
 			}
 		}
 		if length < 0 || capacity < 0 {
@@ -71,7 +85,7 @@ func Make(t interface{}, args ...interface{}) (interface{}, *InterpretError) {
 			var isInt bool
 			size, isInt = args[0].(int)
 			if !isInt {
-				return nil, &InterpretError{errors.New("size is not int")}
+				return nil, &InterpretError{newTypeError("make size", "int", args[0])}
 			}
 		}
 		if size < 0 {
@@ -80,6 +94,23 @@ func Make(t interface{}, args ...interface{}) (interface{}, *InterpretError) {
 		buffer := reflect.MakeChan(typ, size)
 		return buffer.Interface(), nil
 
+	case reflect.Map:
+		if len(args) > 1 {
+			return nil, &InterpretError{errors.New("too many arguments")}
+		}
+		size := 0
+		if len(args) == 1 {
+			var isInt bool
+			size, isInt = args[0].(int)
+			if !isInt {
+				return nil, &InterpretError{newTypeError("make size", "int", args[0])}
+			}
+		}
+		if size < 0 {
+			return nil, &InterpretError{errors.Errorf("negative size hint")}
+		}
+		return reflect.MakeMapWithSize(typ, size).Interface(), nil
+
 	default:
 		return nil, &InterpretError{fmt.Errorf("unknown kind type %T", t)}
 	}
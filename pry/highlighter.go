@@ -1,75 +1,396 @@
 package pry
 
 import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"html"
+	"io"
+	"strings"
+
 	"github.com/mgutz/ansi"
+	"github.com/pkg/errors"
+)
 
-	"regexp"
-	"strings"
+// TokenClass is the syntactic class of a highlighted token.
+type TokenClass int
+
+// The token classes used for highlighting.
+const (
+	TokenPlain TokenClass = iota
+	TokenKeyword
+	TokenString
+	TokenNumber
+	TokenComment
+	TokenOperator
+	// TokenType is a predeclared type such as int or string.
+	TokenType
+	// TokenBuiltin is a builtin function such as len or append.
+	TokenBuiltin
+	// TokenConstant is a predeclared constant: true, false, nil or iota.
+	TokenConstant
+	// TokenIdent is an identifier defined in the scope.
+	TokenIdent
+	// TokenPackage is an identifier of the scope naming a package.
+	TokenPackage
+	// TokenUnknown is an identifier that isn't defined in the scope or
+	// predeclared, such as one being declared or misspelled. Identifiers are
+	// only classified as unknown if there is a scope to look them up in.
+	TokenUnknown
 )
 
-const highlightColor1 = "white+b"
-const highlightColor2 = "green+b"
-const highlightColor3 = "red"
-const highlightColor4 = "blue+b"
-const highlightColor5 = "red+b"
+var tokenClassNames = map[TokenClass]string{
+	TokenPlain:    "plain",
+	TokenKeyword:  "keyword",
+	TokenString:   "string",
+	TokenNumber:   "number",
+	TokenComment:  "comment",
+	TokenOperator: "operator",
+	TokenType:     "type",
+	TokenBuiltin:  "builtin",
+	TokenConstant: "constant",
+	TokenIdent:    "ident",
+	TokenPackage:  "package",
+	TokenUnknown:  "unknown",
+}
 
-// Highlight highlights a string of go code for outputting to bash.
+// String returns the name of the class, suitable for use as a CSS class.
+func (c TokenClass) String() string {
+	return tokenClassNames[c]
+}
+
+// TokenSpan is a classified token spanning the bytes [Start, End) of the
+// highlighted source.
+type TokenSpan struct {
+	Start, End int
+	Class      TokenClass
+}
+
+// Theme maps token classes, and the other parts of the output of a session,
+// to colors. The colors use the github.com/mgutz/ansi style syntax, e.g.
+// "green+b". An empty color leaves the text uncolored. Everything a session
+// colors goes through its theme, so NoColorTheme leaves the output plain.
+type Theme struct {
+	Keyword  string
+	String   string
+	Number   string
+	Comment  string
+	Operator string
+	Type     string
+	Builtin  string
+	Constant string
+	Ident    string
+	Package  string
+	Unknown  string
+
+	// Error colors error messages and Warning warnings.
+	Error   string
+	Warning string
+	// Prompt colors the prompt and LineNumber the line numbers of the
+	// source shown.
+	Prompt     string
+	LineNumber string
+}
+
+// DefaultTheme is the theme used unless colors are disabled.
+var DefaultTheme = Theme{
+	Keyword:  "white+b",
+	String:   "green",
+	Number:   "cyan",
+	Comment:  "blue+b",
+	Operator: "white+b",
+	Type:     "default+d",
+	Builtin:  "white+b",
+	Constant: "cyan",
+	Package:  "magenta",
+
+	Error:      "red",
+	Warning:    "yellow",
+	Prompt:     "blue+b",
+	LineNumber: "blue+b",
+}
+
+// NoColorTheme disables highlighting.
+var NoColorTheme = Theme{}
+
+// paint colors s with color, one of the colors of the theme.
+func (t Theme) paint(s, color string) string {
+	if len(color) == 0 {
+		return s
+	}
+	return ansi.Color(s, color)
+}
+
+func (t Theme) color(class TokenClass) string {
+	switch class {
+	case TokenKeyword:
+		return t.Keyword
+	case TokenString:
+		return t.String
+	case TokenNumber:
+		return t.Number
+	case TokenComment:
+		return t.Comment
+	case TokenOperator:
+		return t.Operator
+	case TokenType:
+		return t.Type
+	case TokenBuiltin:
+		return t.Builtin
+	case TokenConstant:
+		return t.Constant
+	case TokenIdent:
+		return t.Ident
+	case TokenPackage:
+		return t.Package
+	case TokenUnknown:
+		return t.Unknown
+	}
+	return ""
+}
+
+// Backend is the markup Highlight produces.
+type Backend int
+
+const (
+	// BackendANSI colors the tokens with ANSI escape sequences, for
+	// terminals.
+	BackendANSI Backend = iota
+	// BackendHTML escapes the source and wraps the tokens in spans with the
+	// classes of their TokenClass, e.g. <span class="pry-keyword">for</span>,
+	// which HighlightCSS colors. Plain tokens aren't wrapped.
+	BackendHTML
+)
+
+// Style is what Highlight uses to classify and color tokens.
+type Style struct {
+	// Theme colors the tokens of the ANSI backend. The HTML backend marks
+	// the tokens with classes instead, so pages color them with CSS.
+	Theme Theme
+	// Scope, if it's set, tells the identifiers it defines and the packages
+	// it imports apart from unknown identifiers.
+	Scope *Scope
+}
+
+// HighlightCSS is a stylesheet coloring the spans of BackendHTML like
+// DefaultTheme colors a terminal.
+const HighlightCSS = `.pry-keyword, .pry-operator, .pry-builtin { font-weight: bold; }
+.pry-string { color: #a31515; }
+.pry-number, .pry-comment, .pry-constant { color: #0000cc; }
+.pry-type { color: #267f26; font-weight: bold; }
+.pry-ident { color: #008b8b; }
+.pry-package { color: #8b008b; }
+`
+
+// Highlight highlights a string of go code for outputting to bash, with
+// DefaultTheme.
 func Highlight(s string) string {
-	highlightSymbols := []string{"==", "!=", ":=", "="}
-	highlightKeywords := []string{
-		"for", "defer", "func", "struct", "switch", "case",
-		"interface", "if", "range", "bool", "type", "package", "import",
-		"make", "append",
+	return DefaultTheme.Highlight(s, nil)
+}
+
+// HighlightWith highlights Go source with backend. Malformed and incomplete
+// source, such as a partially typed line, is highlighted as far as it can be
+// tokenized and the rest is left plain; it's only an error if backend is
+// unknown.
+func HighlightWith(src string, style Style, backend Backend) (string, error) {
+	switch backend {
+	case BackendANSI:
+		return style.Theme.Highlight(src, style.Scope), nil
+	case BackendHTML:
+		return highlightHTML(src, style.Scope), nil
+	}
+	return "", errors.Errorf("unknown highlight backend %d", backend)
+}
+
+// highlightHTML wraps the tokens of src in spans.
+func highlightHTML(src string, scope *Scope) string {
+	var b strings.Builder
+	last := 0
+	for _, span := range ClassifyTokens(src, scope) {
+		if span.Class == TokenPlain {
+			continue
+		}
+		b.WriteString(html.EscapeString(src[last:span.Start]))
+		fmt.Fprintf(&b, `<span class="pry-%s">%s</span>`, span.Class, html.EscapeString(src[span.Start:span.End]))
+		last = span.End
+	}
+	b.WriteString(html.EscapeString(src[last:]))
+	return b.String()
+}
+
+// Highlight highlights a string of go code for outputting to bash.
+// Incomplete code, such as a partially typed line, is highlighted as far as
+// it can be tokenized and is otherwise left untouched.
+func (t Theme) Highlight(line string, scope *Scope) string {
+	if t == NoColorTheme {
+		return line
+	}
+	var b strings.Builder
+	last := 0
+	for _, span := range ClassifyTokens(line, scope) {
+		color := t.color(span.Class)
+		if len(color) == 0 {
+			continue
+		}
+		b.WriteString(line[last:span.Start])
+		b.WriteString(ansi.Color(line[span.Start:span.End], color))
+		last = span.End
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// maxHighlightLine is the longest text highlightWriter keeps before
+// highlighting it without waiting for the end of its line.
+const maxHighlightLine = 4096
+
+// highlightWriter highlights what's written to it a line at a time, so text
+// that's streamed, such as results, is highlighted as it's written. Close
+// highlights what's left.
+type highlightWriter struct {
+	w     io.Writer
+	theme Theme
+	line  []byte
+}
+
+func (h *highlightWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			h.line = append(h.line, p...)
+			break
+		}
+		h.line = append(h.line, p[:i+1]...)
+		p = p[i+1:]
+		if err := h.flush(len(h.line)); err != nil {
+			return 0, err
+		}
+	}
+	if len(h.line) >= maxHighlightLine {
+		// Long lines are cut between elements, where no token is split.
+		cut := bytes.LastIndex(h.line, []byte(", "))
+		if cut < 0 {
+			cut = len(h.line)
+		} else {
+			cut += len(", ")
+		}
+		if err := h.flush(cut); err != nil {
+			return 0, err
+		}
 	}
-	highlightKeywordsSpaced := []string{"go"}
-	highlightTypes := []string{
-		"byte",
-		"complex128",
-		"complex64",
-		"error",
-		"float",
-		"float32",
-		"float64",
-		"int",
-		"int16",
-		"int32",
-		"int64",
-		"int8",
-		"rune",
-		"string",
-		"uint",
-		"uint16",
-		"uint32",
-		"uint64",
-		"uint8",
-		"uintptr",
+	return n, nil
+}
+
+// flush writes the first n bytes of the line highlighted.
+func (h *highlightWriter) flush(n int) error {
+	_, err := io.WriteString(h.w, h.theme.Highlight(string(h.line[:n]), nil))
+	h.line = h.line[:copy(h.line, h.line[n:])]
+	return err
+}
+
+// Close highlights what's left of the text.
+func (h *highlightWriter) Close() error {
+	if len(h.line) == 0 {
+		return nil
 	}
-	s = highlightWords(s, []string{"-?(0[xX])?\\d+((\\.|e-?)\\d+)*", "nil", "true", "false"}, highlightColor4, "\\W")
-	s = highlightWords(s, highlightKeywords, highlightColor1, "\\W")
-	s = highlightWords(s, highlightKeywordsSpaced, highlightColor1, "\\s")
-	s = highlightWords(s, highlightTypes, highlightColor2, "\\W")
-	s = highlightWords(s, highlightSymbols, highlightColor1, "")
-	s = highlightWords(s, []string{".+"}, highlightColor3, "\"")
-	s = highlightWords(s, []string{"\""}, highlightColor5, "")
-	s = highlightWords(s, []string{"//.+"}, highlightColor4, "")
-	return s
-}
-
-func highlightWords(s string, words []string, color, edges string) string {
-	lE := len(edges) - strings.Count(edges, "\\")
-	s = " " + s + " "
-	for _, word := range words {
-		r, _ := regexp.Compile(edges + word + edges)
-		s = (string)(r.ReplaceAllFunc(([]byte)(s), func(b []byte) []byte {
-			bStr := string(b)
-			return []byte(bStr[0:lE] + ansi.Color(bStr[lE:len(bStr)-lE], color) + bStr[len(bStr)-lE:])
-		}))
+	return h.flush(len(h.line))
+}
+
+// ClassifyTokens tokenizes line and returns the classified tokens in order.
+// Whitespace isn't included. Syntax errors are ignored so partially typed
+// code can be classified.
+func ClassifyTokens(line string, scope *Scope) []TokenSpan {
+	src := []byte(line)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) {}, scanner.ScanComments)
+
+	var spans []TokenSpan
+	last := 0
+	prev := token.ILLEGAL
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// Skip automatically inserted semicolons.
+		if tok == token.SEMICOLON && lit != ";" {
+			continue
+		}
+		start := file.Offset(pos)
+		length := len(lit)
+		if length == 0 {
+			length = len(tok.String())
+		}
+		end := start + length
+		if end > len(line) {
+			end = len(line)
+		}
+		if start < last || start >= end {
+			continue
+		}
+		last = end
+		class := classifyToken(tok, lit, scope)
+		if tok == token.IDENT && prev == token.PERIOD {
+			// Fields, methods and the members of packages aren't looked up.
+			class = TokenPlain
+		}
+		prev = tok
+		spans = append(spans, TokenSpan{
+			Start: start,
+			End:   end,
+			Class: class,
+		})
+	}
+	return spans
+}
+
+func classifyToken(tok token.Token, lit string, scope *Scope) TokenClass {
+	switch {
+	case tok.IsKeyword():
+		return TokenKeyword
+	case tok == token.STRING || tok == token.CHAR:
+		return TokenString
+	case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+		return TokenNumber
+	case tok == token.COMMENT:
+		return TokenComment
+	case tok.IsOperator():
+		return TokenOperator
+	case tok != token.IDENT:
+		return TokenPlain
+	}
+
+	if scope != nil {
+		v, ok := scope.Get(lit)
+		if !ok {
+			v, ok = scope.registeredValue(lit)
+		}
+		if ok {
+			if _, ok := v.(Package); ok {
+				return TokenPackage
+			}
+			return TokenIdent
+		}
 	}
-	if s[0] == ' ' {
-		s = s[1:]
+	switch types.Universe.Lookup(lit).(type) {
+	case *types.TypeName:
+		return TokenType
+	case *types.Builtin:
+		return TokenBuiltin
+	case *types.Const, *types.Nil:
+		return TokenConstant
 	}
-	if s[len(s)-1] == ' ' {
-		s = s[:len(s)-1]
+	if scope != nil {
+		if _, ok := loadRegisteredTypes()[lit]; ok {
+			return TokenType
+		}
+		return TokenUnknown
 	}
-	return s
+	return TokenPlain
 }
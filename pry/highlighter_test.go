@@ -1,9 +1,15 @@
 package pry
 
 import (
+	"bytes"
+	"html"
 	"io/ioutil"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/mgutz/ansi"
 )
 
 // Make sure the highlighter doesn't change the code.
@@ -15,7 +21,7 @@ func TestHighlightSafe(t *testing.T) {
 		t.Error(err)
 	}
 	fileStr := (string)(fileBytes)
-	highlight := Highlight(fileStr)
+	highlight := DefaultTheme.Highlight(fileStr, nil)
 
 	r, err := regexp.Compile("\\x1b\\[(.*?)m")
 	if err != nil {
@@ -29,3 +35,162 @@ func TestHighlightSafe(t *testing.T) {
 		t.Error("Highlighting has changed the code!")
 	}
 }
+
+func TestClassifyTokens(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("a", 1)
+
+	line := `for a := range len("x") { b = nil } // done`
+	var out []string
+	for _, span := range ClassifyTokens(line, scope) {
+		out = append(out, line[span.Start:span.End]+":"+span.Class.String())
+	}
+	want := []string{
+		"for:keyword", "a:ident", ":=:operator", "range:keyword",
+		"len:builtin", "(:operator", `"x":string`, "):operator",
+		"{:operator", "b:unknown", "=:operator", "nil:constant",
+		"}:operator", "// done:comment",
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestClassifyIdents(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings"})
+	scope.Set("s", "x")
+
+	line := `t := strings.ToUpper(s.x)`
+	var out []string
+	for _, span := range ClassifyTokens(line, scope) {
+		out = append(out, line[span.Start:span.End]+":"+span.Class.String())
+	}
+	want := []string{
+		"t:unknown", ":=:operator", "strings:package", ".:operator",
+		"ToUpper:plain", "(:operator", "s:ident", ".:operator", "x:plain",
+		"):operator",
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestHighlightHTML(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("a", 1)
+	out, err := HighlightWith(`if a < b { f("<&>") }`, Style{Scope: scope}, BackendHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<span class="pry-keyword">if</span> <span class="pry-ident">a</span> ` +
+		`<span class="pry-operator">&lt;</span> <span class="pry-unknown">b</span> ` +
+		`<span class="pry-operator">{</span> <span class="pry-unknown">f</span>` +
+		`<span class="pry-operator">(</span><span class="pry-string">&#34;&lt;&amp;&gt;&#34;</span>` +
+		`<span class="pry-operator">)</span> <span class="pry-operator">}</span>`
+	if out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	// Without a scope identifiers are left plain.
+	out, err = HighlightWith(`x := "unterminated <`, Style{}, BackendHTML)
+	want = `x <span class="pry-operator">:=</span> <span class="pry-string">&#34;unterminated &lt;</span>`
+	if err != nil || out != want {
+		t.Errorf("Expected %#v got %#v %v.", want, out, err)
+	}
+
+	out, err = HighlightWith("a", Style{Theme: NoColorTheme}, BackendANSI)
+	if err != nil || out != "a" {
+		t.Errorf("Expected %#v got %#v %v.", "a", out, err)
+	}
+	if _, err := HighlightWith("a", Style{}, Backend(10)); err == nil {
+		t.Errorf("Expected an error for an unknown backend.")
+	}
+}
+
+// Partially typed lines must be highlighted without losing any text.
+func TestHighlightIncomplete(t *testing.T) {
+	t.Parallel()
+
+	r := regexp.MustCompile("\\x1b\\[(.*?)m")
+	tags := regexp.MustCompile("<[^>]*>")
+	lines := []string{
+		`a := "unterminated`,
+		"x := `raw",
+		"/* comment",
+		"f(1.5e",
+		"'a",
+		"a @ # $",
+	}
+	for _, line := range lines {
+		out := Highlight(line)
+		if s := r.ReplaceAllLiteralString(out, ""); s != line {
+			t.Errorf("Highlight(%q) changed the code: %q", line, s)
+		}
+		out, err := HighlightWith(line, Style{Scope: NewScope()}, BackendHTML)
+		if s := html.UnescapeString(tags.ReplaceAllLiteralString(out, "")); err != nil || s != line {
+			t.Errorf("Highlight(%q) changed the code: %q %v", line, s, err)
+		}
+	}
+
+	out := DefaultTheme.Highlight(`s := "abc`, nil)
+	want := "s " + ansi.Color(":=", "white+b") + " " + ansi.Color(`"abc`, DefaultTheme.String)
+	if out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestNoColorTheme(t *testing.T) {
+	t.Parallel()
+
+	line := `for i := 0; i < 10; i++ { fmt.Println("x") }`
+	if out := NoColorTheme.Highlight(line, nil); out != line {
+		t.Errorf("Expected %#v got %#v.", line, out)
+	}
+}
+
+func TestHighlightWriter(t *testing.T) {
+	t.Parallel()
+
+	// Text written in pieces is highlighted like it's highlighted at once.
+	text := "=> []string{\"a\", \"b\"}\nmap[int]bool{1: true}\n// done"
+	var out bytes.Buffer
+	w := &highlightWriter{w: &out, theme: DefaultTheme}
+	for i := 0; i < len(text); i += 3 {
+		end := i + 3
+		if end > len(text) {
+			end = len(text)
+		}
+		if _, err := w.Write([]byte(text[i:end])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := DefaultTheme.Highlight(text, nil); out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+
+	// Long lines are highlighted as they're written, cut between elements.
+	out.Reset()
+	w = &highlightWriter{w: &out, theme: DefaultTheme}
+	long := "[]int{" + strings.Repeat("12345, ", 2*maxHighlightLine/7)
+	if _, err := w.Write([]byte(long)); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() == 0 || len(w.line) >= maxHighlightLine {
+		t.Errorf("Expected the line to be highlighted got %d bytes kept.", len(w.line))
+	}
+	w.Close()
+	plain := regexp.MustCompile("\\x1b\\[(.*?)m").ReplaceAllLiteralString(out.String(), "")
+	if plain != long {
+		t.Error("Highlighting has changed the text!")
+	}
+}
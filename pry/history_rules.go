@@ -0,0 +1,103 @@
+package pry
+
+import (
+	"regexp"
+	"strings"
+)
+
+// HistoryDedup is which repeated inputs the history drops.
+type HistoryDedup int
+
+const (
+	// HistoryKeepDuplicates keeps every input, the default.
+	HistoryKeepDuplicates HistoryDedup = iota
+	// HistoryDedupConsecutive drops inputs repeating the one before them.
+	HistoryDedupConsecutive
+	// HistoryDedupAll drops the earlier copies of inputs, keeping the most
+	// recent one.
+	HistoryDedupAll
+)
+
+func (d HistoryDedup) String() string {
+	switch d {
+	case HistoryKeepDuplicates:
+		return "off"
+	case HistoryDedupConsecutive:
+		return "consecutive"
+	case HistoryDedupAll:
+		return "all"
+	}
+	return "unknown"
+}
+
+// historyRules decide which inputs the history keeps, both in memory and in
+// the file.
+type historyRules struct {
+	// size is the number of records kept, the most recent ones. Zero keeps
+	// them all.
+	size        int
+	dedup       HistoryDedup
+	ignore      *regexp.Regexp
+	ignoreSpace bool
+}
+
+// historyRulesOf returns the history rules of c.
+func historyRulesOf(c *Config) historyRules {
+	return historyRules{
+		size:        c.HistorySize,
+		dedup:       c.HistoryDedup,
+		ignore:      c.HistoryIgnore,
+		ignoreSpace: c.HistoryIgnoreSpace,
+	}
+}
+
+// skip returns whether record is never added to the history.
+func (r historyRules) skip(record string) bool {
+	if r.ignoreSpace && strings.HasPrefix(record, " ") {
+		return true
+	}
+	return r.ignore != nil && r.ignore.MatchString(record)
+}
+
+// keeps returns whether adding record to records changes them.
+func (r historyRules) keeps(records []string, record string) bool {
+	if r.skip(record) {
+		return false
+	}
+	return r.dedup == HistoryKeepDuplicates || len(records) == 0 || records[len(records)-1] != record
+}
+
+// add returns records with record added, as the rules say.
+func (r historyRules) add(records []string, record string) []string {
+	if !r.keeps(records, record) {
+		return records
+	}
+	if r.dedup == HistoryDedupAll {
+		var kept []string
+		for _, other := range records {
+			if other != record {
+				kept = append(kept, other)
+			}
+		}
+		records = kept
+	}
+	return r.truncate(append(records, record))
+}
+
+// clean returns records as if they were added under the rules, which they
+// may not have been, such as records of a file written with other rules.
+func (r historyRules) clean(records []string) []string {
+	var kept []string
+	for _, record := range records {
+		kept = r.add(kept, record)
+	}
+	return kept
+}
+
+// truncate drops the oldest records beyond the size limit.
+func (r historyRules) truncate(records []string) []string {
+	if r.size > 0 && len(records) > r.size {
+		return records[len(records)-r.size:]
+	}
+	return records
+}
@@ -0,0 +1,109 @@
+package pry
+
+import "strings"
+
+// reverseSearch holds the state of an incremental reverse history search
+// (Ctrl-R).
+type reverseSearch struct {
+	active bool
+	query  string
+	// match is the index of the matching history record or -1.
+	match int
+	// original is the line being edited before the search started.
+	original      string
+	originalIndex int
+}
+
+// start begins a search, remembering the line so it can be restored.
+func (s *reverseSearch) start(line string, index int, records []string) {
+	*s = reverseSearch{
+		active:        true,
+		match:         -1,
+		original:      line,
+		originalIndex: index,
+	}
+	s.find(records, len(records)-1)
+}
+
+// find searches backwards through records starting at from for the query.
+// The current match is kept if nothing else matches.
+func (s *reverseSearch) find(records []string, from int) bool {
+	if from >= len(records) {
+		from = len(records) - 1
+	}
+	for i := from; i >= 0; i-- {
+		if strings.Contains(records[i], s.query) {
+			s.match = i
+			return true
+		}
+	}
+	return false
+}
+
+// failed returns whether the current query doesn't match the current record.
+func (s *reverseSearch) failed(records []string) bool {
+	return s.match < 0 || s.match >= len(records) || !strings.Contains(records[s.match], s.query)
+}
+
+// add appends r to the query and narrows the match.
+func (s *reverseSearch) add(r rune, records []string) {
+	s.query += string(r)
+	from := s.match
+	if from < 0 {
+		from = len(records) - 1
+	}
+	s.find(records, from)
+}
+
+// backspace removes the last character from the query.
+func (s *reverseSearch) backspace(records []string) {
+	if len(s.query) == 0 {
+		return
+	}
+	runes := []rune(s.query)
+	s.query = string(runes[:len(runes)-1])
+	s.match = -1
+	s.find(records, len(records)-1)
+}
+
+// next moves to the next older match.
+func (s *reverseSearch) next(records []string) {
+	if s.match < 0 {
+		s.find(records, len(records)-1)
+		return
+	}
+	s.find(records, s.match-1)
+}
+
+// accept returns the line selected by the search and ends it.
+func (s *reverseSearch) accept(records []string) string {
+	s.active = false
+	if s.failed(records) {
+		return s.original
+	}
+	return records[s.match]
+}
+
+// cancel ends the search and returns the original line and cursor.
+func (s *reverseSearch) cancel() (string, int) {
+	s.active = false
+	return s.original, s.originalIndex
+}
+
+// prompt renders the search in the standard readline style. Multi-line
+// matches only show their first line.
+func (s *reverseSearch) prompt(records []string) string {
+	prefix := "(reverse-i-search)"
+	var matched string
+	if s.failed(records) {
+		if len(s.query) > 0 {
+			prefix = "(failed reverse-i-search)"
+		}
+	} else {
+		matched = records[s.match]
+		if i := strings.Index(matched, "\n"); i >= 0 {
+			matched = matched[:i] + " [...]"
+		}
+	}
+	return prefix + "`" + s.query + "': " + matched
+}
@@ -0,0 +1,53 @@
+package pry
+
+import "testing"
+
+func TestReverseSearch(t *testing.T) {
+	t.Parallel()
+
+	records := []string{"a := 10", "b := 20", "a + b", "func() {\n\ta++\n}()"}
+	var s reverseSearch
+	s.start("partial", 3, records)
+	for _, r := range "a" {
+		s.add(r, records)
+	}
+	if out := s.prompt(records); out != "(reverse-i-search)`a': func() { [...]" {
+		t.Errorf("prompt() = %q", out)
+	}
+	s.add(' ', records)
+	if out := s.prompt(records); out != "(reverse-i-search)`a ': a + b" {
+		t.Errorf("prompt() = %q", out)
+	}
+	s.next(records)
+	if out := s.prompt(records); out != "(reverse-i-search)`a ': a := 10" {
+		t.Errorf("prompt() = %q", out)
+	}
+	// No older matches, keep the current one.
+	s.next(records)
+	if out := s.accept(records); out != "a := 10" {
+		t.Errorf("accept() = %q", out)
+	}
+	if s.active {
+		t.Error("search should be inactive after accept")
+	}
+}
+
+func TestReverseSearchFailedAndCancel(t *testing.T) {
+	t.Parallel()
+
+	records := []string{"a := 10"}
+	var s reverseSearch
+	s.start("partial", 3, records)
+	s.add('z', records)
+	if out := s.prompt(records); out != "(failed reverse-i-search)`z': " {
+		t.Errorf("prompt() = %q", out)
+	}
+	s.backspace(records)
+	if out := s.prompt(records); out != "(reverse-i-search)`': a := 10" {
+		t.Errorf("prompt() = %q", out)
+	}
+	line, index := s.cancel()
+	if line != "partial" || index != 3 {
+		t.Errorf("cancel() = %q, %d; expected partial, 3", line, index)
+	}
+}
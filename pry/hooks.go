@@ -0,0 +1,172 @@
+package pry
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Hooks observe the evaluations in a scope, such as to keep an audit trail.
+// They run for REPL input, :load'ed files and calls to Eval alike. Any of
+// them can be nil. A hook that panics is logged and otherwise ignored.
+type Hooks struct {
+	// BeforeEval is called with the source about to be evaluated. Returning
+	// an error vetoes the evaluation, which fails with it.
+	BeforeEval func(src string) error
+	// AfterEval is called with the result of every evaluation, including
+	// the vetoed ones.
+	AfterEval func(src string, result Result, err error)
+	// OnScopeChange is called when a variable is defined or assigned, with
+	// its previous value, or nil if it's new, and its new value. Changes
+	// made through pointers, such as to fields or elements, aren't seen.
+	OnScopeChange func(name string, old, new interface{})
+}
+
+// AddHooks runs h for the evaluations in scope and its children until the
+// returned function is called.
+func (scope *Scope) AddHooks(h Hooks) (remove func()) {
+	entry := &h
+	scope.Lock()
+	scope.hookList = append(scope.hookList, entry)
+	scope.Unlock()
+	return func() {
+		scope.Lock()
+		defer scope.Unlock()
+		for i, e := range scope.hookList {
+			if e == entry {
+				scope.hookList = append(scope.hookList[:i:i], scope.hookList[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// hooks returns the hooks of scope and its parents.
+func (scope *Scope) hooks() []*Hooks {
+	var hooks []*Hooks
+	for s := scope; s != nil; s = s.Parent {
+		s.Lock()
+		hooks = append(hooks, s.hookList...)
+		s.Unlock()
+	}
+	return hooks
+}
+
+// beforeEval runs the BeforeEval hooks and returns the first veto.
+func beforeEval(hooks []*Hooks, src string) error {
+	for _, h := range hooks {
+		if h.BeforeEval == nil {
+			continue
+		}
+		var err error
+		runHook("BeforeEval", func() { err = h.BeforeEval(src) })
+		if err != nil {
+			return errors.Wrap(err, "vetoed")
+		}
+	}
+	return nil
+}
+
+// afterEval runs the AfterEval hooks.
+func afterEval(hooks []*Hooks, src string, res *Result, err error) {
+	for _, h := range hooks {
+		if h.AfterEval != nil {
+			runHook("AfterEval", func() { h.AfterEval(src, *res, err) })
+		}
+	}
+}
+
+// scopeChanged runs the OnScopeChange hooks.
+func scopeChanged(hooks []*Hooks, name string, old, new interface{}) {
+	for _, h := range hooks {
+		if h.OnScopeChange != nil {
+			runHook("OnScopeChange", func() { h.OnScopeChange(name, old, new) })
+		}
+	}
+}
+
+// runHook calls fn, logging rather than propagating its panics.
+func runHook(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("pry: the %s hook panicked: %v", name, r)
+		}
+	}()
+	fn()
+}
+
+// JSONLogHooks returns hooks that write a JSON object per line to w for
+// every evaluation and change of a variable, such as:
+//
+//	{"time":"...","event":"eval","src":"x := 1","kind":"declaration","value":"1","type":"int","duration":"12µs"}
+//	{"time":"...","event":"set","name":"x","new":"1"}
+//
+// Values are formatted the way the REPL prints them. Errors writing to w are ignored.
+func JSONLogHooks(w io.Writer) Hooks {
+	var mu sync.Mutex
+	write := func(entry map[string]interface{}) {
+		entry["time"] = time.Now().Format(time.RFC3339Nano)
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(line, '\n'))
+	}
+	return Hooks{
+		AfterEval: func(src string, result Result, err error) {
+			entry := map[string]interface{}{
+				"event":    "eval",
+				"src":      src,
+				"kind":     result.Kind.String(),
+				"duration": result.Duration.String(),
+			}
+			if err != nil {
+				entry["error"] = err.Error()
+			} else if result.Kind == ResultExpression || result.Value != nil {
+				entry["value"] = formatValue(result.Value)
+			}
+			if result.ReturnedError != nil {
+				entry["returned_error"] = result.ReturnedError.Error()
+			}
+			if result.Type != nil {
+				entry["type"] = result.Type.String()
+			}
+			if len(result.Declared) > 0 {
+				entry["declared"] = result.Declared
+			}
+			write(entry)
+		},
+		OnScopeChange: func(name string, old, new interface{}) {
+			entry := map[string]interface{}{
+				"event": "set",
+				"name":  name,
+				"new":   formatValue(new),
+			}
+			if old != nil {
+				entry["old"] = formatValue(old)
+			}
+			write(entry)
+		},
+	}
+}
+
+// derefValue returns the value a scope keeps behind the pointer ptr.
+func derefValue(ptr interface{}) interface{} {
+	if ptr == nil {
+		return nil
+	}
+	if _, isType := ptr.(reflect.Type); isType {
+		return ptr
+	}
+	if v := reflect.ValueOf(ptr); v.Kind() == reflect.Ptr && !v.IsNil() {
+		return v.Elem().Interface()
+	}
+	return ptr
+}
@@ -0,0 +1,142 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestHooks(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	forbidden := 0
+	scope.Set("forbidden", func() { forbidden++ })
+	var events []string
+	remove := scope.AddHooks(Hooks{
+		BeforeEval: func(src string) error {
+			events = append(events, "before "+src)
+			if strings.Contains(src, "forbidden") {
+				return errors.New("not allowed")
+			}
+			return nil
+		},
+		AfterEval: func(src string, result Result, err error) {
+			events = append(events, fmt.Sprintf("after %s: %#v %s %v", src, result.Value, result.Kind, err))
+		},
+		OnScopeChange: func(name string, old, new interface{}) {
+			events = append(events, fmt.Sprintf("set %s: %#v -> %#v", name, old, new))
+		},
+	})
+	// A panicking hook doesn't break the evaluation.
+	scope.AddHooks(Hooks{
+		BeforeEval:    func(string) error { panic("boom") },
+		AfterEval:     func(string, Result, error) { panic("boom") },
+		OnScopeChange: func(string, interface{}, interface{}) { panic("boom") },
+	})
+
+	if _, err := Eval(context.Background(), scope, "x := 1; x = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Eval(context.Background(), scope, "forbidden()"); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("expected the evaluation to be vetoed, got %v", err)
+	}
+	if forbidden != 0 {
+		t.Errorf("the vetoed evaluation ran")
+	}
+	if _, err := scope.load("fixture.go", "y := 3\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Child scopes run the hooks of their parents.
+	if _, err := Eval(context.Background(), scope.NewChild(), "x"); err != nil {
+		t.Fatal(err)
+	}
+	remove()
+	if _, err := Eval(context.Background(), scope, "x = 4"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"before x := 1; x = 2",
+		"set x: <nil> -> 1",
+		"set x: 1 -> 2",
+		"after x := 1; x = 2: 2 statement <nil>",
+		"before forbidden()",
+		"after forbidden(): <nil> statement vetoed: not allowed",
+		"before y := 3\n",
+		"set y: <nil> -> 3",
+		"after y := 3\n: <nil> declaration <nil>",
+		"before x",
+		"after x: 2 expression <nil>",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected %#v got %#v.", want, events)
+	}
+}
+
+func TestJSONLogHooks(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	scope := NewScope()
+	scope.AddHooks(JSONLogHooks(&buf))
+	Eval(context.Background(), scope, "a := 40")
+	Eval(context.Background(), scope, "a + 2")
+	Eval(context.Background(), scope, "missing")
+
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		if _, ok := entry["time"]; !ok {
+			t.Errorf("%q has no time", line)
+		}
+		if _, ok := entry["duration"]; !ok && entry["event"] == "eval" {
+			t.Errorf("%q has no duration", line)
+		}
+		delete(entry, "time")
+		delete(entry, "duration")
+		entries = append(entries, entry)
+	}
+	want := []map[string]interface{}{
+		{"event": "set", "name": "a", "new": "40"},
+		{"event": "eval", "src": "a := 40", "kind": "declaration", "value": "40", "type": "int", "declared": []interface{}{"a"}},
+		{"event": "eval", "src": "a + 2", "kind": "expression", "value": "42", "type": "int"},
+		{"event": "eval", "src": "missing", "kind": "statement", "error": "undefined: missing"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Expected %#v got %#v.", want, entries)
+	}
+}
+
+func TestREPLHooks(t *testing.T) {
+	t.Parallel()
+
+	var log bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader("a := 2\n"),
+		Out:     &bytes.Buffer{},
+		Options: []Option{WithHistoryFile(""), WithHooks(JSONLogHooks(&log))},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"src":"a := 2"`, `"name":"a"`} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("Expected %q in the log:\n%s", want, log.String())
+		}
+	}
+	// The hooks are removed with the session.
+	if hooks := repl.Scope.hooks(); len(hooks) != 0 {
+		t.Errorf("Expected no hooks got %d.", len(hooks))
+	}
+}
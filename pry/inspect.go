@@ -0,0 +1,758 @@
+package pry
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// The defaults of the Inspect settings of Config.
+const (
+	defaultInspectDepth    = 3
+	defaultInspectWidth    = 80
+	defaultInspectMaxElems = 100
+	// defaultInspectMaxString is about a screenful.
+	defaultInspectMaxString = 1024
+	// inlineHexBytes is the number of bytes BytesHex shows inline.
+	inlineHexBytes = 16
+)
+
+// BytesFormat is how Inspect shows the bytes of []byte and [N]byte values.
+type BytesFormat int
+
+const (
+	// BytesHex shows binary data in hex, inline like []uint8{0xde, 0xad}
+	// if it's 16 bytes or less and as a hex dump otherwise.
+	BytesHex BytesFormat = iota
+	// BytesDump shows every byte slice and array as a hex dump, with the
+	// offsets and the printable characters of each row of 16 bytes.
+	BytesDump
+	// BytesGo shows the bytes like the elements of other slices, except
+	// that byte slices that are valid UTF-8 are shown as strings.
+	BytesGo
+)
+
+func (f BytesFormat) String() string {
+	switch f {
+	case BytesHex:
+		return "hex"
+	case BytesDump:
+		return "dump"
+	case BytesGo:
+		return "go"
+	}
+	return "unknown"
+}
+
+// Inspect renders v for people to read, the way the REPL prints results.
+// Values that don't fit the width, and structs holding other composite
+// values, are broken over lines indented by two spaces. Structs show their
+// field names, unexported ones included. The type of v is shown once, before
+// it; inside it only values whose type isn't clear from where they are, such
+// as in an interface{}, are annotated with it, like int64(1). Pointers are
+// shown as the value they point to, like &pry.Config{...}, but pointers to
+// pointers only by the address they hold. Nil pointers outside of composite
+// values show their type, like (*pry.Config)(nil). Values referring back to
+// a value they're part of show the number it's marked with, like &ref(#1),
+// instead of repeating it.
+//
+// Functions are shown by their signature, name and where they're defined,
+// like func strings.ToUpper(string) string at strings/strings.go:742, and
+// channels by how many elements they hold, like chan int (len 3, cap 10,
+// open). The internal state of the types of package sync, like sync.Mutex,
+// isn't shown unless WithInspectRaw is passed.
+//
+// Values with a formatter registered with RegisterFormatter, or a String or
+// Error method, are shown as what it returns, like net.IP(127.0.0.1), unless
+// WithInspectRaw is passed. Methods that panic are ignored. With
+// WithInspectHumanize, integers are shown as byte sizes too, like
+// 1048576 (1.0 MB), unless WithInspectRaw is passed.
+//
+// The depth, width, number of elements and length of strings shown are set
+// with WithInspectDepth, WithInspectWidth, WithInspectMaxElems and
+// WithInspectMaxString; other options are ignored except WithInspectRaw and
+// WithInspectHumanize.
+func Inspect(v interface{}, opts ...Option) string {
+	c := &Config{
+		InspectDepth:     defaultInspectDepth,
+		InspectWidth:     defaultInspectWidth,
+		InspectMaxElems:  defaultInspectMaxElems,
+		InspectMaxString: defaultInspectMaxString,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c.inspect(v)
+}
+
+// inspect renders v with the Inspect settings of c.
+func (c *Config) inspect(v interface{}) string {
+	var b builderSink
+	c.writeInspect(&b, v, false)
+	return b.String()
+}
+
+// writeInspect renders v to s with the Inspect settings of c, stopping once
+// s is full. bare leaves out the type of v itself, which the REPL shows after
+// it, so it's rendered like {Name: "a"}, 127.0.0.1 or nil.
+func (c *Config) writeInspect(s inspectSink, v interface{}, bare bool) {
+	in := &inspector{config: c, path: map[inspectKey]*inspectNode{}}
+	var root *inspectNode
+	if v == nil {
+		root = &inspectNode{text: "nil"}
+	} else if text, ok := inspectString(reflect.ValueOf(v)); ok && bare && !c.InspectRaw {
+		root = &inspectNode{text: text}
+	} else {
+		root = in.node(reflect.ValueOf(v), 0, !bare, bare)
+	}
+	root.number(new(int))
+	root.render(s, 0, c.InspectWidth)
+}
+
+// inspectSink receives rendered text. Rendering stops early once it's full.
+type inspectSink interface {
+	write(s string)
+	full() bool
+}
+
+// builderSink collects rendered text.
+type builderSink struct {
+	strings.Builder
+}
+
+func (b *builderSink) write(s string) { b.WriteString(s) }
+
+func (b *builderSink) full() bool { return false }
+
+// measureSink counts the columns rendered text takes up, until there are
+// more than max.
+type measureSink struct {
+	columns, max int
+}
+
+func (m *measureSink) write(s string) { m.columns += stringWidth(s) }
+
+func (m *measureSink) full() bool { return m.columns > m.max }
+
+// inspectKey identifies a pointer, map or slice being inspected.
+type inspectKey struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// inspector builds the tree of nodes Inspect renders.
+type inspector struct {
+	config *Config
+	// path holds the values containing the one being inspected, so values
+	// referring back to them are found.
+	path map[inspectKey]*inspectNode
+}
+
+// inspectNode is a rendered value: either text, or a composite of text
+// followed by its children in braces.
+type inspectNode struct {
+	// label comes before the value, such as the name of a field, and key
+	// is the key of map elements.
+	label string
+	key   *inspectNode
+	// text is the value itself, or the type of a composite if it's
+	// annotated.
+	text      string
+	composite bool
+	// expand is set for structs holding composite values, which are always
+	// broken over lines if there's a width.
+	expand   bool
+	children []*inspectNode
+	// dump holds the bytes shown as a hex dump when n is broken over lines.
+	dump []byte
+	// hexElems shows the elements, which are bytes, in hex.
+	hexElems bool
+	// elems holds the elements of slices and arrays of scalars instead of
+	// children. They're only inspected while they're rendered, so huge
+	// slices aren't held in memory a second time.
+	elems        reflect.Value
+	nElems       int
+	elemAnnotate bool
+	in           *inspector
+	// more is the number of elements left out.
+	more int
+
+	// referred is set when a value inside this one refers back to it, and
+	// ref is the number it's marked with.
+	referred bool
+	ref      int
+	// target is the value a back reference refers to, and prefix what comes
+	// before "ref".
+	target *inspectNode
+	prefix string
+}
+
+// enter adds n, the value identified by key, to the path until leave is
+// called. If the value is already on it, it returns a back reference to it
+// instead.
+func (in *inspector) enter(key inspectKey, n *inspectNode, prefix string) (leave func(), ref *inspectNode) {
+	if target, ok := in.path[key]; ok {
+		target.referred = true
+		return nil, &inspectNode{target: target, prefix: prefix}
+	}
+	in.path[key] = n
+	return func() { delete(in.path, key) }, nil
+}
+
+// node builds the node of v, nested depth levels deep. annotate is set when
+// the type of v isn't shown by its container, and elide when it's a composite
+// whose type can be left out, as in the elements of a composite literal.
+func (in *inspector) node(v reflect.Value, depth int, annotate, elide bool) *inspectNode {
+	typ := v.Type()
+	if typ == funcType && !v.IsNil() {
+		// Functions defined in the REPL are shown as what they are, not
+		// as the *Func holding them.
+		return &inspectNode{text: v.Interface().(*Func).String()}
+	}
+	if !in.config.InspectRaw {
+		if s, ok := inspectString(v); ok {
+			return &inspectNode{text: typ.String() + "(" + s + ")"}
+		}
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return &inspectNode{text: "nil"}
+		}
+		return in.node(v.Elem(), depth, true, false)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return &inspectNode{text: annotated(annotate, "("+typ.String()+")(nil)", "nil")}
+		}
+		elem := v.Elem()
+		if elem.Kind() == reflect.Ptr || elem.Kind() == reflect.UnsafePointer {
+			// Only one level is dereferenced, so chains of pointers show
+			// the address the first one points to.
+			return &inspectNode{text: pointerPrefix(v, in.config.InspectRaw) + "&" + pointerAddress(elem)}
+		}
+		n := &inspectNode{}
+		leave, ref := in.enter(inspectKey{ptr: v.Pointer(), typ: typ}, n, "&")
+		if ref != nil {
+			return ref
+		}
+		defer leave()
+		elemNode := in.node(elem, depth, !isComposite(elem.Kind()), elide)
+		// Values inside elem may have referred back to n.
+		elemNode.referred = elemNode.referred || n.referred
+		*n = *elemNode
+		n.text = pointerPrefix(v, in.config.InspectRaw) + "&" + n.text
+		return n
+
+	case reflect.Map:
+		if v.IsNil() {
+			return &inspectNode{text: annotated(annotate, typ.String()+"(nil)", "nil")}
+		}
+		n := &inspectNode{text: annotated(!elide, typ.String(), ""), composite: true}
+		if in.tooDeep(n, depth) {
+			return n
+		}
+		leave, ref := in.enter(inspectKey{ptr: v.Pointer(), typ: typ}, n, "")
+		if ref != nil {
+			return ref
+		}
+		defer leave()
+		keys := sortedKeys(v)
+		keys, n.more = in.elems(keys)
+		for _, key := range keys {
+			child := in.node(v.MapIndex(key), depth+1, typ.Elem().Kind() == reflect.Interface, true)
+			child.key = in.node(key, depth+1, typ.Key().Kind() == reflect.Interface, true)
+			n.children = append(n.children, child)
+			n.expand = n.expand || child.expand
+		}
+		return n
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return &inspectNode{text: annotated(annotate, typ.String()+"(nil)", "nil")}
+		}
+		isBytes := typ.Elem() == reflect.TypeOf(byte(0))
+		if isBytes && v.Kind() == reflect.Slice && in.config.InspectBytes == BytesGo && utf8.Valid(v.Bytes()) {
+			text := in.quote(string(v.Bytes()))
+			return &inspectNode{text: annotated(!elide, typ.String()+"("+text+")", text)}
+		}
+		n := &inspectNode{text: annotated(!elide, typ.String(), ""), composite: true}
+		if in.tooDeep(n, depth) {
+			return n
+		}
+		if isBytes && in.config.InspectBytes != BytesGo {
+			in.bytes(n, v)
+			return n
+		}
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			leave, ref := in.enter(inspectKey{ptr: v.Pointer(), typ: typ, len: v.Len()}, n, "")
+			if ref != nil {
+				return ref
+			}
+			defer leave()
+		}
+		count := v.Len()
+		if max := in.config.InspectMaxElems; max > 0 && count > max {
+			n.more = count - max
+			count = max
+		}
+		if scalarKind(typ.Elem().Kind()) {
+			n.elems, n.nElems, n.elemAnnotate, n.in = v, count, typ.Elem().Kind() == reflect.Interface, in
+			return n
+		}
+		for i := 0; i < count; i++ {
+			child := in.node(v.Index(i), depth+1, typ.Elem().Kind() == reflect.Interface, true)
+			n.children = append(n.children, child)
+			n.expand = n.expand || child.expand
+		}
+		return n
+
+	case reflect.Func:
+		if !v.IsNil() {
+			return &inspectNode{text: pointerPrefix(v, in.config.InspectRaw) + funcText(v)}
+		}
+
+	case reflect.Chan:
+		if !v.IsNil() {
+			return &inspectNode{text: pointerPrefix(v, in.config.InspectRaw) + chanText(v)}
+		}
+
+	case reflect.Struct:
+		if typ.PkgPath() == "sync" && !in.config.InspectRaw {
+			// The fields of mutexes and the like are their internal state,
+			// which means nothing to people reading them.
+			return &inspectNode{text: typ.String() + "{<internal>}"}
+		}
+		n := &inspectNode{text: annotated(!elide, typ.String(), ""), composite: true}
+		if in.tooDeep(n, depth) {
+			return n
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := typ.Field(i)
+			child := in.node(v.Field(i), depth+1, field.Type.Kind() == reflect.Interface, false)
+			child.label = field.Name + ": "
+			n.children = append(n.children, child)
+			n.expand = n.expand || child.composite && child.len() > 0
+		}
+		return n
+	}
+	var text string
+	if v.Kind() == reflect.String {
+		text = in.quote(v.String())
+	} else {
+		text = inspectLeaf(v)
+	}
+	if annotate && !obviousType(typ) {
+		text = typ.String() + "(" + text + ")"
+	}
+	if in.config.InspectHumanize && !in.config.InspectRaw {
+		text += byteSize(v)
+	}
+	return &inspectNode{text: text}
+}
+
+// pointerPrefix returns the address form of the pointer v followed by a
+// space if raw is set, for when the identity of what it points to matters,
+// and nothing otherwise.
+func pointerPrefix(v reflect.Value, raw bool) string {
+	if !raw {
+		return ""
+	}
+	return pointerAddress(v) + " "
+}
+
+// pointerAddress returns the pointer v in the form Go prints it, like
+// (*int)(0xc000012345) or (*int)(nil).
+func pointerAddress(v reflect.Value) string {
+	if v.IsNil() {
+		return "(" + v.Type().String() + ")(nil)"
+	}
+	return fmt.Sprintf("(%s)(%#x)", v.Type(), v.Pointer())
+}
+
+// funcText describes the func v by its signature and, if it's a function
+// compiled into the program, its name and where it's defined, like
+// func strings.ToUpper(string) string at strings/strings.go:742.
+func funcText(v reflect.Value) string {
+	typ := v.Type()
+	sig := typ.String()
+	if len(typ.Name()) > 0 {
+		in := make([]reflect.Type, typ.NumIn())
+		for i := range in {
+			in[i] = typ.In(i)
+		}
+		out := make([]reflect.Type, typ.NumOut())
+		for i := range out {
+			out[i] = typ.Out(i)
+		}
+		sig = reflect.FuncOf(in, out, typ.IsVariadic()).String()
+	}
+	text := sig
+	// Functions made with reflect.MakeFunc, such as those the REPL hands
+	// to Go code, are all named after the stub calling them.
+	if fn := runtime.FuncForPC(v.Pointer()); fn != nil && !strings.HasPrefix(fn.Name(), "reflect.") {
+		name := fn.Name()
+		// Names start with the import path of their package.
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		file, line := fn.FileLine(fn.Entry())
+		text = "func " + name + strings.TrimPrefix(sig, "func") +
+			" at " + filepath.Base(filepath.Dir(file)) + "/" + filepath.Base(file) + ":" + strconv.Itoa(line)
+	}
+	if len(typ.Name()) > 0 {
+		text = typ.String() + "(" + text + ")"
+	}
+	return text
+}
+
+// hchan mirrors the start of the runtime's channel header, up to whether the
+// channel is closed, which reflect can't tell without receiving from it.
+type hchan struct {
+	qcount   uint
+	dataqsiz uint
+	buf      unsafe.Pointer
+	elemsize uint16
+	closed   uint32
+}
+
+// chanText describes the channel v by its type, the number of elements
+// queued in it and whether it's closed, like chan int (len 3, cap 10, open).
+func chanText(v reflect.Value) string {
+	state := "open"
+	if atomic.LoadUint32(&(*hchan)(unsafe.Pointer(v.Pointer())).closed) != 0 {
+		state = "closed"
+	}
+	return fmt.Sprintf("%s (len %d, cap %d, %s)", v.Type(), v.Len(), v.Cap(), state)
+}
+
+// bytes fills in n, the node of the []byte or [N]byte v, to show the bytes
+// in hex, as a dump if they're too many to show inline.
+func (in *inspector) bytes(n *inspectNode, v reflect.Value) {
+	count := v.Len()
+	max := in.config.InspectMaxElems
+	dump := in.config.InspectBytes == BytesDump || count > inlineHexBytes
+	if dump && max > 0 {
+		// Dumps show full rows.
+		max = (max + 15) / 16 * 16
+	}
+	if max > 0 && count > max {
+		n.more = count - max
+		count = max
+	}
+	if dump && count > 0 {
+		n.dump = make([]byte, count)
+		reflect.Copy(reflect.ValueOf(n.dump), v)
+		n.expand = true
+	}
+	n.elems, n.nElems, n.hexElems, n.in = v, count, true, in
+}
+
+// tooDeep elides the children of n if it's more than the allowed depth deep.
+func (in *inspector) tooDeep(n *inspectNode, depth int) bool {
+	if max := in.config.InspectDepth; max > 0 && depth >= max {
+		n.composite = false
+		n.text += "{…}"
+		return true
+	}
+	return false
+}
+
+// byteSize returns the size the integer v is as a number of bytes, like
+// " (1.5 KB)", if it's 1024 or more, and "" otherwise.
+func byteSize(v reflect.Value) string {
+	var n uint64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return ""
+		}
+		n = uint64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n = v.Uint()
+	default:
+		return ""
+	}
+	if n < 1024 {
+		return ""
+	}
+	return " (" + humanBytes(n) + ")"
+}
+
+// quote quotes s, cut after the number of bytes strings are shown with,
+// between characters.
+func (in *inspector) quote(s string) string {
+	max := in.config.InspectMaxString
+	if max <= 0 || len(s) <= max {
+		return strconv.Quote(s)
+	}
+	n := graphemeStart(s, max)
+	return strconv.Quote(s[:n]) + fmt.Sprintf("… (+%d bytes)", len(s)-n)
+}
+
+// annotated returns withType if the type of a value is annotated and
+// without otherwise.
+func annotated(annotate bool, withType, without string) string {
+	if annotate {
+		return withType
+	}
+	return without
+}
+
+// elems returns the elements of keys that are shown and how many are left
+// out.
+func (in *inspector) elems(keys []reflect.Value) ([]reflect.Value, int) {
+	if max := in.config.InspectMaxElems; max > 0 && len(keys) > max {
+		return keys[:max], len(keys) - max
+	}
+	return keys, 0
+}
+
+// isComposite returns whether values of kind are shown with braces.
+func isComposite(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// scalarKind returns whether values of kind have neither elements nor
+// values they refer to.
+func scalarKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
+}
+
+// obviousType returns whether typ is the type a Go constant of its values
+// defaults to, such as int for 1, so it doesn't need to be shown.
+func obviousType(typ reflect.Type) bool {
+	switch typ {
+	case reflect.TypeOf(0), reflect.TypeOf(0.0), reflect.TypeOf(""), reflect.TypeOf(false), reflect.TypeOf(0i):
+		return true
+	}
+	return false
+}
+
+var (
+	funcType     = reflect.TypeOf((*Func)(nil))
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// inspectString returns what the formatter registered for v, or else its
+// String method, returns, which describe it better than its fields.
+func inspectString(v reflect.Value) (s string, ok bool) {
+	if s, ok := formatRegistered(v); ok {
+		return s, true
+	}
+	if !v.CanInterface() || v.Kind() == reflect.Interface {
+		return "", false
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return "", false
+	}
+	defer func() {
+		// Methods that panic are shown as if the values didn't have them.
+		if recover() != nil {
+			s, ok = "", false
+		}
+	}()
+	if v.Type().Implements(stringerType) {
+		return v.Interface().(fmt.Stringer).String(), true
+	}
+	return "", false
+}
+
+// inspectLeaf formats the value v, which has no elements.
+func inspectLeaf(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		s := strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+		// Floats that look like integers are told apart by their point.
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+// number numbers the values referred back to in the order they're shown.
+func (n *inspectNode) number(next *int) {
+	if n.key != nil {
+		n.key.number(next)
+	}
+	if n.referred {
+		*next++
+		n.ref = *next
+	}
+	for _, child := range n.children {
+		child.number(next)
+	}
+}
+
+// head returns the label, the mark and the text of n.
+func (n *inspectNode) head() string {
+	label := n.label
+	if n.key != nil {
+		label = n.key.flat() + ": "
+	}
+	if n.target != nil {
+		return label + n.prefix + "ref(#" + strconv.Itoa(n.target.ref) + ")"
+	}
+	if n.ref > 0 {
+		return label + "#" + strconv.Itoa(n.ref) + " " + n.text
+	}
+	return label + n.text
+}
+
+// len returns the number of elements of n that are shown.
+func (n *inspectNode) len() int {
+	if n.elems.IsValid() {
+		return n.nElems
+	}
+	return len(n.children)
+}
+
+// child returns the element i of n.
+func (n *inspectNode) child(i int) *inspectNode {
+	if n.hexElems {
+		return &inspectNode{text: fmt.Sprintf("%#02x", n.elems.Index(i).Uint())}
+	}
+	if n.elems.IsValid() {
+		return n.in.node(n.elems.Index(i), 0, n.elemAnnotate, true)
+	}
+	return n.children[i]
+}
+
+// flat returns n rendered on one line.
+func (n *inspectNode) flat() string {
+	var b builderSink
+	n.writeFlat(&b)
+	return b.String()
+}
+
+// fits returns whether n rendered on one line is at most width columns wide.
+func (n *inspectNode) fits(width int) bool {
+	m := &measureSink{max: width}
+	n.writeFlat(m)
+	return !m.full()
+}
+
+// writeFlat writes n on one line.
+func (n *inspectNode) writeFlat(s inspectSink) {
+	s.write(n.head())
+	if !n.composite {
+		return
+	}
+	s.write("{")
+	for i := 0; i < n.len() && !s.full(); i++ {
+		if i > 0 {
+			s.write(", ")
+		}
+		n.child(i).writeFlat(s)
+	}
+	if n.more > 0 {
+		if n.len() > 0 {
+			s.write(", ")
+		}
+		s.write(fmt.Sprintf("... %d more", n.more))
+	}
+	s.write("}")
+}
+
+// leaves returns whether the children of n are elements that are neither
+// labeled nor composite.
+func (n *inspectNode) leaves() bool {
+	if n.elems.IsValid() {
+		return true
+	}
+	for _, child := range n.children {
+		if child.composite || len(child.label) > 0 || child.key != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// render writes n, which is indented by level, breaking it over several
+// lines if it's wider than width.
+func (n *inspectNode) render(s inspectSink, level, width int) {
+	if n.composite && width > 0 && len(n.dump) > 0 {
+		n.renderDump(s, level)
+		return
+	}
+	if !n.composite || width <= 0 || n.len() == 0 || !n.expand && n.fits(width-2*level) {
+		n.writeFlat(s)
+		return
+	}
+	indent := strings.Repeat("  ", level)
+	s.write(n.head() + "{\n")
+	if n.leaves() {
+		// Elements without labels or elements of their own, such as
+		// numbers, are filled into lines.
+		line := indent + " "
+		for i := 0; i < n.len() && !s.full(); i++ {
+			elem := " " + n.child(i).flat() + ","
+			if len(line) > len(indent)+1 && stringWidth(line+elem) > width {
+				s.write(line + "\n")
+				line = indent + " "
+			}
+			line += elem
+		}
+		if n.more > 0 {
+			line += fmt.Sprintf(" ... %d more,", n.more)
+		}
+		s.write(line + "\n" + indent + "}")
+		return
+	}
+	for i := 0; i < n.len() && !s.full(); i++ {
+		s.write(indent + "  ")
+		n.child(i).render(s, level+1, width)
+		s.write(",\n")
+	}
+	if n.more > 0 {
+		s.write(fmt.Sprintf("%s  ... %d more,\n", indent, n.more))
+	}
+	s.write(indent + "}")
+}
+
+// renderDump writes the bytes of n, which is indented by level, as a hex
+// dump, like hex.Dump does.
+func (n *inspectNode) renderDump(s inspectSink, level int) {
+	indent := strings.Repeat("  ", level)
+	s.write(n.head() + "{\n")
+	for offset := 0; offset < len(n.dump) && !s.full(); offset += 16 {
+		end := offset + 16
+		if end > len(n.dump) {
+			end = len(n.dump)
+		}
+		// Rows are dumped one at a time, so huge dumps are never held in
+		// memory whole, and given their offset.
+		row := hex.Dump(n.dump[offset:end])
+		s.write(fmt.Sprintf("%s  %08x%s", indent, offset, row[8:]))
+	}
+	if n.more > 0 {
+		s.write(fmt.Sprintf("%s  ... %d more bytes\n", indent, n.more))
+	}
+	s.write(indent + "}")
+}
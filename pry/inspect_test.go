@@ -0,0 +1,465 @@
+package pry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type inspectNodeValue struct {
+	Val  int
+	Next *inspectNodeValue
+}
+
+type inspectPerson struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Extra   interface{}
+	private bool
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "nil"},
+		{1, "1"},
+		{int64(1), "int64(1)"},
+		{2.0, "2.0"},
+		{"a", `"a"`},
+		{[]int{1, 2}, "[]int{1, 2}"},
+		{[]int(nil), "[]int(nil)"},
+		{[]interface{}{1, uint8(2), "c", nil}, `[]interface {}{1, uint8(2), "c", nil}`},
+		{map[string]int{"b": 2, "a": 1}, `map[string]int{"a": 1, "b": 2}`},
+		{&inspectNodeValue{Val: 1}, "&pry.inspectNodeValue{Val: 1, Next: nil}"},
+		{[]byte("hi"), "[]uint8{0x68, 0x69}"},
+		{errors.New("boom"), `*errors.errorString("boom")`},
+		{time.Second, "time.Duration(1s)"},
+		{
+			inspectPerson{Name: "Ada", Age: 36, Tags: []string{"math"}, Extra: int32(1)},
+			`pry.inspectPerson{Name: "Ada", Age: 36, Tags: []string{"math"}, Extra: int32(1), private: false}`,
+		},
+	}
+	for _, c := range cases {
+		if out := Inspect(c.v, WithInspectWidth(0)); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+}
+
+// panickyStringer has a String method that panics.
+type panickyStringer struct {
+	ID int
+}
+
+func (panickyStringer) String() string { panic("broken") }
+
+func TestInspectStringers(t *testing.T) {
+	t.Parallel()
+
+	ips := map[string][]net.IP{"local": {net.IPv4(127, 0, 0, 1)}}
+	boom := errors.New("boom")
+	cases := []struct {
+		v    interface{}
+		raw  bool
+		want string
+	}{
+		{net.IPv4(127, 0, 0, 1), false, "net.IP(127.0.0.1)"},
+		{ips, false, `map[string][]net.IP{"local": {net.IP(127.0.0.1)}}`},
+		{[]interface{}{errors.New("boom")}, false, `[]interface {}{*errors.errorString("boom")}`},
+		{panickyStringer{ID: 1}, false, "pry.panickyStringer{ID: 1}"},
+		{[]panickyStringer{{ID: 1}}, false, "[]pry.panickyStringer{{ID: 1}}"},
+		// Raw values are shown by their fields.
+		{time.Second, true, "time.Duration(1000000000)"},
+		{boom, true, fmt.Sprintf(`(*errors.errorString)(%p) &errors.errorString{s: "boom"}`, boom)},
+		{[]net.IP{net.IPv4(1, 2, 3, 4)[12:]}, true, `[]net.IP{{0x01, 0x02, 0x03, 0x04}}`},
+	}
+	for _, c := range cases {
+		opts := []Option{WithInspectWidth(0)}
+		if c.raw {
+			opts = append(opts, WithInspectRaw())
+		}
+		if out := Inspect(c.v, opts...); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+}
+
+func TestInspectPointers(t *testing.T) {
+	t.Parallel()
+
+	v := &inspectNodeValue{Val: 1}
+	p := &v
+	var nilValue *inspectNodeValue
+	deep := inspectServer{TLS: &inspectTLS{Cert: "a.pem"}}
+	cases := []struct {
+		v    interface{}
+		raw  bool
+		want string
+	}{
+		{nilValue, false, "(*pry.inspectNodeValue)(nil)"},
+		{[]*inspectNodeValue{v, nil}, false, "[]*pry.inspectNodeValue{&{Val: 1, Next: nil}, nil}"},
+		// Only one level is dereferenced.
+		{p, false, fmt.Sprintf("&(*pry.inspectNodeValue)(%p)", v)},
+		{&nilValue, false, "&(*pry.inspectNodeValue)(nil)"},
+		// Pointers count toward the depth like what they point to.
+		{deep, false, `pry.inspectServer{Host: "", Port: 0, TLS: &pry.inspectTLS{Cert: "a.pem", Chain: pry.inspectChain{Roots: nil}}}`},
+		{[]inspectServer{deep}, false, `[]pry.inspectServer{{Host: "", Port: 0, TLS: &pry.inspectTLS{Cert: "a.pem", Chain: pry.inspectChain{…}}}}`},
+		// Raw values show the addresses too.
+		{v, true, fmt.Sprintf("(*pry.inspectNodeValue)(%p) &pry.inspectNodeValue{Val: 1, Next: nil}", v)},
+		{p, true, fmt.Sprintf("(**pry.inspectNodeValue)(%p) &(*pry.inspectNodeValue)(%p)", p, v)},
+	}
+	for _, c := range cases {
+		opts := []Option{WithInspectWidth(0)}
+		if c.raw {
+			opts = append(opts, WithInspectRaw())
+		}
+		if out := Inspect(c.v, opts...); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+}
+
+func TestInspectMaxString(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{"abcdef", `"abcd"… (+2 bytes)`},
+		{"abcd", `"abcd"`},
+		// Strings are cut between runes.
+		{"abcé", `"abc"… (+2 bytes)`},
+		// Bytes are shown in hex, whatever they hold.
+		{[]byte("abcdef"), "[]uint8{0x61, 0x62, 0x63, 0x64, 0x65, 0x66}"},
+		{map[string][]string{"k": {"abcdef"}}, `map[string][]string{"k": {"abcd"… (+2 bytes)}}`},
+		{inspectPerson{Name: "Ada Lovelace"}, `pry.inspectPerson{Name: "Ada "… (+8 bytes), Age: 0, Tags: nil, Extra: nil, private: false}`},
+	}
+	for _, c := range cases {
+		if out := Inspect(c.v, WithInspectWidth(0), WithInspectMaxString(4)); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+	if out := Inspect(strings.Repeat("a", 2000), WithInspectMaxString(0)); len(out) != 2002 {
+		t.Errorf("Expected the string in full got %d bytes.", len(out))
+	}
+}
+
+func TestInspectHumanize(t *testing.T) {
+	t.Parallel()
+
+	v := map[string]interface{}{"body": 51234, "small": uint8(12), "neg": -4096, "limit": int64(1 << 20), "timeout": time.Second}
+	want := `map[string]interface {}{"body": 51234 (50.0 KB), "limit": int64(1048576) (1.0 MB), "neg": -4096, "small": uint8(12), "timeout": time.Duration(1s)}`
+	if out := Inspect(v, WithInspectWidth(0), WithInspectHumanize()); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+	// Raw values are shown as they are.
+	want = `map[string]interface {}{"body": 51234, "limit": int64(1048576), "neg": -4096, "small": uint8(12), "timeout": time.Duration(1000000000)}`
+	if out := Inspect(v, WithInspectWidth(0), WithInspectHumanize(), WithInspectRaw()); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+// inspectDouble is a function compiled into the program for Inspect to show.
+func inspectDouble(n int) int { return 2 * n }
+
+func TestInspectOpaque(t *testing.T) {
+	t.Parallel()
+
+	_, file, line, _ := runtime.Caller(0)
+	where := fmt.Sprintf("pry/%s:%d", filepath.Base(file), line-5)
+
+	buffered := make(chan int, 10)
+	buffered <- 1
+	closed := make(chan struct{})
+	close(closed)
+	type guarded struct {
+		mu sync.Mutex
+		n  int
+	}
+	cases := []struct {
+		v    interface{}
+		want string
+	}{
+		{inspectDouble, "func pry.inspectDouble(int) int at " + where},
+		{http.HandlerFunc(nil), "http.HandlerFunc((http.HandlerFunc)(nil))"},
+		{struct{ F func(int) int }{inspectDouble}, "struct { F func(int) int }{F: func pry.inspectDouble(int) int at " + where + "}"},
+		{buffered, "chan int (len 1, cap 10, open)"},
+		{closed, "chan struct {} (len 0, cap 0, closed)"},
+		{(chan int)(nil), "chan int((chan int)(nil))"},
+		{sync.Mutex{}, "sync.Mutex{<internal>}"},
+		{&sync.WaitGroup{}, "&sync.WaitGroup{<internal>}"},
+		{guarded{n: 1}, "pry.guarded{mu: sync.Mutex{<internal>}, n: 1}"},
+	}
+	for _, c := range cases {
+		if out := Inspect(c.v, WithInspectWidth(0)); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+
+	// Functions made with reflect.MakeFunc only have a signature.
+	f := testFunc(t, NewScope(), "func(n int) int { return n }")
+	native, err := f.Interface(reflect.TypeOf(inspectDouble))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, want := Inspect(native), "func(int) int"; out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+	if out, want := Inspect(f), "func(n int) int at <repl>:1:1"; out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+	// Raw values show their address and internals.
+	if out := Inspect(sync.Mutex{}, WithInspectRaw(), WithInspectWidth(0)); !strings.Contains(out, "sema: 0") {
+		t.Errorf("Expected the fields of the mutex got %#v.", out)
+	}
+	if out := Inspect(buffered, WithInspectRaw()); !strings.HasPrefix(out, "(chan int)(0x") {
+		t.Errorf("Expected the address of the channel got %#v.", out)
+	}
+}
+
+func TestInspectBytes(t *testing.T) {
+	t.Parallel()
+
+	type packet struct {
+		ID   int
+		Body []byte
+	}
+	body := []byte{1, 2, 3, 0xff, 0x80, 0x90, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14}
+	cases := []struct {
+		v    interface{}
+		opts []Option
+		want string
+	}{
+		{[]byte{0xde, 0xad, 0xbe, 0xef}, nil, "[]uint8{0xde, 0xad, 0xbe, 0xef}"},
+		{[4]byte{1, 2, 3, 4}, nil, "[4]uint8{0x01, 0x02, 0x03, 0x04}"},
+		{[]byte("hello"), nil, "[]uint8{0x68, 0x65, 0x6c, 0x6c, 0x6f}"},
+		{map[string][]byte{"k": {0, 1}}, nil, `map[string][]uint8{"k": {0x00, 0x01}}`},
+		{packet{1, body}, nil, `pry.packet{
+  ID: 1,
+  Body: []uint8{
+    00000000  01 02 03 ff 80 90 01 02  03 04 05 06 07 08 09 0a  |................|
+    00000010  0b 0c 0d 0e                                       |....|
+  },
+}`},
+		// The limit is rounded up to whole rows.
+		{make([]byte, 40), []Option{WithInspectMaxElems(20)}, `[]uint8{
+  00000000  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+  00000010  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|
+  ... 8 more bytes
+}`},
+		{[]byte("hello"), []Option{WithInspectBytes(BytesDump)}, `[]uint8{
+  00000000  68 65 6c 6c 6f                                    |hello|
+}`},
+		{[]byte{0xde, 0xad, 0xbe, 0xef}, []Option{WithInspectBytes(BytesGo)}, "[]uint8{222, 173, 190, 239}"},
+		{[]byte{0, 1}, []Option{WithInspectBytes(BytesGo)}, `[]uint8("\x00\x01")`},
+		{map[string][]byte{"k": []byte("hi")}, []Option{WithInspectBytes(BytesGo)}, `map[string][]uint8{"k": "hi"}`},
+	}
+	for _, c := range cases {
+		if out := Inspect(c.v, c.opts...); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+}
+
+func TestInspectWidth(t *testing.T) {
+	t.Parallel()
+
+	v := map[string]inspectPerson{
+		"ada": {Name: "Ada Lovelace", Age: 36, Tags: []string{"math", "engines"}},
+	}
+	want := `map[string]pry.inspectPerson{
+  "ada": {
+    Name: "Ada Lovelace",
+    Age: 36,
+    Tags: []string{"math", "engines"},
+    Extra: nil,
+    private: false,
+  },
+}`
+	if out := Inspect(v, WithInspectWidth(40)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	want = `[]int{
+  1, 2, 3, 4, 5,
+  6, 7, 8, 9,
+}`
+	if out := Inspect([]int{1, 2, 3, 4, 5, 6, 7, 8, 9}, WithInspectWidth(16)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	long := make([]int, 50)
+	if out := Inspect(long, WithInspectWidth(0)); strings.Contains(out, "\n") {
+		t.Errorf("Expected one line got %#v.", out)
+	}
+	// Wide characters take up two columns.
+	want = `[]string{
+  "日本語", "日本語",
+  "日本語",
+}`
+	if out := Inspect([]string{"日本語", "日本語", "日本語"}, WithInspectWidth(22)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestInspectLimits(t *testing.T) {
+	t.Parallel()
+
+	// Strings are cut between characters.
+	for _, c := range []struct {
+		s    string
+		want string
+	}{
+		{"日本語", `"日本"… (+3 bytes)`},
+		{"cafe\u0301s", "\"cafe\u0301\"… (+1 bytes)"},
+		{"ab👍🏽", `"ab"… (+8 bytes)`},
+	} {
+		if out := Inspect(c.s, WithInspectMaxString(6)); out != c.want {
+			t.Errorf("Expected %#v got %#v.", c.want, out)
+		}
+	}
+
+	if want, out := "[]int{0, 0, 0, ... 7 more}", Inspect(make([]int, 10), WithInspectMaxElems(3)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+	want := `map[int]int{0: 0, ... 1 more}`
+	if out := Inspect(map[int]int{0: 0, 1: 1}, WithInspectMaxElems(1)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+	want = "[][][]int{{{…}}}"
+	if out := Inspect([][][]int{{{1}}}, WithInspectDepth(2)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+// inspectConfig is a nested configuration, as programs load them.
+type inspectConfig struct {
+	Name     string
+	Server   inspectServer
+	Backends []*inspectServer
+	Limits   map[string]int
+	Timeout  time.Duration
+	secret   string
+	parent   *inspectConfig
+}
+
+type inspectServer struct {
+	Host string
+	Port int
+	TLS  *inspectTLS
+}
+
+type inspectTLS struct {
+	Cert  string
+	Chain inspectChain
+}
+
+type inspectChain struct {
+	Roots []string
+}
+
+func TestInspectNested(t *testing.T) {
+	t.Parallel()
+
+	tls := &inspectTLS{Cert: "a.pem", Chain: inspectChain{Roots: []string{"root.pem"}}}
+	v := inspectConfig{
+		Name:   "api",
+		Server: inspectServer{Host: "localhost", Port: 8080, TLS: tls},
+		Backends: []*inspectServer{
+			{Host: "db1", Port: 5432},
+			{Host: "db2", Port: 5432},
+			{Host: "db3", Port: 5432},
+		},
+		Limits:  map[string]int{"rps": 100},
+		Timeout: 3 * time.Second,
+		secret:  "hunter2",
+	}
+	want := `pry.inspectConfig{
+  Name: "api",
+  Server: pry.inspectServer{
+    Host: "localhost",
+    Port: 8080,
+    TLS: &pry.inspectTLS{Cert: "a.pem", Chain: pry.inspectChain{…}},
+  },
+  Backends: []*pry.inspectServer{
+    &{Host: "db1", Port: 5432, TLS: nil},
+    &{Host: "db2", Port: 5432, TLS: nil},
+    ... 1 more,
+  },
+  Limits: map[string]int{"rps": 100},
+  Timeout: time.Duration(3s),
+  secret: "hunter2",
+  parent: nil,
+}`
+	if out := Inspect(v, WithInspectMaxElems(2)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	// Without a width it's kept on one line, cut at the same depth.
+	want = `pry.inspectServer{Host: "localhost", Port: 8080, TLS: &pry.inspectTLS{Cert: "a.pem", Chain: pry.inspectChain{Roots: []string{…}}}}`
+	if out := Inspect(v.Server, WithInspectWidth(0)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	t.Parallel()
+
+	// A cyclic linked list.
+	a := &inspectNodeValue{Val: 1}
+	b := &inspectNodeValue{Val: 2, Next: a}
+	a.Next = b
+	want := "#1 &pry.inspectNodeValue{Val: 1, Next: &pry.inspectNodeValue{Val: 2, Next: &ref(#1)}}"
+	if out := Inspect(a, WithInspectDepth(0), WithInspectWidth(0)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	self := &inspectNodeValue{Val: 1}
+	self.Next = self
+	want = "#1 &pry.inspectNodeValue{Val: 1, Next: &ref(#1)}"
+	if out := Inspect(self); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	s := []interface{}{1, nil}
+	s[1] = s
+	m := map[string]interface{}{"s": s}
+	m["m"] = m
+	want = `#1 map[string]interface {}{"m": ref(#1), "s": #2 []interface {}{1, ref(#2)}}`
+	if out := Inspect(m, WithInspectDepth(0)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	// Values seen twice without a cycle are shown both times.
+	shared := &inspectNodeValue{Val: 3}
+	want = "[]*pry.inspectNodeValue{&{Val: 3, Next: nil}, &{Val: 3, Next: nil}}"
+	if out := Inspect([]*inspectNodeValue{shared, shared}, WithInspectWidth(0)); out != want {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestREPLInspect(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("people", map[string]inspectPerson{"ada": {Name: "Ada", Age: 36, Tags: []string{"math"}}})
+	out := runLimited(t, scope, Limits{}, "people\n")
+	// The type of the result is shown once, after it.
+	expectOutput(t, out, `=> {
+  "ada": {
+    Name: "Ada",`, "\n} (map[string]pry.inspectPerson)\n")
+}
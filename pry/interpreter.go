@@ -2,6 +2,7 @@ package pry
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"go/ast"
 	"go/parser"
@@ -29,22 +30,65 @@ var (
 	ErrBranchBreak = errors.New("branch break")
 	// ErrBranchContinue is an internal error thrown when a for loop continues.
 	ErrBranchContinue = errors.New("branch continue")
+
+	// ErrInterrupted occurs when the context of an evaluation is cancelled.
+	// The errors returned are *InterruptedError, which match it.
+	ErrInterrupted = errors.New("interrupted")
+
+	// ErrLimitExceeded occurs when an evaluation exceeds its Limits. The
+	// errors returned, such as *StepLimitError, match it.
+	ErrLimitExceeded = errors.New("limit exceeded")
 )
 
+// returnSignal is the error a return statement stops the function it's in
+// with. It carries the results to the call.
+type returnSignal struct {
+	value interface{}
+}
+
+func (r *returnSignal) Error() string {
+	return "return outside of a function"
+}
+
 // Scope is a string-interface key-value pair that represents variables/functions in scope.
 type Scope struct {
-	Vals   map[string]interface{}
-	Parent *Scope
-	Files  map[string]*ast.File
-	config *types.Config
-	path   string
-	line   int
-	fset   *token.FileSet
+	Vals map[string]interface{}
+	// ReadOnly holds the names in Vals that are copies of values of the
+	// program, such as range variables, so assigning to them doesn't change
+	// the program.
+	ReadOnly map[string]bool
+	Parent   *Scope
+	Files    map[string]*ast.File
+	config   *types.Config
+	path     string
+	line     int
+	fset     *token.FileSet
 
 	isSelect   bool
 	typeAssert reflect.Type
 	isFunction bool
 	defers     []*Defer
+	src        *source
+	ctx        context.Context
+	// builtins holds the builtins and packages registered for the scope
+	// with RegisterBuiltin and RegisterPackage.
+	builtins map[string]interface{}
+	hookList []*Hooks
+	// limits are set with SetLimits and budget tracks them while an
+	// evaluation runs.
+	limits *Limits
+	budget *budget
+	// policy is set with SetPolicy and blocked holds the functions it
+	// blocks while an evaluation runs.
+	policy  *Policy
+	blocked *blockedFuncs
+	// warnings collects the warnings of the evaluation running.
+	warnings *warningLog
+	// nativeCalls counts the native calls of the evaluation running.
+	nativeCalls *int64
+	// compileEval makes Eval compile sources before running them, so the
+	// tests can hold both engines to the same cases.
+	compileEval bool
 
 	sync.Mutex
 }
@@ -71,64 +115,174 @@ func NewScope() *Scope {
 		Vals:  map[string]interface{}{},
 		Files: map[string]*ast.File{},
 	}
-	s.Set("_pryScope", s)
+	s.Define("_pryScope", s)
 	return s
 }
 
 // GetPointer walks the scope and finds the pointer to the value of interest
 func (scope *Scope) GetPointer(name string) (val interface{}, exists bool) {
-	currentScope := scope
-	for !exists && currentScope != nil {
+	_, val, exists = scope.owner(name)
+	return
+}
+
+// owner walks the scope and finds the scope name is in, and the pointer to
+// its value.
+func (scope *Scope) owner(name string) (owner *Scope, val interface{}, exists bool) {
+	for currentScope := scope; currentScope != nil; currentScope = currentScope.Parent {
 		currentScope.Lock()
 		val, exists = currentScope.Vals[name]
 		currentScope.Unlock()
-		currentScope = currentScope.Parent
+		if exists {
+			return currentScope, val, true
+		}
 	}
-	return
+	return nil, nil, false
 }
 
 // Get walks the scope and finds the value of interest
 func (scope *Scope) Get(name string) (interface{}, bool) {
 	val, exists := scope.GetPointer(name)
-	if !exists || val == nil {
+	if !exists {
 		return val, exists
 	}
+	return derefScopeValue(val), exists
+}
+
+// derefScopeValue returns the value kept in a scope as val.
+func derefScopeValue(val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	// Types, such as those of dot imports, are kept as they are.
+	if _, isType := val.(reflect.Type); isType {
+		return val
+	}
 	v := reflect.ValueOf(val)
 	if v.Kind() == reflect.Ptr {
-		return v.Elem().Interface(), exists
+		return v.Elem().Interface()
 	}
-	return v.Interface(), exists
+	return v.Interface()
 }
 
 // Set walks the scope and sets a value in a parent scope if it exists, else current.
+// Values held through a pointer, such as the variables of the program, are
+// written through it unless the name is read-only or val doesn't fit.
 func (scope *Scope) Set(name string, val interface{}) {
+	hooks := scope.hooks()
+	for currentScope := scope; currentScope != nil; currentScope = currentScope.Parent {
+		if currentScope.setExisting(name, val, hooks) {
+			return
+		}
+	}
+	scope.Define(name, val)
+}
+
+// setExisting sets name to val if it's in scope itself, running hooks, and
+// returns whether it was.
+func (scope *Scope) setExisting(name string, val interface{}, hooks []*Hooks) bool {
+	scope.Lock()
+	current, exists := scope.Vals[name]
+	var old interface{}
+	if exists {
+		if len(hooks) > 0 {
+			old = derefValue(current)
+		}
+		if scope.ReadOnly[name] || !writeThrough(current, val) {
+			scope.Vals[name] = wrapValue(val)
+		}
+	}
+	scope.Unlock()
+	if exists {
+		scopeChanged(hooks, name, old, val)
+	}
+	return exists
+}
+
+// Define sets name in the current scope, hiding any parent binding of it.
+func (scope *Scope) Define(name string, val interface{}) {
+	scope.defineTyped(name, val, nil)
+}
+
+// defineTyped is Define declaring name with the type typ, such as the
+// interface type of var w io.Writer, rather than that of val, so assignments
+// to it are checked against typ. val must be assignable to typ.
+func (scope *Scope) defineTyped(name string, val interface{}, typ reflect.Type) {
+	hooks := scope.hooks()
+	scope.Lock()
+	var old interface{}
+	if len(hooks) > 0 {
+		old = derefValue(scope.Vals[name])
+	}
+	scope.Vals[name] = wrapTyped(val, typ)
+	delete(scope.ReadOnly, name)
+	scope.Unlock()
+	scopeChanged(hooks, name, old, val)
+}
+
+// wrapValue returns a pointer to a copy of val, the form the values of a
+// scope are kept in.
+func wrapValue(val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	value := reflect.ValueOf(val)
+	nv := reflect.New(value.Type())
+	nv.Elem().Set(value)
+	return nv.Interface()
+}
+
+// wrapTyped is wrapValue keeping val in a variable of type typ, or of its own
+// type if typ is nil.
+func wrapTyped(val interface{}, typ reflect.Type) interface{} {
+	if typ == nil {
+		return wrapValue(val)
+	}
+	nv := reflect.New(typ)
 	if val != nil {
-		value := reflect.ValueOf(val)
-		if !value.CanAddr() {
-			nv := reflect.New(value.Type())
-			nv.Elem().Set(value)
-			val = nv.Interface()
-		} else {
-			val = value.Addr().Interface()
+		nv.Elem().Set(reflect.ValueOf(val))
+	}
+	return nv.Interface()
+}
+
+// writeThrough stores val in the variable current points to and returns
+// whether it could.
+func writeThrough(current, val interface{}) bool {
+	ptr := reflect.ValueOf(current)
+	if current == nil || ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return false
+	}
+	elem := ptr.Elem()
+	if val == nil {
+		switch elem.Kind() {
+		case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface:
+			elem.Set(reflect.Zero(elem.Type()))
+			return true
 		}
+		return false
 	}
+	value := reflect.ValueOf(val)
+	if !value.Type().AssignableTo(elem.Type()) {
+		return false
+	}
+	elem.Set(value)
+	return true
+}
 
-	exists := false
-	currentScope := scope
-	for !exists && currentScope != nil {
+// Delete removes name from the innermost scope that has it. It returns
+// whether name was found.
+func (scope *Scope) Delete(name string) bool {
+	for currentScope := scope; currentScope != nil; currentScope = currentScope.Parent {
 		currentScope.Lock()
-		_, exists = currentScope.Vals[name]
+		_, exists := currentScope.Vals[name]
 		if exists {
-			currentScope.Vals[name] = val
+			delete(currentScope.Vals, name)
 		}
 		currentScope.Unlock()
-		currentScope = currentScope.Parent
-	}
-	if !exists {
-		scope.Lock()
-		scope.Vals[name] = val
-		scope.Unlock()
+		if exists {
+			return true
+		}
 	}
+	return false
 }
 
 // Keys returns all keys in scope
@@ -140,7 +294,7 @@ func (scope *Scope) Keys() (keys []string) {
 			keys = append(keys, k)
 		}
 		currentScope.Unlock()
-		currentScope = scope.Parent
+		currentScope = currentScope.Parent
 	}
 	return
 }
@@ -155,6 +309,82 @@ func (scope *Scope) NewChild() *Scope {
 // Func represents an interpreted function definition.
 type Func struct {
 	Def *ast.FuncLit
+
+	src *source
+	// scope is the scope the function was defined in, which it runs in when
+	// it's called natively.
+	scope *Scope
+}
+
+// source is the input that an ast.Node was parsed from. It's used to convert
+// token.Pos values into line and column numbers for error traces.
+type source struct {
+	text    string
+	shifted int
+	// name is the file the source was read from. It's empty for input typed
+	// into the REPL.
+	name string
+}
+
+// position returns the position of pos in the source.
+func (s *source) position(pos token.Pos) token.Position {
+	if s == nil || !pos.IsValid() {
+		return token.Position{Filename: "<repl>"}
+	}
+	filename := s.name
+	if len(filename) == 0 {
+		filename = "<repl>"
+	}
+	offset := s.offset(pos)
+	before := s.text[:offset]
+	return token.Position{
+		Filename: filename,
+		Line:     strings.Count(before, "\n") + 1,
+		Column:   offset - strings.LastIndex(before, "\n"),
+	}
+}
+
+// offset returns the offset of pos in the source text.
+func (s *source) offset(pos token.Pos) int {
+	offset := int(pos) - 1 - s.shifted
+	if offset < 0 {
+		offset = 0
+	} else if offset > len(s.text) {
+		offset = len(s.text)
+	}
+	return offset
+}
+
+// currentSource returns the source of the code running in the scope.
+func (scope *Scope) currentSource() *source {
+	for ; scope != nil; scope = scope.Parent {
+		if scope.src != nil {
+			return scope.src
+		}
+	}
+	return nil
+}
+
+// checkInterrupt returns an *InterruptedError if the context of the
+// evaluation running in the scope is done. It also takes a step of the
+// budget of the evaluation, returning the error if a limit is exceeded.
+func (scope *Scope) checkInterrupt() error {
+	if b := scope.currentBudget(); b != nil {
+		if err := b.step(); err != nil {
+			return err
+		}
+	}
+	for ; scope != nil; scope = scope.Parent {
+		if scope.ctx != nil {
+			select {
+			case <-scope.ctx.Done():
+				return &InterruptedError{Err: scope.ctx.Err()}
+			default:
+				return nil
+			}
+		}
+	}
+	return nil
 }
 
 // ParseString parses go code into the ast nodes.
@@ -167,7 +397,7 @@ func (scope *Scope) ParseString(exprStr string) (ast.Node, int, error) {
 		expr, err = parser.ParseExpr(exprStr)
 		shifted = 0
 		if err != nil {
-			return expr, shifted, err
+			return expr, shifted, newParseError(err, shifted)
 		}
 		node, ok := expr.(ast.Node)
 		if !ok {
@@ -175,7 +405,7 @@ func (scope *Scope) ParseString(exprStr string) (ast.Node, int, error) {
 		}
 		return node, shifted, nil
 	} else if err != nil {
-		return expr, shifted, err
+		return expr, shifted, newParseError(err, shifted)
 	}
 	if expr == nil {
 		return nil, 0, errors.Errorf("expression is empty")
@@ -187,54 +417,172 @@ func (scope *Scope) ParseString(exprStr string) (ast.Node, int, error) {
 	return callExpr.Fun.(*ast.FuncLit).Body, shifted, nil
 }
 
-// InterpretString interprets a string of go code and returns the result.
-func (scope *Scope) InterpretString(exprStr string) (v interface{}, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = errors.Errorf("interpreting %q: %s", exprStr, fmt.Sprint(r))
-		}
-	}()
+// InterpretString interprets a string of go code and returns the result,
+// like EvalContext without cancellation. Errors are of the types defined in
+// errors.go where possible, such as *ParseError or *UndefinedError, and can
+// be inspected with errors.As.
+func (scope *Scope) InterpretString(exprStr string) (interface{}, error) {
+	return EvalContext(context.Background(), scope, exprStr)
+}
+
+// InterpretStringContext is EvalContext as a method.
+func (scope *Scope) InterpretStringContext(ctx context.Context, exprStr string) (interface{}, error) {
+	return EvalContext(ctx, scope, exprStr)
+}
+
+// InterpretProgram interprets src, any number of statements separated by
+// semicolons or newlines, as one unit and returns the value of the last
+// one, like EvalContext without cancellation.
+func (scope *Scope) InterpretProgram(src string) (interface{}, error) {
+	return EvalContext(context.Background(), scope, src)
+}
+
+// programPrefix is prepended to programs to parse them as the body of a
+// function. It has no newline so lines and offsets keep their numbering.
+const programPrefix = "package p; func _() {"
+
+// parseProgram parses src, statements separated by semicolons or newlines,
+// as the body of a function. Comments are dropped. It also returns the
+// number of characters prepended to src to parse it. Sources parsed before
+// are taken from the parse cache; the body must not be changed.
+func parseProgram(src string) (*ast.BlockStmt, int, error) {
+	key := parseKey{kind: parseKindProgram, src: src}
+	if p, ok := cachedParse(key); ok {
+		return p.body, p.shifted, nil
+	}
+	body, shifted, err := parseProgramSource(src)
+	if err == nil {
+		cacheParse(&parsed{key: key, body: body, shifted: shifted})
+	}
+	return body, shifted, err
+}
+
+// parseProgramSource is parseProgram without the cache.
+func parseProgramSource(src string) (*ast.BlockStmt, int, error) {
+	shifted := len(programPrefix)
+	imports, src, err := parseImports(src)
+	if err != nil {
+		return nil, shifted, err
+	}
+	// The closing brace is on its own line so a trailing line comment
+	// doesn't swallow it.
+	f, err := parser.ParseFile(token.NewFileSet(), "", programPrefix+src+"\n}", 0)
+	if err != nil {
+		err := newParseError(err, shifted)
+		// Input that ends too early is reported at its end rather than
+		// at the closing brace.
+		if pErr, ok := err.(*ParseError); ok && pErr.Pos.Line > strings.Count(src, "\n")+1 {
+			pErr.Pos = endPosition(src)
+			pErr.Msg = strings.Replace(pErr.Msg, "found '}'", "found 'EOF'", 1)
+		}
+		return nil, shifted, err
+	}
+	body := f.Decls[0].(*ast.FuncDecl).Body
+	// A closing brace in src ends the function early.
+	if len(f.Decls) > 1 {
+		return nil, shifted, &ParseError{Pos: endPosition(src[:int(body.Rbrace)-1-shifted]), Msg: "unexpected }"}
+	}
+	for i := len(imports) - 1; i >= 0; i-- {
+		body.List = append([]ast.Stmt{&ast.DeclStmt{Decl: imports[i]}}, body.List...)
+	}
+	return body, shifted, nil
+}
+
+// importsPrefix is prepended to programs to parse the imports they start
+// with. It's as long as programPrefix so the positions are the same.
+var importsPrefix = "package p;" + strings.Repeat(" ", len(programPrefix)-len("package p;"))
 
-	node, _, err := scope.ParseString(exprStr)
+// parseImports parses the imports src starts with, which can't be in the
+// body of a function. It returns them and src with them blanked out.
+func parseImports(src string) ([]ast.Decl, string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", importsPrefix+src, parser.ImportsOnly)
+	if f == nil || len(f.Imports) == 0 {
+		return nil, src, nil
+	}
 	if err != nil {
-		return node, err
+		return nil, src, newParseError(err, len(importsPrefix))
+	}
+	end := int(f.Decls[len(f.Decls)-1].End()) - 1 - len(importsPrefix)
+	blank := []byte(src[:end])
+	for i, c := range blank {
+		if c != '\n' {
+			blank[i] = ' '
+		}
 	}
+	return f.Decls, string(blank) + src[end:], nil
+}
+
+// endPosition returns the position of the end of text.
+func endPosition(text string) token.Position {
+	return token.Position{Line: strings.Count(text, "\n") + 1, Column: len(text) - strings.LastIndex(text, "\n")}
+}
+
+// EvalContext interprets src in scope and returns the value of the last
+// statement. It's Eval returning only the value.
+func EvalContext(ctx context.Context, scope *Scope, src string) (interface{}, error) {
+	res, err := Eval(ctx, scope, src)
+	return res.Value, err
+}
+
+// interpretSource type checks and interprets node, parsed from src. If run,
+// node compiled, isn't nil it's run instead.
+func (scope *Scope) interpretSource(node ast.Node, src *source, run compiled) (interface{}, error) {
+	scope.src = src
 	errs := scope.CheckStatement(node)
 	if len(errs) > 0 {
 		return node, errs[0]
 	}
-	return scope.Interpret(node)
+	var out interface{}
+	var err error
+	if run != nil {
+		out, err = run(scope)
+	} else {
+		out, err = scope.Interpret(node)
+	}
+	// A return at the top level ends the input with its results.
+	if r, ok := err.(*returnSignal); ok {
+		return r.value, nil
+	}
+	return out, err
 }
 
-// Interpret interprets an ast.Node and returns the value.
-func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
-	builtinScope := map[string]interface{}{
-		"nil":    nil,
-		"true":   true,
-		"false":  false,
-		"append": Append,
-		"make":   Make,
-		"len":    Len,
-		"close":  Close,
+// recoverInterpret turns a panic while interpreting src into *err.
+func recoverInterpret(src string, err *error) {
+	if r := recover(); r != nil {
+		if rErr, ok := r.(error); ok {
+			*err = errors.Wrapf(rErr, "interpreting %q", src)
+		} else {
+			*err = errors.Errorf("interpreting %q: %s", src, fmt.Sprint(r))
+		}
 	}
+}
 
-	switch e := expr.(type) {
-	case *ast.Ident:
+// builtinScope contains the predeclared identifiers that aren't types.
+var builtinScope = map[string]interface{}{
+	// nil is the untyped nil, the nil interface{}. It takes the type of
+	// the variable, parameter or element it's used as; see nilValue.
+	"nil":    nil,
+	"true":   true,
+	"false":  false,
+	"append": Append,
+	"make":   Make,
+	"len":    Len,
+	"close":  Close,
+}
 
-		typ, err := StringToType(e.Name)
-		if err == nil {
-			return typ, err
-		}
+// pureBuiltins are the builtins that only change the values of the
+// interpreter, so calling them isn't counted as a native call.
+var pureBuiltins = map[string]bool{
+	"append": true,
+	"make":   true,
+	"len":    true,
+}
 
-		obj, exists := scope.Get(e.Name)
-		if !exists {
-			// TODO make builtinScope root of other scopes
-			obj, exists = builtinScope[e.Name]
-			if !exists {
-				return nil, fmt.Errorf("can't find EXPR %s", e.Name)
-			}
-		}
-		return obj, nil
+// Interpret interprets an ast.Node and returns the value.
+func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return scope.ident(e.Name)
 
 	case *ast.SelectorExpr:
 		X, err := scope.Interpret(e.X)
@@ -244,29 +592,54 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		sel := e.Sel
 
 		rVal := reflect.ValueOf(X)
-		if rVal.Kind() != reflect.Struct && rVal.Kind() != reflect.Ptr {
-			return nil, fmt.Errorf("%#v is not a struct and thus has no field %#v", X, sel.Name)
-		}
-
 		pkg, isPackage := X.(Package)
 		if isPackage {
-			obj, isPresent := pkg.Functions[sel.Name]
-			if isPresent {
+			if err := scope.checkMember(pkg, sel.Name); err != nil {
+				return nil, err
+			}
+			if obj, isPresent := pkg.Get(sel.Name); isPresent {
 				return obj, nil
 			}
-			return nil, fmt.Errorf("unknown field %#v", sel.Name)
+			if err := pkg.missingError(sel.Name, types.ExprString(e)); err != nil {
+				return nil, err
+			}
+			return nil, &UndefinedError{
+				Name: types.ExprString(e),
+				Hint: didYouMean(sel.Name, pkg.Keys()),
+			}
 		}
 
-		if method := rVal.MethodByName(sel.Name); method.IsValid() {
-			return method.Interface(), nil
+		if rVal.IsValid() {
+			if method := rVal.MethodByName(sel.Name); method.IsValid() {
+				return method.Interface(), nil
+			}
+			// Like Go, methods with a pointer receiver are called on the
+			// address of variables.
+			if ptr, ok := scope.addressOf(e.X, rVal.Type()); ok {
+				if method := ptr.MethodByName(sel.Name); method.IsValid() {
+					return method.Interface(), nil
+				}
+			}
 		}
+		if rVal.Kind() != reflect.Struct && rVal.Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("%#v is not a struct and thus has no field %#v", X, sel.Name)
+		}
+		candidates := memberCandidates(rVal)
 		if rVal.Kind() == reflect.Ptr {
 			rVal = rVal.Elem()
 		}
+		if rVal.Kind() == reflect.Struct {
+			if f, ok := rVal.Type().FieldByName(sel.Name); ok && f.PkgPath != "" {
+				return nil, fmt.Errorf("field %#v is unexported%s", sel.Name, didYouMean(sel.Name, candidates))
+			}
+		}
 		if field := rVal.FieldByName(sel.Name); field.IsValid() {
 			return field.Interface(), nil
 		}
-		return nil, fmt.Errorf("unknown field %#v", sel.Name)
+		return nil, &UndefinedError{
+			Name: types.ExprString(e),
+			Hint: didYouMean(sel.Name, candidates),
+		}
 
 	case *ast.CallExpr:
 		args := make([]interface{}, len(e.Args))
@@ -278,7 +651,7 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 			args[i] = interpretedArg
 		}
 
-		return scope.ExecuteFunc(e.Fun, args)
+		return scope.executeCall(e.Fun, e.Args, args)
 
 	case *ast.GoStmt:
 		go func() {
@@ -304,96 +677,39 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 			}
 			return v, nil
 		case token.CHAR:
-			return (rune)(e.Value[1]), nil
+			r, _, _, err := strconv.UnquoteChar(e.Value[1:len(e.Value)-1], '\'')
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid rune literal %s", e.Value)
+			}
+			return r, nil
 		case token.STRING:
-			return e.Value[1 : len(e.Value)-1], nil
+			s, err := strconv.Unquote(e.Value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid string literal %s", e.Value)
+			}
+			return s, nil
 		default:
 			return nil, fmt.Errorf("unknown basic literal %d", e.Kind)
 		}
 
 	case *ast.CompositeLit:
+		if e.Type == nil {
+			return nil, errors.Errorf("missing type in composite literal")
+		}
 		typ, err := scope.Interpret(e.Type)
 		if err != nil {
 			return nil, err
 		}
 
-		switch t := e.Type.(type) {
-		case *ast.ArrayType:
-			l := len(e.Elts)
-			aType := typ.(reflect.Type)
-			var slice reflect.Value
-			switch aType.Kind() {
-			case reflect.Slice:
-				slice = reflect.MakeSlice(aType, l, l)
-			case reflect.Array:
-				slice = reflect.New(aType).Elem()
-			default:
-				return nil, errors.Errorf("unknown array type %#v", typ)
-			}
-
-			if len(e.Elts) > slice.Len() {
-				return nil, errors.Errorf("array index %d out of bounds [0:%d]", slice.Len(), slice.Len())
-			}
-
-			for i, elem := range e.Elts {
-				elemValue, err := scope.Interpret(elem)
-				if err != nil {
-					return nil, err
-				}
-				slice.Index(i).Set(reflect.ValueOf(elemValue))
-			}
-			return slice.Interface(), nil
-
-		case *ast.MapType:
-			nMap := reflect.MakeMap(typ.(reflect.Type))
-			for _, elem := range e.Elts {
-				switch eT := elem.(type) {
-				case *ast.KeyValueExpr:
-					key, err := scope.Interpret(eT.Key)
-					if err != nil {
-						return nil, err
-					}
-					val, err := scope.Interpret(eT.Value)
-					if err != nil {
-						return nil, err
-					}
-					nMap.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(val))
-
-				default:
-					return nil, fmt.Errorf("invalid element type %#v to map. Expecting key value pair", eT)
-				}
-			}
-			return nMap.Interface(), nil
-
-		case *ast.Ident, *ast.SelectorExpr:
-			objPtr := reflect.New(typ.(reflect.Type))
-			obj := objPtr.Elem()
-			for i, elem := range e.Elts {
-				switch eT := elem.(type) {
-				case *ast.BasicLit:
-					val, err := scope.Interpret(eT)
-					if err != nil {
-						return nil, err
-					}
-					obj.Field(i).Set(reflect.ValueOf(val))
-
-				case *ast.KeyValueExpr:
-					key := eT.Key.(*ast.Ident).Name
-					val, err := scope.Interpret(eT.Value)
-					if err != nil {
-						return nil, err
-					}
-					obj.FieldByName(key).Set(reflect.ValueOf(val))
-
-				default:
-					return nil, fmt.Errorf("invalid element type %T %#v to struct literal", eT, eT)
-				}
-			}
-			return obj.Interface(), nil
-
-		default:
-			return nil, fmt.Errorf("unknown composite literal %#v", t)
+		// Named types, such as those of packages, are built by their kind.
+		aType, isType := typ.(reflect.Type)
+		if generic, ok := typ.(Generic); ok {
+			return nil, errors.Errorf("cannot use generic type %s without instantiation; %s", generic.Name, generic.available())
+		}
+		if !isType {
+			return nil, fmt.Errorf("unknown composite literal %#v", e.Type)
 		}
+		return scope.compositeLit(e, aType)
 
 	case *ast.BinaryExpr:
 		x, err := scope.Interpret(e.X)
@@ -404,18 +720,33 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
-		return ComputeBinaryOp(x, y, e.Op)
+		x, y = untypedOperands(e, x, y)
+		out, err := ComputeBinaryOp(x, y, e.Op)
+		if err != nil {
+			return nil, operationError(e, err)
+		}
+		return out, nil
 
 	case *ast.UnaryExpr:
 		// Handle indirection cases.
 		if e.Op == token.AND {
+			// &T{...} points to a new value.
+			if lit, ok := e.X.(*ast.CompositeLit); ok {
+				v, err := scope.Interpret(lit)
+				if err != nil {
+					return nil, err
+				}
+				ptr := reflect.New(reflect.TypeOf(v))
+				ptr.Elem().Set(reflect.ValueOf(v))
+				return ptr.Interface(), nil
+			}
 			ident, isIdent := e.X.(*ast.Ident)
 			if !isIdent {
 				return nil, errors.Errorf("expected identifier; got %#v", e.X)
 			}
 			val, exists := scope.GetPointer(ident.Name)
 			if !exists {
-				return nil, errors.Errorf("unknown identifier %#v", ident)
+				return nil, &UndefinedError{Name: ident.Name}
 			}
 			return val, nil
 		}
@@ -433,7 +764,7 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		}
 		rType, ok := typ.(reflect.Type)
 		if !ok {
-			return nil, errors.Errorf("invalid type %#v", typ)
+			return nil, newTypeError("array element", "type", typ)
 		}
 		if e.Len == nil {
 			return reflect.SliceOf(rType), nil
@@ -445,13 +776,32 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		}
 		lenI, ok := len.(int)
 		if !ok {
-			return nil, errors.Errorf("expected int; got %#v", len)
+			return nil, newTypeError("array length", "int", len)
 		}
 		if lenI < 0 {
 			return nil, errors.Errorf("negative array size")
 		}
 		return reflect.ArrayOf(lenI, rType), nil
 
+	case *ast.StarExpr:
+		// *T is a pointer type, such as in var b *bytes.Buffer, and *p
+		// what p points to.
+		x, err := scope.Interpret(e.X)
+		if err != nil {
+			return nil, err
+		}
+		if typ, ok := x.(reflect.Type); ok {
+			return reflect.PtrTo(typ), nil
+		}
+		v := reflect.ValueOf(x)
+		if v.Kind() != reflect.Ptr {
+			return nil, newTypeError("pointer indirection", "pointer", x)
+		}
+		if v.IsNil() {
+			return nil, errors.New("invalid memory address or nil pointer dereference")
+		}
+		return v.Elem().Interface(), nil
+
 	case *ast.MapType:
 		keyType, err := scope.Interpret(e.Key)
 		if err != nil {
@@ -471,7 +821,7 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		}
 		typ, isType := typeI.(reflect.Type)
 		if !isType {
-			return nil, fmt.Errorf("chan needs to be passed a type not %T", typ)
+			return nil, newTypeError("chan element", "type", typeI)
 		}
 		return reflect.ChanOf(reflect.BothDir, typ), nil
 
@@ -480,46 +830,20 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
-		i, err := scope.Interpret(e.Index)
-		if err != nil {
-			return nil, err
-		}
-		xVal := reflect.ValueOf(X)
-		for xVal.Type().Kind() == reflect.Ptr {
-			xVal = xVal.Elem()
-		}
-		switch xVal.Type().Kind() {
-		case reflect.Map:
-			val := xVal.MapIndex(reflect.ValueOf(i))
-			if !val.IsValid() {
-				// If not valid key, return the "zero" type. Eg for int 0, string ""
-				return reflect.Zero(xVal.Type().Elem()).Interface(), nil
-			}
-			return val.Interface(), nil
-
-		case reflect.Slice, reflect.Array:
-			iVal, isInt := i.(int)
-			if !isInt {
-				return nil, fmt.Errorf("index has to be an int not %T", i)
-			}
-			if iVal >= xVal.Len() || iVal < 0 {
-				return nil, errors.New("slice index out of range")
-			}
-
-			return xVal.Index(iVal).Interface(), nil
-
-		default:
-			return nil, errors.Errorf("invalid X for IndexExpr: %#v", X)
-		}
+		return scope.index(e, X)
 
 	case *ast.SliceExpr:
-		low, err := scope.Interpret(e.Low)
-		if err != nil {
-			return nil, err
+		var low, high interface{}
+		var err error
+		if e.Low != nil {
+			if low, err = scope.Interpret(e.Low); err != nil {
+				return nil, err
+			}
 		}
-		high, err := scope.Interpret(e.High)
-		if err != nil {
-			return nil, err
+		if e.High != nil {
+			if high, err = scope.Interpret(e.High); err != nil {
+				return nil, err
+			}
 		}
 		X, err := scope.Interpret(e.X)
 		if err != nil {
@@ -530,19 +854,28 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 			low = 0
 		}
 		kind := xVal.Kind()
-		if kind != reflect.Array && kind != reflect.Slice {
+		if kind != reflect.Array && kind != reflect.Slice && kind != reflect.String {
 			return nil, errors.Errorf("invalid X for SliceExpr: %#v", X)
 		}
+		if kind == reflect.Array {
+			// Slicing an array requires it to be addressable.
+			arr := reflect.New(xVal.Type()).Elem()
+			arr.Set(xVal)
+			xVal = arr
+		}
 		if high == nil {
 			high = xVal.Len()
 		}
 		lowVal, isLowInt := low.(int)
+		if !isLowInt {
+			return nil, newTypeError("slice index", "int", low)
+		}
 		highVal, isHighInt := high.(int)
-		if !isLowInt || !isHighInt {
-			return nil, fmt.Errorf("slice: indexes have to be an ints not %T and %T", low, high)
+		if !isHighInt {
+			return nil, newTypeError("slice index", "int", high)
 		}
-		if lowVal < 0 || highVal >= xVal.Len() || highVal < lowVal {
-			return nil, errors.New("slice: index out of bounds")
+		if err := checkSlice(e.X, lowVal, highVal, xVal); err != nil {
+			return nil, err
 		}
 		return xVal.Slice(lowVal, highVal).Interface(), nil
 
@@ -550,10 +883,13 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		return scope.Interpret(e.X)
 
 	case *ast.FuncLit:
-		return &Func{e}, nil
+		return &Func{Def: e, src: scope.currentSource(), scope: scope}, nil
 	case *ast.BlockStmt:
 		var outFinal interface{}
 		for _, stmts := range e.List {
+			if err := scope.checkInterrupt(); err != nil {
+				return nil, err
+			}
 			out, err := scope.Interpret(stmts)
 			if err != nil {
 				return out, err
@@ -572,16 +908,22 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 			results[i] = out
 		}
 
-		if len(results) == 0 {
-			return nil, nil
-		} else if len(results) == 1 {
-			return results[0], nil
+		var out interface{}
+		if len(results) == 1 {
+			out = results[0]
+		} else if len(results) > 1 {
+			out = results
 		}
-		return results, nil
+		return out, &returnSignal{value: out}
 
 	case *ast.AssignStmt:
-		// TODO implement type checking
-		//define := e.Tok == token.DEFINE
+		if len(e.Lhs) == 2 && len(e.Rhs) == 1 {
+			rhs, err := scope.commaOk(e.Rhs[0])
+			if err != nil {
+				return nil, err
+			}
+			return scope.assign(e, rhs)
+		}
 		rhs := make([]interface{}, len(e.Rhs))
 		for i, expr := range e.Rhs {
 			val, err := scope.Interpret(expr)
@@ -590,201 +932,58 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 			}
 			rhs[i] = val
 		}
+		return scope.assign(e, rhs)
 
-		if len(rhs) == 1 && len(e.Lhs) > 1 && reflect.TypeOf(rhs[0]).Kind() == reflect.Slice {
-			rhsV := reflect.ValueOf(rhs[0])
-			rhsLen := rhsV.Len()
-			if rhsLen != len(e.Lhs) {
-				return nil, fmt.Errorf("assignment count mismatch: %d = %d", len(e.Lhs), rhsLen)
+	case *ast.IncDecStmt:
+		return scope.Interpret(incDecAssign(e))
+	case *ast.RangeStmt:
+		return nil, scope.interpretRange(e)
+	case *ast.ExprStmt:
+		return scope.Interpret(e.X)
+	case *ast.DeclStmt:
+		return scope.Interpret(e.Decl)
+	case *ast.GenDecl:
+		switch e.Tok {
+		case token.IMPORT:
+			for _, spec := range e.Specs {
+				if err := scope.importPackage(spec.(*ast.ImportSpec)); err != nil {
+					return nil, err
+				}
 			}
-
-			rhs = rhs[:0]
-
-			for i := 0; i < rhsLen; i++ {
-				rhs = append(rhs, rhsV.Index(i).Interface())
+			return nil, nil
+		case token.CONST:
+			return nil, scope.declareConsts(e)
+		case token.TYPE:
+			return nil, scope.declareTypes(e)
+		}
+		for _, spec := range e.Specs {
+			if _, err := scope.Interpret(spec); err != nil {
+				return nil, err
 			}
 		}
-
-		if len(rhs) != len(e.Lhs) {
-			return nil, fmt.Errorf("assignment count mismatch: %d = %d (%+v)", len(e.Lhs), len(rhs), rhs)
-		}
-
-		for i, id := range e.Lhs {
-			getR := func(val interface{}) (interface{}, error) {
-				r := rhs[i]
-				isModAssign := e.Tok != token.ASSIGN && e.Tok != token.DEFINE
-				if isModAssign {
-					var err error
-					r, err = ComputeBinaryOp(val, r, DeAssign(e.Tok))
-					if err != nil {
-						return nil, err
-					}
-				}
-				return r, nil
-			}
-
-			if ident, ok := id.(*ast.Ident); ok {
-				val, exists := scope.Get(ident.Name)
-				if !exists && (e.Tok != token.DEFINE) {
-					return nil, errors.Errorf("undefined %s", ident.Name)
-				}
-
-				r, err := getR(val)
-				if err != nil {
-					return nil, err
-				}
-				scope.Set(ident.Name, r)
-				continue
-			} else if idx, ok := id.(*ast.IndexExpr); ok {
-				left, err := scope.getValue(idx.X)
-				if err != nil {
-					return nil, err
-				}
-				if left.Type().Kind() == reflect.Map {
-					index, err := scope.Interpret(idx.Index)
-					if err != nil {
-						return nil, err
-					}
-					var val interface{}
-					leftV := left.MapIndex(reflect.ValueOf(index))
-					if leftV.IsValid() {
-						val = leftV.Interface()
-					} else {
-						val = reflect.Zero(left.Type().Elem()).Interface()
-					}
-					r, err := getR(val)
-					if err != nil {
-						return nil, err
-					}
-					left.SetMapIndex(reflect.ValueOf(index), reflect.ValueOf(r))
-					continue
-				}
-			}
-
-			val, err := scope.getValue(id)
-			if err != nil {
-				return nil, err
-			}
-
-			r, err := getR(val.Interface())
-			if err != nil {
-				return nil, err
-			}
-			val.Set(reflect.ValueOf(r))
-		}
-
-		if len(rhs) > 1 {
-			return rhs, nil
-		}
-		return rhs[0], nil
-
-	case *ast.IncDecStmt:
-		var dir string
-		switch e.Tok {
-		case token.INC:
-			dir = "1"
-		case token.DEC:
-			dir = "-1"
-		}
-		ass := &ast.AssignStmt{
-			Tok: token.ASSIGN,
-			Lhs: []ast.Expr{e.X},
-			Rhs: []ast.Expr{&ast.BinaryExpr{
-				X:  e.X,
-				Op: token.ADD,
-				Y: &ast.BasicLit{
-					Kind:  token.INT,
-					Value: dir,
-				},
-			}},
-		}
-		return scope.Interpret(ass)
-	case *ast.RangeStmt:
-		s := scope.NewChild()
-		ranger, err := s.Interpret(e.X)
-		if err != nil {
-			return nil, err
-		}
-		var key, value string
-		if e.Key != nil {
-			key = e.Key.(*ast.Ident).Name
-		}
-		if e.Value != nil {
-			value = e.Value.(*ast.Ident).Name
-		}
-		rv := reflect.ValueOf(ranger)
-		switch rv.Type().Kind() {
-		case reflect.Array, reflect.Slice:
-			for i := 0; i < rv.Len(); i++ {
-				if len(key) > 0 {
-					s.Set(key, i)
-				}
-				if len(value) > 0 {
-					s.Set(value, rv.Index(i).Interface())
-				}
-				s.Interpret(e.Body)
-			}
-		case reflect.Map:
-			keys := rv.MapKeys()
-			for _, keyV := range keys {
-				if len(key) > 0 {
-					s.Set(key, keyV.Interface())
-				}
-				if len(value) > 0 {
-					s.Set(value, rv.MapIndex(keyV).Interface())
-				}
-				s.Interpret(e.Body)
-			}
-		default:
-			return nil, fmt.Errorf("ranging on %s is unsupported", rv.Type().Kind().String())
-		}
-		return nil, nil
-	case *ast.ExprStmt:
-		return scope.Interpret(e.X)
-	case *ast.DeclStmt:
-		return scope.Interpret(e.Decl)
-	case *ast.GenDecl:
-		for _, spec := range e.Specs {
-			if _, err := scope.Interpret(spec); err != nil {
-				return nil, err
-			}
-		}
-		return nil, nil
-	case *ast.ValueSpec:
-		typ, err := scope.Interpret(e.Type)
-		if err != nil {
-			return nil, err
-		}
-		zero := reflect.Zero(typ.(reflect.Type)).Interface()
-		for i, name := range e.Names {
-			if len(e.Values) > i {
-				v, err := scope.Interpret(e.Values[i])
-				if err != nil {
-					return nil, err
-				}
-				scope.Set(name.Name, v)
-			} else {
-				scope.Set(name.Name, zero)
-			}
-		}
-		return nil, nil
-	case *ast.ForStmt:
-		s := scope.NewChild()
-		if e.Init != nil {
-			if _, err := s.Interpret(e.Init); err != nil {
-				return nil, err
-			}
+		return nil, nil
+	case *ast.ValueSpec:
+		return nil, scope.declareValues(e, scope)
+	case *ast.ForStmt:
+		s := scope.NewChild()
+		if e.Init != nil {
+			if _, err := s.Interpret(e.Init); err != nil {
+				return nil, err
+			}
 		}
 		var err error
 		var last interface{}
 		for {
+			if err := s.checkInterrupt(); err != nil {
+				return nil, err
+			}
 			if e.Cond != nil {
 				cond, err := s.Interpret(e.Cond)
 				if err != nil {
 					return nil, err
 				}
 				if cont, ok := cond.(bool); !ok {
-					return nil, fmt.Errorf("for loop requires a boolean condition not %#v", cond)
+					return nil, newTypeError("for loop condition", "bool", cond)
 				} else if !cont {
 					return last, nil
 				}
@@ -826,7 +1025,7 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		}
 		chanV := reflect.ValueOf(channel)
 		if chanV.Kind() != reflect.Chan {
-			return nil, errors.Errorf("expected chan; got %#v", channel)
+			return nil, newTypeError("send", "chan", channel)
 		}
 		succeeded := chanV.TrySend(reflect.ValueOf(val))
 		if !succeeded {
@@ -955,7 +1154,7 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 				if err != nil {
 					return nil, err
 				}
-				if out == want {
+				if typeSwitchMatches(out, want) {
 					return child.Interpret(cc)
 				}
 			}
@@ -992,8 +1191,19 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
+		// Values satisfy the interfaces they implement.
+		if iface, ok := typ.(reflect.Type); ok && iface.Kind() == reflect.Interface {
+			if err := newInterfaceError("type assertion", out, iface); err != nil {
+				return nil, err
+			}
+			return out, nil
+		}
 		if typ != outType {
-			return nil, fmt.Errorf("%#v is not of type %#v, is %T", out, typ, out)
+			return nil, &TypeError{
+				Expected: fmt.Sprint(typ),
+				Got:      outType,
+				Context:  "type assertion",
+			}
 		}
 		return out, nil
 
@@ -1008,8 +1218,12 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
-		if cond == true {
+		if ok, isBool := cond.(bool); !isBool {
+			return nil, newTypeError("if condition", "bool", cond)
+		} else if ok {
 			return currentScope.Interpret(e.Body)
+		} else if e.Else == nil {
+			return nil, nil
 		}
 		return currentScope.Interpret(e.Else)
 
@@ -1036,17 +1250,154 @@ func (scope *Scope) Interpret(expr ast.Node) (interface{}, error) {
 		return reflect.TypeOf(struct{}{}), nil
 
 	default:
+		// Instantiations with several type arguments.
+		if x, indices, ok := indexExprs(e); ok {
+			X, err := scope.Interpret(x)
+			if err != nil {
+				return nil, err
+			}
+			generic, ok := X.(Generic)
+			if !ok {
+				return nil, newTypeError("instantiation", "generic function or type", X)
+			}
+			return generic.Instantiate(typeArgs(indices))
+		}
 		return nil, fmt.Errorf("unknown node %#v", e)
 	}
 }
 
+// compositeLit returns the value of the composite literal e of type aType,
+// whose type may be left out of e when it's an element of another literal.
+func (scope *Scope) compositeLit(e *ast.CompositeLit, aType reflect.Type) (interface{}, error) {
+	switch aType.Kind() {
+	case reflect.Slice, reflect.Array:
+		l := len(e.Elts)
+		var slice reflect.Value
+		switch aType.Kind() {
+		case reflect.Slice:
+			slice = reflect.MakeSlice(aType, l, l)
+		case reflect.Array:
+			slice = reflect.New(aType).Elem()
+		}
+
+		if len(e.Elts) > slice.Len() {
+			return nil, errors.Errorf("array index %d out of bounds [0:%d]", slice.Len(), slice.Len())
+		}
+
+		for i, elem := range e.Elts {
+			elemValue, err := scope.elementValue(elem, aType.Elem())
+			if err != nil {
+				return nil, err
+			}
+			v, err := assignValue("array or slice literal", elem, elemValue, aType.Elem())
+			if err != nil {
+				return nil, err
+			}
+			slice.Index(i).Set(v)
+		}
+		return slice.Interface(), nil
+
+	case reflect.Map:
+		nMap := reflect.MakeMap(aType)
+		for _, elem := range e.Elts {
+			switch eT := elem.(type) {
+			case *ast.KeyValueExpr:
+				key, err := scope.elementValue(eT.Key, aType.Key())
+				if err != nil {
+					return nil, err
+				}
+				val, err := scope.elementValue(eT.Value, aType.Elem())
+				if err != nil {
+					return nil, err
+				}
+				keyV, err := assignValue("map literal", eT.Key, key, aType.Key())
+				if err != nil {
+					return nil, err
+				}
+				valV, err := assignValue("map literal", eT.Value, val, aType.Elem())
+				if err != nil {
+					return nil, err
+				}
+				nMap.SetMapIndex(keyV, valV)
+
+			default:
+				return nil, fmt.Errorf("invalid element type %#v to map. Expecting key value pair", eT)
+			}
+		}
+		return nMap.Interface(), nil
+
+	case reflect.Struct:
+		objPtr := reflect.New(aType)
+		obj := objPtr.Elem()
+		for i, elem := range e.Elts {
+			switch eT := elem.(type) {
+			case *ast.KeyValueExpr:
+				key := eT.Key.(*ast.Ident).Name
+				val, err := scope.Interpret(eT.Value)
+				if err != nil {
+					return nil, err
+				}
+				field := obj.FieldByName(key)
+				if !field.IsValid() {
+					return nil, errors.Errorf("unknown field %s in struct literal of type %s", key, aType)
+				}
+				v, err := assignValue("struct literal", eT.Value, val, field.Type())
+				if err != nil {
+					return nil, err
+				}
+				field.Set(v)
+
+			default:
+				// The values of the fields in order.
+				if i >= obj.NumField() {
+					return nil, errors.Errorf("too many values in struct literal of type %s", aType)
+				}
+				val, err := scope.Interpret(eT)
+				if err != nil {
+					return nil, err
+				}
+				v, err := assignValue("struct literal", eT, val, obj.Field(i).Type())
+				if err != nil {
+					return nil, err
+				}
+				obj.Field(i).Set(v)
+			}
+		}
+		return obj.Interface(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown composite literal %#v", e.Type)
+	}
+}
+
+// elementValue returns the value of expr, an element or key of a composite
+// literal whose elements or keys are of type typ. Composite literals can
+// leave out that type, or &typ if typ is a pointer, like the {1, 2} of
+// []Point{{1, 2}}.
+func (scope *Scope) elementValue(expr ast.Expr, typ reflect.Type) (interface{}, error) {
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || lit.Type != nil {
+		return scope.Interpret(expr)
+	}
+	if typ.Kind() != reflect.Ptr {
+		return scope.compositeLit(lit, typ)
+	}
+	v, err := scope.compositeLit(lit, typ.Elem())
+	if err != nil {
+		return nil, err
+	}
+	ptr := reflect.New(typ.Elem())
+	ptr.Elem().Set(reflect.ValueOf(v))
+	return ptr.Interface(), nil
+}
+
 func (scope *Scope) getValue(id ast.Expr) (reflect.Value, error) {
 	switch id := id.(type) {
 	case *ast.Ident:
 		variable := id.Name
 		current, exists := scope.GetPointer(variable)
 		if !exists {
-			return reflect.Value{}, fmt.Errorf("variable %#v is not defined", variable)
+			return reflect.Value{}, &UndefinedError{Name: variable}
 		}
 		return reflect.ValueOf(current).Elem(), nil
 
@@ -1064,10 +1415,10 @@ func (scope *Scope) getValue(id ast.Expr) (reflect.Value, error) {
 		case reflect.Slice, reflect.Array:
 			indexInt, ok := index.(int)
 			if !ok {
-				return reflect.Value{}, errors.Errorf("expected index to be int, got %#v", index)
+				return reflect.Value{}, newTypeError("index", "int", index)
 			}
-			if indexInt >= elem.Len() {
-				return reflect.Value{}, errors.Errorf("index out of range")
+			if err := checkIndex(id.X, indexInt, elem.Len()); err != nil {
+				return reflect.Value{}, err
 			}
 			return elem.Index(indexInt), nil
 
@@ -1079,6 +1430,14 @@ func (scope *Scope) getValue(id ast.Expr) (reflect.Value, error) {
 		}
 
 	case *ast.SelectorExpr:
+		if x, ok := id.X.(*ast.Ident); ok {
+			if pkg, ok := scope.packageNamed(x.Name); ok {
+				if err := scope.checkMember(pkg, id.Sel.Name); err != nil {
+					return reflect.Value{}, err
+				}
+				return pkg.assignable(id)
+			}
+		}
 		elem, err := scope.getValue(id.X)
 		if err != nil {
 			return reflect.Value{}, err
@@ -1090,73 +1449,344 @@ func (scope *Scope) getValue(id ast.Expr) (reflect.Value, error) {
 	}
 }
 
+// addressOf returns a pointer to the variable expr names if it holds a value
+// of type typ.
+func (scope *Scope) addressOf(expr ast.Expr, typ reflect.Type) (reflect.Value, bool) {
+	ident, ok := expr.(*ast.Ident)
+	if !ok || typ.Kind() == reflect.Ptr {
+		return reflect.Value{}, false
+	}
+	ptr, _ := scope.GetPointer(ident.Name)
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Type().Elem() != typ {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// packageNamed returns the package bound to name, if any.
+func (scope *Scope) packageNamed(name string) (Package, bool) {
+	v, _ := scope.Get(name)
+	pkg, ok := v.(Package)
+	return pkg, ok
+}
+
 func (scope *Scope) ExecuteFunc(funExpr ast.Expr, args []interface{}) (interface{}, error) {
+	return scope.executeCall(funExpr, nil, args)
+}
+
+// executeCall is ExecuteFunc for a call with the argument expressions
+// argExprs, if they're known, which errors show.
+func (scope *Scope) executeCall(funExpr ast.Expr, argExprs []ast.Expr, args []interface{}) (interface{}, error) {
 	fun, err := scope.Interpret(funExpr)
 	if err != nil {
 		return nil, err
 	}
+	if generic, ok := fun.(Generic); ok {
+		if fun, err = generic.infer(args); err != nil {
+			return nil, err
+		}
+	}
 
 	switch funV := fun.(type) {
 	case reflect.Type:
 		if len(args) != 1 {
 			return nil, errors.Errorf("expected args len = 1; args %#v", args)
 		}
-		return reflect.ValueOf(args[0]).Convert(funV).Interface(), nil
+		var argExpr ast.Expr
+		if len(argExprs) == 1 {
+			argExpr = argExprs[0]
+		}
+		return scope.convert(argExpr, args[0], funV)
 
 	case *Func:
-		// TODO enforce func return values
-		currentScope := scope.NewChild()
-		i := 0
-		for _, arg := range funV.Def.Type.Params.List {
-			for _, name := range arg.Names {
-				currentScope.Set(name.Name, args[i])
-				i++
-			}
-		}
-		currentScope.isFunction = true
-		ret, err := currentScope.Interpret(funV.Def.Body)
-		if err != nil {
-			return nil, err
+		frame := Frame{
+			Func: types.ExprString(funExpr),
+			Call: scope.currentSource().position(funExpr.Pos()),
 		}
-		for i := len(currentScope.defers) - 1; i >= 0; i-- {
-			d := currentScope.defers[i]
-			if _, err := d.scope.ExecuteFunc(d.fun, d.arguments); err != nil {
-				return nil, err
-			}
+		if _, isLit := funExpr.(*ast.FuncLit); isLit {
+			frame.Func = funV.literalName()
 		}
-		return ret, nil
+		return scope.callFunc(funV, args, frame)
 	}
 
 	funVal := reflect.ValueOf(fun)
 
 	if funVal.Kind() != reflect.Func {
-		return nil, errors.Errorf("expected func; got %#v", fun)
+		return nil, newTypeError("call", "func", fun)
 	}
 
-	var valueArgs []reflect.Value
-	for _, v := range args {
-		valueArgs = append(valueArgs, reflect.ValueOf(v))
-	}
 	funType := funVal.Type()
-	if (funType.NumIn() != len(valueArgs) && !funType.IsVariadic()) || (funType.IsVariadic() && len(valueArgs) < funType.NumIn()-1) {
+	if (funType.NumIn() != len(args) && !funType.IsVariadic()) || (funType.IsVariadic() && len(args) < funType.NumIn()-1) {
 		return nil, errors.Errorf("number of arguments doesn't match function; expected %d; got %+v", funVal.Type().NumIn(), args)
 	}
-	values := ValuesToInterfaces(funVal.Call(valueArgs))
-	if len(values) > 0 {
-		if last, ok := values[len(values)-1].(*InterpretError); ok {
-			values = values[:len(values)-1]
-			if err := last.Error(); err != nil {
+	if err := scope.checkInterrupt(); err != nil {
+		return nil, err
+	}
+	if err := scope.checkCall(funVal); err != nil {
+		return nil, err
+	}
+	ident, _ := funExpr.(*ast.Ident)
+	if ident != nil && ident.Name == "make" {
+		if err := scope.currentBudget().checkMake(args); err != nil {
+			return nil, err
+		}
+	}
+	if ident == nil || !pureBuiltins[ident.Name] {
+		scope.countNativeCall()
+	}
+	valueArgs := getCallArgs(len(args))
+	for i, v := range args {
+		if v == nil {
+			// The untyped nil takes the type of the parameter.
+			param, err := assignValue("argument to "+types.ExprString(funExpr), nil, nil, paramType(funType, i))
+			if err != nil {
+				putCallArgs(valueArgs)
 				return nil, err
 			}
+			(*valueArgs)[i] = param
+			continue
+		}
+		(*valueArgs)[i] = reflect.ValueOf(v)
+	}
+	out, err := callNative(funExpr, funVal, *valueArgs)
+	putCallArgs(valueArgs)
+	if err != nil {
+		return nil, err
+	}
+	return callResult(out)
+}
+
+// index evaluates the index expression e of X, the value of e.X.
+func (scope *Scope) index(e *ast.IndexExpr, X interface{}) (interface{}, error) {
+	if generic, ok := X.(Generic); ok {
+		return generic.Instantiate(typeArgs([]ast.Expr{e.Index}))
+	}
+	i, err := scope.Interpret(e.Index)
+	if err != nil {
+		return nil, err
+	}
+	if X == nil {
+		return nil, errors.Errorf("invalid operation: %s (indexing nil)", types.ExprString(e))
+	}
+	xVal := reflect.ValueOf(X)
+	for xVal.Type().Kind() == reflect.Ptr {
+		xVal = xVal.Elem()
+	}
+	switch xVal.Type().Kind() {
+	case reflect.Map:
+		val, _, err := mapIndex(xVal, e.Index, i)
+		return val, err
+
+	case reflect.Slice, reflect.Array, reflect.String:
+		iVal, isInt := i.(int)
+		if !isInt {
+			return nil, newTypeError("index", "int", i)
+		}
+		if err := checkIndex(e.X, iVal, xVal.Len()); err != nil {
+			return nil, err
+		}
+
+		return xVal.Index(iVal).Interface(), nil
+
+	default:
+		return nil, errors.Errorf("invalid X for IndexExpr: %#v", X)
+	}
+}
+
+// mapIndex looks up the key i, the value of the expression index, in the map
+// m. Missing keys have the zero value of the elements and ok false.
+func mapIndex(m reflect.Value, index ast.Expr, i interface{}) (val interface{}, ok bool, err error) {
+	key, err := assignValue("map index", index, i, m.Type().Key())
+	if err != nil {
+		return nil, false, err
+	}
+	v := m.MapIndex(key)
+	if !v.IsValid() {
+		return reflect.Zero(m.Type().Elem()).Interface(), false, nil
+	}
+	return v.Interface(), true, nil
+}
+
+// commaOk evaluates expr, the only value of an assignment to two variables.
+// Map index expressions have their comma-ok form, v, ok := m[k], and give
+// the value and whether the key is there. Other expressions have their own
+// values, such as the results of a call.
+func (scope *Scope) commaOk(expr ast.Expr) ([]interface{}, error) {
+	idx, ok := expr.(*ast.IndexExpr)
+	if !ok {
+		v, err := scope.Interpret(expr)
+		return []interface{}{v}, err
+	}
+	X, err := scope.Interpret(idx.X)
+	if err != nil {
+		return nil, err
+	}
+	if xVal := reflect.ValueOf(X); X == nil || xVal.Kind() != reflect.Map {
+		v, err := scope.index(idx, X)
+		return []interface{}{v}, err
+	}
+	i, err := scope.Interpret(idx.Index)
+	if err != nil {
+		return nil, err
+	}
+	v, found, err := mapIndex(reflect.ValueOf(X), idx.Index, i)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{v, found}, nil
+}
+
+// paramType returns the type of the i-th argument of a call to a function of
+// type fn, that of its variadic elements if i is past its parameters.
+func paramType(fn reflect.Type, i int) reflect.Type {
+	if fn.IsVariadic() && i >= fn.NumIn()-1 {
+		return fn.In(fn.NumIn() - 1).Elem()
+	}
+	return fn.In(i)
+}
+
+// callFunc calls f with args in a child of scope. frame describes the call in
+// tracebacks.
+func (scope *Scope) callFunc(f *Func, args []interface{}, frame Frame) (interface{}, error) {
+	// TODO enforce func return values
+	currentScope := scope.NewChild()
+	i := 0
+	for _, arg := range f.Def.Type.Params.List {
+		for _, name := range arg.Names {
+			currentScope.Define(name.Name, args[i])
+			i++
+		}
+	}
+	currentScope.isFunction = true
+	currentScope.src = f.src
+	ret, err := currentScope.Interpret(f.Def.Body)
+	if r, ok := err.(*returnSignal); ok {
+		ret, err = r.value, nil
+	}
+	if err != nil {
+		return nil, withFrame(err, frame)
+	}
+	for i := len(currentScope.defers) - 1; i >= 0; i-- {
+		d := currentScope.defers[i]
+		if _, err := d.scope.ExecuteFunc(d.fun, d.arguments); err != nil {
+			return nil, withFrame(err, frame)
+		}
+	}
+	return ret, nil
+}
+
+// callResult returns what a call returning out evaluates to: nothing, its
+// only result or all of them. A trailing *InterpretError is the error of an
+// interpreted function called from compiled code and is returned as such.
+func callResult(out []reflect.Value) (interface{}, error) {
+	if len(out) == 0 {
+		return nil, nil
+	}
+	if last, ok := out[len(out)-1].Interface().(*InterpretError); ok {
+		out = out[:len(out)-1]
+		if err := last.Error(); err != nil {
+			return nil, err
 		}
 	}
 
-	if len(values) == 0 {
+	if len(out) == 0 {
 		return nil, nil
-	} else if len(values) == 1 {
-		return values[0], nil
+	} else if len(out) == 1 {
+		return out[0].Interface(), nil
+	}
+	return ValuesToInterfaces(out), nil
+}
+
+// maxPooledCallArgs is the most arguments of the native calls whose argument
+// slices are reused.
+const maxPooledCallArgs = 8
+
+// callArgs reuses the argument slices of native calls, one pool per number of
+// arguments, since calls in loops would otherwise allocate one each.
+var callArgs [maxPooledCallArgs + 1]sync.Pool
+
+// getCallArgs returns a slice for n arguments, to be put back with
+// putCallArgs once the call returns.
+func getCallArgs(n int) *[]reflect.Value {
+	if n <= maxPooledCallArgs {
+		if args, ok := callArgs[n].Get().(*[]reflect.Value); ok {
+			return args
+		}
+	}
+	args := make([]reflect.Value, n)
+	return &args
+}
+
+// putCallArgs makes args available to other calls.
+func putCallArgs(args *[]reflect.Value) {
+	n := len(*args)
+	if n > maxPooledCallArgs {
+		return
+	}
+	// Don't keep the arguments alive.
+	for i := range *args {
+		(*args)[i] = reflect.Value{}
+	}
+	callArgs[n].Put(args)
+}
+
+// checkIndex returns an error if i isn't a valid index into a container of
+// the given length. The wording matches the Go runtime's panics.
+func checkIndex(x ast.Expr, i, length int) error {
+	if i < 0 {
+		return rangeError(x, "invalid index [%d] (index must be non-negative)", i)
+	}
+	if i >= length {
+		return rangeError(x, "index out of range [%d] with length %d", i, length)
+	}
+	return nil
+}
+
+// checkSlice returns an error if low and high aren't valid slice bounds of v.
+func checkSlice(x ast.Expr, low, high int, v reflect.Value) error {
+	if low < 0 {
+		return rangeError(x, "invalid slice index [%d:] (index must be non-negative)", low)
+	}
+	if high < 0 {
+		return rangeError(x, "invalid slice index [:%d] (index must be non-negative)", high)
+	}
+	if v.Kind() == reflect.String {
+		if high > v.Len() {
+			return rangeError(x, "slice bounds out of range [:%d] with length %d", high, v.Len())
+		}
+	} else if high > v.Cap() {
+		return rangeError(x, "slice bounds out of range [:%d] with capacity %d", high, v.Cap())
 	}
-	return values, nil
+	if low > high {
+		return rangeError(x, "slice bounds out of range [%d:%d]", low, high)
+	}
+	return nil
+}
+
+// rangeError formats an out of range error, prefixing it with the name of the
+// container if it's a plain identifier.
+func rangeError(x ast.Expr, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if ident, ok := x.(*ast.Ident); ok {
+		msg = ident.Name + ": " + msg
+	}
+	return errors.New(msg)
+}
+
+// callNative calls a compiled function and converts any panic, such as the
+// ones raised by reflect for mismatched arguments, into a *CallError.
+func callNative(funExpr ast.Expr, funVal reflect.Value, args []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cause, ok := r.(error)
+			if !ok {
+				cause = errors.New(fmt.Sprint(r))
+			}
+			err = &CallError{Func: types.ExprString(funExpr), Cause: cause}
+		}
+	}()
+	return funVal.Call(args), nil
 }
 
 // ConfigureTypes configures the scope type checker
@@ -1279,37 +1909,275 @@ func (scope *Scope) TypeCheck() (*types.Info, []error) {
 	return info, errs
 }
 
-// StringToType returns the reflect.Type corresponding to the type string provided. Ex: StringToType("int")
+// lookup returns the value of the identifier name, which isn't a type.
+func (scope *Scope) lookup(name string) (interface{}, error) {
+	if obj, exists := scope.Get(name); exists {
+		return obj, nil
+	}
+	return scope.lookupGlobal(name)
+}
+
+// ident returns the value of the identifier name: a variable in scope, which
+// shadows the predeclared and registered types like in Go, a type or a value
+// lookup finds.
+func (scope *Scope) ident(name string) (interface{}, error) {
+	if obj, exists := scope.Get(name); exists {
+		return obj, nil
+	}
+	// Not StringToType, whose error for every variable is costly.
+	if typ, ok := namedType(name); ok {
+		return typ, nil
+	}
+	return scope.lookupGlobal(name)
+}
+
+// lookupGlobal returns the registered value or builtin called name.
+func (scope *Scope) lookupGlobal(name string) (interface{}, error) {
+	obj, exists := scope.registeredValue(name)
+	if !exists {
+		// TODO make builtinScope root of other scopes
+		obj, exists = builtinScope[name]
+		if !exists {
+			return nil, &UndefinedError{
+				Name: name,
+				Hint: didYouMean(name, scope.identCandidates()),
+			}
+		}
+	}
+	return obj, nil
+}
+
+// operationError adds the expression e to err if it's an *OperationError of
+// computing e.
+func operationError(e *ast.BinaryExpr, err error) error {
+	if opErr, ok := err.(*OperationError); ok && len(opErr.Expr) == 0 {
+		opErr.Expr = types.ExprString(e)
+	}
+	return err
+}
+
+// typeSwitchMatches returns whether the case c of a type switch, a type or
+// nil, matches the dynamic type want of the value switched on. Interface
+// cases match the values implementing them.
+func typeSwitchMatches(c interface{}, want reflect.Type) bool {
+	if typ, ok := c.(reflect.Type); ok && typ.Kind() == reflect.Interface {
+		return want != nil && want.Implements(typ)
+	}
+	return c == want
+}
+
+// incDecAssign returns the assignment x++ and x-- stand for.
+func incDecAssign(e *ast.IncDecStmt) *ast.AssignStmt {
+	tok := token.ADD_ASSIGN
+	if e.Tok == token.DEC {
+		tok = token.SUB_ASSIGN
+	}
+	return &ast.AssignStmt{
+		Tok: tok,
+		Lhs: []ast.Expr{e.X},
+		Rhs: []ast.Expr{&ast.BasicLit{
+			Kind:  token.INT,
+			Value: "1",
+		}},
+	}
+}
+
+// assignedValue returns the value an assignment with tok of r, the value of
+// rhsExpr, stores in a location holding val. typ is the type of the location
+// or nil if it isn't known.
+func assignedValue(tok token.Token, rhsExpr ast.Expr, r, val interface{}, typ reflect.Type) (interface{}, error) {
+	isModAssign := tok != token.ASSIGN && tok != token.DEFINE
+	if isModAssign {
+		if typ != nil {
+			if converted, ok := convertUntyped(rhsExpr, r, typ); ok {
+				r = converted
+			}
+		}
+		var err error
+		r, err = ComputeBinaryOp(val, r, DeAssign(tok))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if typ == nil {
+		return r, nil
+	}
+	return coerceAssign(rhsExpr, r, typ)
+}
+
+// variableType returns the type of the variable kept in a scope as ptr, with
+// the value val.
+func variableType(ptr, val interface{}) reflect.Type {
+	// Variables of the program keep their declared type.
+	if t := reflect.TypeOf(ptr); t != nil && t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return reflect.TypeOf(val)
+}
+
+// declaredType is variableType for any name in a scope, including the types
+// kept as they are and names bound to nil.
+func declaredType(ptr, val interface{}) reflect.Type {
+	if _, isType := ptr.(reflect.Type); isType || ptr == nil {
+		return reflect.TypeOf(val)
+	}
+	return variableType(ptr, val)
+}
+
+// assign runs the assignment e of the values rhs of its right-hand side.
+func (scope *Scope) assign(e *ast.AssignStmt, rhs []interface{}) (interface{}, error) {
+	if len(rhs) == 1 && len(e.Lhs) > 1 && reflect.TypeOf(rhs[0]).Kind() == reflect.Slice {
+		rhsV := reflect.ValueOf(rhs[0])
+		rhsLen := rhsV.Len()
+		if rhsLen != len(e.Lhs) {
+			return nil, fmt.Errorf("assignment count mismatch: %d = %d", len(e.Lhs), rhsLen)
+		}
+
+		rhs = rhs[:0]
+
+		for i := 0; i < rhsLen; i++ {
+			rhs = append(rhs, rhsV.Index(i).Interface())
+		}
+	}
+
+	if len(rhs) != len(e.Lhs) {
+		return nil, fmt.Errorf("assignment count mismatch: %d = %d (%+v)", len(e.Lhs), len(rhs), rhs)
+	}
+
+	for i, id := range e.Lhs {
+		var rhsExpr ast.Expr
+		if len(e.Rhs) == len(e.Lhs) {
+			rhsExpr = e.Rhs[i]
+		}
+
+		getR := func(val interface{}, typ reflect.Type) (interface{}, error) {
+			return assignedValue(e.Tok, rhsExpr, rhs[i], val, typ)
+		}
+
+		if ident, ok := id.(*ast.Ident); ok {
+			val, exists := scope.Get(ident.Name)
+			if !exists && ident.Name == "_" && e.Tok == token.ASSIGN {
+				// Outside of sessions, which keep the last result in _,
+				// the blank identifier discards the value.
+				continue
+			}
+			if !exists && (e.Tok != token.DEFINE) {
+				return nil, &UndefinedError{Name: ident.Name}
+			}
+
+			var typ reflect.Type
+			if exists && e.Tok != token.DEFINE {
+				ptr, _ := scope.GetPointer(ident.Name)
+				typ = variableType(ptr, val)
+			}
+			r, err := getR(val, typ)
+			if err != nil {
+				return nil, err
+			}
+			rhs[i] = r
+			// := declares a new variable unless the name is already in
+			// this scope.
+			scope.Lock()
+			_, local := scope.Vals[ident.Name]
+			scope.Unlock()
+			if e.Tok == token.DEFINE && !local {
+				scope.Define(ident.Name, r)
+			} else {
+				scope.Set(ident.Name, r)
+			}
+			continue
+		} else if idx, ok := id.(*ast.IndexExpr); ok {
+			left, err := scope.getValue(idx.X)
+			if err != nil {
+				return nil, err
+			}
+			if left.Type().Kind() == reflect.Map {
+				index, err := scope.Interpret(idx.Index)
+				if err != nil {
+					return nil, err
+				}
+				var val interface{}
+				leftV := left.MapIndex(reflect.ValueOf(index))
+				if leftV.IsValid() {
+					val = leftV.Interface()
+				} else {
+					val = reflect.Zero(left.Type().Elem()).Interface()
+				}
+				elemType := left.Type().Elem()
+				r, err := getR(val, elemType)
+				if err != nil {
+					return nil, err
+				}
+				rhs[i] = r
+				left.SetMapIndex(reflect.ValueOf(index), valueOf(r, elemType))
+				continue
+			}
+		}
+
+		val, err := scope.getValue(id)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := getR(val.Interface(), val.Type())
+		if err != nil {
+			return nil, err
+		}
+		rhs[i] = r
+		val.Set(valueOf(r, val.Type()))
+	}
+
+	if len(rhs) > 1 {
+		return rhs, nil
+	}
+	return rhs[0], nil
+}
+
+// builtinTypes are the predeclared types by name.
+var builtinTypes = map[string]reflect.Type{
+	"bool":       reflect.TypeOf(true),
+	"byte":       reflect.TypeOf(byte(0)),
+	"rune":       reflect.TypeOf(rune(0)),
+	"string":     reflect.TypeOf(""),
+	"int":        reflect.TypeOf(int(0)),
+	"int8":       reflect.TypeOf(int8(0)),
+	"int16":      reflect.TypeOf(int16(0)),
+	"int32":      reflect.TypeOf(int32(0)),
+	"int64":      reflect.TypeOf(int64(0)),
+	"uint":       reflect.TypeOf(uint(0)),
+	"uint8":      reflect.TypeOf(uint8(0)),
+	"uint16":     reflect.TypeOf(uint16(0)),
+	"uint32":     reflect.TypeOf(uint32(0)),
+	"uint64":     reflect.TypeOf(uint64(0)),
+	"uintptr":    reflect.TypeOf(uintptr(0)),
+	"float32":    reflect.TypeOf(float32(0)),
+	"float64":    reflect.TypeOf(float64(0)),
+	"complex64":  reflect.TypeOf(complex64(0)),
+	"complex128": reflect.TypeOf(complex128(0)),
+	"error":      reflect.TypeOf((*error)(nil)).Elem(),
+	"any":        reflect.TypeOf((*interface{})(nil)).Elem(),
+}
+
+// StringToType returns the reflect.Type corresponding to the type string
+// provided, a predeclared type or one registered with RegisterNamedType.
+// Ex: StringToType("int")
 func StringToType(str string) (reflect.Type, error) {
-	builtinTypes := map[string]reflect.Type{
-		"bool":       reflect.TypeOf(true),
-		"byte":       reflect.TypeOf(byte(0)),
-		"rune":       reflect.TypeOf(rune(0)),
-		"string":     reflect.TypeOf(""),
-		"int":        reflect.TypeOf(int(0)),
-		"int8":       reflect.TypeOf(int8(0)),
-		"int16":      reflect.TypeOf(int16(0)),
-		"int32":      reflect.TypeOf(int32(0)),
-		"int64":      reflect.TypeOf(int64(0)),
-		"uint":       reflect.TypeOf(uint(0)),
-		"uint8":      reflect.TypeOf(uint8(0)),
-		"uint16":     reflect.TypeOf(uint16(0)),
-		"uint32":     reflect.TypeOf(uint32(0)),
-		"uint64":     reflect.TypeOf(uint64(0)),
-		"uintptr":    reflect.TypeOf(uintptr(0)),
-		"float32":    reflect.TypeOf(float32(0)),
-		"float64":    reflect.TypeOf(float64(0)),
-		"complex64":  reflect.TypeOf(complex64(0)),
-		"complex128": reflect.TypeOf(complex128(0)),
-		"error":      reflect.TypeOf(errors.New("")),
-	}
-	val, present := builtinTypes[str]
+	val, present := namedType(str)
 	if !present {
 		return nil, fmt.Errorf("type %#v is not in table", str)
 	}
 	return val, nil
 }
 
+// namedType returns the predeclared or registered type called name.
+func namedType(name string) (reflect.Type, bool) {
+	if t, ok := builtinTypes[name]; ok {
+		return t, true
+	}
+	t, ok := loadRegisteredTypes()[name]
+	return t, ok
+}
+
 // ValuesToInterfaces converts a slice of []reflect.Value to []interface{}
 func ValuesToInterfaces(vals []reflect.Value) []interface{} {
 	inters := make([]interface{}, len(vals))
@@ -1318,3 +2186,253 @@ func ValuesToInterfaces(vals []reflect.Value) []interface{} {
 	}
 	return inters
 }
+
+// declareValues declares the names of the var or const spec e in scope. Its
+// type and values are evaluated in valueScope, which has iota in const
+// declarations.
+func (scope *Scope) declareValues(e *ast.ValueSpec, valueScope *Scope) error {
+	// Without a type every name has a value, e.g. var x = 1.
+	var typ reflect.Type
+	var zero interface{}
+	if e.Type != nil {
+		t, err := valueScope.Interpret(e.Type)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if typ, ok = t.(reflect.Type); !ok {
+			return errors.Errorf("%s is not a type", types.ExprString(e.Type))
+		}
+		zero = reflect.Zero(typ).Interface()
+	}
+	// var v, ok = m[k] has the comma-ok form of the lookup.
+	var commaOk []interface{}
+	if len(e.Names) == 2 && len(e.Values) == 1 {
+		vals, err := valueScope.commaOk(e.Values[0])
+		if err != nil {
+			return err
+		}
+		if len(vals) != 2 {
+			return errors.Errorf("assignment mismatch: 2 variables but %s is 1 value", types.ExprString(e.Values[0]))
+		}
+		commaOk = vals
+	}
+	for i, name := range e.Names {
+		v := zero
+		var valueExpr ast.Expr
+		switch {
+		case commaOk != nil:
+			v = commaOk[i]
+		case len(e.Values) > i:
+			valueExpr = e.Values[i]
+			var err error
+			if v, err = valueScope.Interpret(valueExpr); err != nil {
+				return err
+			}
+		default:
+			scope.defineTyped(name.Name, v, typ)
+			continue
+		}
+		// The values are converted to the declared type, as they are
+		// when they're assigned later.
+		if typ != nil {
+			var err error
+			if v, err = coerceAssign(valueExpr, v, typ); err != nil {
+				return err
+			}
+		}
+		scope.defineTyped(name.Name, v, typ)
+	}
+	return nil
+}
+
+// declareConsts declares the constants of the const declaration d. Specs
+// without a type or values repeat those of the spec before them, and iota is
+// the index of the spec in the group.
+func (scope *Scope) declareConsts(d *ast.GenDecl) error {
+	var last *ast.ValueSpec
+	for i, spec := range d.Specs {
+		vs := spec.(*ast.ValueSpec)
+		if vs.Type == nil && len(vs.Values) == 0 && last != nil {
+			vs = &ast.ValueSpec{Names: vs.Names, Type: last.Type, Values: last.Values}
+		}
+		last = vs
+		if len(vs.Values) == 0 {
+			return errors.Errorf("missing init expr for const declaration %s", vs.Names[0].Name)
+		}
+		valueScope := scope.NewChild()
+		valueScope.Define("iota", i)
+		if err := scope.declareValues(vs, valueScope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareTypes declares the types of the type declaration d. Only aliases
+// can be declared, as reflect can't create named types.
+func (scope *Scope) declareTypes(d *ast.GenDecl) error {
+	for _, spec := range d.Specs {
+		ts := spec.(*ast.TypeSpec)
+		if !ts.Assign.IsValid() {
+			return errors.Errorf("type declarations are not supported, only aliases: use type %s = %s", ts.Name.Name, types.ExprString(ts.Type))
+		}
+		t, err := scope.Interpret(ts.Type)
+		if err != nil {
+			return err
+		}
+		typ, ok := t.(reflect.Type)
+		if !ok {
+			return errors.Errorf("%s is not a type", types.ExprString(ts.Type))
+		}
+		scope.Define(ts.Name.Name, typ)
+	}
+	return nil
+}
+
+// interpretRange runs the range loop e over an array, slice, map, integer
+// n, which yields 0 to n-1, or iterator function, which calls the body
+// through the yield function it's given.
+func (scope *Scope) interpretRange(e *ast.RangeStmt) error {
+	s := scope.NewChild()
+	ranger, err := s.Interpret(e.X)
+	if err != nil {
+		return err
+	}
+	var key, value string
+	if e.Key != nil {
+		key = e.Key.(*ast.Ident).Name
+	}
+	if e.Value != nil {
+		value = e.Value.(*ast.Ident).Name
+	}
+	// body runs an iteration with the key and value k and v. It returns
+	// whether the loop goes on.
+	body := func(k, v func() interface{}) (bool, error) {
+		if err := s.checkInterrupt(); err != nil {
+			return false, err
+		}
+		if len(key) > 0 {
+			s.Define(key, k())
+		}
+		if len(value) > 0 {
+			s.Define(value, v())
+		}
+		_, err := s.Interpret(e.Body)
+		if err == ErrBranchBreak {
+			return false, nil
+		} else if err != nil && err != ErrBranchContinue {
+			return false, err
+		}
+		return true, nil
+	}
+	if ranger == nil {
+		return errors.Errorf("cannot range over %s (untyped nil)", types.ExprString(e.X))
+	}
+	if f, ok := ranger.(*Func); ok {
+		return s.rangeFunc(e, f, reflect.Value{}, body)
+	}
+	rv := reflect.ValueOf(ranger)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < rv.Len(); i++ {
+			i := i
+			if more, err := body(func() interface{} { return i }, func() interface{} { return rv.Index(i).Interface() }); !more {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, keyV := range rv.MapKeys() {
+			keyV := keyV
+			if more, err := body(keyV.Interface, func() interface{} { return rv.MapIndex(keyV).Interface() }); !more {
+				return err
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if len(value) > 0 {
+			return errors.Errorf("range over %s permits only one iteration variable", types.ExprString(e.X))
+		}
+		// Negative numbers yield nothing.
+		var n uint64
+		if rv.Kind() >= reflect.Uint {
+			n = rv.Uint()
+		} else if rv.Int() > 0 {
+			n = uint64(rv.Int())
+		}
+		for i := uint64(0); i < n; i++ {
+			k := reflect.ValueOf(i).Convert(rv.Type()).Interface
+			if more, err := body(k, nil); !more {
+				return err
+			}
+		}
+	case reflect.Func:
+		return s.rangeFunc(e, nil, rv, body)
+	default:
+		return errors.Errorf("cannot range over %s (type %s)", types.ExprString(e.X), rv.Type())
+	}
+	return nil
+}
+
+// rangeFunc runs the range loop e over an iterator, the interpreted function
+// f or else the native function fn, such as func(yield func(K, V) bool). The
+// iterator calls body through yield until it returns false.
+func (scope *Scope) rangeFunc(e *ast.RangeStmt, f *Func, fn reflect.Value, body func(k, v func() interface{}) (bool, error)) error {
+	var typ reflect.Type
+	if f != nil {
+		params, variadic, err := f.definedIn().fieldTypes(f.Def.Type.Params)
+		if err != nil {
+			return err
+		}
+		results, _, err := f.definedIn().fieldTypes(f.Def.Type.Results)
+		if err != nil {
+			return err
+		}
+		typ = reflect.FuncOf(params, results, variadic)
+	} else {
+		typ = fn.Type()
+	}
+	if typ.NumIn() != 1 || typ.NumOut() != 0 || typ.IsVariadic() {
+		return errors.Errorf("cannot range over %s (type %s): func must be func(yield func(...) bool)", types.ExprString(e.X), typ)
+	}
+	yieldType := typ.In(0)
+	if yieldType.Kind() != reflect.Func || yieldType.NumIn() > 2 || yieldType.IsVariadic() ||
+		yieldType.NumOut() != 1 || yieldType.Out(0).Kind() != reflect.Bool {
+		return errors.Errorf("cannot range over %s (type %s): yield func must be func(...) bool", types.ExprString(e.X), typ)
+	}
+	if yieldType.NumIn() == 0 && e.Key != nil {
+		return errors.Errorf("range over %s permits no iteration variables", types.ExprString(e.X))
+	} else if yieldType.NumIn() == 1 && e.Value != nil {
+		return errors.Errorf("range over %s permits only one iteration variable", types.ExprString(e.X))
+	}
+
+	// done is set once the body stops the loop, after which the iterator
+	// mustn't call yield.
+	var done bool
+	var bodyErr error
+	yield := reflect.MakeFunc(yieldType, func(in []reflect.Value) []reflect.Value {
+		more := false
+		if done {
+			if bodyErr == nil {
+				bodyErr = errors.New("range function continued iteration after loop body returned false")
+			}
+		} else {
+			arg := func(i int) func() interface{} {
+				return func() interface{} { return in[i].Interface() }
+			}
+			if more, bodyErr = body(arg(0), arg(1)); !more {
+				done = true
+			}
+		}
+		return []reflect.Value{reflect.ValueOf(more).Convert(yieldType.Out(0))}
+	})
+	if f != nil {
+		if _, err := f.callNatively(typ, []reflect.Value{yield}); err != nil {
+			return err
+		}
+	} else {
+		scope.countNativeCall()
+		fn.Call([]reflect.Value{yield})
+	}
+	return bodyErr
+}
@@ -1,15 +1,23 @@
 package pry
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEmptyString(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(``)
 	if err != nil {
 		t.Error(err)
@@ -23,7 +31,7 @@ func TestEmptyString(t *testing.T) {
 func TestStringLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`"Hello!"`)
 	if err != nil {
 		t.Error(err)
@@ -36,7 +44,7 @@ func TestStringLiteral(t *testing.T) {
 func TestIntLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`-1234`)
 	if err != nil {
 		t.Error(err)
@@ -48,7 +56,7 @@ func TestIntLiteral(t *testing.T) {
 func TestHexIntLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`0xC123`)
 	if err != nil {
 		t.Error(err)
@@ -61,7 +69,7 @@ func TestHexIntLiteral(t *testing.T) {
 func TestOctalIntLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`03272`)
 	if err != nil {
 		t.Error(err)
@@ -74,7 +82,7 @@ func TestOctalIntLiteral(t *testing.T) {
 func TestCharLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`'a'`)
 	if err != nil {
 		t.Error(err)
@@ -87,7 +95,7 @@ func TestCharLiteral(t *testing.T) {
 func TestArrayLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`[]int{1,2,3,4}`)
 	if err != nil {
 		t.Error(err)
@@ -101,7 +109,7 @@ func TestArrayLiteral(t *testing.T) {
 func TestFixedArrayLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`[4]int{1,2,3,4}`)
 	if err != nil {
 		t.Error(err)
@@ -115,7 +123,7 @@ func TestFixedArrayLiteral(t *testing.T) {
 func TestFixedArray(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`
 		var a [3]int
 		a[2]
@@ -132,7 +140,7 @@ func TestFixedArray(t *testing.T) {
 func TestFixedArraySet(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`
 		var a [3]int
 		b := &a
@@ -151,7 +159,7 @@ func TestFixedArraySet(t *testing.T) {
 func TestArraySet(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`
 		a := []int{1,2,3,4}
 		a[2] = 1
@@ -169,7 +177,7 @@ func TestArraySet(t *testing.T) {
 func TestMapLiteral(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`
 		map[string]int{
 			"duck": 5,
@@ -188,10 +196,36 @@ func TestMapLiteral(t *testing.T) {
 	}
 }
 
+func TestElidedCompositeLiterals(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`map[string][]int{"a": {1}, "b": {}}`, map[string][]int{"a": {1}, "b": {}}},
+		{`[]point{{1, 2}, {Y: 3}}`, []comparePoint{{1, 2}, {Y: 3}}},
+		{`[2][]string{{"a"}, {"b", "c"}}`, [2][]string{{"a"}, {"b", "c"}}},
+		{`map[point]string{{1, 2}: "a"}`, map[comparePoint]string{{1, 2}: "a"}},
+		{`m := map[string]map[string]int{"a": {"b": 1}}; m["a"]["b"]`, 1},
+		{`p := []*point{{1, 2}}; p[0].Y`, 2},
+	}
+	for _, c := range cases {
+		scope := newTestScope(t)
+		scope.Set("point", reflect.TypeOf(comparePoint{}))
+		out, err := scope.InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+		} else if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+}
+
 func TestMapSet(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`
 		a := map[string]int{}
 		a["blah"] = 1
@@ -209,7 +243,7 @@ func TestMapSet(t *testing.T) {
 func TestMapLiteralInterface(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`
 		map[string]interface{}{
 			"duck": 5,
@@ -228,10 +262,60 @@ func TestMapLiteralInterface(t *testing.T) {
 	}
 }
 
+// mapIndexPoint is a struct element type of the maps of TestMapIndex.
+type mapIndexPoint struct {
+	X    int
+	Tags []string
+}
+
+func TestMapIndex(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		// Scalars
+		{`m := map[string]int{"a": 1}; m["a"]`, 1},
+		{`m := map[string]int{"a": 1}; m["b"]`, 0},
+		{`m := map[string]int{"a": 1}; v, ok := m["a"]; []interface{}{v, ok}`, []interface{}{1, true}},
+		{`m := map[string]int{"a": 1}; v, ok := m["b"]; []interface{}{v, ok}`, []interface{}{0, false}},
+		{`var m map[string]int; v, ok := m["a"]; []interface{}{v, ok}`, []interface{}{0, false}},
+		// Slices, where a nil entry is there and a missing one isn't.
+		{`m := map[string][]int{"a": nil}; len(m["b"])`, 0},
+		{`m := map[string][]int{"a": nil}; v, ok := m["a"]; []interface{}{v == nil, ok}`, []interface{}{true, true}},
+		{`m := map[string][]int{"a": nil}; v, ok := m["b"]; []interface{}{v == nil, ok}`, []interface{}{true, false}},
+		// Structs
+		{`m := map[string]point{"a": point{X: 1}}; m["a"].X`, 1},
+		{`m := map[string]point{}; m["b"].X + len(m["b"].Tags)`, 0},
+		{`m := map[string]point{}; v, ok := m["b"]; []interface{}{v, ok}`, []interface{}{mapIndexPoint{}, false}},
+		{`m := map[string]point{"a": point{X: 2}}; var v, ok = m["a"]; []interface{}{v.X, ok}`, []interface{}{2, true}},
+		// Assignments to existing variables and the blank identifier.
+		{`m := map[int]string{1: "x"}; ok := false; _, ok = m[1]; ok`, true},
+	}
+	for _, c := range cases {
+		scope := newTestScope(t)
+		scope.Set("point", reflect.TypeOf(mapIndexPoint{}))
+		out, err := scope.InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+
+	want := `cannot use "a" (type string) as type int in map index`
+	if _, err := newTestScope(t).InterpretString(`m := map[int]int{}; m["a"]`); err == nil || err.Error() != want {
+		t.Errorf("Expected error %q; got %v", want, err)
+	}
+}
+
 func TestTypeCast(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", -1234.0)
 	out, err := scope.InterpretString(`int(a)`)
 	if err != nil {
@@ -243,11 +327,240 @@ func TestTypeCast(t *testing.T) {
 	}
 }
 
+func TestStringConversions(t *testing.T) {
+	t.Parallel()
+
+	const text = "héllo, 世界 🙂"
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`[]byte(text)`, []byte(text)},
+		{`string([]byte(text))`, text},
+		{`[]rune(text)`, []rune(text)},
+		{`string([]rune(text))`, text},
+		{`len([]rune(text))`, 11},
+		{`r := []rune(text); string(r[7]) + string(r[8])`, "世界"},
+		{`string('世')`, "世"},
+		{`'🙂'`, '🙂'},
+		{`"\u4e16\t\x41"`, "世\tA"},
+		{`string(65)`, "A"},
+		{`string(-1)`, "\uFFFD"},
+		{`string(0xD800)`, "\uFFFD"},
+		{`string(0x110000)`, "\uFFFD"},
+		{`b := []byte(text); string(b[0])`, "h"},
+		{`string(bytes("ab"))`, "ab"},
+		{`bytes(text)`, convertBytes(text)},
+	}
+	for _, c := range cases {
+		scope := newTestScope(t)
+		scope.Set("text", text)
+		scope.Set("bytes", reflect.TypeOf(convertBytes(nil)))
+		out, err := scope.InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+}
+
+// convertBytes is a named []byte type.
+type convertBytes []byte
+
+func TestStringConversionWarning(t *testing.T) {
+	t.Parallel()
+
+	const warning = "conversion from int to string yields a string of one rune, not a string of digits (did you mean fmt.Sprint(x)?)"
+	cases := []struct {
+		src  string
+		want []string
+	}{
+		{`string(65)`, []string{warning}},
+		{`n := 65; string(n)`, []string{warning}},
+		// Bytes and runes are meant as characters.
+		{`string(rune(65))`, nil},
+		{`b := []byte("A"); string(b[0])`, nil},
+		{`string([]byte("A"))`, nil},
+	}
+	for _, c := range cases {
+		res, err := Eval(context.Background(), newTestScope(t), c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if res.Value != "A" || !reflect.DeepEqual(res.Warnings, c.want) {
+			t.Errorf("%s: Expected %#v, %#v got %#v, %#v.", c.src, "A", c.want, res.Value, res.Warnings)
+		}
+	}
+}
+
+// celsius is a named float64 type with a method.
+type celsius float64
+
+func (c celsius) String() string { return fmt.Sprintf("%g°C", float64(c)) }
+
+func TestNamedTypeConversions(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`celsius(20)`, celsius(20)},
+		{`celsius(20).String()`, "20°C"},
+		{`x := 20.5; celsius(x).String()`, "20.5°C"},
+		{`float64(celsius(3))`, 3.0},
+		{`time.Duration(3e9)`, 3 * time.Second},
+		{`time.Duration(3e9).String()`, "3s"},
+		{`int64(time.Second)`, int64(time.Second)},
+		// Arithmetic keeps the named type, and untyped constants take it.
+		{`n := 3; time.Duration(n) * time.Second`, 3 * time.Second},
+		{`2 * time.Second`, 2 * time.Second},
+		{`(time.Second * 2).String()`, "2s"},
+		{`d := time.Second; d += time.Second; d << 1`, 4 * time.Second},
+		{`celsius(1) + 2.5`, celsius(3.5)},
+		{`time.Second > time.Duration(10)`, true},
+	}
+	for _, c := range cases {
+		scope := assignScope()
+		scope.Set("celsius", reflect.TypeOf(celsius(0)))
+		out, err := scope.InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+
+	errCases := []struct {
+		src  string
+		want string
+	}{
+		{`time.Duration("1s")`, `cannot convert "1s" (type string) to type time.Duration`},
+		{`b := true; celsius(b)`, "cannot convert b (type bool) to type pry.celsius"},
+		{`int(nil)`, "cannot convert nil to type int"},
+		{`time.Duration(1.5)`, "cannot convert 1.5 (untyped float constant) to type time.Duration (truncated)"},
+	}
+	for _, c := range errCases {
+		scope := assignScope()
+		scope.Set("celsius", reflect.TypeOf(celsius(0)))
+		_, err := scope.InterpretString(c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: expected error %q; got %v", c.src, c.want, err)
+		}
+	}
+}
+
+func TestTypeDeclarations(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	out, err := scope.InterpretString("type (temp = float64; temps = []temp); type id = int; temps{temp(id(20)), 1.5}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{20, 1.5}; !reflect.DeepEqual(out, want) {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	want := "type declarations are not supported, only aliases: use type Celsius = float64"
+	if _, err := scope.InterpretString("type Celsius float64"); err == nil || err.Error() != want {
+		t.Errorf("Expected error %q got %v.", want, err)
+	}
+	want = "n is not a type"
+	if _, err := scope.InterpretString("n := 3; type x = n"); err == nil || err.Error() != want {
+		t.Errorf("Expected error %q got %v.", want, err)
+	}
+}
+
+// comparePoint and compareTags are struct types for TestCompareComposite,
+// comparable and not.
+type comparePoint struct{ X, Y int }
+
+type compareTags struct {
+	Name string
+	Tags []string
+}
+
+// compareAny holds a value of any type.
+type compareAny struct{ V interface{} }
+
+func TestCompareComposite(t *testing.T) {
+	t.Parallel()
+
+	err1 := errors.New("a")
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		// Structs, field by field.
+		{`a := point{1, 2}; b := point{1, 2}; a == b`, true},
+		{`a := point{1, 2}; b := point{X: 1, Y: 3}; a == b`, false},
+		{`a := point{1, 2}; b := point{1, 3}; a != b`, true},
+		{`a := anyOf{V: 1}; b := anyOf{V: 1}; a == b`, true},
+		// Arrays, element by element.
+		{`a := [2]int{1, 2}; b := [2]int{1, 2}; a == b`, true},
+		{`a := [2]string{"a", "b"}; b := [2]string{"a", "c"}; a == b`, false},
+		// Interfaces by their dynamic types and values.
+		{`err1 == err1`, true},
+		{`err1 == errors.New("a")`, false},
+		{`var v interface{} = point{1, 2}; v == point{1, 2}`, true},
+		// Pointers and channels by identity.
+		{`a := &point{}; b := &point{}; a == b`, false},
+		{`a := &point{}; b := a; a == b`, true},
+		{`ch := make(chan int); ch == ch`, true},
+		// Anything can be compared to nil.
+		{`var s []int; s == nil`, true},
+		{`m := map[string]int{}; m != nil`, true},
+	}
+	for _, c := range cases {
+		scope := newTestScope(t)
+		scope.Set("point", reflect.TypeOf(comparePoint{}))
+		scope.Set("anyOf", reflect.TypeOf(compareAny{}))
+		scope.Set("err1", err1)
+		scope.Set("errors", Package{Name: "errors", Functions: map[string]interface{}{"New": errors.New}})
+		out, err := scope.InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+
+	errCases := []struct {
+		src  string
+		want string
+	}{
+		{`a := []int{1}; b := []int{1}; a == b`, "invalid operation: a == b (slice can only be compared to nil)"},
+		{`a := map[int]int{}; a != a`, "invalid operation: a != a (map can only be compared to nil)"},
+		{`f := func() {}; f == f`, "invalid operation: f == f (func can only be compared to nil)"},
+		{`a := tags{}; a == a`, "invalid operation: a == a (struct containing []string cannot be compared)"},
+		{`a := [1][]int{}; a == a`, "invalid operation: a == a ([1][]int cannot be compared)"},
+		{`a := anyOf{V: []int{}}; a == a`, "runtime error: comparing uncomparable type []int"},
+	}
+	for _, c := range errCases {
+		scope := newTestScope(t)
+		scope.Set("tags", reflect.TypeOf(compareTags{}))
+		scope.Set("anyOf", reflect.TypeOf(compareAny{}))
+		_, err := scope.InterpretString(c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: expected error %q; got %v", c.src, c.want, err)
+		}
+	}
+}
+
 // Selectors and Ident
 func TestBasicIdent(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", 5)
 	out, err := scope.InterpretString(`a`)
 	if err != nil {
@@ -261,7 +574,7 @@ func TestBasicIdent(t *testing.T) {
 func TestMissingBasicIdent(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`a`)
 	if err == nil || out != nil {
 		t.Error("Found non-existant ident.")
@@ -270,7 +583,7 @@ func TestMissingBasicIdent(t *testing.T) {
 func TestMapIdent(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", map[string]int{
 		"B": 10,
 	})
@@ -286,7 +599,7 @@ func TestMapIdent(t *testing.T) {
 func TestMissingMapIdent(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", map[string]int{})
 
 	out, err := scope.InterpretString(`a["b"]`)
@@ -300,7 +613,7 @@ func TestMissingMapIdent(t *testing.T) {
 func TestArrIdent(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", []int{1, 2, 3})
 
 	out, err := scope.InterpretString(`a[1]`)
@@ -316,7 +629,7 @@ func TestArrIdent(t *testing.T) {
 func TestMissingArrIdent(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", []int{1})
 
 	out, err := scope.InterpretString(`a[1]`)
@@ -328,7 +641,7 @@ func TestMissingArrIdent(t *testing.T) {
 func TestSlice(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", []int{1, 2, 3, 4})
 
 	out, err := scope.InterpretString(`a[1:3]`)
@@ -341,6 +654,156 @@ func TestSlice(t *testing.T) {
 	}
 }
 
+func TestSliceOmittedBounds(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("a", []int{1, 2, 3, 4})
+	scope.Set("b", [3]int{1, 2, 3})
+	scope.Set("c", "hello")
+
+	cases := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`a[:]`, []int{1, 2, 3, 4}},
+		{`a[2:]`, []int{3, 4}},
+		{`a[:4]`, []int{1, 2, 3, 4}},
+		{`b[1:]`, []int{2, 3}},
+		{`c[1:3]`, "el"},
+		{`c[1]`, byte('e')},
+	}
+	for _, c := range cases {
+		out, err := scope.InterpretString(c.expr)
+		if err != nil {
+			t.Errorf("%s: %+v", c.expr, err)
+		}
+		if !reflect.DeepEqual(c.expected, out) {
+			t.Errorf("%s: expected %#v got %#v.", c.expr, c.expected, out)
+		}
+	}
+}
+
+func TestOutOfRangeMessages(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("a", []int{1, 2, 3})
+	scope.Set("s", "abc")
+
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`a[7]`, "a: index out of range [7] with length 3"},
+		{`a[-1]`, "a: invalid index [-1] (index must be non-negative)"},
+		{`s[3]`, "s: index out of range [3] with length 3"},
+		{`[]int{1}[2]`, "index out of range [2] with length 1"},
+		{`a[1:5]`, "a: slice bounds out of range [:5] with capacity 3"},
+		{`a[2:1]`, "a: slice bounds out of range [2:1]"},
+		{`a[-1:]`, "a: invalid slice index [-1:] (index must be non-negative)"},
+		{`s[:4]`, "s: slice bounds out of range [:4] with length 3"},
+		{`a[5] = 1`, "a: index out of range [5] with length 3"},
+	}
+	for _, c := range cases {
+		_, err := scope.InterpretString(c.expr)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: expected error %q; got %v", c.expr, c.want, err)
+		}
+	}
+}
+
+func TestInterruptInfiniteLoop(t *testing.T) {
+	t.Parallel()
+
+	cases := []string{
+		`for {}`,
+		`for { i++ }`,
+		`for i < 100 { i = i * 1 }`,
+		`recurse := func() int { return 0 }; for { recurse() }`,
+		`for { for _, x := range []int{1, 2, 3} { i += x } }`,
+	}
+	for _, expr := range cases {
+		scope := newTestScope(t)
+		scope.Set("i", 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		done := make(chan error, 1)
+		go func() {
+			_, err := scope.InterpretStringContext(ctx, expr)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrInterrupted) {
+				t.Errorf("%s: expected ErrInterrupted; got %v", expr, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: evaluation wasn't interrupted", expr)
+		}
+		cancel()
+
+		// The scope stays usable after the interrupt.
+		out, err := scope.InterpretString(`i + 1`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := out.(int); !ok {
+			t.Errorf("%s: expected an int; got %#v", expr, out)
+		}
+	}
+}
+
+func TestEvalContext(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("i", 0)
+	calls := 0
+	scope.Set("work", func() { calls++ })
+
+	// A busy loop calling a native function stops at the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := EvalContext(ctx, scope, "for {\n\ti++\n\twork()\n}")
+		done <- err
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the evaluation wasn't interrupted")
+	}
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) || !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected an *InterruptedError wrapping context.DeadlineExceeded; got %T %v", err, err)
+	}
+
+	// Nothing runs once the context is done.
+	before := calls
+	if _, err := EvalContext(ctx, scope, "work(); i = -1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %#v got %#v.", context.DeadlineExceeded, err)
+	}
+	if calls != before {
+		t.Errorf("work was called %d times after the deadline", calls-before)
+	}
+	if i, _ := scope.Get("i"); i == -1 {
+		t.Errorf("the statements after the deadline ran")
+	}
+
+	// Cancelling between statements stops before the next one.
+	ctx, cancel = context.WithCancel(context.Background())
+	scope.Set("cancel", cancel)
+	if _, err := EvalContext(ctx, scope, "work(); cancel(); work()"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected %#v got %#v.", context.Canceled, err)
+	}
+	if calls != before+1 {
+		t.Errorf("Expected %#v got %#v.", before+1, calls)
+	}
+}
+
 // Structs
 type testStruct struct {
 	A    int
@@ -354,7 +817,7 @@ func (a testStruct) B() int {
 func TestSelector(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", testStruct{A: 1})
 
 	out, err := scope.InterpretString(`a.A`)
@@ -368,7 +831,7 @@ func TestSelector(t *testing.T) {
 }
 
 func TestStructLiteral(t *testing.T) {
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", Type(testStruct{}))
 
 	out, err := scope.InterpretString(`a{0, "a", "b"}`)
@@ -382,7 +845,7 @@ func TestStructLiteral(t *testing.T) {
 }
 
 func TestStructLiteralNamed(t *testing.T) {
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", Type(testStruct{}))
 
 	out, err := scope.InterpretString(`a{C: "c", A: 0}`)
@@ -396,7 +859,7 @@ func TestStructLiteralNamed(t *testing.T) {
 }
 
 func TestStructLiteralEmpty(t *testing.T) {
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", Type(testStruct{}))
 
 	out, err := scope.InterpretString(`a{}`)
@@ -410,7 +873,7 @@ func TestStructLiteralEmpty(t *testing.T) {
 }
 
 func TestStructSelectorAssignment(t *testing.T) {
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", testStruct{})
 
 	out, err := scope.InterpretString(`a.A = 10; a`)
@@ -426,7 +889,7 @@ func TestStructSelectorAssignment(t *testing.T) {
 func TestSelectorFunc(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", testStruct{A: 1})
 
 	out, err := scope.InterpretString(`a.B()`)
@@ -439,11 +902,218 @@ func TestSelectorFunc(t *testing.T) {
 	}
 }
 
+var testPackageVar = 1
+
+func testPackage() Package {
+	return Package{
+		Name:      "pkg",
+		Functions: map[string]interface{}{"F": func() int { return 1 }, "Shadowed": "function"},
+		Variables: map[string]interface{}{"V": &testPackageVar, "Shadowed": new(string)},
+		Consts:    map[string]interface{}{"Second": time.Second, "Pi": 3.14, "Shadowed": "const"},
+	}
+}
+
+func TestPackageMembers(t *testing.T) {
+	scope := newTestScope(t)
+	scope.Set("pkg", testPackage())
+
+	for _, c := range []struct {
+		expr string
+		want interface{}
+	}{
+		{"pkg.F()", 1},
+		{"pkg.V", 1},
+		{"pkg.Second", time.Second},
+		{"pkg.Pi", 3.14},
+		{"pkg.Shadowed", "function"},
+	} {
+		out, err := scope.InterpretString(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.want, out) {
+			t.Errorf("%s: Expected %#v got %#v.", c.expr, c.want, out)
+		}
+	}
+}
+
+func TestPackageVariableAssignment(t *testing.T) {
+	defer func() { testPackageVar = 1 }()
+	scope := newTestScope(t)
+	scope.Set("pkg", testPackage())
+
+	if _, err := scope.InterpretString("pkg.V = 5; pkg.V += 2"); err != nil {
+		t.Fatal(err)
+	}
+	if testPackageVar != 7 {
+		t.Errorf("Expected %#v got %#v.", 7, testPackageVar)
+	}
+	for _, expr := range []string{"pkg.Second = 1", "pkg.F = nil", "pkg.Missing = 1"} {
+		if _, err := scope.InterpretString(expr); err == nil {
+			t.Errorf("%s: expected an error", expr)
+		}
+	}
+}
+
+func TestLazyPackage(t *testing.T) {
+	t.Parallel()
+
+	loads := 0
+	lazy := func() Package {
+		return LazyPackage("pkg", "example.com/pkg", func() Package {
+			loads++
+			return testPackage()
+		})
+	}
+	scope := newTestScope(t)
+	scope.Set("pkg", lazy())
+	scope.Set("unused", lazy())
+	if _, err := scope.InterpretString("1 + 1"); err != nil || loads != 0 {
+		t.Errorf("Expected no loads got %d %v.", loads, err)
+	}
+	for i := 0; i < 2; i++ {
+		if out, err := scope.InterpretString("pkg.F() + pkg.V"); err != nil || out != 2 {
+			t.Errorf("Expected %#v got %#v %v.", 2, out, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("Expected %#v got %#v.", 1, loads)
+	}
+	if names, _ := Complete(scope, "unused.S", 8); !reflect.DeepEqual(candidateTexts(names), []string{"Second", "Shadowed"}) || loads != 2 {
+		t.Errorf("Expected %#v got %#v after %d loads.", []string{"Second", "Shadowed"}, candidateTexts(names), loads)
+	}
+	var undefined *UndefinedError
+	if _, err := scope.InterpretString("pkg.Missing"); !errors.As(err, &undefined) {
+		t.Errorf("Expected an *UndefinedError got %#v.", err)
+	}
+}
+
+type testCookie struct {
+	Name, Value string
+}
+
+func (c *testCookie) String() string {
+	return c.Name + "=" + c.Value
+}
+
+type testHeader map[string]string
+
+func (h testHeader) Get(key string) string {
+	return h[key]
+}
+
+func TestPackageTypes(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("pkg", Package{Name: "pkg", Types: TypeMap{
+		"Cookie":   reflect.TypeOf(testCookie{}),
+		"Header":   reflect.TypeOf(testHeader{}),
+		"Duration": reflect.TypeOf(time.Duration(0)),
+	}})
+
+	for _, c := range []struct {
+		expr string
+		want interface{}
+	}{
+		{`c := pkg.Cookie{Name: "a", Value: "b"}; c.String()`, "a=b"},
+		{`pkg.Cookie{Name: "a"}.Name`, "a"},
+		{`h := pkg.Header{"k": "v"}; h.Get("k")`, "v"},
+		{`pkg.Duration(5e9)`, 5 * time.Second},
+		{`pkg.Duration(5e9).String()`, "5s"},
+	} {
+		out, err := scope.InterpretString(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.want, out) {
+			t.Errorf("%s: Expected %#v got %#v.", c.expr, c.want, out)
+		}
+	}
+	if _, err := scope.InterpretString("pkg.Cookie = nil"); err == nil {
+		t.Error("Expected an error assigning to a type")
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("pkg", Package{Name: "pkg", Generics: map[string]Generic{
+		"Sort": {Name: "pkg.Sort", Instances: map[string]interface{}{
+			"[]int":    sort.Ints,
+			"[]string": sort.Strings,
+		}},
+		"Pair": {Name: "pkg.Pair", Instances: map[string]interface{}{
+			"string, string": reflect.TypeOf(testCookie{}),
+		}},
+	}})
+
+	for _, c := range []struct {
+		expr string
+		want interface{}
+	}{
+		{`xs := []int{3, 1, 2}; pkg.Sort[[]int](xs); xs`, []int{1, 2, 3}},
+		{`xs := []string{"b", "a"}; pkg.Sort(xs); xs`, []string{"a", "b"}},
+		{`c := pkg.Pair[string, string]{Name: "a", Value: "b"}; c.String()`, "a=b"},
+	} {
+		out, err := scope.InterpretString(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.want, out) {
+			t.Errorf("%s: Expected %#v got %#v.", c.expr, c.want, out)
+		}
+	}
+
+	for expr, want := range map[string]string{
+		`pkg.Sort[[]byte]`: "pkg.Sort[[]byte] wasn't instantiated; available: pkg.Sort[[]int], pkg.Sort[[]string]",
+		`pkg.Sort(1)`:      "cannot infer the type arguments of pkg.Sort from (int); available: pkg.Sort[[]int], pkg.Sort[[]string]",
+		`pkg.Pair{}`:       "cannot use generic type pkg.Pair without instantiation; available: pkg.Pair[string, string]",
+	} {
+		_, err := scope.InterpretString(expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: Expected an error containing %q got %v.", expr, want, err)
+		}
+	}
+}
+
+// TestDotImportScope covers the members of dot imports, which are bound in
+// the scope directly.
+func TestDotImportScope(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Vals["Cookie"] = reflect.TypeOf(testCookie{})
+	scope.Vals["ToUpper"] = strings.ToUpper
+	scope.ReadOnly = map[string]bool{"Cookie": true}
+
+	for _, c := range []struct {
+		expr string
+		want interface{}
+	}{
+		{`c := Cookie{Name: "a", Value: "b"}; c.String()`, "a=b"},
+		{`ToUpper("a")`, "A"},
+	} {
+		out, err := scope.InterpretString(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(c.want, out) {
+			t.Errorf("%s: Expected %#v got %#v.", c.expr, c.want, out)
+		}
+	}
+}
+
 // Basic Math
 func TestBasicMath(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	pairs := map[string]interface{}{
 		"2*3":        6,
 		"2.0 * 3.0":  6.0,
@@ -484,7 +1154,7 @@ func TestMathShifting(t *testing.T) {
 		{8, ">>", 2, 2},
 		{6, "&^", 4, 2},
 	}
-	scope := NewScope()
+	scope := newTestScope(t)
 	for _, typ := range types {
 		for _, td := range cases {
 			query := fmt.Sprintf("%s(%d) %s %s(%d)", typ, td.l, td.op, typ, td.r)
@@ -531,7 +1201,7 @@ func TestMathBasic(t *testing.T) {
 		{3, "!=", 3, -1},
 		{3, "!=", 4, 1},
 	}
-	scope := NewScope()
+	scope := newTestScope(t)
 	for _, typ := range types {
 		for _, td := range cases {
 			query := fmt.Sprintf("%s(%d) %s %s(%d)", typ, td.l, td.op, typ, td.r)
@@ -564,7 +1234,7 @@ func TestBoolConds(t *testing.T) {
 		{false, "||", true, true},
 		{false, "||", false, false},
 	}
-	scope := NewScope()
+	scope := newTestScope(t)
 	for _, td := range cases {
 		query := fmt.Sprintf("%#v %s %#v", td.l, td.op, td.r)
 		outI, err := scope.InterpretString(query)
@@ -618,7 +1288,7 @@ func interfaceToInt(i interface{}) int {
 func TestStringConcat(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", 5)
 
 	out, err := scope.InterpretString(`"hello" + "foo"`)
@@ -634,7 +1304,7 @@ func TestStringConcat(t *testing.T) {
 func TestParens(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", 5)
 
 	out, err := scope.InterpretString(`((10) * (a))`)
@@ -651,7 +1321,7 @@ func TestParens(t *testing.T) {
 func TestMakeSlice(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`make([]int, 1, 10)`)
 	if err != nil {
 		t.Error(err)
@@ -665,7 +1335,7 @@ func TestMakeSlice(t *testing.T) {
 func TestMakeChan(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`make(chan int, 10)`)
 	if err != nil {
 		t.Error(err)
@@ -679,7 +1349,7 @@ func TestMakeChan(t *testing.T) {
 func TestMakeChanInterface(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`make(chan interface{}, 10)`)
 	if err != nil {
 		t.Error(err)
@@ -693,7 +1363,7 @@ func TestMakeChanInterface(t *testing.T) {
 func TestMakeUnknown(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	out, err := scope.InterpretString(`make(int)`)
 	if err == nil || out != nil {
 		t.Error("Should have thrown error.")
@@ -703,7 +1373,7 @@ func TestMakeUnknown(t *testing.T) {
 func TestAppend(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", []int{1})
 
 	_, err := scope.InterpretString(`a = append(a, 2, 3)`)
@@ -724,7 +1394,7 @@ func TestAppend(t *testing.T) {
 func TestMultiReturn(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("f", func() (int, error) {
 		return 0, nil
 	})
@@ -747,7 +1417,7 @@ func TestMultiReturn(t *testing.T) {
 func TestDeclareAssignVar(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", []int{1})
 
 	out, err := scope.InterpretString(`var a, b int = 2, 3`)
@@ -769,10 +1439,34 @@ func TestDeclareAssignVar(t *testing.T) {
 	}
 }
 
+func TestDeclareVarWithoutType(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	for _, stmt := range []string{`var a = 2`, `const b = "b"`} {
+		if _, err := scope.InterpretString(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testData := []struct {
+		v    string
+		want interface{}
+	}{
+		{"a", 2},
+		{"b", "b"},
+	}
+	for _, td := range testData {
+		out, _ := scope.Get(td.v)
+		if !reflect.DeepEqual(td.want, out) {
+			t.Errorf("Expected %#v got %#v.", td.want, out)
+		}
+	}
+}
+
 func TestDeclareAssign(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", []int{1})
 
 	out, err := scope.InterpretString(`b := 2`)
@@ -789,7 +1483,7 @@ func TestDeclareAssign(t *testing.T) {
 func TestAssign(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 	scope.Set("a", 1)
 
 	if _, err := scope.InterpretString(`b = 1`); err == nil {
@@ -807,12 +1501,324 @@ func TestAssign(t *testing.T) {
 	}
 }
 
+func TestAssignTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		val  interface{}
+		expr string
+		want string
+	}{
+		{1, `a = int64(2)`, "cannot use int64(2) (type int64) as type int in assignment; use int(int64(2)) to convert"},
+		{1, `a = 1.5`, "cannot use 1.5 (type float64) as type int in assignment"},
+		{"foo", `a = []byte("bar")`, `cannot use []byte("bar") (type []uint8) as type string in assignment; use string([]byte("bar")) to convert`},
+		{1, `a = "foo"`, `cannot use "foo" (type string) as type int in assignment`},
+		{int8(1), `a = 300`, "cannot use 300 (type int) as type int8 in assignment"},
+		{int8(1), `b := 300; a = b`, "cannot use b (type int) as type int8 in assignment; use int8(b) to convert"},
+		{[]int{1}, `a[0] = "foo"`, `cannot use "foo" (type string) as type int in assignment`},
+	}
+	for _, c := range cases {
+		scope := newTestScope(t)
+		scope.Set("a", c.val)
+		_, err := scope.InterpretString(c.expr)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: expected error %q; got %v", c.expr, c.want, err)
+		}
+	}
+}
+
+func TestAssignUntypedConversion(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		val      interface{}
+		expr     string
+		expected interface{}
+	}{
+		{int64(1), `a = 2`, int64(2)},
+		{1.5, `a = 2`, 2.0},
+		{1, `a = 2.0`, 2},
+		{uint8(1), `a = 'a'`, uint8('a')},
+		{int64(1), `a += 2`, int64(3)},
+		{int64(1), `a++`, int64(2)},
+		{float32(1), `a = -0.5`, float32(-0.5)},
+	}
+	for _, c := range cases {
+		scope := newTestScope(t)
+		scope.Set("a", c.val)
+		if _, err := scope.InterpretString(c.expr); err != nil {
+			t.Errorf("%s: %+v", c.expr, err)
+		}
+		out, _ := scope.Get("a")
+		if !reflect.DeepEqual(c.expected, out) {
+			t.Errorf("%s: expected %#v got %#v.", c.expr, c.expected, out)
+		}
+	}
+}
+
+// assignScope returns a scope with stand-ins for bytes, io and time.
+func assignScope() *Scope {
+	scope := NewScope()
+	scope.Set("bytes", Package{Name: "bytes", Functions: map[string]interface{}{
+		"NewBufferString": bytes.NewBufferString,
+	}, Types: TypeMap{"Buffer": reflect.TypeOf(bytes.Buffer{})}})
+	scope.Set("io", Package{Name: "io", Types: TypeMap{
+		"Writer":     reflect.TypeOf((*io.Writer)(nil)).Elem(),
+		"Reader":     reflect.TypeOf((*io.Reader)(nil)).Elem(),
+		"ReadCloser": reflect.TypeOf((*io.ReadCloser)(nil)).Elem(),
+	}})
+	scope.Set("strings", Package{Name: "strings", Functions: map[string]interface{}{
+		"NewReader": strings.NewReader,
+	}, Types: TypeMap{"Reader": reflect.TypeOf(strings.Reader{})}})
+	scope.Set("time", Package{Name: "time", Types: TypeMap{
+		"Duration": reflect.TypeOf(time.Duration(0)),
+	}, Consts: map[string]interface{}{"Second": time.Second}})
+	return scope
+}
+
+func TestAssignDeclaredType(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString("a")
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		// Interfaces hold any value implementing them, and nil.
+		{`var w io.Writer = bytes.NewBufferString("a"); w = nil; w`, nil},
+		{`var w io.Writer; w = bytes.NewBufferString("a"); w`, buf},
+		{`var e error; e = nil; e == nil`, true},
+		{`var v interface{} = 1; v = "s"; v`, "s"},
+		{`var v interface{} = 1; v = nil; v`, nil},
+		// Pointers, maps, slices and funcs can be nil.
+		{`var b *bytes.Buffer; b == nil`, true},
+		{`b := bytes.NewBufferString("a"); b = nil; b == nil`, true},
+		{`var b *bytes.Buffer = bytes.NewBufferString("a"); *b`, *buf},
+		{`m := map[string]int{}; m = nil; len(m)`, 0},
+		{`var m map[string]int; m == nil`, true},
+		{`s := []int{1}; s = nil; len(s)`, 0},
+		// Untyped constants take the type of the variable.
+		{`var f float64 = 1; f`, 1.0},
+		{`var f float64; f = 2; f`, 2.0},
+		{`var f float32 = 1; f += 2; f`, float32(3)},
+		{`var d time.Duration = 2; d`, 2 * time.Nanosecond},
+		{`d := time.Second; d = 5; d`, 5 * time.Nanosecond},
+	}
+	for _, c := range cases {
+		out, err := assignScope().InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+		} else if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+}
+
+func TestAssignDeclaredTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`var w io.Writer = 1`, "cannot use 1 (type int) as type io.Writer in assignment: int does not implement io.Writer (missing method Write)"},
+		{`var w io.Writer; w = "s"`, `cannot use "s" (type string) as type io.Writer in assignment: string does not implement io.Writer (missing method Write)`},
+		{`var w io.Writer; b := bytes.NewBufferString("a"); w = *b`, "cannot use *b (type bytes.Buffer) as type io.Writer in assignment: bytes.Buffer does not implement io.Writer (method Write has pointer receiver)"},
+		{`var f float64; f = "x"`, `cannot use "x" (type string) as type float64 in assignment`},
+		{`var f float64 = 1; f = 2.5; i := 1; i = f`, "cannot use f (type float64) as type int in assignment; use int(f) to convert"},
+		{`i := 1; i = nil`, "cannot use nil as type int in assignment"},
+		// Named types are distinct from their underlying types.
+		{`var d time.Duration; n := int64(3); d = n`, "cannot use n (type int64) as type time.Duration in assignment; use time.Duration(n) to convert"},
+		{`n := int64(3); n = time.Second`, "cannot use time.Second (type time.Duration) as type int64 in assignment; use int64(time.Second) to convert"},
+	}
+	for _, c := range cases {
+		_, err := assignScope().InterpretString(c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: expected error %q; got %v", c.src, c.want, err)
+		}
+	}
+}
+
+// nilError is an error whose nil pointers are returned as errors.
+type nilError struct{}
+
+func (e *nilError) Error() string { return "nil error" }
+
+// nilScope is assignScope with functions taking and returning nils.
+func nilScope() *Scope {
+	scope := assignScope()
+	scope.Set("typedNil", func() error {
+		var err *nilError
+		return err
+	})
+	scope.Set("isNil", func(b *bytes.Buffer) bool { return b == nil })
+	scope.Set("count", func(s []int, m map[string]int) int { return len(s) + len(m) })
+	scope.Set("double", func(n int) int { return n * 2 })
+	scope.Set("nils", func(n int, vs ...interface{}) int {
+		for _, v := range vs {
+			if v != nil {
+				return -1
+			}
+		}
+		return len(vs)
+	})
+	return scope
+}
+
+func TestNilComparison(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`err := typedNil(); err == nil`, true},
+		{`err := typedNil(); nil != err`, false},
+		{`var b *bytes.Buffer; b == nil`, true},
+		{`b := bytes.NewBufferString("a"); b != nil`, true},
+		{`(*bytes.Buffer)(nil) == nil`, true},
+		{`[]int(nil) == nil`, true},
+		{`var m map[string]int; nil == m`, true},
+		{`nil == nil`, true},
+	}
+	for _, c := range cases {
+		out, err := nilScope().InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+}
+
+func TestNilArgument(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`isNil(nil)`, true},
+		{`count(nil, nil)`, 0},
+		{`nils(1, nil, nil)`, 2},
+		{`func(b *bytes.Buffer) bool { return b == nil }(nil)`, true},
+		{`a := []*bytes.Buffer{}; a = append(a, nil); len(a)`, 1},
+	}
+	for _, c := range cases {
+		out, err := nilScope().InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+
+	want := "cannot use nil as type int in argument to double"
+	if _, err := nilScope().InterpretString(`double(nil)`); err == nil || err.Error() != want {
+		t.Errorf("Expected error %q; got %v", want, err)
+	}
+}
+
+func TestNilAssign(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`var b *bytes.Buffer = nil; b == nil`, true},
+		{`var w io.Writer = bytes.NewBufferString("a"); w = nil; w == nil`, true},
+		{`a := make([]*bytes.Buffer, 1); a[0] = nil; a[0] == nil`, true},
+		{`a := []*bytes.Buffer{nil, bytes.NewBufferString("a")}; a[0] == nil`, true},
+		{`m := map[string][]int{"a": nil}; m["a"] == nil`, true},
+		{`a := []float64{1, 2.5}; a[0] + a[1]`, 3.5},
+	}
+	for _, c := range cases {
+		out, err := nilScope().InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+
+	errCases := []struct {
+		src  string
+		want string
+	}{
+		{`n := 1; n = nil`, "cannot use nil as type int in assignment"},
+		{`a := []int{1, nil}`, "cannot use nil as type int in array or slice literal"},
+		{`m := map[string]int{"a": nil}`, "cannot use nil as type int in map literal"},
+		{`a := []int{"x"}`, `cannot use "x" (type string) as type int in array or slice literal`},
+	}
+	for _, c := range errCases {
+		_, err := nilScope().InterpretString(c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: expected error %q; got %v", c.src, c.want, err)
+		}
+	}
+}
+
+func TestInterfaceAssertAndConvert(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{`var r io.Reader = strings.NewReader("x"); buf := make([]byte, 1); n, err := r.Read(buf); string(buf[:n]) + fmt(n) + fmt(err == nil)`, "x1true"},
+		{`var v interface{} = bytes.NewBufferString("a"); w := v.(io.Writer); w.Write([]byte("b")); v.(*bytes.Buffer).String()`, "ab"},
+		{`r := io.Reader(strings.NewReader("xy")); r.(*strings.Reader).Len()`, 2},
+		{`error(nil) == nil`, true},
+		{`var v interface{} = strings.NewReader("x"); n := 0; switch v.(type) { case io.Writer: n = 1; case io.Reader: n = 2 }; n`, 2},
+	}
+	for _, c := range cases {
+		scope := assignScope()
+		scope.Set("fmt", func(v interface{}) string { return fmt.Sprint(v) })
+		out, err := scope.InterpretString(c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%s: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+}
+
+func TestInterfaceAssertAndConvertErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`var v interface{} = 1; v.(io.Reader)`, "type assertion: int does not implement io.Reader (missing method Read)"},
+		{`var v interface{} = strings.NewReader("x"); v.(io.ReadCloser)`, "type assertion: *strings.Reader does not implement io.ReadCloser (missing method Close)"},
+		{`var v interface{}; v.(io.Reader)`, "type assertion: interface is nil, not io.Reader"},
+		{`io.ReadCloser(1)`, "conversion: int does not implement io.ReadCloser (missing method Close, missing method Read)"},
+		{`b := bytes.NewBufferString("a"); io.Writer(*b)`, "conversion: bytes.Buffer does not implement io.Writer (method Write has pointer receiver)"},
+	}
+	for _, c := range cases {
+		_, err := assignScope().InterpretString(c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%s: expected error %q; got %v", c.src, c.want, err)
+		}
+	}
+}
+
 // Statements
 
 func TestFuncDeclAndCall(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 		a := func(){ return 5 }
@@ -832,7 +1838,7 @@ func TestFuncDeclAndCall(t *testing.T) {
 func TestChannel(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 		a := make(chan int, 10)
@@ -852,7 +1858,7 @@ func TestChannel(t *testing.T) {
 func TestChannelSendFail(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	_, out := scope.InterpretString(`
 		a := make(chan int)
@@ -867,7 +1873,7 @@ func TestChannelSendFail(t *testing.T) {
 func TestChannelRecvFail(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	_, out := scope.InterpretString(`
 		a := make(chan int)
@@ -885,7 +1891,7 @@ func TestChannelRecvFail(t *testing.T) {
 func TestFor(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 		a := 1
@@ -920,7 +1926,7 @@ func TestFor(t *testing.T) {
 func TestForBreak(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	_, err := scope.InterpretString(`for { break }`)
 	if err != nil {
@@ -931,7 +1937,7 @@ func TestForBreak(t *testing.T) {
 func TestForContinue(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 		a := 0
@@ -954,7 +1960,7 @@ func TestForContinue(t *testing.T) {
 func TestForRangeArray(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 		a := 1
@@ -975,7 +1981,7 @@ func TestForRangeArray(t *testing.T) {
 func TestForRangeMap(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 		a := 1
@@ -993,10 +1999,146 @@ func TestForRangeMap(t *testing.T) {
 	}
 }
 
+func TestForRangeInt(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{"r := 0; for i := range 5 { r += i }; r", 10},
+		{"r := 0; for range 3 { r++ }; r", 3},
+		{"r := 0; for i := range 10 { if i == 1 { continue }; if i == 4 { break }; r += i }; r", 5},
+		// The variable has the type of the number.
+		{"var r uint8; for i := range uint8(3) { r += i }; r", uint8(3)},
+		{"r := 0; for i := range -2 { r += i }; r", 0},
+	}
+	for _, c := range cases {
+		out, err := newTestScope(t).InterpretProgram(c.src)
+		if err != nil {
+			t.Errorf("%q: %+v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%q: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+}
+
+func TestForRangeFunc(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	var yields int
+	scope.Set("count", func(yield func(int) bool) {
+		for i := 0; i < 10; i++ {
+			yields++
+			if !yield(i) {
+				return
+			}
+		}
+	})
+	scope.Set("pairs", func(yield func(string, int) bool) {
+		_ = yield("a", 1) && yield("b", 2)
+	})
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{"r := 0; for v := range count { if v == 1 { continue }; if v == 4 { break }; r += v }; r", 5},
+		{"r := \"\"; for k, v := range pairs { r += k + string(rune('0'+v)) }; r", "a1b2"},
+		{"r := \"\"; for k := range pairs { r += k }; r", "ab"},
+		{`seq := func(yield func(int) bool) {
+			for i := 0; i < 10; i++ {
+				if !yield(i * i) {
+					return
+				}
+			}
+		}
+		r := []int{}
+		for v := range seq {
+			if v > 10 {
+				break
+			}
+			r = append(r, v)
+		}
+		r`, []int{0, 1, 4, 9}},
+		{"n := 0; for range func(yield func() bool) { yield(); yield() } { n++ }; n", 2},
+	}
+	for _, c := range cases {
+		out, err := scope.InterpretProgram(c.src)
+		if err != nil {
+			t.Errorf("%q: %+v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%q: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+	// The iterator stops once the body breaks.
+	yields = 0
+	if _, err := scope.InterpretProgram("for v := range count { if v == 2 { break } }"); err != nil || yields != 3 {
+		t.Errorf("Expected 3 yields got %d, %v.", yields, err)
+	}
+}
+
+func TestForRangeErrors(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("broken", func(yield func(int) bool) {
+		yield(1)
+		yield(2)
+	})
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{`for range "abc" {}`, `cannot range over "abc" (type string)`},
+		{"for range nil {}", "cannot range over nil (untyped nil)"},
+		{"for i, v := range 3 {}", "range over 3 permits only one iteration variable"},
+		{"f := func(yield func(int)) {}; for range f {}", "cannot range over f (type func(func(int))): yield func must be func(...) bool"},
+		{"f := func() {}; for range f {}", "cannot range over f (type func()): func must be func(yield func(...) bool)"},
+		{"for k, v := range func(yield func(int) bool) {} {}", "range over (func(yield func(int) bool) literal) permits only one iteration variable"},
+		{"for k := range func(yield func() bool) {} {}", "range over (func(yield func() bool) literal) permits no iteration variables"},
+		{"for range broken { break }", "range function continued iteration after loop body returned false"},
+		{"for range 2 { undefinedVar }", "undefined: undefinedVar"},
+	}
+	for _, c := range cases {
+		_, err := scope.InterpretProgram(c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%q: Expected %#v got %v.", c.src, c.want, err)
+		}
+	}
+}
+
+func TestReturnEndsFunc(t *testing.T) {
+	t.Parallel()
+
+	out, err := newTestScope(t).InterpretProgram(`
+	f := func(n int) int {
+		for i := 0; i < n; i++ {
+			if i == 2 {
+				return i * 10
+			}
+		}
+		return -1
+	}
+	[]int{f(5), f(1)}
+	`)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := []int{20, -1}
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %#v got %#v.", expected, out)
+	}
+}
+
 func TestSelectDefault(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 0
@@ -1021,7 +2163,7 @@ func TestSelectDefault(t *testing.T) {
 func TestSelect(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 0
@@ -1047,7 +2189,7 @@ func TestSelect(t *testing.T) {
 func TestSelectMultiCase(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	c := make(chan int, 10)
@@ -1074,7 +2216,7 @@ func TestSelectMultiCase(t *testing.T) {
 func TestSwitch(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 10
@@ -1099,7 +2241,7 @@ func TestSwitch(t *testing.T) {
 func TestSwitchDefault(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 0
@@ -1124,7 +2266,7 @@ func TestSwitchDefault(t *testing.T) {
 func TestSwitchBool(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	out := 0
@@ -1146,7 +2288,7 @@ func TestSwitchBool(t *testing.T) {
 func TestSwitchType(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	out := 0
@@ -1172,7 +2314,7 @@ func TestSwitchType(t *testing.T) {
 func TestSwitchTypeUse(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	out := 0
@@ -1198,7 +2340,7 @@ func TestSwitchTypeUse(t *testing.T) {
 func TestSwitchNone(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	out := 0
@@ -1220,7 +2362,7 @@ func TestSwitchNone(t *testing.T) {
 func TestIf(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 0
@@ -1243,7 +2385,7 @@ func TestIf(t *testing.T) {
 func TestIfElse(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 0
@@ -1266,7 +2408,7 @@ func TestIfElse(t *testing.T) {
 func TestIfIfElse(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 0
@@ -1286,10 +2428,73 @@ func TestIfIfElse(t *testing.T) {
 	}
 }
 
+func TestIfWithoutElse(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+
+	out, err := scope.InterpretString(`
+	a := 0
+	if false {
+		a = 1
+	}
+	a
+	`)
+	if err != nil {
+		t.Error(err)
+	}
+	expected := 0
+	if !reflect.DeepEqual(expected, out) {
+		t.Errorf("Expected %#v got %#v.", expected, out)
+	}
+	if _, err := scope.InterpretString("if 1 {}"); err == nil || err.Error() != "if condition: expected bool; got int" {
+		t.Errorf("Expected a non-boolean condition error got %v.", err)
+	}
+}
+
+func TestInitStatementScope(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+		// gone are the variables of the init statement, which must be
+		// undefined once the statement completes.
+		gone []string
+	}{
+		{`r := 0; if v, ok := m["a"]; ok { r = v }; r`, 1, []string{"v", "ok"}},
+		{`r := 0; if v, ok := m["b"]; ok { r = v } else { r = v - 1 }; r`, -1, []string{"v", "ok"}},
+		{`r := 0; if v, ok := m["b"]; ok { r = 1 } else if w := v + 2; w == 2 { r = w }; r`, 2, []string{"v", "ok", "w"}},
+		{"x := 1; if x := 2; x == 2 { x = 3 }; x", 1, nil},
+		{"r := 0; for i := 0; i < 3; i++ { r += i }; r", 3, []string{"i"}},
+		{"r := 0; for i, j := 0, 10; i < j; i, j = i+1, j-1 { r++ }; r", 5, []string{"i", "j"}},
+		{"r := 0; switch x := m[\"a\"] * 2; x { case 2: r = x * 3 }; r", 6, []string{"x"}},
+		{"r := 0; switch x := 2; { case x > 1: r = x }; r", 2, []string{"x"}},
+		{"r := 0; var i interface{} = 1; switch y := 3; v := i.(type) { case int: r = v + y }; r", 4, []string{"y", "v"}},
+	}
+	for _, c := range cases {
+		scope := newTestScope(t)
+		scope.Set("m", map[string]int{"a": 1})
+		out, err := scope.InterpretProgram(c.src)
+		if err != nil {
+			t.Errorf("%q: %+v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%q: Expected %#v got %#v.", c.src, c.want, out)
+		}
+		for _, name := range c.gone {
+			if v, ok := scope.Get(name); ok {
+				t.Errorf("%q: Expected %s to be undefined got %#v.", c.src, name, v)
+			}
+		}
+	}
+}
+
 func TestFunctionArgs(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	f := func(b, c int) int {
@@ -1309,7 +2514,7 @@ func TestFunctionArgs(t *testing.T) {
 func TestFunctionArgsBad(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	scope.Set("f", func(b, c int) int {
 		return b + c
@@ -1326,7 +2531,7 @@ func TestFunctionArgsBad(t *testing.T) {
 func TestDefer(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a :=  0
@@ -1354,7 +2559,7 @@ func TestDefer(t *testing.T) {
 func TestStringAppend(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := "foo"
@@ -1373,7 +2578,7 @@ func TestStringAppend(t *testing.T) {
 func TestIntMod(t *testing.T) {
 	t.Parallel()
 
-	scope := NewScope()
+	scope := newTestScope(t)
 
 	out, err := scope.InterpretString(`
 	a := 10
@@ -1395,3 +2600,312 @@ func TestIntMod(t *testing.T) {
 // TODO Packages
 
 // TODO References
+
+func TestAssignWritesThrough(t *testing.T) {
+	t.Parallel()
+
+	retries := 3
+	var err error = errors.New("failed")
+	var any interface{} = 1
+	item := "a"
+	scope := newTestScope(t)
+	scope.Vals["retries"] = &retries
+	scope.Vals["err"] = &err
+	scope.Vals["any"] = &any
+	scope.Vals["item"] = &item
+	scope.ReadOnly = map[string]bool{"item": true}
+
+	for _, input := range []string{
+		"retries = 5",
+		"err = nil",
+		`any = "s"`,
+		`item = "b"`,
+		"for _, retries := range []int{8} {}",
+		"f := func(retries int) {}",
+		"f(9)",
+	} {
+		if _, err := scope.InterpretString(input); err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+	}
+	if retries != 5 {
+		t.Errorf("Expected %#v got %#v.", 5, retries)
+	}
+	if err != nil {
+		t.Errorf("Expected %#v got %#v.", nil, err)
+	}
+	if any != "s" {
+		t.Errorf("Expected %#v got %#v.", "s", any)
+	}
+	if item != "a" {
+		t.Errorf("read-only variables shouldn't be written back; got %#v", item)
+	}
+	if out, _ := scope.Get("item"); out != "b" {
+		t.Errorf("Expected %#v got %#v.", "b", out)
+	}
+}
+
+func TestDefineShadowsParent(t *testing.T) {
+	t.Parallel()
+
+	x := 1
+	parent := newTestScope(t)
+	parent.Vals["x"] = &x
+	child := parent.NewChild()
+	if _, err := child.InterpretString("x := 2"); err != nil {
+		t.Fatal(err)
+	}
+	if x != 1 {
+		t.Errorf(":= in a child scope shouldn't change the parent; got %#v", x)
+	}
+	if out, _ := child.Get("x"); out != 2 {
+		t.Errorf("Expected %#v got %#v.", 2, out)
+	}
+	if _, err := parent.InterpretString("x := 3"); err != nil {
+		t.Fatal(err)
+	}
+	if x != 3 {
+		t.Errorf("Expected %#v got %#v.", 3, x)
+	}
+}
+
+func TestInterpretProgram(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want interface{}
+	}{
+		{"x := 1; y := x * 2; y", 2},
+		{"a := []int{1, 2}\n\n// Comments are ignored.\nfor _, v := range []int{3, 4} {\n\ta = append(a, v) /* here too */\n}\nlen(a)", 4},
+		{"s := \"a;b\"\ns // trailing comment", "a;b"},
+		{"v := 1\nv = 5\nv", 5},
+		{"", nil},
+		{"\n  // nothing\n", nil},
+	}
+	for _, c := range cases {
+		out, err := newTestScope(t).InterpretProgram(c.src)
+		if err != nil {
+			t.Errorf("%q: %+v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, c.want) {
+			t.Errorf("%q: Expected %#v got %#v.", c.src, c.want, out)
+		}
+	}
+}
+
+func TestInterpretProgramErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		src  string
+		want string
+	}{
+		{"x := 1\ny := )", "2:6: expected operand, found ')'"},
+		{"x := 1 }\nfunc f() {", "1:8: unexpected }"},
+	}
+	for _, c := range cases {
+		_, err := newTestScope(t).InterpretProgram(c.src)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%q: expected *ParseError; got %T %+v", c.src, err, err)
+			continue
+		}
+		if got := parseErr.Error(); got != c.want {
+			t.Errorf("%q: Expected %#v got %#v.", c.src, c.want, got)
+		}
+	}
+}
+
+func TestGroupedDeclarations(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("strings", Package{Name: "strings", Path: "strings", Functions: map[string]interface{}{
+		"ToUpper": strings.ToUpper,
+		"Repeat":  strings.Repeat,
+	}})
+	scope.Set("strconv", Package{Name: "strconv", Path: "strconv", Functions: map[string]interface{}{
+		"Itoa": strconv.Itoa,
+	}})
+	src := `import (
+	"strconv"
+	str "strings"
+	_ "strings"
+)
+
+// Levels of a logger.
+const (
+	debug = iota
+	info
+	warn
+	_
+	fatal
+)
+
+const (
+	kb = 1 << (10 * (iota + 1))
+	mb
+	name, prefix = "log", "["
+	other, suffix
+)
+
+var (
+	level     = warn
+	lines     []string
+	count, max = 0, 3
+)
+
+format := func(l int, msg string) string {
+	return prefix + str.ToUpper(name) + strconv.Itoa(l) + suffix + " " + msg
+}
+for i := 0; i < max; i++ {
+	lines = append(lines, format(level+i, str.Repeat("x", i)))
+	count++
+}
+[]interface{}{debug, info, fatal, kb, mb, other, count, lines}`
+	out, err := scope.InterpretProgram(src)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	want := []interface{}{0, 1, 4, 1024, 1 << 20, "log", 3, []string{"[LOG2[ ", "[LOG3[ x", "[LOG4[ xx"}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+	if _, ok := scope.Get("iota"); ok {
+		t.Errorf("Expected iota not to be defined.")
+	}
+
+	errCases := []struct {
+		src  string
+		want string
+	}{
+		{"import \"net/http\"\nhttp.Get", `package "net/http" isn't available in this session`},
+		{"import (\n\t\"strings\"", "2:11: expected ')', found 'EOF'"},
+		{"const (\n\ta\n)", "missing init expr for const declaration a"},
+	}
+	for _, c := range errCases {
+		_, err := scope.InterpretProgram(c.src)
+		if err == nil || err.Error() != c.want {
+			t.Errorf("%q: Expected %#v got %v.", c.src, c.want, err)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	t.Parallel()
+
+	scope := newTestScope(t)
+	scope.Set("noop", func() {})
+	scope.Set("fail", func() error { return nil })
+	scope.Set("atoi", strconv.Atoi)
+	// Variables of the program keep their static type.
+	var err error
+	scope.Vals["err"] = &err
+
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	cases := []struct {
+		src      string
+		value    interface{}
+		typ      reflect.Type
+		kind     ResultKind
+		declared []string
+	}{
+		{"1 + 2", 3, reflect.TypeOf(0), ResultExpression, nil},
+		{"a := 1", 1, reflect.TypeOf(0), ResultDeclaration, []string{"a"}},
+		{"var b, _ int", nil, nil, ResultDeclaration, []string{"b"}},
+		{"const C = 1; c, d := 1, 2", []interface{}{1, 2}, reflect.TypeOf([]interface{}{}), ResultDeclaration, []string{"C", "c", "d"}},
+		{"a = 5", 5, reflect.TypeOf(0), ResultStatement, nil},
+		{"a", 5, reflect.TypeOf(0), ResultExpression, nil},
+		{"noop()", nil, nil, ResultStatement, nil},
+		{"e := 1; noop()", nil, nil, ResultStatement, []string{"e"}},
+		{"fail()", nil, errorType, ResultExpression, nil},
+		{"err", nil, errorType, ResultExpression, nil},
+		{`atoi("7")`, 7, reflect.TypeOf(0), ResultExpression, nil},
+		{"if true {}", nil, nil, ResultStatement, nil},
+		{"", nil, nil, ResultStatement, nil},
+	}
+	for _, c := range cases {
+		res, err := Eval(context.Background(), scope, c.src)
+		if err != nil {
+			t.Errorf("%q: %v", c.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(res.Value, c.value) || res.Type != c.typ || res.Kind != c.kind || !reflect.DeepEqual(res.Declared, c.declared) {
+			t.Errorf("%q: Expected %#v %v %s %#v got %#v %v %s %#v.", c.src, c.value, c.typ, c.kind, c.declared, res.Value, res.Type, res.Kind, res.Declared)
+		}
+	}
+
+	// Errors returned by calls are kept apart from the other results.
+	res, err := Eval(context.Background(), scope, `atoi("z")`)
+	if err != nil || res.Value != 0 || res.ReturnedError == nil {
+		t.Errorf("Expected 0 and the error of atoi got %#v %v.", res, err)
+	}
+
+	res, err = Eval(context.Background(), scope, "undefined")
+	if err == nil || res == nil {
+		t.Errorf("Expected an error and a result got %#v %v.", res, err)
+	}
+}
+
+// callScope returns a scope for the call benchmarks, with strings.Contains
+// and a function without results.
+func callScope() *Scope {
+	scope := NewScope()
+	scope.Set("strings", Package{Name: "strings", Path: "strings", Functions: map[string]interface{}{
+		"Contains": strings.Contains,
+	}})
+	scope.Set("noop", func(string) {})
+	scope.Set("s", "needle in a haystack")
+	return scope
+}
+
+func BenchmarkCallNative(b *testing.B) {
+	for _, src := range []string{`strings.Contains(s, "hay")`, `noop(s)`} {
+		b.Run(src, func(b *testing.B) {
+			scope := callScope()
+			call, _, err := parseProgram(src)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := scope.Interpret(call); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCallNativeLoop(b *testing.B) {
+	scope := callScope()
+	prog, err := Compile(scope, `n := 0; for i := 0; i < 100; i++ { if strings.Contains(s, "hay") { n++ } else { n-- } }; n`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := prog.Run(nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIdentExpr(b *testing.B) {
+	scope := NewScope()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		scope.Set(name, 3)
+	}
+	expr, _, err := parseProgram("a + b*c - d/a + int(b)")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := scope.Interpret(expr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
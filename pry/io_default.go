@@ -3,10 +3,16 @@
 package pry
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/pkg/errors"
@@ -16,10 +22,16 @@ var readFile = ioutil.ReadFile
 
 var historyFile = ".go-pry_history"
 
+// rcFile is the name of the startup file in the home directory, and of the
+// one of the project in the working directory.
+var rcFile = ".gopryrc"
+
 type ioHistory struct {
 	FileName string
 	FilePath string
 	Records  []string
+	// rules decide which records are kept.
+	rules historyRules
 }
 
 // NewHistory constructs ioHistory instance
@@ -37,37 +49,221 @@ func NewHistory() (*ioHistory, error) {
 	return &h, nil
 }
 
+// openHistory constructs the history described by the config.
+func openHistory(c *Config) (*ioHistory, error) {
+	return &ioHistory{
+		FileName: filepath.Base(c.HistoryFile),
+		FilePath: c.HistoryFile,
+		rules:    historyRulesOf(c),
+	}, nil
+}
+
+func defaultHistoryFile() string {
+	dir, err := homedir.Dir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(dir, historyFile)
+}
+
+// defaultRCFile returns the path of the startup file: $GOPRY_RC, or rcFile
+// in the home directory.
+func defaultRCFile() string {
+	if rc := os.Getenv("GOPRY_RC"); len(rc) > 0 {
+		return rc
+	}
+	dir, err := homedir.Dir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(dir, rcFile)
+}
+
+// rcFiles returns the startup files run before the first prompt: the one of
+// c, then the one in the working directory unless it's the same file.
+func rcFiles(c *Config) []string {
+	var files []string
+	if len(c.RCFile) > 0 {
+		files = append(files, c.RCFile)
+	}
+	local, err := os.Stat(rcFile)
+	if err != nil {
+		return files
+	}
+	if global, err := os.Stat(c.RCFile); err == nil && os.SameFile(global, local) {
+		return files
+	}
+	return append(files, rcFile)
+}
+
+// readRC returns the lines of the startup file at path, or none if it
+// doesn't exist.
+func readRC(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading the rc file")
+	}
+	text := strings.TrimSuffix(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	if len(text) == 0 {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
 // Load unmarshal history file into history's records
 func (h *ioHistory) Load() error {
-	body, err := ioutil.ReadFile(h.FilePath)
-	if err != nil {
+	if h.FilePath == "" {
+		return nil
+	}
+	f, err := os.Open(h.FilePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
 		return errors.Wrapf(err, "History file not found")
 	}
-	var records []string
-	if err := json.Unmarshal(body, &records); err != nil {
-		return errors.Wrapf(err, "Error reading history file")
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return errors.Wrapf(err, "error locking history file")
 	}
+	defer unlockFile(f)
 
-	h.Records = records
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading history file")
+	}
+	records, err := decodeHistory(body)
+	if err != nil {
+		return errors.Wrapf(err, "Error reading history file")
+	}
+	h.Records = h.rules.clean(records)
 	return nil
 }
 
 // Save saves marshaled history's records into file
 func (h ioHistory) Save() error {
-	body, err := json.Marshal(h.Records)
+	if h.FilePath == "" {
+		return nil
+	}
+	f, err := os.OpenFile(h.FilePath, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "error writing history to the file")
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return errors.Wrapf(err, "error locking history file")
+	}
+	defer unlockFile(f)
+
+	return h.rewrite(f, h.rules.clean(h.Records))
+}
+
+// Append adds a record to the history and appends it to the history file,
+// unless the rules drop it. The file is rewritten when they drop other
+// records, such as the oldest ones once it grows past the size limit.
+func (h *ioHistory) Append(record string) error {
+	if !h.rules.keeps(h.Records, record) {
+		return nil
+	}
+	h.Records = h.rules.add(h.Records, record)
+	if h.FilePath == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.FilePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
 	if err != nil {
-		return errors.Wrapf(err, "error marshaling history")
+		return errors.Wrapf(err, "error writing history to the file")
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return errors.Wrapf(err, "error locking history file")
+	}
+	defer unlockFile(f)
+
+	// Other sessions may have written to the file since it was loaded so
+	// the file contents are authoritative.
+	body, err := ioutil.ReadAll(f)
+	if err != nil {
+		return errors.Wrapf(err, "error reading history file")
+	}
+	records, err := decodeHistory(body)
+	if err != nil {
+		return errors.Wrapf(err, "error reading history file")
+	}
+	isLegacy := bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+	if !isLegacy && !h.rules.keeps(records, record) {
+		return nil
+	}
+	next := h.rules.add(records, record)
+	if isLegacy || len(next) != len(records)+1 {
+		return h.rewrite(f, next)
 	}
-	if err := ioutil.WriteFile(h.FilePath, body, 0755); err != nil {
+	if _, err := f.WriteString(strconv.Quote(record) + "\n"); err != nil {
 		return errors.Wrapf(err, "error writing history to the file")
 	}
+	return nil
+}
 
+// setRules changes the rules deciding which records are kept, for the
+// records added from then on.
+func (h *ioHistory) setRules(rules historyRules) {
+	h.rules = rules
+}
+
+// rewrite replaces the contents of the locked file f with records.
+func (h ioHistory) rewrite(f *os.File, records []string) error {
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.WriteString(strconv.Quote(record))
+		buf.WriteByte('\n')
+	}
+	if err := f.Truncate(0); err != nil {
+		return errors.Wrapf(err, "error writing history to the file")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "error writing history to the file")
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return errors.Wrapf(err, "error writing history to the file")
+	}
 	return nil
 }
 
+// decodeHistory parses a history file. Each line holds one quoted record so
+// multi-line entries are restored as a single record. Files written by older
+// versions, which stored a JSON array, are also accepted.
+func decodeHistory(body []byte) ([]string, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+		var records []string
+		if err := json.Unmarshal(body, &records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	}
+
+	var records []string
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		record, err := strconv.Unquote(line)
+		if err != nil {
+			// Skip lines that were only partially written.
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
 // Len returns amount of records in history
 func (h ioHistory) Len() int { return len(h.Records) }
 
+// Record returns the record at index i.
+func (h ioHistory) Record(i int) string { return h.Records[i] }
+
 // Add appends record into history's records
 func (h *ioHistory) Add(record string) {
 	h.Records = append(h.Records, record)
@@ -3,13 +3,20 @@
 package pry
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
 )
 
 func TestHistory(t *testing.T) {
@@ -46,3 +53,274 @@ func TestHistory(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestHistoryAppend(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "go-pry-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newConfig(WithHistoryFile(filepath.Join(dir, "history")), WithHistorySize(3))
+	history, err := openHistory(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Load(); err != nil {
+		t.Fatalf("loading a missing history file should succeed: %+v", err)
+	}
+	for _, record := range []string{"a := 1", "func() {\n\ta++\n}()", "b", "c"} {
+		if err := history.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A second session should see the entries of the first.
+	other, err := openHistory(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Load(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"func() {\n\ta++\n}()", "b", "c"}
+	if !reflect.DeepEqual(expected, other.Records) {
+		t.Errorf("history.Load() = %+v; expected %+v", other.Records, expected)
+	}
+	if !reflect.DeepEqual(expected, history.Records) {
+		t.Errorf("history.Records = %+v; expected %+v", history.Records, expected)
+	}
+}
+
+func TestHistoryRules(t *testing.T) {
+	t.Parallel()
+
+	secret := regexp.MustCompile("(?i)password")
+	inputs := []string{"xs", "xs", "a := 1", "xs", " secret := 2", `login("Password1")`, "b", "xs", "xs"}
+	cases := []struct {
+		opts []Option
+		want []string
+	}{
+		{nil, inputs},
+		{[]Option{WithHistoryDedup(HistoryDedupConsecutive)}, []string{"xs", "a := 1", "xs", " secret := 2", `login("Password1")`, "b", "xs"}},
+		{[]Option{WithHistoryDedup(HistoryDedupAll)}, []string{"a := 1", " secret := 2", `login("Password1")`, "b", "xs"}},
+		{[]Option{WithHistoryIgnore(secret), WithHistoryIgnoreSpace()}, []string{"xs", "xs", "a := 1", "xs", "b", "xs", "xs"}},
+		{[]Option{WithHistoryDedup(HistoryDedupAll), WithHistoryIgnoreSpace(), WithHistorySize(2)}, []string{"b", "xs"}},
+	}
+	for i, c := range cases {
+		path := filepath.Join(t.TempDir(), "history")
+		config := newConfig(append([]Option{WithHistoryFile(path)}, c.opts...)...)
+		history, err := openHistory(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, input := range inputs {
+			if err := history.Append(input); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// The records in memory and in the file follow the rules.
+		if !reflect.DeepEqual(history.Records, c.want) {
+			t.Errorf("%d: expected the records %q got %q", i, c.want, history.Records)
+		}
+		loaded, err := openHistory(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := loaded.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(loaded.Records, c.want) {
+			t.Errorf("%d: expected the file to have %q got %q", i, c.want, loaded.Records)
+		}
+	}
+}
+
+func TestHistoryRulesSave(t *testing.T) {
+	t.Parallel()
+
+	// Files written under other rules are cleaned up when they're loaded
+	// and saved, and trimmed to the size oldest first.
+	path := filepath.Join(t.TempDir(), "history")
+	old := &ioHistory{FilePath: path, Records: []string{"a", "a", "b", "token=1", "a", "c", "c"}}
+	if err := old.Save(); err != nil {
+		t.Fatal(err)
+	}
+	config := newConfig(WithHistoryFile(path), WithHistoryDedup(HistoryDedupAll),
+		WithHistoryIgnore(regexp.MustCompile("token")), WithHistorySize(2))
+	history, err := openHistory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(history.Records, want) {
+		t.Errorf("Expected the records %q got %q.", want, history.Records)
+	}
+	history.Records = append(history.Records, "d", "d", "c")
+	if err := history.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\"d\"\n\"c\"\n"; string(data) != want {
+		t.Errorf("Expected the file %q got %q.", want, data)
+	}
+}
+
+func TestHistoryLegacyFormat(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "go-pry-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history")
+	if err := ioutil.WriteFile(path, []byte(`["a","b"]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	history, err := openHistory(newConfig(WithHistoryFile(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Append("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Load(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(expected, history.Records) {
+		t.Errorf("history.Load() = %+v; expected %+v", history.Records, expected)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	t.Parallel()
+
+	history, err := openHistory(newConfig(WithHistoryFile("")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Append("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if history.Len() != 1 {
+		t.Errorf("expected in-memory history to be kept; got %+v", history.Records)
+	}
+}
+
+// withHome runs the test in a new working directory with a new home
+// directory, which it returns.
+func withHome(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GOPRY_RC", "")
+	t.Setenv("GOPRY_NORC", "")
+	homedir.Reset()
+	t.Cleanup(homedir.Reset)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return home
+}
+
+func TestRCFiles(t *testing.T) {
+	home := withHome(t)
+	global := strings.Join([]string{
+		"x := 1",
+		"y := missing",
+		"f := func() int {",
+		"return x + 1",
+		"}",
+		":nosuchcommand",
+		"z := f()",
+	}, "\n") + "\n"
+	if err := ioutil.WriteFile(filepath.Join(home, ".gopryrc"), []byte(global), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The project's rc file runs after the global one.
+	local := "x++\n:set maxstring 3\ng := func() {\n"
+	if err := ioutil.WriteFile(".gopryrc", []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+	historyFile := filepath.Join(t.TempDir(), "history")
+
+	var out bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader("x\nz\n\"abcdef\"\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile(historyFile)},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput(t, out.String(),
+		"undefined: missing",
+		"  at "+filepath.Join(home, ".gopryrc")+":2\n",
+		"unknown command :nosuchcommand",
+		"  at "+filepath.Join(home, ".gopryrc")+":6\n",
+		"maxstring = 3\n",
+		".gopryrc:3: the input isn't finished",
+		"=> 2\n",
+		"=> 2\n",
+		`=> "abc"… (+3 bytes)`,
+	)
+	// The rc files aren't added to the history.
+	history, err := openHistory(newConfig(WithHistoryFile(historyFile)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"x", "z", `"abcdef"`}; !reflect.DeepEqual(history.Records, want) {
+		t.Errorf("Expected the history %q got %q.", want, history.Records)
+	}
+
+	out.Reset()
+	repl = &REPL{
+		In:      strings.NewReader("x\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile(""), WithNoRC()},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "undefined: x") || strings.Contains(out.String(), "missing") {
+		t.Errorf("Expected the rc files to be skipped got %q.", out.String())
+	}
+}
+
+func TestRCFilesSame(t *testing.T) {
+	home := withHome(t)
+	if err := os.Chdir(home); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(".gopryrc", []byte("n := 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The rc file of the home directory runs once from there.
+	if files := rcFiles(newConfig()); len(files) != 1 {
+		t.Errorf("Expected one rc file got %q.", files)
+	}
+	if files := rcFiles(newConfig(WithRCFile(""))); !reflect.DeepEqual(files, []string{".gopryrc"}) {
+		t.Errorf("Expected the local rc file got %q.", files)
+	}
+}
@@ -37,6 +37,11 @@ func readFile(path string) ([]byte, error) {
 
 type browserHistory struct {
 	Records []string
+	// Key is the localStorage key the history is stored under. An empty key
+	// disables persistence.
+	Key string
+	// rules decide which records are kept.
+	rules historyRules
 }
 
 // NewHistory constructs browserHistory instance
@@ -45,12 +50,41 @@ func NewHistory() (*browserHistory, error) {
 	// FIXME:
 	// when localStorage is full, can be return an error
 
-	return &browserHistory{}, nil
+	return &browserHistory{Key: defaultHistoryFile()}, nil
+}
+
+// openHistory constructs the history described by the config.
+func openHistory(c *Config) (*browserHistory, error) {
+	return &browserHistory{Key: c.HistoryFile, rules: historyRulesOf(c)}, nil
+}
+
+func defaultHistoryFile() string {
+	return "history"
+}
+
+// defaultRCFile returns the path of the startup file, which the browser
+// doesn't have.
+func defaultRCFile() string {
+	return ""
+}
+
+// rcFiles returns the startup files run before the first prompt, none in
+// the browser.
+func rcFiles(c *Config) []string {
+	return nil
+}
+
+// readRC returns the lines of the startup file at path.
+func readRC(path string) ([]string, error) {
+	return nil, nil
 }
 
 // Load unmarshal localStorage data into history's records
 func (bh *browserHistory) Load() error {
-	hist := js.Global().Get("localStorage").Get("history")
+	if bh.Key == "" {
+		return nil
+	}
+	hist := js.Global().Get("localStorage").Get(bh.Key)
 	if hist.Type() == js.TypeUndefined {
 		return nil // nothing to unmarashal
 	}
@@ -58,25 +92,47 @@ func (bh *browserHistory) Load() error {
 	if err := json.Unmarshal([]byte(hist.String()), &records); err != nil {
 		return err
 	}
-	bh.Records = records
+	bh.Records = bh.rules.clean(records)
 
 	return nil
 }
 
 // Save saves marshaled history's records into localStorage
 func (bh browserHistory) Save() error {
-	bytes, err := json.Marshal(bh.Records)
+	if bh.Key == "" {
+		return nil
+	}
+	bytes, err := json.Marshal(bh.rules.clean(bh.Records))
 	if err != nil {
 		return err
 	}
-	js.Global().Get("localStorage").Set("history", string(bytes))
+	js.Global().Get("localStorage").Set(bh.Key, string(bytes))
 
 	return nil
 }
 
+// Append adds a record to the history and saves it, unless the rules drop
+// it.
+func (bh *browserHistory) Append(record string) error {
+	if !bh.rules.keeps(bh.Records, record) {
+		return nil
+	}
+	bh.Records = bh.rules.add(bh.Records, record)
+	return bh.Save()
+}
+
+// setRules changes the rules deciding which records are kept, for the
+// records added from then on.
+func (bh *browserHistory) setRules(rules historyRules) {
+	bh.rules = rules
+}
+
 // Len returns amount of records in history
 func (bh browserHistory) Len() int { return len(bh.Records) }
 
+// Record returns the record at index i.
+func (bh browserHistory) Record(i int) string { return bh.Records[i] }
+
 // Add appends record into history's records
 func (bh *browserHistory) Add(record string) {
 	bh.Records = append(bh.Records, record)
@@ -0,0 +1,589 @@
+package pry
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// EditMode is the set of key bindings the terminal editor uses.
+type EditMode int
+
+const (
+	// EditEmacs is the default bindings, those of emacs and most shells,
+	// such as Ctrl-A, Alt-F and Ctrl-K.
+	EditEmacs EditMode = iota
+	// EditVi starts lines in insert mode, and ESC switches to normal mode
+	// with vi's motions and operators.
+	EditVi
+)
+
+func (m EditMode) String() string {
+	switch m {
+	case EditEmacs:
+		return "emacs"
+	case EditVi:
+		return "vi"
+	}
+	return "unknown"
+}
+
+// lineState is the state of the line being edited.
+type lineState struct {
+	line string
+	// index is the cursor, as an offset in bytes into line.
+	index      int
+	historyPos int
+	search     reverseSearch
+	// r is the key being handled and afterCR is set if the key before it
+	// was a carriage return.
+	r       rune
+	afterCR bool
+	// normal is set in vi normal mode, and operator is the vi operator
+	// waiting for its motion, 'd' or 'c', if any.
+	normal   bool
+	operator rune
+}
+
+// keyAction edits the line in response to a key. It returns errLineDone
+// once the line is done, or the error ReadLine returns.
+type keyAction func(e *terminalEditor, s *lineState) error
+
+// errLineDone is returned by the key action ending the line.
+var errLineDone = errors.New("line done")
+
+// keyName returns the name of the key r is read for in keymaps: the rune
+// itself for printable keys, "ctrl-a" for control keys and "enter",
+// "tab", "esc" and "backspace".
+func keyName(r rune) string {
+	switch r {
+	case 9:
+		return "tab"
+	case 10, 13:
+		return "enter"
+	case 27:
+		return "esc"
+	case 127, '\b':
+		return "backspace"
+	}
+	if r > 0 && r < 27 {
+		return "ctrl-" + string('a'+r-1)
+	}
+	return string(r)
+}
+
+// escapeKeys names the special keys by their escape sequences.
+var escapeKeys = map[string]string{
+	"\033[A":  "up",
+	"\033[B":  "down",
+	"\033[C":  "right",
+	"\033[D":  "left",
+	"\033[H":  "home",
+	"\033[F":  "end",
+	"\033[1~": "home",
+	"\033[4~": "end",
+	"\033[3~": "delete",
+}
+
+// commonKeys are bound in every mode, unless a mode binds them otherwise.
+var commonKeys = map[string]keyAction{
+	"enter":     acceptLine,
+	"tab":       completeWord,
+	"ctrl-c":    abortLine,
+	"ctrl-d":    deleteOrExit,
+	"ctrl-r":    searchHistory,
+	"ctrl-l":    clearScreen,
+	"backspace": deleteBack,
+	"delete":    deleteForward,
+	"up":        historyPrev,
+	"down":      historyNext,
+	"left":      moveBy(backwardChar),
+	"right":     moveBy(forwardChar),
+	"home":      moveBy(lineStart),
+	"end":       moveBy(lineEnd),
+}
+
+// emacsKeys are the bindings of EditEmacs.
+var emacsKeys = withKeys(commonKeys, map[string]keyAction{
+	"ctrl-a": moveBy(lineStart),
+	"ctrl-e": moveBy(lineEnd),
+	"ctrl-b": moveBy(backwardChar),
+	"ctrl-f": moveBy(forwardChar),
+	"alt-b":  moveBy(backwardWord),
+	"alt-f":  moveBy(forwardWord),
+	"ctrl-p": historyPrev,
+	"ctrl-n": historyNext,
+	"ctrl-w": killBy(backwardBigWord),
+	"alt-d":  killBy(forwardWord),
+	"ctrl-k": killBy(lineEnd),
+	"ctrl-u": killBy(lineStart),
+	"ctrl-y": yank,
+})
+
+// viInsertKeys are the bindings of vi insert mode.
+var viInsertKeys = withKeys(commonKeys, map[string]keyAction{
+	"esc":    normalMode,
+	"ctrl-w": killBy(backwardBigWord),
+	"ctrl-u": killBy(lineStart),
+})
+
+// viMotions move the cursor in vi normal mode and tell the operators what
+// they apply to.
+var viMotions = map[string]func(line string, index int) int{
+	"h":     backwardChar,
+	"left":  backwardChar,
+	"l":     forwardChar,
+	"right": forwardChar,
+	" ":     forwardChar,
+	"0":     lineStart,
+	"home":  lineStart,
+	"^":     firstNonBlank,
+	"$":     lineEnd,
+	"end":   lineEnd,
+	"w":     viNextWord,
+	"b":     viPrevWord,
+	"e":     viWordEnd,
+}
+
+// viInclusive are the motions whose operators take the character they end
+// on too.
+var viInclusive = map[string]bool{"e": true}
+
+// viNormalKeys are the bindings of vi normal mode, besides viMotions.
+var viNormalKeys = withKeys(commonKeys, map[string]keyAction{
+	"esc": func(*terminalEditor, *lineState) error { return nil },
+	"i":   insertMode(nil),
+	"a":   insertMode(forwardChar),
+	"A":   insertMode(lineEnd),
+	"I":   insertMode(firstNonBlank),
+	"x":   killBy(forwardChar),
+	"X":   killBy(backwardChar),
+	"d":   viOperator('d'),
+	"c":   viOperator('c'),
+	"D":   viOperatorTo('d', "$"),
+	"C":   viOperatorTo('c', "$"),
+	"p":   viPut(true),
+	"P":   viPut(false),
+	"k":   historyPrev,
+	"j":   historyNext,
+	"/":   searchHistory,
+})
+
+// withKeys returns the bindings of base with those of keys added.
+func withKeys(base, keys map[string]keyAction) map[string]keyAction {
+	all := map[string]keyAction{}
+	for key, action := range base {
+		all[key] = action
+	}
+	for key, action := range keys {
+		all[key] = action
+	}
+	return all
+}
+
+// keymap returns the bindings the line is edited with.
+func (e *terminalEditor) keymap(s *lineState) map[string]keyAction {
+	mode := EditEmacs
+	if e.mode != nil {
+		mode = e.mode()
+	}
+	switch {
+	case mode != EditVi:
+		return emacsKeys
+	case s.normal:
+		return viNormalKeys
+	}
+	return viInsertKeys
+}
+
+// handleKey handles the key named key with the bindings of the mode. Unbound
+// printable keys are typed, and so are those pressed with Alt.
+func (e *terminalEditor) handleKey(s *lineState, key string) error {
+	if s.normal && s.operator != 0 {
+		return e.applyOperator(s, key)
+	}
+	keys := e.keymap(s)
+	if action, ok := keys[key]; ok {
+		err := action(e, s)
+		if s.normal {
+			s.clampNormal()
+		}
+		return err
+	}
+	if s.normal {
+		if motion, ok := viMotions[key]; ok {
+			s.index = motion(s.line, s.index)
+			s.clampNormal()
+		}
+		return nil
+	}
+	r, size := utf8.DecodeRuneInString(key)
+	if strings.HasPrefix(key, "alt-") {
+		// Alt with a key that isn't bound is the key.
+		r, size = utf8.DecodeRuneInString(key[len("alt-"):])
+		key = key[len("alt-"):]
+	}
+	if size == len(key) && r >= 32 {
+		s.insert(r, e.indent)
+	}
+	return nil
+}
+
+// insert types r at the cursor. A closing bracket typed at the start of a
+// line takes a level of indentation off.
+func (s *lineState) insert(r rune, indent string) {
+	if strings.ContainsRune(")]}", r) && len(indent) > 0 &&
+		len(strings.TrimSpace(s.line[:s.index])) == 0 && strings.HasSuffix(s.line[:s.index], indent) {
+		s.line = s.line[:s.index-len(indent)] + s.line[s.index:]
+		s.index -= len(indent)
+	}
+	s.line = s.line[:s.index] + string(r) + s.line[s.index:]
+	s.index += utf8.RuneLen(r)
+}
+
+// clampNormal keeps the cursor on a character in vi normal mode, which
+// can't be after the last one.
+func (s *lineState) clampNormal() {
+	if s.index >= len(s.line) && len(s.line) > 0 {
+		s.index = len(s.line) - prevGrapheme(s.line)
+	}
+}
+
+func acceptLine(e *terminalEditor, s *lineState) error {
+	if s.r == '\n' && s.afterCR {
+		// The carriage return before it was a pasted line ending, or it
+		// would have ended the line.
+		return nil
+	}
+	if p, ok := e.tty.(*pasteTTY); ok && p.follows(pasteGap) {
+		// Keys following at once mean the line ending was pasted.
+		s.line, s.index = insertPasted(s.line, s.index, s.r, s.afterCR)
+		return nil
+	}
+	return errLineDone
+}
+
+func completeWord(e *terminalEditor, s *lineState) error {
+	s.line, s.index = e.complete(s.line, s.index)
+	return nil
+}
+
+func abortLine(e *terminalEditor, s *lineState) error {
+	fmt.Fprintf(e.out, "\033[%dC^C\n", lineWidth(s.line[s.index:])+1)
+	return ErrLineAborted
+}
+
+// deleteOrExit deletes the character under the cursor, or ends the session
+// if the line is empty.
+func deleteOrExit(e *terminalEditor, s *lineState) error {
+	if len(s.line) == 0 {
+		fmt.Fprintln(e.out)
+		return ErrContinue
+	}
+	return deleteForward(e, s)
+}
+
+func searchHistory(e *terminalEditor, s *lineState) error {
+	s.search.start(s.line, s.index, e.history)
+	return nil
+}
+
+func clearScreen(e *terminalEditor, s *lineState) error {
+	fmt.Fprint(e.out, "\033[H\033[2J")
+	return nil
+}
+
+func deleteBack(e *terminalEditor, s *lineState) error {
+	n := prevGrapheme(s.line[:s.index])
+	s.line = s.line[:s.index-n] + s.line[s.index:]
+	s.index -= n
+	return nil
+}
+
+func deleteForward(e *terminalEditor, s *lineState) error {
+	s.line = s.line[:s.index] + s.line[s.index+nextGrapheme(s.line[s.index:]):]
+	return nil
+}
+
+func historyPrev(e *terminalEditor, s *lineState) error {
+	if s.historyPos > 0 {
+		s.historyPos--
+	}
+	if len(e.history) > 0 {
+		s.line = e.history[s.historyPos]
+	}
+	s.index = len(s.line)
+	return nil
+}
+
+func historyNext(e *terminalEditor, s *lineState) error {
+	if s.historyPos < len(e.history) {
+		s.historyPos++
+	}
+	if s.historyPos == len(e.history) {
+		s.line = ""
+	} else {
+		s.line = e.history[s.historyPos]
+	}
+	s.index = len(s.line)
+	return nil
+}
+
+func yank(e *terminalEditor, s *lineState) error {
+	s.line = s.line[:s.index] + e.killed + s.line[s.index:]
+	s.index += len(e.killed)
+	return nil
+}
+
+// moveBy returns the action moving the cursor where motion says.
+func moveBy(motion func(line string, index int) int) keyAction {
+	return func(e *terminalEditor, s *lineState) error {
+		s.index = motion(s.line, s.index)
+		return nil
+	}
+}
+
+// killBy returns the action cutting the text between the cursor and where
+// motion says, which Ctrl-Y pastes.
+func killBy(motion func(line string, index int) int) keyAction {
+	return func(e *terminalEditor, s *lineState) error {
+		s.kill(e, s.index, motion(s.line, s.index))
+		return nil
+	}
+}
+
+// kill cuts the text between the offsets from and to, in either order.
+func (s *lineState) kill(e *terminalEditor, from, to int) {
+	if from > to {
+		from, to = to, from
+	}
+	if from == to {
+		return
+	}
+	e.killed = s.line[from:to]
+	s.line = s.line[:from] + s.line[to:]
+	s.index = from
+}
+
+// normalMode switches from vi insert mode to normal mode, moving the cursor
+// onto the character before it as vi does.
+func normalMode(e *terminalEditor, s *lineState) error {
+	s.normal = true
+	s.index = backwardChar(s.line, s.index)
+	return nil
+}
+
+// insertMode returns the action switching to vi insert mode after moving
+// the cursor where motion says, if it isn't nil.
+func insertMode(motion func(line string, index int) int) keyAction {
+	return func(e *terminalEditor, s *lineState) error {
+		if motion != nil {
+			s.index = motion(s.line, s.index)
+		}
+		s.normal = false
+		return nil
+	}
+}
+
+// viOperator returns the action of the vi operator op, which applies to the
+// text the next motion moves over.
+func viOperator(op rune) keyAction {
+	return func(e *terminalEditor, s *lineState) error {
+		s.operator = op
+		return nil
+	}
+}
+
+// viOperatorTo returns the action applying the vi operator op with the
+// motion named motion, as D is d$.
+func viOperatorTo(op rune, motion string) keyAction {
+	return func(e *terminalEditor, s *lineState) error {
+		s.operator = op
+		return e.applyOperator(s, motion)
+	}
+}
+
+// applyOperator applies the pending vi operator to the text moved over by
+// the motion named key. The operator's own key, as in dd, applies it to the
+// whole line, and other keys cancel it.
+func (e *terminalEditor) applyOperator(s *lineState, key string) error {
+	op := s.operator
+	s.operator = 0
+	if key == string(op) {
+		s.kill(e, 0, len(s.line))
+	} else {
+		if op == 'c' && key == "w" && s.index < len(s.line) && classAt(s.line, s.index) != spaceClass {
+			// cw changes to the end of the word, as in vi.
+			key = "e"
+		}
+		motion, ok := viMotions[key]
+		if !ok {
+			return nil
+		}
+		to := motion(s.line, s.index)
+		if viInclusive[key] && to < len(s.line) {
+			to += nextGrapheme(s.line[to:])
+		}
+		s.kill(e, s.index, to)
+	}
+	if op == 'c' {
+		s.normal = false
+	} else {
+		s.clampNormal()
+	}
+	return nil
+}
+
+// viPut returns the action pasting the text last cut after the cursor, or
+// before it if after isn't set.
+func viPut(after bool) keyAction {
+	return func(e *terminalEditor, s *lineState) error {
+		if len(e.killed) == 0 {
+			return nil
+		}
+		if after && s.index < len(s.line) {
+			s.index += nextGrapheme(s.line[s.index:])
+		}
+		s.line = s.line[:s.index] + e.killed + s.line[s.index:]
+		s.index += len(e.killed) - prevGrapheme(e.killed)
+		return nil
+	}
+}
+
+// The classes of characters words are made of. Vi words are runs of
+// characters of the same class other than spaces, and emacs words runs of
+// word characters.
+const (
+	spaceClass = iota
+	wordClass
+	punctClass
+)
+
+// charClass returns the class of r.
+func charClass(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return spaceClass
+	case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return wordClass
+	}
+	return punctClass
+}
+
+// classAt returns the class of the character at offset i of line.
+func classAt(line string, i int) int {
+	r, _ := utf8.DecodeRuneInString(line[i:])
+	return charClass(r)
+}
+
+// classBefore returns the class of the character before offset i of line.
+func classBefore(line string, i int) int {
+	return classAt(line, i-prevGrapheme(line[:i]))
+}
+
+func backwardChar(line string, index int) int {
+	return index - prevGrapheme(line[:index])
+}
+
+func forwardChar(line string, index int) int {
+	return index + nextGrapheme(line[index:])
+}
+
+func lineStart(line string, index int) int {
+	return 0
+}
+
+func lineEnd(line string, index int) int {
+	return len(line)
+}
+
+func firstNonBlank(line string, index int) int {
+	return len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace))
+}
+
+// forwardWord moves to the end of the word at or after the cursor.
+func forwardWord(line string, index int) int {
+	for index < len(line) && classAt(line, index) != wordClass {
+		index = forwardChar(line, index)
+	}
+	for index < len(line) && classAt(line, index) == wordClass {
+		index = forwardChar(line, index)
+	}
+	return index
+}
+
+// backwardWord moves to the start of the word before the cursor.
+func backwardWord(line string, index int) int {
+	for index > 0 && classBefore(line, index) != wordClass {
+		index = backwardChar(line, index)
+	}
+	for index > 0 && classBefore(line, index) == wordClass {
+		index = backwardChar(line, index)
+	}
+	return index
+}
+
+// backwardBigWord moves to the start of the text between spaces before the
+// cursor, what Ctrl-W cuts.
+func backwardBigWord(line string, index int) int {
+	for index > 0 && classBefore(line, index) == spaceClass {
+		index = backwardChar(line, index)
+	}
+	for index > 0 && classBefore(line, index) != spaceClass {
+		index = backwardChar(line, index)
+	}
+	return index
+}
+
+// viNextWord moves to the start of the next vi word.
+func viNextWord(line string, index int) int {
+	if index < len(line) {
+		if class := classAt(line, index); class != spaceClass {
+			for index < len(line) && classAt(line, index) == class {
+				index = forwardChar(line, index)
+			}
+		}
+	}
+	for index < len(line) && classAt(line, index) == spaceClass {
+		index = forwardChar(line, index)
+	}
+	return index
+}
+
+// viPrevWord moves to the start of the vi word before the cursor.
+func viPrevWord(line string, index int) int {
+	for index > 0 && classBefore(line, index) == spaceClass {
+		index = backwardChar(line, index)
+	}
+	if index > 0 {
+		class := classBefore(line, index)
+		for index > 0 && classBefore(line, index) == class {
+			index = backwardChar(line, index)
+		}
+	}
+	return index
+}
+
+// viWordEnd moves to the last character of the vi word after the cursor.
+func viWordEnd(line string, index int) int {
+	if index < len(line) {
+		index = forwardChar(line, index)
+	}
+	for index < len(line) && classAt(line, index) == spaceClass {
+		index = forwardChar(line, index)
+	}
+	if index >= len(line) {
+		return index
+	}
+	class := classAt(line, index)
+	for {
+		next := forwardChar(line, index)
+		if next >= len(line) || classAt(line, next) != class {
+			return index
+		}
+		index = next
+	}
+}
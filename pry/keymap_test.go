@@ -0,0 +1,79 @@
+package pry
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTerminalEditorKeymaps(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		mode EditMode
+		keys string
+		want string
+	}{
+		// Emacs moves by lines and words and cuts text Ctrl-Y pastes.
+		{EditEmacs, "bc\x01a\x05d\r", "abcd"},
+		{EditEmacs, "foo bar\033bx\033f!\r", "foo xbar!"},
+		{EditEmacs, "foo.bar baz\x17\x01\x19 \r", "baz foo.bar "},
+		{EditEmacs, "abc def\x02\x02\x02\x0b\x01\x19\r", "defabc "},
+		{EditEmacs, "abc def\033b\x15x\r", "xdef"},
+		{EditEmacs, "one two\x01\033d\r", " two"},
+		// Alt with a key that isn't bound types the key.
+		{EditEmacs, "a\033x\r", "ax"},
+		// Vi starts in insert mode, and ESC switches to normal mode.
+		{EditVi, "abc\033hix\r", "axbc"},
+		{EditVi, "abc\0330ax\r", "axbc"},
+		{EditVi, "abc\0330Ax\r", "abcx"},
+		{EditVi, "abc\033\033hhay\r", "aybc"},
+		{EditVi, "foo bar baz\0330wdw\r", "foo baz"},
+		{EditVi, "foo bar baz\033bcwqux\r", "foo bar qux"},
+		{EditVi, "foo.bar\0330wwix\r", "foo.xbar"},
+		{EditVi, "foo bar\033bD\r", "foo "},
+		{EditVi, "foo bar\033ddinew\r", "new"},
+		{EditVi, "abc\0330xp\r", "bac"},
+		{EditVi, "abc\0330lC!\r", "a!"},
+		// Arrow keys still work in insert mode.
+		{EditVi, "ac\033[Db\r", "abc"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		tty := newScriptedTTY(c.keys, 80, 24)
+		defer tty.Close()
+		editor := newTerminalEditor(&out, tty)
+		mode := c.mode
+		editor.mode = func() EditMode { return mode }
+		line, err := editor.ReadLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != c.want {
+			t.Errorf("%s %q: Expected %#v got %#v.", c.mode, c.keys, c.want, line)
+		}
+	}
+}
+
+func TestTerminalEditorViPrompt(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	tty := newScriptedTTY("ab\033i\r", 80, 24)
+	defer tty.Close()
+	editor := newTerminalEditor(&out, tty)
+	editor.mode = func() EditMode { return EditVi }
+	editor.normalMark = "[N]"
+	if _, err := editor.ReadLine("> "); err != nil {
+		t.Fatal(err)
+	}
+	// Normal mode is marked before the prompt until i switches back.
+	redraws := strings.Split(out.String(), "\r\033[K")
+	last := redraws[len(redraws)-1]
+	if normal := redraws[len(redraws)-2]; !strings.HasPrefix(normal, "[N]> ab") {
+		t.Errorf("Expected the normal mode prompt got %q.", normal)
+	}
+	if !strings.HasPrefix(last, "> ab") {
+		t.Errorf("Expected the insert mode prompt got %q.", last)
+	}
+}
@@ -0,0 +1,206 @@
+package pry
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Limits are guardrails for evaluations, such as for remote or shared
+// sessions. Zero values are unlimited, which is the default.
+type Limits struct {
+	// MaxSteps is the number of steps an evaluation can take. Every
+	// statement, loop iteration and native call is a step.
+	MaxSteps int64
+	// MaxMakeBytes is the largest size make can allocate, in bytes. Native
+	// functions allocating on their own aren't limited.
+	MaxMakeBytes int64
+	// MaxOutputBytes is the longest result the REPL prints, in bytes. Longer
+	// results are cut short.
+	MaxOutputBytes int
+	// MaxDuration is how long an evaluation can run. It's checked at the
+	// same points as cancellation, so a native call that's already running
+	// isn't stopped.
+	MaxDuration time.Duration
+}
+
+// SetLimits sets the limits of the evaluations in scope and its children.
+func (scope *Scope) SetLimits(l Limits) {
+	scope.Lock()
+	scope.limits = &l
+	scope.Unlock()
+}
+
+// pushLimits sets the limits of scope until restore is called.
+func (scope *Scope) pushLimits(l Limits) (restore func()) {
+	scope.Lock()
+	prev := scope.limits
+	scope.limits = &l
+	scope.Unlock()
+	return func() {
+		scope.Lock()
+		scope.limits = prev
+		scope.Unlock()
+	}
+}
+
+// currentLimits returns the limits set on scope or its closest parent.
+func (scope *Scope) currentLimits() (Limits, bool) {
+	for s := scope; s != nil; s = s.Parent {
+		s.Lock()
+		l := s.limits
+		s.Unlock()
+		if l != nil {
+			return *l, true
+		}
+	}
+	return Limits{}, false
+}
+
+// budget tracks what an evaluation used of its limits. Goroutines started
+// by the evaluation share it.
+type budget struct {
+	limits   Limits
+	steps    int64
+	deadline time.Time
+}
+
+// newBudget starts the budget of an evaluation limited by l.
+func newBudget(l Limits) *budget {
+	b := &budget{limits: l}
+	if l.MaxDuration > 0 {
+		b.deadline = time.Now().Add(l.MaxDuration)
+	}
+	return b
+}
+
+// step takes a step, returning an error if it exceeds a limit.
+func (b *budget) step() error {
+	if b.limits.MaxSteps > 0 && atomic.AddInt64(&b.steps, 1) > b.limits.MaxSteps {
+		return &StepLimitError{Max: b.limits.MaxSteps}
+	}
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return &DurationLimitError{Max: b.limits.MaxDuration}
+	}
+	return nil
+}
+
+// currentBudget returns the budget of the evaluation running in scope, or
+// nil if it's unlimited.
+func (scope *Scope) currentBudget() *budget {
+	for s := scope; s != nil; s = s.Parent {
+		if s.budget != nil {
+			return s.budget
+		}
+	}
+	return nil
+}
+
+// checkMake returns a *MakeLimitError if make(args...) would allocate more
+// than the budget allows.
+func (b *budget) checkMake(args []interface{}) error {
+	if b == nil || b.limits.MaxMakeBytes <= 0 || len(args) == 0 {
+		return nil
+	}
+	typ, ok := args[0].(reflect.Type)
+	if !ok {
+		return nil
+	}
+	// The capacity, when given, is what's allocated.
+	n := int64(0)
+	if len(args) > 1 {
+		size, _ := args[len(args)-1].(int)
+		n = int64(size)
+	}
+	var elem int64
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Chan:
+		elem = int64(typ.Elem().Size())
+	case reflect.Map:
+		elem = int64(typ.Key().Size() + typ.Elem().Size())
+	default:
+		return nil
+	}
+	if elem == 0 {
+		elem = 1
+	}
+	if n > b.limits.MaxMakeBytes/elem {
+		return &MakeLimitError{Type: typ, Size: n, Max: b.limits.MaxMakeBytes}
+	}
+	return nil
+}
+
+// formatResult renders v the way the REPL prints it, with the Inspect
+// settings of c, cut to c.Limits.MaxOutputBytes if it's positive.
+func formatResult(v interface{}, c *Config) (string, error) {
+	var b strings.Builder
+	err := writeResult(&b, v, c, false, nil)
+	return b.String(), err
+}
+
+// resultFlushSize is how much of a result is rendered before it's written,
+// about a screenful.
+const resultFlushSize = 4096
+
+// writeResult writes v to w like formatResult, while it's rendered, so the
+// start of huge values shows up at once and they're never held in memory
+// whole. bare leaves out the type of v, as writeInspect does. interrupted, if
+// it isn't nil, is checked every time part of the result is written, and
+// stops the rendering with ErrInterrupted once it returns true.
+func writeResult(w io.Writer, v interface{}, c *Config, bare bool, interrupted func() bool) error {
+	s := &streamSink{w: w, max: c.Limits.MaxOutputBytes, interrupted: interrupted}
+	c.writeInspect(s, v, bare)
+	if s.cut {
+		s.buf = append(s.buf, "..."...)
+	}
+	s.flush()
+	if s.err != nil {
+		return s.err
+	}
+	if s.cut {
+		return &OutputLimitError{Max: c.Limits.MaxOutputBytes}
+	}
+	return nil
+}
+
+// streamSink writes what's rendered to w in parts, cutting it after max
+// bytes if max is positive.
+type streamSink struct {
+	w           io.Writer
+	buf         []byte
+	written     int
+	max         int
+	cut         bool
+	interrupted func() bool
+	err         error
+}
+
+func (s *streamSink) write(str string) {
+	if s.full() {
+		return
+	}
+	if s.max > 0 && s.written+len(str) > s.max {
+		str = str[:graphemeStart(str, s.max-s.written)]
+		s.cut = true
+	}
+	s.buf = append(s.buf, str...)
+	s.written += len(str)
+	if len(s.buf) >= resultFlushSize {
+		s.flush()
+	}
+}
+
+func (s *streamSink) full() bool { return s.cut || s.err != nil }
+
+// flush writes what's buffered, then checks for an interruption.
+func (s *streamSink) flush() {
+	if s.err == nil && len(s.buf) > 0 {
+		_, s.err = s.w.Write(s.buf)
+	}
+	s.buf = s.buf[:0]
+	if s.err == nil && s.interrupted != nil && s.interrupted() {
+		s.err = ErrInterrupted
+	}
+}
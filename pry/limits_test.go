@@ -0,0 +1,195 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runLimited runs a REPL session in scope over input with limits and
+// returns its output.
+func runLimited(t *testing.T, scope *Scope, limits Limits, input string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	repl := &REPL{
+		Scope:   scope,
+		In:      strings.NewReader(input),
+		Out:     &out,
+		Options: []Option{WithHistoryFile(""), WithLimits(limits)},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+// expectOutput fails the test unless out contains each of want in order.
+func expectOutput(t *testing.T, out string, want ...string) {
+	t.Helper()
+
+	rest := out
+	for _, w := range want {
+		i := strings.Index(rest, w)
+		if i < 0 {
+			t.Fatalf("Expected %q in the output:\n%s", w, out)
+		}
+		rest = rest[i+len(w):]
+	}
+}
+
+func TestLimitsMaxSteps(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.SetLimits(Limits{MaxSteps: 100})
+	_, err := scope.InterpretString("for {}")
+	var stepErr *StepLimitError
+	if !errors.As(err, &stepErr) || stepErr.Max != 100 || !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected a *StepLimitError got %#v.", err)
+	}
+	// Every evaluation gets its own budget.
+	if out, err := scope.InterpretString("1 + 1"); err != nil || out != 2 {
+		t.Errorf("Expected %#v got %#v %v.", 2, out, err)
+	}
+
+	out := runLimited(t, NewScope(), Limits{MaxSteps: 100}, "i := 0\nfor { i++ }\ni > 0\n")
+	expectOutput(t, out, "more than the 100 steps allowed", "=> true\n")
+}
+
+func TestLimitsMaxMakeBytes(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.SetLimits(Limits{MaxMakeBytes: 1024})
+	for _, src := range []string{
+		"make([]byte, 1<<40)",
+		"make([]int64, 1, 129)",
+		"make(chan int32, 257)",
+		"make(map[int64]int64, 65)",
+	} {
+		_, err := scope.InterpretString(src)
+		var makeErr *MakeLimitError
+		if !errors.As(err, &makeErr) || !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%q: Expected a *MakeLimitError got %#v.", src, err)
+		}
+	}
+	for _, src := range []string{
+		"make([]byte, 1024)",
+		"make([]int64, 1, 128)",
+		"make(map[string]int)",
+	} {
+		if _, err := scope.InterpretString(src); err != nil {
+			t.Errorf("%q: %v", src, err)
+		}
+	}
+
+	// The line editor swallows the key after '[' for now.
+	scope = NewScope()
+	scope.Set("bytes", reflect.TypeOf([]byte(nil)))
+	out := runLimited(t, scope, Limits{MaxMakeBytes: 1024}, "b := make(bytes, 1<<40)\nlen(make(bytes, 10))\n")
+	expectOutput(t, out, "make([]uint8, 1099511627776) allocates more than the 1024 bytes allowed", "=> 10\n")
+}
+
+func TestLimitsMaxOutputBytes(t *testing.T) {
+	t.Parallel()
+
+	out := runLimited(t, NewScope(), Limits{MaxOutputBytes: 10}, "s := \"0123456789abcdef\"\ns\nlen(s)\n")
+	expectOutput(t, out, "=> \"012345678...\n", "the result is longer than the 10 bytes allowed", "=> 16\n")
+
+	s, err := formatResult("ééé", &Config{Limits: Limits{MaxOutputBytes: 4}})
+	var outputErr *OutputLimitError
+	if !errors.As(err, &outputErr) || !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected an *OutputLimitError got %#v.", err)
+	}
+	// Characters aren't split.
+	if want := "\"é..."; s != want {
+		t.Errorf("Expected %#v got %#v.", want, s)
+	}
+}
+
+// heapWriter discards what's written to it, keeping track of how much the
+// live heap grows meanwhile.
+type heapWriter struct {
+	writes, bytes int
+	base, peak    uint64
+}
+
+// liveHeap returns the bytes in use once garbage is collected.
+func liveHeap() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+func (w *heapWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.bytes += len(p)
+	if w.writes%512 == 0 {
+		if heap := liveHeap(); heap > w.peak {
+			w.peak = heap
+		}
+	}
+	return len(p), nil
+}
+
+func TestWriteResultStreams(t *testing.T) {
+	// The heap is measured, so this doesn't run in parallel.
+	huge := make([]int32, 2000000)
+	for i := range huge {
+		huge[i] = int32(i)
+	}
+	config := &Config{InspectDepth: defaultInspectDepth, InspectWidth: 80}
+	w := &heapWriter{base: liveHeap()}
+	if err := writeResult(w, huge, config, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes < 1000 {
+		t.Errorf("Expected the result to be written in parts got %d writes.", w.writes)
+	}
+	// The result is about 18MB, more than the slice itself.
+	if growth := int64(w.peak) - int64(w.base); w.bytes < 16<<20 || growth > 4<<20 {
+		t.Errorf("Expected the heap to grow less than 4MB while writing %d bytes got %d.", w.bytes, growth)
+	}
+	runtime.KeepAlive(huge)
+
+	// Interruptions stop the rendering.
+	var out strings.Builder
+	checks := 0
+	err := writeResult(&out, huge, config, false, func() bool {
+		checks++
+		return checks == 3
+	})
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("Expected %#v got %#v.", ErrInterrupted, err)
+	}
+	if out.Len() > 4*resultFlushSize {
+		t.Errorf("Expected rendering to stop after 3 parts got %d bytes.", out.Len())
+	}
+}
+
+func TestLimitsMaxDuration(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("sleep", func() { time.Sleep(time.Millisecond) })
+	scope.SetLimits(Limits{MaxDuration: 20 * time.Millisecond})
+	start := time.Now()
+	_, err := scope.InterpretString("for { sleep() }")
+	var durationErr *DurationLimitError
+	if !errors.As(err, &durationErr) || !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected a *DurationLimitError got %#v.", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the evaluation ran for %s", elapsed)
+	}
+
+	out := runLimited(t, NewScope(), Limits{MaxDuration: 20 * time.Millisecond}, "for {}\n1 + 2\n")
+	expectOutput(t, out, "ran longer than the 20ms allowed", "=> 3\n")
+}
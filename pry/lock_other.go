@@ -0,0 +1,16 @@
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd,!windows
+
+package pry
+
+import "os"
+
+// lockFile is a no-op on systems without flock, where concurrent sessions
+// may interleave their writes.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on systems without flock.
+func unlockFile(f *os.File) error {
+	return nil
+}
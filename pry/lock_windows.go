@@ -0,0 +1,16 @@
+// +build windows
+
+package pry
+
+import "os"
+
+// lockFile is a no-op on Windows which already prevents concurrent writes to
+// open files.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on Windows.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -1,20 +1,237 @@
 package pry
 
+import (
+	"go/ast"
+	"go/types"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
 // Package represents a Go package for use with pry
 type Package struct {
-	Name      string
+	Name string
+	// Path is the import path. It's used to find the package documentation.
+	Path      string
 	Functions map[string]interface{}
+	// Variables holds pointers to the package-level variables, so assigning
+	// to them changes the program.
+	Variables map[string]interface{}
+	// Consts holds the constants. Untyped constants have their default type.
+	Consts map[string]interface{}
+	// Types holds the named types, which composite literals and conversions
+	// use.
+	Types TypeMap
+	// Generics holds the generic functions and types.
+	Generics map[string]Generic
+	// Skipped is why go-pry didn't generate the members of the package,
+	// such as "excluded". It's empty if it did.
+	Skipped string
+	// Unavailable holds why the exports the generated code can't refer to,
+	// such as constants too large for any type, were left out, by name.
+	Unavailable map[string]string
+
+	// lazy loads the members of packages made with LazyPackage.
+	lazy *lazyMembers
+}
+
+// lazyMembers are the members of a package, loaded the first time they're
+// needed.
+type lazyMembers struct {
+	once sync.Once
+	load func() Package
+	pkg  Package
+	// done is set once pkg is loaded.
+	done uint32
+}
+
+// LazyPackage returns the package name, imported from path, whose members
+// load returns the first time they're needed, such as to evaluate a selector
+// or complete one, so sessions only build the members of the packages they
+// use. The generated code uses it. load is called once and the Name and Path
+// of what it returns are ignored.
+func LazyPackage(name, path string, load func() Package) Package {
+	return Package{Name: name, Path: path, lazy: &lazyMembers{load: load}}
+}
+
+// loaded returns p with its members, loading them if p is lazy.
+func (p Package) loaded() Package {
+	l := p.lazy
+	if l == nil {
+		return p
+	}
+	l.once.Do(func() {
+		l.pkg = l.load()
+		l.pkg.Name, l.pkg.Path, l.pkg.lazy = p.Name, p.Path, nil
+		l.load = nil
+		atomic.StoreUint32(&l.done, 1)
+	})
+	return l.pkg
+}
+
+// isLoaded returns whether the members of p are built.
+func (p Package) isLoaded() bool {
+	return p.lazy == nil || atomic.LoadUint32(&p.lazy.done) != 0
 }
 
+// TypeMap holds types by name. Generated code uses it so it doesn't have to
+// import reflect.
+type TypeMap = map[string]reflect.Type
+
+// Keys returns the sorted names of the members of the package.
 func (p Package) Keys() []string {
+	p = p.loaded()
+	seen := map[string]bool{}
 	var keys []string
-	for k := range p.Functions {
-		keys = append(keys, k)
+	add := func(k string) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	for _, m := range []map[string]interface{}{p.Functions, p.Variables, p.Consts} {
+		for k := range m {
+			add(k)
+		}
+	}
+	for k := range p.Types {
+		add(k)
 	}
+	for k := range p.Generics {
+		add(k)
+	}
+	sort.Strings(keys)
 	return keys
 }
 
+// Get returns the member named key. Functions take precedence over
+// variables, then constants, types, which are returned as reflect.Type, and
+// generics.
 func (p Package) Get(key string) (interface{}, bool) {
-	v, ok := p.Functions[key]
-	return v, ok
+	v, ok := p.member(key)
+	if !ok {
+		return nil, false
+	}
+	return valueInterface(v), true
+}
+
+// member returns the member named key. Variables are addressable so they can
+// be assigned to.
+func (p Package) member(key string) (reflect.Value, bool) {
+	p = p.loaded()
+	if v, ok := p.Functions[key]; ok {
+		return reflect.ValueOf(v), true
+	}
+	if v, ok := p.Variables[key]; ok {
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			return rv.Elem(), true
+		}
+		return reflect.ValueOf(v), true
+	}
+	if v, ok := p.Consts[key]; ok {
+		return reflect.ValueOf(v), true
+	}
+	if t, ok := p.Types[key]; ok {
+		return reflect.ValueOf(t), true
+	}
+	if g, ok := p.Generics[key]; ok {
+		return reflect.ValueOf(g), true
+	}
+	return reflect.Value{}, false
+}
+
+// assignable returns the variable sel selects from the package, following
+// the precedence of Get.
+func (p Package) assignable(sel *ast.SelectorExpr) (reflect.Value, error) {
+	p = p.loaded()
+	name := types.ExprString(sel)
+	if _, ok := p.Functions[sel.Sel.Name]; ok {
+		return reflect.Value{}, errors.Errorf("cannot assign to %s (not a variable)", name)
+	}
+	if _, ok := p.Variables[sel.Sel.Name]; ok {
+		if v, _ := p.member(sel.Sel.Name); v.CanSet() {
+			return v, nil
+		}
+		return reflect.Value{}, errors.Errorf("cannot assign to %s (not addressable)", name)
+	}
+	if _, ok := p.Consts[sel.Sel.Name]; ok {
+		return reflect.Value{}, errors.Errorf("cannot assign to %s (constant)", name)
+	}
+	if _, ok := p.Types[sel.Sel.Name]; ok {
+		return reflect.Value{}, errors.Errorf("cannot assign to %s (type)", name)
+	}
+	if _, ok := p.Generics[sel.Sel.Name]; ok {
+		return reflect.Value{}, errors.Errorf("cannot assign to %s (generic)", name)
+	}
+	if err := p.missingError(sel.Sel.Name, name); err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.Value{}, &UndefinedError{Name: name, Hint: didYouMean(sel.Sel.Name, p.Keys())}
+}
+
+// loadFailed is the reason packages that failed to load are skipped for.
+const loadFailed = "failed to load"
+
+// missingError explains why key, which is written name, isn't a member of
+// the package if go-pry left it out. It's nil otherwise.
+func (p Package) missingError(key, name string) error {
+	p = p.loaded()
+	if len(p.Skipped) > 0 {
+		if p.Skipped == loadFailed {
+			return errors.Errorf("%s is unavailable: go-pry skipped the package %s since it %s", name, p.Path, p.Skipped)
+		}
+		return errors.Errorf("%s is unavailable: go-pry skipped the package %s (%s); list it with -include or as !%s in .pryignore to use it",
+			name, p.Path, p.Skipped, p.Path)
+	}
+	if reason, ok := p.Unavailable[key]; ok {
+		return errors.Errorf("%s is unavailable: %s", name, reason)
+	}
+	return nil
+}
+
+// importPackage binds the package imported by spec. Packages can't be loaded
+// at runtime, so it must be in the scope already, under its name or any other
+// with the same path.
+func (scope *Scope) importPackage(spec *ast.ImportSpec) error {
+	importPath, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return errors.Wrapf(err, "import path %s", spec.Path.Value)
+	}
+	name := ""
+	if spec.Name != nil {
+		name = spec.Name.Name
+	}
+	if name == "." {
+		return errors.Errorf("dot imports aren't supported: %q", importPath)
+	}
+	pkg, ok := scope.findPackage(importPath)
+	if !ok {
+		return errors.Errorf("package %q isn't available in this session", importPath)
+	}
+	if len(name) > 0 && name != "_" {
+		scope.Define(name, pkg)
+	}
+	return nil
+}
+
+// findPackage returns the package of the scope imported as importPath.
+// Packages without a path match by their name.
+func (scope *Scope) findPackage(importPath string) (Package, bool) {
+	if v, ok := scope.Get(path.Base(importPath)); ok {
+		if pkg, ok := v.(Package); ok && (len(pkg.Path) == 0 || pkg.Path == importPath) {
+			return pkg, true
+		}
+	}
+	for _, key := range scope.Keys() {
+		v, _ := scope.Get(key)
+		if pkg, ok := v.(Package); ok && pkg.Path == importPath {
+			return pkg, true
+		}
+	}
+	return Package{}, false
 }
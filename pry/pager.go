@@ -0,0 +1,353 @@
+package pry
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// page displays text through a pager if it takes up more rows of the
+// terminal than the paging threshold. It returns whether text was paged.
+func page(config *Config, out io.Writer, tty genericTTY, text string) (bool, error) {
+	if config.PagerThreshold < 0 {
+		return false, nil
+	}
+	width, height, err := tty.Size()
+	if err != nil || width <= 0 || height <= 1 {
+		return false, nil
+	}
+	threshold := config.PagerThreshold
+	if threshold == 0 {
+		threshold = height - 1
+	}
+	rows := wrapRows(text, width)
+	if len(rows) <= threshold {
+		return false, nil
+	}
+
+	if len(config.Pager) > 0 && runtime.GOOS != "js" {
+		return true, runExternalPager(config.Pager, out, strings.NewReader(text))
+	}
+	p := &pager{rows: rows, height: height - 1}
+	return true, p.run(out, tty)
+}
+
+// pageStream is page for text read from r, such as a result while it's
+// rendered. Only what's displayed is read, so the pager shows up once it
+// has a screenful and the rest is read as it's scrolled to. It returns once
+// the pager is closed, which may leave the rest of r unread.
+func pageStream(config *Config, out io.Writer, tty genericTTY, r io.Reader) error {
+	width, height, err := tty.Size()
+	if config.PagerThreshold < 0 || err != nil || width <= 0 || height <= 1 {
+		_, err := io.Copy(out, r)
+		return err
+	}
+	threshold := config.PagerThreshold
+	if threshold == 0 {
+		threshold = height - 1
+	}
+	// What's read is kept until it's known whether it's paged.
+	read := &recordingReader{r: r, record: true}
+	scanner := newRowScanner(read, width)
+	var rows []string
+	for len(rows) <= threshold {
+		row, ok := scanner.next()
+		if !ok {
+			_, err := out.Write(read.buf.Bytes())
+			return err
+		}
+		rows = append(rows, row)
+	}
+
+	if len(config.Pager) > 0 && runtime.GOOS != "js" {
+		return runExternalPager(config.Pager, out, io.MultiReader(&read.buf, r))
+	}
+	read.record = false
+	read.buf = bytes.Buffer{}
+	p := &pager{rows: rows, height: height - 1, source: scanner}
+	return p.run(out, tty)
+}
+
+// recordingReader reads from r, keeping what's read in buf while record is
+// set.
+type recordingReader struct {
+	r      io.Reader
+	buf    bytes.Buffer
+	record bool
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.record {
+		r.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// runExternalPager pipes text through the command line cmd, such as
+// "less -R".
+func runExternalPager(cmdLine string, out io.Writer, text io.Reader) error {
+	args := strings.Fields(cmdLine)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = text
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "running pager %q", cmdLine)
+	}
+	return nil
+}
+
+// wrapRows splits text into the rows it takes up in a terminal of the given
+// width. ANSI escape sequences don't take up any columns.
+func wrapRows(text string, width int) []string {
+	scanner := newRowScanner(strings.NewReader(text), width)
+	var rows []string
+	for {
+		row, ok := scanner.next()
+		if !ok {
+			return rows
+		}
+		rows = append(rows, row)
+	}
+}
+
+// rowScanner splits text into rows like wrapRows while it's read.
+type rowScanner struct {
+	r     *bufio.Reader
+	width int
+	// started is set once a rune was read and newline while the last one
+	// read ended a line, since text ending with a newline doesn't end with
+	// an empty row.
+	started, newline, done bool
+}
+
+func newRowScanner(r io.Reader, width int) *rowScanner {
+	return &rowScanner{r: bufio.NewReader(r), width: width}
+}
+
+// next returns the next row, or false once there are no more.
+func (s *rowScanner) next() (string, bool) {
+	if s.done {
+		return "", false
+	}
+	var row strings.Builder
+	cols := 0
+	for {
+		r, _, err := s.r.ReadRune()
+		if err != nil {
+			s.done = true
+			if s.started && s.newline {
+				return "", false
+			}
+			return row.String(), true
+		}
+		s.started = true
+		s.newline = r == '\n'
+		if r == '\n' {
+			return row.String(), true
+		}
+		if r == '\x1b' {
+			if n := s.escapeLen(); n > 0 {
+				seq := make([]byte, n)
+				io.ReadFull(s.r, seq)
+				row.WriteRune(r)
+				row.Write(seq)
+				continue
+			}
+		}
+		// Wide characters that don't fit start the next row, and marks
+		// stay on the row of the character they combine with.
+		w := runeWidth(r)
+		if cols > 0 && cols+w > s.width {
+			s.r.UnreadRune()
+			return row.String(), true
+		}
+		row.WriteRune(r)
+		cols += w
+	}
+}
+
+// maxEscapeLen is the longest ANSI escape sequence rows are split around.
+const maxEscapeLen = 32
+
+// escapeLen returns the length of the rest of the ANSI escape sequence
+// started by the escape just read, or 0 if it doesn't start one.
+func (s *rowScanner) escapeLen() int {
+	peek, _ := s.r.Peek(maxEscapeLen)
+	if loc := ansiEscape.FindIndex(append([]byte{'\x1b'}, peek...)); loc != nil && loc[0] == 0 {
+		return loc[1] - 1
+	}
+	return 0
+}
+
+// pager is a minimal less-like pager. It understands space/f and b to move a
+// page, j/k and enter to move a row, g/G to jump to the start or end, /query
+// and n to search forward and q to quit.
+type pager struct {
+	rows []string
+	// source holds the rows that weren't read yet, if any.
+	source *rowScanner
+	// height is the number of rows shown at once.
+	height int
+	top    int
+	query  string
+	// status overrides the status line until the next key press.
+	status string
+}
+
+// run displays the pager on the alternate screen so the terminal is
+// restored when it's closed.
+func (p *pager) run(out io.Writer, tty genericTTY) error {
+	fmt.Fprint(out, "\033[?1049h")
+	defer fmt.Fprint(out, "\033[?1049l")
+
+	for {
+		p.render(out)
+		r, _, err := tty.ReadRune()
+		if err != nil {
+			return err
+		}
+		p.status = ""
+		switch r {
+		case 'q', 'Q', 3, 4: // Ctrl-C, Ctrl-D
+			return nil
+		case ' ', 'f':
+			p.scroll(p.height)
+		case 'b':
+			p.scroll(-p.height)
+		case 'j', 10, 13: // Enter
+			p.scroll(1)
+		case 'k':
+			p.scroll(-1)
+		case 'g':
+			p.top = 0
+		case 'G':
+			p.load(-1)
+			p.scroll(len(p.rows))
+		case '/':
+			query, err := p.readQuery(out, tty)
+			if err != nil {
+				return err
+			}
+			if len(query) > 0 {
+				p.query = query
+			}
+			p.search()
+		case 'n':
+			p.search()
+		}
+	}
+}
+
+// load reads rows until there are n, or all of them if n is negative.
+func (p *pager) load(n int) {
+	for p.source != nil && (n < 0 || len(p.rows) < n) {
+		row, ok := p.source.next()
+		if !ok {
+			p.source = nil
+			return
+		}
+		p.rows = append(p.rows, row)
+	}
+}
+
+// maxTop returns the offset of the last page of the rows read.
+func (p *pager) maxTop() int {
+	if len(p.rows) <= p.height {
+		return 0
+	}
+	return len(p.rows) - p.height
+}
+
+func (p *pager) scroll(n int) {
+	p.load(p.top + n + p.height)
+	p.top += n
+	if p.top > p.maxTop() {
+		p.top = p.maxTop()
+	}
+	if p.top < 0 {
+		p.top = 0
+	}
+}
+
+// search moves to the next row after the top one containing the query.
+func (p *pager) search() {
+	if len(p.query) == 0 {
+		return
+	}
+	for i := p.top + 1; ; i++ {
+		if p.load(i + 1); i >= len(p.rows) {
+			break
+		}
+		if strings.Contains(ansiEscape.ReplaceAllString(p.rows[i], ""), p.query) {
+			// The rows of the page are needed to know it isn't the last.
+			p.load(i + p.height)
+			p.top = i
+			if p.top > p.maxTop() {
+				p.top = p.maxTop()
+			}
+			return
+		}
+	}
+	p.status = "Pattern not found"
+}
+
+// readQuery reads a search query on the status line.
+func (p *pager) readQuery(out io.Writer, tty genericTTY) (string, error) {
+	var query []rune
+	for {
+		fmt.Fprintf(out, "\r\033[K/%s", string(query))
+		r, _, err := tty.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case 10, 13:
+			return string(query), nil
+		case 27, 3: // ESC, Ctrl-C
+			return "", nil
+		case 127, '\b':
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+		default:
+			if r >= 32 {
+				query = append(query, r)
+			}
+		}
+	}
+}
+
+func (p *pager) render(out io.Writer) {
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	// One more row tells whether the last one is shown.
+	p.load(p.top + p.height + 1)
+	end := p.top + p.height
+	if end > len(p.rows) {
+		end = len(p.rows)
+	}
+	for _, row := range p.rows[p.top:end] {
+		b.WriteString(row)
+		b.WriteString("\033[0m\r\n")
+	}
+	status := p.status
+	if len(status) == 0 {
+		if end == len(p.rows) {
+			status = "(END)"
+		} else if p.source != nil {
+			status = fmt.Sprintf("lines %d-%d", p.top+1, end)
+		} else {
+			status = fmt.Sprintf("lines %d-%d/%d", p.top+1, end, len(p.rows))
+		}
+	}
+	b.WriteString("\033[7m" + status + "\033[0m")
+	fmt.Fprint(out, b.String())
+}
@@ -0,0 +1,162 @@
+package pry
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/d4l3k/go-pry/pry/safebuffer"
+)
+
+// sizedTTY is a testTTY with a custom size.
+type sizedTTY struct {
+	*testTTY
+	width, height int
+}
+
+// newScriptedTTY returns a TTY that's sent input.
+func newScriptedTTY(input string, width, height int) *sizedTTY {
+	tty := makeTestTTY()
+	go tty.Write([]byte(input))
+	return &sizedTTY{tty, width, height}
+}
+
+func (t *sizedTTY) Size() (int, int, error) {
+	return t.width, t.height, nil
+}
+
+func TestWrapRows(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"abcdef", 3, []string{"abc", "def"}},
+		{"abcdefg\nhi\n", 3, []string{"abc", "def", "g", "hi"}},
+		{"\033[1mab\033[0mcd", 2, []string{"\033[1mab\033[0m", "cd"}},
+		{"", 3, []string{""}},
+		{"日本語", 3, []string{"日", "本", "語"}},
+		{"ae\u0301b", 2, []string{"ae\u0301", "b"}},
+	}
+	for _, c := range cases {
+		if out := wrapRows(c.text, c.width); !reflect.DeepEqual(out, c.want) {
+			t.Errorf("wrapRows(%q, %d) = %#v; expected %#v", c.text, c.width, out, c.want)
+		}
+	}
+}
+
+func TestPageThreshold(t *testing.T) {
+	t.Parallel()
+
+	text := strings.Repeat("line\n", 10)
+	cases := []struct {
+		threshold int
+		height    int
+		want      bool
+	}{
+		{0, 20, false},
+		{0, 5, true},
+		{12, 5, false},
+		{3, 100, true},
+		{-1, 5, false},
+	}
+	for _, c := range cases {
+		var out safebuffer.Buffer
+		config := &Config{PagerThreshold: c.threshold}
+		tty := newScriptedTTY("q", 80, c.height)
+		paged, err := page(config, &out, tty, text)
+		tty.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if paged != c.want {
+			t.Errorf("threshold %d, height %d: expected paged = %t; got %t", c.threshold, c.height, c.want, paged)
+		}
+	}
+}
+
+func TestPagerNavigation(t *testing.T) {
+	t.Parallel()
+
+	var rows []string
+	for i := 0; i < 20; i++ {
+		rows = append(rows, "row "+string(rune('a'+i)))
+	}
+
+	cases := []struct {
+		input string
+		top   int
+	}{
+		{" ", 5},
+		{"  b", 5},
+		{"jjk", 1},
+		{"G", 15},
+		{"Gkg", 0},
+		{"Gk", 14},
+		{"/row m\n", 12},
+		{"/row\nn", 2},
+		{"/missing\n", 0},
+		{"kkk", 0},
+	}
+	for _, c := range cases {
+		// Rows streamed to the pager are read as they're needed.
+		streamed := newRowScanner(strings.NewReader(strings.Join(rows, "\n")), 80)
+		for _, p := range []*pager{{rows: rows, height: 5}, {height: 5, source: streamed}} {
+			var out safebuffer.Buffer
+			tty := newScriptedTTY(c.input+"q", 80, 6)
+			err := p.run(&out, tty)
+			tty.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.top != c.top {
+				t.Errorf("%q: expected top = %d; got %d", c.input, c.top, p.top)
+			}
+		}
+	}
+}
+
+// endlessRows is text of rows that never ends.
+type endlessRows struct {
+	rows int
+}
+
+func (r *endlessRows) Read(p []byte) (int, error) {
+	row := fmt.Sprintf("row %d\n", r.rows)
+	r.rows++
+	return copy(p, row), nil
+}
+
+func TestPageStream(t *testing.T) {
+	t.Parallel()
+
+	// Text that's short enough is written as it is.
+	var out safebuffer.Buffer
+	tty := newScriptedTTY("", 80, 20)
+	text := "=> \033[1mshort\033[0m\n\n"
+	if err := pageStream(&Config{}, &out, tty, strings.NewReader(text)); err != nil {
+		t.Fatal(err)
+	}
+	tty.Close()
+	if out.String() != text {
+		t.Errorf("Expected %#v got %#v.", text, out.String())
+	}
+
+	// Longer text is paged while it's read.
+	out = safebuffer.Buffer{}
+	tty = newScriptedTTY(" q", 80, 6)
+	endless := &endlessRows{}
+	if err := pageStream(&Config{}, &out, tty, endless); err != nil {
+		t.Fatal(err)
+	}
+	tty.Close()
+	if !strings.Contains(out.String(), "row 9\033[0m\r\n\033[7mlines 6-10\033[0m") {
+		t.Errorf("Expected the second page got %q.", out.String())
+	}
+	if endless.rows > 1000 {
+		t.Errorf("Expected only the rows shown to be read got %d.", endless.rows)
+	}
+}
@@ -0,0 +1,127 @@
+package pry
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// pasteMode is how the terminal editor tells pasted text from typed text, so
+// a pasted block is edited as a whole rather than run line by line.
+type pasteMode int
+
+const (
+	// pasteNone treats pasted text as typed.
+	pasteNone pasteMode = iota
+	// pasteBracketed asks the terminal to mark pasted text with
+	// "\033[200~" and "\033[201~".
+	pasteBracketed
+	// pasteTiming takes line endings followed by more input within
+	// pasteGap to be pasted, since nobody types that fast.
+	pasteTiming
+)
+
+// pasteGap is the longest time between a line ending and the next key for
+// them to be taken as pasted when the terminal doesn't mark pastes.
+const pasteGap = 10 * time.Millisecond
+
+// The escape sequences of bracketed paste. The first two turn it on and off
+// and terminals send the others around pasted text.
+const (
+	bracketedPasteOn    = "\033[?2004h"
+	bracketedPasteOff   = "\033[?2004l"
+	bracketedPasteStart = "\033[200~"
+	bracketedPasteEnd   = "\033[201~"
+)
+
+// terminalPasteMode returns the paste mode of the terminal named term, as
+// in $TERM. Terminals that don't know bracketed paste would show its escape
+// sequences, so they get the timing heuristic instead.
+func terminalPasteMode(term string) pasteMode {
+	switch {
+	case term == "", term == "dumb", term == "emacs", term == "cons25",
+		strings.HasPrefix(term, "linux"), strings.HasPrefix(term, "vt"):
+		return pasteTiming
+	}
+	return pasteBracketed
+}
+
+// pasteTTY is a TTY that can tell whether a key follows at once, as it does
+// when text is pasted.
+type pasteTTY struct {
+	genericTTY
+
+	start, stop sync.Once
+	runes       chan runeResult
+	done        chan struct{}
+	// next is a key read by follows that ReadRune hasn't returned yet.
+	next *runeResult
+}
+
+func newPasteTTY(tty genericTTY) *pasteTTY {
+	return &pasteTTY{
+		genericTTY: tty,
+		runes:      make(chan runeResult),
+		done:       make(chan struct{}),
+	}
+}
+
+// read forwards runes from the underlying TTY until it fails or is closed.
+func (t *pasteTTY) read() {
+	for {
+		r, size, err := t.genericTTY.ReadRune()
+		select {
+		case t.runes <- runeResult{r, size, err}:
+		case <-t.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *pasteTTY) ReadRune() (rune, int, error) {
+	t.start.Do(func() {
+		go t.read()
+	})
+	if t.next != nil {
+		res := *t.next
+		t.next = nil
+		return res.r, res.size, res.err
+	}
+	res := <-t.runes
+	return res.r, res.size, res.err
+}
+
+// follows returns whether a key is read within gap. The key is returned by
+// the next ReadRune.
+func (t *pasteTTY) follows(gap time.Duration) bool {
+	t.start.Do(func() {
+		go t.read()
+	})
+	if t.next != nil {
+		return t.next.err == nil
+	}
+	timer := time.NewTimer(gap)
+	defer timer.Stop()
+	select {
+	case res := <-t.runes:
+		t.next = &res
+		return res.err == nil
+	case <-timer.C:
+		return false
+	}
+}
+
+// Stop stops forwarding runes without closing the underlying TTY.
+func (t *pasteTTY) Stop() {
+	t.stop.Do(func() {
+		close(t.done)
+	})
+}
+
+func (t *pasteTTY) Close() error {
+	t.Stop()
+	return t.genericTTY.Close()
+}
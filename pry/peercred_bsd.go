@@ -0,0 +1,38 @@
+// +build darwin freebsd
+
+package pry
+
+import (
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// checkPeer rejects connections from other users than the one running the
+// program, using the credentials of the peer from LOCAL_PEERCRED.
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.Errorf("can't check the credentials of a %s connection", conn.LocalAddr().Network())
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return errors.Wrap(err, "reading the peer credentials")
+	}
+	var cred *unix.Xucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return errors.Wrap(err, "reading the peer credentials")
+	}
+	if credErr != nil {
+		return errors.Wrap(credErr, "reading the peer credentials")
+	}
+	if int(cred.Uid) != os.Geteuid() {
+		return errors.Errorf("permission denied for uid %d", cred.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package pry
+
+import (
+	"fmt"
+	"go/ast"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Policy restricts the packages and functions code evaluated in a scope can
+// use, such as for sessions handed to other people. Symbols are written as
+// an import path, such as "os/exec", or an import path and member, such as
+// "os.Exit".
+//
+// The checks are made when a member of a package is referred to and when a
+// native function is called, so blocked functions can't be called through
+// variables holding them either. Functions that aren't members of a package
+// in scope are matched by the package and name they're declared with, and
+// with an allow-list the ones whose package is unknown are blocked. Methods
+// of the values of blocked packages aren't checked.
+type Policy struct {
+	// Deny lists the blocked packages and members.
+	Deny []string
+	// Allow, if it isn't empty, lists the only packages and members that
+	// can be used. Deny takes precedence over it.
+	Allow []string
+	// DenyFuncs lists functions that are blocked however they're reached,
+	// such as os.Exit.
+	DenyFuncs []interface{}
+}
+
+// DefaultDeny lists the members of the standard library that end the
+// program, run commands or change files. It's meant for Policy.Deny.
+var DefaultDeny = []string{
+	"os.Exit",
+	"os.Chdir",
+	"os.Chmod",
+	"os.Chown",
+	"os.Create",
+	"os.Link",
+	"os.Mkdir",
+	"os.MkdirAll",
+	"os.OpenFile",
+	"os.Remove",
+	"os.RemoveAll",
+	"os.Rename",
+	"os.Symlink",
+	"os.Truncate",
+	"os.WriteFile",
+	"os/exec",
+	"io/ioutil.WriteFile",
+	"log.Fatal",
+	"log.Fatalf",
+	"log.Fatalln",
+	"syscall",
+	"unsafe",
+}
+
+// SetPolicy restricts what the evaluations in scope and its children can
+// use.
+func (scope *Scope) SetPolicy(p Policy) {
+	scope.Lock()
+	scope.policy = &p
+	scope.Unlock()
+}
+
+// pushPolicy sets the policy of scope until restore is called.
+func (scope *Scope) pushPolicy(p Policy) (restore func()) {
+	scope.Lock()
+	prev := scope.policy
+	scope.policy = &p
+	scope.Unlock()
+	return func() {
+		scope.Lock()
+		scope.policy = prev
+		scope.Unlock()
+	}
+}
+
+// currentPolicy returns the policy set on scope or its closest parent, or nil.
+func (scope *Scope) currentPolicy() *Policy {
+	for s := scope; s != nil; s = s.Parent {
+		s.Lock()
+		p := s.policy
+		s.Unlock()
+		if p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// isZero returns whether p allows everything.
+func (p *Policy) isZero() bool {
+	return p == nil || len(p.Deny) == 0 && len(p.Allow) == 0 && len(p.DenyFuncs) == 0
+}
+
+// packagePath returns the path symbols of pkg are written with.
+func packagePath(pkg Package) string {
+	if len(pkg.Path) > 0 {
+		return pkg.Path
+	}
+	return pkg.Name
+}
+
+// matchSymbol returns whether symbol, a package path or a path and member,
+// is one of list or a member of a package in it.
+func matchSymbol(list []string, symbol string) bool {
+	for _, s := range list {
+		if s == symbol || strings.HasPrefix(symbol, s+".") && !strings.Contains(symbol[len(s)+1:], "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns whether the member name of pkg can be used.
+func (p *Policy) allows(pkg Package, name string) bool {
+	if p.isZero() {
+		return true
+	}
+	symbol := packagePath(pkg) + "." + name
+	if matchSymbol(p.Deny, symbol) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchSymbol(p.Allow, symbol)
+}
+
+// allowsPackage returns whether some member of pkg can be used.
+func (p *Policy) allowsPackage(pkg Package) bool {
+	if p.isZero() {
+		return true
+	}
+	path := packagePath(pkg)
+	if matchSymbol(p.Deny, path) {
+		return false
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, s := range p.Allow {
+		if s == path || strings.HasPrefix(s, path+".") && !strings.Contains(s[len(path)+1:], "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMember returns a *PolicyError if the member name of pkg is blocked.
+func (scope *Scope) checkMember(pkg Package, name string) error {
+	if !scope.currentPolicy().allows(pkg, name) {
+		return &PolicyError{Symbol: packagePath(pkg) + "." + name}
+	}
+	return nil
+}
+
+// checkCall returns a *PolicyError if the function fn is blocked, either
+// directly or as a blocked member of a package in scope.
+func (scope *Scope) checkCall(fn reflect.Value) error {
+	p := scope.currentPolicy()
+	if p.isZero() || fn.Kind() != reflect.Func || fn.IsNil() {
+		return nil
+	}
+	blocked := scope.currentBlocked()
+	if blocked == nil {
+		blocked = newBlockedFuncs(p)
+	}
+	if symbol, ok := blocked.lookup(scope, fn.Pointer()); ok {
+		return &PolicyError{Symbol: symbol}
+	}
+	return nil
+}
+
+// currentBlocked returns the blocked functions of the evaluation running in
+// scope, or nil if there's none.
+func (scope *Scope) currentBlocked() *blockedFuncs {
+	for s := scope; s != nil; s = s.Parent {
+		if s.blocked != nil {
+			return s.blocked
+		}
+	}
+	return nil
+}
+
+// blockedFuncs are the functions a policy blocks, keyed by their code
+// pointer: the ones it denies and the blocked members of the packages in
+// scope. The members are added as functions are called, so checking calls
+// doesn't build the members of lazy packages the session doesn't use.
+type blockedFuncs struct {
+	sync.Mutex
+	policy *Policy
+	// funcs holds the symbols of the functions looked up, which are empty
+	// for the ones that aren't blocked.
+	funcs map[uintptr]string
+	// scanned holds the packages whose members are in funcs, by the
+	// pointer of their functions.
+	scanned map[uintptr]bool
+}
+
+// newBlockedFuncs returns the functions p blocks.
+func newBlockedFuncs(p *Policy) *blockedFuncs {
+	b := &blockedFuncs{policy: p, funcs: map[uintptr]string{}, scanned: map[uintptr]bool{}}
+	for _, fn := range p.DenyFuncs {
+		if v := reflect.ValueOf(fn); v.Kind() == reflect.Func && !v.IsNil() {
+			name := "function"
+			if f := runtime.FuncForPC(v.Pointer()); f != nil {
+				name = f.Name()
+			}
+			b.funcs[v.Pointer()] = name
+		}
+	}
+	return b
+}
+
+// lookup returns the symbol the function at fn is blocked as, if it's
+// blocked. The members of the built packages in scope are added first, and
+// the lazy ones are only built if they're where the function is declared.
+func (b *blockedFuncs) lookup(scope *Scope, fn uintptr) (string, bool) {
+	b.Lock()
+	defer b.Unlock()
+	if symbol, ok := b.funcs[fn]; ok {
+		return symbol, len(symbol) > 0
+	}
+	if len(b.policy.Deny) > 0 || len(b.policy.Allow) > 0 {
+		path := funcPackage(fn)
+		for _, pkg := range scope.packages() {
+			if !pkg.isLoaded() && packagePath(pkg) != path {
+				continue
+			}
+			members := pkg.loaded().Functions
+			key := reflect.ValueOf(members).Pointer()
+			if b.scanned[key] {
+				continue
+			}
+			b.scanned[key] = true
+			for name, member := range members {
+				if b.policy.allows(pkg, name) {
+					continue
+				}
+				if v := reflect.ValueOf(member); v.Kind() == reflect.Func && !v.IsNil() {
+					b.funcs[v.Pointer()] = packagePath(pkg) + "." + name
+				}
+			}
+		}
+	}
+	symbol, ok := b.funcs[fn]
+	if !ok {
+		symbol = b.policy.blockedFunc(fn)
+	}
+	b.funcs[fn] = symbol
+	return symbol, len(symbol) > 0
+}
+
+// pryPackage is the import path of this package, whose functions are the
+// builtins.
+var pryPackage = reflect.TypeOf(Package{}).PkgPath()
+
+// blockedFunc returns the symbol the function at fn is blocked as by the
+// name it's declared with, or "" if it isn't blocked. It catches the
+// functions handed to the scope in variables, which aren't members of any
+// package in it. With an allow-list, functions of unknown packages are
+// blocked.
+func (p *Policy) blockedFunc(fn uintptr) string {
+	if len(p.Deny) == 0 && len(p.Allow) == 0 {
+		return ""
+	}
+	path, member := funcSymbol(fn)
+	switch {
+	case path == pryPackage:
+		// The builtins.
+		return ""
+	case path == "reflect" && len(member) > 0 && !ast.IsExported(member):
+		// The stubs of interpreted functions and method values.
+		return ""
+	case len(path) == 0:
+		if len(p.Allow) > 0 {
+			return "function"
+		}
+		return ""
+	}
+	symbol := path + "." + member
+	if matchSymbol(p.Deny, symbol) || len(p.Allow) > 0 && !matchSymbol(p.Allow, symbol) {
+		return symbol
+	}
+	return ""
+}
+
+// funcPackage returns the import path of the package the function at pc is
+// declared in, or "" if it's unknown.
+func funcPackage(pc uintptr) string {
+	path, _ := funcSymbol(pc)
+	return path
+}
+
+// funcSymbol returns the import path of the package the function at pc is
+// declared in and the name of the member it's part of. Ex: "os", "Remove"
+// or "bytes", "(*Buffer)". The path is "" if it's unknown.
+func funcSymbol(pc uintptr) (path, member string) {
+	f := runtime.FuncForPC(pc)
+	if f == nil {
+		return "", ""
+	}
+	name := f.Name()
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", ""
+	}
+	// The runtime escapes the dots in the last element of the path.
+	path = strings.Replace(name[:slash+1+dot], "%2e", ".", -1)
+	member = name[slash+2+dot:]
+	if end := strings.IndexAny(member, ".[-"); end > 0 {
+		member = member[:end]
+	}
+	return path, member
+}
+
+// packages returns the packages in scope, bound to names or registered.
+func (scope *Scope) packages() []Package {
+	var pkgs []Package
+	for _, b := range scope.bindings() {
+		if pkg, ok := b.value.(Package); ok {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	for _, name := range scope.registeredNames() {
+		if v, _ := scope.registeredValue(name); v != nil {
+			if pkg, ok := v.(Package); ok {
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	return pkgs
+}
+
+// markBlocked returns the completions of the members of pkg with the blocked
+// ones marked.
+func (p *Policy) markBlocked(pkg Package, members []Candidate) []Candidate {
+	if p.isZero() {
+		return members
+	}
+	out := make([]Candidate, len(members))
+	for i, c := range members {
+		if !p.allows(pkg, c.Text) {
+			c.Blocked = true
+		}
+		out[i] = c
+	}
+	return out
+}
+
+// blockedSummary describes the members of pkg p blocks for :packages, or
+// is empty if it blocks none.
+func (p *Policy) blockedSummary(pkg Package) string {
+	if p.isZero() {
+		return ""
+	}
+	if !p.allowsPackage(pkg) {
+		return "blocked"
+	}
+	var names []string
+	for _, name := range pkg.Keys() {
+		if !p.allows(pkg, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d blocked (%s)", len(names), strings.Join(names, ", "))
+}
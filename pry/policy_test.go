@@ -0,0 +1,202 @@
+package pry
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sandboxScope returns a scope with stand-ins for os, os/exec and strings.
+func sandboxScope(exits *int) *Scope {
+	exit := func(code int) { *exits++ }
+	scope := NewScope()
+	scope.Set("os", Package{Name: "os", Path: "os", Functions: map[string]interface{}{
+		"Exit":   exit,
+		"Getpid": os.Getpid,
+	}})
+	scope.Set("exec", Package{Name: "exec", Path: "os/exec", Functions: map[string]interface{}{
+		"LookPath": func(string) (string, error) { return "", nil },
+	}})
+	scope.Set("strings", Package{Name: "strings", Path: "strings", Functions: map[string]interface{}{"ToUpper": strings.ToUpper}})
+	scope.Set("strconv", Package{Name: "strconv", Path: "strconv", Functions: map[string]interface{}{"Itoa": strconv.Itoa}})
+	// A variable of the program holding a blocked function.
+	scope.Set("quit", exit)
+	return scope
+}
+
+func TestPolicyDeny(t *testing.T) {
+	t.Parallel()
+
+	exits := 0
+	scope := sandboxScope(&exits)
+	scope.SetPolicy(Policy{Deny: []string{"os.Exit", "os/exec"}})
+
+	cases := []struct {
+		src    string
+		symbol string
+	}{
+		{"os.Exit(1)", "os.Exit"},
+		{"f := os.Exit", "os.Exit"},
+		{`exec.LookPath("sh")`, "os/exec.LookPath"},
+		{"quit(1)", "os.Exit"},
+		{"g := quit; g(2)", "os.Exit"},
+	}
+	for _, c := range cases {
+		_, err := scope.InterpretString(c.src)
+		var policyErr *PolicyError
+		if !errors.As(err, &policyErr) || policyErr.Symbol != c.symbol {
+			t.Errorf("%q: Expected a *PolicyError for %s got %#v.", c.src, c.symbol, err)
+		}
+	}
+	if exits != 0 {
+		t.Errorf("a blocked function was called %d times", exits)
+	}
+	for _, src := range []string{"os.Getpid()", `strings.ToUpper("a")`} {
+		if _, err := scope.InterpretString(src); err != nil {
+			t.Errorf("%q: %v", src, err)
+		}
+	}
+}
+
+func TestPolicyAllow(t *testing.T) {
+	t.Parallel()
+
+	exits := 0
+	scope := sandboxScope(&exits)
+	scope.SetPolicy(Policy{Allow: []string{"strings", "strconv"}})
+
+	if out, err := scope.InterpretString(`strings.ToUpper(strconv.Itoa(1) + "a")`); err != nil || out != "1A" {
+		t.Errorf("Expected %#v got %#v %v.", "1A", out, err)
+	}
+	for _, src := range []string{"os.Getpid()", "quit(0)"} {
+		var policyErr *PolicyError
+		if _, err := scope.InterpretString(src); !errors.As(err, &policyErr) {
+			t.Errorf("%q: Expected a *PolicyError got %#v.", src, err)
+		}
+	}
+}
+
+func TestPolicyDenyFuncs(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	calls := 0
+	scope.Set("danger", func() { calls++ })
+	danger, _ := scope.Get("danger")
+	scope.SetPolicy(Policy{DenyFuncs: []interface{}{danger}})
+	var policyErr *PolicyError
+	if _, err := scope.InterpretString("danger()"); !errors.As(err, &policyErr) || calls != 0 {
+		t.Errorf("Expected a *PolicyError got %#v (%d calls).", err, calls)
+	}
+}
+
+func TestPolicyLazyPackages(t *testing.T) {
+	t.Parallel()
+
+	loads := map[string]int{}
+	lazy := func(name string, functions map[string]interface{}) Package {
+		return LazyPackage(name, name, func() Package {
+			loads[name]++
+			return Package{Functions: functions}
+		})
+	}
+	scope := NewScope()
+	scope.Set("strconv", lazy("strconv", map[string]interface{}{"Itoa": strconv.Itoa}))
+	scope.Set("strings", lazy("strings", map[string]interface{}{"ToUpper": strings.ToUpper}))
+	scope.Set("itoa", func() func(int) string { return strconv.Itoa })
+	scope.SetPolicy(Policy{Deny: []string{"strconv.Itoa"}})
+
+	// Calls only build the package of the function called, if any.
+	if _, err := scope.InterpretString("f := itoa(); 1 + 1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(loads) != 0 {
+		t.Errorf("Expected no packages to be built got %v.", loads)
+	}
+	var policyErr *PolicyError
+	if _, err := scope.InterpretString("f(1)"); !errors.As(err, &policyErr) || policyErr.Symbol != "strconv.Itoa" {
+		t.Errorf("Expected a *PolicyError for strconv.Itoa got %#v.", err)
+	}
+	if want := map[string]int{"strconv": 1}; !reflect.DeepEqual(loads, want) {
+		t.Errorf("Expected %v got %v.", want, loads)
+	}
+}
+
+func TestPolicyListings(t *testing.T) {
+	t.Parallel()
+
+	exits := 0
+	scope := sandboxScope(&exits)
+	scope.SetPolicy(Policy{Deny: []string{"os.Exit", "os/exec"}})
+
+	completions, _ := Complete(scope, "os.", 3)
+	want := []Candidate{
+		{Text: "Exit", Kind: CandidateFunc, Type: "func(int)", Blocked: true},
+		{Text: "Getpid", Kind: CandidateFunc, Type: "func() int"},
+	}
+	for i := range completions {
+		completions[i].Doc = ""
+	}
+	if !reflect.DeepEqual(completions, want) {
+		t.Errorf("Expected %#v got %#v.", want, completions)
+	}
+	completions, _ = Complete(scope, "exe", 3)
+	if len(completions) != 1 || completions[0].detail() != "package os/exec (blocked)" {
+		t.Errorf("Expected %#v got %#v.", "package os/exec (blocked)", completions)
+	}
+
+	var out bytes.Buffer
+	env := &commandEnv{scope: scope, out: &out, config: newConfig()}
+	if _, err := runCommand(env, ":packages"); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"  exec     os/exec  1 member, blocked\n",
+		"  os       os       2 members, 1 blocked (Exit)\n",
+		"  strings  strings  1 member\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected %q in:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestPolicyHostFuncs(t *testing.T) {
+	t.Parallel()
+
+	policies := []struct {
+		name   string
+		policy Policy
+	}{
+		{"deny", Policy{Deny: DefaultDeny}},
+		{"allow", Policy{Allow: []string{"strings"}}},
+	}
+	for _, p := range policies {
+		victim := filepath.Join(t.TempDir(), "victim")
+		if err := ioutil.WriteFile(victim, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		scope := NewScope()
+		scope.Set("remove", os.Remove)
+		scope.Set("victim", victim)
+		scope.Set("upper", strings.ToUpper)
+		scope.SetPolicy(p.policy)
+
+		var policyErr *PolicyError
+		if _, err := scope.InterpretString("remove(victim)"); !errors.As(err, &policyErr) || policyErr.Symbol != "os.Remove" {
+			t.Errorf("%s: Expected a *PolicyError for os.Remove got %#v.", p.name, err)
+		}
+		if _, err := os.Stat(victim); err != nil {
+			t.Errorf("%s: %v", p.name, err)
+		}
+		if out, err := scope.InterpretString(`n := append([]int{}, 1); upper("ab"[:len(n)+1])`); err != nil || out != "AB" {
+			t.Errorf("%s: Expected %#v got %#v %v.", p.name, "AB", out, err)
+		}
+	}
+}
@@ -1,43 +1,148 @@
 package pry
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"go/ast"
+	"go/token"
 
-	"github.com/mgutz/ansi"
+	"github.com/pkg/errors"
 )
 
 // Pry does nothing. It only exists so running code without go-pry doesn't throw an error.
 func Pry(v ...interface{}) {
 }
 
-// Apply drops into a pry shell in the location required.
-func Apply(scope *Scope) {
-	out, tty := openTTY()
-	defer tty.Close()
+// PryIf is like Pry but only opens the REPL when cond is true. go-pry turns
+// it into an if statement, so the scope is only captured when it opens. It
+// must be called as a statement.
+func PryIf(cond bool) {
+}
+
+// PryIfFunc is like PryIf but cond is only called when the breakpoint is
+// reached.
+func PryIfFunc(cond func() bool) {
+}
+
+// PryOnce is like Pry but only opens the REPL the first time it's reached.
+func PryOnce() {
+}
+
+var onceKeys = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+// Once reports whether it's the first time it has been called with key.
+// Generated code uses it for PryOnce, keyed by the file and line of the call.
+func Once(key string) bool {
+	onceKeys.Lock()
+	defer onceKeys.Unlock()
+	if onceKeys.seen[key] {
+		return false
+	}
+	onceKeys.seen[key] = true
+	return true
+}
+
+// PryWithTimeout is like Pry but continues the program if there's no input
+// for d. Zero or less waits forever.
+func PryWithTimeout(d time.Duration) {
+}
 
+// Apply drops into a pry shell in the location required. If stdin isn't a
+// terminal, such as in CI, it logs the scope and returns immediately. It does
+// nothing when built with -tags prynoop and returns after logging a line when
+// breakpoints are disabled with SetEnabled or PRY_DISABLED. Only one
+// breakpoint has the terminal at a time; those reached by other goroutines
+// meanwhile wait for their turn unless WithContinueIfBusy is given.
+func Apply(scope *Scope, opts ...Option) {
+	if !buildEnabled {
+		return
+	}
 	_, filePathRaw, lineNum, _ := runtime.Caller(1)
+	if skipped(filePathRaw, lineNum) {
+		return
+	}
 	filePath := filepath.Dir(filePathRaw) + "/." + filepath.Base(filePathRaw) + "pry"
 
-	if err := apply(scope, out, tty, filePath, filePathRaw, lineNum); err != nil {
+	config := newConfig(opts...)
+	if len(config.ListenAddr) > 0 {
+		// A remote session failing, e.g. because the address is in use,
+		// shouldn't stop the program.
+		if err := listenAndServe(scope, config, filePath, filePathRaw, lineNum); err != nil {
+			log.Printf("pry: %s:%d: %+v", filePathRaw, lineNum, err)
+		}
+		return
+	}
+	if !interactive() {
+		log.Printf("pry: %s:%d: stdin isn't a terminal, continuing\n%s",
+			filePathRaw, lineNum, formatVars(scope.bindings(), "", "", config, NoColorTheme))
+		return
+	}
+
+	// Breakpoints reached by other goroutines wait for this one to end.
+	if !config.queue.acquire(os.Stdout, filePathRaw, lineNum, config.ContinueIfBusy) {
+		return
+	}
+	defer config.queue.release()
+	defer lockTerminal()()
+
+	out, tty := openTTY()
+	defer tty.Close()
+	if !isTerminal(out) {
+		config.Theme = NoColorTheme
+		config.PagerThreshold = -1
+	}
+	config.paste = terminalPasteMode(os.Getenv("TERM"))
+	repl := &REPL{Out: out, Scope: scope, File: filePathRaw, Line: lineNum, tty: tty}
+	if err := repl.run(context.Background(), config); err != nil {
 		log.Fatalf("%+v", err)
 	}
 }
 
+// resultVar is bound to the result of the last evaluation.
+const resultVar = "_"
+
 type genericTTY interface {
-	ReadRune() (rune, error)
+	// ReadRune reads a key, like io.RuneReader.
+	ReadRune() (r rune, size int, err error)
 	Size() (int, int, error)
 	Close() error
 }
 
+// unwrapTTY returns the TTY the wrappers of the session around tty read
+// from, such as the terminal.
+func unwrapTTY(tty genericTTY) genericTTY {
+	for {
+		switch t := tty.(type) {
+		case *contextTTY:
+			tty = t.genericTTY
+		case *timeoutTTY:
+			tty = t.genericTTY
+		case *pasteTTY:
+			tty = t.genericTTY
+		default:
+			return tty
+		}
+	}
+}
+
 func apply(
 	scope *Scope,
+	config *Config,
 	out io.Writer,
 	tty genericTTY,
 	filePath, filePathRaw string,
@@ -46,216 +151,464 @@ func apply(
 	if scope.Files == nil {
 		scope.Files = map[string]*ast.File{}
 	}
-
-	if err := scope.ConfigureTypes(filePath, lineNum); err != nil {
-		return err
+	for _, h := range config.Hooks {
+		defer scope.AddHooks(h)()
+	}
+	if config.Limits != (Limits{}) {
+		defer scope.pushLimits(config.Limits)()
+	}
+	if !config.Policy.isZero() {
+		defer scope.pushPolicy(config.Policy)()
 	}
 
-	displayFilePosition(out, filePathRaw, filePath, lineNum)
+	// Sessions without a file, such as those opened by a signal, skip type
+	// checking against the source.
+	if len(filePath) > 0 {
+		if err := scope.ConfigureTypes(filePath, lineNum); err != nil {
+			return err
+		}
+	} else {
+		scope.fset = token.NewFileSet()
+	}
+	// Only breakpoints have a position; a REPL without a file starts with
+	// the prompt.
+	goroutine := goroutineID()
+	var pos *position
+	if len(filePathRaw) > 0 {
+		pos = newPosition(filePath, filePathRaw, lineNum)
+		pos.show(out, config)
+	}
 
-	history, err := NewHistory()
+	history, err := openHistory(config)
 	if err != nil {
-		fmt.Errorf("Failed to initiliaze history %+v", err)
+		return errors.Wrap(err, "failed to initialize history")
 	}
 	if err := history.Load(); err != nil {
-		fmt.Errorf("Failed to load the history %+v", err)
+		fmt.Fprintf(out, "Failed to load the history: %+v\n", err)
 	}
 
-	currentPos := history.Len()
+	sess := newSession(scope)
+	// The transcript is written in full even if the session panics.
+	defer func() {
+		if err := sess.stopRecording(); err != nil {
+			printError(out, config.Theme, err)
+		}
+	}()
+	if config.Timeout > 0 {
+		timed := newTimeoutTTY(tty, config.Timeout)
+		defer timed.Stop()
+		tty = timed
+	}
+	if config.LineEditor == nil && !config.lineInput && config.paste == pasteTiming {
+		// Everything reading keys goes through it, so the keys it reads
+		// ahead aren't lost.
+		pasted := newPasteTTY(tty)
+		defer pasted.Stop()
+		tty = pasted
+	}
 
-	line := ""
-	count := history.Len()
-	index := 0
-	r := rune(0)
-	for {
-		prompt := fmt.Sprintf("[%d] go-pry> ", currentPos)
-		fmt.Fprintf(out, "\r\033[K%s%s \033[0J\033[%dD", prompt, Highlight(line), len(line)-index+1)
+	editor := config.LineEditor
+	if editor == nil {
+		editor = defaultEditor(config, scope, out, tty)
+		defer editor.Close()
+	}
+	for _, record := range history.Records {
+		editor.AddHistory(record)
+	}
+	editor.SetCompleter(scopeCompleter(scope))
+	// Output is recorded, but not the editor's.
+	out = recordedWriter{out, sess}
+	if len(config.RecordFile) > 0 {
+		if err := sess.record(config.RecordFile, config.RecordTimestamps); err != nil {
+			printError(out, config.Theme, err)
+		}
+	}
+	// loading is set while the rc files run.
+	loading := false
+	addHistory := func(input string) {
+		if loading {
+			return
+		}
+		// :set can change the rules at any time.
+		rules := historyRulesOf(config)
+		history.setRules(rules)
+		replacer, replace := editor.(historyReplacer)
+		if !replace && rules.keeps(history.Records, input) {
+			editor.AddHistory(input)
+		}
+		if err := history.Append(input); err != nil {
+			printError(out, config.Theme, err)
+		}
+		if replace {
+			replacer.setHistory(history.Records)
+		}
+	}
 
-		promptWidth := len(prompt) + index
-		displaySuggestions(scope, out, tty, line, index, promptWidth)
+	// pending holds the previous lines of incomplete multi-line input.
+	pending := ""
+	// handle runs line, or adds it to the pending input if it doesn't
+	// complete it. It returns errExit once the session should end.
+	handle := func(line string) error {
+		input := pending + line
+		if len(input) == 0 {
+			return nil
+		}
+		// The history has the input as it was typed and the session what
+		// it expanded to.
+		source, aliasErr := expandAliases(config.Aliases, input)
+		if len(pending) == 0 && aliasErr == nil {
+			env := &commandEnv{scope: scope, out: out, tty: tty, config: config, session: sess, history: history, position: pos}
+			isCommand, err := runCommand(env, source)
+			if len(env.rerun) > 0 {
+				input = env.rerun
+				if source, aliasErr = expandAliases(config.Aliases, input); aliasErr == nil {
+					fmt.Fprintln(out, config.Theme.Highlight(input, scope))
+					isCommand, err = runCommand(env, source)
+				}
+			}
+			if err == errExit {
+				return errExit
+			} else if err != nil {
+				printError(out, config.Theme, err)
+			}
+			if isCommand {
+				sess.add(history.Len(), source, true, err)
+				addHistory(input)
+				return nil
+			}
+		}
+		if needsContinuation(input) {
+			pending = input + "\n"
+			return nil
+		}
+		pending = ""
+		if aliasErr != nil {
+			printError(out, config.Theme, aliasErr)
+			sess.add(history.Len(), input, false, aliasErr)
+			sess.evaluated(nil, aliasErr, config.UndoLevels)
+			addHistory(input)
+			return nil
+		}
 
-		bPrev := r
+		var undo *checkpoint
+		if config.UndoLevels > 0 {
+			undo = takeCheckpoint(scope)
+			undo.input = input
+		}
+		res, err := interpret(scope, source)
+		if undo != nil {
+			undo.nativeCalls = res.NativeCalls
+		}
+		for _, w := range res.Warnings {
+			fmt.Fprintln(out, config.Theme.paint("Warning: "+w, config.Theme.Warning))
+		}
+		if errors.Is(err, ErrInterrupted) {
+			fmt.Fprintln(out, "interrupted")
+		} else if err != nil {
+			printError(out, config.Theme, err, res.Value)
+			var rErr *RuntimeError
+			if errors.As(err, &rErr) {
+				fmt.Fprintln(out, "  "+rErr.Traceback())
+			}
+		} else if res.Kind == ResultExpression {
+			// Declarations and statements, such as calls to functions
+			// without results, have nothing to show.
+			if res.Value != nil {
+				scope.Set(resultVar, res.Value)
+			}
+			printResult(config, out, tty, res)
+			if res.ReturnedError != nil {
+				fmt.Fprintln(out, config.Theme.paint("Returned error: "+res.ReturnedError.Error(), config.Theme.Error))
+			}
+		}
+		sess.add(history.Len(), source, false, err)
+		sess.evaluated(undo, err, config.UndoLevels)
+		addHistory(input)
+		return nil
+	}
 
-		r = 0
-		for r == 0 {
-			var err error
-			r, err = tty.ReadRune()
+	if !config.NoRC {
+		// The rc files run like typed input, except they aren't added to
+		// the history.
+		loading = true
+		for _, path := range rcFiles(config) {
+			lines, err := readRC(path)
 			if err != nil {
-				return err
+				printError(out, config.Theme, err)
 			}
-		}
-		switch r {
-		default:
-			if bPrev == 27 && r == 91 {
-				continue
-			} else if bPrev == 91 {
-				switch r {
-				case 66: // Down
-					currentPos++
-					if history.Len() < currentPos {
-						currentPos = history.Len()
-					}
-					if history.Len() == currentPos {
-						line = ""
-					} else {
-						line = history.Records[currentPos]
-					}
-					index = len(line)
-				case 65: // Up
-					currentPos--
-					if currentPos < 0 {
-						currentPos = 0
-					}
-					if history.Len() > 0 {
-						line = history.Records[currentPos]
-					}
-					index = len(line)
-				case 67: // Right
-					index++
-					if index > len(line) {
-						index = len(line)
-					}
-				case 68: // Left
-					index--
-					if index < 0 {
-						index = 0
-					}
+			// start is the line the input being run starts on.
+			start := 0
+			for i, line := range lines {
+				if len(pending) == 0 {
+					start = i + 1
 				}
-				continue
-			} else if bPrev == 51 && r == 126 { // DELETE
-				if len(line) > 0 && index < len(line) {
-					line = line[:index] + line[index+1:]
+				entries := len(sess.entries)
+				if err := handle(line); err == errExit {
+					return nil
 				}
-				if index > len(line) {
-					index = len(line)
+				if n := len(sess.entries); n > entries && sess.entries[n-1].err != nil {
+					fmt.Fprintf(out, "  at %s:%d\n", path, start)
 				}
-				continue
-			}
-			line = line[:index] + string(r) + line[index:]
-			index++
-		case 127, '\b': // Backspace
-			if len(line) > 0 && index > 0 {
-				line = line[:index-1] + line[index:]
-				index--
 			}
-			if index > len(line) {
-				index = len(line)
+			if len(pending) > 0 {
+				printError(out, config.Theme, errors.Errorf("%s:%d: the input isn't finished", path, start))
+				pending = ""
 			}
-		case 27: // ? This happens on key press
-		case 9: //TAB
-		case 10, 13: //ENTER
-			fmt.Fprintln(out, "\033[100000C\033[0J")
-			if len(line) == 0 {
-				continue
-			}
-			if line == "continue" || line == "exit" {
-				return nil
-			}
-			resp, err := scope.InterpretString(line)
-			if err != nil {
-				fmt.Fprintln(out, "Error: ", err, resp)
-			} else {
-				respStr := Highlight(fmt.Sprintf("%#v", resp))
-				fmt.Fprintf(out, "=> %s\n", respStr)
+		}
+		loading = false
+	}
+
+	for {
+		info := PromptInfo{
+			Counter:   history.Len(),
+			File:      filePathRaw,
+			Line:      lineNum,
+			Goroutine: goroutine,
+			ScopeSize: len(scope.Keys()),
+			BlockLine: blockLine(pending),
+		}
+		prompt := config.Prompt(info)
+		if len(pending) > 0 {
+			prompt = config.ContinuationPrompt(info)
+			if config.LineNumbers {
+				prompt = numberLine(prompt, info.BlockLine)
 			}
-			history.Add(line)
-			err = history.Save()
-			if err != nil {
-				fmt.Fprintln(out, "Error: ", err)
+		}
+		if indenter, ok := editor.(autoIndenter); ok {
+			indenter.indentNext(indentDepth(pending))
+		}
+		prompt = config.Theme.paint(prompt, config.Theme.Prompt)
+		if t := sess.transcript; t != nil {
+			if warning := t.warning(); len(warning) > 0 {
+				fmt.Fprintln(out, config.Theme.paint("Warning: "+warning, config.Theme.Warning))
 			}
+		}
+		line, err := editor.ReadLine(prompt)
+		switch {
+		case err == errTimeout:
+			fmt.Fprintf(out, "\nNo input for %s, continuing.\n", config.Timeout)
+			fmt.Fprint(out, formatVars(scope.bindings(), "", "", config, config.Theme))
+			return nil
+		case err == ErrLineAborted:
+			pending = ""
+			continue
+		case err == ErrContinue:
+			return nil
+		case err != nil:
+			return err
+		}
 
-			count++
-			currentPos = count
-			line = ""
-			index = 0
-		case 4: // Ctrl-D
-			fmt.Fprintln(out)
+		if t := sess.transcript; t != nil {
+			t.input(prompt, line)
+		}
+		if err := handle(line); err == errExit {
 			return nil
 		}
 	}
 }
 
+// defaultEditor returns the editor of sessions that weren't given one. It
+// reads the keys from tty, or lines if the session was asked to.
+func defaultEditor(config *Config, scope *Scope, out io.Writer, tty genericTTY) LineEditor {
+	if config.lineInput {
+		return newReaderEditor(tty, out)
+	}
+	e := newTerminalEditor(out, tty)
+	style := Style{Theme: config.Theme, Scope: scope}
+	e.highlight = func(line string) string {
+		highlighted, err := HighlightWith(line, style, BackendANSI)
+		if err != nil {
+			return line
+		}
+		return highlighted
+	}
+	e.suggest = scope.liveSuggestions
+	e.paste = config.paste
+	e.indent = config.Indent
+	e.mode = func() EditMode { return config.EditMode }
+	e.normalMark = config.Theme.paint("N ", config.Theme.Type)
+	return e
+}
+
+// ansiEscape matches ANSI escape sequences.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;?]*[a-zA-Z]")
+
+// visibleWidth returns the number of columns s takes up in a terminal.
+func visibleWidth(s string) int {
+	return stringWidth(ansiEscape.ReplaceAllString(s, ""))
+}
+
+// goroutineID returns the ID of the calling goroutine, or 0 if it can't be
+// determined.
+func goroutineID() int {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// The trace starts with "goroutine 1 [running]:".
+	fields := strings.Fields(string(buf))
+	if len(fields) < 2 {
+		return 0
+	}
+	id, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// interpret evaluates input, cancelling the evaluation if the user
+// interrupts it with Ctrl-C.
+func interpret(scope *Scope, input string) (*Result, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := notifyInterrupt(cancel)
+	defer stop()
+	return Eval(ctx, scope, input)
+}
+
+// printResult prints the result of an expression, through the pager if it's
+// long. It's printed while it's rendered, so the start of huge results shows
+// up at once, and Ctrl-C stops it.
+func printResult(config *Config, out io.Writer, tty genericTTY, res *Result) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stop := notifyInterrupt(cancel)
+	defer stop()
+
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		io.WriteString(w, "=> ")
+		err := writeResultLine(w, res, config, func() bool { return ctx.Err() != nil })
+		io.WriteString(w, "\n")
+		w.Close()
+		done <- err
+	}()
+	if err := pageStream(config, out, tty, r); err != nil {
+		printError(out, config.Theme, err)
+	}
+	// Closing the pager early stops the rendering.
+	r.Close()
+	switch err := <-done; {
+	case errors.Is(err, ErrInterrupted):
+		fmt.Fprintln(out, "interrupted")
+	case errors.Is(err, io.ErrClosedPipe):
+	case err != nil:
+		printError(out, config.Theme, err)
+	}
+}
+
+// writeResultLine writes the value of res followed by its type, like
+// 1 (int64), or the values of a call with several results each followed by
+// theirs.
+func writeResultLine(w io.Writer, res *Result, config *Config, interrupted func() bool) error {
+	values, types := []interface{}{res.Value}, []reflect.Type{res.Type}
+	if len(res.Types) > 0 {
+		values, types = res.Value.([]interface{}), res.Types
+	}
+	for i, v := range values {
+		if i > 0 {
+			io.WriteString(w, ", ")
+		}
+		hw := &highlightWriter{w: w, theme: config.Theme}
+		err := writeResult(hw, v, config, true, interrupted)
+		hw.Close()
+		if err != nil {
+			return err
+		}
+		if typ := config.resultType(v, types[i]); len(typ) > 0 {
+			io.WriteString(w, " "+config.Theme.paint("("+typ+")", config.Theme.Type))
+		}
+	}
+	return nil
+}
+
+// resultType returns the type shown after v, a result of the static type
+// static, or "" if it's left out. Interfaces holding a value of another type
+// show both, like *os.File, declared io.Reader.
+func (c *Config) resultType(v interface{}, static reflect.Type) string {
+	dynamic := reflect.TypeOf(v)
+	if static == nil {
+		static = dynamic
+	}
+	switch {
+	case static == nil:
+		// Untyped nil has no type to show.
+		return ""
+	case static.Kind() == reflect.Interface && dynamic != nil:
+		return dynamic.String() + ", declared " + static.String()
+	case obviousType(static) && !c.ShowObviousTypes:
+		return ""
+	}
+	return static.String()
+}
+
+// printError prints an error message made of a, colored with theme.
+func printError(out io.Writer, theme Theme, a ...interface{}) {
+	msg := fmt.Sprintln(append([]interface{}{"Error: "}, a...)...)
+	fmt.Fprintln(out, theme.paint(strings.TrimSuffix(msg, "\n"), theme.Error))
+}
+
+// isDevNull returns whether f is the null device, which is a character
+// device but not a terminal. go test runs tests with it as stdin.
+func isDevNull(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err == nil && os.SameFile(info, null)
+}
+
+// isTerminal returns whether out is a terminal. Writers that aren't files,
+// such as the browser terminal, are assumed to be terminals.
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return true
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 func displayFilePosition(
-	out io.Writer, filePathRaw, filePath string, lineNum int,
+	out io.Writer, theme Theme, filePathRaw, filePath string, lineNum, contextLines int,
 ) {
 	fmt.Fprintf(out, "\nFrom %s @ line %d :\n\n", filePathRaw, lineNum)
 	file, err := readFile(filePath)
+	if err != nil && filePath != filePathRaw {
+		// The file wasn't instrumented by go-pry.
+		file, err = readFile(filePathRaw)
+	}
 	if err != nil {
-		fmt.Fprintln(out, err)
+		fmt.Fprintf(out, "Source unavailable: %v\n\n", err)
+		return
 	}
 	lines := strings.Split((string)(file), "\n")
 	lineNum--
-	start := lineNum - 5
+	start := lineNum - contextLines
 	if start < 0 {
 		start = 0
 	}
-	end := lineNum + 6
+	end := lineNum + contextLines + 1
 	if end > len(lines) {
 		end = len(lines)
 	}
-	maxLen := len(fmt.Sprint(end))
-	for i := start; i < end; i++ {
-		caret := "  "
-		if i == lineNum {
-			caret = "=>"
-		}
-		numStr := fmt.Sprint(i + 1)
-		if len(numStr) < maxLen {
-			numStr = " " + numStr
-		}
-		num := ansi.Color(numStr, "blue+b")
-		highlightedLine := Highlight(strings.Replace(lines[i], "\t", "  ", -1))
-		fmt.Fprintf(out, " %s %s: %s\n", caret, num, highlightedLine)
+	if start > end {
+		start = end
+	}
+	var shown []string
+	for _, line := range lines[start:end] {
+		shown = append(shown, strings.Replace(line, "\t", "  ", -1))
 	}
+	fmt.Fprint(out, numberedLines(theme, shown, start+1, lineNum+1))
 	fmt.Fprintln(out)
 }
 
-// displaySuggestions renders the live autocomplete from GoCode.
-func displaySuggestions(
-	scope *Scope,
-	out io.Writer,
-	tty genericTTY,
-	line string,
-	index, promptWidth int,
-) {
-	var err error
-	var suggestions []string
+// liveSuggestions returns the suggestions shown below the line as it's
+// typed, from GoCode or, in the browser, from the scope.
+func (scope *Scope) liveSuggestions(line string, index int) ([]string, error) {
 	if runtime.GOOS == "js" {
-		suggestions, err = scope.SuggestionsPry(line, index)
-	} else {
-		suggestions, err = scope.SuggestionsGoCode(line, index)
-	}
-	if err != nil {
-		suggestions = []string{"ERR", err.Error()}
-	}
-
-	maxLength := 0
-	if len(suggestions) > 10 {
-		suggestions = suggestions[:10]
-	}
-	for _, term := range suggestions {
-		if len(term) > maxLength {
-			maxLength = len(term)
-		}
-	}
-	termWidth, _, _ := tty.Size()
-	for _, term := range suggestions {
-		paddedTerm := term
-		for len(paddedTerm) < maxLength {
-			paddedTerm += " "
-		}
-		var leftPadding string
-		for i := 0; i < promptWidth; i++ {
-			leftPadding += " "
-		}
-		if promptWidth > termWidth {
-			return
-		} else if len(paddedTerm)+promptWidth > termWidth {
-			paddedTerm = paddedTerm[:termWidth-promptWidth]
-		}
-		fmt.Fprintf(out, "\n%s%s\033[%dD", leftPadding, ansi.Color(paddedTerm, "white+b:magenta"), len(paddedTerm))
-	}
-	if len(suggestions) > 0 {
-		fmt.Fprintf(out, "\033[%dA", len(suggestions))
+		return scope.SuggestionsPry(line, index)
 	}
+	return scope.SuggestionsGoCode(line, index)
 }
@@ -1,14 +1,18 @@
 package pry
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/cenkalti/backoff"
 	"github.com/d4l3k/go-pry/pry/safebuffer"
@@ -34,6 +38,25 @@ func TestCLIBasicStatement(t *testing.T) {
 	})
 }
 
+func TestCLIProgram(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte("a := 1; b := a + 1 // comment\nfor i := 0; i < 3; i++ {\n\tb += i\n}\n"))
+
+	succeedsSoon(t, func() error {
+		out, _ := env.Get("b")
+		want := 5
+		if !reflect.DeepEqual(out, want) {
+			return errors.Errorf(
+				"expected b = %d; got %v\nOutput:\n%s\n", want, out, env.Output())
+		}
+		return nil
+	})
+}
+
 func TestCLIHistory(t *testing.T) {
 	t.Parallel()
 
@@ -76,6 +99,246 @@ func TestCLIEditingArrows(t *testing.T) {
 	})
 }
 
+func TestCLIReverseSearch(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte("var a int\na = 10\na = 20\n"))
+	// Ctrl-R "= 1" enter
+	env.Write([]byte("\x12= 1\n"))
+	env.Write([]byte("a = a + 1\n"))
+
+	succeedsSoon(t, func() error {
+		out, _ := env.Get("a")
+		want := 11
+		if !reflect.DeepEqual(out, want) {
+			return errors.Errorf(
+				"expected a = %d; got %d\nOutput:\n%s\n", want, out, env.Output())
+		}
+		return nil
+	})
+}
+
+func TestCLITabComplete(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte("var someLongName int\n"))
+	env.Write([]byte("someL\t = 10\n"))
+
+	succeedsSoon(t, func() error {
+		out, _ := env.Get("someLongName")
+		want := 10
+		if !reflect.DeepEqual(out, want) {
+			return errors.Errorf(
+				"expected someLongName = %d; got %d\nOutput:\n%s\n", want, out, env.Output())
+		}
+		return nil
+	})
+}
+
+func TestCLIMultiline(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte("a := 0\n"))
+	env.Write([]byte("for i := 0; i < 4; i++ {\n"))
+	env.Write([]byte("a += i\n"))
+	env.Write([]byte("}\n"))
+
+	succeedsSoon(t, func() error {
+		out, _ := env.Get("a")
+		want := 6
+		if !reflect.DeepEqual(out, want) {
+			return errors.Errorf(
+				"expected a = %d; got %d\nOutput:\n%s\n", want, out, env.Output())
+		}
+		return nil
+	})
+}
+
+func TestCLIMultilineAbort(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte("a := 1\n"))
+	env.Write([]byte("a = 2 +\n"))
+	// Ctrl-C
+	env.Write([]byte("\x03"))
+	env.Write([]byte("b := a\n"))
+
+	succeedsSoon(t, func() error {
+		out, _ := env.Get("b")
+		want := 1
+		if !reflect.DeepEqual(out, want) {
+			return errors.Errorf(
+				"expected b = %d; got %d\nOutput:\n%s\n", want, out, env.Output())
+		}
+		return nil
+	})
+}
+
+func TestCLIPrompt(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t,
+		WithPrompt(func(info PromptInfo) string {
+			return fmt.Sprintf("[%d] pry(%s:%d)> ", info.Counter, filepath.Base(info.File), info.Line)
+		}),
+		WithContinuationPrompt(func(info PromptInfo) string {
+			return "\033[1m...\033[0m "
+		}),
+	)
+	defer env.Close()
+
+	env.Write([]byte("a := 1\n"))
+	env.Write([]byte("f(\n"))
+
+	succeedsSoon(t, func() error {
+		out := env.Output()
+		for _, want := range []string{"[1] pry(main.go:2)> ", "\033[1m...\033[0m "} {
+			if !strings.Contains(out, want) {
+				return errors.Errorf("expected output to contain %q\nOutput:\n%s\n", want, out)
+			}
+		}
+		return nil
+	})
+	env.Write([]byte("\x03"))
+}
+
+func TestCLIPager(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t, WithPagerThreshold(1), WithPager(""), WithInspectMaxString(0))
+	defer env.Close()
+
+	// The result is wider than the test terminal so it wraps onto two rows.
+	// Strings are shown in full, so it's taller than the screen.
+	env.Write([]byte("s := \"x\"\n"))
+	env.Write([]byte("for i := 0; i < 14; i++ { s += s }\n"))
+	env.Write([]byte("s\n"))
+	env.Write([]byte("q"))
+	env.Write([]byte("b := len(s)\n"))
+
+	succeedsSoon(t, func() error {
+		out, _ := env.Get("b")
+		want := 1 << 14
+		if !reflect.DeepEqual(out, want) {
+			return errors.Errorf(
+				"expected b = %d; got %d\nOutput:\n%s\n", want, out, env.Output())
+		}
+		if !strings.Contains(env.Output(), "(END)") {
+			return errors.Errorf("expected the result to be paged\nOutput:\n%s\n", env.Output())
+		}
+		return nil
+	})
+}
+
+func TestCLIHelp(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte(":help\n"))
+
+	succeedsSoon(t, func() error {
+		if !strings.Contains(env.Output(), "Session commands:") {
+			return errors.Errorf("expected help to be printed\nOutput:\n%s\n", env.Output())
+		}
+		return nil
+	})
+}
+
+func TestCLIResultVar(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t)
+	defer env.Close()
+
+	env.Write([]byte("1 + 2\n"))
+	env.Write([]byte("_ * 2\n"))
+
+	succeedsSoon(t, func() error {
+		if !strings.Contains(ansiEscape.ReplaceAllString(env.Output(), ""), "=> 6\n") {
+			return errors.Errorf("expected the last result to be bound to _\nOutput:\n%s\n", env.Output())
+		}
+		return nil
+	})
+}
+
+func TestCLIWriteBack(t *testing.T) {
+	t.Parallel()
+
+	retries := 3
+	env := testPryApply(t)
+	// The session has ended, so nothing reads the input Close writes.
+	defer func() {
+		env.testTTY.Close()
+		os.RemoveAll(env.dir)
+	}()
+	env.Scope.Lock()
+	env.Scope.Vals["retries"] = &retries
+	env.Scope.Unlock()
+
+	env.Write([]byte("retries = 5\ncontinue\n"))
+	select {
+	case <-env.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the session didn't end\nOutput:\n%s\n", env.Output())
+	}
+	if retries != 5 {
+		t.Errorf("Expected %#v got %#v.\nOutput:\n%s\n", 5, retries, env.Output())
+	}
+}
+
+func TestOnce(t *testing.T) {
+	t.Parallel()
+
+	got := []bool{Once("once_test.go:1"), Once("once_test.go:1"), Once("once_test.go:2")}
+	want := []bool{true, false, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %#v got %#v.", want, got)
+	}
+}
+
+func TestVisibleWidth(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]int{
+		"[1] go-pry> ":               12,
+		"\033[1;32mpry\033[0m> ":     5,
+		"\033[1m⏎\033[0m":            1,
+		DefaultTheme.Highlight(`a := "foo"`, nil): 10,
+	}
+	for s, want := range cases {
+		if out := visibleWidth(s); out != want {
+			t.Errorf("visibleWidth(%q) = %d; expected %d", s, out, want)
+		}
+	}
+}
+
+func TestGoroutineID(t *testing.T) {
+	t.Parallel()
+
+	main := goroutineID()
+	other := make(chan int)
+	go func() {
+		other <- goroutineID()
+	}()
+	if id := <-other; main <= 0 || id <= 0 || id == main {
+		t.Errorf("expected distinct goroutine IDs; got %d and %d", main, id)
+	}
+}
+
 type testTTY struct {
 	*io.PipeReader
 	*io.PipeWriter
@@ -86,10 +349,21 @@ func makeTestTTY() *testTTY {
 	return &testTTY{r, w}
 }
 
-func (t *testTTY) ReadRune() (rune, error) {
-	buf := make([]byte, 1)
-	_, err := t.PipeReader.Read(buf)
-	return rune(buf[0]), err
+// ReadRune reads the bytes of a UTF-8 encoded rune, one at a time as a
+// terminal sends them.
+func (t *testTTY) ReadRune() (rune, int, error) {
+	var buf []byte
+	for {
+		b := make([]byte, 1)
+		if _, err := t.PipeReader.Read(b); err != nil {
+			return 0, 0, err
+		}
+		buf = append(buf, b[0])
+		if utf8.FullRune(buf) {
+			r, size := utf8.DecodeRune(buf)
+			return r, size, nil
+		}
+	}
 }
 
 func (t *testTTY) Size() (int, int, error) {
@@ -106,20 +380,46 @@ type testPryEnv struct {
 	*testTTY
 	*Scope
 	dir, file string
+	// done is closed when the session ends.
+	done chan struct{}
 }
 
-func testPryApply(t testing.TB) *testPryEnv {
+func testPryApply(t testing.TB, opts ...Option) *testPryEnv {
 	var stdout safebuffer.Buffer
 	tty := makeTestTTY()
 	scope := NewScope()
 
+	dir, filePath := writeTestFile(t)
+	lineNum := 2
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		config := newConfig(append([]Option{WithHistoryFile("")}, opts...)...)
+		if err := apply(scope, config, &stdout, tty, filePath, filePath, lineNum); err != nil {
+			log.Fatalf("%+v", err)
+		}
+	}()
+
+	return &testPryEnv{
+		stdout:  &stdout,
+		testTTY: tty,
+		Scope:   scope,
+		dir:     dir,
+		file:    filePath,
+		done:    done,
+	}
+}
+
+// writeTestFile writes a program with a breakpoint to a new directory.
+func writeTestFile(t testing.TB) (dir, filePath string) {
 	wd, err := os.Getwd()
 	if err != nil {
 		t.Fatal(err)
 	}
 	log.Printf("cwd %+v", wd)
 
-	dir, err := ioutil.TempDir(wd, "go-pry-test")
+	dir, err = ioutil.TempDir(wd, "go-pry-test")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -145,22 +445,7 @@ func main() {
 	}
 	file.Close()
 
-	filePath := file.Name()
-	lineNum := 2
-
-	go func() {
-		if err := apply(scope, &stdout, tty, filePath, filePath, lineNum); err != nil {
-			log.Fatalf("%+v", err)
-		}
-	}()
-
-	return &testPryEnv{
-		stdout:  &stdout,
-		testTTY: tty,
-		Scope:   scope,
-		dir:     dir,
-		file:    filePath,
-	}
+	return dir, file.Name()
 }
 
 func (env *testPryEnv) Output() string {
@@ -49,6 +49,181 @@ func DeAssign(tok token.Token) token.Token {
 
 // ComputeBinaryOp executes the corresponding binary operation (+, -, etc) on two interfaces.
 func ComputeBinaryOp(xI, yI interface{}, op token.Token) (interface{}, error) {
+	// The most common operands, ints, int64s, float64s, strings and bools of
+	// the same type, skip the general path's conversions. What they leave to
+	// computeBinaryOp gives the same results, only slower.
+	switch x := xI.(type) {
+	case int:
+		y, same := yI.(int)
+		if !same {
+			break
+		}
+		switch op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return x / y, nil
+		case token.REM:
+			if y == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return x % y, nil
+		case token.AND:
+			return x & y, nil
+		case token.OR:
+			return x | y, nil
+		case token.XOR:
+			return x ^ y, nil
+		case token.AND_NOT:
+			return x &^ y, nil
+		case token.SHL:
+			return x << uint64(y), nil
+		case token.SHR:
+			return x >> uint64(y), nil
+		case token.LSS:
+			return x < y, nil
+		case token.GTR:
+			return x > y, nil
+		case token.LEQ:
+			return x <= y, nil
+		case token.GEQ:
+			return x >= y, nil
+		case token.EQL:
+			return x == y, nil
+		case token.NEQ:
+			return x != y, nil
+		}
+	case int64:
+		y, same := yI.(int64)
+		if !same {
+			break
+		}
+		switch op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return x / y, nil
+		case token.REM:
+			if y == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return x % y, nil
+		case token.AND:
+			return x & y, nil
+		case token.OR:
+			return x | y, nil
+		case token.XOR:
+			return x ^ y, nil
+		case token.AND_NOT:
+			return x &^ y, nil
+		case token.SHL:
+			return x << uint64(y), nil
+		case token.SHR:
+			return x >> uint64(y), nil
+		case token.LSS:
+			return x < y, nil
+		case token.GTR:
+			return x > y, nil
+		case token.LEQ:
+			return x <= y, nil
+		case token.GEQ:
+			return x >= y, nil
+		case token.EQL:
+			return x == y, nil
+		case token.NEQ:
+			return x != y, nil
+		}
+	case float64:
+		y, same := yI.(float64)
+		if !same {
+			break
+		}
+		switch op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return x / y, nil
+		case token.LSS:
+			return x < y, nil
+		case token.GTR:
+			return x > y, nil
+		case token.LEQ:
+			return x <= y, nil
+		case token.GEQ:
+			return x >= y, nil
+		case token.EQL:
+			return x == y, nil
+		case token.NEQ:
+			return x != y, nil
+		}
+	case string:
+		y, same := yI.(string)
+		if !same {
+			break
+		}
+		// Strings can't be ordered yet.
+		switch op {
+		case token.ADD:
+			return x + y, nil
+		case token.EQL:
+			return x == y, nil
+		case token.NEQ:
+			return x != y, nil
+		}
+	case bool:
+		y, same := yI.(bool)
+		if !same {
+			break
+		}
+		switch op {
+		case token.LAND:
+			return x && y, nil
+		case token.LOR:
+			return x || y, nil
+		case token.EQL:
+			return x == y, nil
+		case token.NEQ:
+			return x != y, nil
+		}
+	}
+
+	return computeBinaryOp(xI, yI, op)
+}
+
+// basicTypes are the predeclared types that aren't interfaces, by kind.
+var basicTypes = func() map[reflect.Kind]reflect.Type {
+	types := map[reflect.Kind]reflect.Type{}
+	for _, t := range builtinTypes {
+		if t.Kind() != reflect.Interface {
+			types[t.Kind()] = t
+		}
+	}
+	return types
+}()
+
+// computeBinaryOp is ComputeBinaryOp for any operands.
+func computeBinaryOp(xI, yI interface{}, op token.Token) (interface{}, error) {
 	typeX := reflect.TypeOf(xI)
 	typeY := reflect.TypeOf(yI)
 	if typeX == typeY {
@@ -720,16 +895,108 @@ func ComputeBinaryOp(xI, yI interface{}, op token.Token) (interface{}, error) {
 			}
 		}
 	}
+	// Named types, such as time.Duration, compute as their underlying types
+	// and keep their type.
+	if typeX != nil && typeX.PkgPath() != "" && (typeX == typeY || op == token.SHL || op == token.SHR) {
+		if under, ok := basicTypes[typeX.Kind()]; ok {
+			x := reflect.ValueOf(xI).Convert(under).Interface()
+			y := yI
+			if typeY == typeX {
+				y = reflect.ValueOf(yI).Convert(under).Interface()
+			}
+			out, err := computeBinaryOp(x, y, op)
+			if err != nil {
+				return nil, err
+			}
+			// Comparisons are bools.
+			if reflect.TypeOf(out) == under {
+				return reflect.ValueOf(out).Convert(typeX).Interface(), nil
+			}
+			return out, nil
+		}
+	}
 	// Anything
 	switch op {
 	case token.EQL:
-		return xI == yI, nil
+		return equal(xI, yI, op)
 	case token.NEQ:
-		return xI != yI, nil
+		eq, err := equal(xI, yI, op)
+		if err != nil {
+			return nil, err
+		}
+		return !eq, nil
 	}
 	return nil, fmt.Errorf("unknown operation %#v between %#v and %#v", op, xI, yI)
 }
 
+// equal returns whether xI equals yI, as == compares them. Structs are equal
+// if their fields are, arrays if their elements are, interfaces if their
+// dynamic types and values are, and pointers and channels if they point to
+// the same thing. Slices, maps and funcs can only be compared to nil; op is
+// the operator reported if they aren't.
+func equal(xI, yI interface{}, op token.Token) (eq bool, err error) {
+	if isNil, ok := comparesNil(xI, yI); ok {
+		return isNil, nil
+	}
+	for _, v := range []interface{}{xI, yI} {
+		// Interpreted funcs are funcs too.
+		if _, isFunc := v.(*Func); isFunc {
+			return false, &OperationError{Op: op, Reason: "func can only be compared to nil"}
+		}
+		if why := incomparable(reflect.TypeOf(v)); len(why) > 0 {
+			return false, &OperationError{Op: op, Reason: why}
+		}
+	}
+	defer func() {
+		// Interface fields holding incomparable values can't be compared
+		// either, which only shows when they are.
+		if r := recover(); r != nil {
+			eq, err = false, errors.New(fmt.Sprint(r))
+		}
+	}()
+	return xI == yI, nil
+}
+
+// incomparable explains why values of type t can't be compared with ==, or
+// returns "" if they can.
+func incomparable(t reflect.Type) string {
+	if t == nil || t.Comparable() {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Func:
+		return fmt.Sprintf("%s can only be compared to nil", t.Kind())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i).Type; !f.Comparable() {
+				return fmt.Sprintf("struct containing %s cannot be compared", f)
+			}
+		}
+	}
+	return fmt.Sprintf("%s cannot be compared", t)
+}
+
+// comparesNil returns whether the operand of a comparison with nil is nil, if
+// one of xI and yI is nil, as a nil pointer, map, slice, channel or func
+// equals nil.
+func comparesNil(xI, yI interface{}) (isNil, ok bool) {
+	v := xI
+	if xI == nil {
+		v = yI
+	} else if yI != nil {
+		return false, false
+	}
+	if v == nil {
+		return true, true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return rv.IsNil(), true
+	}
+	return false, false
+}
+
 // ComputeUnaryOp computes the corresponding unary (+x, -x) operation on an interface.
 func (scope *Scope) ComputeUnaryOp(xI interface{}, op token.Token) (interface{}, error) {
 	if xI == nil {
@@ -0,0 +1,90 @@
+package pry
+
+import (
+	"fmt"
+	"go/token"
+	"math"
+	"testing"
+)
+
+// binaryOps are the operators ComputeBinaryOp is called with.
+var binaryOps = []token.Token{
+	token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+	token.AND, token.OR, token.XOR, token.SHL, token.SHR, token.AND_NOT,
+	token.LAND, token.LOR,
+	token.EQL, token.LSS, token.GTR, token.NEQ, token.LEQ, token.GEQ,
+}
+
+// binaryOperands are operands for every fast path, its edge cases and
+// operands left to the general path.
+var binaryOperands = []interface{}{
+	0, 1, -1, 7, -3, 64, math.MaxInt64, math.MinInt64,
+	int64(0), int64(1), int64(-1), int64(7), int64(64), int64(math.MaxInt64), int64(math.MinInt64),
+	0.0, math.Copysign(0, -1), 1.5, -2.0, math.NaN(), math.Inf(1), math.MaxFloat64,
+	"", "a", "b",
+	true, false,
+	uint8(3), int32(-2), float32(1.5), nil,
+}
+
+// showBinaryOp runs op and describes the outcome, so the results of both
+// paths can be compared exactly, NaNs and panics included.
+func showBinaryOp(f func(xI, yI interface{}, op token.Token) (interface{}, error), x, y interface{}, op token.Token) (out string) {
+	defer func() {
+		if r := recover(); r != nil {
+			out = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+	v, err := f(x, y, op)
+	return fmt.Sprintf("%#v %T %v", v, v, err)
+}
+
+func TestComputeBinaryOpFastPath(t *testing.T) {
+	t.Parallel()
+
+	for _, x := range binaryOperands {
+		for _, y := range binaryOperands {
+			for _, op := range binaryOps {
+				want := showBinaryOp(computeBinaryOp, x, y, op)
+				if out := showBinaryOp(ComputeBinaryOp, x, y, op); out != want {
+					t.Errorf("%#v %s %#v: Expected %#v got %#v.", x, op, y, want, out)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkComputeBinaryOp(b *testing.B) {
+	cases := []struct {
+		name string
+		x, y interface{}
+		op   token.Token
+	}{
+		{"int+", 3, 4, token.ADD},
+		{"int<", 3, 4, token.LSS},
+		{"int==", 3, 4, token.EQL},
+		{"int64*", int64(3), int64(4), token.MUL},
+		{"float64/", 3.0, 4.0, token.QUO},
+		{"string+", "a", "b", token.ADD},
+		{"string==", "a", "b", token.EQL},
+		{"bool&&", true, false, token.LAND},
+	}
+	paths := []struct {
+		name string
+		f    func(xI, yI interface{}, op token.Token) (interface{}, error)
+	}{
+		{"general", computeBinaryOp},
+		{"fast", ComputeBinaryOp},
+	}
+	for _, c := range cases {
+		for _, p := range paths {
+			c, f := c, p.f
+			b.Run(c.name+"/"+p.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := f(c.x, c.y, c.op); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
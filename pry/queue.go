@@ -0,0 +1,155 @@
+package pry
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	registerCommand(&command{
+		Name:     ":queue",
+		Category: categorySession,
+		Usage:    ":queue [skip <n>... | skip all]",
+		Summary:  "List the breakpoints waiting for the terminal, or skip them.",
+		Help: "Only one breakpoint uses the terminal at a time. Others reached by " +
+			"other goroutines wait for the session to end and then open in the " +
+			"order they were reached. Skipped breakpoints continue their " +
+			"goroutine without opening.",
+		Run: runQueue,
+	})
+}
+
+// breakpointQueue makes breakpoints take turns on the terminal: one session
+// owns it at a time and the others wait in order.
+type breakpointQueue struct {
+	mu      sync.Mutex
+	busy    bool
+	waiting []*queuedBreakpoint
+}
+
+// terminalQueue is the queue of the breakpoints opening on the terminal.
+var terminalQueue = &breakpointQueue{}
+
+// queuedBreakpoint is a breakpoint waiting for the terminal.
+type queuedBreakpoint struct {
+	goroutine int
+	file      string
+	line      int
+	since     time.Time
+	// turn is closed when the breakpoint gets the terminal or is skipped.
+	turn    chan struct{}
+	skipped bool
+}
+
+// acquire waits until the breakpoint at file:line has the terminal, writing
+// a notice to out if it has to wait. It returns false if the breakpoint was
+// skipped instead, or right away if the terminal is busy and continueIfBusy
+// is set. The caller has to call release after a true return.
+func (q *breakpointQueue) acquire(out io.Writer, file string, line int, continueIfBusy bool) bool {
+	q.mu.Lock()
+	if !q.busy {
+		q.busy = true
+		q.mu.Unlock()
+		return true
+	}
+	if continueIfBusy {
+		q.mu.Unlock()
+		return false
+	}
+	b := &queuedBreakpoint{
+		goroutine: goroutineID(),
+		file:      file,
+		line:      line,
+		since:     time.Now(),
+		turn:      make(chan struct{}),
+	}
+	q.waiting = append(q.waiting, b)
+	n := len(q.waiting)
+	q.mu.Unlock()
+
+	// The terminal may be in raw mode for the active session.
+	fmt.Fprintf(out, "\r\ngoroutine %d waiting at %s:%d (%d in queue)\r\n", b.goroutine, filepath.Base(file), line, n)
+	<-b.turn
+	return !b.skipped
+}
+
+// release hands the terminal to the next breakpoint waiting, if any.
+func (q *breakpointQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+	next := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	close(next.turn)
+}
+
+// list returns the breakpoints waiting, in the order they'll open.
+func (q *breakpointQueue) list() []*queuedBreakpoint {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*queuedBreakpoint(nil), q.waiting...)
+}
+
+// skip continues the waiting breakpoints b without opening them. Those that
+// aren't waiting anymore are ignored.
+func (q *breakpointQueue) skip(bs ...*queuedBreakpoint) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, b := range bs {
+		for i, w := range q.waiting {
+			if w == b {
+				q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+				b.skipped = true
+				close(b.turn)
+				break
+			}
+		}
+	}
+}
+
+func runQueue(env *commandEnv, args []string) error {
+	q := env.config.queue
+	waiting := q.list()
+	if len(args) == 0 {
+		if len(waiting) == 0 {
+			fmt.Fprintln(env.out, "No breakpoints waiting.")
+			return nil
+		}
+		var b strings.Builder
+		for i, w := range waiting {
+			fmt.Fprintf(&b, "%d. goroutine %d at %s:%d, waiting for %s\n",
+				i+1, w.goroutine, w.file, w.line, time.Since(w.since).Round(time.Second))
+		}
+		env.show(b.String())
+		return nil
+	}
+
+	if args[0] != "skip" || len(args) == 1 {
+		return errors.New("usage: :queue [skip <n>... | skip all]")
+	}
+	var skip []*queuedBreakpoint
+	if len(args) == 2 && args[1] == "all" {
+		skip = waiting
+	} else {
+		for _, arg := range args[1:] {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 || n > len(waiting) {
+				return errors.Errorf("no waiting breakpoint %s; see :queue", arg)
+			}
+			skip = append(skip, waiting[n-1])
+		}
+	}
+	q.skip(skip...)
+	fmt.Fprintf(env.out, "Skipped %d breakpoint(s).\n", len(skip))
+	return nil
+}
@@ -0,0 +1,173 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/d4l3k/go-pry/pry/safebuffer"
+	"github.com/pkg/errors"
+)
+
+// waitForQueue waits until n breakpoints are waiting in q.
+func waitForQueue(t *testing.T, q *breakpointQueue, n int) {
+	succeedsSoon(t, func() error {
+		if got := len(q.list()); got != n {
+			return errors.Errorf("expected %d breakpoints waiting, got %d", n, got)
+		}
+		return nil
+	})
+}
+
+func TestBreakpointQueueSerializes(t *testing.T) {
+	t.Parallel()
+
+	q := &breakpointQueue{}
+	var notices safebuffer.Buffer
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	// session runs a scripted session at the breakpoint name.go:1 once it
+	// has the terminal.
+	session := func(name string, in io.Reader) error {
+		if !q.acquire(&notices, name+".go", 1, false) {
+			return errors.Errorf("%s was skipped", name)
+		}
+		defer q.release()
+		record(name + " start")
+		defer record(name + " end")
+		var out bytes.Buffer
+		repl := &REPL{In: in, Out: &out, Options: []Option{WithHistoryFile("")}}
+		if err := repl.Run(context.Background()); err != nil {
+			return err
+		}
+		if want := fmt.Sprintf("=> %q\n", name); !strings.Contains(out.String(), want) {
+			return errors.Errorf("expected %q in the output of %s:\n%s", want, name, out.String())
+		}
+		return nil
+	}
+
+	errs := make(chan error, 3)
+	r, w := io.Pipe()
+	go func() { errs <- session("a", r) }()
+	succeedsSoon(t, func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(events) == 0 {
+			return errors.New("a hasn't started")
+		}
+		return nil
+	})
+	for i, name := range []string{"b", "c"} {
+		in := strings.NewReader(fmt.Sprintf("x := %q\nx\n", name))
+		go func(name string) { errs <- session(name, in) }(name)
+		waitForQueue(t, q, i+1)
+	}
+	if want := "waiting at c.go:1 (2 in queue)"; !strings.Contains(notices.String(), want) {
+		t.Errorf("Expected %q in the notices:\n%s", want, notices.String())
+	}
+
+	if _, err := w.Write([]byte("x := \"a\"\nx\n")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	want := []string{"a start", "a end", "b start", "b end", "c start", "c end"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Expected %#v got %#v.", want, events)
+	}
+}
+
+func TestQueueCommand(t *testing.T) {
+	t.Parallel()
+
+	q := &breakpointQueue{}
+	if !q.acquire(ioutil.Discard, "main.go", 1, false) {
+		t.Fatal("Expected the first breakpoint to get the terminal")
+	}
+	results := make([]chan bool, 2)
+	for i := range results {
+		results[i] = make(chan bool, 1)
+		go func(i int) {
+			results[i] <- q.acquire(ioutil.Discard, fmt.Sprintf("worker%d.go", i+1), 88, false)
+		}(i)
+		waitForQueue(t, q, i+1)
+	}
+
+	var out bytes.Buffer
+	config := newConfig()
+	config.queue = q
+	env := &commandEnv{scope: NewScope(), out: &out, config: config}
+	if _, err := runCommand(env, ":queue"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"1. goroutine ", " at worker1.go:88, waiting for ", "2. goroutine ", " at worker2.go:88, "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output:\n%s", want, out.String())
+		}
+	}
+
+	if _, err := runCommand(env, ":queue skip 3"); err == nil {
+		t.Error("Expected an error skipping a breakpoint that isn't waiting")
+	}
+	out.Reset()
+	if _, err := runCommand(env, ":queue skip 2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-results[1]; got {
+		t.Error("Expected the skipped breakpoint to continue without the terminal")
+	}
+	if _, err := runCommand(env, ":queue skip all"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-results[0]; got {
+		t.Error("Expected the skipped breakpoint to continue without the terminal")
+	}
+	out.Reset()
+	if _, err := runCommand(env, ":queue"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "No breakpoints waiting.\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+
+	q.release()
+	if !q.acquire(ioutil.Discard, "main.go", 1, false) {
+		t.Error("Expected the terminal to be free")
+	}
+}
+
+func TestQueueContinueIfBusy(t *testing.T) {
+	t.Parallel()
+
+	q := &breakpointQueue{}
+	var notices bytes.Buffer
+	if !q.acquire(&notices, "main.go", 1, true) {
+		t.Fatal("Expected the first breakpoint to get the terminal")
+	}
+	if q.acquire(&notices, "main.go", 2, true) {
+		t.Error("Expected the breakpoint to continue while the terminal is busy")
+	}
+	if notices.Len() > 0 || len(q.list()) > 0 {
+		t.Errorf("Expected the breakpoint not to wait; notices %q", notices.String())
+	}
+	q.release()
+	if !q.acquire(&notices, "main.go", 2, true) {
+		t.Error("Expected the breakpoint to get the free terminal")
+	}
+}
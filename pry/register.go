@@ -0,0 +1,247 @@
+package pry
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// registered holds the builtins and packages the application registered for
+// every session.
+var registered = struct {
+	sync.Mutex
+	vals map[string]interface{}
+}{vals: map[string]interface{}{}}
+
+// registeredTypes holds the types registered with RegisterNamedType, by name.
+// Registrations replace the map rather than change it, so looking types up,
+// as is done for every identifier, doesn't lock.
+var registeredTypes = struct {
+	sync.Mutex
+	table atomic.Value // map[string]reflect.Type
+}{}
+
+// RegisterOption configures RegisterBuiltin and RegisterPackage.
+type RegisterOption func(*registerConfig)
+
+type registerConfig struct {
+	override bool
+}
+
+// Override lets a registration replace a builtin, including the predeclared
+// functions such as len, or a previous registration with the same name.
+func Override() RegisterOption {
+	return func(c *registerConfig) {
+		c.override = true
+	}
+}
+
+// RegisterBuiltin makes the function fn callable as name in every session,
+// like the predeclared functions. Applications use it to expose their own
+// helpers, such as reloadConfig(), without the code generator. It returns an
+// error if fn isn't a function or name is already a builtin, unless Override
+// is passed. Variables of the program and the session shadow builtins.
+func RegisterBuiltin(name string, fn interface{}, opts ...RegisterOption) error {
+	if err := validateBuiltin(fn); err != nil {
+		return errors.Wrapf(err, "registering %s", name)
+	}
+	return register(nil, name, fn, opts)
+}
+
+// RegisterPackage makes members, keyed by name, available as the package name
+// in every session, so they're referred to as name.Member. Members that are
+// reflect.Type are types and other functions and values are registered as
+// they are. It returns an error if name is already a builtin, unless
+// Override is passed.
+func RegisterPackage(name string, members map[string]interface{}, opts ...RegisterOption) error {
+	return register(nil, name, newRegisteredPackage(name, members), opts)
+}
+
+// RegisterNamedType makes t available as the type name in every session,
+// like the predeclared types, for conversions and declarations such as
+// Celsius(20) or var c Celsius. Types are resolved before any other name, so
+// it returns an error if name is already a builtin, registered or not, or a
+// type registered before, unless Override is passed. The predeclared types
+// can't be replaced.
+func RegisterNamedType(name string, t reflect.Type, opts ...RegisterOption) error {
+	var c registerConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if t == nil {
+		return errors.Errorf("registering %s: the type is nil", name)
+	}
+	if !token.IsIdentifier(name) || name == "_" {
+		return errors.Errorf("registering %s: not a valid identifier", name)
+	}
+	if _, ok := builtinTypes[name]; ok {
+		return errors.Errorf("registering %s: builtin types can't be replaced", name)
+	}
+	registeredTypes.Lock()
+	defer registeredTypes.Unlock()
+
+	old := loadRegisteredTypes()
+	if !c.override {
+		if _, ok := builtinScope[name]; ok {
+			return errors.Errorf("registering %s: it's already a builtin; pass pry.Override() to replace it", name)
+		} else if _, ok := (*Scope)(nil).registeredValue(name); ok {
+			return errors.Errorf("registering %s: it's already registered; pass pry.Override() to replace it", name)
+		} else if _, ok := old[name]; ok {
+			return errors.Errorf("registering %s: it's already registered; pass pry.Override() to replace it", name)
+		}
+	}
+	table := make(map[string]reflect.Type, len(old)+1)
+	for k, v := range old {
+		table[k] = v
+	}
+	table[name] = t
+	registeredTypes.table.Store(table)
+	return nil
+}
+
+// loadRegisteredTypes returns the types registered with RegisterNamedType.
+// The map mustn't be changed.
+func loadRegisteredTypes() map[string]reflect.Type {
+	table, _ := registeredTypes.table.Load().(map[string]reflect.Type)
+	return table
+}
+
+// RegisterBuiltin is like the function RegisterBuiltin but only makes fn
+// available in scope and its children.
+func (scope *Scope) RegisterBuiltin(name string, fn interface{}, opts ...RegisterOption) error {
+	if err := validateBuiltin(fn); err != nil {
+		return errors.Wrapf(err, "registering %s", name)
+	}
+	return register(scope, name, fn, opts)
+}
+
+// RegisterPackage is like the function RegisterPackage but only makes the
+// package available in scope and its children.
+func (scope *Scope) RegisterPackage(name string, members map[string]interface{}, opts ...RegisterOption) error {
+	return register(scope, name, newRegisteredPackage(name, members), opts)
+}
+
+// validateBuiltin returns an error if fn can't be called.
+func validateBuiltin(fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return errors.Errorf("%T isn't a function", fn)
+	}
+	if v.IsNil() {
+		return errors.New("the function is nil")
+	}
+	return nil
+}
+
+// newRegisteredPackage returns the package name made of members.
+func newRegisteredPackage(name string, members map[string]interface{}) Package {
+	pkg := Package{Name: name, Path: name, Functions: map[string]interface{}{}, Consts: map[string]interface{}{}, Types: TypeMap{}}
+	for k, v := range members {
+		switch v := v.(type) {
+		case reflect.Type:
+			pkg.Types[k] = v
+		default:
+			if reflect.ValueOf(v).Kind() == reflect.Func {
+				pkg.Functions[k] = v
+			} else {
+				pkg.Consts[k] = v
+			}
+		}
+	}
+	return pkg
+}
+
+// register binds name to v in scope or, if scope is nil, in every session.
+func register(scope *Scope, name string, v interface{}, opts []RegisterOption) error {
+	var c registerConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if !token.IsIdentifier(name) || name == "_" {
+		return errors.Errorf("registering %s: not a valid identifier", name)
+	}
+	// Type names are resolved before any other name.
+	if _, ok := builtinTypes[name]; ok {
+		return errors.Errorf("registering %s: builtin types can't be replaced", name)
+	}
+	if _, ok := namedType(name); ok && !c.override {
+		return errors.Errorf("registering %s: it's already a registered type; pass pry.Override() to replace it", name)
+	}
+	if !c.override {
+		if _, ok := builtinScope[name]; ok {
+			return errors.Errorf("registering %s: it's already a builtin; pass pry.Override() to replace it", name)
+		} else if _, ok := scope.registeredValue(name); ok {
+			return errors.Errorf("registering %s: it's already registered; pass pry.Override() to replace it", name)
+		}
+	}
+	if scope == nil {
+		registered.Lock()
+		registered.vals[name] = v
+		registered.Unlock()
+		return nil
+	}
+	scope.Lock()
+	if scope.builtins == nil {
+		scope.builtins = map[string]interface{}{}
+	}
+	scope.builtins[name] = v
+	scope.Unlock()
+	return nil
+}
+
+// registeredValue returns the builtin or package registered as name for scope
+// or for every session. scope can be nil.
+func (scope *Scope) registeredValue(name string) (interface{}, bool) {
+	for s := scope; s != nil; s = s.Parent {
+		s.Lock()
+		v, ok := s.builtins[name]
+		s.Unlock()
+		if ok {
+			return v, true
+		}
+	}
+	registered.Lock()
+	defer registered.Unlock()
+	v, ok := registered.vals[name]
+	return v, ok
+}
+
+// registeredNames returns the sorted names registered for scope or for every
+// session.
+func (scope *Scope) registeredNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(vals map[string]interface{}) {
+		for name := range vals {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	for s := scope; s != nil; s = s.Parent {
+		s.Lock()
+		add(s.builtins)
+		s.Unlock()
+	}
+	registered.Lock()
+	add(registered.vals)
+	registered.Unlock()
+	sort.Strings(names)
+	return names
+}
+
+// registeredSignature describes the registered builtin or package v for
+// :help.
+func registeredSignature(name string, v interface{}) string {
+	if pkg, ok := v.(Package); ok {
+		return fmt.Sprintf("package %s (%s)", name, strings.Join(pkg.Keys(), ", "))
+	}
+	return name + strings.TrimPrefix(reflect.TypeOf(v).String(), "func")
+}
@@ -0,0 +1,164 @@
+package pry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterBuiltin(t *testing.T) {
+	defer func() {
+		registered.Lock()
+		delete(registered.vals, "reloadConfig")
+		delete(registered.vals, "app")
+		registered.Unlock()
+	}()
+
+	reloads := 0
+	if err := RegisterBuiltin("reloadConfig", func() int { reloads++; return reloads }); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterPackage("app", map[string]interface{}{
+		"Double":  func(x int) int { return x * 2 },
+		"Version": "1.2",
+		"Config":  reflect.TypeOf(testCookie{}),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// New sessions see the registrations.
+	scope := NewScope()
+	for src, want := range map[string]interface{}{
+		"reloadConfig()": 1,
+		"app.Double(21)": 42,
+		"app.Version":    "1.2",
+	} {
+		out, err := scope.InterpretString(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+		} else if !reflect.DeepEqual(out, want) {
+			t.Errorf("%q: Expected %#v got %#v.", src, want, out)
+		}
+	}
+
+	if names, _ := Complete(scope, "relo", 4); !reflect.DeepEqual(candidateTexts(names), []string{"reloadConfig"}) {
+		t.Errorf("Expected %#v got %#v.", []string{"reloadConfig"}, candidateTexts(names))
+	}
+	if names, _ := Complete(scope, "app.Do", 6); !reflect.DeepEqual(candidateTexts(names), []string{"Double"}) {
+		t.Errorf("Expected %#v got %#v.", []string{"Double"}, candidateTexts(names))
+	}
+	help := helpText(scope, 80)
+	for _, want := range []string{"reloadConfig() int", "package app (Config, Double, Version)"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("Expected %q in :help:\n%s", want, help)
+		}
+	}
+
+	// Collisions need Override.
+	if err := RegisterBuiltin("reloadConfig", func() {}); err == nil {
+		t.Errorf("expected an error registering reloadConfig twice")
+	}
+	if err := RegisterBuiltin("reloadConfig", func() int { return -1 }, Override()); err != nil {
+		t.Error(err)
+	}
+	if out, err := scope.InterpretString("reloadConfig()"); err != nil || out != -1 {
+		t.Errorf("Expected %#v got %#v %v.", -1, out, err)
+	}
+}
+
+func TestScopeRegisterBuiltin(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	if err := scope.RegisterBuiltin("dumpState", func() string { return "ok" }); err != nil {
+		t.Fatal(err)
+	}
+	child := scope.NewChild()
+	if out, err := child.InterpretString("dumpState()"); err != nil || out != "ok" {
+		t.Errorf("Expected %#v got %#v %v.", "ok", out, err)
+	}
+	// Other scopes don't see it.
+	if _, err := NewScope().InterpretString("dumpState()"); err == nil {
+		t.Errorf("expected dumpState to be undefined in another scope")
+	}
+
+	if err := scope.RegisterBuiltin("len", func() {}); err == nil || !strings.Contains(err.Error(), "Override") {
+		t.Errorf("expected an error mentioning Override, got %v", err)
+	}
+	if err := scope.RegisterBuiltin("len", func(string) int { return 7 }, Override()); err != nil {
+		t.Error(err)
+	}
+	if out, err := scope.InterpretString(`len("abc")`); err != nil || out != 7 {
+		t.Errorf("Expected %#v got %#v %v.", 7, out, err)
+	}
+
+	for _, c := range []struct {
+		name string
+		fn   interface{}
+	}{
+		{"notFunc", 1},
+		{"nilFunc", (func())(nil)},
+		{"int", func() {}},
+		{"not valid", func() {}},
+	} {
+		if err := scope.RegisterBuiltin(c.name, c.fn, Override()); err == nil {
+			t.Errorf("expected an error registering %s", c.name)
+		}
+	}
+}
+
+type testCelsius float64
+
+func TestRegisterNamedType(t *testing.T) {
+	old := loadRegisteredTypes()
+	defer registeredTypes.table.Store(old)
+
+	celsius := reflect.TypeOf(testCelsius(0))
+	if err := RegisterNamedType("Celsius", celsius); err != nil {
+		t.Fatal(err)
+	}
+	scope := NewScope()
+	for src, want := range map[string]interface{}{
+		"Celsius(20)":                 testCelsius(20),
+		"var c Celsius; c":            testCelsius(0),
+		"x := float64(Celsius(2)); x": 2.0,
+	} {
+		out, err := scope.NewChild().InterpretString(src)
+		if err != nil {
+			t.Errorf("%q: %v", src, err)
+		} else if !reflect.DeepEqual(out, want) {
+			t.Errorf("%q: Expected %#v got %#v.", src, want, out)
+		}
+	}
+	if typ, err := StringToType("Celsius"); err != nil || typ != celsius {
+		t.Errorf("Expected %#v got %#v %v.", celsius, typ, err)
+	}
+	if names, _ := Complete(scope, "Cels", 4); !reflect.DeepEqual(candidateTexts(names), []string{"Celsius"}) {
+		t.Errorf("Expected %#v got %#v.", []string{"Celsius"}, candidateTexts(names))
+	}
+
+	for _, c := range []struct {
+		name string
+		t    reflect.Type
+		opts []RegisterOption
+	}{
+		{"Celsius", celsius, nil},
+		{"int", celsius, []RegisterOption{Override()}},
+		{"len", celsius, nil},
+		{"not valid", celsius, nil},
+		{"Nil", nil, nil},
+	} {
+		if err := RegisterNamedType(c.name, c.t, c.opts...); err == nil {
+			t.Errorf("expected an error registering %s", c.name)
+		}
+	}
+	if err := RegisterBuiltin("Celsius", func() {}); err == nil {
+		t.Errorf("expected an error registering a builtin over a type")
+	}
+	if err := RegisterNamedType("Celsius", reflect.TypeOf(0.0), Override()); err != nil {
+		t.Error(err)
+	}
+	if out, err := scope.InterpretString("Celsius(1)"); err != nil || out != 1.0 {
+		t.Errorf("Expected %#v got %#v %v.", 1.0, out, err)
+	}
+}
@@ -0,0 +1,433 @@
+package pry
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Telnet commands and options used by the remote REPL, see RFC 854.
+const (
+	telnetSE   = 240
+	telnetIP   = 244
+	telnetSB   = 250
+	telnetWill = 251
+	telnetWont = 252
+	telnetDo   = 253
+	telnetDont = 254
+	telnetIAC  = 255
+
+	telnetEcho = 1
+	telnetSGA  = 3
+	telnetNAWS = 31
+)
+
+// telnetSetup asks telnet clients to send every key as it's typed without
+// echoing it, since the REPL does its own line editing, and to report their
+// window size.
+var telnetSetup = []byte{
+	telnetIAC, telnetWill, telnetEcho,
+	telnetIAC, telnetWill, telnetSGA,
+	telnetIAC, telnetDo, telnetNAWS,
+}
+
+// unixPrefix selects a unix socket as the listen address, e.g.
+// "unix:/run/app/pry.sock". Without a path the socket is created at
+// socketPath(os.Getpid()).
+const unixPrefix = "unix:"
+
+// socketPath returns the default path of the socket of process pid, which
+// go-pry attach <pid> connects to.
+func socketPath(pid int) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("go-pry-%d.sock", pid))
+}
+
+// ListenAndServe waits for a connection on addr and runs the REPL with scope
+// over it.
+//
+// A TCP address, such as "localhost:2345", accepts a single connection and
+// stops listening as soon as a client connects. Only loopback addresses are
+// accepted unless WithAllowRemote is given. ListenAndServe returns once the
+// client disconnects or continues.
+//
+// A unix socket, such as "unix:/run/app/pry.sock" or just "unix:", only
+// accepts connections from the user running the program. Clients can detach
+// and attach again until one of them continues, and the socket is removed
+// afterwards.
+//
+// Connect with go-pry attach or telnet. Like Apply, ListenAndServe returns
+// immediately when breakpoints are disabled.
+func ListenAndServe(addr string, scope *Scope, opts ...Option) error {
+	if !buildEnabled {
+		return nil
+	}
+	_, filePathRaw, lineNum, _ := runtime.Caller(1)
+	if skipped(filePathRaw, lineNum) {
+		return nil
+	}
+	config := newConfig(append(opts, WithListenAddr(addr))...)
+	return listenAndServe(scope, config, sourcePath(filePathRaw), filePathRaw, lineNum)
+}
+
+// sourcePath returns the original version of a file instrumented by go-pry
+// or the file itself if it wasn't instrumented.
+func sourcePath(filePathRaw string) string {
+	filePath := filepath.Dir(filePathRaw) + "/." + filepath.Base(filePathRaw) + "pry"
+	if _, err := os.Stat(filePath); err != nil {
+		return filePathRaw
+	}
+	return filePath
+}
+
+func listenAndServe(scope *Scope, config *Config, filePath, filePathRaw string, lineNum int) error {
+	if strings.HasPrefix(config.ListenAddr, unixPrefix) {
+		return serveUnix(scope, config, filePath, filePathRaw, lineNum)
+	}
+	l, err := listen(config.ListenAddr, config.AllowRemote)
+	if err != nil {
+		return err
+	}
+	log.Printf("pry: %s:%d: waiting for a connection on %s", filePathRaw, lineNum, l.Addr())
+	return serveListener(l, scope, config, filePath, filePathRaw, lineNum)
+}
+
+// listen listens on the TCP address addr, which has to be a loopback
+// address unless allowRemote is set.
+func listen(addr string, allowRemote bool) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid listen address %q", addr)
+	}
+	if !allowRemote && !isLoopback(host) {
+		return nil, errors.Errorf("%s isn't a loopback address; use WithAllowRemote to listen on other interfaces", addr)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listening on %s", addr)
+	}
+	return l, nil
+}
+
+// isLoopback returns whether host only refers to the local machine. An empty
+// host listens on every interface.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveListener accepts a single connection on l, closes l and runs the
+// session over the connection.
+func serveListener(l net.Listener, scope *Scope, config *Config, filePath, filePathRaw string, lineNum int) error {
+	conn, err := l.Accept()
+	l.Close()
+	if err != nil {
+		return errors.Wrap(err, "accepting a connection")
+	}
+	if err := serveConn(conn, scope, config, filePath, filePathRaw, lineNum); err != io.EOF {
+		return err
+	}
+	// The client disconnected.
+	return nil
+}
+
+// serveUnix serves the session on a unix socket until a client continues.
+func serveUnix(scope *Scope, config *Config, filePath, filePathRaw string, lineNum int) error {
+	path := strings.TrimPrefix(config.ListenAddr, unixPrefix)
+	if len(path) == 0 {
+		path = socketPath(os.Getpid())
+	}
+	l, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+	// Closing the listener removes the socket.
+	defer l.Close()
+
+	log.Printf("pry: %s:%d: waiting for a connection on %s", filePathRaw, lineNum, path)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return errors.Wrap(err, "accepting a connection")
+		}
+		if err := checkPeer(conn); err != nil {
+			log.Printf("pry: %s: rejected a connection: %v", path, err)
+			fmt.Fprintf(conn, "pry: %v\r\n", err)
+			conn.Close()
+			continue
+		}
+		if err := serveConn(conn, scope, config, filePath, filePathRaw, lineNum); err != io.EOF {
+			return err
+		}
+		log.Printf("pry: %s:%d: the client detached, waiting for a connection on %s", filePathRaw, lineNum, path)
+	}
+}
+
+// listenUnix listens on a unix socket at path only its owner can connect to.
+// A socket left behind by a process that's gone is replaced.
+func listenUnix(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, errors.Errorf("%s is in use", path)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	// The socket is made in a directory only its owner can enter and
+	// restricted before it's moved to path, so other users never get to
+	// connect to it.
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".pry-")
+	if err != nil {
+		return nil, errors.Wrapf(err, "listening on %s", path)
+	}
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, "pry.sock")
+	l, err := net.Listen("unix", private)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listening on %s", path)
+	}
+	ul := l.(*net.UnixListener)
+	ul.SetUnlinkOnClose(false)
+	if err := os.Chmod(private, 0700); err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "restricting access to %s", path)
+	}
+	if err := os.Rename(private, path); err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "listening on %s", path)
+	}
+	return movedListener{ul, path}, nil
+}
+
+// movedListener is a unix listener whose socket was moved to path, which is
+// removed once it's closed.
+type movedListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l movedListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
+
+// serveConn runs the session over conn and closes it. It returns io.EOF if
+// the client disconnected before continuing.
+func serveConn(conn net.Conn, scope *Scope, config *Config, filePath, filePathRaw string, lineNum int) error {
+	defer conn.Close()
+	if _, err := conn.Write(telnetSetup); err != nil {
+		return errors.Wrap(err, "starting the session")
+	}
+	remote := *config
+	// An external pager would run on the terminal of the program.
+	remote.Pager = ""
+	// The keys come from the terminal of the client.
+	remote.LineEditor = nil
+	return apply(scope, &remote, crlfWriter{conn}, newConnTTY(conn), filePath, filePathRaw, lineNum)
+}
+
+// replAddress returns the network and address of target, which go-pry attach
+// accepts: a process ID, the path of a unix socket or a TCP address.
+func replAddress(target string) (network, addr string) {
+	if pid, err := strconv.Atoi(target); err == nil {
+		return "unix", socketPath(pid)
+	}
+	if strings.HasPrefix(target, unixPrefix) {
+		return "unix", strings.TrimPrefix(target, unixPrefix)
+	}
+	if strings.ContainsRune(target, os.PathSeparator) || strings.HasSuffix(target, ".sock") {
+		return "unix", target
+	}
+	return "tcp", target
+}
+
+// connTTY reads the keys sent by a client of the remote REPL. Telnet
+// negotiation is stripped and the window size the client reports is kept.
+type connTTY struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// cr is set after a carriage return, which telnet clients follow with
+	// a line feed or NUL.
+	cr bool
+
+	mu            sync.Mutex
+	width, height int
+}
+
+func newConnTTY(conn net.Conn) *connTTY {
+	return &connTTY{conn: conn, r: bufio.NewReader(conn), width: 80, height: 24}
+}
+
+// ReadRune returns the next key. Any error reading the connection means
+// the client is gone and is returned as io.EOF.
+func (t *connTTY) ReadRune() (rune, int, error) {
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return 0, 0, io.EOF
+		}
+		cr := t.cr
+		t.cr = b == '\r'
+		switch {
+		case b == telnetIAC:
+			r, err := t.command()
+			if err != nil {
+				return 0, 0, io.EOF
+			}
+			if r != 0 {
+				return r, utf8.RuneLen(r), nil
+			}
+		case cr && (b == '\n' || b == 0):
+		case b < 0x80:
+			return rune(b), 1, nil
+		default:
+			t.r.UnreadByte()
+			r, size, err := t.r.ReadRune()
+			if err != nil {
+				return 0, 0, io.EOF
+			}
+			return r, size, nil
+		}
+	}
+}
+
+// command handles the telnet command following IAC. It returns the key the
+// command stands for, if any.
+func (t *connTTY) command() (rune, error) {
+	cmd, err := t.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch cmd {
+	case telnetWill, telnetWont, telnetDo, telnetDont:
+		_, err := t.r.ReadByte()
+		return 0, err
+	case telnetSB:
+		data, err := t.subnegotiation()
+		if err != nil {
+			return 0, err
+		}
+		if len(data) == 5 && data[0] == telnetNAWS {
+			t.mu.Lock()
+			t.width = int(data[1])<<8 | int(data[2])
+			t.height = int(data[3])<<8 | int(data[4])
+			t.mu.Unlock()
+		}
+		return 0, nil
+	case telnetIP:
+		return 3, nil // Ctrl-C
+	}
+	return 0, nil
+}
+
+// subnegotiation reads the data of a subnegotiation up to IAC SE.
+func (t *connTTY) subnegotiation() ([]byte, error) {
+	var data []byte
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != telnetIAC {
+			data = append(data, b)
+			continue
+		}
+		if b, err = t.r.ReadByte(); err != nil {
+			return nil, err
+		}
+		if b == telnetSE {
+			return data, nil
+		}
+		data = append(data, b)
+	}
+}
+
+// Size returns the window size reported by the client or 80x24.
+func (t *connTTY) Size() (int, int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.width, t.height, nil
+}
+
+func (t *connTTY) Close() error {
+	return t.conn.Close()
+}
+
+// crlfWriter ends lines with CRLF, as telnet and raw terminals expect.
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (w crlfWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(bytes.Replace(p, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// telnetWindowSize reports a window size to the remote REPL.
+func telnetWindowSize(width, height int) []byte {
+	size := []byte{telnetIAC, telnetSB, telnetNAWS}
+	for _, n := range []int{width, height} {
+		for _, b := range []byte{byte(n >> 8), byte(n)} {
+			size = append(size, b)
+			if b == telnetIAC {
+				size = append(size, telnetIAC)
+			}
+		}
+	}
+	return append(size, telnetIAC, telnetSE)
+}
+
+// telnetReader strips telnet negotiation from what the remote REPL sends.
+type telnetReader struct {
+	r *bufio.Reader
+}
+
+func (t telnetReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if n > 0 && t.r.Buffered() == 0 {
+			break
+		}
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		if b != telnetIAC {
+			p[n] = b
+			n++
+			continue
+		}
+		cmd, err := t.r.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		switch cmd {
+		case telnetIAC:
+			p[n] = b
+			n++
+		case telnetWill, telnetWont, telnetDo, telnetDont:
+			if _, err := t.r.ReadByte(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
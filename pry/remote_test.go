@@ -0,0 +1,293 @@
+package pry
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestListenLoopbackOnly(t *testing.T) {
+	t.Parallel()
+
+	for _, addr := range []string{"127.0.0.1:0", "localhost:0"} {
+		l, err := listen(addr, false)
+		if err != nil {
+			t.Errorf("listen(%q): %v", addr, err)
+			continue
+		}
+		l.Close()
+	}
+	for _, addr := range []string{":0", "0.0.0.0:0", "192.0.2.1:0", "example.com:0"} {
+		if l, err := listen(addr, false); err == nil || !strings.Contains(err.Error(), "WithAllowRemote") {
+			t.Errorf("listen(%q): expected an error mentioning WithAllowRemote got %v", addr, err)
+			if l != nil {
+				l.Close()
+			}
+		}
+	}
+	l, err := listen(":0", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if _, err := listen("2345", false); err == nil {
+		t.Errorf("expected an error for an address without a host")
+	}
+}
+
+func TestConnTTY(t *testing.T) {
+	t.Parallel()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	tty := newConnTTY(server)
+	defer tty.Close()
+
+	input := append([]byte{telnetIAC, telnetDo, telnetEcho}, "a\r\n"...)
+	input = append(input, telnetWindowSize(120, 255)...)
+	input = append(input, "é\r\x00"...)
+	input = append(input, telnetIAC, telnetIP)
+	go func() {
+		client.Write(input)
+		client.Close()
+	}()
+
+	var got []rune
+	for {
+		r, _, err := tty.ReadRune()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := []rune{'a', '\r', 'é', '\r', 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %#v got %#v.", want, got)
+	}
+	if width, height, _ := tty.Size(); width != 120 || height != 255 {
+		t.Errorf("Expected 120x255 got %dx%d.", width, height)
+	}
+}
+
+func TestTelnetReader(t *testing.T) {
+	t.Parallel()
+
+	in := append(append([]byte("a\r\n"), telnetSetup...), telnetIAC, telnetIAC, 'b')
+	out, err := ioutil.ReadAll(telnetReader{bufio.NewReader(bytes.NewReader(in))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{'a', '\r', '\n', telnetIAC, 'b'}
+	if !bytes.Equal(out, want) {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+}
+
+func TestCRLFWriter(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	n, err := crlfWriter{&out}.Write([]byte("a\nb\n"))
+	if err != nil || n != 4 {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if want := "a\r\nb\r\n"; out.String() != want {
+		t.Errorf("Expected %#v got %#v.", want, out.String())
+	}
+}
+
+func TestCLIRemote(t *testing.T) {
+	t.Parallel()
+
+	dir, file := writeTestFile(t)
+	defer os.RemoveAll(dir)
+
+	l, err := listen("127.0.0.1:0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	done := make(chan error, 1)
+	go func() {
+		done <- serveListener(l, NewScope(), newConfig(WithHistoryFile("")), file, file, 2)
+	}()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("6 * 7\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	r := telnetReader{bufio.NewReader(conn)}
+	succeedsSoon(t, func() error {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		buf := make([]byte, 1024)
+		n, _ := r.Read(buf)
+		out.Write(buf[:n])
+		if !strings.Contains(ansiEscape.ReplaceAllString(out.String(), ""), "=> 42\r\n") {
+			return errors.Errorf("expected the result over the connection\nOutput:\n%s\n", out.String())
+		}
+		return nil
+	})
+	conn.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session didn't end when the client disconnected")
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Errorf("expected the listener to be closed")
+	}
+}
+
+func TestReplAddress(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		target, network, addr string
+	}{
+		{"localhost:2345", "tcp", "localhost:2345"},
+		{"1234", "unix", socketPath(1234)},
+		{"unix:/run/app/pry.sock", "unix", "/run/app/pry.sock"},
+		{"/tmp/pry.sock", "unix", "/tmp/pry.sock"},
+		{"pry.sock", "unix", "pry.sock"},
+	}
+	for _, c := range cases {
+		network, addr := replAddress(c.target)
+		if network != c.network || addr != c.addr {
+			t.Errorf("replAddress(%q) = %q, %q; expected %q, %q", c.target, network, addr, c.network, c.addr)
+		}
+	}
+	if want := filepath.Join(os.TempDir(), "go-pry-1234.sock"); socketPath(1234) != want {
+		t.Errorf("Expected %#v got %#v.", want, socketPath(1234))
+	}
+}
+
+func TestCheckPeer(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "pry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pry.sock")
+	l, err := listenUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0700 {
+		t.Errorf("Expected %#o got %#o.", 0700, perm)
+	}
+	if _, err := listenUnix(path); err == nil {
+		t.Errorf("expected an error listening on a socket in use")
+	}
+
+	go func() {
+		if conn, err := net.Dial("unix", path); err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 1))
+		}
+	}()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		t.Errorf("expected a connection from the same user to be accepted: %v", err)
+	}
+
+	// The socket is made elsewhere and moved into place, and removed once
+	// it's closed.
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("Expected only the socket in %s got %d files %v.", dir, len(files), err)
+	}
+	l.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed got %v.", err)
+	}
+}
+
+func TestCLIUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	dir, file := writeTestFile(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pry.sock")
+
+	done := make(chan error, 1)
+	go func() {
+		config := newConfig(WithHistoryFile(""), WithListenAddr(unixPrefix+path))
+		done <- listenAndServe(NewScope(), config, file, file, 2)
+	}()
+
+	// attach sends input and waits for want in the output.
+	attach := func(input, want string) net.Conn {
+		var conn net.Conn
+		succeedsSoon(t, func() error {
+			var err error
+			conn, err = net.Dial("unix", path)
+			return err
+		})
+		if _, err := conn.Write([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		r := telnetReader{bufio.NewReader(conn)}
+		succeedsSoon(t, func() error {
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			buf := make([]byte, 1024)
+			n, _ := r.Read(buf)
+			out.Write(buf[:n])
+			if !strings.Contains(ansiEscape.ReplaceAllString(out.String(), ""), want) {
+				return errors.Errorf("expected %q in the output\nOutput:\n%s\n", want, out.String())
+			}
+			return nil
+		})
+		return conn
+	}
+
+	attach("a := 20\r", "[1] go-pry>").Close()
+	conn := attach("a * 2\r", "=> 40\r\n")
+	if _, err := conn.Write([]byte("continue\r")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session didn't end when the client continued")
+	}
+	conn.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed; got %v", err)
+	}
+}
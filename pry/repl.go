@@ -0,0 +1,204 @@
+package pry
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// REPL is a session reading keys from In and writing to Out. Apply runs one
+// on the terminal, but a REPL can run over any stream, such as a network
+// connection or scripted input.
+type REPL struct {
+	// In is where the input is read from. It's read as typed if Out is a
+	// terminal and as lines otherwise. It's only read by the pager if the
+	// session has a LineEditor.
+	In io.Reader
+	// Out is where the output is written. Colors and paging are disabled
+	// unless it's a terminal; WithTheme and WithPagerThreshold override that,
+	// and WithNoColor disables colors on terminals too.
+	Out io.Writer
+	// Scope is the scope statements are evaluated in. It defaults to a new
+	// scope.
+	Scope *Scope
+	// File and Line are where the session was started. The source around the
+	// line is shown and statements are type checked against the file. Neither
+	// is done without a file.
+	File string
+	Line int
+	// Options configure the session.
+	Options []Option
+
+	// tty reads the keys from the terminal instead of In.
+	tty genericTTY
+}
+
+// Run runs the session until it's continued, In is exhausted or ctx is done.
+// It returns ctx's error if ctx ended the session.
+func (r *REPL) Run(ctx context.Context) error {
+	var opts []Option
+	f, ok := r.Out.(*os.File)
+	terminal := ok && isTerminal(f)
+	if !terminal {
+		opts = append(opts, WithTheme(NoColorTheme), WithPagerThreshold(-1))
+	}
+	config := newConfig(append(opts, r.Options...)...)
+	config.lineInput = !terminal
+	if terminal {
+		config.paste = terminalPasteMode(os.Getenv("TERM"))
+	}
+	return r.run(ctx, config)
+}
+
+func (r *REPL) run(ctx context.Context, config *Config) error {
+	if r.Scope == nil {
+		r.Scope = NewScope()
+	}
+	tty := r.tty
+	if tty == nil {
+		in := r.In
+		if in == nil {
+			in = strings.NewReader("")
+		}
+		tty = readerTTY{bufio.NewReader(in)}
+	}
+	if ctx.Done() != nil {
+		canceled := newContextTTY(ctx, tty)
+		defer canceled.Stop()
+		tty = canceled
+		if config.LineEditor != nil {
+			config.LineEditor = contextEditor{config.LineEditor, ctx}
+		}
+	}
+
+	filePath := ""
+	if len(r.File) > 0 {
+		filePath = sourcePath(r.File)
+	}
+	err := apply(r.Scope, config, r.Out, tty, filePath, r.File, r.Line)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// readerTTY reads keys from a stream that isn't a terminal and reports a
+// size of 80x24.
+type readerTTY struct {
+	r *bufio.Reader
+}
+
+func (t readerTTY) ReadRune() (rune, int, error) {
+	return t.r.ReadRune()
+}
+
+func (t readerTTY) Size() (int, int, error) {
+	return 80, 24, nil
+}
+
+// Close does nothing; the stream belongs to whoever started the session.
+func (t readerTTY) Close() error {
+	return nil
+}
+
+// contextEditor is a LineEditor whose ReadLine returns the context's error
+// once the context is done, even if the underlying editor is blocked. The line
+// it was reading is dropped.
+type contextEditor struct {
+	LineEditor
+	ctx context.Context
+}
+
+func (e contextEditor) ReadLine(prompt string) (string, error) {
+	if err := e.ctx.Err(); err != nil {
+		return "", err
+	}
+	lines := make(chan lineResult, 1)
+	go func() {
+		line, err := e.LineEditor.ReadLine(prompt)
+		lines <- lineResult{line, err}
+	}()
+	select {
+	case res := <-lines:
+		return res.line, res.err
+	case <-e.ctx.Done():
+		return "", e.ctx.Err()
+	}
+}
+
+func (e contextEditor) indentNext(depth int) {
+	if indenter, ok := e.LineEditor.(autoIndenter); ok {
+		indenter.indentNext(depth)
+	}
+}
+
+// lineResult is the result of a ReadLine.
+type lineResult struct {
+	line string
+	err  error
+}
+
+// contextTTY is a TTY whose ReadRune returns the context's error once the
+// context is done, even if the underlying TTY is blocked.
+type contextTTY struct {
+	genericTTY
+	ctx context.Context
+
+	start, stop sync.Once
+	runes       chan runeResult
+	done        chan struct{}
+}
+
+func newContextTTY(ctx context.Context, tty genericTTY) *contextTTY {
+	return &contextTTY{
+		genericTTY: tty,
+		ctx:        ctx,
+		runes:      make(chan runeResult),
+		done:       make(chan struct{}),
+	}
+}
+
+// read forwards runes from the underlying TTY until it fails or is closed.
+func (t *contextTTY) read() {
+	for {
+		r, size, err := t.genericTTY.ReadRune()
+		select {
+		case t.runes <- runeResult{r, size, err}:
+		case <-t.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *contextTTY) ReadRune() (rune, int, error) {
+	t.start.Do(func() {
+		go t.read()
+	})
+	select {
+	case res := <-t.runes:
+		return res.r, res.size, res.err
+	case <-t.ctx.Done():
+		return 0, 0, t.ctx.Err()
+	}
+}
+
+// Stop stops forwarding runes without closing the underlying TTY.
+func (t *contextTTY) Stop() {
+	t.stop.Do(func() {
+		close(t.done)
+	})
+}
+
+func (t *contextTTY) Close() error {
+	t.Stop()
+	return t.genericTTY.Close()
+}
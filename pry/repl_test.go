@@ -0,0 +1,269 @@
+package pry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mgutz/ansi"
+)
+
+func TestREPLRun(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader("a := 2\na * 21\nb\nstring(a + 63)\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile("")},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{"=> 42\n", "undefined: b", "Warning: conversion from int to string yields a string of one rune"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in the output:\n%s", want, got)
+		}
+	}
+	// Output that isn't a terminal isn't colored.
+	if strings.Contains(got, "\033[0;") || strings.Contains(got, "\033[1;") {
+		t.Errorf("Expected no colors in the output:\n%q", got)
+	}
+	// Declarations don't print their value.
+	if strings.Contains(got, "=> 2\n") {
+		t.Errorf("Expected no result for the declaration:\n%s", got)
+	}
+	if a, _ := repl.Scope.Get("a"); a != 2 {
+		t.Errorf("Expected %#v got %#v.", 2, a)
+	}
+}
+
+func TestREPLRunResults(t *testing.T) {
+	t.Parallel()
+
+	input := []string{
+		"f := func() {}",
+		"f()",
+		"x := 1",
+		"x = 3",
+		"x++",
+		"var y int",
+		`atoi("12")`,
+		"_ + 1",
+		`atoi("z")`,
+		"split := func(s string) (string, string, error) { return s[:1], s[1:], nil }",
+		`split("ab")`,
+		"pair()",
+		"fail()",
+		"x",
+		`""`,
+		"int64(0)",
+		"var err error",
+		"err",
+		"err = fail()",
+		"err",
+		"var v interface{} = 0",
+		"v",
+		"nilPoint",
+		"pt",
+		"&pt",
+		"[]interface{}{pt}",
+		"ip",
+		"wide()",
+	}
+	var out bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader(strings.Join(input, "\n") + "\n"),
+		Out:     &out,
+		Scope:   NewScope(),
+		Options: []Option{WithHistoryFile("")},
+	}
+	repl.Scope.Set("atoi", strconv.Atoi)
+	repl.Scope.Set("pair", func() (int, string) { return 1, "a" })
+	repl.Scope.Set("fail", func() error { return errors.New("boom") })
+	type point struct{ X, Y int }
+	repl.Scope.Set("pt", point{1, 2})
+	repl.Scope.Set("nilPoint", (*point)(nil))
+	repl.Scope.Set("ip", net.IPv4(127, 0, 0, 1))
+	repl.Scope.Set("wide", func() (int32, string, *point) { return 1, "a", nil })
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := `[0] go-pry> f := func() {}
+[1] go-pry> f()
+[2] go-pry> x := 1
+[3] go-pry> x = 3
+[4] go-pry> x++
+[5] go-pry> var y int
+[6] go-pry> atoi("12")
+=> 12
+[7] go-pry> _ + 1
+=> 13
+[8] go-pry> atoi("z")
+=> 0
+Returned error: strconv.Atoi: parsing "z": invalid syntax
+[9] go-pry> split := func(s string) (string, string, error) { return s[:1], s[1:], nil }
+[10] go-pry> split("ab")
+=> "a", "b"
+[11] go-pry> pair()
+=> 1, "a"
+[12] go-pry> fail()
+=> "boom" (*errors.errorString, declared error)
+[13] go-pry> x
+=> 4
+[14] go-pry> ""
+=> ""
+[15] go-pry> int64(0)
+=> 0 (int64)
+[16] go-pry> var err error
+[17] go-pry> err
+=> nil (error)
+[18] go-pry> err = fail()
+[19] go-pry> err
+=> "boom" (*errors.errorString, declared error)
+[20] go-pry> var v interface{} = 0
+[21] go-pry> v
+=> 0 (int, declared interface {})
+[22] go-pry> nilPoint
+=> nil (*pry.point)
+[23] go-pry> pt
+=> {X: 1, Y: 2} (pry.point)
+[24] go-pry> &pt
+=> &{X: 1, Y: 2} (*pry.point)
+[25] go-pry> []interface{}{pt}
+=> {pry.point{X: 1, Y: 2}} ([]interface {})
+[26] go-pry> ip
+=> 127.0.0.1 (net.IP)
+[27] go-pry> wide()
+=> 1 (int32), "a", nil (*pry.point)
+[28] go-pry> 
+`
+	// Without a file, the session starts with the prompt.
+	if got := out.String(); got != want {
+		t.Errorf("Expected %#v got %#v.", want, got)
+	}
+}
+
+func TestREPLRunObviousTypes(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader("1\n\"a\"\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile(""), WithObviousTypes(true)},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput(t, out.String(), "=> 1 (int)\n", "=> \"a\" (string)\n")
+}
+
+func TestREPLRunBytes(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader("b := []byte(\"héllo\")\nb\n:vars\n:set bytesformat go\nb\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile("")},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The type is only shown once, after the bytes, and :vars shows them
+	// like results.
+	expectOutput(t, out.String(),
+		"=> {0x68, 0xc3, 0xa9, 0x6c, 0x6c, 0x6f} ([]uint8)\n",
+		"  b  []uint8  {0x68, 0xc3, 0xa9, 0x6c, 0x6c, 0x6f}\n",
+		"=> \"héllo\" ([]uint8)\n",
+	)
+}
+
+func TestREPLRunColors(t *testing.T) {
+	t.Parallel()
+
+	input := "s := \"a\"\nvar n int\n:vars\ns + \"b\"\nn + 1\nundefinedVar\n"
+	run := func(opts ...Option) string {
+		var out bytes.Buffer
+		repl := &REPL{
+			In:      strings.NewReader(input),
+			Out:     &out,
+			Options: append([]Option{WithHistoryFile(""), WithTheme(DefaultTheme)}, opts...),
+		}
+		if err := repl.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	colored := run()
+	for _, want := range []string{
+		DefaultTheme.paint("string", DefaultTheme.Type),
+		DefaultTheme.paint(`"ab"`, DefaultTheme.String),
+		DefaultTheme.paint("1", DefaultTheme.Number),
+		ansi.ColorCode(DefaultTheme.Error) + "Error:  undefined: undefinedVar",
+		DefaultTheme.paint("[1] go-pry> ", DefaultTheme.Prompt),
+	} {
+		if !strings.Contains(colored, want) {
+			t.Errorf("Expected %q in the output:\n%q", want, colored)
+		}
+	}
+
+	// WithNoColor wins over the theme.
+	if plain := run(WithNoColor()); strings.Contains(plain, "\033[") {
+		t.Errorf("Expected no escape sequences in the output:\n%q", plain)
+	}
+}
+
+func TestREPLRunContinue(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	repl := &REPL{
+		In:      strings.NewReader("continue\nunreachable\n"),
+		Out:     &out,
+		Options: []Option{WithHistoryFile("")},
+	}
+	if err := repl.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "unreachable") {
+		t.Errorf("Expected the session to end at continue:\n%s", out.String())
+	}
+}
+
+func TestREPLRunCanceled(t *testing.T) {
+	t.Parallel()
+
+	r, w := io.Pipe()
+	defer w.Close()
+	repls := map[string]*REPL{
+		"In":         {In: r, Out: ioutil.Discard, Options: []Option{WithHistoryFile("")}},
+		"LineEditor": {Out: ioutil.Discard, Options: []Option{WithHistoryFile(""), WithLineEditor(NewReaderEditor(r, ioutil.Discard))}},
+	}
+	for name, repl := range repls {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func(repl *REPL) {
+			done <- repl.Run(ctx)
+		}(repl)
+		cancel()
+		select {
+		case err := <-done:
+			if err != context.Canceled {
+				t.Errorf("%s: Expected %#v got %#v.", name, context.Canceled, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the session didn't end when the context was canceled", name)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package pry
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResultKind is the kind of statement that produced a Result.
+type ResultKind int
+
+const (
+	// ResultExpression is the value of an expression, which the REPL
+	// prints.
+	ResultExpression ResultKind = iota
+	// ResultDeclaration declares variables, constants or types, with := or
+	// var, const and type statements.
+	ResultDeclaration
+	// ResultStatement is any other statement, such as an assignment, a loop
+	// or a call to a function without results.
+	ResultStatement
+)
+
+func (k ResultKind) String() string {
+	switch k {
+	case ResultExpression:
+		return "expression"
+	case ResultDeclaration:
+		return "declaration"
+	case ResultStatement:
+		return "statement"
+	}
+	return "unknown"
+}
+
+// Result is the outcome of evaluating some input with Eval.
+type Result struct {
+	// Value is the value of the last statement, nil if it has none.
+	Value interface{}
+	// Type is the static type of Value where it's known, such as the
+	// interface type of a variable holding an error, and its dynamic type
+	// otherwise. It's nil if Value is nil and the type isn't known.
+	Type reflect.Type
+	// Types are the static types of the results of a call with several,
+	// which Value holds as a []interface{}. It's nil for other results.
+	Types []reflect.Type
+	// Kind is the kind of the last statement.
+	Kind ResultKind
+	// Declared lists the names declared by the input in order.
+	Declared []string
+	// Duration is how long the evaluation took.
+	Duration time.Duration
+	// Warnings are about what the input did that's allowed but likely a
+	// mistake, such as those go vet reports.
+	Warnings []string
+	// ReturnedError is the error returned by a call whose last result is an
+	// error, such as strconv.Atoi(s). Value holds the other results: the
+	// only one, or a []interface{} of several. It's nil if the call
+	// succeeded.
+	ReturnedError error
+	// NativeCalls is the number of calls to compiled functions, such as
+	// those of packages, the evaluation made. Builtins like append and len
+	// aren't counted.
+	NativeCalls int
+}
+
+// warningLog collects the warnings of an evaluation.
+type warningLog struct {
+	sync.Mutex
+	list []string
+}
+
+// warn adds a warning to the evaluation running in scope. It's dropped if
+// the scope isn't evaluated by Eval, such as with InterpretString.
+func (scope *Scope) warn(format string, args ...interface{}) {
+	for s := scope; s != nil; s = s.Parent {
+		if log := s.warnings; log != nil {
+			log.Lock()
+			log.list = append(log.list, fmt.Sprintf(format, args...))
+			log.Unlock()
+			return
+		}
+	}
+}
+
+// Eval interprets src in scope and describes the result of its last
+// statement. src is any number of statements separated by semicolons or
+// newlines; empty input is a statement without a value. The Result is never
+// nil; on errors it holds what was evaluated.
+//
+// Once ctx is done the evaluation stops with an *InterruptedError wrapping
+// ctx.Err(). Cancellation is checked before the evaluation starts, between
+// statements, on every loop iteration and before native calls, so no new
+// work starts after it; a native call that's already running isn't
+// interrupted.
+//
+// The hooks added to scope with AddHooks run around the evaluation.
+func Eval(ctx context.Context, scope *Scope, src string) (*Result, error) {
+	return scope.eval(ctx, src, nil)
+}
+
+// eval is Eval running prog, compiled from src, if it isn't nil.
+func (scope *Scope) eval(ctx context.Context, src string, prog *Program) (res *Result, err error) {
+	res = &Result{Kind: ResultStatement}
+	hooks := scope.hooks()
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start)
+		afterEval(hooks, src, res, err)
+	}()
+	defer recoverInterpret(src, &err)
+	if err := beforeEval(hooks, src); err != nil {
+		return res, err
+	}
+
+	// A context that's never done would hide the one of an evaluation
+	// running in a parent scope.
+	if ctx.Done() != nil {
+		prev := scope.ctx
+		scope.ctx = ctx
+		defer func() {
+			scope.ctx = prev
+		}()
+	}
+	// Evaluations started by one that's running, such as from a native
+	// call, share its budget.
+	if l, ok := scope.currentLimits(); ok && scope.currentBudget() == nil {
+		scope.budget = newBudget(l)
+		defer func() {
+			scope.budget = nil
+		}()
+	}
+	// Evaluations started by one that's running warn in its result.
+	if scope.currentWarnings() == nil {
+		scope.warnings = &warningLog{}
+		defer func() {
+			res.Warnings = scope.warnings.list
+			scope.warnings = nil
+		}()
+	}
+	if scope.currentNativeCalls() == nil {
+		scope.nativeCalls = new(int64)
+		defer func() {
+			res.NativeCalls = int(atomic.LoadInt64(scope.nativeCalls))
+			scope.nativeCalls = nil
+		}()
+	}
+	if p := scope.currentPolicy(); !p.isZero() && scope.currentBlocked() == nil {
+		scope.blocked = newBlockedFuncs(p)
+		defer func() {
+			scope.blocked = nil
+		}()
+	}
+	if err := scope.checkInterrupt(); err != nil {
+		return res, err
+	}
+
+	if prog == nil {
+		body, shifted, err := parseProgram(src)
+		if err != nil {
+			return res, err
+		}
+		prog = &Program{src: src, body: body, shifted: shifted}
+		if scope.compiling() {
+			prog.run = compileNode(body)
+		}
+	}
+	body := prog.body
+	if len(body.List) == 0 {
+		return res, nil
+	}
+	res.Value, err = scope.interpretSource(body, &source{text: src, shifted: prog.shifted}, prog.run)
+	if err != nil {
+		return res, err
+	}
+	res.Declared = declaredNames(body.List)
+	scope.describeResult(res, body.List[len(body.List)-1])
+	return res, nil
+}
+
+// currentNativeCalls returns the count of native calls of the evaluation
+// running in scope, or nil if there's none.
+func (scope *Scope) currentNativeCalls() *int64 {
+	for s := scope; s != nil; s = s.Parent {
+		if s.nativeCalls != nil {
+			return s.nativeCalls
+		}
+	}
+	return nil
+}
+
+// countNativeCall counts a native call of the evaluation running in scope.
+func (scope *Scope) countNativeCall() {
+	if n := scope.currentNativeCalls(); n != nil {
+		atomic.AddInt64(n, 1)
+	}
+}
+
+// currentWarnings returns the warnings of the evaluation running in scope,
+// or nil if there's none.
+func (scope *Scope) currentWarnings() *warningLog {
+	for s := scope; s != nil; s = s.Parent {
+		if s.warnings != nil {
+			return s.warnings
+		}
+	}
+	return nil
+}
+
+// describeResult fills in the kind and type of res, the result of the
+// statement stmt.
+func (scope *Scope) describeResult(res *Result, stmt ast.Stmt) {
+	res.Type = reflect.TypeOf(res.Value)
+	switch s := stmt.(type) {
+	case *ast.DeclStmt:
+		res.Kind = ResultDeclaration
+	case *ast.AssignStmt:
+		if s.Tok == token.DEFINE {
+			res.Kind = ResultDeclaration
+		}
+	case *ast.ExprStmt:
+		if res.Value == nil && !scope.hasValue(s.X) {
+			return
+		}
+		res.Kind = ResultExpression
+		if typ := scope.staticType(s.X); typ != nil {
+			res.Type = typ
+		}
+		if call, ok := s.X.(*ast.CallExpr); ok {
+			scope.describeCall(res, call)
+		}
+	}
+}
+
+// describeCall fills in the types of the results of call, if it has
+// several, and moves the error it returned, if its results end in one after
+// others, from the values of res to its ReturnedError.
+func (scope *Scope) describeCall(res *Result, call *ast.CallExpr) {
+	results := scope.callResults(call)
+	vals, ok := res.Value.([]interface{})
+	if len(results) < 2 || !ok || len(vals) != len(results) {
+		return
+	}
+	if last := len(results) - 1; results[last] == errorType {
+		res.ReturnedError, _ = vals[last].(error)
+		vals, results = vals[:last], results[:last]
+		if len(vals) == 1 {
+			res.Value, res.Type = vals[0], results[0]
+			return
+		}
+		res.Value = vals
+	}
+	res.Types = results
+}
+
+// callResults returns the result types of the function called by call, if
+// it can be found without side effects.
+func (scope *Scope) callResults(call *ast.CallExpr) []reflect.Type {
+	if !isSafeExpr(call.Fun) {
+		return nil
+	}
+	fun, err := scope.staticValue(call.Fun)
+	if err != nil || !fun.IsValid() {
+		return nil
+	}
+	if f, ok := valueInterface(fun).(*Func); ok {
+		results, _, err := f.definedIn().fieldTypes(f.Def.Type.Results)
+		if err != nil {
+			return nil
+		}
+		return results
+	}
+	if fun.Kind() != reflect.Func {
+		return nil
+	}
+	results := make([]reflect.Type, fun.Type().NumOut())
+	for i := range results {
+		results[i] = fun.Type().Out(i)
+	}
+	return results
+}
+
+// staticType returns the static type of expr if it can be found without
+// side effects, or nil.
+func (scope *Scope) staticType(expr ast.Expr) reflect.Type {
+	if call, ok := expr.(*ast.CallExpr); ok {
+		if !isSafeExpr(call.Fun) {
+			return nil
+		}
+		fun, err := scope.staticValue(call.Fun)
+		if err != nil || !fun.IsValid() || fun.Kind() != reflect.Func || fun.Type().NumOut() != 1 {
+			return nil
+		}
+		return fun.Type().Out(0)
+	}
+	if !isSafeExpr(expr) {
+		return nil
+	}
+	v, err := scope.staticValue(expr)
+	if err != nil || !v.IsValid() {
+		return nil
+	}
+	return v.Type()
+}
+
+// declaredNames returns the names declared by stmts, leaving out blank
+// identifiers.
+func declaredNames(stmts []ast.Stmt) []string {
+	var names []string
+	add := func(ident *ast.Ident) {
+		if ident.Name != "_" {
+			names = append(names, ident.Name)
+		}
+	}
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.AssignStmt:
+			if s.Tok != token.DEFINE {
+				continue
+			}
+			for _, lhs := range s.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok {
+					add(ident)
+				}
+			}
+		case *ast.DeclStmt:
+			decl, ok := s.Decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, ident := range spec.Names {
+						add(ident)
+					}
+				case *ast.TypeSpec:
+					add(spec.Name)
+				}
+			}
+		}
+	}
+	return names
+}
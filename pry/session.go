@@ -0,0 +1,70 @@
+package pry
+
+// session records the inputs of the current REPL session so commands like
+// :save can replay them. The history also has inputs of earlier sessions,
+// and doesn't know which ones succeeded.
+type session struct {
+	entries []sessionEntry
+	// initial has the names bound when the session started, such as the
+	// variables of the program.
+	initial map[string]bool
+	// undo holds the checkpoints taken before the last inputs that
+	// succeeded, the latest last.
+	undo []*checkpoint
+	// failed is set when the last input failed, so :undo has nothing to
+	// take back.
+	failed bool
+	// transcript records the session while :record is on.
+	transcript *transcript
+}
+
+func newSession(scope *Scope) *session {
+	s := &session{initial: map[string]bool{}}
+	for _, name := range scope.Keys() {
+		s.initial[name] = true
+	}
+	return s
+}
+
+// sessionEntry is one input of a session.
+type sessionEntry struct {
+	// number is the position of the input in the history, which is shown by
+	// the prompt.
+	number  int
+	input   string
+	command bool
+	err     error
+	// undone is set once :undo took the input back.
+	undone bool
+}
+
+func (s *session) add(number int, input string, command bool, err error) {
+	s.entries = append(s.entries, sessionEntry{number: number, input: input, command: command, err: err})
+}
+
+// succeeded returns the inputs that evaluated without an error, skipping
+// commands, numbered between from and to inclusive.
+func (s *session) succeeded(from, to int) []sessionEntry {
+	var entries []sessionEntry
+	for _, e := range s.entries {
+		if e.command || e.err != nil || e.undone || e.number < from || e.number > to {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// evaluated records the checkpoint c taken before the last input, which
+// evaluated with err. Only the last levels checkpoints are kept.
+func (s *session) evaluated(c *checkpoint, err error, levels int) {
+	s.failed = err != nil
+	if c == nil || err != nil {
+		return
+	}
+	c.entry = len(s.entries) - 1
+	s.undo = append(s.undo, c)
+	if len(s.undo) > levels {
+		s.undo = s.undo[len(s.undo)-levels:]
+	}
+}
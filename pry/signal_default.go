@@ -0,0 +1,121 @@
+// +build !js
+
+package pry
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// notifyInterrupt calls cancel when the process receives an interrupt, such
+// as Ctrl-C in a terminal, until stop is called. While it's active the
+// interrupt doesn't terminate the process.
+func notifyInterrupt(cancel func()) (stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// EnableSignalAttach opens a REPL with the scope returned by scopeProvider
+// every time the process receives sig, typically syscall.SIGUSR1, until
+// disable is called. The provider usually exposes package-level registries
+// of the program, since there's no local scope to capture.
+//
+// The REPL runs on the terminal if stdin is one. Otherwise it waits for a
+// connection on the listen address, which defaults to the unix socket
+// go-pry attach <pid> connects to. The signal is ignored while a session is
+// open.
+//
+// By default the Go runtime terminates the process on SIGUSR1 and most other
+// signals. While signal attach is enabled the signal only opens the REPL;
+// once disable is called the default action applies again, unless other code
+// called signal.Notify for the same signal. When built with -tags prynoop
+// the handler isn't installed, and while breakpoints are disabled the signal
+// is logged and ignored.
+func EnableSignalAttach(sig os.Signal, scopeProvider func() *Scope, opts ...Option) (disable func()) {
+	if !buildEnabled {
+		return func() {}
+	}
+	_, filePathRaw, lineNum, _ := runtime.Caller(1)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig)
+	done := make(chan struct{})
+	var active int32
+	go func() {
+		for {
+			select {
+			case <-c:
+				if skipped(filePathRaw, lineNum) {
+					continue
+				}
+				if !atomic.CompareAndSwapInt32(&active, 0, 1) {
+					continue
+				}
+				go func() {
+					defer atomic.StoreInt32(&active, 0)
+					signalSession(sig, scopeProvider(), newConfig(opts...), filePathRaw, lineNum)
+				}()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
+
+// signalSession runs the session opened by sig. There's no source to show
+// or type check statements against, so it's started without a file. It's a
+// variable so tests can observe the sessions without a terminal.
+var signalSession = func(sig os.Signal, scope *Scope, config *Config, filePathRaw string, lineNum int) {
+	where := fmt.Sprintf("%s:%d", filePathRaw, lineNum)
+	if len(config.ListenAddr) == 0 && !interactive() {
+		config.ListenAddr = unixPrefix
+	}
+	if len(config.ListenAddr) > 0 {
+		log.Printf("pry: %s: received %v", where, sig)
+		if err := listenAndServe(scope, config, "", filePathRaw, lineNum); err != nil {
+			log.Printf("pry: %s: %+v", where, err)
+		}
+		return
+	}
+
+	if !config.queue.acquire(os.Stdout, filePathRaw, lineNum, config.ContinueIfBusy) {
+		return
+	}
+	defer config.queue.release()
+	defer lockTerminal()()
+
+	out, tty := openTTY()
+	defer tty.Close()
+	if !isTerminal(out) {
+		config.Theme = NoColorTheme
+		config.PagerThreshold = -1
+	}
+	if err := apply(scope, config, out, tty, "", filePathRaw, lineNum); err != nil {
+		log.Printf("pry: %s: %+v", where, err)
+	}
+}
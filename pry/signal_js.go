@@ -0,0 +1,16 @@
+// +build js
+
+package pry
+
+import "os"
+
+// notifyInterrupt is a no-op in the browser, which has no process signals.
+func notifyInterrupt(cancel func()) (stop func()) {
+	return func() {}
+}
+
+// EnableSignalAttach does nothing in the browser, which has no process
+// signals.
+func EnableSignalAttach(sig os.Signal, scopeProvider func() *Scope, opts ...Option) (disable func()) {
+	return func() {}
+}
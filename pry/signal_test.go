@@ -0,0 +1,132 @@
+// +build !js,!windows
+
+package pry
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestSignalAttach(t *testing.T) {
+	// Keep the default action of SIGUSR1, terminating the process, from
+	// applying once signal attach is disabled.
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	defer signal.Stop(c)
+
+	sessions := make(chan *Scope)
+	release := make(chan struct{})
+	defer func(session func(os.Signal, *Scope, *Config, string, int)) {
+		signalSession = session
+	}(signalSession)
+	signalSession = func(sig os.Signal, scope *Scope, config *Config, filePathRaw string, lineNum int) {
+		sessions <- scope
+		<-release
+	}
+
+	scope := NewScope()
+	disable := EnableSignalAttach(syscall.SIGUSR1, func() *Scope { return scope })
+	signalSelf := func() {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectSession := func(want bool) {
+		select {
+		case got := <-sessions:
+			if !want {
+				t.Fatal("Expected the signal to be ignored")
+			}
+			if got != scope {
+				t.Errorf("Expected %#v got %#v.", scope, got)
+			}
+		case <-time.After(500 * time.Millisecond):
+			if want {
+				t.Fatal("Expected the signal to open a session")
+			}
+		}
+	}
+
+	signalSelf()
+	expectSession(true)
+	// The signal is ignored while the session is open.
+	signalSelf()
+	expectSession(false)
+	release <- struct{}{}
+
+	succeedsSoon(t, func() error {
+		signalSelf()
+		select {
+		case <-sessions:
+			return nil
+		case <-time.After(100 * time.Millisecond):
+			return errors.New("the signal didn't open a session after the previous one ended")
+		}
+	})
+	release <- struct{}{}
+
+	disable()
+	disable()
+	signalSelf()
+	expectSession(false)
+}
+
+func TestSignalAttachSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-pry-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pry.sock")
+
+	scope := NewScope()
+	scope.Set("answer", 42)
+	disable := EnableSignalAttach(syscall.SIGUSR2, func() *Scope { return scope },
+		WithHistoryFile(""), WithListenAddr(unixPrefix+path))
+	defer disable()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	var conn net.Conn
+	succeedsSoon(t, func() error {
+		conn, err = net.Dial("unix", path)
+		return err
+	})
+	defer conn.Close()
+	if _, err := conn.Write([]byte("answer\r")); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	r := telnetReader{bufio.NewReader(conn)}
+	succeedsSoon(t, func() error {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		buf := make([]byte, 1024)
+		n, _ := r.Read(buf)
+		out.Write(buf[:n])
+		if !strings.Contains(ansiEscape.ReplaceAllString(out.String(), ""), "=> 42\r\n") {
+			return errors.Errorf("expected the answer in the output\nOutput:\n%s\n", out.String())
+		}
+		return nil
+	})
+	if _, err := conn.Write([]byte("continue\r")); err != nil {
+		t.Fatal(err)
+	}
+	succeedsSoon(t, func() error {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			return errors.Errorf("expected the socket to be removed; got %v", err)
+		}
+		return nil
+	})
+}
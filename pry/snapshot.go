@@ -0,0 +1,282 @@
+package pry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// VarSnapshot is a variable of a scope as SnapshotJSON encodes it.
+type VarSnapshot struct {
+	// Type is the type of the variable, like :vars shows it. Ex: "[]int" or
+	// "error"
+	Type string `json:"type"`
+	// Kind is the kind of the value. Ex: "slice", "func" or "nil"
+	Kind string `json:"kind"`
+	// Value is the value encoded as JSON.
+	Value interface{} `json:"value"`
+	// Addressable is set when assigning to the variable changes it, rather
+	// than a copy of a value of the program, such as a range variable.
+	Addressable bool `json:"addressable"`
+}
+
+// SnapshotJSON encodes the variables visible from scope, for tools such as
+// dashboards showing the state of a breakpoint, as a JSON object of names to
+// VarSnapshot. Packages and shadowed variables are left out.
+//
+// Values are encoded as JSON with the depth and number of elements Inspect
+// shows, set with WithInspectDepth and WithInspectMaxElems, and values with a
+// MarshalJSON method encode themselves. Pointers are encoded as the value
+// they point to and errors as their message. What JSON can't hold is encoded
+// as an object with a single key:
+//
+//   - {"$unencodable": "chan int"} for funcs, chans and unsafe pointers.
+//   - {"$elided": "main.Node"} for values nested too deeply.
+//   - {"$ref": "list.next"} for values referring back to a value containing
+//     them, which is where it is.
+//   - {"$more": 5} ends arrays, or is a key of objects, that had elements
+//     left out.
+//
+// Floats that aren't finite and complex numbers are encoded as strings, as
+// in "NaN".
+func (scope *Scope) SnapshotJSON(opts ...Option) ([]byte, error) {
+	c := &Config{
+		InspectDepth:    defaultInspectDepth,
+		InspectMaxElems: defaultInspectMaxElems,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return json.Marshal(scope.snapshot(c))
+}
+
+// MarshalJSON is SnapshotJSON with the default settings.
+func (scope *Scope) MarshalJSON() ([]byte, error) {
+	return scope.SnapshotJSON()
+}
+
+// snapshot returns the variables visible from scope, their values encoded
+// with the Inspect settings of c.
+func (scope *Scope) snapshot(c *Config) map[string]VarSnapshot {
+	out := map[string]VarSnapshot{}
+	for _, b := range scope.bindings() {
+		if _, isPackage := b.value.(Package); isPackage || b.shadowed {
+			continue
+		}
+		s := &snapshotter{config: c, path: map[inspectKey]string{}}
+		kind := "nil"
+		switch v := b.value.(type) {
+		case nil:
+		case *Func:
+			kind = "func"
+		default:
+			kind = reflect.TypeOf(v).Kind().String()
+		}
+		out[b.name] = VarSnapshot{
+			Type:        b.typeString(),
+			Kind:        kind,
+			Value:       s.value(reflect.ValueOf(b.value), b.name, 0),
+			Addressable: !b.readOnly,
+		}
+	}
+	return out
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	funcPtrType       = reflect.TypeOf(&Func{})
+)
+
+// snapshotter encodes values for SnapshotJSON.
+type snapshotter struct {
+	config *Config
+	// path holds where the values containing the one being encoded are, so
+	// values referring back to them are found.
+	path map[inspectKey]string
+}
+
+// enter adds the value identified by key, found at at, to the path until
+// leave is called. If it's already on it, it returns a reference to where it
+// is instead.
+func (s *snapshotter) enter(key inspectKey, at string) (leave func(), ref interface{}) {
+	if target, ok := s.path[key]; ok {
+		return nil, map[string]interface{}{"$ref": target}
+	}
+	s.path[key] = at
+	return func() { delete(s.path, key) }, nil
+}
+
+// tooDeep returns the placeholder of v if it's nested more than the allowed
+// depth deep.
+func (s *snapshotter) tooDeep(v reflect.Value, depth int) (interface{}, bool) {
+	if max := s.config.InspectDepth; max > 0 && depth >= max {
+		return map[string]interface{}{"$elided": v.Type().String()}, true
+	}
+	return nil, false
+}
+
+// maxElems returns how many of n elements are encoded.
+func (s *snapshotter) maxElems(n int) int {
+	if max := s.config.InspectMaxElems; max > 0 && n > max {
+		return max
+	}
+	return n
+}
+
+// value encodes v, found at at, nested depth levels deep.
+func (s *snapshotter) value(v reflect.Value, at string, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Type() == funcPtrType && !v.IsNil() {
+		return map[string]interface{}{"$unencodable": v.Interface().(*Func).signature()}
+	}
+	if raw, ok := marshalSelf(v); ok {
+		return raw
+	}
+	if v.CanInterface() && v.Type().Implements(errorType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		if msg, ok := errorMessage(v.Interface().(error)); ok {
+			return msg
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return s.value(v.Elem(), at, depth)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		leave, ref := s.enter(inspectKey{ptr: v.Pointer(), typ: v.Type()}, at)
+		if ref != nil {
+			return ref
+		}
+		defer leave()
+		return s.value(v.Elem(), at, depth)
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if elided, ok := s.tooDeep(v, depth); ok {
+			return elided
+		}
+		leave, ref := s.enter(inspectKey{ptr: v.Pointer(), typ: v.Type()}, at)
+		if ref != nil {
+			return ref
+		}
+		defer leave()
+		keys := sortedKeys(v)
+		out := map[string]interface{}{}
+		n := s.maxElems(len(keys))
+		for _, key := range keys[:n] {
+			name := fmt.Sprint(key)
+			elemAt := at + "[" + name + "]"
+			if key.Kind() == reflect.String {
+				elemAt = at + "[" + strconv.Quote(name) + "]"
+			}
+			out[name] = s.value(v.MapIndex(key), elemAt, depth+1)
+		}
+		if n < len(keys) {
+			out["$more"] = len(keys) - n
+		}
+		return out
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			if b := v.Bytes(); utf8.Valid(b) {
+				return string(b)
+			}
+		}
+		if elided, ok := s.tooDeep(v, depth); ok {
+			return elided
+		}
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			leave, ref := s.enter(inspectKey{ptr: v.Pointer(), typ: v.Type(), len: v.Len()}, at)
+			if ref != nil {
+				return ref
+			}
+			defer leave()
+		}
+		n := s.maxElems(v.Len())
+		out := make([]interface{}, 0, n+1)
+		for i := 0; i < n; i++ {
+			out = append(out, s.value(v.Index(i), at+"["+strconv.Itoa(i)+"]", depth+1))
+		}
+		if n < v.Len() {
+			out = append(out, map[string]interface{}{"$more": v.Len() - n})
+		}
+		return out
+
+	case reflect.Struct:
+		if elided, ok := s.tooDeep(v, depth); ok {
+			return elided
+		}
+		out := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Name
+			out[name] = s.value(v.Field(i), at+"."+name, depth+1)
+		}
+		return out
+
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, v.Type().Bits()))
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
+	}
+	return map[string]interface{}{"$unencodable": v.Type().String()}
+}
+
+// marshalSelf encodes v with its MarshalJSON method, if it has one that
+// works.
+func marshalSelf(v reflect.Value) (raw json.RawMessage, ok bool) {
+	if !v.CanInterface() || !v.Type().Implements(jsonMarshalerType) {
+		return nil, false
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	defer func() {
+		// Methods that panic are treated as if the values didn't have them.
+		if recover() != nil {
+			raw, ok = nil, false
+		}
+	}()
+	b, err := v.Interface().(json.Marshaler).MarshalJSON()
+	if err != nil || !json.Valid(b) {
+		return nil, false
+	}
+	return b, true
+}
+
+// errorMessage returns the message of err, unless its Error method panics.
+func errorMessage(err error) (msg string, ok bool) {
+	defer func() {
+		if recover() != nil {
+			msg, ok = "", false
+		}
+	}()
+	return err.Error(), true
+}
@@ -0,0 +1,120 @@
+package pry
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type snapshotNode struct {
+	Name string
+	Next *snapshotNode
+	tags []string
+}
+
+// decodeSnapshot decodes the snapshot of scope.
+func decodeSnapshot(t *testing.T, scope *Scope, opts ...Option) map[string]VarSnapshot {
+	t.Helper()
+
+	b, err := scope.SnapshotJSON(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]VarSnapshot
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("%s: %s", err, b)
+	}
+	return out
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	t.Parallel()
+
+	parent := NewScope()
+	parent.Set("shadowed", 1)
+	parent.Set("strings", Package{Name: "strings", Path: "strings"})
+	scope := parent.NewChild()
+	scope.Set("shadowed", "inner")
+	scope.Set("n", 3)
+	scope.Set("f", 1.5)
+	scope.Set("nan", math.NaN())
+	scope.Set("c", 1+2i)
+	scope.Set("b", []byte("hi"))
+	scope.Set("nothing", nil)
+	scope.Set("err", errors.New("boom"))
+	scope.Set("when", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	scope.Set("ch", make(chan int))
+	scope.Set("m", map[int][]string{2: {"b"}, 1: {"a"}})
+	node := &snapshotNode{Name: "a", tags: []string{"x"}}
+	node.Next = &snapshotNode{Name: "b", Next: node}
+	scope.Set("node", node)
+	if _, err := scope.InterpretString("double := func(x int) int { return x * 2 }; var failure error"); err != nil {
+		t.Fatal(err)
+	}
+	scope.ReadOnly = map[string]bool{"n": true}
+
+	out := decodeSnapshot(t, scope)
+	want := map[string]VarSnapshot{
+		"shadowed": {Type: "string", Kind: "string", Value: "inner", Addressable: true},
+		"n":        {Type: "int", Kind: "int", Value: 3.0},
+		"f":        {Type: "float64", Kind: "float64", Value: 1.5, Addressable: true},
+		"nan":      {Type: "float64", Kind: "float64", Value: "NaN", Addressable: true},
+		"c":        {Type: "complex128", Kind: "complex128", Value: "(1+2i)", Addressable: true},
+		"b":        {Type: "[]uint8", Kind: "slice", Value: "hi", Addressable: true},
+		"nothing":  {Type: "nil", Kind: "nil", Addressable: true},
+		"err":      {Type: "*errors.errorString", Kind: "ptr", Value: "boom", Addressable: true},
+		"when":     {Type: "time.Time", Kind: "struct", Value: "2020-01-02T03:04:05Z", Addressable: true},
+		"ch":       {Type: "chan int", Kind: "chan", Value: map[string]interface{}{"$unencodable": "chan int"}, Addressable: true},
+		"m": {Type: "map[int][]string", Kind: "map", Value: map[string]interface{}{
+			"1": []interface{}{"a"},
+			"2": []interface{}{"b"},
+		}, Addressable: true},
+		"node": {Type: "*pry.snapshotNode", Kind: "ptr", Value: map[string]interface{}{
+			"Name": "a",
+			"Next": map[string]interface{}{
+				"Name": "b",
+				"Next": map[string]interface{}{"$ref": "node"},
+				"tags": nil,
+			},
+			"tags": []interface{}{"x"},
+		}, Addressable: true},
+		"failure": {Type: "error", Kind: "nil", Addressable: true},
+		"double":  {Type: "func(x int) int", Kind: "func", Value: map[string]interface{}{"$unencodable": "func(x int) int"}, Addressable: true},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Expected %#v got %#v.", want, out)
+	}
+
+	// MarshalJSON encodes the same snapshot.
+	b, err := json.Marshal(scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, _ := scope.SnapshotJSON(); string(b) != string(snapshot) {
+		t.Errorf("Expected %s got %s.", snapshot, b)
+	}
+}
+
+func TestSnapshotJSONLimits(t *testing.T) {
+	t.Parallel()
+
+	scope := NewScope()
+	scope.Set("xs", []int{1, 2, 3, 4})
+	scope.Set("m", map[string]int{"a": 1, "b": 2, "c": 3})
+	scope.Set("nested", [][]int{{1}, {2}})
+
+	out := decodeSnapshot(t, scope, WithInspectMaxElems(2), WithInspectDepth(1))
+	want := map[string]interface{}{
+		"xs":     []interface{}{1.0, 2.0, map[string]interface{}{"$more": 2.0}},
+		"m":      map[string]interface{}{"a": 1.0, "b": 2.0, "$more": 1.0},
+		"nested": []interface{}{map[string]interface{}{"$elided": "[]int"}, map[string]interface{}{"$elided": "[]int"}},
+	}
+	for name, value := range want {
+		if !reflect.DeepEqual(out[name].Value, value) {
+			t.Errorf("%s: Expected %#v got %#v.", name, value, out[name].Value)
+		}
+	}
+}
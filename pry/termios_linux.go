@@ -0,0 +1,9 @@
+package pry
+
+import "syscall"
+
+// The ioctl requests getting and setting the state of a terminal.
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,79 @@
+package pry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// errTimeout is returned by timeoutTTY when there's no input in time.
+var errTimeout = errors.New("timed out waiting for input")
+
+// timeoutTTY is a TTY whose ReadRune gives up with errTimeout if no input
+// arrives within the timeout. Every call waits for the full timeout, so any
+// key press restarts the countdown.
+type timeoutTTY struct {
+	genericTTY
+	timeout time.Duration
+
+	start, stop sync.Once
+	runes       chan runeResult
+	done        chan struct{}
+}
+
+type runeResult struct {
+	r    rune
+	size int
+	err  error
+}
+
+func newTimeoutTTY(tty genericTTY, timeout time.Duration) *timeoutTTY {
+	return &timeoutTTY{
+		genericTTY: tty,
+		timeout:    timeout,
+		runes:      make(chan runeResult),
+		done:       make(chan struct{}),
+	}
+}
+
+// read forwards runes from the underlying TTY until it fails or is closed.
+func (t *timeoutTTY) read() {
+	for {
+		r, size, err := t.genericTTY.ReadRune()
+		select {
+		case t.runes <- runeResult{r, size, err}:
+		case <-t.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *timeoutTTY) ReadRune() (rune, int, error) {
+	t.start.Do(func() {
+		go t.read()
+	})
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	select {
+	case res := <-t.runes:
+		return res.r, res.size, res.err
+	case <-timer.C:
+		return 0, 0, errTimeout
+	}
+}
+
+// Stop stops forwarding runes without closing the underlying TTY.
+func (t *timeoutTTY) Stop() {
+	t.stop.Do(func() {
+		close(t.done)
+	})
+}
+
+func (t *timeoutTTY) Close() error {
+	t.Stop()
+	return t.genericTTY.Close()
+}
@@ -0,0 +1,62 @@
+package pry
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestTimeoutTTY(t *testing.T) {
+	t.Parallel()
+
+	tty := makeTestTTY()
+	timed := newTimeoutTTY(tty, 50*time.Millisecond)
+	defer timed.Close()
+
+	if _, _, err := timed.ReadRune(); err != errTimeout {
+		t.Fatalf("Expected %#v got %#v.", errTimeout, err)
+	}
+	go tty.Write([]byte("a"))
+	r, _, err := timed.ReadRune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 'a' {
+		t.Errorf("Expected %#v got %#v.", 'a', r)
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	SetDefaultTimeout(time.Minute)
+	defer SetDefaultTimeout(0)
+
+	if c := newConfig(); c.Timeout != time.Minute {
+		t.Errorf("Expected %#v got %#v.", time.Minute, c.Timeout)
+	}
+	if c := newConfig(WithTimeout(time.Second)); c.Timeout != time.Second {
+		t.Errorf("Expected %#v got %#v.", time.Second, c.Timeout)
+	}
+}
+
+func TestCLITimeout(t *testing.T) {
+	t.Parallel()
+
+	env := testPryApply(t, WithTimeout(100*time.Millisecond))
+	// The session has ended, so nothing reads the input Close writes.
+	defer func() {
+		env.testTTY.Close()
+		os.RemoveAll(env.dir)
+	}()
+	env.Scope.Set("answer", 42)
+
+	succeedsSoon(t, func() error {
+		out := env.Output()
+		if !strings.Contains(out, "No input for 100ms, continuing.") || !strings.Contains(out, "answer") {
+			return errors.Errorf("expected the session to time out and print the scope\nOutput:\n%s\n", out)
+		}
+		return nil
+	})
+}
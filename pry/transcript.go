@@ -0,0 +1,203 @@
+package pry
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// transcriptBuffer is the number of bytes a transcript holds while they're
+// written. More are dropped rather than making the session wait for the
+// disk.
+const transcriptBuffer = 1 << 20
+
+// transcript records the prompts, inputs and output of a session to a file,
+// without the escape sequences of colors. It's written in the background so
+// a slow disk never holds up evaluation.
+type transcript struct {
+	path       string
+	timestamps bool
+
+	mu sync.Mutex
+	// buf holds the bytes waiting to be written, at most limit of them.
+	buf   []byte
+	limit int
+	// dropped is the number of bytes dropped since the last warning and
+	// err the error that stopped the writing, if any.
+	dropped int
+	err     error
+	closed  bool
+
+	w    io.WriteCloser
+	wake chan struct{}
+	done chan struct{}
+}
+
+// openTranscript starts recording to the file at path, appending to it if
+// it exists.
+func openTranscript(path string, timestamps bool) (*transcript, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening the transcript")
+	}
+	t := newTranscript(f, transcriptBuffer)
+	t.path = path
+	t.timestamps = timestamps
+	return t, nil
+}
+
+// newTranscript returns a transcript writing to w, holding up to limit
+// bytes while they're written.
+func newTranscript(w io.WriteCloser, limit int) *transcript {
+	t := &transcript{
+		limit: limit,
+		w:     w,
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// run writes the buffered bytes until the transcript is closed.
+func (t *transcript) run() {
+	defer close(t.done)
+	for range t.wake {
+		for {
+			t.mu.Lock()
+			buf := t.buf
+			t.buf = nil
+			closed := t.closed
+			t.mu.Unlock()
+			if len(buf) == 0 {
+				if closed {
+					return
+				}
+				break
+			}
+			if _, err := t.w.Write(buf); err != nil {
+				t.mu.Lock()
+				t.err = errors.Wrap(err, "writing the transcript")
+				t.mu.Unlock()
+				return
+			}
+		}
+	}
+}
+
+// Write records the output p. It never blocks on the file.
+func (t *transcript) Write(p []byte) (int, error) {
+	t.add(ansiEscape.ReplaceAllLiteral(p, nil))
+	return len(p), nil
+}
+
+// input records the input line typed after prompt, as a new entry.
+func (t *transcript) input(prompt, line string) {
+	entry := ansiEscape.ReplaceAllString(prompt, "") + line + "\n"
+	if t.timestamps {
+		entry = time.Now().Format("[15:04:05] ") + entry
+	}
+	t.add([]byte(entry))
+}
+
+// add queues b to be written, or drops it if the buffer is full.
+func (t *transcript) add(b []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.err != nil {
+		return
+	}
+	if len(t.buf)+len(b) > t.limit {
+		t.dropped += len(b)
+		return
+	}
+	t.buf = append(t.buf, b...)
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// warning returns what went wrong since it was last called: bytes dropped
+// or an error that stopped the writing. It's empty if nothing did.
+func (t *transcript) warning() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var warning string
+	if t.dropped > 0 {
+		warning = fmt.Sprintf("the transcript dropped %d bytes of output because the disk is too slow", t.dropped)
+		t.dropped = 0
+	}
+	if t.err != nil {
+		if len(warning) > 0 {
+			warning += "; "
+		}
+		warning += t.err.Error() + "; recording stopped"
+		t.err = nil
+		t.closed = true
+	}
+	return warning
+}
+
+// Close writes what's buffered and closes the file. It returns the error
+// that stopped the writing, if any.
+func (t *transcript) Close() error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.wake)
+	}
+	t.mu.Unlock()
+	<-t.done
+	t.mu.Lock()
+	err := t.err
+	t.mu.Unlock()
+	if cerr := t.w.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "closing the transcript")
+	}
+	return err
+}
+
+// record starts recording the session to the file at path, instead of the
+// file it was recorded to.
+func (s *session) record(path string, timestamps bool) error {
+	t, err := openTranscript(path, timestamps)
+	if err != nil {
+		return err
+	}
+	if err := s.stopRecording(); err != nil {
+		t.Close()
+		return err
+	}
+	s.transcript = t
+	return nil
+}
+
+// stopRecording stops recording the session, if it's recorded, once what's
+// buffered is written.
+func (s *session) stopRecording() error {
+	if s.transcript == nil {
+		return nil
+	}
+	err := s.transcript.Close()
+	s.transcript = nil
+	return err
+}
+
+// recordedWriter writes to w, and to the transcript of the session while
+// it's recorded.
+type recordedWriter struct {
+	w    io.Writer
+	sess *session
+}
+
+func (r recordedWriter) Write(p []byte) (int, error) {
+	if t := r.sess.transcript; t != nil {
+		t.Write(p)
+	}
+	return r.w.Write(p)
+}
@@ -5,10 +5,25 @@ package pry
 import (
 	"io"
 	"log"
+	"os"
+	"sync"
 	"syscall/js"
 )
 
-var tty = newWASMTTY()
+// tty is the xterm.js terminal of the page, the global term. It's set up when
+// it's first used, so pages without a terminal, such as those only
+// evaluating code with JSEval, can load the package.
+var tty struct {
+	once sync.Once
+	t    *wasmTTY
+}
+
+func wasmTerminal() *wasmTTY {
+	tty.once.Do(func() {
+		tty.t = newWASMTTY()
+	})
+	return tty.t
+}
 
 func newWASMTTY() *wasmTTY {
 
@@ -29,11 +44,25 @@ func newWASMTTY() *wasmTTY {
 
 func init() {
 	log.SetFlags(log.Flags() | log.Lshortfile)
-	log.SetOutput(tty)
+	if term := js.Global().Get("term"); !term.IsUndefined() && !term.IsNull() {
+		log.SetOutput(wasmTerminal())
+	}
 }
 
 func openTTY() (io.Writer, genericTTY) {
-	return tty, tty
+	t := wasmTerminal()
+	return t, t
+}
+
+// interactive returns whether someone can type into the terminal, which is
+// always the case in the browser.
+func interactive() bool {
+	return true
+}
+
+// lockTerminal is a no-op in the browser, which runs a single program.
+func lockTerminal() (unlock func()) {
+	return func() {}
 }
 
 type wasmTTY struct {
@@ -46,12 +75,12 @@ func (t *wasmTTY) Write(buf []byte) (int, error) {
 	return len(buf), nil
 }
 
-func (t *wasmTTY) ReadRune() (rune, error) {
+func (t *wasmTTY) ReadRune() (rune, int, error) {
 	var buf [1]byte
 	if _, err := t.r.Read(buf[:]); err != nil {
-		return 0, err
+		return 0, 0, err
 	}
-	return rune(buf[0]), nil
+	return rune(buf[0]), 1, nil
 }
 
 func (t *wasmTTY) Size() (int, int, error) {
@@ -61,3 +90,9 @@ func (t *wasmTTY) Size() (int, int, error) {
 func (t *wasmTTY) Close() error {
 	return nil
 }
+
+// suspendTerminal does nothing in the browser, which can't run other
+// programs.
+func suspendTerminal(tty genericTTY) (in, out *os.File, resume func(), err error) {
+	return nil, nil, func() {}, nil
+}
@@ -0,0 +1,23 @@
+// +build !js
+
+package pry
+
+import (
+	"unicode/utf8"
+
+	gotty "github.com/mattn/go-tty"
+)
+
+// terminalTTY is the terminal of the program as a genericTTY.
+type terminalTTY struct {
+	*gotty.TTY
+}
+
+// ReadRune reads a key typed on the terminal.
+func (t terminalTTY) ReadRune() (rune, int, error) {
+	r, err := t.TTY.ReadRune()
+	if err != nil {
+		return 0, 0, err
+	}
+	return r, utf8.RuneLen(r), nil
+}
@@ -1,10 +1,12 @@
-// +build linux darwin
+// +build linux darwin dragonfly freebsd netbsd openbsd
 
 package pry
 
 import (
 	"io"
 	"os"
+	"syscall"
+	"unsafe"
 
 	gotty "github.com/mattn/go-tty"
 )
@@ -14,5 +16,40 @@ func openTTY() (io.Writer, genericTTY) {
 	if err != nil {
 		panic(err)
 	}
-	return os.Stdout, tty
+	if inTest() && !isTerminal(os.Stdout) {
+		return tty.Output(), terminalTTY{tty}
+	}
+	return os.Stdout, terminalTTY{tty}
+}
+
+// interactive returns whether someone can type into the terminal: stdin is
+// one or, in tests, the process has a controlling terminal.
+func interactive() bool {
+	return isTerminal(os.Stdin) && !isDevNull(os.Stdin) || inTest() && hasTerminal()
+}
+
+// suspendTerminal hands the terminal tty reads from over to a child process,
+// with echo and line editing on as programs expect, and returns the files of
+// the terminal and the function taking it back for the session. The files
+// are nil if tty isn't a terminal.
+func suspendTerminal(tty genericTTY) (in, out *os.File, resume func(), err error) {
+	term, ok := unwrapTTY(tty).(terminalTTY)
+	if !ok {
+		return nil, nil, func() {}, nil
+	}
+	fd := term.Input().Fd()
+	var saved syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&saved))); errno != 0 {
+		return nil, nil, nil, errno
+	}
+	cooked := saved
+	cooked.Iflag |= syscall.ICRNL
+	cooked.Oflag |= syscall.OPOST
+	cooked.Lflag |= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&cooked))); errno != 0 {
+		return nil, nil, nil, errno
+	}
+	return term.Input(), term.Output(), func() {
+		syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&saved)))
+	}, nil
 }
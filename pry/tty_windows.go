@@ -4,6 +4,7 @@ package pry
 
 import (
 	"io"
+	"os"
 
 	colorable "github.com/mattn/go-colorable"
 	gotty "github.com/mattn/go-tty"
@@ -14,5 +15,25 @@ func openTTY() (io.Writer, genericTTY) {
 	if err != nil {
 		panic(err)
 	}
-	return colorable.NewColorableStdout(), tty
+	if inTest() && !isTerminal(os.Stdout) {
+		return colorable.NewColorable(tty.Output()), terminalTTY{tty}
+	}
+	return colorable.NewColorableStdout(), terminalTTY{tty}
+}
+
+// interactive returns whether someone can type into the terminal: stdin is
+// one or, in tests, the process has a console.
+func interactive() bool {
+	return isTerminal(os.Stdin) && !isDevNull(os.Stdin) || inTest() && hasTerminal()
+}
+
+// suspendTerminal hands the console tty reads from over to a child process
+// and returns its files and the function taking it back for the session.
+// The files are nil if tty isn't a console.
+func suspendTerminal(tty genericTTY) (in, out *os.File, resume func(), err error) {
+	term, ok := unwrapTTY(tty).(terminalTTY)
+	if !ok {
+		return nil, nil, func() {}, nil
+	}
+	return term.Input(), term.Output(), func() {}, nil
 }
@@ -0,0 +1,87 @@
+package pry
+
+import "reflect"
+
+// defaultUndoLevels is the number of inputs :undo can take back by default.
+const defaultUndoLevels = 20
+
+// checkpoint is the state of the variables of a scope and its parents before
+// an input, which :undo goes back to. Variables are copied shallowly, so
+// changes made through the pointers, slices and maps they hold aren't taken
+// back.
+type checkpoint struct {
+	input  string
+	scopes []scopeState
+	// entry is the index of the input in the session entries.
+	entry int
+	// nativeCalls is the number of native calls the input made, whose
+	// effects outside the interpreter can't be taken back.
+	nativeCalls int
+}
+
+// scopeState is the state of the variables of one scope.
+type scopeState struct {
+	scope    *Scope
+	vals     map[string]interface{}
+	readOnly map[string]bool
+	// values holds copies of the variables vals points to, since
+	// assignments change them in place.
+	values map[string]reflect.Value
+}
+
+// takeCheckpoint returns the state of the variables of scope and its
+// parents.
+func takeCheckpoint(scope *Scope) *checkpoint {
+	c := &checkpoint{}
+	for s := scope; s != nil; s = s.Parent {
+		state := scopeState{
+			scope:    s,
+			vals:     map[string]interface{}{},
+			readOnly: map[string]bool{},
+			values:   map[string]reflect.Value{},
+		}
+		s.Lock()
+		for name, val := range s.Vals {
+			state.vals[name] = val
+			if _, isType := val.(reflect.Type); isType || val == nil {
+				continue
+			}
+			if ptr := reflect.ValueOf(val); ptr.Kind() == reflect.Ptr && !ptr.IsNil() {
+				value := reflect.New(ptr.Type().Elem()).Elem()
+				value.Set(ptr.Elem())
+				state.values[name] = value
+			}
+		}
+		for name, readOnly := range s.ReadOnly {
+			state.readOnly[name] = readOnly
+		}
+		s.Unlock()
+		c.scopes = append(c.scopes, state)
+	}
+	return c
+}
+
+// restore puts the variables back as they were when c was taken. Names
+// defined since are removed, and the variables of the program are written
+// back through their pointers.
+func (c *checkpoint) restore() {
+	for _, state := range c.scopes {
+		s := state.scope
+		s.Lock()
+		s.Vals = map[string]interface{}{}
+		for name, val := range state.vals {
+			s.Vals[name] = val
+			if value, ok := state.values[name]; ok {
+				reflect.ValueOf(val).Elem().Set(value)
+			}
+		}
+		s.ReadOnly = nil
+		if len(state.readOnly) > 0 {
+			s.ReadOnly = map[string]bool{}
+			for name, readOnly := range state.readOnly {
+				s.ReadOnly[name] = readOnly
+			}
+		}
+		s.Unlock()
+	}
+}
@@ -0,0 +1,93 @@
+// +build !js
+
+package pry
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// wasmSmokeScript loads the wasm binary given as its argument with Node and
+// prints what pryEval returns.
+const wasmSmokeScript = `
+globalThis.require = require;
+globalThis.fs = require("fs");
+globalThis.path = require("path");
+globalThis.TextEncoder = require("util").TextEncoder;
+globalThis.TextDecoder = require("util").TextDecoder;
+globalThis.performance ??= require("perf_hooks").performance;
+globalThis.crypto ??= require("crypto");
+require(process.argv[2]);
+
+const go = new Go();
+WebAssembly.instantiate(fs.readFileSync(process.argv[3]), go.importObject).then((result) => {
+	go.run(result.instance);
+	for (const src of ["2 + 2", "x := 1", "undefinedVar"]) {
+		console.log(JSON.stringify(pryEval(src)));
+	}
+	process.exit(0);
+}).catch((err) => {
+	console.error(err);
+	process.exit(1);
+});
+`
+
+func TestWASMBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the package for js/wasm")
+	}
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "go-pry-wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wasm := filepath.Join(dir, "eval.wasm")
+
+	// The package and its subpackages build for the browser, and so does the
+	// command exposing pryEval.
+	for _, args := range [][]string{{"build", "./..."}, {"build", "-o", wasm, "../playground/eval"}} {
+		cmd := exec.Command("go", args...)
+		cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node isn't installed")
+	}
+	var wasmExec string
+	for _, dir := range []string{"lib/wasm", "misc/wasm"} {
+		path := filepath.Join(runtime.GOROOT(), dir, "wasm_exec.js")
+		if _, err := os.Stat(path); err == nil {
+			wasmExec = path
+			break
+		}
+	}
+	if len(wasmExec) == 0 {
+		t.Skip("wasm_exec.js isn't in GOROOT")
+	}
+	script := filepath.Join(dir, "smoke.js")
+	if err := ioutil.WriteFile(script, []byte(wasmSmokeScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(node, script, wasmExec, wasm).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	want := `{"result":"4","error":""}
+{"result":"","error":""}
+{"result":"","error":"undefined: undefinedVar"}
+`
+	if string(out) != want {
+		t.Errorf("Expected %#v got %#v.", want, string(out))
+	}
+}
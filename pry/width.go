@@ -0,0 +1,245 @@
+package pry
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// wideRanges are the ranges of runes taking up two columns in a terminal:
+// the East Asian wide and fullwidth characters and the emoji shown as
+// pictures.
+var wideRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1},
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1},
+		{Lo: 0x2329, Hi: 0x232a, Stride: 1},
+		{Lo: 0x23e9, Hi: 0x23ec, Stride: 1},
+		{Lo: 0x23f0, Hi: 0x23f3, Stride: 3},
+		{Lo: 0x25fd, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2614, Hi: 0x2615, Stride: 1},
+		{Lo: 0x2648, Hi: 0x2653, Stride: 1},
+		{Lo: 0x267f, Hi: 0x2693, Stride: 20},
+		{Lo: 0x26a1, Hi: 0x26aa, Stride: 9},
+		{Lo: 0x26ab, Hi: 0x26bd, Stride: 18},
+		{Lo: 0x26be, Hi: 0x26c4, Stride: 6},
+		{Lo: 0x26c5, Hi: 0x26ce, Stride: 9},
+		{Lo: 0x26d4, Hi: 0x26ea, Stride: 22},
+		{Lo: 0x26f2, Hi: 0x26f3, Stride: 1},
+		{Lo: 0x26f5, Hi: 0x26fa, Stride: 5},
+		{Lo: 0x26fd, Hi: 0x2705, Stride: 8},
+		{Lo: 0x270a, Hi: 0x270b, Stride: 1},
+		{Lo: 0x2728, Hi: 0x274c, Stride: 36},
+		{Lo: 0x274e, Hi: 0x2753, Stride: 5},
+		{Lo: 0x2754, Hi: 0x2755, Stride: 1},
+		{Lo: 0x2757, Hi: 0x2795, Stride: 62},
+		{Lo: 0x2796, Hi: 0x2797, Stride: 1},
+		{Lo: 0x27b0, Hi: 0x27bf, Stride: 15},
+		{Lo: 0x2b1b, Hi: 0x2b1c, Stride: 1},
+		{Lo: 0x2b50, Hi: 0x2b55, Stride: 5},
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1},
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1},
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1},
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1},
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1},
+		{Lo: 0xa960, Hi: 0xa97f, Stride: 1},
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1},
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1},
+		{Lo: 0xfe10, Hi: 0xfe19, Stride: 1},
+		{Lo: 0xfe30, Hi: 0xfe6f, Stride: 1},
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1},
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x16fe0, Hi: 0x16fe4, Stride: 1},
+		{Lo: 0x17000, Hi: 0x18cff, Stride: 1},
+		{Lo: 0x1b000, Hi: 0x1b2ff, Stride: 1},
+		{Lo: 0x1f004, Hi: 0x1f0cf, Stride: 203},
+		{Lo: 0x1f18e, Hi: 0x1f191, Stride: 3},
+		{Lo: 0x1f192, Hi: 0x1f19a, Stride: 1},
+		{Lo: 0x1f200, Hi: 0x1f202, Stride: 1},
+		{Lo: 0x1f210, Hi: 0x1f23b, Stride: 1},
+		{Lo: 0x1f240, Hi: 0x1f248, Stride: 1},
+		{Lo: 0x1f250, Hi: 0x1f251, Stride: 1},
+		{Lo: 0x1f260, Hi: 0x1f265, Stride: 1},
+		{Lo: 0x1f300, Hi: 0x1f320, Stride: 1},
+		{Lo: 0x1f32d, Hi: 0x1f335, Stride: 1},
+		{Lo: 0x1f337, Hi: 0x1f37c, Stride: 1},
+		{Lo: 0x1f37e, Hi: 0x1f393, Stride: 1},
+		{Lo: 0x1f3a0, Hi: 0x1f3ca, Stride: 1},
+		{Lo: 0x1f3cf, Hi: 0x1f3d3, Stride: 1},
+		{Lo: 0x1f3e0, Hi: 0x1f3f0, Stride: 1},
+		{Lo: 0x1f3f4, Hi: 0x1f3f8, Stride: 4},
+		{Lo: 0x1f3f9, Hi: 0x1f43e, Stride: 1},
+		{Lo: 0x1f440, Hi: 0x1f442, Stride: 2},
+		{Lo: 0x1f443, Hi: 0x1f4fc, Stride: 1},
+		{Lo: 0x1f4ff, Hi: 0x1f53d, Stride: 1},
+		{Lo: 0x1f54b, Hi: 0x1f54e, Stride: 1},
+		{Lo: 0x1f550, Hi: 0x1f567, Stride: 1},
+		{Lo: 0x1f57a, Hi: 0x1f595, Stride: 27},
+		{Lo: 0x1f596, Hi: 0x1f5a4, Stride: 14},
+		{Lo: 0x1f5fb, Hi: 0x1f64f, Stride: 1},
+		{Lo: 0x1f680, Hi: 0x1f6c5, Stride: 1},
+		{Lo: 0x1f6cc, Hi: 0x1f6d0, Stride: 4},
+		{Lo: 0x1f6d1, Hi: 0x1f6d2, Stride: 1},
+		{Lo: 0x1f6d5, Hi: 0x1f6d7, Stride: 1},
+		{Lo: 0x1f6dc, Hi: 0x1f6df, Stride: 1},
+		{Lo: 0x1f6eb, Hi: 0x1f6ec, Stride: 1},
+		{Lo: 0x1f6f4, Hi: 0x1f6fc, Stride: 1},
+		{Lo: 0x1f7e0, Hi: 0x1f7eb, Stride: 1},
+		{Lo: 0x1f7f0, Hi: 0x1f90c, Stride: 284},
+		{Lo: 0x1f90d, Hi: 0x1f93a, Stride: 1},
+		{Lo: 0x1f93c, Hi: 0x1f945, Stride: 1},
+		{Lo: 0x1f947, Hi: 0x1f9ff, Stride: 1},
+		{Lo: 0x1fa70, Hi: 0x1faff, Stride: 1},
+		{Lo: 0x20000, Hi: 0x2fffd, Stride: 1},
+		{Lo: 0x30000, Hi: 0x3fffd, Stride: 1},
+	},
+}
+
+// runeWidth returns the number of columns r takes up in a terminal: 0 for
+// control characters and the marks combining with the rune before them, 2
+// for wide characters such as CJK ideographs and emoji, and 1 otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || r >= 0x7f && r < 0xa0:
+		return 0
+	case r < 0x300:
+		return 1
+	case joinsPrevious(r) || r == zeroWidthJoiner:
+		return 0
+	case unicode.Is(wideRanges, r):
+		return 2
+	}
+	return 1
+}
+
+// stringWidth returns the number of columns s takes up in a terminal.
+func stringWidth(s string) int {
+	width := 0
+	for len(s) > 0 {
+		n := nextGrapheme(s)
+		width += graphemeWidth(s[:n])
+		s = s[n:]
+	}
+	return width
+}
+
+// graphemeWidth returns the number of columns the grapheme cluster g takes
+// up: the width of its first rune, or 2 if it's an emoji sequence or a flag.
+func graphemeWidth(g string) int {
+	r, size := utf8.DecodeRuneInString(g)
+	width := runeWidth(r)
+	if size < len(g) && width == 1 {
+		// Text presentation characters followed by VS16 and pairs of
+		// regional indicators are shown as emoji.
+		next, _ := utf8.DecodeRuneInString(g[size:])
+		if next == 0xfe0f || isRegionalIndicator(r) {
+			width = 2
+		}
+	}
+	return width
+}
+
+// zeroWidthJoiner joins emoji into a single one, like 👩‍💻.
+const zeroWidthJoiner = 0x200d
+
+// joinsPrevious returns whether r is part of the grapheme cluster of the
+// rune before it: combining marks, variation selectors and skin tones.
+func joinsPrevious(r rune) bool {
+	switch {
+	case r >= 0xfe00 && r <= 0xfe0f, r >= 0x1f3fb && r <= 0x1f3ff, r >= 0xe0020 && r <= 0xe007f:
+		return true
+	case r == 0x200b || r == 0x200c || r == 0x2060 || r == 0xfeff:
+		// Zero-width spaces take up no column, whatever they join.
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// isRegionalIndicator returns whether r is one of the letters pairs of
+// which make up flags, like 🇫🇷.
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// nextGrapheme returns the length in bytes of the grapheme cluster s starts
+// with: a rune with the marks combining with it, emoji joined by zero-width
+// joiners or a flag. Invalid UTF-8 is a cluster per byte.
+func nextGrapheme(s string) int {
+	if len(s) == 0 {
+		return 0
+	}
+	first, n := utf8.DecodeRuneInString(s)
+	if first == '\r' && len(s) > 1 && s[1] == '\n' {
+		return 2
+	}
+	if first < 0x20 || first == utf8.RuneError && n == 1 {
+		return n
+	}
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		switch {
+		case joinsPrevious(r):
+		case r == zeroWidthJoiner:
+			n += size
+			// The joiner takes the rune after it too.
+			r, size = utf8.DecodeRuneInString(s[n:])
+			if n == len(s) || r < 0x20 {
+				return n
+			}
+		case isRegionalIndicator(r) && isRegionalIndicator(first) && n == utf8.RuneLen(first):
+			// Flags are pairs of regional indicators.
+		default:
+			return n
+		}
+		n += size
+	}
+	return n
+}
+
+// prevGrapheme returns the length in bytes of the grapheme cluster s ends
+// with.
+func prevGrapheme(s string) int {
+	start := 0
+	for start < len(s) {
+		n := nextGrapheme(s[start:])
+		if start+n >= len(s) {
+			return len(s) - start
+		}
+		start += n
+	}
+	return 0
+}
+
+// graphemeStart returns the largest offset in s that's at most n and isn't
+// inside a grapheme cluster, so s can be cut there.
+func graphemeStart(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+	start := 0
+	for start < n {
+		size := nextGrapheme(s[start:])
+		if start+size > n {
+			break
+		}
+		start += size
+	}
+	return start
+}
+
+// truncateWidth returns the longest start of s that takes up at most width
+// columns, cut between grapheme clusters.
+func truncateWidth(s string, width int) string {
+	used := 0
+	for i := 0; i < len(s); {
+		n := nextGrapheme(s[i:])
+		w := graphemeWidth(s[i : i+n])
+		if used+w > width {
+			return s[:i]
+		}
+		used += w
+		i += n
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package pry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringWidth(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		s     string
+		width int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"日本語", 6},
+		{"ｆｕｌｌ", 8},
+		{"e\u0301", 1},
+		{"🎉", 2},
+		{"👍🏽", 2},
+		{"👩‍💻", 2},
+		{"🇫🇷", 2},
+		{"❤️", 2},
+		{"a\tb", 2},
+		{"x := \"日本\" // 🎉", 17},
+	}
+	for _, c := range cases {
+		if out := stringWidth(c.s); out != c.width {
+			t.Errorf("stringWidth(%q) = %d; expected %d", c.s, out, c.width)
+		}
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		s    string
+		want []string
+	}{
+		{"ab", []string{"a", "b"}},
+		{"e\u0301x", []string{"e\u0301", "x"}},
+		{"日本", []string{"日", "本"}},
+		{"👩‍💻👍🏽", []string{"👩‍💻", "👍🏽"}},
+		{"🇫🇷🇩🇪", []string{"🇫🇷", "🇩🇪"}},
+		{"a\r\nb", []string{"a", "\r\n", "b"}},
+		{"\xffa", []string{"\xff", "a"}},
+		{"a\u200d", []string{"a\u200d"}},
+	}
+	for _, c := range cases {
+		var clusters []string
+		for s := c.s; len(s) > 0; {
+			n := nextGrapheme(s)
+			clusters = append(clusters, s[:n])
+			s = s[n:]
+		}
+		if !reflect.DeepEqual(clusters, c.want) {
+			t.Errorf("%q: Expected %q got %q.", c.s, c.want, clusters)
+		}
+		if n := prevGrapheme(c.s); c.s[len(c.s)-n:] != c.want[len(c.want)-1] {
+			t.Errorf("%q: Expected it to end with %q got %q.", c.s, c.want[len(c.want)-1], c.s[len(c.s)-n:])
+		}
+	}
+
+	// Strings are cut between clusters.
+	if n := graphemeStart("ae\u0301b", 2); n != 1 {
+		t.Errorf("Expected 1 got %d.", n)
+	}
+	if n := graphemeStart("日本", 4); n != 3 {
+		t.Errorf("Expected 3 got %d.", n)
+	}
+	for _, c := range []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"日本語", 5, "日本"},
+		{"ae\u0301b", 2, "ae\u0301"},
+		{"🎉a", 1, ""},
+		{"abc", 5, "abc"},
+	} {
+		if out := truncateWidth(c.s, c.width); out != c.want {
+			t.Errorf("truncateWidth(%q, %d) = %q; expected %q", c.s, c.width, out, c.want)
+		}
+	}
+}